@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+
+	// Register the egsql driver.
+	_ "github.com/nao1215/egsql/egsql-drv"
+	"github.com/spf13/cobra"
+)
+
+var queryCmd = &cobra.Command{
+	Use:   "query SQL",
+	Short: "Execute the SQL and print the rows, e.g. the plan of EXPLAIN",
+	Long: `Execute the SQL and print the column names and the rows separated by tabs.
+
+EXPLAIN prints the plan of SELECT, INSERT, UPDATE and DELETE statements,
+including INSERT ... SELECT and ON CONFLICT. EXPLAIN ANALYZE executes the
+statement, so EXPLAIN ANALYZE INSERT, UPDATE and DELETE change the rows.
+Other statements can not be explained.
+
+egsql persists only the catalog in the home directory, and the rows are held
+in memory. Each run of this command opens the database again, so the rows
+inserted by one run are not seen by the next; only DDL (e.g. CREATE TABLE)
+and sequences persist between runs.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		dsn, err := cmd.Flags().GetString("dsn")
+		if err != nil {
+			exitError(err)
+		}
+		if err := query(dsn, args[0]); err != nil {
+			exitError(err)
+		}
+	},
+}
+
+func init() {
+	queryCmd.Flags().StringP("dsn", "d", "", "egsql home directory with the options, e.g. path?search_path=public (default: $EGSQL_HOME or ~/.egsql)")
+	rootCmd.AddCommand(queryCmd)
+}
+
+// query executes the SQL and prints the column names and the rows separated by tabs.
+func query(dsn, sqlText string) error {
+	db, err := sql.Open("egsql", dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(sqlText)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stdout, strings.Join(columns, "\t"))
+
+	values := make([]interface{}, len(columns))
+	for i := range values {
+		values[i] = new(sql.NullString)
+	}
+	for rows.Next() {
+		if err := rows.Scan(values...); err != nil {
+			return err
+		}
+		fields := make([]string, len(values))
+		for i, v := range values {
+			if s := v.(*sql.NullString); s.Valid {
+				fields[i] = s.String
+			} else {
+				fields[i] = "NULL"
+			}
+		}
+		fmt.Fprintln(os.Stdout, strings.Join(fields, "\t"))
+	}
+	return rows.Err()
+}
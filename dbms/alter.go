@@ -0,0 +1,217 @@
+package dbms
+
+import (
+	"github.com/nao1215/egsql/dbms/meta"
+	"github.com/nao1215/egsql/dbms/storage"
+	"github.com/nao1215/egsql/misc/errfmt"
+)
+
+// AddColumn adds the column to the end of the table. The existing rows
+// get the default value (NULL if defaultValue is nil).
+func (db *EgSQLDB) AddColumn(tableName, column string, dataType meta.DataType, defaultValue interface{}) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	s, err := db.alterable(tableName)
+	if err != nil {
+		return err
+	}
+	if err := s.AddColumn(column, dataType); err != nil {
+		return errfmt.Wrap(err, column)
+	}
+	if err := s.SetDefault(column, defaultValue); err != nil {
+		return errfmt.Wrap(err, column)
+	}
+
+	v := s.DefaultValue(column)
+	return db.applySchemes(map[string]*meta.Scheme{tableName: s}, nil, tableName, func(row storage.Row) storage.Row {
+		return append(append(storage.Row{}, row...), v)
+	})
+}
+
+// DropColumn removes the column and the constraints and indexes that include it
+// from the table. The column referenced by the FOREIGN KEY constraint of
+// other tables can not be dropped.
+func (db *EgSQLDB) DropColumn(tableName, column string) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	s, err := db.alterable(tableName)
+	if err != nil {
+		return err
+	}
+	for _, child := range db.catalog.ReferencedBy(tableName) {
+		if child.TableName != tableName && child.References(tableName, column) {
+			return errfmt.Wrap(ErrDependentObject, column+" is referenced by "+child.TableName)
+		}
+	}
+	pos := s.ColumnIndex(column)
+	if err := s.DropColumn(column); err != nil {
+		return errfmt.Wrap(err, column)
+	}
+
+	return db.applySchemes(map[string]*meta.Scheme{tableName: s}, nil, tableName, func(row storage.Row) storage.Row {
+		return append(append(storage.Row{}, row[:pos]...), row[pos+1:]...)
+	})
+}
+
+// RenameColumn renames the column. The FOREIGN KEY constraints of other tables
+// referencing the column follow the new name.
+func (db *EgSQLDB) RenameColumn(tableName, oldName, newName string) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	s, err := db.alterable(tableName)
+	if err != nil {
+		return err
+	}
+	if err := s.RenameColumn(oldName, newName); err != nil {
+		return errfmt.Wrap(err, oldName)
+	}
+
+	schemes := map[string]*meta.Scheme{tableName: s}
+	for _, child := range db.catalog.ReferencedBy(tableName) {
+		if child.TableName == tableName || !child.References(tableName, oldName) {
+			continue
+		}
+		c, err := db.alterable(child.TableName)
+		if err != nil {
+			return err
+		}
+		c.RenameRefColumn(tableName, oldName, newName)
+		schemes[child.TableName] = c
+	}
+	return db.applySchemes(schemes, nil, "", nil)
+}
+
+// RenameTable renames the table. The FOREIGN KEY constraints of other tables
+// referencing the table follow the new name, and the identity sequence owned
+// by the table is renamed to "<new table>_<column>_seq", so that a new table
+// of the old name gets its own sequence of the usual name.
+func (db *EgSQLDB) RenameTable(oldName, newName string) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	s, err := db.alterable(oldName)
+	if err != nil {
+		return err
+	}
+	if db.catalog.HasScheme(newName) {
+		return errfmt.Wrap(ErrExistTable, newName)
+	}
+	s.Rename(newName)
+
+	var seqs map[string]*meta.Sequence
+	if id := s.Identity; id != nil {
+		if seq := db.catalog.FetchSequence(id.Sequence); seq != nil && seq.OwnedBy == oldName {
+			renamed := *seq
+			renamed.Name = db.uniqueSequenceName(newName + "_" + id.Column + "_seq")
+			renamed.OwnedBy = newName
+			id.Sequence = renamed.Name
+			seqs = map[string]*meta.Sequence{seq.Name: &renamed}
+		}
+	}
+
+	schemes := map[string]*meta.Scheme{oldName: s}
+	for _, child := range db.catalog.ReferencedBy(oldName) {
+		if child.TableName == oldName {
+			continue
+		}
+		c, err := db.alterable(child.TableName)
+		if err != nil {
+			return err
+		}
+		c.RenameRefTable(oldName, newName)
+		schemes[child.TableName] = c
+	}
+	return db.applySchemes(schemes, seqs, "", nil)
+}
+
+// SetColumnDefault changes the default value of the column.
+// If value is nil, the default value is removed.
+func (db *EgSQLDB) SetColumnDefault(tableName, column string, value interface{}) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	s, err := db.alterable(tableName)
+	if err != nil {
+		return err
+	}
+	if err := s.SetDefault(column, value); err != nil {
+		return errfmt.Wrap(err, column)
+	}
+	return db.applySchemes(map[string]*meta.Scheme{tableName: s}, nil, "", nil)
+}
+
+// alterable returns the copy of the scheme of the table to be changed.
+// The table changed by a transaction in progress can not be altered
+// because the undo log has the rows in the old format.
+func (db *EgSQLDB) alterable(tableName string) (*meta.Scheme, error) {
+	s := db.catalog.FetchScheme(tableName)
+	if s == nil {
+		return nil, errfmt.Wrap(ErrNotExistTable, tableName)
+	}
+	if err := db.checkNotInUse(tableName); err != nil {
+		return nil, err
+	}
+	return s.Clone(), nil
+}
+
+// checkNotInUse checks that no transaction in progress has changed the table.
+func (db *EgSQLDB) checkNotInUse(tableName string) error {
+	for tx := range db.txs {
+		if tx.changed(tableName) {
+			return errfmt.Wrap(ErrTableInUse, tableName)
+		}
+	}
+	return nil
+}
+
+// applySchemes replaces the schemes with the changed schemes, and the
+// sequences with the changed sequences. Key of schemes and seqs is the name
+// before the change. The rows of the table named rewrite are converted by
+// convert, and the other tables keep their rows.
+//
+// The new tables are built in memory and the catalog is persisted before the
+// database is changed, so if any step fails, neither the tables nor the
+// catalog file is changed. Only the catalog file is persisted; it is replaced
+// atomically, so after a crash it has either all changes or none of them.
+// The rows are held in memory only (see NewEgSQLDB).
+func (db *EgSQLDB) applySchemes(schemes map[string]*meta.Scheme, seqs map[string]*meta.Sequence, rewrite string, convert func(row storage.Row) storage.Row) error {
+	tables := make(map[string]*storage.Table, len(schemes))
+	for name, s := range schemes {
+		var fn func(row storage.Row) storage.Row
+		if name == rewrite {
+			fn = convert
+		}
+		t, err := db.tables[name].Rebuild(s, fn)
+		if err != nil {
+			return err
+		}
+		tables[name] = t
+	}
+
+	next := db.catalog.Copy()
+	for name, s := range schemes {
+		next.Replace(name, s)
+	}
+	for name, seq := range seqs {
+		next.ReplaceSequence(name, seq)
+	}
+	if err := storage.SaveCatalog(db.homeDir, next); err != nil {
+		return err
+	}
+
+	for name, s := range schemes {
+		db.catalog.Replace(name, s)
+		delete(db.tables, name)
+	}
+	for name, seq := range seqs {
+		db.catalog.ReplaceSequence(name, seq)
+	}
+	for name, t := range tables {
+		db.tables[schemes[name].TableName] = t
+	}
+	db.version++
+	return nil
+}
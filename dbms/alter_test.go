@@ -0,0 +1,245 @@
+package dbms
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nao1215/egsql/dbms/meta"
+	"github.com/nao1215/egsql/dbms/storage"
+)
+
+func TestEgSQLDB_AlterTable(t *testing.T) {
+	tests := []struct {
+		name      string
+		sql       []string
+		table     string
+		want      []storage.Row
+		wantErr   error
+		wantTable []string
+	}{
+		{
+			name:  "[Success] add column with default",
+			sql:   []string{"ALTER TABLE users ADD COLUMN age INT DEFAULT 20", "INSERT INTO users (id) VALUES (13)"},
+			table: "users",
+			want: []storage.Row{
+				{int64(10), int64(1), int64(20)}, {int64(11), int64(1), int64(20)},
+				{int64(12), nil, int64(20)}, {int64(13), int64(0), int64(20)},
+			},
+		},
+		{
+			name:  "[Success] drop column",
+			sql:   []string{"ALTER TABLE users DROP COLUMN group_id"},
+			table: "users",
+			want:  []storage.Row{{int64(10)}, {int64(11)}, {int64(12)}},
+		},
+		{
+			name:  "[Success] set and drop default",
+			sql:   []string{"ALTER TABLE users ALTER COLUMN group_id SET DEFAULT 2", "INSERT INTO users (id) VALUES (13)", "ALTER TABLE users ALTER group_id DROP DEFAULT", "INSERT INTO users (id) VALUES (14)"},
+			table: "users",
+			want: []storage.Row{
+				{int64(10), int64(1)}, {int64(11), int64(1)}, {int64(12), nil},
+				{int64(13), int64(2)}, {int64(14), nil},
+			},
+		},
+		{
+			name:  "[Success] rename referenced table and column",
+			sql:   []string{"ALTER TABLE groups RENAME TO teams", "ALTER TABLE teams RENAME COLUMN id TO team_id", "INSERT INTO users VALUES (13, 2)"},
+			table: "users",
+			want: []storage.Row{
+				{int64(10), int64(1)}, {int64(11), int64(1)}, {int64(12), nil}, {int64(13), int64(2)},
+			},
+			wantTable: []string{"teams", "users"},
+		},
+		{
+			name:    "[Error] drop referenced column",
+			sql:     []string{"ALTER TABLE groups DROP COLUMN id"},
+			wantErr: ErrDependentObject,
+		},
+		{
+			name:    "[Error] drop primary key column",
+			sql:     []string{"ALTER TABLE users DROP COLUMN id"},
+			wantErr: meta.ErrDropKeyColumn,
+		},
+		{
+			name:    "[Error] rename to existing table",
+			sql:     []string{"ALTER TABLE groups RENAME TO users"},
+			wantErr: ErrExistTable,
+		},
+		{
+			name:    "[Error] default type mismatch",
+			sql:     []string{"ALTER TABLE users ADD COLUMN age INT DEFAULT 'twenty'"},
+			wantErr: meta.ErrInvalidDefault,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t, meta.ForeignKey{})
+			setup(t, db)
+
+			for _, sql := range tt.sql {
+				if _, err := execSQL(t, db, sql); err != nil {
+					if !errors.Is(err, tt.wantErr) {
+						t.Fatalf("Exec(%q) error = %v, wantErr %v", sql, err, tt.wantErr)
+					}
+					return
+				}
+			}
+			if tt.wantErr != nil {
+				t.Fatalf("Exec() error = nil, wantErr %v", tt.wantErr)
+			}
+			if diff := cmp.Diff(tt.want, rows(db, tt.table)); diff != "" {
+				t.Errorf("rows mismatch (-want +got):\n%s", diff)
+			}
+
+			// The changed schemes are persisted.
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+			reopened, err := NewEgSQLDB(db.homeDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(db.catalog.Schemes, reopened.catalog.Schemes); diff != "" {
+				t.Errorf("persisted catalog mismatch (-want +got):\n%s", diff)
+			}
+			for _, name := range tt.wantTable {
+				if db.Table(name) == nil {
+					t.Errorf("table %s does not exist", name)
+				}
+			}
+		})
+	}
+}
+
+func TestEgSQLDB_AlterTable_RenameFollowsForeignKey(t *testing.T) {
+	db := newTestDB(t, meta.ForeignKey{OnDelete: meta.Cascade})
+	setup(t, db)
+
+	if err := db.RenameTable("groups", "teams"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.RenameColumn("teams", "id", "team_id"); err != nil {
+		t.Fatal(err)
+	}
+	fk := db.catalog.FetchScheme("users").ForeignKeys[0]
+	if fk.RefTable != "teams" || !meta.KeyColumns(fk.RefColumns).Equal([]string{"team_id"}) {
+		t.Fatalf("foreign key = %+v, want reference to teams(team_id)", fk)
+	}
+
+	err := exec(db, func(w *Writer) error {
+		teams, err := w.Table("teams")
+		if err != nil {
+			return err
+		}
+		rowIDs, err := teams.Lookup("teams_pkey", storage.Row{int64(1)})
+		if err != nil {
+			return err
+		}
+		return w.Delete("teams", rowIDs[0])
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]storage.Row{{int64(12), nil}}, rows(db, "users")); diff != "" {
+		t.Errorf("rows mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestEgSQLDB_AlterTable_RenameIndexes(t *testing.T) {
+	db := newTestDB(t, meta.ForeignKey{})
+	for _, sql := range []string{
+		"ALTER TABLE groups RENAME TO teams",
+		"ALTER TABLE users RENAME TO members",
+		"CREATE TABLE groups (id INT PRIMARY KEY, name TEXT UNIQUE)",
+		"CREATE TABLE users (id INT PRIMARY KEY, group_id INT REFERENCES groups)",
+	} {
+		if _, err := execSQL(t, db, sql); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := map[string][]string{}
+	for _, name := range []string{"teams", "members", "groups", "users"} {
+		for _, idx := range db.catalog.FetchScheme(name).Indexes {
+			got[name] = append(got[name], idx.Name)
+		}
+	}
+	want := map[string][]string{
+		"teams":   {"teams_pkey"},
+		"members": {"members_pkey", "members_group_id_fkey"},
+		"groups":  {"groups_pkey", "groups_name_key"},
+		"users":   {"users_pkey", "users_group_id_fkey"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("index names mismatch (-want +got):\n%s", diff)
+	}
+
+	// The renamed indexes still enforce the constraints.
+	if _, err := execSQL(t, db, "INSERT INTO members VALUES (10, 9)"); !errors.Is(err, ErrForeignKeyViolation) {
+		t.Errorf("Exec() error = %v, wantErr %v", err, ErrForeignKeyViolation)
+	}
+	if _, err := execSQL(t, db, "INSERT INTO teams VALUES (1, 'a'), (1, 'b')"); !errors.Is(err, storage.ErrDuplicateKey) {
+		t.Errorf("Exec() error = %v, wantErr %v", err, storage.ErrDuplicateKey)
+	}
+}
+
+func TestEgSQLDB_AlterTable_RenameIdentitySequence(t *testing.T) {
+	db, err := NewEgSQLDB(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sql := range []string{
+		"CREATE TABLE t (id INT PRIMARY KEY AUTOINCREMENT, v TEXT)",
+		"INSERT INTO t (v) VALUES ('old')",
+		"ALTER TABLE t RENAME TO t_old",
+		"CREATE TABLE t (id INT PRIMARY KEY AUTOINCREMENT, v TEXT)",
+	} {
+		if _, err := execSQL(t, db, sql); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := db.catalog.FetchScheme("t_old").Identity.Sequence; got != "t_old_id_seq" {
+		t.Errorf("renamed identity sequence = %q, want %q", got, "t_old_id_seq")
+	}
+	if seq := db.catalog.FetchSequence("t_old_id_seq"); seq == nil || seq.OwnedBy != "t_old" {
+		t.Errorf("renamed identity sequence = %+v, want owned by t_old", seq)
+	}
+
+	// The tables have their own counters, even after the old table is dropped.
+	if _, err := execSQL(t, db, "DROP TABLE t_old"); err != nil {
+		t.Fatal(err)
+	}
+	id, err := execSQL(t, db, "INSERT INTO t (v) VALUES ('new')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 1 {
+		t.Errorf("LastInsertID = %d, want 1", id)
+	}
+	if db.catalog.HasSequence("t_old_id_seq") {
+		t.Error("identity sequence of the dropped table is left")
+	}
+}
+
+func TestEgSQLDB_AlterTable_InUse(t *testing.T) {
+	db := newTestDB(t, meta.ForeignKey{})
+	tx := db.Begin()
+	err := tx.Statement(func(w *Writer) error {
+		_, err := w.Insert("groups", storage.Row{int64(1), "admin"})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.DropColumn("groups", "name"); !errors.Is(err, ErrTableInUse) {
+		t.Errorf("DropColumn() error = %v, want %v", err, ErrTableInUse)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DropColumn("groups", "name"); err != nil {
+		t.Errorf("DropColumn() error = %v after rollback", err)
+	}
+}
@@ -0,0 +1,65 @@
+package dbms
+
+import (
+	"github.com/nao1215/egsql/dbms/meta"
+	"github.com/nao1215/egsql/dbms/query"
+	"github.com/nao1215/egsql/dbms/storage"
+	"github.com/nao1215/egsql/misc/errfmt"
+)
+
+// execAnalyze executes ANALYZE statement.
+func (db *EgSQLDB) execAnalyze(sess *Session, stmt *query.AnalyzeStmt) (*meta.ResultSet, error) {
+	var tables []string
+	if stmt.Table != nil {
+		table, err := db.resolveTable(sess, *stmt.Table)
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	if err := db.Analyze(tables...); err != nil {
+		return nil, err
+	}
+	return meta.NewResultSet("ANALYZE"), nil
+}
+
+// Analyze collects the statistics of the tables and persists them in
+// the catalog. If no table is specified, all tables are analyzed.
+// The planner estimates the costs of the plans with the statistics,
+// so the prepared statements are planned again after it.
+func (db *EgSQLDB) Analyze(tableNames ...string) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if len(tableNames) == 0 {
+		for _, s := range db.catalog.Schemes {
+			tableNames = append(tableNames, s.TableName)
+		}
+	}
+	stats := make([]*meta.TableStats, 0, len(tableNames))
+	for _, name := range tableNames {
+		t, ok := db.tables[name]
+		if !ok {
+			return errfmt.Wrap(ErrNotExistTable, name)
+		}
+		var rows [][]interface{}
+		t.Scan(func(_ int64, row storage.Row) bool {
+			rows = append(rows, row)
+			return true
+		})
+		stats = append(stats, meta.NewTableStats(t.Scheme(), rows))
+	}
+
+	next := db.catalog.Copy()
+	for _, s := range stats {
+		next.SetStats(s)
+	}
+	if err := storage.SaveCatalog(db.homeDir, next); err != nil {
+		return err
+	}
+	for _, s := range stats {
+		db.catalog.SetStats(s)
+	}
+	db.version++
+	return nil
+}
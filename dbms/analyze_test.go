@@ -0,0 +1,247 @@
+package dbms
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nao1215/egsql/dbms/expr"
+	"github.com/nao1215/egsql/dbms/query"
+)
+
+func TestEgSQLDB_Analyze(t *testing.T) {
+	home := t.TempDir()
+	db, err := NewEgSQLDB(home)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sql := range []string{
+		"CREATE TABLE users (id INT PRIMARY KEY, name TEXT)",
+		"CREATE TABLE groups (id INT PRIMARY KEY)",
+		"INSERT INTO users VALUES (1, 'alice'), (2, 'bob'), (3, NULL), (4, 'bob')",
+	} {
+		if _, err := execSQL(t, db, sql); err != nil {
+			t.Fatal(err)
+		}
+	}
+	statsSQL := "SELECT table_name, column_name, row_count, null_count, distinct_count, histogram FROM egsql_column_stats"
+
+	t.Run("[Success] no statistics before ANALYZE", func(t *testing.T) {
+		if rows := querySQL(t, db, statsSQL).Rows; len(rows) != 0 {
+			t.Errorf("rows = %v, want none", rows)
+		}
+	})
+
+	t.Run("[Success] analyze table", func(t *testing.T) {
+		version := db.Version()
+		if _, err := execSQL(t, db, "ANALYZE users"); err != nil {
+			t.Fatal(err)
+		}
+		if db.Version() == version {
+			t.Error("ANALYZE does not change the version")
+		}
+		want := [][]interface{}{
+			{"users", "id", int64(4), int64(0), int64(4), "1,2,3,4"},
+			{"users", "name", int64(4), int64(1), int64(2), "alice,bob,bob"},
+		}
+		if diff := cmp.Diff(want, querySQL(t, db, statsSQL).Rows); diff != "" {
+			t.Errorf("mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("[Success] analyze all tables and persist", func(t *testing.T) {
+		if _, err := execSQL(t, db, "ANALYZE"); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+		reopened, err := NewEgSQLDB(home)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := [][]interface{}{
+			{"groups", "id", int64(0), int64(0), int64(0), ""},
+			{"users", "id", int64(4), int64(0), int64(4), "1,2,3,4"},
+			{"users", "name", int64(4), int64(1), int64(2), "alice,bob,bob"},
+		}
+		if diff := cmp.Diff(want, querySQL(t, reopened, statsSQL).Rows); diff != "" {
+			t.Errorf("mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("[Success] statistics are dropped with the table", func(t *testing.T) {
+		if _, err := execSQL(t, db, "DROP TABLE groups"); err != nil {
+			t.Fatal(err)
+		}
+		if db.Catalog().FetchStats("groups") != nil {
+			t.Error("statistics of the dropped table remain")
+		}
+	})
+
+	t.Run("[Error] analyze not exist table", func(t *testing.T) {
+		if _, err := execSQL(t, db, "ANALYZE roles"); !errors.Is(err, ErrNotExistTable) {
+			t.Errorf("error = %v, want %v", err, ErrNotExistTable)
+		}
+	})
+}
+
+// newJoinTestDB returns the database of the tables with the rows of the
+// different sizes: users has 100 rows, groups has 5 rows and orders has 300
+// rows, and each order belongs to the user and each user to the group.
+func newJoinTestDB(t *testing.T) *EgSQLDB {
+	t.Helper()
+
+	db, err := NewEgSQLDB(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sql := range []string{
+		"CREATE TABLE groups (id INT PRIMARY KEY, name TEXT)",
+		"CREATE TABLE users (id INT PRIMARY KEY, group_id INT, name TEXT UNIQUE)",
+		"CREATE TABLE orders (id INT PRIMARY KEY, user_id INT, amount INT)",
+	} {
+		if _, err := execSQL(t, db, sql); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 1; i <= 5; i++ {
+		if _, err := execSQL(t, db, "INSERT INTO groups VALUES (?, ?)", int64(i), fmt.Sprintf("g%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 1; i <= 100; i++ {
+		if _, err := execSQL(t, db, "INSERT INTO users VALUES (?, ?, ?)", int64(i), int64(i%5+1), fmt.Sprintf("u%03d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 1; i <= 300; i++ {
+		if _, err := execSQL(t, db, "INSERT INTO orders VALUES (?, ?, ?)", int64(i), int64(i%100+1), int64(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func TestEgSQLDB_SelectOptimized(t *testing.T) {
+	db := newJoinTestDB(t)
+
+	tests := []struct {
+		name string
+		sql  string
+		want [][]interface{}
+	}{
+		{
+			name: "[Success] index scan by primary key",
+			sql:  "SELECT id, name FROM users WHERE id = 7",
+			want: [][]interface{}{{int64(7), "u007"}},
+		},
+		{
+			name: "[Success] index scan by parameter and filter",
+			sql:  "SELECT id FROM users WHERE name = ? AND group_id = 2",
+			want: [][]interface{}{{int64(1)}},
+		},
+		{
+			name: "[Success] join with the conditions of WHERE clause",
+			sql: "SELECT g.name, u.name, o.amount FROM orders o, users u, groups g " +
+				"WHERE o.user_id = u.id AND u.group_id = g.id AND g.name = 'g3' AND o.amount > 290 ORDER BY o.amount",
+			want: [][]interface{}{{"g3", "u092", int64(291)}, {"g3", "u097", int64(296)}},
+		},
+		{
+			name: "[Success] join with the conditions of ON clause",
+			sql: "SELECT count(*) FROM orders o JOIN users u ON o.user_id = u.id " +
+				"JOIN groups g ON u.group_id = g.id AND g.id = 1",
+			want: [][]interface{}{{int64(60)}},
+		},
+		{
+			name: "[Success] star is expanded in the written order",
+			sql:  "SELECT * FROM orders o JOIN users u ON o.user_id = u.id JOIN groups g ON g.id = u.group_id WHERE o.id = 1",
+			want: [][]interface{}{{int64(1), int64(2), int64(1), int64(2), int64(3), "u002", int64(3), "g3"}},
+		},
+		{
+			name: "[Success] outer join is not reordered",
+			sql:  "SELECT g.id, u.id FROM groups g LEFT JOIN users u ON u.group_id = g.id AND u.id < 3 WHERE g.id < 4 ORDER BY g.id",
+			want: [][]interface{}{{int64(1), nil}, {int64(2), int64(1)}, {int64(3), int64(2)}},
+		},
+		{
+			name: "[Success] condition with subquery is evaluated after the join",
+			sql: "SELECT u.id FROM users u JOIN groups g ON u.group_id = g.id " +
+				"WHERE g.id = (SELECT max(id) FROM groups) AND u.id < 10 ORDER BY u.id",
+			want: [][]interface{}{{int64(4)}, {int64(9)}},
+		},
+	}
+	for _, analyzed := range []bool{false, true} {
+		if analyzed {
+			if _, err := execSQL(t, db, "ANALYZE"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, tt := range tests {
+			t.Run(fmt.Sprintf("%s (analyzed: %v)", tt.name, analyzed), func(t *testing.T) {
+				rs := querySQL(t, db, tt.sql, "u001")
+				if diff := cmp.Diff(tt.want, rs.Rows); diff != "" {
+					t.Errorf("mismatch (-want +got):\n%s", diff)
+				}
+			})
+		}
+	}
+}
+
+func TestEgSQLDB_PlanOptimized(t *testing.T) {
+	db := newJoinTestDB(t)
+
+	// planFromWhere returns the plan of FROM clause and the tables in the order of the join.
+	planFromWhere := func(t *testing.T, sql string) (string, []string) {
+		t.Helper()
+		stmt, _, err := query.Parse(sql)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := stmt.(*query.SelectStmt)
+		p := &planner{db: db, sess: NewSession(), env: &expr.Env{}}
+		from, _, err := p.planFromWhere(s.From, s.Where)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var tables []string
+		for _, c := range from.columns {
+			if len(tables) == 0 || tables[len(tables)-1] != c.Table {
+				tables = append(tables, c.Table)
+			}
+		}
+		return fmt.Sprintf("%T", from.plan), tables
+	}
+
+	t.Run("[Success] access path", func(t *testing.T) {
+		tests := []struct {
+			sql  string
+			want string
+		}{
+			{sql: "SELECT * FROM users WHERE id = 1", want: "*executor.IndexScan"},
+			{sql: "SELECT * FROM users WHERE 1 = id AND group_id = 1", want: "*executor.Filter"},
+			{sql: "SELECT * FROM users WHERE id < 3", want: "*executor.Filter"},
+			{sql: "SELECT * FROM users", want: "*executor.Values"},
+		}
+		for _, tt := range tests {
+			if got, _ := planFromWhere(t, tt.sql); got != tt.want {
+				t.Errorf("plan of %q = %s, want %s", tt.sql, got, tt.want)
+			}
+		}
+	})
+
+	sql := "SELECT * FROM orders o, users u, groups g WHERE o.user_id = u.id AND u.group_id = g.id AND g.name = 'g1'"
+	t.Run("[Success] written order without statistics", func(t *testing.T) {
+		if _, got := planFromWhere(t, sql); !cmp.Equal(got, []string{"o", "u", "g"}) {
+			t.Errorf("join order = %v", got)
+		}
+	})
+	t.Run("[Success] join order by statistics", func(t *testing.T) {
+		if _, err := execSQL(t, db, "ANALYZE"); err != nil {
+			t.Fatal(err)
+		}
+		if _, got := planFromWhere(t, sql); !cmp.Equal(got, []string{"g", "u", "o"}) {
+			t.Errorf("join order = %v", got)
+		}
+	})
+}
@@ -0,0 +1,249 @@
+package dbms
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/nao1215/egsql/dbms/expr"
+	"github.com/nao1215/egsql/misc/errfmt"
+)
+
+// timestampLayout is the text format of the timestamps that the date/time
+// functions return. The functions take the timestamps in this format, RFC 3339
+// or the date only format.
+const timestampLayout = "2006-01-02 15:04:05"
+
+// now returns the current time. It is replaced in the tests.
+var now = time.Now
+
+// builtinFunctions is the scalar functions available in every database.
+var builtinFunctions = []*Function{
+	// String functions.
+	{Name: "lower", Params: []expr.Type{expr.Varchar}, MinArgs: 1, Result: expr.Varchar, Deterministic: true,
+		Fn: func(args []interface{}) (interface{}, error) { return strings.ToLower(args[0].(string)), nil }},
+	{Name: "upper", Params: []expr.Type{expr.Varchar}, MinArgs: 1, Result: expr.Varchar, Deterministic: true,
+		Fn: func(args []interface{}) (interface{}, error) { return strings.ToUpper(args[0].(string)), nil }},
+	{Name: "length", Params: []expr.Type{expr.Varchar}, MinArgs: 1, Result: expr.Int, Deterministic: true,
+		Fn: func(args []interface{}) (interface{}, error) {
+			return int64(utf8.RuneCountInString(args[0].(string))), nil
+		}},
+	{Name: "substr", Params: []expr.Type{expr.Varchar, expr.Int, expr.Int}, MinArgs: 2, Result: expr.Varchar, Deterministic: true,
+		Fn: substr},
+	{Name: "trim", Params: []expr.Type{expr.Varchar, expr.Varchar}, MinArgs: 1, Result: expr.Varchar, Deterministic: true,
+		Fn: trimFunc(strings.Trim)},
+	{Name: "ltrim", Params: []expr.Type{expr.Varchar, expr.Varchar}, MinArgs: 1, Result: expr.Varchar, Deterministic: true,
+		Fn: trimFunc(strings.TrimLeft)},
+	{Name: "rtrim", Params: []expr.Type{expr.Varchar, expr.Varchar}, MinArgs: 1, Result: expr.Varchar, Deterministic: true,
+		Fn: trimFunc(strings.TrimRight)},
+	{Name: "replace", Params: []expr.Type{expr.Varchar, expr.Varchar, expr.Varchar}, MinArgs: 3, Result: expr.Varchar, Deterministic: true,
+		Fn: func(args []interface{}) (interface{}, error) {
+			s, from := args[0].(string), args[1].(string)
+			if from == "" {
+				return s, nil
+			}
+			return strings.ReplaceAll(s, from, args[2].(string)), nil
+		}},
+
+	// Conditional functions.
+	{Name: "coalesce", Params: []expr.Type{expr.Unknown}, MinArgs: 1, Variadic: true, Deterministic: true, CalledOnNull: true,
+		Fn: func(args []interface{}) (interface{}, error) {
+			for _, v := range args {
+				if v != nil {
+					return v, nil
+				}
+			}
+			return nil, nil
+		}},
+	{Name: "nullif", Params: []expr.Type{expr.Unknown, expr.Unknown}, MinArgs: 2, Deterministic: true, CalledOnNull: true,
+		Fn: func(args []interface{}) (interface{}, error) {
+			if args[0] == nil || args[1] == nil {
+				return args[0], nil
+			}
+			c, err := expr.Compare(args[0], args[1])
+			if err != nil || c == 0 {
+				return nil, err
+			}
+			return args[0], nil
+		}},
+
+	// Math functions.
+	{Name: "abs", Params: []expr.Type{expr.Int}, MinArgs: 1, Result: expr.Int, Deterministic: true,
+		Fn: func(args []interface{}) (interface{}, error) {
+			x := args[0].(int64)
+			if x == math.MinInt64 {
+				return nil, errfmt.Wrap(expr.ErrOutOfRange, "abs("+strconv.FormatInt(x, 10)+")")
+			}
+			if x < 0 {
+				return -x, nil
+			}
+			return x, nil
+		}},
+	{Name: "sign", Params: []expr.Type{expr.Int}, MinArgs: 1, Result: expr.Int, Deterministic: true,
+		Fn: func(args []interface{}) (interface{}, error) {
+			switch x := args[0].(int64); {
+			case x > 0:
+				return int64(1), nil
+			case x < 0:
+				return int64(-1), nil
+			}
+			return int64(0), nil
+		}},
+	{Name: "round", Params: []expr.Type{expr.Int, expr.Int}, MinArgs: 1, Result: expr.Int, Deterministic: true,
+		Fn: round},
+
+	// Date/time functions. The timestamps are Varchar in timestampLayout.
+	{Name: "now", Result: expr.Varchar,
+		Fn: func(args []interface{}) (interface{}, error) { return now().UTC().Format(timestampLayout), nil }},
+	{Name: "date_trunc", Params: []expr.Type{expr.Varchar, expr.Varchar}, MinArgs: 2, Result: expr.Varchar, Deterministic: true,
+		Fn: dateTrunc},
+	{Name: "strftime", Params: []expr.Type{expr.Varchar, expr.Varchar}, MinArgs: 2, Result: expr.Varchar, Deterministic: true,
+		Fn: strftime},
+}
+
+// substr returns the substring of SUBSTR(s, start [, length]). The position is
+// 1-origin in characters, and the part before the first character is empty.
+func substr(args []interface{}) (interface{}, error) {
+	s := []rune(args[0].(string))
+	from := args[1].(int64)
+	to := int64(len(s)) + 1
+	if len(args) > 2 {
+		n := args[2].(int64)
+		if n < 0 {
+			return nil, errfmt.Wrap(ErrInvalidArgument, "negative substring length")
+		}
+		if from < to-n {
+			to = from + n
+		}
+	}
+	if from < 1 {
+		from = 1
+	}
+	if from >= to {
+		return "", nil
+	}
+	return string(s[from-1 : to-1]), nil
+}
+
+// trimFunc returns the function that removes the characters (default space)
+// from the string by trim.
+func trimFunc(trim func(s, cutset string) string) func(args []interface{}) (interface{}, error) {
+	return func(args []interface{}) (interface{}, error) {
+		cutset := " "
+		if len(args) > 1 {
+			cutset = args[1].(string)
+		}
+		return trim(args[0].(string), cutset), nil
+	}
+}
+
+// round rounds the integer to the digits of ROUND(x [, digits]). The negative
+// digits round it to the tens, hundreds and so on, half away from zero.
+func round(args []interface{}) (interface{}, error) {
+	x := args[0].(int64)
+	if len(args) < 2 || args[1].(int64) >= 0 {
+		return x, nil
+	}
+	digits := -args[1].(int64)
+	if digits > 18 {
+		return int64(0), nil
+	}
+	unit := int64(math.Pow10(int(digits)))
+	q, r := x/unit, x%unit
+	switch {
+	case r >= unit-r && r > 0:
+		q++
+	case -r >= unit+r && r < 0:
+		q--
+	}
+	if q > math.MaxInt64/unit || q < math.MinInt64/unit {
+		return nil, errfmt.Wrap(expr.ErrOutOfRange, "round")
+	}
+	return q * unit, nil
+}
+
+// parseTimestamp parses the timestamp text.
+func parseTimestamp(s string) (time.Time, error) {
+	for _, layout := range []string{timestampLayout, time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errfmt.Wrap(ErrInvalidArgument, "invalid timestamp '"+s+"'")
+}
+
+// dateTrunc truncates the timestamp of DATE_TRUNC(unit, timestamp) to the unit:
+// year, month, week (Monday), day, hour, minute or second.
+func dateTrunc(args []interface{}) (interface{}, error) {
+	t, err := parseTimestamp(args[1].(string))
+	if err != nil {
+		return nil, err
+	}
+	y, m, d := t.Date()
+	switch unit := strings.ToLower(args[0].(string)); unit {
+	case "year":
+		t = time.Date(y, 1, 1, 0, 0, 0, 0, t.Location())
+	case "month":
+		t = time.Date(y, m, 1, 0, 0, 0, 0, t.Location())
+	case "week":
+		t = time.Date(y, m, d-(int(t.Weekday())+6)%7, 0, 0, 0, 0, t.Location())
+	case "day":
+		t = time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+	case "hour":
+		t = t.Truncate(time.Hour)
+	case "minute":
+		t = t.Truncate(time.Minute)
+	case "second":
+		t = t.Truncate(time.Second)
+	default:
+		return nil, errfmt.Wrap(ErrInvalidArgument, "unknown unit '"+unit+"'")
+	}
+	return t.Format(timestampLayout), nil
+}
+
+// strftime formats the timestamp of STRFTIME(format, timestamp). The format
+// takes the substitutions of SQLite: %Y, %m, %d, %H, %M, %S, %j (day of year),
+// %w (day of week, Sunday is 0), %s (Unix time) and %%.
+func strftime(args []interface{}) (interface{}, error) {
+	t, err := parseTimestamp(args[1].(string))
+	if err != nil {
+		return nil, err
+	}
+	format := args[0].(string)
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 == len(format) {
+			b.WriteByte(format[i])
+			continue
+		}
+		i++
+		switch format[i] {
+		case 'Y':
+			b.WriteString(t.Format("2006"))
+		case 'm':
+			b.WriteString(t.Format("01"))
+		case 'd':
+			b.WriteString(t.Format("02"))
+		case 'H':
+			b.WriteString(t.Format("15"))
+		case 'M':
+			b.WriteString(t.Format("04"))
+		case 'S':
+			b.WriteString(t.Format("05"))
+		case 'j':
+			b.WriteString(fmt.Sprintf("%03d", t.YearDay()))
+		case 'w':
+			b.WriteString(strconv.Itoa(int(t.Weekday())))
+		case 's':
+			b.WriteString(strconv.FormatInt(t.Unix(), 10))
+		case '%':
+			b.WriteByte('%')
+		default:
+			return nil, errfmt.Wrap(ErrInvalidArgument, "unknown format '%"+string(format[i])+"'")
+		}
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,156 @@
+package dbms
+
+import (
+	"fmt"
+
+	"github.com/nao1215/egsql/dbms/executor"
+	"github.com/nao1215/egsql/dbms/expr"
+	"github.com/nao1215/egsql/dbms/query"
+	"github.com/nao1215/egsql/misc/errfmt"
+)
+
+// cte is the common table expression in scope. It is planned where it is
+// referenced, like the subquery in FROM clause, but it can not reference
+// the columns of the outer queries.
+type cte struct {
+	def       *query.CommonTableExpr
+	recursive bool
+	// work is the work table that the recursive reference reads while the
+	// recursive term is planned, or nil.
+	work *executor.WorkTable
+	// columns is the columns of the work table.
+	columns expr.Columns
+	// referenced is set to true if the recursive reference is planned.
+	referenced bool
+	// next is the common table expression declared before it, or in the outer query.
+	next *cte
+}
+
+// declareCTEs adds the common table expressions of WITH clause to the scope.
+func (p *planner) declareCTEs(defs []query.CommonTableExpr, recursive bool) error {
+	declared := make(map[string]bool)
+	for i := range defs {
+		if declared[defs[i].Name] {
+			return errfmt.Wrap(ErrDuplicateAlias, fmt.Sprintf("WITH query name %q is specified more than once", defs[i].Name))
+		}
+		declared[defs[i].Name] = true
+		p.ctes = &cte{def: &defs[i], recursive: recursive, next: p.ctes}
+	}
+	return nil
+}
+
+// lookupCTE returns the common table expression of the name, or nil.
+// The name qualified with the schema name is not a common table expression.
+func (p *planner) lookupCTE(name query.ObjectName) *cte {
+	if name.Schema != "" {
+		return nil
+	}
+	for c := p.ctes; c != nil; c = c.next {
+		if c.def.Name == name.Name {
+			return c
+		}
+	}
+	return nil
+}
+
+// planCTE plans the reference to the common table expression. Its columns
+// are qualified with the alias. The recursive reference in the recursive
+// term reads the work table.
+func (p *planner) planCTE(c *cte, alias string) (*relation, error) {
+	var r *relation
+	if c.work != nil {
+		c.referenced = true
+		r = newRelation(&executor.WorkTableScan{Table: c.work}, append(expr.Columns{}, c.columns...))
+	} else {
+		// The query does not see the common table expression itself and
+		// the ones declared after it.
+		sub := &planner{db: p.db, sess: p.sess, ctx: p.ctx, env: p.env, ctes: c.next, bound: p.bound}
+		var err error
+		if c.recursive && c.def.Select.SetOp != nil && c.def.Select.SetOp.Op == query.Union && len(c.def.Select.With) == 0 {
+			r, err = sub.planRecursive(c)
+		} else {
+			r, err = sub.planSelect(c.def.Select)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if r.columns, err = cteColumns(c.def, r.columns); err != nil {
+			return nil, err
+		}
+	}
+	for i := range r.columns {
+		r.columns[i].Table = alias
+	}
+	return r, nil
+}
+
+// planRecursive plans the recursive query "anchor UNION [ALL] recursive" of
+// WITH RECURSIVE. The recursive term is planned with the name bound to the
+// work table that has the rows returned by the previous iteration, and its
+// columns are converted to the types of the anchor. If the recursive term
+// does not reference the name, the query is the plain UNION.
+func (p *planner) planRecursive(c *cte) (*relation, error) {
+	stmt := c.def.Select
+	op := stmt.SetOp
+	anchor, err := p.planSelect(op.Left)
+	if err != nil {
+		return nil, err
+	}
+	columns, err := cteColumns(c.def, anchor.columns)
+	if err != nil {
+		return nil, err
+	}
+	self := &cte{def: c.def, recursive: true, work: &executor.WorkTable{}, columns: columns, next: c.next}
+	defer func(ctes *cte) { p.ctes = ctes }(p.ctes)
+	p.ctes = self
+	recursive, err := p.planSelect(op.Right)
+	if err != nil {
+		return nil, err
+	}
+	if !self.referenced {
+		columns, err := p.unifyColumns(anchor, recursive)
+		if err != nil {
+			return nil, err
+		}
+		r, err := p.planSortedSetOperation(newRelation(p.setOperator(op, anchor.plan, recursive.plan, len(columns)), columns), stmt.OrderBy)
+		if err != nil {
+			return nil, err
+		}
+		return p.planLimit(r, stmt.Limit, stmt.Offset)
+	}
+	if len(stmt.OrderBy) > 0 || stmt.Limit != nil || stmt.Offset != nil {
+		return nil, errfmt.Wrap(ErrNotSupportedExpr, fmt.Sprintf("ORDER BY, LIMIT or OFFSET in recursive query %q", c.def.Name))
+	}
+	if len(recursive.columns) != len(columns) {
+		return nil, errfmt.Wrap(ErrColumnCount,
+			fmt.Sprintf("recursive query %q has %d columns in the recursive term, but %d columns in the non-recursive term",
+				c.def.Name, len(recursive.columns), len(columns)))
+	}
+	if err := p.coerceRelation(recursive, columns); err != nil {
+		return nil, err
+	}
+	return newRelation(&executor.RecursiveUnion{
+		Anchor: anchor.plan, Recursive: recursive.plan, Work: self.work,
+		All: op.All, MaxDepth: p.sess.MaxRecursionDepth,
+	}, columns), nil
+}
+
+// cteColumns returns the columns of the common table expression, which are
+// renamed to the column list if it is specified.
+func cteColumns(def *query.CommonTableExpr, columns expr.Columns) (expr.Columns, error) {
+	renamed := make(expr.Columns, len(columns))
+	for i, c := range columns {
+		renamed[i] = expr.ColumnInfo{Name: c.Name, T: c.T}
+	}
+	if len(def.Columns) == 0 {
+		return renamed, nil
+	}
+	if len(def.Columns) != len(columns) {
+		return nil, errfmt.Wrap(ErrColumnCount,
+			fmt.Sprintf("WITH query %q has %d columns, but %d columns are specified", def.Name, len(columns), len(def.Columns)))
+	}
+	for i, name := range def.Columns {
+		renamed[i].Name = name
+	}
+	return renamed, nil
+}
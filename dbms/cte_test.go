@@ -0,0 +1,149 @@
+package dbms
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nao1215/egsql/dbms/expr"
+	"github.com/nao1215/egsql/dbms/query"
+)
+
+func TestEgSQLDB_SelectCTE(t *testing.T) {
+	db, err := NewEgSQLDB(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sql := range []string{
+		"CREATE TABLE nodes (id INT PRIMARY KEY, parent_id INT, name TEXT)",
+		"INSERT INTO nodes VALUES (1, NULL, 'root'), (2, 1, 'a'), (3, 1, 'b'), (4, 2, 'a1'), (5, 4, 'a11')",
+		"CREATE TABLE edges (src INT, dst INT, PRIMARY KEY (src, dst))",
+		"INSERT INTO edges VALUES (1, 2), (2, 3), (3, 1)",
+	} {
+		if _, err := execSQL(t, db, sql); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		set         string
+		sql         string
+		wantColumns []string
+		wantRows    [][]interface{}
+		wantErr     error
+	}{
+		{
+			name: "[Success] tree traversal",
+			sql: `WITH RECURSIVE sub (id, name, depth) AS (
+					SELECT id, name, 0 FROM nodes WHERE id = 2
+					UNION ALL
+					SELECT n.id, n.name, s.depth + 1 FROM nodes n JOIN sub s ON n.parent_id = s.id
+				) SELECT name, depth FROM sub`,
+			wantColumns: []string{"name", "depth"},
+			wantRows:    [][]interface{}{{"a", int64(0)}, {"a1", int64(1)}, {"a11", int64(2)}},
+		},
+		{
+			name: "[Success] union removes duplicates of cyclic graph",
+			sql: `WITH RECURSIVE reach (id) AS (
+					SELECT 1 UNION SELECT e.dst FROM edges e, reach r WHERE e.src = r.id
+				) SELECT id FROM reach`,
+			wantColumns: []string{"id"},
+			wantRows:    [][]interface{}{{int64(1)}, {int64(2)}, {int64(3)}},
+		},
+		{
+			name: "[Success] non-recursive common table expressions",
+			sql: `WITH roots AS (SELECT id, name FROM nodes WHERE parent_id IS NULL),
+					children AS (SELECT n.name FROM nodes n JOIN roots r ON n.parent_id = r.id)
+				SELECT * FROM children`,
+			wantColumns: []string{"name"},
+			wantRows:    [][]interface{}{{"a"}, {"b"}},
+		},
+		{
+			name:        "[Success] common table expression in subquery",
+			sql:         "WITH leaf (id) AS (SELECT 5) SELECT name FROM nodes WHERE id IN (SELECT id FROM leaf)",
+			wantColumns: []string{"name"},
+			wantRows:    [][]interface{}{{"a11"}},
+		},
+		{
+			name:        "[Success] union",
+			sql:         "SELECT name FROM nodes WHERE id < 3 UNION ALL SELECT 'x' UNION SELECT NULL",
+			wantColumns: []string{"name"},
+			wantRows:    [][]interface{}{{"root"}, {"a"}, {"x"}, {nil}},
+		},
+		{
+			name: "[Success] recursion within max depth",
+			set:  "SET max_recursion_depth = 4",
+			sql: `WITH RECURSIVE t (n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM t WHERE n < 5)
+				SELECT n FROM t`,
+			wantColumns: []string{"n"},
+			wantRows:    [][]interface{}{{int64(1)}, {int64(2)}, {int64(3)}, {int64(4)}, {int64(5)}},
+		},
+		{
+			name:    "[Error] recursion beyond max depth",
+			set:     "SET max_recursion_depth = 3",
+			sql:     "WITH RECURSIVE t (n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM t WHERE n < 5) SELECT n FROM t",
+			wantErr: ErrRecursionLimit,
+		},
+		{
+			name:    "[Error] infinite recursion",
+			sql:     "WITH RECURSIVE t (n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM t) SELECT n FROM t",
+			wantErr: ErrRecursionLimit,
+		},
+		{
+			name:    "[Error] invalid max recursion depth",
+			sql:     "SET max_recursion_depth = off",
+			wantErr: ErrInvalidSetting,
+		},
+		{
+			name:    "[Error] column list does not match",
+			sql:     "WITH t (a, b) AS (SELECT 1) SELECT * FROM t",
+			wantErr: ErrColumnCount,
+		},
+		{
+			name:    "[Error] union of different number of columns",
+			sql:     "SELECT 1 UNION SELECT 1, 2",
+			wantErr: ErrColumnCount,
+		},
+		{
+			name:    "[Error] union of different types",
+			sql:     "SELECT 1 UNION SELECT 'a' || 'b'",
+			wantErr: expr.ErrTypeMismatch,
+		},
+		{
+			name:    "[Error] duplicate common table expression",
+			sql:     "WITH t AS (SELECT 1), t AS (SELECT 2) SELECT * FROM t",
+			wantErr: ErrDuplicateAlias,
+		},
+		{
+			name:    "[Error] common table expression is not visible in itself without recursive",
+			sql:     "WITH t (n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM t) SELECT n FROM t",
+			wantErr: ErrNotExistTable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sess := NewSession()
+			if tt.set != "" {
+				querySessionSQL(t, db, sess, tt.set)
+			}
+			stmt, _, err := query.Parse(tt.sql)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rs, err := db.Exec(sess, stmt, nil)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Exec() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(tt.wantColumns, rs.ColumnNames); diff != "" {
+				t.Errorf("ColumnNames mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.wantRows, rs.Rows); diff != "" {
+				t.Errorf("Rows mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
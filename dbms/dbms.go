@@ -1,15 +1,386 @@
 package dbms
 
+import (
+	"context"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/nao1215/egsql/dbms/executor"
+	"github.com/nao1215/egsql/dbms/meta"
+	"github.com/nao1215/egsql/dbms/storage"
+	"github.com/nao1215/egsql/misc/errfmt"
+	"github.com/nao1215/egsql/misc/slice"
+)
+
+// tempDirName is the directory in the EgSQL HOME where the operators of
+// the query write the temporary files.
+const tempDirName = "tmp"
+
+// sequenceCacheSize is the number of sequence values reserved in the catalog at once.
+const sequenceCacheSize = 32
+
 // EgSQLDB is the kernel of the DB management system.
 type EgSQLDB struct {
+	// homeDir is the EgSQL HOME directory path where the catalog is stored.
+	homeDir string
+	catalog *storage.Catalog
+	// tables is the records of each table. Key is table name.
+	tables map[string]*storage.Table
+	// txs is the transactions in progress.
+	txs map[*Tx]struct{}
+	// version is incremented whenever a table is created, altered or dropped,
+	// or the statistics are collected by ANALYZE.
+	// The prepared statements compare it to detect that they are out of date.
+	version uint64
+	// workMem is the bytes of the rows that an operator of the query keeps in
+	// memory before it spills them to the temporary files. If it is 0,
+	// executor.DefaultWorkMem is used.
+	workMem int64
+	// funcs is the scalar functions that the queries can call.
+	funcs *functionRegistry
+	// plans is the prepared statements and their plans. It has its own lock.
+	plans *planCache
+	// lock is the exclusive lock of the EgSQL HOME, released by Close.
+	lock  *storage.HomeLock
+	mutex *sync.RWMutex
 }
 
-// NewEgSQLDB return EgSQLDB instance.
-func NewEgSQLDB() (*EgSQLDB, error) {
+// NewEgSQLDB return EgSQLDB instance that uses the catalog in the EgSQL HOME directory.
+// The database locks the directory until it is closed, so that no other database
+// uses the same catalog. If the directory is locked, storage.ErrHomeLocked is returned.
+//
+// Only the catalog (the schemas, the tables, the sequences and the statistics)
+// is persisted. The rows of the tables are held in memory, so the tables are
+// empty when the database is opened, and the statistics describe the rows
+// at the time of ANALYZE.
+func NewEgSQLDB(homeDir string) (*EgSQLDB, error) {
 	// [ENV]
 	// database name
 	// user name
 	// password
-	// EgSQL HOME directory path
-	return &EgSQLDB{}, nil
+	lock, err := storage.LockHome(homeDir)
+	if err != nil {
+		return nil, err
+	}
+	catalog, err := storage.LoadCatalog(homeDir)
+	if err != nil {
+		_ = lock.Unlock()
+		return nil, err
+	}
+	if catalog.NeedsUpgrade() || catalog.Recovered() {
+		// The legacy json catalog is rewritten in the current format, and the
+		// corrupt catalog is repaired from the backup at once, not at the next DDL.
+		if err := storage.SaveCatalog(homeDir, catalog); err != nil {
+			_ = lock.Unlock()
+			return nil, err
+		}
+	}
+
+	db := &EgSQLDB{
+		homeDir: homeDir,
+		catalog: catalog,
+		tables:  make(map[string]*storage.Table),
+		txs:     make(map[*Tx]struct{}),
+		funcs:   newFunctionRegistry(),
+		plans:   newPlanCache(),
+		lock:    lock,
+		mutex:   &sync.RWMutex{},
+	}
+	for _, s := range catalog.Schemes {
+		db.tables[s.TableName] = storage.NewTable(s)
+	}
+	return db, nil
+}
+
+// Close releases the lock of the EgSQL HOME. The database must not be used after it.
+func (db *EgSQLDB) Close() error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	return db.lock.Unlock()
+}
+
+// executorConfig returns the resources of the operators of the query in the
+// session. The temporary files are created in the "tmp" directory of the
+// EgSQL HOME, and work_mem of the session overrides that of the database.
+func (db *EgSQLDB) executorConfig(ctx context.Context, sess *Session) *executor.Config {
+	workMem := db.workMem
+	if sess.WorkMem > 0 {
+		workMem = sess.WorkMem
+	}
+	return &executor.Config{TempDir: filepath.Join(db.homeDir, tempDirName), WorkMem: workMem, Context: ctx}
+}
+
+// Catalog returns the system catalog of the database.
+func (db *EgSQLDB) Catalog() *storage.Catalog {
+	return db.catalog
+}
+
+// Version returns the version of the table definitions. It changes whenever
+// a table is created, altered or dropped, or the tables are analyzed.
+func (db *EgSQLDB) Version() uint64 {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+	return db.version
+}
+
+// Table returns the table with the specified name.
+// If the table does not exist, nil is returned.
+func (db *EgSQLDB) Table(name string) *storage.Table {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+	return db.tables[name]
+}
+
+// CreateTable adds the table to the catalog and persists the catalog.
+// The FOREIGN KEY constraints of the scheme are checked against
+// the referenced tables, and the referenced columns are completed
+// with the primary key of the referenced table if they are omitted.
+func (db *EgSQLDB) CreateTable(scheme *meta.Scheme) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if db.catalog.HasScheme(scheme.TableName) {
+		return errfmt.Wrap(ErrExistTable, scheme.TableName)
+	}
+	if !db.catalog.HasSchema(scheme.SchemaName()) {
+		return errfmt.Wrap(ErrNotExistSchema, scheme.SchemaName())
+	}
+	if err := db.resolveForeignKeys(scheme); err != nil {
+		return err
+	}
+
+	var seqs []*meta.Sequence
+	if id := scheme.Identity; id != nil {
+		// The table owns a new sequence; it never shares one with another table.
+		id.Sequence = db.uniqueSequenceName(id.Sequence)
+		seq, err := meta.NewSequence(id.Sequence, 1, 1)
+		if err != nil {
+			return err
+		}
+		seq.OwnedBy = scheme.TableName
+		seqs = append(seqs, seq)
+	}
+
+	if err := db.saveCatalogWith([]*meta.Scheme{scheme}, seqs); err != nil {
+		return err
+	}
+	db.catalog.Add(scheme)
+	for _, seq := range seqs {
+		db.catalog.AddSequence(seq)
+	}
+	db.tables[scheme.TableName] = storage.NewTable(scheme)
+	db.version++
+	return nil
+}
+
+// uniqueSequenceName returns base, or base with the smallest numeric suffix
+// if a sequence named base already exists.
+func (db *EgSQLDB) uniqueSequenceName(base string) string {
+	name := base
+	for i := 1; db.catalog.HasSequence(name); i++ {
+		name = base + strconv.Itoa(i)
+	}
+	return name
+}
+
+// DropTable removes the table and its indexes from the catalog, persists
+// the catalog and releases the rows. The sequences owned by the table are
+// dropped too. If ifExists is true, dropping the table that does not exist
+// is not an error. The table referenced by the FOREIGN KEY constraint of
+// other tables can not be dropped.
+func (db *EgSQLDB) DropTable(tableName string, ifExists bool) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if !db.catalog.HasScheme(tableName) {
+		if ifExists {
+			return nil
+		}
+		return errfmt.Wrap(ErrNotExistTable, tableName)
+	}
+	if err := db.checkDroppable([]string{tableName}); err != nil {
+		return err
+	}
+	return db.dropObjects(nil, []string{tableName}, nil)
+}
+
+// dropObjects removes the schemas, the tables and the sequences from
+// the catalog, persists the catalog and releases the rows of the tables.
+// The sequences owned by the tables are removed too.
+func (db *EgSQLDB) dropObjects(schemas, tableNames, sequences []string) error {
+	for _, seq := range db.catalog.Sequences {
+		if seq.OwnedBy != "" && slice.Contains(tableNames, seq.OwnedBy) {
+			sequences = append(sequences, seq.Name)
+		}
+	}
+
+	next := db.catalog.Copy()
+	remove := func(c *storage.Catalog) {
+		for _, name := range schemas {
+			c.RemoveSchema(name)
+		}
+		for _, name := range tableNames {
+			c.Remove(name)
+		}
+		for _, name := range sequences {
+			c.RemoveSequence(name)
+		}
+	}
+	remove(next)
+	if err := storage.SaveCatalog(db.homeDir, next); err != nil {
+		return err
+	}
+
+	remove(db.catalog)
+	for _, name := range tableNames {
+		db.tables[name].Truncate()
+		delete(db.tables, name)
+	}
+	db.version++
+	return nil
+}
+
+// TruncateTable removes all rows of the tables and releases them.
+// A table referenced by the FOREIGN KEY constraint of other tables can be
+// truncated only if the referencing tables are truncated together.
+// TRUNCATE is not transactional; it can not be rolled back.
+func (db *EgSQLDB) TruncateTable(tableNames ...string) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	for _, name := range tableNames {
+		if !db.catalog.HasScheme(name) {
+			return errfmt.Wrap(ErrNotExistTable, name)
+		}
+	}
+	if err := db.checkDroppable(tableNames); err != nil {
+		return err
+	}
+	for _, name := range tableNames {
+		db.tables[name].Truncate()
+	}
+	return nil
+}
+
+// checkDroppable checks that the rows of the tables can be removed at once:
+// no transaction in progress has changed them, and no other table references them.
+func (db *EgSQLDB) checkDroppable(tableNames []string) error {
+	targets := make(map[string]bool, len(tableNames))
+	for _, name := range tableNames {
+		targets[name] = true
+	}
+	for _, name := range tableNames {
+		if err := db.checkNotInUse(name); err != nil {
+			return err
+		}
+		for _, child := range db.catalog.ReferencedBy(name) {
+			if !targets[child.TableName] {
+				return errfmt.Wrap(ErrDependentObject, name+" is referenced by "+child.TableName)
+			}
+		}
+	}
+	return nil
+}
+
+// CreateSequence adds the sequence to the catalog and persists the catalog.
+func (db *EgSQLDB) CreateSequence(seq *meta.Sequence) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if db.catalog.HasSequence(seq.Name) {
+		return errfmt.Wrap(ErrExistSequence, seq.Name)
+	}
+	if schema, _ := meta.SplitQualifiedName(seq.Name); !db.catalog.HasSchema(schema) {
+		return errfmt.Wrap(ErrNotExistSchema, schema)
+	}
+	if err := db.saveCatalogWith(nil, []*meta.Sequence{seq}); err != nil {
+		return err
+	}
+	db.catalog.AddSequence(seq)
+	return nil
+}
+
+// NextVal advances the sequence with the specified name and returns its value.
+func (db *EgSQLDB) NextVal(name string) (int64, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	return db.nextVal(name)
+}
+
+// nextVal is NextVal without locking.
+func (db *EgSQLDB) nextVal(name string) (int64, error) {
+	seq := db.catalog.FetchSequence(name)
+	if seq == nil {
+		return 0, errfmt.Wrap(ErrNotExistSequence, name)
+	}
+	if err := db.reserve(seq); err != nil {
+		return 0, err
+	}
+	return seq.Next(), nil
+}
+
+// reserve reserves the next block of the sequence values and persists
+// the catalog if the next value is not reserved yet.
+func (db *EgSQLDB) reserve(seq *meta.Sequence) error {
+	if !seq.NeedReserve() {
+		return nil
+	}
+	last := seq.Last
+	seq.Reserve(sequenceCacheSize)
+	if err := storage.SaveCatalog(db.homeDir, db.catalog); err != nil {
+		seq.Last = last
+		return err
+	}
+	return nil
+}
+
+// saveCatalogWith persists the catalog including the new schemes and sequences
+// before they are added to the catalog in memory, so that the memory does not
+// have them if saving fails.
+func (db *EgSQLDB) saveCatalogWith(schemes []*meta.Scheme, seqs []*meta.Sequence) error {
+	next := db.catalog.Copy()
+	for _, s := range schemes {
+		next.Add(s)
+	}
+	for _, s := range seqs {
+		next.AddSequence(s)
+	}
+	return storage.SaveCatalog(db.homeDir, next)
+}
+
+// resolveForeignKeys checks that each FOREIGN KEY constraint references
+// the primary key or UNIQUE columns of an existing table with the same data types.
+func (db *EgSQLDB) resolveForeignKeys(scheme *meta.Scheme) error {
+	for i := range scheme.ForeignKeys {
+		fk := &scheme.ForeignKeys[i]
+
+		parent := scheme
+		if fk.RefTable != scheme.TableName {
+			parent = db.catalog.FetchScheme(fk.RefTable)
+		}
+		if parent == nil {
+			return errfmt.Wrap(ErrNotExistTable, fk.RefTable)
+		}
+
+		if len(fk.RefColumns) == 0 {
+			fk.RefColumns = append([]string{}, parent.PrimaryKey...)
+		}
+		if len(fk.RefColumns) != len(fk.Columns) {
+			return errfmt.Wrap(meta.ErrNotMatchRefColumnNum, fk.Name)
+		}
+		if parent.UniqueIndexFor(fk.RefColumns) == "" {
+			return errfmt.Wrap(meta.ErrInvalidForeignKey,
+				fk.Name+": referenced columns are not the primary key or unique")
+		}
+		for j := range fk.Columns {
+			child := scheme.ColumnDataTypes[scheme.ColumnIndex(fk.Columns[j])]
+			ref := parent.ColumnDataTypes[parent.ColumnIndex(fk.RefColumns[j])]
+			if child != ref {
+				return errfmt.Wrap(meta.ErrInvalidForeignKey,
+					fk.Name+": data types of referencing and referenced columns do not match")
+			}
+		}
+	}
+	return nil
 }
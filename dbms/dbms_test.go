@@ -0,0 +1,397 @@
+package dbms
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nao1215/egsql/dbms/meta"
+	"github.com/nao1215/egsql/dbms/storage"
+)
+
+func TestEgSQLDB_CreateTable(t *testing.T) {
+	newParent := func() *meta.Scheme {
+		s, err := meta.NewScheme("parents", []string{"tenant_id", "id", "code"},
+			[]meta.DataType{meta.Int, meta.Int, meta.Varchar}, "tenant_id", "id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.AddUnique("code"); err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	tests := []struct {
+		name           string
+		fk             meta.ForeignKey
+		wantErrIs      error
+		wantRefColumns []string
+	}{
+		{
+			name:           "[Success] reference primary key of parent",
+			fk:             meta.ForeignKey{Columns: []string{"tenant_id", "parent_id"}, RefTable: "parents"},
+			wantErrIs:      nil,
+			wantRefColumns: []string{"tenant_id", "id"},
+		},
+		{
+			name:           "[Success] reference unique columns of parent",
+			fk:             meta.ForeignKey{Columns: []string{"code"}, RefTable: "parents", RefColumns: []string{"code"}},
+			wantErrIs:      nil,
+			wantRefColumns: []string{"code"},
+		},
+		{
+			name:           "[Success] reference itself",
+			fk:             meta.ForeignKey{Columns: []string{"parent_id"}, RefTable: "children", RefColumns: []string{"id"}},
+			wantErrIs:      nil,
+			wantRefColumns: []string{"id"},
+		},
+		{
+			name:      "[Error] parent table does not exist",
+			fk:        meta.ForeignKey{Columns: []string{"parent_id"}, RefTable: "not_exist"},
+			wantErrIs: ErrNotExistTable,
+		},
+		{
+			name:      "[Error] referenced columns are not unique",
+			fk:        meta.ForeignKey{Columns: []string{"parent_id"}, RefTable: "parents", RefColumns: []string{"id"}},
+			wantErrIs: meta.ErrInvalidForeignKey,
+		},
+		{
+			name:      "[Error] number of columns does not match parent primary key",
+			fk:        meta.ForeignKey{Columns: []string{"parent_id"}, RefTable: "parents"},
+			wantErrIs: meta.ErrNotMatchRefColumnNum,
+		},
+		{
+			name:      "[Error] data types do not match",
+			fk:        meta.ForeignKey{Columns: []string{"parent_id"}, RefTable: "parents", RefColumns: []string{"code"}},
+			wantErrIs: meta.ErrInvalidForeignKey,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			home := t.TempDir()
+			db, err := NewEgSQLDB(home)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := db.CreateTable(newParent()); err != nil {
+				t.Fatal(err)
+			}
+
+			child, err := meta.NewScheme("children", []string{"id", "tenant_id", "parent_id", "code"},
+				[]meta.DataType{meta.Int, meta.Int, meta.Int, meta.Varchar}, "id")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := child.AddForeignKey(tt.fk); err != nil {
+				t.Fatal(err)
+			}
+
+			err = db.CreateTable(child)
+			if !errors.Is(err, tt.wantErrIs) {
+				t.Fatalf("EgSQLDB.CreateTable() error = %v, wantErrIs %v", err, tt.wantErrIs)
+			}
+			if err != nil {
+				if db.Table("children") != nil {
+					t.Errorf("table is created even though the error occurred")
+				}
+				return
+			}
+
+			// The foreign key is persisted in the catalog.
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+			reopen, err := NewEgSQLDB(home)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := reopen.Catalog().FetchScheme("children").ForeignKeys[0].RefColumns
+			if diff := cmp.Diff(tt.wantRefColumns, got); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestEgSQLDB_CreateTable_Exist(t *testing.T) {
+	db, err := NewEgSQLDB(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := meta.NewScheme("users", []string{"id"}, []meta.DataType{meta.Int}, "id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateTable(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateTable(s); !errors.Is(err, ErrExistTable) {
+		t.Errorf("EgSQLDB.CreateTable() error = %v, wantErrIs %v", err, ErrExistTable)
+	}
+}
+
+func TestEgSQLDB_DropTable(t *testing.T) {
+	tests := []struct {
+		name       string
+		sql        []string
+		wantTables []string
+		wantErr    error
+	}{
+		{
+			name:       "[Success] drop child table, then parent table",
+			sql:        []string{"DROP TABLE users", "DROP TABLE groups"},
+			wantTables: []string{},
+		},
+		{
+			name:       "[Success] drop not exist table with IF EXISTS",
+			sql:        []string{"DROP TABLE IF EXISTS roles"},
+			wantTables: []string{"groups", "users"},
+		},
+		{
+			name:    "[Error] drop not exist table",
+			sql:     []string{"DROP TABLE roles"},
+			wantErr: ErrNotExistTable,
+		},
+		{
+			name:    "[Error] drop referenced table",
+			sql:     []string{"DROP TABLE groups"},
+			wantErr: ErrDependentObject,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t, meta.ForeignKey{})
+			setup(t, db)
+
+			for _, sql := range tt.sql {
+				if _, err := execSQL(t, db, sql); err != nil {
+					if !errors.Is(err, tt.wantErr) {
+						t.Fatalf("Exec(%q) error = %v, wantErr %v", sql, err, tt.wantErr)
+					}
+					return
+				}
+			}
+			if tt.wantErr != nil {
+				t.Fatalf("Exec() error = nil, wantErr %v", tt.wantErr)
+			}
+
+			if err := db.Close(); err != nil {
+				t.Fatal(err)
+			}
+			reopened, err := NewEgSQLDB(db.homeDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for _, s := range reopened.catalog.Schemes {
+				got = append(got, s.TableName)
+			}
+			if diff := cmp.Diff(tt.wantTables, got); diff != "" {
+				t.Errorf("persisted tables mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestEgSQLDB_DropTable_Identity(t *testing.T) {
+	db, err := NewEgSQLDB(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	create := "CREATE TABLE users (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT)"
+	if _, err := execSQL(t, db, create); err != nil {
+		t.Fatal(err)
+	}
+	version := db.Version()
+	if _, err := execSQL(t, db, "INSERT INTO users (name) VALUES ('a')"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := execSQL(t, db, "DROP TABLE users"); err != nil {
+		t.Fatal(err)
+	}
+	if db.Version() == version {
+		t.Error("Version() is not changed by DROP TABLE")
+	}
+	if db.catalog.HasSequence("users_id_seq") {
+		t.Error("identity sequence is not dropped")
+	}
+
+	// The table created again starts from the empty table and a new sequence.
+	if _, err := execSQL(t, db, create); err != nil {
+		t.Fatal(err)
+	}
+	id, err := execSQL(t, db, "INSERT INTO users (name) VALUES ('b')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 1 {
+		t.Errorf("LastInsertID = %d, want 1", id)
+	}
+	if diff := cmp.Diff([]storage.Row{{int64(1), "b"}}, rows(db, "users")); diff != "" {
+		t.Errorf("rows mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestEgSQLDB_CreateTable_IdentitySequence(t *testing.T) {
+	db, err := NewEgSQLDB(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sql := range []string{
+		"CREATE SEQUENCE users_id_seq START WITH 100",
+		"CREATE TABLE users (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT)",
+	} {
+		if _, err := execSQL(t, db, sql); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The table does not take over the sequence created by CREATE SEQUENCE.
+	if got := db.catalog.FetchScheme("users").Identity.Sequence; got != "users_id_seq1" {
+		t.Errorf("identity sequence = %q, want %q", got, "users_id_seq1")
+	}
+	id, err := execSQL(t, db, "INSERT INTO users (name) VALUES ('a')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 1 {
+		t.Errorf("LastInsertID = %d, want 1", id)
+	}
+
+	if _, err := execSQL(t, db, "DROP TABLE users"); err != nil {
+		t.Fatal(err)
+	}
+	if db.catalog.HasSequence("users_id_seq1") {
+		t.Error("sequence owned by the table is not dropped")
+	}
+	if !db.catalog.HasSequence("users_id_seq") {
+		t.Error("sequence not owned by the table is dropped")
+	}
+}
+
+func TestEgSQLDB_TruncateTable(t *testing.T) {
+	db := newTestDB(t, meta.ForeignKey{})
+	setup(t, db)
+
+	if _, err := execSQL(t, db, "TRUNCATE TABLE groups"); !errors.Is(err, ErrDependentObject) {
+		t.Errorf("TRUNCATE error = %v, want %v", err, ErrDependentObject)
+	}
+	if _, err := execSQL(t, db, "TRUNCATE users, groups"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"groups", "users"} {
+		if n := db.Table(name).Len(); n != 0 {
+			t.Errorf("%s has %d rows after TRUNCATE", name, n)
+		}
+	}
+	if _, err := execSQL(t, db, "INSERT INTO groups VALUES (1, 'admin')"); err != nil {
+		t.Errorf("INSERT after TRUNCATE error = %v", err)
+	}
+}
+
+func TestNewEgSQLDB_UpgradeLegacyCatalog(t *testing.T) {
+	dir := t.TempDir()
+	legacy := `{"Schemes":[{"tableName":"users","columnNames":["id","name"],"dataTypes":"AQI=","pk":"id"}]}`
+	if err := ioutil.WriteFile(filepath.Join(dir, "catalog.db"), []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	upgraded, err := NewEgSQLDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := upgraded.Close(); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "catalog.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(b, []byte("EGSQLCAT")) {
+		t.Fatalf("catalog file is not upgraded: %q", b)
+	}
+
+	db, err := NewEgSQLDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !db.Catalog().HasScheme("users") {
+		t.Error("table users does not exist after upgrade")
+	}
+	if db.Catalog().NeedsUpgrade() {
+		t.Error("upgraded catalog needs upgrade")
+	}
+}
+
+func TestNewEgSQLDB_Locked(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewEgSQLDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewEgSQLDB(dir); !errors.Is(err, storage.ErrHomeLocked) {
+		t.Errorf("NewEgSQLDB() error = %v, wantErrIs %v", err, storage.ErrHomeLocked)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := NewEgSQLDB(dir)
+	if err != nil {
+		t.Fatalf("NewEgSQLDB() after Close error = %v", err)
+	}
+	if err := reopened.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewEgSQLDB_CorruptCatalog(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "catalog.db"), []byte("EGSQLCAT broken"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewEgSQLDB(dir); !errors.Is(err, storage.ErrCorruptCatalogFile) {
+		t.Errorf("NewEgSQLDB() error = %v, wantErrIs %v", err, storage.ErrCorruptCatalogFile)
+	}
+}
+
+func TestNewEgSQLDB_RecoverCatalog(t *testing.T) {
+	dir := t.TempDir()
+	db, err := NewEgSQLDB(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"first", "second"} {
+		s, err := meta.NewScheme(name, []string{"id"}, []meta.DataType{meta.Int}, "id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := db.CreateTable(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "catalog.db"), []byte("EGSQLCAT broken"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewEgSQLDB(dir); err != nil {
+		t.Fatal(err)
+	}
+	// The catalog file is repaired from the backup that has the first table only.
+	c, err := storage.LoadCatalog(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Recovered() {
+		t.Error("catalog file is not repaired")
+	}
+	if !c.HasScheme("first") || c.HasScheme("second") {
+		t.Errorf("catalog is not the backup: %v", c.Schemes)
+	}
+}
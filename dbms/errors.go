@@ -1 +1,89 @@
 package dbms
+
+import (
+	"errors"
+
+	"github.com/nao1215/egsql/dbms/executor"
+	"github.com/nao1215/egsql/dbms/expr"
+)
+
+var (
+	// ErrExistTable means that the table with the same name already exists.
+	ErrExistTable = errors.New("table already exists")
+	// ErrNotExistTable means that the specified table does not exist.
+	ErrNotExistTable = errors.New("table does not exist")
+	// ErrExistSchema means that the schema with the same name already exists.
+	ErrExistSchema = errors.New("schema already exists")
+	// ErrNotExistSchema means that the specified schema does not exist.
+	ErrNotExistSchema = errors.New("schema does not exist")
+	// ErrInvalidSchemaName means that the schema name is empty or has ".".
+	ErrInvalidSchemaName = errors.New("invalid schema name")
+	// ErrSystemSchema means that the object in the system schema (e.g. information_schema)
+	// is created, changed or dropped. The system views are read-only.
+	ErrSystemSchema = errors.New("system schema is read-only")
+	// ErrDropDefaultSchema means that the default schema "public" is dropped.
+	ErrDropDefaultSchema = errors.New("cannot drop the default schema")
+	// ErrExistSequence means that the sequence with the same name already exists.
+	ErrExistSequence = errors.New("sequence already exists")
+	// ErrNotExistSequence means that the specified sequence does not exist.
+	ErrNotExistSequence = errors.New("sequence does not exist")
+	// ErrGeneratedAlways means that the value is specified for the column of
+	// GENERATED ALWAYS AS IDENTITY.
+	ErrGeneratedAlways = errors.New("cannot insert a non-NULL value into column generated always")
+	// ErrForeignKeyViolation means that the change violates the FOREIGN KEY constraint.
+	ErrForeignKeyViolation = errors.New("change violates foreign key constraint")
+	// ErrDuplicateColumn means that the same column is specified more than once.
+	ErrDuplicateColumn = errors.New("column is specified more than once")
+	// ErrNotMatchArgNum means that the number of arguments and the number of
+	// placeholders do not match.
+	// It is the same error as expr.ErrNotMatchArgNum.
+	ErrNotMatchArgNum = expr.ErrNotMatchArgNum
+	// ErrNotSupportedFunction means that the function is not supported.
+	// It is the same error as expr.ErrNotSupportedFunction.
+	ErrNotSupportedFunction = expr.ErrNotSupportedFunction
+	// ErrWrongNumberOfArgs means that the function is called with the wrong
+	// number of arguments. It is the same error as expr.ErrWrongNumberOfArgs.
+	ErrWrongNumberOfArgs = expr.ErrWrongNumberOfArgs
+	// ErrInvalidArgument means that the value of the argument of the function
+	// is invalid, e.g. the timestamp text that can not be parsed.
+	ErrInvalidArgument = errors.New("invalid argument")
+	// ErrInvalidFunction means that the function to register is invalid, e.g.
+	// it has no implementation.
+	ErrInvalidFunction = errors.New("invalid function definition")
+	// ErrNotSupportedExpr means that the expression can not be used in the place.
+	// It is the same error as expr.ErrNotSupportedExpr.
+	ErrNotSupportedExpr = expr.ErrNotSupportedExpr
+	// ErrTableInUse means that the table is changed by the transaction in progress,
+	// so its definition can not be changed.
+	ErrTableInUse = errors.New("table is in use by a transaction in progress")
+	// ErrDependentObject means that the object can not be changed because
+	// other objects depend on it (e.g. the column referenced by a foreign key).
+	ErrDependentObject = errors.New("other objects depend on it")
+	// ErrNotSupportedSetting means that the setting specified by SET is not supported.
+	ErrNotSupportedSetting = errors.New("not supported setting")
+	// ErrInvalidSetting means that the value of the setting specified by SET is invalid.
+	ErrInvalidSetting = errors.New("invalid value for the setting")
+	// ErrInvalidPosition means that the position of the select list like
+	// GROUP BY 3 is out of range.
+	ErrInvalidPosition = errors.New("position is not in select list")
+	// ErrDuplicateAlias means that the same table name or alias is specified
+	// more than once in FROM clause.
+	ErrDuplicateAlias = errors.New("table name is specified more than once")
+	// ErrColumnCount means that the number of the columns does not match, e.g. the
+	// queries of UNION, or the query and the column list of WITH clause.
+	ErrColumnCount = errors.New("number of columns does not match")
+	// ErrRecursionLimit means that the recursive query exceeds the maximum
+	// recursion depth. It is the same error as executor.ErrRecursionLimit.
+	ErrRecursionLimit = executor.ErrRecursionLimit
+	// ErrInvalidLimit means that the value of LIMIT or OFFSET clause is negative.
+	// It is the same error as executor.ErrInvalidLimit.
+	ErrInvalidLimit = executor.ErrInvalidLimit
+	// ErrNoConflictTarget means that no primary key or unique constraint matches
+	// the columns of ON CONFLICT clause, or DO UPDATE has no columns.
+	ErrNoConflictTarget = errors.New("no unique constraint matches the ON CONFLICT specification")
+	// ErrConflictTwice means that ON CONFLICT DO UPDATE affects the same row
+	// more than once, e.g. the rows to insert have the same key.
+	ErrConflictTwice = errors.New("ON CONFLICT DO UPDATE cannot affect a row a second time")
+	// ErrTxDone means that the transaction has already been committed or rolled back.
+	ErrTxDone = errors.New("transaction has already been committed or rolled back")
+)
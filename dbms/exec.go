@@ -0,0 +1,656 @@
+package dbms
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/nao1215/egsql/dbms/executor"
+	"github.com/nao1215/egsql/dbms/expr"
+	"github.com/nao1215/egsql/dbms/meta"
+	"github.com/nao1215/egsql/dbms/query"
+	"github.com/nao1215/egsql/dbms/storage"
+	"github.com/nao1215/egsql/misc/errfmt"
+)
+
+// Exec executes the statement in the session with the arguments bound to
+// the placeholders. If sess is nil, the statement is executed in a new session.
+// If the session has no transaction in progress, the statement is executed in
+// its own transaction that is committed when the statement succeeds.
+// DDL statements are not transactional; they are persisted immediately even
+// if the session has a transaction in progress.
+func (db *EgSQLDB) Exec(sess *Session, stmt query.Stmt, args []interface{}) (*meta.ResultSet, error) {
+	if sess == nil {
+		sess = NewSession()
+	}
+
+	switch s := stmt.(type) {
+	case *query.CreateSchemaStmt:
+		if err := db.CreateSchema(s.Name); err != nil {
+			return nil, err
+		}
+		return meta.NewResultSet("CREATE SCHEMA"), nil
+	case *query.DropSchemaStmt:
+		if err := db.DropSchema(s.Name, s.IfExists, s.Cascade); err != nil {
+			return nil, err
+		}
+		return meta.NewResultSet("DROP SCHEMA"), nil
+	case *query.SetStmt:
+		return execSet(sess, s)
+	case *query.CreateTableStmt:
+		return db.execCreateTable(sess, s)
+	case *query.CreateSequenceStmt:
+		return db.execCreateSequence(sess, s)
+	case *query.AlterTableStmt:
+		return db.execAlterTable(sess, s)
+	case *query.DropTableStmt:
+		return db.execDropTable(sess, s)
+	case *query.TruncateStmt:
+		return db.execTruncate(sess, s)
+	case *query.AnalyzeStmt:
+		return db.execAnalyze(sess, s)
+	case *query.ExplainStmt:
+		return db.execExplain(sess, s, args)
+	case *query.SelectStmt:
+		return db.execSelect(sess, s, args)
+	case *query.InsertStmt:
+		return db.inTx(sess.Tx, func(tx *Tx) (*meta.ResultSet, error) {
+			return db.execInsert(sess, tx, s, args, nil)
+		})
+	case *query.UpdateStmt:
+		return db.inTx(sess.Tx, func(tx *Tx) (*meta.ResultSet, error) {
+			return db.execUpdate(sess, tx, s, args, nil)
+		})
+	case *query.DeleteStmt:
+		return db.inTx(sess.Tx, func(tx *Tx) (*meta.ResultSet, error) {
+			return db.execDelete(sess, tx, s, args, nil)
+		})
+	}
+	return nil, errfmt.Wrap(query.ErrNotSupportedStatement, fmt.Sprintf("%T", stmt))
+}
+
+// inTx executes fn in tx. If tx is nil, fn is executed in a new transaction
+// that is committed if fn succeeds and rolled back otherwise.
+func (db *EgSQLDB) inTx(tx *Tx, fn func(tx *Tx) (*meta.ResultSet, error)) (*meta.ResultSet, error) {
+	if tx != nil {
+		return fn(tx)
+	}
+
+	tx = db.Begin()
+	rs, err := fn(tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return rs, nil
+}
+
+// execCreateTable executes CREATE TABLE statement.
+func (db *EgSQLDB) execCreateTable(sess *Session, stmt *query.CreateTableStmt) (*meta.ResultSet, error) {
+	scheme, err := db.newScheme(sess, stmt)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.CreateTable(scheme); err != nil {
+		return nil, err
+	}
+	return meta.NewResultSet("CREATE TABLE"), nil
+}
+
+// newScheme converts CREATE TABLE statement to the scheme.
+// The table names are resolved with the search path of the session.
+func (db *EgSQLDB) newScheme(sess *Session, stmt *query.CreateTableStmt) (*meta.Scheme, error) {
+	tableName, err := db.newName(sess, stmt.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	var types []meta.DataType
+	for _, c := range stmt.Columns {
+		names = append(names, c.Name)
+		types = append(types, c.Type)
+	}
+	scheme, err := meta.NewScheme(tableName, names, types, stmt.PrimaryKey...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range stmt.Columns {
+		if c.Default != nil {
+			v, err := defaultValue(c.Name, c.Default)
+			if err != nil {
+				return nil, err
+			}
+			if err := scheme.SetDefault(c.Name, v); err != nil {
+				return nil, errfmt.Wrap(err, c.Name)
+			}
+		}
+		if c.Identity {
+			if err := scheme.SetIdentity(c.Name, c.Always); err != nil {
+				return nil, errfmt.Wrap(err, c.Name)
+			}
+		}
+	}
+	for _, u := range stmt.Uniques {
+		if err := scheme.AddUnique(u...); err != nil {
+			return nil, err
+		}
+	}
+	for _, fk := range stmt.ForeignKeys {
+		refTable := tableName
+		if fk.RefTable != stmt.Name && (fk.RefTable.Schema != "" || fk.RefTable.Name != stmt.Name.Name) {
+			if refTable, err = db.resolveTable(sess, fk.RefTable); err != nil {
+				return nil, err
+			}
+		}
+		err := scheme.AddForeignKey(meta.ForeignKey{
+			Name:       fk.Name,
+			Columns:    fk.Columns,
+			RefTable:   refTable,
+			RefColumns: fk.RefColumns,
+			OnDelete:   fk.OnDelete,
+			OnUpdate:   fk.OnUpdate,
+			Deferred:   fk.Deferred,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return scheme, nil
+}
+
+// defaultValue returns the value of DEFAULT clause of the column.
+// Only a constant is allowed.
+func defaultValue(column string, e query.Expr) (interface{}, error) {
+	if e == nil {
+		return nil, nil
+	}
+	lit, ok := e.(*query.Literal)
+	if !ok {
+		return nil, errfmt.Wrap(meta.ErrInvalidDefault, column+": default must be a constant")
+	}
+	return lit.Value, nil
+}
+
+// execAlterTable executes ALTER TABLE statement.
+func (db *EgSQLDB) execAlterTable(sess *Session, stmt *query.AlterTableStmt) (*meta.ResultSet, error) {
+	table, err := db.resolveTable(sess, stmt.Table)
+	if err != nil {
+		return nil, err
+	}
+
+	switch a := stmt.Action.(type) {
+	case *query.AddColumn:
+		var v interface{}
+		if v, err = defaultValue(a.Column.Name, a.Column.Default); err == nil {
+			err = db.AddColumn(table, a.Column.Name, a.Column.Type, v)
+		}
+	case *query.DropColumn:
+		err = db.DropColumn(table, a.Column)
+	case *query.RenameColumn:
+		err = db.RenameColumn(table, a.Column, a.NewName)
+	case *query.RenameTable:
+		schema, _ := meta.SplitQualifiedName(table)
+		err = db.RenameTable(table, meta.QualifiedName(schema, a.NewName))
+	case *query.AlterColumnDefault:
+		var v interface{}
+		if v, err = defaultValue(a.Column, a.Default); err == nil {
+			err = db.SetColumnDefault(table, a.Column, v)
+		}
+	default:
+		err = errfmt.Wrap(query.ErrNotSupportedStatement, fmt.Sprintf("%T", a))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return meta.NewResultSet("ALTER TABLE"), nil
+}
+
+// execDropTable executes DROP TABLE statement.
+func (db *EgSQLDB) execDropTable(sess *Session, stmt *query.DropTableStmt) (*meta.ResultSet, error) {
+	table, err := db.resolveTable(sess, stmt.Name)
+	if err != nil {
+		if stmt.IfExists && errors.Is(err, ErrNotExistTable) {
+			return meta.NewResultSet("DROP TABLE"), nil
+		}
+		return nil, err
+	}
+	if err := db.DropTable(table, stmt.IfExists); err != nil {
+		return nil, err
+	}
+	return meta.NewResultSet("DROP TABLE"), nil
+}
+
+// execTruncate executes TRUNCATE statement.
+func (db *EgSQLDB) execTruncate(sess *Session, stmt *query.TruncateStmt) (*meta.ResultSet, error) {
+	tables := make([]string, 0, len(stmt.Tables))
+	for _, name := range stmt.Tables {
+		table, err := db.resolveTable(sess, name)
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	if err := db.TruncateTable(tables...); err != nil {
+		return nil, err
+	}
+	return meta.NewResultSet("TRUNCATE TABLE"), nil
+}
+
+// execCreateSequence executes CREATE SEQUENCE statement.
+func (db *EgSQLDB) execCreateSequence(sess *Session, stmt *query.CreateSequenceStmt) (*meta.ResultSet, error) {
+	name, err := db.newName(sess, stmt.Name)
+	if err != nil {
+		return nil, err
+	}
+	seq, err := meta.NewSequence(name, stmt.Start, stmt.Increment)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.CreateSequence(seq); err != nil {
+		return nil, err
+	}
+	return meta.NewResultSet("CREATE SEQUENCE"), nil
+}
+
+// execInsert executes INSERT statement. The omitted columns are filled with
+// their default values, and the identity column is generated if it is omitted
+// or NULL. The rows of the query are computed before any row is inserted, so
+// the query does not see the rows inserted by the statement. The row that
+// conflicts with an existing row is skipped or updated by ON CONFLICT clause.
+// If plan is not nil, the plan of the statement is instrumented and recorded
+// in it for EXPLAIN ANALYZE.
+func (db *EgSQLDB) execInsert(sess *Session, tx *Tx, stmt *query.InsertStmt, args []interface{}, plan *modifyPlan) (*meta.ResultSet, error) {
+	table, err := db.resolveTable(sess, stmt.Table)
+	if err != nil {
+		return nil, err
+	}
+
+	var rs *meta.ResultSet
+	err = tx.Statement(func(w *Writer) error {
+		t, err := w.Table(table)
+		if err != nil {
+			return err
+		}
+		scheme := t.Scheme()
+
+		positions, err := columnPositions(scheme, stmt.Columns)
+		if err != nil {
+			return err
+		}
+		rows, err := db.insertRows(sess, scheme, positions, stmt, args, plan)
+		if err != nil {
+			return err
+		}
+		var u *upsert
+		if stmt.OnConflict != nil {
+			if u, err = db.newUpsert(sess, table, stmt.Table.Name, scheme, stmt.OnConflict, args); err != nil {
+				return err
+			}
+		}
+		if plan != nil {
+			plan.kind, plan.table, plan.upsert = "Insert", table, u
+		}
+
+		var affected int64
+		for _, row := range rows {
+			if u != nil {
+				id, ok, err := u.conflict(t, row)
+				if err != nil {
+					return err
+				}
+				if ok {
+					updated, err := u.update(w, t, id, row)
+					if err != nil {
+						return err
+					}
+					if updated {
+						affected++
+					}
+					continue
+				}
+			}
+			id, err := w.Insert(table, row)
+			if err != nil {
+				return err
+			}
+			if u != nil {
+				u.touched[id] = true
+			}
+			affected++
+		}
+
+		rs = meta.NewResultSet(fmt.Sprintf("INSERT 0 %d", affected))
+		rs.AffectedRows = affected
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	rs.LastInsertID = tx.LastInsertID()
+	return rs, nil
+}
+
+// insertRows returns the rows to insert: the rows of VALUES clause or the
+// result rows of the query, with the omitted columns filled with their
+// default values. If plan is not nil, the plan of the rows is instrumented
+// and recorded in it. It must be called with db.mutex locked.
+func (db *EgSQLDB) insertRows(sess *Session, scheme *meta.Scheme, positions []int, stmt *query.InsertStmt, args []interface{}, plan *modifyPlan) ([]storage.Row, error) {
+	newRow := func() storage.Row {
+		row := make(storage.Row, len(scheme.ColumnNames))
+		for i, c := range scheme.ColumnNames {
+			row[i] = scheme.DefaultValue(c)
+		}
+		return row
+	}
+
+	if stmt.Select == nil {
+		rows := make([]storage.Row, 0, len(stmt.Rows))
+		for _, values := range stmt.Rows {
+			if len(values) != len(positions) {
+				return nil, storage.ErrNotMatchValueNum
+			}
+			row := newRow()
+			for i, e := range values {
+				v, err := db.evalConst(sess, e, expr.TypeOf(scheme.ColumnDataTypes[positions[i]]), args)
+				if err != nil {
+					return nil, err
+				}
+				row[positions[i]] = v
+			}
+			rows = append(rows, row)
+		}
+		if plan != nil {
+			plan.source = &executor.Values{Rows: toValues(rows)}
+		}
+		return rows, nil
+	}
+
+	p := &planner{db: db, sess: sess, env: &expr.Env{Args: args}}
+	r, err := p.planSelect(stmt.Select)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.columns) != len(positions) {
+		return nil, storage.ErrNotMatchValueNum
+	}
+	// The values are converted to the types of the columns like the values of VALUES clause.
+	exprs := make([]expr.Expr, len(r.columns))
+	for i, c := range r.columns {
+		if exprs[i], err = expr.Coerce(&expr.Column{Index: i, Name: c.Name, T: c.T}, expr.TypeOf(scheme.ColumnDataTypes[positions[i]])); err != nil {
+			return nil, err
+		}
+	}
+	if plan != nil {
+		r.plan = executor.Analyze(r.plan)
+		plan.source = r.plan
+	}
+	values, err := executor.Run(r.plan)
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]storage.Row, 0, len(values))
+	for _, v := range values {
+		row := newRow()
+		for i, e := range exprs {
+			if row[positions[i]], err = e.Eval(p.env, v); err != nil {
+				return nil, err
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// execUpdate executes UPDATE statement. The rows to update and their new
+// values are computed before any row is updated, so the values are computed
+// from the rows before the statement. The FOREIGN KEY actions are applied
+// and the constraints are checked at the end of the statement. If plan is not
+// nil, the plan of the rows to update is instrumented and recorded in it.
+func (db *EgSQLDB) execUpdate(sess *Session, tx *Tx, stmt *query.UpdateStmt, args []interface{}, plan *modifyPlan) (*meta.ResultSet, error) {
+	table, err := db.resolveTable(sess, stmt.Table)
+	if err != nil {
+		return nil, err
+	}
+
+	var rs *meta.ResultSet
+	err = tx.Statement(func(w *Writer) error {
+		t, err := w.Table(table)
+		if err != nil {
+			return err
+		}
+		scheme := t.Scheme()
+
+		p := &planner{db: db, sess: sess, env: &expr.Env{Args: args}}
+		b := p.binder(tableColumns(scheme, aliasOr(stmt.Alias, stmt.Table.Name)))
+		positions, values, err := bindAssignments(b, scheme, stmt.Set)
+		if err != nil {
+			return err
+		}
+		source, err := planWhere(p, b, t, stmt.Where)
+		if err != nil {
+			return err
+		}
+		if plan != nil {
+			source = executor.Analyze(source)
+			plan.kind, plan.table, plan.source = "Update", table, source
+		}
+		ids, rows, err := scanWhere(source)
+		if err != nil {
+			return err
+		}
+		updated := make([]storage.Row, len(rows))
+		for i, row := range rows {
+			updated[i] = append(storage.Row{}, row...)
+			for j, pos := range positions {
+				if updated[i][pos], err = values[j].Eval(p.env, row); err != nil {
+					return err
+				}
+			}
+		}
+		for i, id := range ids {
+			if err := w.Update(table, id, updated[i]); err != nil {
+				return err
+			}
+		}
+
+		rs = meta.NewResultSet(fmt.Sprintf("UPDATE %d", len(ids)))
+		rs.AffectedRows = int64(len(ids))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rs, nil
+}
+
+// execDelete executes DELETE statement. The rows to delete are found before
+// any row is deleted. The FOREIGN KEY actions are applied and the constraints
+// are checked at the end of the statement. If plan is not nil, the plan of the
+// rows to delete is instrumented and recorded in it.
+func (db *EgSQLDB) execDelete(sess *Session, tx *Tx, stmt *query.DeleteStmt, args []interface{}, plan *modifyPlan) (*meta.ResultSet, error) {
+	table, err := db.resolveTable(sess, stmt.Table)
+	if err != nil {
+		return nil, err
+	}
+
+	var rs *meta.ResultSet
+	err = tx.Statement(func(w *Writer) error {
+		t, err := w.Table(table)
+		if err != nil {
+			return err
+		}
+
+		p := &planner{db: db, sess: sess, env: &expr.Env{Args: args}}
+		b := p.binder(tableColumns(t.Scheme(), aliasOr(stmt.Alias, stmt.Table.Name)))
+		source, err := planWhere(p, b, t, stmt.Where)
+		if err != nil {
+			return err
+		}
+		if plan != nil {
+			source = executor.Analyze(source)
+			plan.kind, plan.table, plan.source = "Delete", table, source
+		}
+		ids, _, err := scanWhere(source)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if err := w.Delete(table, id); err != nil {
+				return err
+			}
+		}
+
+		rs = meta.NewResultSet(fmt.Sprintf("DELETE %d", len(ids)))
+		rs.AffectedRows = int64(len(ids))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rs, nil
+}
+
+// tableColumns returns the columns of the table qualified with the alias.
+func tableColumns(scheme *meta.Scheme, alias string) expr.Columns {
+	columns := make(expr.Columns, len(scheme.ColumnNames))
+	for i, name := range scheme.ColumnNames {
+		columns[i] = expr.ColumnInfo{Table: alias, Name: name, T: expr.TypeOf(scheme.ColumnDataTypes[i])}
+	}
+	return columns
+}
+
+// planWhere returns the plan of the rows of the table for which the condition
+// is true, each followed by its row id. If where is nil, all rows are returned.
+// The rows are read when the plan is made, before the condition is evaluated,
+// so the subqueries in it can read the table.
+func planWhere(p *planner, b *expr.Binder, t *storage.Table, where query.Expr) (executor.Operator, error) {
+	var rows [][]interface{}
+	t.Scan(func(id int64, row storage.Row) bool {
+		rows = append(rows, append(append(make([]interface{}, 0, len(row)+1), row...), id))
+		return true
+	})
+	var plan executor.Operator = &executor.Values{Rows: rows, Table: t.Scheme().TableName}
+	if where != nil {
+		cond, err := b.BindAs(where, expr.Bool)
+		if err != nil {
+			return nil, err
+		}
+		plan = &executor.Filter{Input: plan, Cond: cond, Env: p.env}
+	}
+	return plan, nil
+}
+
+// scanWhere runs the plan made by planWhere, and returns the row ids and the rows.
+func scanWhere(plan executor.Operator) ([]int64, []storage.Row, error) {
+	values, err := executor.Run(plan)
+	if err != nil {
+		return nil, nil, err
+	}
+	ids := make([]int64, len(values))
+	rows := make([]storage.Row, len(values))
+	for i, v := range values {
+		ids[i], rows[i] = v[len(v)-1].(int64), v[:len(v)-1]
+	}
+	return ids, rows, nil
+}
+
+// bindAssignments binds the assignments of SET clause, and returns the
+// positions of the columns and their values converted to the column types.
+func bindAssignments(b *expr.Binder, scheme *meta.Scheme, set []query.Assignment) ([]int, []expr.Expr, error) {
+	positions := make([]int, 0, len(set))
+	values := make([]expr.Expr, 0, len(set))
+	for _, a := range set {
+		pos := scheme.ColumnIndex(a.Column)
+		if pos < 0 {
+			return nil, nil, errfmt.Wrap(meta.ErrNotExistColumn, a.Column)
+		}
+		for _, p := range positions {
+			if p == pos {
+				return nil, nil, errfmt.Wrap(ErrDuplicateColumn, a.Column)
+			}
+		}
+		v, err := b.BindAs(a.Value, expr.TypeOf(scheme.ColumnDataTypes[pos]))
+		if err != nil {
+			return nil, nil, err
+		}
+		positions = append(positions, pos)
+		values = append(values, v)
+	}
+	return positions, values, nil
+}
+
+// columnPositions returns the positions of the columns in the table.
+// If columns is empty, the positions of all columns are returned.
+func columnPositions(scheme *meta.Scheme, columns []string) ([]int, error) {
+	if len(columns) == 0 {
+		positions := make([]int, len(scheme.ColumnNames))
+		for i := range positions {
+			positions[i] = i
+		}
+		return positions, nil
+	}
+
+	positions := make([]int, 0, len(columns))
+	for _, c := range columns {
+		pos := scheme.ColumnIndex(c)
+		if pos < 0 {
+			return nil, errfmt.Wrap(meta.ErrNotExistColumn, c)
+		}
+		for _, p := range positions {
+			if p == pos {
+				return nil, errfmt.Wrap(ErrDuplicateColumn, c)
+			}
+		}
+		positions = append(positions, pos)
+	}
+	return positions, nil
+}
+
+// evalConst evaluates the expression that does not reference any column,
+// converting it to the type t (e.g. the type of the column to insert into).
+// It must be called in a statement because nextval() advances the sequence.
+func (db *EgSQLDB) evalConst(sess *Session, e query.Expr, t expr.Type, args []interface{}) (interface{}, error) {
+	b := &expr.Binder{Funcs: db.funcBinder(sess), Aggregates: db.funcs}
+	bound, err := b.BindAs(e, t)
+	if err != nil {
+		return nil, err
+	}
+	return bound.Eval(&expr.Env{Args: args}, nil)
+}
+
+// funcBinder returns the binder of the function calls in the session: the
+// functions of the registry and nextval('sequence'). nextval must be evaluated
+// with db.mutex locked because it advances the sequence.
+func (db *EgSQLDB) funcBinder(sess *Session) expr.FuncBinder {
+	return func(name string, args []expr.Expr) (expr.Expr, error) {
+		if name != "nextval" {
+			f, ok := db.funcs.lookup(name)
+			if !ok {
+				return nil, errfmt.Wrap(ErrNotSupportedFunction, name)
+			}
+			return f.bind(args)
+		}
+		if len(args) != 1 {
+			return nil, errfmt.Wrap(ErrWrongNumberOfArgs, "nextval takes 1 argument")
+		}
+		arg, err := expr.Coerce(args[0], expr.Varchar)
+		if err != nil {
+			return nil, err
+		}
+		return &expr.Call{Name: name, Args: []expr.Expr{arg}, T: expr.Int, Fn: func(values []interface{}) (interface{}, error) {
+			text, ok := values[0].(string)
+			if !ok {
+				return nil, errfmt.Wrap(ErrNotSupportedFunction, "nextval argument must be a sequence name")
+			}
+			seq, err := db.resolveSequence(sess, text)
+			if err != nil {
+				return nil, err
+			}
+			return db.nextVal(seq)
+		}}, nil
+	}
+}
@@ -0,0 +1,427 @@
+package dbms
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nao1215/egsql/dbms/meta"
+	"github.com/nao1215/egsql/dbms/query"
+	"github.com/nao1215/egsql/dbms/storage"
+)
+
+// execSQL parses and executes the SQL in auto-commit mode.
+func execSQL(t *testing.T, db *EgSQLDB, sql string, args ...interface{}) (int64, error) {
+	t.Helper()
+
+	stmt, _, err := query.Parse(sql)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs, err := db.Exec(nil, stmt, args)
+	if err != nil {
+		return 0, err
+	}
+	return rs.LastInsertID, nil
+}
+
+func TestEgSQLDB_Exec_Identity(t *testing.T) {
+	tests := []struct {
+		name    string
+		create  string
+		inserts []string
+		wantIDs []int64
+		want    []storage.Row
+		wantErr error
+	}{
+		{
+			name:    "[Success] AUTOINCREMENT generates id",
+			create:  "CREATE TABLE users (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT)",
+			inserts: []string{"INSERT INTO users (name) VALUES ('a')", "INSERT INTO users (name) VALUES ('b')"},
+			wantIDs: []int64{1, 2},
+			want:    []storage.Row{{int64(1), "a"}, {int64(2), "b"}},
+		},
+		{
+			name:    "[Success] explicit value advances sequence",
+			create:  "CREATE TABLE users (id INT PRIMARY KEY AUTO_INCREMENT, name TEXT)",
+			inserts: []string{"INSERT INTO users VALUES (10, 'a')", "INSERT INTO users (id, name) VALUES (NULL, 'b')"},
+			wantIDs: []int64{0, 11},
+			want:    []storage.Row{{int64(10), "a"}, {int64(11), "b"}},
+		},
+		{
+			name:    "[Error] GENERATED ALWAYS rejects explicit value",
+			create:  "CREATE TABLE users (id INT GENERATED ALWAYS AS IDENTITY PRIMARY KEY, name TEXT)",
+			inserts: []string{"INSERT INTO users VALUES (1, 'a')"},
+			wantErr: ErrGeneratedAlways,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := NewEgSQLDB(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := execSQL(t, db, tt.create); err != nil {
+				t.Fatal(err)
+			}
+
+			var gotIDs []int64
+			for _, sql := range tt.inserts {
+				id, err := execSQL(t, db, sql)
+				if err != nil {
+					if !errors.Is(err, tt.wantErr) {
+						t.Fatalf("Exec() error = %v, wantErr %v", err, tt.wantErr)
+					}
+					return
+				}
+				gotIDs = append(gotIDs, id)
+			}
+			if tt.wantErr != nil {
+				t.Fatalf("Exec() error = nil, wantErr %v", tt.wantErr)
+			}
+			if diff := cmp.Diff(tt.wantIDs, gotIDs); diff != "" {
+				t.Errorf("LastInsertID mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.want, rows(db, "users")); diff != "" {
+				t.Errorf("rows mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestEgSQLDB_Exec_SequenceSurvivesReopen(t *testing.T) {
+	home := t.TempDir()
+	db, err := NewEgSQLDB(home)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := execSQL(t, db, "CREATE SEQUENCE order_no START WITH 100 INCREMENT BY 10"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := execSQL(t, db, "CREATE TABLE orders (no INT PRIMARY KEY)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := execSQL(t, db, "INSERT INTO orders VALUES (nextval('order_no')), (nextval('order_no'))"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The values reserved before reopening are never returned again.
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db, err = NewEgSQLDB(home)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := db.NextVal("order_no")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := int64(100 + 10*sequenceCacheSize); got != want {
+		t.Errorf("NextVal() = %d, want %d", got, want)
+	}
+
+	if _, err := db.NextVal("not_exist"); !errors.Is(err, ErrNotExistSequence) {
+		t.Errorf("NextVal() error = %v, want %v", err, ErrNotExistSequence)
+	}
+}
+
+func TestEgSQLDB_Exec_Upsert(t *testing.T) {
+	tests := []struct {
+		name         string
+		sql          string
+		args         []interface{}
+		wantAffected int64
+		want         []storage.Row
+		wantErr      error
+	}{
+		{
+			name:         "[Success] do nothing skips conflicting rows",
+			sql:          "INSERT INTO users VALUES (1, 'x@example.com', 0), (3, 'c@example.com', 0), (4, 'b@example.com', 0) ON CONFLICT DO NOTHING",
+			wantAffected: 1,
+			want:         []storage.Row{{int64(1), "a@example.com", int64(1)}, {int64(2), "b@example.com", int64(2)}, {int64(3), "c@example.com", int64(0)}},
+		},
+		{
+			name:         "[Success] do nothing skips duplicates in the rows to insert",
+			sql:          "INSERT INTO users VALUES (3, 'c@example.com', 0), (3, 'd@example.com', 0) ON CONFLICT (id) DO NOTHING",
+			wantAffected: 1,
+			want:         []storage.Row{{int64(1), "a@example.com", int64(1)}, {int64(2), "b@example.com", int64(2)}, {int64(3), "c@example.com", int64(0)}},
+		},
+		{
+			name:         "[Success] do update with excluded",
+			sql:          "INSERT INTO users VALUES (1, 'x@example.com', 5), (3, 'c@example.com', 0) ON CONFLICT (id) DO UPDATE SET email = excluded.email, n = users.n + excluded.n",
+			wantAffected: 2,
+			want:         []storage.Row{{int64(1), "x@example.com", int64(6)}, {int64(2), "b@example.com", int64(2)}, {int64(3), "c@example.com", int64(0)}},
+		},
+		{
+			name:         "[Success] do update on unique column with condition",
+			sql:          "INSERT INTO users (id, email) VALUES (10, 'a@example.com'), (11, 'b@example.com') ON CONFLICT (email) DO UPDATE SET n = n + ? WHERE n > 1",
+			args:         []interface{}{int64(10)},
+			wantAffected: 1,
+			want:         []storage.Row{{int64(1), "a@example.com", int64(1)}, {int64(2), "b@example.com", int64(12)}},
+		},
+		{
+			name:         "[Success] insert select",
+			sql:          "INSERT INTO users (id, email) SELECT id + 10, email || '.org' FROM users WHERE n > ?",
+			args:         []interface{}{int64(0)},
+			wantAffected: 2,
+			want: []storage.Row{
+				{int64(1), "a@example.com", int64(1)}, {int64(2), "b@example.com", int64(2)},
+				{int64(11), "a@example.com.org", int64(0)}, {int64(12), "b@example.com.org", int64(0)},
+			},
+		},
+		{
+			name:         "[Success] insert select on conflict",
+			sql:          "INSERT INTO users SELECT id, email, 100 FROM users ON CONFLICT (id) DO UPDATE SET n = excluded.n",
+			wantAffected: 2,
+			want:         []storage.Row{{int64(1), "a@example.com", int64(100)}, {int64(2), "b@example.com", int64(100)}},
+		},
+		{
+			name:    "[Error] conflict on other constraint",
+			sql:     "INSERT INTO users VALUES (3, 'a@example.com', 0) ON CONFLICT (id) DO NOTHING",
+			wantErr: storage.ErrDuplicateKey,
+		},
+		{
+			name:    "[Error] do update affects a row twice",
+			sql:     "INSERT INTO users VALUES (1, 'x@example.com', 0), (1, 'y@example.com', 0) ON CONFLICT (id) DO UPDATE SET email = excluded.email",
+			wantErr: ErrConflictTwice,
+		},
+		{
+			name:    "[Error] no unique constraint on conflict columns",
+			sql:     "INSERT INTO users VALUES (1, 'x@example.com', 0) ON CONFLICT (n) DO NOTHING",
+			wantErr: ErrNoConflictTarget,
+		},
+		{
+			name:    "[Error] do update without conflict columns",
+			sql:     "INSERT INTO users VALUES (1, 'x@example.com', 0) ON CONFLICT DO UPDATE SET n = 0",
+			wantErr: ErrNoConflictTarget,
+		},
+		{
+			name:    "[Error] excluded column must be qualified",
+			sql:     "INSERT INTO users VALUES (1, 'x@example.com', 0) ON CONFLICT (id) DO UPDATE SET n = excluded",
+			wantErr: meta.ErrNotExistColumn,
+		},
+		{
+			name:    "[Error] insert select with wrong number of columns",
+			sql:     "INSERT INTO users SELECT id FROM users",
+			wantErr: storage.ErrNotMatchValueNum,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := NewEgSQLDB(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, sql := range []string{
+				"CREATE TABLE users (id INT PRIMARY KEY, email TEXT UNIQUE, n INT DEFAULT 0)",
+				"INSERT INTO users VALUES (1, 'a@example.com', 1), (2, 'b@example.com', 2)",
+			} {
+				if _, err := execSQL(t, db, sql); err != nil {
+					t.Fatal(err)
+				}
+			}
+			before := rows(db, "users")
+
+			stmt, _, err := query.Parse(tt.sql)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rs, err := db.Exec(nil, stmt, tt.args)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Exec() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				// The statement is rolled back.
+				if diff := cmp.Diff(before, rows(db, "users")); diff != "" {
+					t.Errorf("rows mismatch (-want +got):\n%s", diff)
+				}
+				return
+			}
+			if rs.AffectedRows != tt.wantAffected {
+				t.Errorf("AffectedRows = %d, want %d", rs.AffectedRows, tt.wantAffected)
+			}
+			if diff := cmp.Diff(tt.want, rows(db, "users")); diff != "" {
+				t.Errorf("rows mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestEgSQLDB_Exec_Insert(t *testing.T) {
+	tests := []struct {
+		name         string
+		sql          string
+		args         []interface{}
+		wantAffected int64
+		want         []storage.Row
+		wantErr      error
+	}{
+		{
+			name:         "[Success] all columns with placeholders",
+			sql:          "INSERT INTO users VALUES (1, ?), (2, NULL)",
+			args:         []interface{}{"a"},
+			wantAffected: 2,
+			want:         []storage.Row{{int64(1), "a"}, {int64(2), nil}},
+		},
+		{
+			name:         "[Success] omitted column is default",
+			sql:          "INSERT INTO users (id) VALUES (1)",
+			wantAffected: 1,
+			want:         []storage.Row{{int64(1), "none"}},
+		},
+		{
+			name:    "[Error] column is specified twice",
+			sql:     "INSERT INTO users (id, id) VALUES (1, 2)",
+			wantErr: ErrDuplicateColumn,
+		},
+		{
+			name:    "[Error] missing argument",
+			sql:     "INSERT INTO users VALUES (1, ?)",
+			wantErr: ErrNotMatchArgNum,
+		},
+		{
+			name:    "[Error] number of values does not match",
+			sql:     "INSERT INTO users (id, name) VALUES (1)",
+			wantErr: storage.ErrNotMatchValueNum,
+		},
+		{
+			name:    "[Error] duplicate key undoes the statement",
+			sql:     "INSERT INTO users VALUES (1, 'a'), (1, 'b')",
+			wantErr: storage.ErrDuplicateKey,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := NewEgSQLDB(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := execSQL(t, db, "CREATE TABLE users (id INT PRIMARY KEY, name TEXT DEFAULT 'none')"); err != nil {
+				t.Fatal(err)
+			}
+
+			stmt, _, err := query.Parse(tt.sql)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rs, err := db.Exec(nil, stmt, tt.args)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Exec() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && rs.AffectedRows != tt.wantAffected {
+				t.Errorf("AffectedRows = %d, want %d", rs.AffectedRows, tt.wantAffected)
+			}
+			if diff := cmp.Diff(tt.want, rows(db, "users")); diff != "" {
+				t.Errorf("rows mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestEgSQLDB_Exec_UpdateDelete(t *testing.T) {
+	tests := []struct {
+		name         string
+		sql          string
+		args         []interface{}
+		wantAffected int64
+		want         []storage.Row
+		wantErr      error
+	}{
+		{
+			name:         "[Success] update with condition",
+			sql:          "UPDATE users SET n = n + ?, email = 'x@example.com' WHERE id = 1",
+			args:         []interface{}{int64(10)},
+			wantAffected: 1,
+			want:         []storage.Row{{int64(1), "x@example.com", int64(11)}, {int64(2), "b@example.com", int64(2)}, {int64(3), "c@example.com", int64(3)}},
+		},
+		{
+			name:         "[Success] update sees the values before the statement",
+			sql:          "UPDATE users u SET id = u.n + 10, n = u.id WHERE u.n > 1",
+			wantAffected: 2,
+			want:         []storage.Row{{int64(1), "a@example.com", int64(1)}, {int64(12), "b@example.com", int64(2)}, {int64(13), "c@example.com", int64(3)}},
+		},
+		{
+			name:         "[Success] update all rows",
+			sql:          "UPDATE users SET n = 0",
+			wantAffected: 3,
+			want:         []storage.Row{{int64(1), "a@example.com", int64(0)}, {int64(2), "b@example.com", int64(0)}, {int64(3), "c@example.com", int64(0)}},
+		},
+		{
+			name:         "[Success] delete with subquery",
+			sql:          "DELETE FROM users WHERE n > (SELECT MIN(n) FROM users)",
+			wantAffected: 2,
+			want:         []storage.Row{{int64(1), "a@example.com", int64(1)}},
+		},
+		{
+			name:         "[Success] delete nothing",
+			sql:          "DELETE FROM users AS u WHERE u.email IS NULL",
+			wantAffected: 0,
+			want:         []storage.Row{{int64(1), "a@example.com", int64(1)}, {int64(2), "b@example.com", int64(2)}, {int64(3), "c@example.com", int64(3)}},
+		},
+		{
+			name:         "[Success] delete all rows",
+			sql:          "DELETE FROM users",
+			wantAffected: 3,
+		},
+		{
+			name:    "[Error] duplicate key undoes the statement",
+			sql:     "UPDATE users SET email = 'a@example.com' WHERE id > 1",
+			wantErr: storage.ErrDuplicateKey,
+		},
+		{
+			name:    "[Error] column is assigned twice",
+			sql:     "UPDATE users SET n = 1, n = 2",
+			wantErr: ErrDuplicateColumn,
+		},
+		{
+			name:    "[Error] column does not exist",
+			sql:     "UPDATE users SET age = 1",
+			wantErr: meta.ErrNotExistColumn,
+		},
+		{
+			name:    "[Error] table does not exist",
+			sql:     "DELETE FROM groups",
+			wantErr: ErrNotExistTable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := NewEgSQLDB(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, sql := range []string{
+				"CREATE TABLE users (id INT PRIMARY KEY, email TEXT UNIQUE, n INT DEFAULT 0)",
+				"INSERT INTO users VALUES (1, 'a@example.com', 1), (2, 'b@example.com', 2), (3, 'c@example.com', 3)",
+			} {
+				if _, err := execSQL(t, db, sql); err != nil {
+					t.Fatal(err)
+				}
+			}
+			before := rows(db, "users")
+
+			stmt, _, err := query.Parse(tt.sql)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rs, err := db.Exec(nil, stmt, tt.args)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Exec() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				// The statement is rolled back.
+				if diff := cmp.Diff(before, rows(db, "users")); diff != "" {
+					t.Errorf("rows mismatch (-want +got):\n%s", diff)
+				}
+				return
+			}
+			if rs.AffectedRows != tt.wantAffected {
+				t.Errorf("AffectedRows = %d, want %d", rs.AffectedRows, tt.wantAffected)
+			}
+			if diff := cmp.Diff(tt.want, rows(db, "users")); diff != "" {
+				t.Errorf("rows mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,359 @@
+package executor
+
+import (
+	"hash/fnv"
+	"io"
+
+	"github.com/nao1215/egsql/dbms/expr"
+)
+
+const (
+	// spillPartitions is the number of the partitions that HashAggregate
+	// writes the rows of the new groups to when the groups exceed the budget.
+	spillPartitions = 8
+	// maxSpillDepth is the number of times that the rows of a group can be
+	// partitioned. The partition at the depth is aggregated in memory
+	// regardless of the budget, because its rows are too skewed to split.
+	maxSpillDepth = 4
+	// accumulatorSize is the approximate bytes of an accumulator in memory.
+	accumulatorSize = 64
+)
+
+// operatorSource reads the rows of the operator.
+type operatorSource struct {
+	op Operator
+}
+
+// next returns the next row of the operator.
+func (s operatorSource) next() ([]interface{}, error) {
+	return s.op.Next()
+}
+
+// group is the accumulators of the rows that have the same keys.
+type group struct {
+	keys []interface{}
+	accs []expr.Accumulator
+}
+
+// newGroup returns the group of the keys.
+func newGroup(keys []interface{}, aggs []*expr.Aggregate) *group {
+	g := &group{keys: keys, accs: make([]expr.Accumulator, len(aggs))}
+	for i, a := range aggs {
+		g.accs[i] = a.NewAccumulator()
+	}
+	return g
+}
+
+// step adds the row to the accumulators.
+func (g *group) step(env *expr.Env, aggs []*expr.Aggregate, row []interface{}) error {
+	for i, a := range aggs {
+		args, err := a.Eval(env, row)
+		if err != nil {
+			return err
+		}
+		if err := g.accs[i].Step(args); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// result returns the grouped row: the keys followed by the results of the aggregate functions.
+func (g *group) result() ([]interface{}, error) {
+	row := append(make([]interface{}, 0, len(g.keys)+len(g.accs)), g.keys...)
+	for _, acc := range g.accs {
+		v, err := acc.Result()
+		if err != nil {
+			return nil, err
+		}
+		row = append(row, v)
+	}
+	return row, nil
+}
+
+// HashAggregate groups the input rows by the values of Keys in a hash table,
+// and returns a grouped row for each group: the values of Keys followed by
+// the results of Aggregates. If Keys is empty, it returns one row even if
+// there is no input row.
+//
+// When the groups in memory exceed the budget, the rows of the new groups are
+// written to the partitions in temporary files by the hash of their keys, and
+// each partition is aggregated after the groups in memory are returned.
+// The groups are returned in the order of their first rows in each pass.
+type HashAggregate struct {
+	Input      Operator
+	Keys       []expr.Expr
+	Aggregates []*expr.Aggregate
+	Env        *expr.Env
+	Config     *Config
+
+	out     [][]interface{}
+	pending []partition
+}
+
+// partition is the rows of the groups that are spilled to a temporary file.
+type partition struct {
+	file  *spillFile
+	depth int
+}
+
+// Open aggregates the input rows that fit in memory.
+func (h *HashAggregate) Open() error {
+	h.out, h.pending = nil, nil
+	if err := h.Input.Open(); err != nil {
+		return err
+	}
+	return h.aggregate(operatorSource{h.Input}, 0)
+}
+
+// Next returns the next grouped row.
+func (h *HashAggregate) Next() ([]interface{}, error) {
+	for len(h.out) == 0 {
+		if len(h.pending) == 0 {
+			return nil, io.EOF
+		}
+		p := h.pending[0]
+		h.pending = h.pending[1:]
+		err := h.aggregate(p.file, p.depth)
+		if closeErr := p.file.close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	row := h.out[0]
+	h.out = h.out[1:]
+	return row, nil
+}
+
+// Close removes the temporary files and closes the input.
+func (h *HashAggregate) Close() error {
+	var files []*spillFile
+	for _, p := range h.pending {
+		files = append(files, p.file)
+	}
+	h.out, h.pending = nil, nil
+	err := closeAll(files)
+	if inErr := h.Input.Close(); err == nil {
+		err = inErr
+	}
+	return err
+}
+
+// aggregate aggregates the rows of the source, and adds the grouped rows to h.out
+// and the partitions of the spilled rows to h.pending.
+func (h *HashAggregate) aggregate(src rowSource, depth int) error {
+	index := make(map[string]*group)
+	var groups []*group
+	var parts []*spillFile
+	size := int64(0)
+	for {
+		row, err := src.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			closeAll(parts)
+			return err
+		}
+		keys, err := evalAll(h.Env, h.Keys, row)
+		if err != nil {
+			closeAll(parts)
+			return err
+		}
+		key := expr.Key(keys)
+		g, ok := index[key]
+		if !ok {
+			if parts == nil && len(groups) > 0 && size > h.Config.workMem() && depth < maxSpillDepth {
+				if parts, err = newPartitions(h.Config); err != nil {
+					return err
+				}
+			}
+			if parts != nil {
+				if err := parts[partitionOf(key, depth)].write(row); err != nil {
+					closeAll(parts)
+					return err
+				}
+				continue
+			}
+			g = newGroup(keys, h.Aggregates)
+			index[key] = g
+			groups = append(groups, g)
+			size += rowSize(keys) + accumulatorSize*int64(len(h.Aggregates))
+		}
+		if err := g.step(h.Env, h.Aggregates, row); err != nil {
+			closeAll(parts)
+			return err
+		}
+	}
+	if len(groups) == 0 && len(h.Keys) == 0 {
+		groups = append(groups, newGroup(nil, h.Aggregates))
+	}
+
+	for _, g := range groups {
+		row, err := g.result()
+		if err != nil {
+			closeAll(parts)
+			return err
+		}
+		h.out = append(h.out, row)
+	}
+	for _, f := range parts {
+		if f.rows == 0 {
+			f.close()
+			continue
+		}
+		if err := f.rewind(); err != nil {
+			closeAll(parts)
+			return err
+		}
+		h.pending = append(h.pending, partition{file: f, depth: depth + 1})
+	}
+	return nil
+}
+
+// newPartitions creates the temporary files of the partitions.
+func newPartitions(c *Config) ([]*spillFile, error) {
+	parts := make([]*spillFile, spillPartitions)
+	for i := range parts {
+		f, err := newSpillFile(c)
+		if err != nil {
+			closeAll(parts[:i])
+			return nil, err
+		}
+		parts[i] = f
+	}
+	return parts, nil
+}
+
+// partitionOf returns the partition of the group key. The hash depends on
+// the depth so that the rows of a partition are split again at the next depth.
+func partitionOf(key string, depth int) int {
+	h := fnv.New32a()
+	h.Write([]byte{byte(depth)})
+	h.Write([]byte(key))
+	return int(h.Sum32() % spillPartitions)
+}
+
+// SortAggregate sorts the input rows by the values of Keys, and aggregates
+// the consecutive rows that have the same keys. It returns the same rows as
+// HashAggregate in the order of the keys. The sort writes the sorted runs
+// to temporary files when the rows exceed the budget.
+type SortAggregate struct {
+	Input      Operator
+	Keys       []expr.Expr
+	Aggregates []*expr.Aggregate
+	Env        *expr.Env
+	Config     *Config
+
+	sorter *sorter
+	src    rowSource
+	// lookahead is the first row of the next group.
+	lookahead []interface{}
+	done      bool
+	// emitted is the number of the returned groups.
+	emitted int
+}
+
+// Open sorts the input rows.
+func (s *SortAggregate) Open() error {
+	s.lookahead, s.done, s.emitted = nil, false, 0
+	if err := s.Input.Open(); err != nil {
+		return err
+	}
+	sortKeys := make([]SortKey, len(s.Keys))
+	for i := range sortKeys {
+		sortKeys[i] = SortKey{Index: i}
+	}
+	s.sorter = newSorter(sortKeys, s.Config)
+	for {
+		row, err := s.Input.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		// The sorted row is the keys followed by the input row.
+		keys, err := evalAll(s.Env, s.Keys, row)
+		if err != nil {
+			return err
+		}
+		if err := s.sorter.add(append(keys, row...)); err != nil {
+			return err
+		}
+	}
+	src, err := s.sorter.sorted()
+	if err != nil {
+		return err
+	}
+	s.src = src
+	return nil
+}
+
+// Next returns the grouped row of the next keys.
+func (s *SortAggregate) Next() ([]interface{}, error) {
+	if s.done {
+		return nil, io.EOF
+	}
+	first := s.lookahead
+	if first == nil {
+		row, err := s.src.next()
+		if err == io.EOF {
+			s.done = true
+			if len(s.Keys) == 0 && s.emitted == 0 {
+				s.emitted++
+				return newGroup(nil, s.Aggregates).result()
+			}
+			return nil, io.EOF
+		}
+		if err != nil {
+			return nil, err
+		}
+		first = row
+	}
+
+	n := len(s.Keys)
+	g := newGroup(first[:n], s.Aggregates)
+	if err := g.step(s.Env, s.Aggregates, first[n:]); err != nil {
+		return nil, err
+	}
+	s.lookahead = nil
+	for {
+		row, err := s.src.next()
+		if err == io.EOF {
+			s.done = true
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		c, err := compareRows(s.sorter.keys, first, row)
+		if err != nil {
+			return nil, err
+		}
+		if c != 0 {
+			s.lookahead = row
+			break
+		}
+		if err := g.step(s.Env, s.Aggregates, row[n:]); err != nil {
+			return nil, err
+		}
+	}
+	s.emitted++
+	return g.result()
+}
+
+// Close removes the temporary files and closes the input.
+func (s *SortAggregate) Close() error {
+	var err error
+	if s.sorter != nil {
+		err = s.sorter.close()
+		s.sorter, s.src = nil, nil
+	}
+	if inErr := s.Input.Close(); err == nil {
+		err = inErr
+	}
+	return err
+}
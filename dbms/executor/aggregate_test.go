@@ -0,0 +1,165 @@
+package executor
+
+import (
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nao1215/egsql/dbms/expr"
+)
+
+// newTestAggregates returns COUNT(*), SUM(x) and COUNT(DISTINCT x) where x is the column at 1.
+func newTestAggregates(t *testing.T) []*expr.Aggregate {
+	t.Helper()
+
+	x := &expr.Column{Index: 1, Name: "x", T: expr.Int}
+	count, err := expr.NewAggregate("count", nil, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum, err := expr.NewAggregate("sum", []expr.Expr{x}, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	distinct, err := expr.NewAggregate("count", []expr.Expr{x}, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []*expr.Aggregate{count, sum, distinct}
+}
+
+// testRows returns the rows (g, x) where g is i % groups and x is i % 3,
+// and the expected grouped rows (g, COUNT(*), SUM(x), COUNT(DISTINCT x)) sorted by g.
+func testRows(n, groups int) ([][]interface{}, [][]interface{}) {
+	var rows [][]interface{}
+	want := make([][]interface{}, groups)
+	distinct := make([]map[int64]bool, groups)
+	for g := range want {
+		want[g] = []interface{}{int64(g), int64(0), nil, int64(0)}
+		distinct[g] = make(map[int64]bool)
+	}
+	for i := 0; i < n; i++ {
+		g, x := i%groups, int64(i%3)
+		rows = append(rows, []interface{}{int64(g), x})
+		w := want[g]
+		w[1] = w[1].(int64) + 1
+		if w[2] == nil {
+			w[2] = int64(0)
+		}
+		w[2] = w[2].(int64) + x
+		distinct[g][x] = true
+		w[3] = int64(len(distinct[g]))
+	}
+	return rows, want
+}
+
+func TestAggregate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rows    int
+		groups  int
+		workMem int64
+		hash    bool
+	}{
+		{name: "[Success] hash aggregation in memory", rows: 100, groups: 7, hash: true},
+		{name: "[Success] hash aggregation with spill", rows: 3000, groups: 500, workMem: 1024, hash: true},
+		{name: "[Success] sort aggregation in memory", rows: 100, groups: 7},
+		{name: "[Success] sort aggregation with spill", rows: 3000, groups: 500, workMem: 1024},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, want := testRows(tt.rows, tt.groups)
+			config := &Config{TempDir: t.TempDir(), WorkMem: tt.workMem}
+			keys := []expr.Expr{&expr.Column{Index: 0, Name: "g", T: expr.Int}}
+			var op Operator
+			if tt.hash {
+				op = &HashAggregate{Input: &Values{Rows: rows}, Keys: keys, Aggregates: newTestAggregates(t), Config: config}
+			} else {
+				op = &SortAggregate{Input: &Values{Rows: rows}, Keys: keys, Aggregates: newTestAggregates(t), Config: config}
+			}
+
+			got, err := Run(op)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sort.Slice(got, func(i, j int) bool { return got[i][0].(int64) < got[j][0].(int64) })
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("Run() mismatch (-want +got):\n%s", diff)
+			}
+			files, err := os.ReadDir(config.TempDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) != 0 {
+				t.Errorf("temporary files are left: %v", files)
+			}
+		})
+	}
+}
+
+func TestAggregate_NoKeys(t *testing.T) {
+	for _, op := range []Operator{
+		&HashAggregate{Input: &Values{}, Aggregates: newTestAggregates(t)},
+		&SortAggregate{Input: &Values{}, Aggregates: newTestAggregates(t)},
+	} {
+		got, err := Run(op)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := [][]interface{}{{int64(0), nil, int64(0)}}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("Run(%T) mismatch (-want +got):\n%s", op, diff)
+		}
+	}
+}
+
+func TestSorter(t *testing.T) {
+	config := &Config{TempDir: t.TempDir(), WorkMem: 256}
+	s := newSorter([]SortKey{{Index: 0, Desc: true}, {Index: 1, NullsFirst: true}}, config)
+	var want [][]interface{}
+	for i := 0; i < 200; i++ {
+		var b interface{} = "x"
+		if i%4 == 0 {
+			b = nil
+		}
+		row := []interface{}{int64(i % 5), b, int64(i)}
+		if err := s.add(row); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, row)
+	}
+	if len(s.runs) == 0 {
+		t.Fatal("no sorted run is spilled")
+	}
+	// The sort is stable, so the rows of the same keys keep the order of i.
+	sort.SliceStable(want, func(i, j int) bool {
+		a, b := want[i], want[j]
+		if a[0] != b[0] {
+			return a[0].(int64) > b[0].(int64)
+		}
+		return a[1] == nil && b[1] != nil
+	})
+
+	src, err := s.sorted()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got [][]interface{}
+	for {
+		row, err := src.next()
+		if err != nil {
+			break
+		}
+		got = append(got, row)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("sorted() mismatch (-want +got):\n%s", diff)
+	}
+	if err := s.close(); err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := os.ReadDir(config.TempDir); len(files) != 0 {
+		t.Errorf("temporary files are left: %v", files)
+	}
+}
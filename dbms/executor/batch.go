@@ -0,0 +1,267 @@
+package executor
+
+import (
+	"io"
+
+	"github.com/nao1215/egsql/dbms/expr"
+)
+
+// BatchSize is the maximum number of rows in a batch.
+const BatchSize = 1024
+
+// Batch is the rows stored as column vectors: Vectors[i][j] is the value of
+// the i-th column of the j-th row. Processing the rows a batch at a time
+// reduces the per-row overhead of calling the operators.
+type Batch struct {
+	Vectors [][]interface{}
+	// Len is the number of rows.
+	Len int
+}
+
+// newBatch returns the empty batch of the columns.
+func newBatch(width, capacity int) *Batch {
+	b := &Batch{Vectors: make([][]interface{}, width)}
+	for i := range b.Vectors {
+		b.Vectors[i] = make([]interface{}, 0, capacity)
+	}
+	return b
+}
+
+// Row returns the j-th row of the batch.
+func (b *Batch) Row(j int) []interface{} {
+	row := make([]interface{}, len(b.Vectors))
+	for i, v := range b.Vectors {
+		row[i] = v[j]
+	}
+	return row
+}
+
+// append appends the row to the batch.
+func (b *Batch) append(row []interface{}) {
+	for i, v := range row {
+		b.Vectors[i] = append(b.Vectors[i], v)
+	}
+	b.Len++
+}
+
+// slice returns the rows of the batch from i to j.
+func (b *Batch) slice(i, j int) *Batch {
+	s := &Batch{Vectors: make([][]interface{}, len(b.Vectors)), Len: j - i}
+	for k, v := range b.Vectors {
+		s.Vectors[k] = v[i:j]
+	}
+	return s
+}
+
+// BatchOperator is the operator that also returns the rows a batch at a time.
+// The operators that have no native batch processing are read by NextBatch
+// through Next. An operator is read by either Next or NextBatch until it is
+// closed, not both.
+type BatchOperator interface {
+	Operator
+	// NextBatch returns the next batch of at least one and at most max rows.
+	// It returns io.EOF if there is no more row. The batch is valid until
+	// the next call and must not be modified by the caller.
+	NextBatch(max int) (*Batch, error)
+}
+
+// NextBatch returns the next batch of at most max rows of the opened operator.
+// If the operator is not a BatchOperator, the rows are read by Next.
+func NextBatch(op Operator, max int) (*Batch, error) {
+	if b, ok := op.(BatchOperator); ok {
+		return b.NextBatch(max)
+	}
+	var batch *Batch
+	for batch == nil || batch.Len < max {
+		row, err := op.Next()
+		if err == io.EOF && batch != nil {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if batch == nil {
+			batch = newBatch(len(row), max)
+		}
+		batch.append(row)
+	}
+	return batch, nil
+}
+
+// NextBatch returns the next rows.
+func (v *Values) NextBatch(max int) (*Batch, error) {
+	if v.pos >= len(v.Rows) {
+		return nil, io.EOF
+	}
+	end := v.pos + max
+	if end > len(v.Rows) {
+		end = len(v.Rows)
+	}
+	batch := newBatch(len(v.Rows[v.pos]), end-v.pos)
+	for _, row := range v.Rows[v.pos:end] {
+		batch.append(row)
+	}
+	v.pos = end
+	return batch, nil
+}
+
+// NextBatch returns the next rows of the key.
+func (s *IndexScan) NextBatch(max int) (*Batch, error) {
+	var batch *Batch
+	for len(s.ids) > 0 && (batch == nil || batch.Len < max) {
+		id := s.ids[0]
+		s.ids = s.ids[1:]
+		if row, ok := s.Table.Get(id); ok {
+			if batch == nil {
+				batch = newBatch(len(row), max)
+			}
+			batch.append(row)
+		}
+	}
+	if batch == nil {
+		return nil, io.EOF
+	}
+	return batch, nil
+}
+
+// NextBatch returns the rows of the next input batch that satisfy the condition.
+func (f *Filter) NextBatch(max int) (*Batch, error) {
+	for {
+		in, err := NextBatch(f.Input, max)
+		if err != nil {
+			return nil, err
+		}
+		conds, err := evalVector(f.Env, f.Cond, in)
+		if err != nil {
+			return nil, err
+		}
+		out := newBatch(len(in.Vectors), in.Len)
+		for j, ok := range conds {
+			if ok != true {
+				continue
+			}
+			for i, v := range in.Vectors {
+				out.Vectors[i] = append(out.Vectors[i], v[j])
+			}
+			out.Len++
+		}
+		if out.Len > 0 {
+			return out, nil
+		}
+	}
+}
+
+// NextBatch returns the values of the expressions for the next input batch.
+func (p *Project) NextBatch(max int) (*Batch, error) {
+	in, err := NextBatch(p.Input, max)
+	if err != nil {
+		return nil, err
+	}
+	out := &Batch{Vectors: make([][]interface{}, len(p.Exprs)), Len: in.Len}
+	for i, e := range p.Exprs {
+		if out.Vectors[i], err = evalVector(p.Env, e, in); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// NextBatch returns the next rows within the limit. It reads no more input
+// rows than the limit, so that the expressions of the input are not evaluated
+// for the rows that are not returned.
+func (l *Limit) NextBatch(max int) (*Batch, error) {
+	for l.skip > 0 {
+		n := BatchSize
+		if l.skip < int64(n) {
+			n = int(l.skip)
+		}
+		b, err := NextBatch(l.Input, n)
+		if err != nil {
+			return nil, err
+		}
+		l.skip -= int64(b.Len)
+	}
+	if l.remaining == 0 {
+		return nil, io.EOF
+	}
+	if l.remaining > 0 && l.remaining < int64(max) {
+		max = int(l.remaining)
+	}
+	b, err := NextBatch(l.Input, max)
+	if err != nil {
+		return nil, err
+	}
+	if l.remaining > 0 {
+		l.remaining -= int64(b.Len)
+	}
+	return b, nil
+}
+
+// evalVector returns the values of the expression for the rows of the batch.
+// The columns are evaluated without copying, and the operands of the binary
+// operators are evaluated as vectors. The other expressions are evaluated
+// for each row.
+func evalVector(env *expr.Env, e expr.Expr, b *Batch) ([]interface{}, error) {
+	switch e := e.(type) {
+	case *expr.Column:
+		return b.Vectors[e.Index], nil
+	case *expr.Const, *expr.Param:
+		v, err := e.Eval(env, nil)
+		if err != nil {
+			return nil, err
+		}
+		values := make([]interface{}, b.Len)
+		for j := range values {
+			values[j] = v
+		}
+		return values, nil
+	case *expr.Comparison:
+		return evalBinary(env, &expr.Comparison{Op: e.Op, Left: pairLeft, Right: pairRight}, e.Left, e.Right, b)
+	case *expr.Arith:
+		return evalBinary(env, &expr.Arith{Op: e.Op, Left: pairLeft, Right: pairRight}, e.Left, e.Right, b)
+	case *expr.Concat:
+		return evalBinary(env, &expr.Concat{Left: pairLeft, Right: pairRight}, e.Left, e.Right, b)
+	}
+
+	values := make([]interface{}, b.Len)
+	row := make([]interface{}, len(b.Vectors))
+	for j := range values {
+		for i, v := range b.Vectors {
+			row[i] = v[j]
+		}
+		v, err := e.Eval(env, row)
+		if err != nil {
+			return nil, err
+		}
+		values[j] = v
+	}
+	return values, nil
+}
+
+// pairLeft and pairRight are the operands of the binary operator evaluated by evalBinary.
+var (
+	pairLeft  = &expr.Column{Index: 0}
+	pairRight = &expr.Column{Index: 1}
+)
+
+// evalBinary evaluates the operands left and right as vectors, and then op,
+// whose operands are pairLeft and pairRight, for each pair of the values.
+func evalBinary(env *expr.Env, op expr.Expr, left, right expr.Expr, b *Batch) ([]interface{}, error) {
+	l, err := evalVector(env, left, b)
+	if err != nil {
+		return nil, err
+	}
+	r, err := evalVector(env, right, b)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]interface{}, b.Len)
+	pair := make([]interface{}, 2)
+	for j := range values {
+		pair[0], pair[1] = l[j], r[j]
+		if values[j], err = op.Eval(env, pair); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
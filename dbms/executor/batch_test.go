@@ -0,0 +1,134 @@
+package executor
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nao1215/egsql/dbms/expr"
+)
+
+func TestNextBatch(t *testing.T) {
+	rows := make([][]interface{}, 2500)
+	for i := range rows {
+		rows[i] = []interface{}{int64(i), "x"}
+	}
+	x := &expr.Column{Index: 0}
+	even := &expr.Comparison{
+		Op:    "=",
+		Left:  &expr.Arith{Op: "%", Left: x, Right: &expr.Const{Value: int64(2), T: expr.Int}},
+		Right: &expr.Const{Value: int64(0), T: expr.Int},
+	}
+	tests := []struct {
+		name string
+		plan func() Operator
+		// want is the lengths of the batches.
+		want []int
+	}{
+		{
+			name: "[Success] values",
+			plan: func() Operator { return &Values{Rows: rows} },
+			want: []int{1024, 1024, 452},
+		},
+		{
+			name: "[Success] filter and project",
+			plan: func() Operator {
+				return &Project{Input: &Filter{Input: &Values{Rows: rows}, Cond: even}, Exprs: []expr.Expr{x, even}}
+			},
+			want: []int{512, 512, 226},
+		},
+		{
+			name: "[Success] limit and offset",
+			plan: func() Operator {
+				return &Limit{
+					Input:  &Values{Rows: rows},
+					Count:  &expr.Const{Value: int64(1500), T: expr.Int},
+					Offset: &expr.Const{Value: int64(10), T: expr.Int},
+				}
+			},
+			want: []int{1024, 476},
+		},
+		{
+			name: "[Success] operator without batches",
+			plan: func() Operator { return &Sort{Input: &Values{Rows: rows}, Keys: []SortKey{{Index: 0, Desc: true}}} },
+			want: []int{1024, 1024, 452},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, err := runRows(tt.plan())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			plan := tt.plan()
+			defer plan.Close()
+			if err := plan.Open(); err != nil {
+				t.Fatal(err)
+			}
+			var lens []int
+			var got [][]interface{}
+			for {
+				b, err := NextBatch(plan, BatchSize)
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				lens = append(lens, b.Len)
+				for j := 0; j < b.Len; j++ {
+					got = append(got, b.Row(j))
+				}
+			}
+			if diff := cmp.Diff(tt.want, lens); diff != "" {
+				t.Errorf("batch lengths mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("rows mismatch with Next (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLimit_NextBatch_NotEvaluateBeyondLimit(t *testing.T) {
+	rows := [][]interface{}{{int64(1)}, {int64(2)}, {int64(0)}}
+	// 6 / x fails at the third row, which is beyond the limit.
+	div := &expr.Arith{Op: "/", Left: &expr.Const{Value: int64(6), T: expr.Int}, Right: &expr.Column{Index: 0}}
+	plan := &Limit{
+		Input: &Project{Input: &Values{Rows: rows}, Exprs: []expr.Expr{div}},
+		Count: &expr.Const{Value: int64(2), T: expr.Int},
+	}
+	got, err := Run(plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([][]interface{}{{int64(6)}, {int64(3)}}, got); diff != "" {
+		t.Errorf("Run() mismatch (-want +got):\n%s", diff)
+	}
+
+	plan.Count = nil
+	if _, err := Run(plan); !errors.Is(err, expr.ErrDivisionByZero) {
+		t.Errorf("Run() error = %v, want %v", err, expr.ErrDivisionByZero)
+	}
+}
+
+// runRows returns all rows of the operator read by Next.
+func runRows(op Operator) ([][]interface{}, error) {
+	defer op.Close()
+	if err := op.Open(); err != nil {
+		return nil, err
+	}
+	var rows [][]interface{}
+	for {
+		row, err := op.Next()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+}
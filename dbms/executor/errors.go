@@ -0,0 +1,12 @@
+package executor
+
+import "errors"
+
+var (
+	// ErrSpill means that the rows can not be written to or read from the temporary file.
+	ErrSpill = errors.New("failed to spill rows to temporary file")
+	// ErrRecursionLimit means that the recursive query exceeds the maximum recursion depth.
+	ErrRecursionLimit = errors.New("recursive query exceeds the maximum recursion depth")
+	// ErrInvalidLimit means that the value of LIMIT or OFFSET clause is negative.
+	ErrInvalidLimit = errors.New("invalid LIMIT or OFFSET")
+)
@@ -0,0 +1,346 @@
+package executor
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nao1215/egsql/dbms/expr"
+)
+
+// Spill counts the rows that an operator writes to the temporary files and
+// reads back from them, for EXPLAIN ANALYZE. The tables are in memory, so the
+// rows read from them are only counted as the actual rows of the operators.
+type Spill struct {
+	Written int64
+	Read    int64
+}
+
+// Instrument measures the operator for EXPLAIN ANALYZE: the rows it returns,
+// the loops (the times it is opened), the time spent in it including its
+// inputs, and the rows spilled to the temporary files.
+type Instrument struct {
+	Op    Operator
+	Rows  int64
+	Loops int64
+	Time  time.Duration
+	Spill Spill
+}
+
+// Open opens the operator.
+func (in *Instrument) Open() error {
+	start := time.Now()
+	err := in.Op.Open()
+	in.Time += time.Since(start)
+	in.Loops++
+	return err
+}
+
+// Next returns the next row of the operator.
+func (in *Instrument) Next() ([]interface{}, error) {
+	start := time.Now()
+	row, err := in.Op.Next()
+	in.Time += time.Since(start)
+	if err == nil {
+		in.Rows++
+	}
+	return row, err
+}
+
+// Close closes the operator.
+func (in *Instrument) Close() error {
+	start := time.Now()
+	err := in.Op.Close()
+	in.Time += time.Since(start)
+	return err
+}
+
+// Analyze wraps each operator of the tree, including the plans of the
+// subqueries, with Instrument, and returns the root.
+func Analyze(op Operator) *Instrument {
+	if in, ok := op.(*Instrument); ok {
+		return in
+	}
+	in := &Instrument{Op: op}
+	for _, input := range inputs(op) {
+		*input = Analyze(*input)
+	}
+	for _, sub := range subqueries(op) {
+		sub.Plan = Analyze(sub.Plan)
+	}
+	if config := configOf(op); config != nil && *config != nil {
+		c := **config
+		c.spill = &in.Spill
+		*config = &c
+	}
+	return in
+}
+
+// Explain returns the lines that describe the operator tree, one operator per
+// line. The inputs follow the operator, indented and marked with "->". The
+// operators wrapped by Analyze are annotated with their measurements.
+func Explain(op Operator) []string {
+	var lines []string
+	explain(op, "", "", &lines)
+	return lines
+}
+
+// explain appends the lines of the operator and its inputs. prefix is the
+// indent of the line, and label is put before the operator name.
+func explain(op Operator, prefix, label string, lines *[]string) {
+	in, analyzed := op.(*Instrument)
+	if analyzed {
+		op = in.Op
+	}
+	line := prefix + label + describe(op)
+	if analyzed {
+		line += fmt.Sprintf(" (actual rows=%d loops=%d time=%.3fms", in.Rows, in.Loops, float64(in.Time.Microseconds())/1000)
+		if s := in.Spill; s != (Spill{}) {
+			line += fmt.Sprintf(" spilled rows: written=%d read=%d", s.Written, s.Read)
+		}
+		line += ")"
+	}
+	*lines = append(*lines, line)
+
+	indent := prefix + strings.Repeat(" ", len(label))
+	for _, input := range inputs(op) {
+		explain(*input, indent+"  ", "-> ", lines)
+	}
+	for _, sub := range subqueries(op) {
+		name := "SubPlan"
+		if sub.Correlated {
+			name = "Correlated SubPlan"
+		}
+		*lines = append(*lines, indent+"  "+name)
+		explain(sub.Plan, indent+"    ", "-> ", lines)
+	}
+}
+
+// describe returns the name of the operator and its arguments.
+func describe(op Operator) string {
+	switch o := op.(type) {
+	case *Values:
+		if o.Table != "" {
+			return fmt.Sprintf("Seq Scan on %s (rows=%d)", o.Table, len(o.Rows))
+		}
+		return fmt.Sprintf("Values (rows=%d)", len(o.Rows))
+	case *IndexScan:
+		return fmt.Sprintf("Index Scan on %s using %s (key: %s)", o.Table.Scheme().TableName, o.Index, exprList(o.Key))
+	case *WorkTableScan:
+		return "Work Table Scan"
+	case *Filter:
+		return "Filter (cond: " + o.Cond.String() + ")"
+	case *Project:
+		return "Project (" + exprList(o.Exprs) + ")"
+	case *Limit:
+		args := make([]string, 0, 2)
+		if o.Count != nil {
+			args = append(args, "count: "+o.Count.String())
+		}
+		if o.Offset != nil {
+			args = append(args, "offset: "+o.Offset.String())
+		}
+		if len(args) == 0 {
+			return "Limit"
+		}
+		return "Limit (" + strings.Join(args, ", ") + ")"
+	case *Sort:
+		return "Sort (keys: " + sortKeys(o.Keys) + ")"
+	case *NestedLoopJoin:
+		return fmt.Sprintf("Nested Loop %s Join", o.Type) + condition(o.Cond)
+	case *HashJoin:
+		return fmt.Sprintf("Hash %s Join (keys: %s)", o.Type, keyPairs(o.LeftKeys, o.RightKeys)) + condition(o.Cond)
+	case *IndexJoin:
+		return fmt.Sprintf("Index %s Join on %s using %s (key: %s)", o.Type, o.Table.Scheme().TableName, o.Index, exprList(o.Keys)) + condition(o.Cond)
+	case *SemiJoin:
+		name := "Hash Semi Join"
+		if o.Anti {
+			name = "Hash Anti Join"
+		}
+		return name + " (keys: " + keyPairs(o.LeftKeys, o.RightKeys) + ")"
+	case *HashAggregate:
+		return "Hash Aggregate" + aggregateArgs(o.Keys, o.Aggregates)
+	case *SortAggregate:
+		return "Sort Aggregate" + aggregateArgs(o.Keys, o.Aggregates)
+	case *Window:
+		funcs := make([]string, len(o.Funcs))
+		for i, f := range o.Funcs {
+			funcs[i] = f.String()
+		}
+		return "Window (" + strings.Join(funcs, ", ") + ")"
+	case *Union:
+		return "Union" + all(o.All)
+	case *HashSetOp:
+		return "Hash " + o.Op.String() + all(o.All)
+	case *SortSetOp:
+		return "Sort " + o.Op.String() + all(o.All)
+	case *RecursiveUnion:
+		return "Recursive Union" + all(o.All)
+	}
+	return fmt.Sprintf("%T", op)
+}
+
+// inputs returns the pointers to the input operators of the operator, so
+// that Analyze can replace them.
+func inputs(op Operator) []*Operator {
+	switch o := op.(type) {
+	case *Filter:
+		return []*Operator{&o.Input}
+	case *Project:
+		return []*Operator{&o.Input}
+	case *Limit:
+		return []*Operator{&o.Input}
+	case *Sort:
+		return []*Operator{&o.Input}
+	case *HashAggregate:
+		return []*Operator{&o.Input}
+	case *SortAggregate:
+		return []*Operator{&o.Input}
+	case *Window:
+		return []*Operator{&o.Input}
+	case *IndexJoin:
+		return []*Operator{&o.Left}
+	case *NestedLoopJoin:
+		return []*Operator{&o.Left, &o.Right}
+	case *HashJoin:
+		return []*Operator{&o.Left, &o.Right}
+	case *SemiJoin:
+		return []*Operator{&o.Left, &o.Right}
+	case *Union:
+		return []*Operator{&o.Left, &o.Right}
+	case *HashSetOp:
+		return []*Operator{&o.Left, &o.Right}
+	case *SortSetOp:
+		return []*Operator{&o.Left, &o.Right}
+	case *RecursiveUnion:
+		return []*Operator{&o.Anchor, &o.Recursive}
+	}
+	return nil
+}
+
+// subqueries returns the subqueries in the expressions of the operator.
+func subqueries(op Operator) []*Subquery {
+	var exprs []expr.Expr
+	switch o := op.(type) {
+	case *Filter:
+		exprs = []expr.Expr{o.Cond}
+	case *Project:
+		exprs = o.Exprs
+	case *NestedLoopJoin:
+		exprs = []expr.Expr{o.Cond}
+	case *HashJoin:
+		exprs = append(append([]expr.Expr{o.Cond}, o.LeftKeys...), o.RightKeys...)
+	case *IndexJoin:
+		exprs = append([]expr.Expr{o.Cond}, o.Keys...)
+	}
+	var subs []*Subquery
+	for _, e := range exprs {
+		expr.Walk(e, func(e expr.Expr) bool {
+			var q expr.Query
+			switch v := e.(type) {
+			case *expr.ScalarSubquery:
+				q = v.Query
+			case *expr.Exists:
+				q = v.Query
+			case *expr.InSubquery:
+				q = v.Query
+			}
+			if s, ok := q.(*Subquery); ok {
+				subs = append(subs, s)
+			}
+			return true
+		})
+	}
+	return subs
+}
+
+// configOf returns the pointer to the config of the operator that writes the
+// temporary files, or nil.
+func configOf(op Operator) **Config {
+	switch o := op.(type) {
+	case *Sort:
+		return &o.Config
+	case *HashAggregate:
+		return &o.Config
+	case *SortAggregate:
+		return &o.Config
+	case *Window:
+		return &o.Config
+	case *SortSetOp:
+		return &o.Config
+	}
+	return nil
+}
+
+// exprList returns the expressions separated by ",".
+func exprList(exprs []expr.Expr) string {
+	s := make([]string, len(exprs))
+	for i, e := range exprs {
+		s[i] = e.String()
+	}
+	return strings.Join(s, ", ")
+}
+
+// keyPairs returns the equality of the left keys and the right keys.
+func keyPairs(left, right []expr.Expr) string {
+	s := make([]string, len(left))
+	for i := range left {
+		s[i] = left[i].String() + " = " + right[i].String()
+	}
+	return strings.Join(s, ", ")
+}
+
+// condition returns the condition as the argument, or "" if it is nil.
+func condition(cond expr.Expr) string {
+	if cond == nil {
+		return ""
+	}
+	return " (cond: " + cond.String() + ")"
+}
+
+// sortKeys returns the sort keys. The columns are numbered from 1.
+func sortKeys(keys []SortKey) string {
+	s := make([]string, len(keys))
+	for i, k := range keys {
+		s[i] = fmt.Sprintf("#%d", k.Index+1)
+		if k.Desc {
+			s[i] += " DESC"
+		}
+		if k.NullsFirst != k.Desc {
+			// NULL comes last in ascending order and first in descending order by default.
+			if k.NullsFirst {
+				s[i] += " NULLS FIRST"
+			} else {
+				s[i] += " NULLS LAST"
+			}
+		}
+	}
+	return strings.Join(s, ", ")
+}
+
+// aggregateArgs returns the group keys and the aggregate functions as the arguments.
+func aggregateArgs(keys []expr.Expr, aggs []*expr.Aggregate) string {
+	args := make([]string, 0, 2)
+	if len(keys) > 0 {
+		args = append(args, "keys: "+exprList(keys))
+	}
+	if len(aggs) > 0 {
+		s := make([]string, len(aggs))
+		for i, a := range aggs {
+			s[i] = a.String()
+		}
+		args = append(args, "aggregates: "+strings.Join(s, ", "))
+	}
+	if len(args) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(args, ", ") + ")"
+}
+
+// all returns " All" for the set operation of ALL.
+func all(b bool) string {
+	if b {
+		return " All"
+	}
+	return ""
+}
@@ -0,0 +1,57 @@
+package executor
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestExplain(t *testing.T) {
+	plan := &Limit{
+		Input: &Sort{
+			Input: &Union{Left: &Values{Rows: [][]interface{}{{int64(1)}}, Table: "a"}, Right: &Values{}},
+			Keys:  []SortKey{{Index: 0, Desc: true, NullsFirst: false}},
+		},
+	}
+	want := []string{
+		"Limit",
+		"  -> Sort (keys: #1 DESC NULLS LAST)",
+		"       -> Union",
+		"            -> Seq Scan on a (rows=1)",
+		"            -> Values (rows=0)",
+	}
+	if diff := cmp.Diff(want, Explain(plan)); diff != "" {
+		t.Errorf("Explain() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	rows := make([][]interface{}, 100)
+	for i := range rows {
+		rows[i] = []interface{}{int64(len(rows) - i)}
+	}
+	// The small budget makes the sort write the rows to the temporary files.
+	config := &Config{TempDir: t.TempDir(), WorkMem: 64}
+	root := Analyze(&Sort{Input: &Values{Rows: rows}, Keys: []SortKey{{Index: 0}}, Config: config})
+	got, err := Run(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(rows) {
+		t.Fatalf("Run() returns %d rows, want %d", len(got), len(rows))
+	}
+
+	if root.Rows != 100 || root.Loops != 1 {
+		t.Errorf("sort: rows = %d, loops = %d, want 100, 1", root.Rows, root.Loops)
+	}
+	if diff := cmp.Diff(Spill{Written: 100, Read: 100}, root.Spill); diff != "" {
+		t.Errorf("sort spill mismatch (-want +got):\n%s", diff)
+	}
+	scan := root.Op.(*Sort).Input.(*Instrument)
+	if diff := cmp.Diff(Spill{}, scan.Spill); diff != "" {
+		t.Errorf("scan spill mismatch (-want +got):\n%s", diff)
+	}
+	if config.spill != nil {
+		t.Errorf("Analyze() modifies the shared config")
+	}
+}
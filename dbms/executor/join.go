@@ -0,0 +1,368 @@
+package executor
+
+import (
+	"io"
+
+	"github.com/nao1215/egsql/dbms/expr"
+	"github.com/nao1215/egsql/dbms/storage"
+)
+
+// JoinType is the type of the join. It is Enum.
+type JoinType uint8
+
+const (
+	// InnerJoin returns the pairs of the left and right rows that match.
+	InnerJoin JoinType = iota
+	// LeftJoin returns InnerJoin rows and the left rows that match no right row,
+	// extended with NULLs.
+	LeftJoin
+	// RightJoin returns InnerJoin rows and the right rows that match no left row,
+	// extended with NULLs.
+	RightJoin
+	// FullJoin returns LeftJoin rows and the right rows that match no left row.
+	FullJoin
+)
+
+// String is stringer for JoinType.
+func (t JoinType) String() string {
+	switch t {
+	case LeftJoin:
+		return "Left"
+	case RightJoin:
+		return "Right"
+	case FullJoin:
+		return "Full"
+	default:
+		return "Inner"
+	}
+}
+
+// keepsLeft reports whether the left rows that match nothing are returned.
+func (t JoinType) keepsLeft() bool {
+	return t == LeftJoin || t == FullJoin
+}
+
+// keepsRight reports whether the right rows that match nothing are returned.
+func (t JoinType) keepsRight() bool {
+	return t == RightJoin || t == FullJoin
+}
+
+// joinRow returns the left row followed by the right row. The nil row is
+// replaced with NULLs of the width.
+func joinRow(left []interface{}, leftWidth int, right []interface{}, rightWidth int) []interface{} {
+	row := make([]interface{}, leftWidth+rightWidth)
+	copy(row, left)
+	copy(row[leftWidth:], right)
+	return row
+}
+
+// matches reports whether the joined row satisfies the condition. nil condition is TRUE.
+func matches(env *expr.Env, cond expr.Expr, row []interface{}) (bool, error) {
+	if cond == nil {
+		return true, nil
+	}
+	v, err := cond.Eval(env, row)
+	return v == true, err
+}
+
+// joinState is the state shared by the join operators: the current left row
+// and the right rows that matched any left row (for RightJoin and FullJoin).
+type joinState struct {
+	leftWidth   int
+	rightWidth  int
+	left        []interface{}
+	leftMatched bool
+	// rightMatched is indexed by the position of the right row.
+	rightMatched []bool
+	// unmatched is the position of the next right row to check after the left rows end.
+	unmatched int
+	leftDone  bool
+}
+
+// nextUnmatchedRight returns the next right row that matched no left row,
+// extended with NULLs on the left.
+func (s *joinState) nextUnmatchedRight(rights [][]interface{}) ([]interface{}, error) {
+	for s.unmatched < len(rights) {
+		i := s.unmatched
+		s.unmatched++
+		if !s.rightMatched[i] {
+			return joinRow(nil, s.leftWidth, rights[i], s.rightWidth), nil
+		}
+	}
+	return nil, io.EOF
+}
+
+// NestedLoopJoin joins each left row with every right row, and returns the
+// joined rows that satisfy Cond. The right rows are read into memory at Open.
+// It can join by any condition.
+type NestedLoopJoin struct {
+	Left  Operator
+	Right Operator
+	// LeftWidth and RightWidth is the number of the columns of the inputs.
+	LeftWidth  int
+	RightWidth int
+	// Cond is the join condition evaluated for the joined row. nil is TRUE (CROSS JOIN).
+	Cond expr.Expr
+	Type JoinType
+	Env  *expr.Env
+
+	rights [][]interface{}
+	pos    int
+	state  joinState
+}
+
+// Open reads the right rows and opens the left input.
+func (j *NestedLoopJoin) Open() error {
+	rights, err := Run(j.Right)
+	if err != nil {
+		return err
+	}
+	j.rights, j.pos = rights, len(rights)
+	j.state = joinState{leftWidth: j.LeftWidth, rightWidth: j.RightWidth, rightMatched: make([]bool, len(rights))}
+	return j.Left.Open()
+}
+
+// Next returns the next joined row.
+func (j *NestedLoopJoin) Next() ([]interface{}, error) {
+	s := &j.state
+	for !s.leftDone {
+		if j.pos >= len(j.rights) {
+			if s.left != nil && !s.leftMatched && j.Type.keepsLeft() {
+				left := s.left
+				s.left = nil
+				return joinRow(left, s.leftWidth, nil, s.rightWidth), nil
+			}
+			left, err := j.Left.Next()
+			if err == io.EOF {
+				s.leftDone = true
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			s.left, s.leftMatched, j.pos = left, false, 0
+			continue
+		}
+		i := j.pos
+		j.pos++
+		row := joinRow(s.left, s.leftWidth, j.rights[i], s.rightWidth)
+		ok, err := matches(j.Env, j.Cond, row)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			s.leftMatched = true
+			s.rightMatched[i] = true
+			return row, nil
+		}
+	}
+	if j.Type.keepsRight() {
+		return s.nextUnmatchedRight(j.rights)
+	}
+	return nil, io.EOF
+}
+
+// Close closes the inputs.
+func (j *NestedLoopJoin) Close() error {
+	j.rights = nil
+	err := j.Left.Close()
+	if rErr := j.Right.Close(); err == nil {
+		err = rErr
+	}
+	return err
+}
+
+// HashJoin joins the rows whose LeftKeys and RightKeys are equal, using the
+// hash table of the right rows built at Open. The rows whose keys include
+// NULL match nothing. Cond is the rest of the join condition evaluated for
+// the joined row, or nil.
+type HashJoin struct {
+	Left       Operator
+	Right      Operator
+	LeftWidth  int
+	RightWidth int
+	// LeftKeys is evaluated for the left row, and RightKeys is evaluated for the
+	// joined row whose left part is NULLs, so that both are bound to the joined row.
+	LeftKeys  []expr.Expr
+	RightKeys []expr.Expr
+	Cond      expr.Expr
+	Type      JoinType
+	Env       *expr.Env
+
+	rights [][]interface{}
+	table  map[string][]int
+	// candidates is the positions of the right rows of the key of the current left row.
+	candidates []int
+	state      joinState
+}
+
+// Open builds the hash table of the right rows and opens the left input.
+func (j *HashJoin) Open() error {
+	rights, err := Run(j.Right)
+	if err != nil {
+		return err
+	}
+	j.rights, j.candidates = rights, nil
+	j.table = make(map[string][]int)
+	buf := make([]interface{}, j.LeftWidth+j.RightWidth)
+	for i, r := range rights {
+		copy(buf[j.LeftWidth:], r)
+		key, ok, err := hashKey(j.Env, j.RightKeys, buf)
+		if err != nil {
+			return err
+		}
+		if ok {
+			j.table[key] = append(j.table[key], i)
+		}
+	}
+	j.state = joinState{leftWidth: j.LeftWidth, rightWidth: j.RightWidth, rightMatched: make([]bool, len(rights))}
+	return j.Left.Open()
+}
+
+// hashKey returns the key of the values of the expressions. It returns false
+// if any value is NULL.
+func hashKey(env *expr.Env, exprs []expr.Expr, row []interface{}) (string, bool, error) {
+	values, err := evalAll(env, exprs, row)
+	if err != nil {
+		return "", false, err
+	}
+	for _, v := range values {
+		if v == nil {
+			return "", false, nil
+		}
+	}
+	return expr.Key(values), true, nil
+}
+
+// Next returns the next joined row.
+func (j *HashJoin) Next() ([]interface{}, error) {
+	s := &j.state
+	for !s.leftDone {
+		if len(j.candidates) == 0 {
+			if s.left != nil && !s.leftMatched && j.Type.keepsLeft() {
+				left := s.left
+				s.left = nil
+				return joinRow(left, s.leftWidth, nil, s.rightWidth), nil
+			}
+			left, err := j.Left.Next()
+			if err == io.EOF {
+				s.leftDone = true
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			s.left, s.leftMatched = left, false
+			key, ok, err := hashKey(j.Env, j.LeftKeys, left)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				j.candidates = j.table[key]
+			}
+			continue
+		}
+		i := j.candidates[0]
+		j.candidates = j.candidates[1:]
+		row := joinRow(s.left, s.leftWidth, j.rights[i], s.rightWidth)
+		ok, err := matches(j.Env, j.Cond, row)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			s.leftMatched = true
+			s.rightMatched[i] = true
+			return row, nil
+		}
+	}
+	if j.Type.keepsRight() {
+		return s.nextUnmatchedRight(j.rights)
+	}
+	return nil, io.EOF
+}
+
+// Close closes the inputs.
+func (j *HashJoin) Close() error {
+	j.rights, j.table = nil, nil
+	err := j.Left.Close()
+	if rErr := j.Right.Close(); err == nil {
+		err = rErr
+	}
+	return err
+}
+
+// IndexJoin joins each left row with the rows of Table found by the index,
+// whose columns equal the values of Keys. It is the index nested loop join:
+// the right rows are not read except for the ones that match, so it is used
+// when the right input is a table with the index on the join columns.
+// Type must be InnerJoin or LeftJoin.
+type IndexJoin struct {
+	Left      Operator
+	LeftWidth int
+	Table     *storage.Table
+	Index     string
+	// Keys is evaluated for the left row, in the order of the index columns.
+	Keys []expr.Expr
+	// Cond is the rest of the join condition evaluated for the joined row, or nil.
+	Cond expr.Expr
+	Type JoinType
+	Env  *expr.Env
+
+	left        []interface{}
+	leftMatched bool
+	ids         []int64
+}
+
+// Open opens the left input.
+func (j *IndexJoin) Open() error {
+	j.left, j.ids = nil, nil
+	return j.Left.Open()
+}
+
+// Next returns the next joined row.
+func (j *IndexJoin) Next() ([]interface{}, error) {
+	width := len(j.Table.Scheme().ColumnNames)
+	for {
+		if len(j.ids) == 0 {
+			if j.left != nil && !j.leftMatched && j.Type == LeftJoin {
+				left := j.left
+				j.left = nil
+				return joinRow(left, j.LeftWidth, nil, width), nil
+			}
+			left, err := j.Left.Next()
+			if err != nil {
+				return nil, err
+			}
+			j.left, j.leftMatched = left, false
+			key, err := evalAll(j.Env, j.Keys, left)
+			if err != nil {
+				return nil, err
+			}
+			if j.ids, err = j.Table.Lookup(j.Index, key); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		id := j.ids[0]
+		j.ids = j.ids[1:]
+		right, ok := j.Table.Get(id)
+		if !ok {
+			continue
+		}
+		row := joinRow(j.left, j.LeftWidth, right, width)
+		ok, err := matches(j.Env, j.Cond, row)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			j.leftMatched = true
+			return row, nil
+		}
+	}
+}
+
+// Close closes the left input.
+func (j *IndexJoin) Close() error {
+	j.left, j.ids = nil, nil
+	return j.Left.Close()
+}
@@ -0,0 +1,200 @@
+package executor
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/nao1215/egsql/dbms/expr"
+	"github.com/nao1215/egsql/dbms/meta"
+	"github.com/nao1215/egsql/dbms/storage"
+)
+
+func TestJoin(t *testing.T) {
+	// left is (id, name) and right is (user_id, amount). The joined row is
+	// (id, name, user_id, amount), so the keys are the columns at 0 and 2.
+	left := [][]interface{}{{int64(1), "alice"}, {int64(2), "bob"}, {nil, "nobody"}}
+	right := [][]interface{}{{int64(1), int64(100)}, {int64(1), int64(50)}, {int64(3), int64(70)}, {nil, int64(5)}}
+	leftKey := &expr.Column{Index: 0, Name: "id", T: expr.Int}
+	rightKey := &expr.Column{Index: 2, Name: "user_id", T: expr.Int}
+	cond := &expr.Comparison{Op: "=", Left: leftKey, Right: rightKey}
+
+	inner := [][]interface{}{
+		{int64(1), "alice", int64(1), int64(100)},
+		{int64(1), "alice", int64(1), int64(50)},
+	}
+	leftOnly := [][]interface{}{{int64(2), "bob", nil, nil}, {nil, "nobody", nil, nil}}
+	rightOnly := [][]interface{}{{nil, nil, int64(3), int64(70)}, {nil, nil, nil, int64(5)}}
+	tests := []struct {
+		name string
+		typ  JoinType
+		want [][]interface{}
+	}{
+		{name: "[Success] inner join", typ: InnerJoin, want: inner},
+		{name: "[Success] left join", typ: LeftJoin, want: append(append([][]interface{}{}, inner...), leftOnly...)},
+		{name: "[Success] right join", typ: RightJoin, want: append(append([][]interface{}{}, inner...), rightOnly...)},
+		{name: "[Success] full join", typ: FullJoin, want: append(append(append([][]interface{}{}, inner...), leftOnly...), rightOnly...)},
+	}
+	sortRows := cmpopts.SortSlices(func(a, b []interface{}) bool { return fmt.Sprint(a) < fmt.Sprint(b) })
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, op := range []Operator{
+				&NestedLoopJoin{
+					Left: &Values{Rows: left}, Right: &Values{Rows: right}, LeftWidth: 2, RightWidth: 2,
+					Cond: cond, Type: tt.typ,
+				},
+				&HashJoin{
+					Left: &Values{Rows: left}, Right: &Values{Rows: right}, LeftWidth: 2, RightWidth: 2,
+					LeftKeys: []expr.Expr{leftKey}, RightKeys: []expr.Expr{rightKey}, Type: tt.typ,
+				},
+			} {
+				got, err := Run(op)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if diff := cmp.Diff(tt.want, got, sortRows); diff != "" {
+					t.Errorf("Run(%T) mismatch (-want +got):\n%s", op, diff)
+				}
+			}
+		})
+	}
+}
+
+func TestIndexJoin(t *testing.T) {
+	scheme := &meta.Scheme{
+		TableName:       "users",
+		ColumnNames:     []string{"id", "name"},
+		ColumnDataTypes: []meta.DataType{meta.Int, meta.Varchar},
+		PrimaryKey:      meta.KeyColumns{"id"},
+		Indexes:         []meta.Index{{Name: "users_pkey", Columns: []string{"id"}, Unique: true, Primary: true}},
+	}
+	table := storage.NewTable(scheme)
+	for _, row := range []storage.Row{{int64(1), "alice"}, {int64(2), "bob"}} {
+		if _, err := table.Insert(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The left row is (user_id, amount), and the joined row is (user_id, amount, id, name).
+	left := [][]interface{}{{int64(1), int64(100)}, {int64(3), int64(70)}, {int64(2), int64(5)}, {nil, int64(1)}}
+	key := &expr.Column{Index: 0, Name: "user_id", T: expr.Int}
+	cond := &expr.Comparison{Op: ">", Left: &expr.Column{Index: 1, Name: "amount", T: expr.Int}, Right: &expr.Const{Value: int64(10), T: expr.Int}}
+
+	tests := []struct {
+		name string
+		typ  JoinType
+		want [][]interface{}
+	}{
+		{
+			name: "[Success] inner join",
+			typ:  InnerJoin,
+			want: [][]interface{}{{int64(1), int64(100), int64(1), "alice"}},
+		},
+		{
+			name: "[Success] left join",
+			typ:  LeftJoin,
+			want: [][]interface{}{
+				{int64(1), int64(100), int64(1), "alice"},
+				{int64(3), int64(70), nil, nil},
+				{int64(2), int64(5), nil, nil},
+				{nil, int64(1), nil, nil},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op := &IndexJoin{
+				Left: &Values{Rows: left}, LeftWidth: 2, Table: table, Index: "users_pkey",
+				Keys: []expr.Expr{key}, Cond: cond, Type: tt.typ,
+			}
+			got, err := Run(op)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Run() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSemiJoin(t *testing.T) {
+	left := [][]interface{}{{int64(1), "alice"}, {int64(2), "bob"}, {nil, "nobody"}}
+	right := [][]interface{}{{int64(1)}, {int64(1)}, {int64(3)}, {nil}}
+	tests := []struct {
+		name string
+		anti bool
+		want [][]interface{}
+	}{
+		{name: "[Success] semi join returns each matching row once", want: [][]interface{}{{int64(1), "alice"}}},
+		{name: "[Success] anti join returns rows of null key", anti: true, want: [][]interface{}{{int64(2), "bob"}, {nil, "nobody"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Run(&SemiJoin{
+				Left: &Values{Rows: left}, Right: &Values{Rows: right},
+				LeftKeys:  []expr.Expr{&expr.Column{Index: 0, Name: "id", T: expr.Int}},
+				RightKeys: []expr.Expr{&expr.Column{Index: 0, Name: "user_id", T: expr.Int}},
+				Anti:      tt.anti,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Run() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestIndexScan(t *testing.T) {
+	scheme := &meta.Scheme{
+		TableName:       "users",
+		ColumnNames:     []string{"id", "group_id"},
+		ColumnDataTypes: []meta.DataType{meta.Int, meta.Int},
+		PrimaryKey:      meta.KeyColumns{"id"},
+		Indexes:         []meta.Index{{Name: "users_group_id_idx", Columns: []string{"group_id"}}},
+	}
+	table := storage.NewTable(scheme)
+	for _, row := range []storage.Row{{int64(1), int64(10)}, {int64(2), int64(20)}, {int64(3), int64(10)}} {
+		if _, err := table.Insert(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		key  expr.Expr
+		want [][]interface{}
+	}{
+		{
+			name: "[Success] rows of the key",
+			key:  &expr.Const{Value: int64(10), T: expr.Int},
+			want: [][]interface{}{{int64(1), int64(10)}, {int64(3), int64(10)}},
+		},
+		{
+			name: "[Success] parameter key",
+			key:  &expr.Param{Index: 0},
+			want: [][]interface{}{{int64(2), int64(20)}},
+		},
+		{
+			name: "[Success] null matches nothing",
+			key:  &expr.Const{T: expr.Int},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op := &IndexScan{
+				Table: table, Index: "users_group_id_idx", Key: []expr.Expr{tt.key},
+				Env: &expr.Env{Args: []interface{}{int64(20)}},
+			}
+			got, err := Run(op)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+// Package executor is the physical operators that execute the query plan.
+//
+// An operator is an iterator of rows: Open prepares it, each Next returns
+// the next row until io.EOF, and Close releases its resources. The operators
+// are composed into a tree whose leaves read the tables, and the root returns
+// the result rows of the query. The operators that implement BatchOperator
+// also return the rows a batch of column vectors at a time, which the root
+// reads through NextBatch to reduce the per-row overhead.
+//
+// The blocking operators like the aggregation keep at most Config.WorkMem
+// bytes of rows in memory, and write the rest to the temporary files in
+// Config.TempDir, so that they work on inputs larger than memory.
+package executor
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/nao1215/egsql/dbms/expr"
+	"github.com/nao1215/egsql/misc/errfmt"
+)
+
+// Operator is a physical operator that returns rows.
+type Operator interface {
+	// Open prepares the operator to return the rows.
+	Open() error
+	// Next returns the next row. It returns io.EOF if there is no more row.
+	// The returned row must not be modified by the caller.
+	Next() ([]interface{}, error)
+	// Close releases the resources of the operator and its inputs.
+	// It can be called more than once, even if Open failed.
+	Close() error
+}
+
+// Values returns the rows in memory. It is the leaf of the plan.
+type Values struct {
+	Rows [][]interface{}
+	// Table is the name of the table whose rows are Rows, or empty. It is
+	// shown by EXPLAIN.
+	Table string
+	pos   int
+}
+
+// Open rewinds the rows.
+func (v *Values) Open() error {
+	v.pos = 0
+	return nil
+}
+
+// Next returns the next row.
+func (v *Values) Next() ([]interface{}, error) {
+	if v.pos >= len(v.Rows) {
+		return nil, io.EOF
+	}
+	v.pos++
+	return v.Rows[v.pos-1], nil
+}
+
+// Close does nothing.
+func (v *Values) Close() error {
+	return nil
+}
+
+// Filter returns the input rows for which Cond is TRUE.
+type Filter struct {
+	Input Operator
+	Cond  expr.Expr
+	Env   *expr.Env
+}
+
+// Open opens the input.
+func (f *Filter) Open() error {
+	return f.Input.Open()
+}
+
+// Next returns the next row that satisfies the condition.
+func (f *Filter) Next() ([]interface{}, error) {
+	for {
+		row, err := f.Input.Next()
+		if err != nil {
+			return nil, err
+		}
+		ok, err := f.Cond.Eval(f.Env, row)
+		if err != nil {
+			return nil, err
+		}
+		if ok == true {
+			return row, nil
+		}
+	}
+}
+
+// Close closes the input.
+func (f *Filter) Close() error {
+	return f.Input.Close()
+}
+
+// Project returns the values of Exprs for each input row.
+type Project struct {
+	Input Operator
+	Exprs []expr.Expr
+	Env   *expr.Env
+}
+
+// Open opens the input.
+func (p *Project) Open() error {
+	return p.Input.Open()
+}
+
+// Next returns the values of the expressions for the next row.
+func (p *Project) Next() ([]interface{}, error) {
+	row, err := p.Input.Next()
+	if err != nil {
+		return nil, err
+	}
+	return evalAll(p.Env, p.Exprs, row)
+}
+
+// Close closes the input.
+func (p *Project) Close() error {
+	return p.Input.Close()
+}
+
+// Limit skips Offset rows of the input and returns at most Count rows.
+// Count and Offset are evaluated when it is opened. If Count is nil or NULL,
+// the number of rows is not limited.
+type Limit struct {
+	Input  Operator
+	Count  expr.Expr
+	Offset expr.Expr
+	Env    *expr.Env
+
+	// remaining is the number of rows to return, or -1 if not limited.
+	remaining int64
+	skip      int64
+}
+
+// Open evaluates the count and the offset, and opens the input.
+func (l *Limit) Open() error {
+	var err error
+	if l.remaining, err = evalCount(l.Env, l.Count, "LIMIT", -1); err != nil {
+		return err
+	}
+	if l.skip, err = evalCount(l.Env, l.Offset, "OFFSET", 0); err != nil {
+		return err
+	}
+	return l.Input.Open()
+}
+
+// Next returns the next row within the limit.
+func (l *Limit) Next() ([]interface{}, error) {
+	for ; l.skip > 0; l.skip-- {
+		if _, err := l.Input.Next(); err != nil {
+			return nil, err
+		}
+	}
+	if l.remaining == 0 {
+		return nil, io.EOF
+	}
+	row, err := l.Input.Next()
+	if err != nil {
+		return nil, err
+	}
+	if l.remaining > 0 {
+		l.remaining--
+	}
+	return row, nil
+}
+
+// Close closes the input.
+func (l *Limit) Close() error {
+	return l.Input.Close()
+}
+
+// evalCount returns the number of rows of LIMIT or OFFSET clause, or
+// defaultValue if the expression is nil or NULL.
+func evalCount(env *expr.Env, e expr.Expr, clause string, defaultValue int64) (int64, error) {
+	if e == nil {
+		return defaultValue, nil
+	}
+	v, err := e.Eval(env, nil)
+	if err != nil || v == nil {
+		return defaultValue, err
+	}
+	n, ok := v.(int64)
+	if !ok || n < 0 {
+		return 0, errfmt.Wrap(ErrInvalidLimit, fmt.Sprintf("%s must be a non-negative integer: %v", clause, v))
+	}
+	return n, nil
+}
+
+// evalAll returns the values of the expressions for the row.
+func evalAll(env *expr.Env, exprs []expr.Expr, row []interface{}) ([]interface{}, error) {
+	values := make([]interface{}, len(exprs))
+	for i, e := range exprs {
+		v, err := e.Eval(env, row)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// Run opens the operator, returns all its rows and closes it.
+func Run(op Operator) ([][]interface{}, error) {
+	return runLimit(op, -1)
+}
+
+// runLimit is Run that returns at most limit rows. If limit is negative,
+// all rows are returned. The rows are read a batch at a time.
+func runLimit(op Operator, limit int) ([][]interface{}, error) {
+	defer op.Close()
+
+	if err := op.Open(); err != nil {
+		return nil, err
+	}
+	var rows [][]interface{}
+	for limit < 0 || len(rows) < limit {
+		max := BatchSize
+		if limit >= 0 && limit-len(rows) < max {
+			max = limit - len(rows)
+		}
+		batch, err := NextBatch(op, max)
+		if err == io.EOF {
+			return rows, op.Close()
+		}
+		if err != nil {
+			return nil, err
+		}
+		for j := 0; j < batch.Len; j++ {
+			rows = append(rows, batch.Row(j))
+		}
+	}
+	return rows, op.Close()
+}
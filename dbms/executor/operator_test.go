@@ -0,0 +1,65 @@
+package executor
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nao1215/egsql/dbms/expr"
+)
+
+func TestLimit(t *testing.T) {
+	rows := [][]interface{}{{int64(1)}, {int64(2)}, {int64(3)}}
+	count := func(v interface{}) expr.Expr { return &expr.Const{Value: v, T: expr.Int} }
+	tests := []struct {
+		name    string
+		count   expr.Expr
+		offset  expr.Expr
+		args    []interface{}
+		want    [][]interface{}
+		wantErr error
+	}{
+		{
+			name:  "[Success] limit",
+			count: count(int64(2)),
+			want:  [][]interface{}{{int64(1)}, {int64(2)}},
+		},
+		{
+			name:   "[Success] offset",
+			offset: count(int64(1)),
+			want:   [][]interface{}{{int64(2)}, {int64(3)}},
+		},
+		{
+			name:   "[Success] limit and offset by parameters",
+			count:  &expr.Param{Index: 0},
+			offset: &expr.Param{Index: 1},
+			args:   []interface{}{int64(1), int64(2)},
+			want:   [][]interface{}{{int64(3)}},
+		},
+		{
+			name:   "[Success] null limit and offset beyond the rows",
+			count:  count(nil),
+			offset: count(int64(5)),
+		},
+		{
+			name:  "[Success] zero limit",
+			count: count(int64(0)),
+		},
+		{
+			name:    "[Error] negative limit",
+			count:   count(int64(-1)),
+			wantErr: ErrInvalidLimit,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Run(&Limit{Input: &Values{Rows: rows}, Count: tt.count, Offset: tt.offset, Env: &expr.Env{Args: tt.args}})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Run() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package executor
+
+import (
+	"io"
+
+	"github.com/nao1215/egsql/dbms/expr"
+	"github.com/nao1215/egsql/dbms/storage"
+)
+
+// IndexScan returns the rows of the table whose indexed columns equal to Key,
+// looking them up by the index. It is the leaf of the plan used instead of
+// reading all rows when the index narrows them down.
+type IndexScan struct {
+	Table *storage.Table
+	Index string
+	// Key is evaluated when it is opened, in the order of the index columns.
+	// It must not reference any column.
+	Key []expr.Expr
+	Env *expr.Env
+
+	ids []int64
+}
+
+// Open looks up the row ids of the key.
+func (s *IndexScan) Open() error {
+	key, err := evalAll(s.Env, s.Key, nil)
+	if err != nil {
+		return err
+	}
+	s.ids, err = s.Table.Lookup(s.Index, key)
+	return err
+}
+
+// Next returns the next row of the key.
+func (s *IndexScan) Next() ([]interface{}, error) {
+	for len(s.ids) > 0 {
+		id := s.ids[0]
+		s.ids = s.ids[1:]
+		if row, ok := s.Table.Get(id); ok {
+			return row, nil
+		}
+	}
+	return nil, io.EOF
+}
+
+// Close releases the row ids.
+func (s *IndexScan) Close() error {
+	s.ids = nil
+	return nil
+}
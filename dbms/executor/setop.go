@@ -0,0 +1,436 @@
+package executor
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/nao1215/egsql/dbms/expr"
+	"github.com/nao1215/egsql/misc/errfmt"
+)
+
+// Union returns the left rows followed by the right rows. The duplicate
+// rows are removed unless All is true; the first one of them is returned.
+type Union struct {
+	Left  Operator
+	Right Operator
+	All   bool
+
+	current Operator
+	seen    map[string]bool
+}
+
+// Open opens the inputs.
+func (u *Union) Open() error {
+	u.current, u.seen = u.Left, make(map[string]bool)
+	if err := u.Left.Open(); err != nil {
+		return err
+	}
+	return u.Right.Open()
+}
+
+// Next returns the next row that is not returned yet.
+func (u *Union) Next() ([]interface{}, error) {
+	for {
+		row, err := u.current.Next()
+		if err == io.EOF && u.current == u.Left {
+			u.current = u.Right
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !u.All {
+			key := expr.Key(row)
+			if u.seen[key] {
+				continue
+			}
+			u.seen[key] = true
+		}
+		return row, nil
+	}
+}
+
+// Close closes the inputs.
+func (u *Union) Close() error {
+	u.seen = nil
+	err := u.Left.Close()
+	if rerr := u.Right.Close(); err == nil {
+		err = rerr
+	}
+	return err
+}
+
+// SetOpType is the type of the set operation of HashSetOp and SortSetOp.
+type SetOpType int
+
+const (
+	// SetUnion returns the rows of either input.
+	SetUnion SetOpType = iota
+	// SetIntersect returns the left rows that are also in the right input.
+	SetIntersect
+	// SetExcept returns the left rows that are not in the right input.
+	SetExcept
+)
+
+// String returns the name of the set operation.
+func (t SetOpType) String() string {
+	switch t {
+	case SetIntersect:
+		return "Intersect"
+	case SetExcept:
+		return "Except"
+	default:
+		return "Union"
+	}
+}
+
+// count returns the number of the result rows of the row that the left
+// input has l times and the right input has r times.
+func (t SetOpType) count(all bool, l, r int) int {
+	n := 0
+	switch t {
+	case SetUnion:
+		n = l + r
+	case SetIntersect:
+		n = l
+		if r < l {
+			n = r
+		}
+	case SetExcept:
+		n = l - r
+		if !all && r > 0 {
+			n = 0
+		}
+	}
+	switch {
+	case n < 0:
+		return 0
+	case n > 1 && !all:
+		return 1
+	}
+	return n
+}
+
+// HashSetOp is INTERSECT or EXCEPT by the hash table of the right rows.
+// It returns the left rows in order, and the duplicate rows are removed
+// unless All is true; the first one of them is returned. The hash table is
+// kept in memory.
+type HashSetOp struct {
+	Left  Operator
+	Right Operator
+	// Op is SetIntersect or SetExcept.
+	Op  SetOpType
+	All bool
+
+	// counts is the number of the right rows of the key that are not matched
+	// yet. It is negative if the left row of the key is returned by EXCEPT.
+	counts map[string]int
+}
+
+// Open reads the right rows and opens the left input.
+func (h *HashSetOp) Open() error {
+	h.counts = make(map[string]int)
+	if err := h.Right.Open(); err != nil {
+		return err
+	}
+	for {
+		row, err := h.Right.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		h.counts[expr.Key(row)]++
+	}
+	return h.Left.Open()
+}
+
+// Next returns the next left row in the result.
+func (h *HashSetOp) Next() ([]interface{}, error) {
+	for {
+		row, err := h.Left.Next()
+		if err != nil {
+			return nil, err
+		}
+		key := expr.Key(row)
+		n := h.counts[key]
+		switch {
+		case h.Op == SetIntersect && n > 0:
+			if h.All {
+				h.counts[key]--
+			} else {
+				h.counts[key] = 0
+			}
+			return row, nil
+		case h.Op == SetExcept && h.All && n > 0:
+			h.counts[key]--
+		case h.Op == SetExcept && n == 0:
+			if !h.All {
+				h.counts[key] = -1
+			}
+			return row, nil
+		}
+	}
+}
+
+// Close closes the inputs.
+func (h *HashSetOp) Close() error {
+	h.counts = nil
+	err := h.Left.Close()
+	if rerr := h.Right.Close(); err == nil {
+		err = rerr
+	}
+	return err
+}
+
+// SortSetOp is the set operation by sorting both inputs by all columns and
+// merging them. The rows are returned in the sorted order, and the duplicate
+// rows are removed unless All is true. The sort writes the sorted runs to
+// temporary files when the rows exceed the budget.
+type SortSetOp struct {
+	Left  Operator
+	Right Operator
+	Op    SetOpType
+	All   bool
+	// Width is the number of the columns of the rows.
+	Width  int
+	Config *Config
+
+	keys        []SortKey
+	sorters     []*sorter
+	left, right sortedInput
+	// row is returned pending more times.
+	row     []interface{}
+	pending int
+}
+
+// sortedInput is the sorted rows of an input of SortSetOp.
+type sortedInput struct {
+	src  rowSource
+	head []interface{}
+	done bool
+}
+
+// open sorts the rows of the operator and reads the first row.
+func (in *sortedInput) open(op Operator, s *SortSetOp) error {
+	*in = sortedInput{}
+	if err := op.Open(); err != nil {
+		return err
+	}
+	sorter, src, err := sortAll(op, s.keys, s.Config)
+	s.sorters = append(s.sorters, sorter)
+	if err != nil {
+		return err
+	}
+	in.src = src
+	return in.advance()
+}
+
+// advance reads the next row.
+func (in *sortedInput) advance() error {
+	row, err := in.src.next()
+	if err == io.EOF {
+		in.done, in.head = true, nil
+		return nil
+	}
+	in.head = row
+	return err
+}
+
+// count reads the rows equal to the row and returns the number of them.
+func (in *sortedInput) count(keys []SortKey, row []interface{}) (int, error) {
+	n := 0
+	for !in.done {
+		c, err := compareRows(keys, in.head, row)
+		if err != nil {
+			return 0, err
+		}
+		if c != 0 {
+			break
+		}
+		n++
+		if err := in.advance(); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+// Open sorts the inputs.
+func (s *SortSetOp) Open() error {
+	s.keys, s.row, s.pending = make([]SortKey, s.Width), nil, 0
+	for i := range s.keys {
+		s.keys[i] = SortKey{Index: i}
+	}
+	if err := s.left.open(s.Left, s); err != nil {
+		return err
+	}
+	return s.right.open(s.Right, s)
+}
+
+// Next returns the next row in the result.
+func (s *SortSetOp) Next() ([]interface{}, error) {
+	for s.pending == 0 {
+		if s.left.done && s.right.done {
+			return nil, io.EOF
+		}
+		// The smaller first row of the inputs is the next row.
+		row := s.left.head
+		if s.left.done {
+			row = s.right.head
+		} else if !s.right.done {
+			c, err := compareRows(s.keys, s.right.head, row)
+			if err != nil {
+				return nil, err
+			}
+			if c < 0 {
+				row = s.right.head
+			}
+		}
+		l, err := s.left.count(s.keys, row)
+		if err != nil {
+			return nil, err
+		}
+		r, err := s.right.count(s.keys, row)
+		if err != nil {
+			return nil, err
+		}
+		s.row, s.pending = row, s.Op.count(s.All, l, r)
+	}
+	s.pending--
+	return s.row, nil
+}
+
+// Close removes the temporary files and closes the inputs.
+func (s *SortSetOp) Close() error {
+	var err error
+	for _, sorter := range s.sorters {
+		if serr := sorter.close(); err == nil {
+			err = serr
+		}
+	}
+	s.sorters, s.left, s.right = nil, sortedInput{}, sortedInput{}
+	if lerr := s.Left.Close(); err == nil {
+		err = lerr
+	}
+	if rerr := s.Right.Close(); err == nil {
+		err = rerr
+	}
+	return err
+}
+
+// WorkTable is the rows returned by the previous iteration of the recursive
+// query. The recursive term reads them by WorkTableScan.
+type WorkTable struct {
+	rows [][]interface{}
+}
+
+// WorkTableScan returns the rows of the work table.
+type WorkTableScan struct {
+	Table *WorkTable
+	pos   int
+}
+
+// Open rewinds the rows.
+func (s *WorkTableScan) Open() error {
+	s.pos = 0
+	return nil
+}
+
+// Next returns the next row of the work table.
+func (s *WorkTableScan) Next() ([]interface{}, error) {
+	if s.pos >= len(s.Table.rows) {
+		return nil, io.EOF
+	}
+	s.pos++
+	return s.Table.rows[s.pos-1], nil
+}
+
+// Close does nothing.
+func (s *WorkTableScan) Close() error {
+	return nil
+}
+
+// RecursiveUnion is the recursive query "anchor UNION [ALL] recursive".
+// It returns the rows of Anchor, and then runs Recursive repeatedly, whose
+// WorkTableScan of Work reads the rows returned by the previous iteration,
+// until an iteration returns no new row. The duplicate rows are removed
+// unless All is true, which makes the recursion on cyclic data terminate.
+// If an iteration beyond MaxDepth returns a row, Next returns ErrRecursionLimit.
+// MaxDepth 0 means no limit.
+type RecursiveUnion struct {
+	Anchor    Operator
+	Recursive Operator
+	Work      *WorkTable
+	All       bool
+	MaxDepth  int
+
+	current Operator
+	depth   int
+	next    [][]interface{}
+	seen    map[string]bool
+}
+
+// Open opens the anchor.
+func (r *RecursiveUnion) Open() error {
+	r.current, r.depth, r.next, r.seen = r.Anchor, 0, nil, make(map[string]bool)
+	return r.Anchor.Open()
+}
+
+// Next returns the next row of the current iteration.
+func (r *RecursiveUnion) Next() ([]interface{}, error) {
+	for {
+		if r.current == nil {
+			return nil, io.EOF
+		}
+		row, err := r.current.Next()
+		if err == io.EOF {
+			if err := r.iterate(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !r.All {
+			key := expr.Key(row)
+			if r.seen[key] {
+				continue
+			}
+			r.seen[key] = true
+		}
+		if r.MaxDepth > 0 && r.depth > r.MaxDepth {
+			return nil, errfmt.Wrap(ErrRecursionLimit, fmt.Sprintf("more than %d iterations", r.MaxDepth))
+		}
+		r.next = append(r.next, row)
+		return row, nil
+	}
+}
+
+// iterate closes the current input, and starts the next iteration if the
+// current one returned any row.
+func (r *RecursiveUnion) iterate() error {
+	if err := r.current.Close(); err != nil {
+		return err
+	}
+	r.current = nil
+	if len(r.next) == 0 {
+		return nil
+	}
+	r.Work.rows, r.next = r.next, nil
+	r.depth++
+	r.current = r.Recursive
+	return r.Recursive.Open()
+}
+
+// Close closes the inputs and releases the work table.
+func (r *RecursiveUnion) Close() error {
+	r.current, r.next, r.seen, r.Work.rows = nil, nil, nil, nil
+	err := r.Anchor.Close()
+	if rerr := r.Recursive.Close(); err == nil {
+		err = rerr
+	}
+	return err
+}
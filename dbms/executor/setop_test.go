@@ -0,0 +1,182 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/nao1215/egsql/dbms/expr"
+)
+
+func TestUnion(t *testing.T) {
+	left := [][]interface{}{{int64(1), "a"}, {int64(2), "b"}, {int64(1), "a"}}
+	right := [][]interface{}{{int64(2), "b"}, {nil, "c"}, {nil, "c"}}
+	tests := []struct {
+		name string
+		all  bool
+		want [][]interface{}
+	}{
+		{
+			name: "[Success] union removes duplicate rows",
+			want: [][]interface{}{{int64(1), "a"}, {int64(2), "b"}, {nil, "c"}},
+		},
+		{
+			name: "[Success] union all",
+			all:  true,
+			want: append(append([][]interface{}{}, left...), right...),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Run(&Union{Left: &Values{Rows: left}, Right: &Values{Rows: right}, All: tt.all})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Run() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSetOp(t *testing.T) {
+	left := [][]interface{}{{int64(1), "a"}, {int64(1), "a"}, {int64(1), "a"}, {int64(2), "b"}, {nil, "c"}, {nil, "c"}}
+	right := [][]interface{}{{int64(1), "a"}, {nil, "c"}, {int64(3), "d"}, {int64(1), "a"}}
+	tests := []struct {
+		name string
+		op   SetOpType
+		all  bool
+		want [][]interface{}
+	}{
+		{
+			name: "[Success] union",
+			op:   SetUnion,
+			want: [][]interface{}{{int64(1), "a"}, {int64(2), "b"}, {int64(3), "d"}, {nil, "c"}},
+		},
+		{
+			name: "[Success] intersect",
+			op:   SetIntersect,
+			want: [][]interface{}{{int64(1), "a"}, {nil, "c"}},
+		},
+		{
+			name: "[Success] intersect all",
+			op:   SetIntersect,
+			all:  true,
+			want: [][]interface{}{{int64(1), "a"}, {int64(1), "a"}, {nil, "c"}},
+		},
+		{
+			name: "[Success] except",
+			op:   SetExcept,
+			want: [][]interface{}{{int64(2), "b"}},
+		},
+		{
+			name: "[Success] except all",
+			op:   SetExcept,
+			all:  true,
+			want: [][]interface{}{{int64(1), "a"}, {int64(2), "b"}, {nil, "c"}},
+		},
+	}
+	sortRows := cmpopts.SortSlices(func(a, b []interface{}) bool { return fmt.Sprint(a) < fmt.Sprint(b) })
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The small budget makes the sort write the rows to the temporary files.
+			config := &Config{TempDir: t.TempDir(), WorkMem: 64}
+			ops := []Operator{&SortSetOp{
+				Left: &Values{Rows: left}, Right: &Values{Rows: right}, Op: tt.op, All: tt.all, Width: 2, Config: config,
+			}}
+			if tt.op != SetUnion {
+				ops = append(ops, &HashSetOp{Left: &Values{Rows: left}, Right: &Values{Rows: right}, Op: tt.op, All: tt.all})
+			}
+			for _, op := range ops {
+				got, err := Run(op)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if diff := cmp.Diff(tt.want, got, sortRows); diff != "" {
+					t.Errorf("Run(%T) mismatch (-want +got):\n%s", op, diff)
+				}
+			}
+			if files, _ := os.ReadDir(config.TempDir); len(files) != 0 {
+				t.Errorf("temporary files are left: %v", files)
+			}
+		})
+	}
+}
+
+func TestRecursiveUnion(t *testing.T) {
+	// The recursive term is "SELECT n % mod + 1 FROM work WHERE n < 5", so the
+	// rows are 1, 2, ..., 5 if mod is large, and cycle if mod is small.
+	recursive := func(work *WorkTable, mod int64) Operator {
+		n := &expr.Column{Index: 0, Name: "n", T: expr.Int}
+		return &Project{
+			Input: &Filter{
+				Input: &WorkTableScan{Table: work},
+				Cond:  &expr.Comparison{Op: "<", Left: n, Right: &expr.Const{Value: int64(5), T: expr.Int}},
+				Env:   &expr.Env{},
+			},
+			Exprs: []expr.Expr{&expr.Arith{
+				Op:    "+",
+				Left:  &expr.Arith{Op: "%", Left: n, Right: &expr.Const{Value: mod, T: expr.Int}},
+				Right: &expr.Const{Value: int64(1), T: expr.Int},
+			}},
+			Env: &expr.Env{},
+		}
+	}
+	tests := []struct {
+		name     string
+		mod      int64
+		all      bool
+		maxDepth int
+		want     [][]interface{}
+		wantErr  error
+	}{
+		{
+			name: "[Success] recursion ends when no row is returned",
+			mod:  100,
+			all:  true,
+			want: [][]interface{}{{int64(1)}, {int64(2)}, {int64(3)}, {int64(4)}, {int64(5)}},
+		},
+		{
+			name: "[Success] cycle ends without duplicate rows",
+			mod:  2,
+			want: [][]interface{}{{int64(1)}, {int64(2)}},
+		},
+		{
+			name:     "[Success] recursion within max depth",
+			mod:      100,
+			maxDepth: 4,
+			want:     [][]interface{}{{int64(1)}, {int64(2)}, {int64(3)}, {int64(4)}, {int64(5)}},
+		},
+		{
+			name:     "[Error] recursion beyond max depth",
+			mod:      100,
+			maxDepth: 3,
+			wantErr:  ErrRecursionLimit,
+		},
+		{
+			name:     "[Error] infinite recursion with union all",
+			mod:      2,
+			all:      true,
+			maxDepth: 10,
+			wantErr:  ErrRecursionLimit,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			work := &WorkTable{}
+			got, err := Run(&RecursiveUnion{
+				Anchor: &Values{Rows: [][]interface{}{{int64(1)}}}, Recursive: recursive(work, tt.mod),
+				Work: work, All: tt.all, MaxDepth: tt.maxDepth,
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Run() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,370 @@
+package executor
+
+import (
+	"container/heap"
+	"io"
+	"sort"
+
+	"github.com/nao1215/egsql/dbms/expr"
+)
+
+// SortKey is a column of the rows to sort by.
+type SortKey struct {
+	// Index is the position of the column in the row.
+	Index int
+	// Desc is a flag indicating whether the rows are sorted in descending order.
+	Desc bool
+	// NullsFirst is a flag indicating whether NULL comes before the other values.
+	NullsFirst bool
+}
+
+// compareRows compares the rows by the keys and returns -1, 0 or +1.
+func compareRows(keys []SortKey, a, b []interface{}) (int, error) {
+	for _, k := range keys {
+		x, y := a[k.Index], b[k.Index]
+		c := 0
+		switch {
+		case x == nil && y == nil:
+			continue
+		case x == nil || y == nil:
+			// The position of NULL does not depend on the direction.
+			if (x == nil) == k.NullsFirst {
+				return -1, nil
+			}
+			return 1, nil
+		default:
+			var err error
+			if c, err = expr.Compare(x, y); err != nil {
+				return 0, err
+			}
+		}
+		if c != 0 {
+			if k.Desc {
+				c = -c
+			}
+			return c, nil
+		}
+	}
+	return 0, nil
+}
+
+// Sort returns the input rows in the order of Keys. The sort is stable,
+// and writes the sorted runs to temporary files when the rows exceed the budget.
+type Sort struct {
+	Input  Operator
+	Keys   []SortKey
+	Config *Config
+
+	sorter *sorter
+	src    rowSource
+}
+
+// Open sorts the input rows.
+func (s *Sort) Open() error {
+	if err := s.Input.Open(); err != nil {
+		return err
+	}
+	var err error
+	s.sorter, s.src, err = sortAll(s.Input, s.Keys, s.Config)
+	return err
+}
+
+// Next returns the next row in order.
+func (s *Sort) Next() ([]interface{}, error) {
+	return s.src.next()
+}
+
+// Close removes the temporary files and closes the input.
+func (s *Sort) Close() error {
+	var err error
+	if s.sorter != nil {
+		err = s.sorter.close()
+		s.sorter, s.src = nil, nil
+	}
+	if inErr := s.Input.Close(); err == nil {
+		err = inErr
+	}
+	return err
+}
+
+// sortAll sorts the rows of the opened operator, and returns the sorter,
+// which must be closed, and the sorted rows.
+func sortAll(op Operator, keys []SortKey, config *Config) (*sorter, rowSource, error) {
+	s := newSorter(keys, config)
+	for {
+		row, err := op.Next()
+		if err == io.EOF {
+			break
+		}
+		if err == nil {
+			err = s.add(row)
+		}
+		if err != nil {
+			return s, nil, err
+		}
+	}
+	src, err := s.sorted()
+	if err != nil {
+		return s, nil, err
+	}
+	return s, src, nil
+}
+
+// rowSource is the rows read in order.
+type rowSource interface {
+	// next returns the next row, or io.EOF if there is no more row.
+	next() ([]interface{}, error)
+}
+
+// sliceSource reads the rows in memory.
+type sliceSource struct {
+	rows [][]interface{}
+}
+
+// next returns the next row.
+func (s *sliceSource) next() ([]interface{}, error) {
+	if len(s.rows) == 0 {
+		return nil, io.EOF
+	}
+	row := s.rows[0]
+	s.rows = s.rows[1:]
+	return row, nil
+}
+
+// next returns the next row in the file.
+func (s *spillFile) next() ([]interface{}, error) {
+	return s.read()
+}
+
+// mergeFanIn is the number of the sorted runs of the same level that the
+// sorter merges into one run of the next level. The runs are merged when they
+// reach it, so that the number of the open temporary files is bounded by
+// mergeFanIn per level.
+const mergeFanIn = 64
+
+// checkInterval is the number of the rows that the sorter adds between the
+// checks of the context of the query.
+const checkInterval = 1024
+
+// sorter sorts the rows by the keys with the memory budget of the config.
+// When the rows in memory exceed the budget, they are sorted and written to
+// a temporary file as a sorted run, and the runs are merged at the end.
+// The sort is stable.
+type sorter struct {
+	keys   []SortKey
+	config *Config
+	buf    [][]interface{}
+	size   int64
+	// runs is the sorted runs from the oldest, and levels is the number of the
+	// merges that made each run. The levels do not increase along the runs.
+	runs   []*spillFile
+	levels []int
+	// added is the number of the rows added.
+	added int
+}
+
+// newSorter returns the sorter of the rows.
+func newSorter(keys []SortKey, config *Config) *sorter {
+	return &sorter{keys: keys, config: config}
+}
+
+// add adds the row to sort.
+func (s *sorter) add(row []interface{}) error {
+	if s.added++; s.added%checkInterval == 0 {
+		if err := s.config.err(); err != nil {
+			return err
+		}
+	}
+	s.buf = append(s.buf, row)
+	s.size += rowSize(row)
+	if s.size <= s.config.workMem() {
+		return nil
+	}
+	if err := s.sortBuffer(); err != nil {
+		return err
+	}
+	run, err := newSpillFile(s.config)
+	if err != nil {
+		return err
+	}
+	s.runs = append(s.runs, run)
+	s.levels = append(s.levels, 0)
+	for _, r := range s.buf {
+		if err := run.write(r); err != nil {
+			return err
+		}
+	}
+	if err := run.rewind(); err != nil {
+		return err
+	}
+	s.buf, s.size = nil, 0
+	return s.cascade()
+}
+
+// cascade merges the last mergeFanIn runs into one run of the next level
+// while they are of the same level. Each row is merged once per level, so the
+// rows are written O(log n) times in total.
+func (s *sorter) cascade() error {
+	for n := len(s.runs); n >= mergeFanIn && s.levels[n-mergeFanIn] == s.levels[n-1]; n = len(s.runs) {
+		if err := s.mergeRuns(n - mergeFanIn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeRuns merges the sorted runs from the position into one run. The merged
+// rows of the same keys keep the order of the runs, so the sort stays stable.
+func (s *sorter) mergeRuns(from int) error {
+	sources := make([]rowSource, 0, len(s.runs)-from)
+	for _, r := range s.runs[from:] {
+		sources = append(sources, r)
+	}
+	m, err := newMerger(s.keys, sources)
+	if err != nil {
+		return err
+	}
+	run, err := newSpillFile(s.config)
+	if err != nil {
+		return err
+	}
+	for {
+		row, err := m.next()
+		if err == io.EOF {
+			break
+		}
+		if err == nil {
+			err = run.write(row)
+		}
+		if err != nil {
+			run.close()
+			return err
+		}
+	}
+	if err := run.rewind(); err != nil {
+		run.close()
+		return err
+	}
+	err = closeAll(s.runs[from:])
+	s.runs = append(s.runs[:from], run)
+	s.levels = append(s.levels[:from], s.levels[from]+1)
+	return err
+}
+
+// sortBuffer sorts the rows in memory.
+func (s *sorter) sortBuffer() error {
+	var err error
+	sort.SliceStable(s.buf, func(i, j int) bool {
+		c, cmpErr := compareRows(s.keys, s.buf[i], s.buf[j])
+		if cmpErr != nil && err == nil {
+			err = cmpErr
+		}
+		return c < 0
+	})
+	return err
+}
+
+// sorted returns the rows added so far in order. The rows must not be added after it.
+func (s *sorter) sorted() (rowSource, error) {
+	if err := s.sortBuffer(); err != nil {
+		return nil, err
+	}
+	if len(s.runs) == 0 {
+		return &sliceSource{rows: s.buf}, nil
+	}
+	sources := make([]rowSource, 0, len(s.runs)+1)
+	for _, r := range s.runs {
+		sources = append(sources, r)
+	}
+	sources = append(sources, &sliceSource{rows: s.buf})
+	return newMerger(s.keys, sources)
+}
+
+// close removes the temporary files.
+func (s *sorter) close() error {
+	err := closeAll(s.runs)
+	s.runs, s.levels, s.buf = nil, nil, nil
+	return err
+}
+
+// merger merges the sorted sources into one sorted sequence (k-way merge).
+// The rows of the same keys are returned in the order of the sources,
+// so that the merge keeps the sort stable.
+type merger struct {
+	keys []SortKey
+	// heads is the heap of the first rows of the sources that are not exhausted.
+	heads []mergeHead
+	err   error
+}
+
+// mergeHead is the first row of a source.
+type mergeHead struct {
+	row    []interface{}
+	order  int
+	source rowSource
+}
+
+// newMerger returns the merger of the sorted sources.
+func newMerger(keys []SortKey, sources []rowSource) (*merger, error) {
+	m := &merger{keys: keys}
+	for i, src := range sources {
+		row, err := src.next()
+		if err == io.EOF {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		m.heads = append(m.heads, mergeHead{row: row, order: i, source: src})
+	}
+	heap.Init(m)
+	return m, m.err
+}
+
+// next returns the smallest row of the sources.
+func (m *merger) next() ([]interface{}, error) {
+	if len(m.heads) == 0 {
+		return nil, io.EOF
+	}
+	head := &m.heads[0]
+	row := head.row
+	next, err := head.source.next()
+	switch {
+	case err == io.EOF:
+		heap.Pop(m)
+	case err != nil:
+		return nil, err
+	default:
+		head.row = next
+		heap.Fix(m, 0)
+	}
+	return row, m.err
+}
+
+// Len is the number of the sources that are not exhausted.
+func (m *merger) Len() int { return len(m.heads) }
+
+// Less compares the first rows of the sources.
+func (m *merger) Less(i, j int) bool {
+	c, err := compareRows(m.keys, m.heads[i].row, m.heads[j].row)
+	if err != nil && m.err == nil {
+		m.err = err
+	}
+	if c == 0 {
+		return m.heads[i].order < m.heads[j].order
+	}
+	return c < 0
+}
+
+// Swap swaps the sources.
+func (m *merger) Swap(i, j int) { m.heads[i], m.heads[j] = m.heads[j], m.heads[i] }
+
+// Push is not used because the sources are added only by newMerger.
+func (m *merger) Push(x interface{}) { m.heads = append(m.heads, x.(mergeHead)) }
+
+// Pop removes the last source.
+func (m *merger) Pop() interface{} {
+	last := m.heads[len(m.heads)-1]
+	m.heads = m.heads[:len(m.heads)-1]
+	return last
+}
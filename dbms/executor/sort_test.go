@@ -0,0 +1,106 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// cancelAfter returns the rows of Input, and cancels the context after
+// returning N rows.
+type cancelAfter struct {
+	Operator
+	N      int
+	cancel context.CancelFunc
+	count  int
+}
+
+// Next returns the next row of the input.
+func (c *cancelAfter) Next() ([]interface{}, error) {
+	if c.count++; c.count == c.N {
+		c.cancel()
+	}
+	return c.Operator.Next()
+}
+
+func TestSort_Cancel(t *testing.T) {
+	rows := make([][]interface{}, 5000)
+	for i := range rows {
+		rows[i] = []interface{}{int64(len(rows) - i), "row"}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// The small budget makes the sort write the runs before it is cancelled.
+	config := &Config{TempDir: t.TempDir(), WorkMem: 1 << 10, Context: ctx}
+	input := &cancelAfter{Operator: &Values{Rows: rows}, N: 3000, cancel: cancel}
+
+	_, err := Run(&Sort{Input: input, Keys: []SortKey{{Index: 0}}, Config: config})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Run() error = %v, want %v", err, context.Canceled)
+	}
+	if input.count >= len(rows) {
+		t.Errorf("the sort reads all %d rows after it is cancelled", input.count)
+	}
+	if files, _ := os.ReadDir(config.TempDir); len(files) != 0 {
+		t.Errorf("temporary files are left: %v", files)
+	}
+}
+
+func TestSort_ManyRuns(t *testing.T) {
+	rows := make([][]interface{}, 3000)
+	for i := range rows {
+		rows[i] = []interface{}{int64(i % 7), int64(i)}
+	}
+	// The tiny budget makes more runs than mergeFanIn, which are merged on the way.
+	config := &Config{TempDir: t.TempDir(), WorkMem: 256}
+	got, err := Run(&Sort{Input: &Values{Rows: rows}, Keys: []SortKey{{Index: 0}}, Config: config})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append([][]interface{}{}, rows...)
+	sort.SliceStable(want, func(i, j int) bool { return want[i][0].(int64) < want[j][0].(int64) })
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Run() mismatch (-want +got):\n%s", diff)
+	}
+	if files, _ := os.ReadDir(config.TempDir); len(files) != 0 {
+		t.Errorf("temporary files are left: %v", files)
+	}
+}
+
+func TestSorter_MergeLevels(t *testing.T) {
+	// Each row makes a run, and the runs are merged in two levels, so each
+	// row is written once as a run and once per level.
+	n := mergeFanIn * mergeFanIn
+	spill := &Spill{}
+	s := newSorter([]SortKey{{Index: 0}}, &Config{TempDir: t.TempDir(), WorkMem: 1, spill: spill})
+	defer s.close()
+	for i := 0; i < n; i++ {
+		if err := s.add([]interface{}{int64(n - i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if diff := cmp.Diff([]int{2}, s.levels); diff != "" {
+		t.Errorf("levels mismatch (-want +got):\n%s", diff)
+	}
+	if want := int64(3 * n); spill.Written != want {
+		t.Errorf("written rows = %d, want %d", spill.Written, want)
+	}
+
+	src, err := s.sorted()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= n; i++ {
+		row, err := src.next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if row[0] != int64(i) {
+			t.Fatalf("row %d = %v, want %d", i, row[0], i)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package executor
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"os"
+
+	"github.com/nao1215/egsql/misc/errfmt"
+)
+
+// DefaultWorkMem is the default memory budget of an operator in bytes.
+const DefaultWorkMem = 4 << 20
+
+// Config is the resources that the operators can use.
+type Config struct {
+	// TempDir is the directory where the temporary files are created.
+	// It is created if it does not exist.
+	TempDir string
+	// WorkMem is the bytes of the rows that an operator keeps in memory
+	// before it writes them to the temporary files. If it is 0 or less,
+	// DefaultWorkMem is used.
+	WorkMem int64
+	// Context is the context of the query, or nil. The operators that write
+	// the temporary files stop with its error when it is done, and the files
+	// are removed when the operators are closed.
+	Context context.Context
+
+	// spill counts the rows written to and read from the temporary files
+	// for EXPLAIN ANALYZE, or nil.
+	spill *Spill
+}
+
+// workMem returns the memory budget of an operator.
+func (c *Config) workMem() int64 {
+	if c == nil || c.WorkMem <= 0 {
+		return DefaultWorkMem
+	}
+	return c.WorkMem
+}
+
+// err returns the error of the context if it is done.
+func (c *Config) err() error {
+	if c == nil || c.Context == nil {
+		return nil
+	}
+	return c.Context.Err()
+}
+
+// rowSize returns the approximate bytes of the row in memory.
+func rowSize(row []interface{}) int64 {
+	size := int64(24 + 16*len(row))
+	for _, v := range row {
+		if s, ok := v.(string); ok {
+			size += int64(len(s))
+		}
+	}
+	return size
+}
+
+// The tags of the values in the spill file.
+const (
+	tagNull byte = iota
+	tagInt
+	tagString
+	tagFalse
+	tagTrue
+)
+
+// spillFile is a temporary file of rows. The rows are written first, and
+// then read in the same order after rewind. The file is removed by close.
+type spillFile struct {
+	f *os.File
+	w *bufio.Writer
+	r *bufio.Reader
+	// rows is the number of rows written.
+	rows  int
+	buf   []byte
+	spill *Spill
+}
+
+// newSpillFile creates the temporary file in the directory of the config.
+func newSpillFile(c *Config) (*spillFile, error) {
+	if err := c.err(); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(c.TempDir, 0700); err != nil {
+		return nil, errfmt.Wrap(ErrSpill, err.Error())
+	}
+	f, err := os.CreateTemp(c.TempDir, "egsql-spill-*.tmp")
+	if err != nil {
+		return nil, errfmt.Wrap(ErrSpill, err.Error())
+	}
+	return &spillFile{f: f, w: bufio.NewWriter(f), buf: make([]byte, binary.MaxVarintLen64), spill: c.spill}, nil
+}
+
+// write appends the row to the file.
+func (s *spillFile) write(row []interface{}) error {
+	s.putUvarint(uint64(len(row)))
+	for _, v := range row {
+		switch x := v.(type) {
+		case nil:
+			s.w.WriteByte(tagNull)
+		case int64:
+			s.w.WriteByte(tagInt)
+			n := binary.PutVarint(s.buf, x)
+			s.w.Write(s.buf[:n])
+		case string:
+			s.w.WriteByte(tagString)
+			s.putUvarint(uint64(len(x)))
+			s.w.WriteString(x)
+		case bool:
+			if x {
+				s.w.WriteByte(tagTrue)
+			} else {
+				s.w.WriteByte(tagFalse)
+			}
+		default:
+			return errfmt.Wrap(ErrSpill, "unsupported value")
+		}
+	}
+	s.rows++
+	if s.spill != nil {
+		s.spill.Written++
+	}
+	return nil
+}
+
+// putUvarint writes the unsigned integer.
+func (s *spillFile) putUvarint(x uint64) {
+	n := binary.PutUvarint(s.buf, x)
+	s.w.Write(s.buf[:n])
+}
+
+// rewind flushes the written rows and starts reading from the first row.
+func (s *spillFile) rewind() error {
+	if err := s.w.Flush(); err != nil {
+		return errfmt.Wrap(ErrSpill, err.Error())
+	}
+	if _, err := s.f.Seek(0, io.SeekStart); err != nil {
+		return errfmt.Wrap(ErrSpill, err.Error())
+	}
+	s.r = bufio.NewReader(s.f)
+	return nil
+}
+
+// read returns the next row. It returns io.EOF after the last row.
+func (s *spillFile) read() ([]interface{}, error) {
+	n, err := binary.ReadUvarint(s.r)
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, errfmt.Wrap(ErrSpill, err.Error())
+	}
+	row := make([]interface{}, n)
+	for i := range row {
+		tag, err := s.r.ReadByte()
+		if err != nil {
+			return nil, errfmt.Wrap(ErrSpill, err.Error())
+		}
+		switch tag {
+		case tagInt:
+			if row[i], err = binary.ReadVarint(s.r); err != nil {
+				return nil, errfmt.Wrap(ErrSpill, err.Error())
+			}
+		case tagString:
+			l, err := binary.ReadUvarint(s.r)
+			if err != nil {
+				return nil, errfmt.Wrap(ErrSpill, err.Error())
+			}
+			b := make([]byte, l)
+			if _, err := io.ReadFull(s.r, b); err != nil {
+				return nil, errfmt.Wrap(ErrSpill, err.Error())
+			}
+			row[i] = string(b)
+		case tagTrue:
+			row[i] = true
+		case tagFalse:
+			row[i] = false
+		}
+	}
+	if s.spill != nil {
+		s.spill.Read++
+	}
+	return row, nil
+}
+
+// close closes and removes the file.
+func (s *spillFile) close() error {
+	if s.f == nil {
+		return nil
+	}
+	name := s.f.Name()
+	err := s.f.Close()
+	s.f = nil
+	if rmErr := os.Remove(name); err == nil && rmErr != nil {
+		err = rmErr
+	}
+	if err != nil {
+		return errfmt.Wrap(ErrSpill, err.Error())
+	}
+	return nil
+}
+
+// closeAll closes and removes the files, and returns the first error.
+func closeAll(files []*spillFile) error {
+	var first error
+	for _, f := range files {
+		if err := f.close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
@@ -0,0 +1,104 @@
+package executor
+
+import "github.com/nao1215/egsql/dbms/expr"
+
+// Subquery is the plan of the subquery evaluated by the expression (expr.Query).
+// Plan is run with Env, whose Outer is set to the rows of the outer queries
+// for each evaluation. If the subquery is not correlated, its rows are
+// computed once and reused, so a Subquery must be used by only one expression.
+type Subquery struct {
+	Plan Operator
+	Env  *expr.Env
+	// Correlated is a flag indicating whether the subquery references the
+	// columns of the outer queries.
+	Correlated bool
+
+	rows [][]interface{}
+	done bool
+}
+
+// Rows returns at most limit rows of the subquery for the row of the outer query.
+func (s *Subquery) Rows(env *expr.Env, row []interface{}, limit int) ([][]interface{}, error) {
+	if s.done {
+		return s.rows, nil
+	}
+	s.Env.Args = env.Args
+	s.Env.Outer = append([][]interface{}{row}, env.Outer...)
+	rows, err := runLimit(s.Plan, limit)
+	if err != nil {
+		return nil, err
+	}
+	if !s.Correlated {
+		s.rows, s.done = rows, true
+	}
+	return rows, nil
+}
+
+// Reset discards the rows of the subquery that is not correlated, so that
+// they are computed again when the plan is executed again.
+func (s *Subquery) Reset() {
+	s.rows, s.done = nil, false
+}
+
+// SemiJoin returns the left rows that have any right row of the same keys
+// (the semi join), or the left rows that have no such right row if Anti is
+// true (the anti join). The rows whose keys include NULL match nothing.
+// The simple correlated EXISTS is planned as SemiJoin, which reads the rows
+// of the subquery once instead of running it for each row.
+type SemiJoin struct {
+	Left  Operator
+	Right Operator
+	// LeftKeys is evaluated for the left row, and RightKeys is evaluated for the right row.
+	LeftKeys  []expr.Expr
+	RightKeys []expr.Expr
+	Anti      bool
+	Env       *expr.Env
+
+	keys map[string]bool
+}
+
+// Open reads the keys of the right rows and opens the left input.
+func (j *SemiJoin) Open() error {
+	rights, err := Run(j.Right)
+	if err != nil {
+		return err
+	}
+	j.keys = make(map[string]bool)
+	for _, r := range rights {
+		key, ok, err := hashKey(j.Env, j.RightKeys, r)
+		if err != nil {
+			return err
+		}
+		if ok {
+			j.keys[key] = true
+		}
+	}
+	return j.Left.Open()
+}
+
+// Next returns the next left row that matches (or does not match if Anti) any right row.
+func (j *SemiJoin) Next() ([]interface{}, error) {
+	for {
+		row, err := j.Left.Next()
+		if err != nil {
+			return nil, err
+		}
+		key, ok, err := hashKey(j.Env, j.LeftKeys, row)
+		if err != nil {
+			return nil, err
+		}
+		if (ok && j.keys[key]) != j.Anti {
+			return row, nil
+		}
+	}
+}
+
+// Close closes the inputs.
+func (j *SemiJoin) Close() error {
+	j.keys = nil
+	err := j.Left.Close()
+	if rErr := j.Right.Close(); err == nil {
+		err = rErr
+	}
+	return err
+}
@@ -0,0 +1,350 @@
+package executor
+
+import (
+	"io"
+
+	"github.com/nao1215/egsql/dbms/expr"
+	"github.com/nao1215/egsql/dbms/query"
+)
+
+// Window computes the window functions of the same window. It sorts the input
+// rows by PartitionBy and OrderBy, reads the rows of a partition into memory,
+// and returns the input rows of the partition extended to Width columns with
+// the results of Funcs at Positions. The sort writes the sorted runs to
+// temporary files when the rows exceed the budget.
+type Window struct {
+	Input       Operator
+	PartitionBy []expr.Expr
+	OrderBy     []expr.SortExpr
+	Funcs       []*expr.WindowFunc
+	Positions   []int
+	Width       int
+	Env         *expr.Env
+	Config      *Config
+
+	sorter *sorter
+	src    rowSource
+	// lookahead is the first row of the next partition.
+	lookahead []interface{}
+	// out is the rows of the current partition with the results.
+	out [][]interface{}
+}
+
+// Open sorts the input rows.
+func (w *Window) Open() error {
+	w.lookahead, w.out = nil, nil
+	if err := w.Input.Open(); err != nil {
+		return err
+	}
+	// The sorted row is the partition keys and the order keys followed by the input row.
+	exprs := append(append([]expr.Expr{}, w.PartitionBy...), sortExprs(w.OrderBy)...)
+	keys := make([]SortKey, len(exprs))
+	for i := range keys {
+		keys[i] = SortKey{Index: i}
+		if o := i - len(w.PartitionBy); o >= 0 {
+			keys[i].Desc, keys[i].NullsFirst = w.OrderBy[o].Desc, w.OrderBy[o].NullsFirst
+		}
+	}
+	w.sorter = newSorter(keys, w.Config)
+	for {
+		row, err := w.Input.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		values, err := evalAll(w.Env, exprs, row)
+		if err != nil {
+			return err
+		}
+		if err := w.sorter.add(append(values, row...)); err != nil {
+			return err
+		}
+	}
+	src, err := w.sorter.sorted()
+	if err != nil {
+		return err
+	}
+	w.src = src
+	return nil
+}
+
+// Next returns the next row with the results of the window functions.
+func (w *Window) Next() ([]interface{}, error) {
+	if len(w.out) == 0 {
+		rows, err := w.readPartition()
+		if err != nil {
+			return nil, err
+		}
+		if w.out, err = w.compute(rows); err != nil {
+			return nil, err
+		}
+	}
+	row := w.out[0]
+	w.out = w.out[1:]
+	return row, nil
+}
+
+// Close removes the temporary files and closes the input.
+func (w *Window) Close() error {
+	var err error
+	if w.sorter != nil {
+		err = w.sorter.close()
+		w.sorter, w.src = nil, nil
+	}
+	w.lookahead, w.out = nil, nil
+	if inErr := w.Input.Close(); err == nil {
+		err = inErr
+	}
+	return err
+}
+
+// readPartition returns the sorted rows of the next partition, or io.EOF if
+// there is no more row.
+func (w *Window) readPartition() ([][]interface{}, error) {
+	first := w.lookahead
+	if first == nil {
+		row, err := w.src.next()
+		if err != nil {
+			return nil, err
+		}
+		first = row
+	}
+	w.lookahead = nil
+	rows := [][]interface{}{first}
+	partition := w.sorter.keys[:len(w.PartitionBy)]
+	for {
+		row, err := w.src.next()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		c, err := compareRows(partition, first, row)
+		if err != nil {
+			return nil, err
+		}
+		if c != 0 {
+			w.lookahead = row
+			return rows, nil
+		}
+		rows = append(rows, row)
+	}
+}
+
+// compute returns the input rows of the partition with the results.
+func (w *Window) compute(rows [][]interface{}) ([][]interface{}, error) {
+	n := len(w.sorter.keys)
+	p := &windowPartition{env: w.Env, rows: make([][]interface{}, len(rows))}
+	for i, row := range rows {
+		p.rows[i] = row[n:]
+	}
+	if err := p.setPeers(rows, w.sorter.keys[len(w.PartitionBy):]); err != nil {
+		return nil, err
+	}
+	out := make([][]interface{}, len(rows))
+	for i, row := range p.rows {
+		out[i] = make([]interface{}, w.Width)
+		copy(out[i], row)
+	}
+	for k, fn := range w.Funcs {
+		results, err := p.eval(fn)
+		if err != nil {
+			return nil, err
+		}
+		for i, v := range results {
+			out[i][w.Positions[k]] = v
+		}
+	}
+	return out, nil
+}
+
+// sortExprs returns the expressions of the sort keys.
+func sortExprs(items []expr.SortExpr) []expr.Expr {
+	exprs := make([]expr.Expr, len(items))
+	for i, item := range items {
+		exprs[i] = item.Expr
+	}
+	return exprs
+}
+
+// windowPartition is the input rows of a partition in the order of the window.
+type windowPartition struct {
+	env  *expr.Env
+	rows [][]interface{}
+	// peerStart and peerEnd is the range of the peers of each row, i.e. the
+	// rows that have the same order keys.
+	peerStart, peerEnd []int
+	// groups is the number of the peer groups up to each row.
+	groups []int
+}
+
+// setPeers sets the peers of the rows by the order keys of the sorted rows.
+func (p *windowPartition) setPeers(sorted [][]interface{}, keys []SortKey) error {
+	n := len(sorted)
+	p.peerStart, p.peerEnd, p.groups = make([]int, n), make([]int, n), make([]int, n)
+	start := 0
+	for i := range sorted {
+		p.groups[i] = 1
+		if i > 0 {
+			c, err := compareRows(keys, sorted[i-1], sorted[i])
+			if err != nil {
+				return err
+			}
+			p.groups[i] = p.groups[i-1]
+			if c != 0 {
+				for j := start; j < i; j++ {
+					p.peerEnd[j] = i
+				}
+				start = i
+				p.groups[i]++
+			}
+		}
+		p.peerStart[i] = start
+	}
+	for j := start; j < n; j++ {
+		p.peerEnd[j] = n
+	}
+	return nil
+}
+
+// eval returns the results of the window function for the rows.
+func (p *windowPartition) eval(fn *expr.WindowFunc) ([]interface{}, error) {
+	results := make([]interface{}, len(p.rows))
+	switch fn.Name {
+	case "row_number":
+		for i := range p.rows {
+			results[i] = int64(i + 1)
+		}
+	case "rank":
+		for i := range p.rows {
+			results[i] = int64(p.peerStart[i] + 1)
+		}
+	case "dense_rank":
+		for i := range p.rows {
+			results[i] = int64(p.groups[i])
+		}
+	case "lag", "lead":
+		for i := range p.rows {
+			v, err := p.offsetValue(fn, i)
+			if err != nil {
+				return nil, err
+			}
+			results[i] = v
+		}
+	case "first_value", "last_value":
+		for i := range p.rows {
+			lo, hi := p.frame(fn.Frame, i)
+			if lo >= hi {
+				continue
+			}
+			j := lo
+			if fn.Name == "last_value" {
+				j = hi - 1
+			}
+			v, err := fn.Args[0].Eval(p.env, p.rows[j])
+			if err != nil {
+				return nil, err
+			}
+			results[i] = v
+		}
+	default:
+		return p.aggregate(fn, results)
+	}
+	return results, nil
+}
+
+// offsetValue returns the value of LAG or LEAD for the i-th row: the argument
+// of the row at the offset before or after it, or the default if there is no
+// such row.
+func (p *windowPartition) offsetValue(fn *expr.WindowFunc, i int) (interface{}, error) {
+	offset := int64(1)
+	if len(fn.Args) > 1 {
+		v, err := fn.Args[1].Eval(p.env, p.rows[i])
+		if err != nil || v == nil {
+			return nil, err
+		}
+		offset = v.(int64)
+	}
+	if fn.Name == "lag" {
+		offset = -offset
+	}
+	if j := int64(i) + offset; j >= 0 && j < int64(len(p.rows)) {
+		return fn.Args[0].Eval(p.env, p.rows[j])
+	}
+	if len(fn.Args) > 2 {
+		return fn.Args[2].Eval(p.env, p.rows[i])
+	}
+	return nil, nil
+}
+
+// aggregate sets the results of the aggregate function over the frames. The
+// frames that start at the first row are aggregated incrementally because
+// their ends never move backward.
+func (p *windowPartition) aggregate(fn *expr.WindowFunc, results []interface{}) ([]interface{}, error) {
+	running := fn.Frame.Start.Type == query.UnboundedPreceding
+	acc, stepped := fn.Aggregate.NewAccumulator(), 0
+	for i := range p.rows {
+		lo, hi := p.frame(fn.Frame, i)
+		if !running {
+			acc, stepped = fn.Aggregate.NewAccumulator(), lo
+		}
+		for ; stepped < hi; stepped++ {
+			args, err := fn.Aggregate.Eval(p.env, p.rows[stepped])
+			if err != nil {
+				return nil, err
+			}
+			if err := acc.Step(args); err != nil {
+				return nil, err
+			}
+		}
+		v, err := acc.Result()
+		if err != nil {
+			return nil, err
+		}
+		results[i] = v
+	}
+	return results, nil
+}
+
+// frame returns the range of the rows in the frame of the i-th row. The range
+// is empty if lo >= hi.
+func (p *windowPartition) frame(f query.WindowFrame, i int) (lo, hi int) {
+	n := len(p.rows)
+	bound := func(b query.FrameBound, end bool) int {
+		switch b.Type {
+		case query.UnboundedPreceding:
+			return 0
+		case query.UnboundedFollowing:
+			return n
+		case query.CurrentRow:
+			switch {
+			case f.Range && end:
+				return p.peerEnd[i]
+			case f.Range:
+				return p.peerStart[i]
+			case end:
+				return i + 1
+			}
+			return i
+		}
+		offset := int(b.Offset)
+		if b.Type == query.Preceding {
+			offset = -offset
+		}
+		if end {
+			return i + offset + 1
+		}
+		return i + offset
+	}
+	lo, hi = bound(f.Start, false), bound(f.End, true)
+	if lo < 0 {
+		lo = 0
+	}
+	if hi > n {
+		hi = n
+	}
+	return lo, hi
+}
@@ -0,0 +1,73 @@
+package executor
+
+import (
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nao1215/egsql/dbms/expr"
+	"github.com/nao1215/egsql/dbms/query"
+)
+
+func TestWindow(t *testing.T) {
+	// The rows are (g, x).
+	rows := [][]interface{}{
+		{"a", int64(3)}, {"b", int64(5)}, {"a", int64(1)}, {"a", int64(3)}, {"b", nil}, {"a", int64(4)},
+	}
+	g := &expr.Column{Index: 0, Name: "g", T: expr.Varchar}
+	x := &expr.Column{Index: 1, Name: "x", T: expr.Int}
+	sum, err := expr.NewAggregate("sum", []expr.Expr{x}, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows2 := query.WindowFrame{
+		Start: query.FrameBound{Type: query.Preceding, Offset: 1},
+		End:   query.FrameBound{Type: query.Following, Offset: 1},
+	}
+	running := query.WindowFrame{
+		Range: true,
+		Start: query.FrameBound{Type: query.UnboundedPreceding},
+		End:   query.FrameBound{Type: query.CurrentRow},
+	}
+	funcs := []*expr.WindowFunc{
+		{Name: "row_number", T: expr.Int},
+		{Name: "rank", T: expr.Int},
+		{Name: "dense_rank", T: expr.Int},
+		{Name: "lag", Args: []expr.Expr{x}, T: expr.Int},
+		{Name: "sum", Aggregate: sum, Frame: running, T: expr.Int},
+		{Name: "sum", Aggregate: sum, Frame: rows2, T: expr.Int},
+		{Name: "last_value", Args: []expr.Expr{x}, Frame: running, T: expr.Int},
+	}
+	want := [][]interface{}{
+		{"a", int64(1), int64(1), int64(1), int64(1), nil, int64(1), int64(4), int64(1)},
+		{"a", int64(3), int64(2), int64(2), int64(2), int64(1), int64(7), int64(7), int64(3)},
+		{"a", int64(3), int64(3), int64(2), int64(2), int64(3), int64(7), int64(10), int64(3)},
+		{"a", int64(4), int64(4), int64(4), int64(3), int64(3), int64(11), int64(7), int64(4)},
+		{"b", int64(5), int64(1), int64(1), int64(1), nil, int64(5), int64(5), int64(5)},
+		{"b", nil, int64(2), int64(2), int64(2), int64(5), int64(5), int64(5), nil},
+	}
+	positions := make([]int, len(funcs))
+	for i := range positions {
+		positions[i] = 2 + i
+	}
+	// The small budget makes the sort write the rows to the temporary files.
+	config := &Config{TempDir: t.TempDir(), WorkMem: 64}
+	got, err := Run(&Window{
+		Input:       &Values{Rows: rows},
+		PartitionBy: []expr.Expr{g},
+		OrderBy:     []expr.SortExpr{{Expr: x}},
+		Funcs:       funcs,
+		Positions:   positions,
+		Width:       2 + len(funcs),
+		Config:      config,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Run() mismatch (-want +got):\n%s", diff)
+	}
+	if files, _ := os.ReadDir(config.TempDir); len(files) != 0 {
+		t.Errorf("temporary files are left: %v", files)
+	}
+}
@@ -0,0 +1,243 @@
+package dbms
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nao1215/egsql/dbms/executor"
+	"github.com/nao1215/egsql/dbms/expr"
+	"github.com/nao1215/egsql/dbms/meta"
+	"github.com/nao1215/egsql/dbms/query"
+	"github.com/nao1215/egsql/dbms/storage"
+	"github.com/nao1215/egsql/misc/errfmt"
+)
+
+// modifyPlan is the plan of INSERT, UPDATE or DELETE statement shown by EXPLAIN.
+type modifyPlan struct {
+	// kind is "Insert", "Update" or "Delete".
+	kind  string
+	table string
+	// source is the plan of the rows to insert, or of the rows to update or
+	// delete each followed by its row id.
+	source executor.Operator
+	// upsert is ON CONFLICT clause of INSERT, or nil.
+	upsert *upsert
+}
+
+// execExplain executes EXPLAIN statement. It returns the operator tree of the
+// query as the rows of one column "QUERY PLAN", one operator per row. For
+// EXPLAIN ANALYZE, the query is executed and each operator is annotated with
+// the actual rows, the loops, the time and the rows spilled to the temporary
+// files. SELECT, INSERT, UPDATE and DELETE can be explained.
+func (db *EgSQLDB) execExplain(sess *Session, stmt *query.ExplainStmt, args []interface{}) (*meta.ResultSet, error) {
+	var lines []string
+	switch s := stmt.Stmt.(type) {
+	case *query.SelectStmt:
+		plan, err := db.explainSelect(sess, s, stmt.Analyze, args)
+		if err != nil {
+			return nil, err
+		}
+		lines = executor.Explain(plan)
+	case *query.InsertStmt, *query.UpdateStmt, *query.DeleteStmt:
+		var err error
+		if lines, err = db.explainModify(sess, s, stmt.Analyze, args); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errfmt.Wrap(query.ErrNotSupportedStatement, fmt.Sprintf("EXPLAIN %T: only SELECT, INSERT, UPDATE and DELETE can be explained", stmt.Stmt))
+	}
+
+	rs := meta.NewResultSet("EXPLAIN")
+	rs.ColumnNames = []string{"QUERY PLAN"}
+	for _, line := range lines {
+		rs.Rows = append(rs.Rows, []interface{}{line})
+	}
+	return rs, nil
+}
+
+// explainSelect plans SELECT statement, and executes it for EXPLAIN ANALYZE.
+func (db *EgSQLDB) explainSelect(sess *Session, s *query.SelectStmt, analyze bool, args []interface{}) (executor.Operator, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	p := &planner{db: db, sess: sess, env: &expr.Env{Args: args}}
+	r, err := p.planSelect(s)
+	if err != nil {
+		return nil, err
+	}
+	if !analyze {
+		return r.plan, nil
+	}
+	plan := executor.Analyze(r.plan)
+	if _, err := executor.Run(plan); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// explainModify returns the lines that describe INSERT, UPDATE or DELETE
+// statement. EXPLAIN ANALYZE executes the statement, so the rows are changed,
+// in the transaction of the session if any.
+func (db *EgSQLDB) explainModify(sess *Session, stmt query.Stmt, analyze bool, args []interface{}) ([]string, error) {
+	if !analyze {
+		var plan *modifyPlan
+		var err error
+		switch s := stmt.(type) {
+		case *query.InsertStmt:
+			plan, err = db.planInsert(sess, s, args)
+		case *query.UpdateStmt:
+			plan, err = db.planUpdate(sess, s, args)
+		case *query.DeleteStmt:
+			plan, err = db.planDelete(sess, s, args)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return explainModifyPlan(plan, plan.kind+" on "+plan.table), nil
+	}
+
+	plan := &modifyPlan{}
+	start := time.Now()
+	rs, err := db.inTx(sess.Tx, func(tx *Tx) (*meta.ResultSet, error) {
+		switch s := stmt.(type) {
+		case *query.InsertStmt:
+			return db.execInsert(sess, tx, s, args, plan)
+		case *query.UpdateStmt:
+			return db.execUpdate(sess, tx, s, args, plan)
+		}
+		return db.execDelete(sess, tx, stmt.(*query.DeleteStmt), args, plan)
+	})
+	if err != nil {
+		return nil, err
+	}
+	header := fmt.Sprintf("%s on %s (actual rows=%d loops=1 time=%.3fms)", plan.kind, plan.table, rs.AffectedRows, float64(time.Since(start).Microseconds())/1000)
+	return explainModifyPlan(plan, header), nil
+}
+
+// planInsert returns the plan of INSERT statement without executing it. The
+// values of VALUES clause are not evaluated, because they may advance the
+// sequences.
+func (db *EgSQLDB) planInsert(sess *Session, s *query.InsertStmt, args []interface{}) (*modifyPlan, error) {
+	table, err := db.resolveTable(sess, s.Table)
+	if err != nil {
+		return nil, err
+	}
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	t, ok := db.tables[table]
+	if !ok {
+		return nil, errfmt.Wrap(ErrNotExistTable, table)
+	}
+	scheme := t.Scheme()
+	positions, err := columnPositions(scheme, s.Columns)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &modifyPlan{kind: "Insert", table: table}
+	if s.Select == nil {
+		for _, values := range s.Rows {
+			if len(values) != len(positions) {
+				return nil, storage.ErrNotMatchValueNum
+			}
+		}
+		plan.source = &executor.Values{Rows: make([][]interface{}, len(s.Rows))}
+	} else {
+		p := &planner{db: db, sess: sess, env: &expr.Env{Args: args}}
+		r, err := p.planSelect(s.Select)
+		if err != nil {
+			return nil, err
+		}
+		if len(r.columns) != len(positions) {
+			return nil, storage.ErrNotMatchValueNum
+		}
+		plan.source = r.plan
+	}
+	if s.OnConflict != nil {
+		if plan.upsert, err = db.newUpsert(sess, table, s.Table.Name, scheme, s.OnConflict, args); err != nil {
+			return nil, err
+		}
+	}
+	return plan, nil
+}
+
+// planUpdate returns the plan of UPDATE statement without executing it.
+func (db *EgSQLDB) planUpdate(sess *Session, s *query.UpdateStmt, args []interface{}) (*modifyPlan, error) {
+	table, err := db.resolveTable(sess, s.Table)
+	if err != nil {
+		return nil, err
+	}
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	t, ok := db.tables[table]
+	if !ok {
+		return nil, errfmt.Wrap(ErrNotExistTable, table)
+	}
+	p := &planner{db: db, sess: sess, env: &expr.Env{Args: args}}
+	b := p.binder(tableColumns(t.Scheme(), aliasOr(s.Alias, s.Table.Name)))
+	if _, _, err := bindAssignments(b, t.Scheme(), s.Set); err != nil {
+		return nil, err
+	}
+	source, err := planWhere(p, b, t, s.Where)
+	if err != nil {
+		return nil, err
+	}
+	return &modifyPlan{kind: "Update", table: table, source: source}, nil
+}
+
+// planDelete returns the plan of DELETE statement without executing it.
+func (db *EgSQLDB) planDelete(sess *Session, s *query.DeleteStmt, args []interface{}) (*modifyPlan, error) {
+	table, err := db.resolveTable(sess, s.Table)
+	if err != nil {
+		return nil, err
+	}
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	t, ok := db.tables[table]
+	if !ok {
+		return nil, errfmt.Wrap(ErrNotExistTable, table)
+	}
+	p := &planner{db: db, sess: sess, env: &expr.Env{Args: args}}
+	b := p.binder(tableColumns(t.Scheme(), aliasOr(s.Alias, s.Table.Name)))
+	source, err := planWhere(p, b, t, s.Where)
+	if err != nil {
+		return nil, err
+	}
+	return &modifyPlan{kind: "Delete", table: table, source: source}, nil
+}
+
+// explainModifyPlan returns the lines of the plan of INSERT, UPDATE or DELETE
+// statement: the header, ON CONFLICT clause, and the plan of the rows as the input.
+func explainModifyPlan(plan *modifyPlan, header string) []string {
+	lines := []string{header}
+	if u := plan.upsert; u != nil {
+		resolution := "UPDATE"
+		if u.doNothing {
+			resolution = "NOTHING"
+		}
+		lines = append(lines, "  Conflict Resolution: "+resolution)
+		names := make([]string, len(u.indexes))
+		for i, idx := range u.indexes {
+			names[i] = idx.Name
+		}
+		lines = append(lines, "  Conflict Arbiter Indexes: "+strings.Join(names, ", "))
+		if u.where != nil {
+			lines = append(lines, "  Conflict Filter: "+u.where.String())
+		}
+	}
+	for i, line := range executor.Explain(plan.source) {
+		if i == 0 {
+			lines = append(lines, "  -> "+line)
+		} else {
+			lines = append(lines, "     "+line)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,245 @@
+package dbms
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nao1215/egsql/dbms/query"
+)
+
+func TestEgSQLDB_Explain(t *testing.T) {
+	db, err := NewEgSQLDB(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sql := range []string{
+		"CREATE TABLE a (id INT PRIMARY KEY, v INT)",
+		"INSERT INTO a VALUES (1, 1), (2, 2), (3, 3)",
+	} {
+		if _, err := execSQL(t, db, sql); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		sql  string
+		want []string
+	}{
+		{
+			name: "[Success] seq scan, filter and sort",
+			sql:  "EXPLAIN SELECT v FROM a WHERE v > 1 ORDER BY v DESC",
+			want: []string{
+				"Sort (keys: #1 DESC)",
+				"  -> Project (v)",
+				"       -> Filter (cond: (v > 1))",
+				"            -> Seq Scan on a (rows=3)",
+			},
+		},
+		{
+			name: "[Success] index scan",
+			sql:  "EXPLAIN SELECT id FROM a WHERE id = 2",
+			want: []string{
+				"Project (id)",
+				"  -> Index Scan on a using a_pkey (key: 2)",
+			},
+		},
+		{
+			name: "[Success] insert values",
+			sql:  "EXPLAIN INSERT INTO a VALUES (4, 4), (5, 5)",
+			want: []string{
+				"Insert on a",
+				"  -> Values (rows=2)",
+			},
+		},
+		{
+			name: "[Success] insert select",
+			sql:  "EXPLAIN INSERT INTO a SELECT id + 10, v FROM a WHERE v > 1",
+			want: []string{
+				"Insert on a",
+				"  -> Project ((id + 10), v)",
+				"       -> Filter (cond: (v > 1))",
+				"            -> Seq Scan on a (rows=3)",
+			},
+		},
+		{
+			name: "[Success] insert on conflict do nothing",
+			sql:  "EXPLAIN INSERT INTO a VALUES (1, 1) ON CONFLICT DO NOTHING",
+			want: []string{
+				"Insert on a",
+				"  Conflict Resolution: NOTHING",
+				"  Conflict Arbiter Indexes: a_pkey",
+				"  -> Values (rows=1)",
+			},
+		},
+		{
+			name: "[Success] insert on conflict do update",
+			sql:  "EXPLAIN INSERT INTO a VALUES (1, 1) ON CONFLICT (id) DO UPDATE SET v = excluded.v WHERE a.v < 10",
+			want: []string{
+				"Insert on a",
+				"  Conflict Resolution: UPDATE",
+				"  Conflict Arbiter Indexes: a_pkey",
+				"  Conflict Filter: (a.v < 10)",
+				"  -> Values (rows=1)",
+			},
+		},
+		{
+			name: "[Success] update",
+			sql:  "EXPLAIN UPDATE a SET v = v + 1 WHERE v > 1",
+			want: []string{
+				"Update on a",
+				"  -> Filter (cond: (v > 1))",
+				"       -> Seq Scan on a (rows=3)",
+			},
+		},
+		{
+			name: "[Success] delete all rows",
+			sql:  "EXPLAIN DELETE FROM a",
+			want: []string{
+				"Delete on a",
+				"  -> Seq Scan on a (rows=3)",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs := querySQL(t, db, tt.sql)
+			if diff := cmp.Diff([]string{"QUERY PLAN"}, rs.ColumnNames); diff != "" {
+				t.Errorf("columns mismatch (-want +got):\n%s", diff)
+			}
+			got := make([]string, len(rs.Rows))
+			for i, row := range rs.Rows {
+				got[i] = row[0].(string)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("plan mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	// EXPLAIN without ANALYZE does not change the rows.
+	rs := querySQL(t, db, "SELECT count(*) FROM a")
+	if diff := cmp.Diff([][]interface{}{{int64(3)}}, rs.Rows); diff != "" {
+		t.Errorf("rows mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestEgSQLDB_ExplainAnalyze(t *testing.T) {
+	db, err := NewEgSQLDB(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sql := range []string{
+		"CREATE TABLE a (id INT PRIMARY KEY, v INT)",
+		"INSERT INTO a VALUES (1, 1), (2, 2), (3, 1)",
+	} {
+		if _, err := execSQL(t, db, sql); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rs := querySQL(t, db, "EXPLAIN ANALYZE SELECT v, count(*) FROM a GROUP BY v")
+	want := []*regexp.Regexp{
+		regexp.MustCompile(`^Project \(v, count\(\*\)\) \(actual rows=2 loops=1 time=[0-9.]+ms\)$`),
+		regexp.MustCompile(`^  -> Hash Aggregate \(keys: v, aggregates: count\(\*\)\) \(actual rows=2 loops=1 time=[0-9.]+ms\)$`),
+		regexp.MustCompile(`^       -> Seq Scan on a \(rows=3\) \(actual rows=3 loops=1 time=[0-9.]+ms\)$`),
+	}
+	if len(rs.Rows) != len(want) {
+		t.Fatalf("EXPLAIN ANALYZE returns %d lines, want %d: %v", len(rs.Rows), len(want), rs.Rows)
+	}
+	for i, re := range want {
+		if line := rs.Rows[i][0].(string); !re.MatchString(line) {
+			t.Errorf("line %d = %q, want to match %q", i, line, re)
+		}
+	}
+}
+
+func TestEgSQLDB_ExplainAnalyzeInsert(t *testing.T) {
+	db, err := NewEgSQLDB(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sql := range []string{
+		"CREATE TABLE a (id INT PRIMARY KEY, v INT)",
+		"INSERT INTO a VALUES (1, 1), (2, 2), (3, 3)",
+	} {
+		if _, err := execSQL(t, db, sql); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rs := querySQL(t, db, "EXPLAIN ANALYZE INSERT INTO a SELECT id + 1, v FROM a ON CONFLICT DO NOTHING")
+	want := []*regexp.Regexp{
+		regexp.MustCompile(`^Insert on a \(actual rows=1 loops=1 time=[0-9.]+ms\)$`),
+		regexp.MustCompile(`^  Conflict Resolution: NOTHING$`),
+		regexp.MustCompile(`^  Conflict Arbiter Indexes: a_pkey$`),
+		regexp.MustCompile(`^  -> Project \(\(id \+ 1\), v\) \(actual rows=3 loops=1 time=[0-9.]+ms\)$`),
+		regexp.MustCompile(`^       -> Seq Scan on a \(rows=3\) \(actual rows=3 loops=1 time=[0-9.]+ms\)$`),
+	}
+	if len(rs.Rows) != len(want) {
+		t.Fatalf("EXPLAIN ANALYZE returns %d lines, want %d: %v", len(rs.Rows), len(want), rs.Rows)
+	}
+	for i, re := range want {
+		if line := rs.Rows[i][0].(string); !re.MatchString(line) {
+			t.Errorf("line %d = %q, want to match %q", i, line, re)
+		}
+	}
+
+	// EXPLAIN ANALYZE executes the statement.
+	rs = querySQL(t, db, "SELECT id, v FROM a ORDER BY id")
+	wantRows := [][]interface{}{{int64(1), int64(1)}, {int64(2), int64(2)}, {int64(3), int64(3)}, {int64(4), int64(3)}}
+	if diff := cmp.Diff(wantRows, rs.Rows); diff != "" {
+		t.Errorf("rows mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestEgSQLDB_ExplainAnalyzeDelete(t *testing.T) {
+	db, err := NewEgSQLDB(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sql := range []string{
+		"CREATE TABLE a (id INT PRIMARY KEY, v INT)",
+		"INSERT INTO a VALUES (1, 1), (2, 2), (3, 3)",
+	} {
+		if _, err := execSQL(t, db, sql); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rs := querySQL(t, db, "EXPLAIN ANALYZE DELETE FROM a WHERE v >= 2")
+	want := []*regexp.Regexp{
+		regexp.MustCompile(`^Delete on a \(actual rows=2 loops=1 time=[0-9.]+ms\)$`),
+		regexp.MustCompile(`^  -> Filter \(cond: \(v >= 2\)\) \(actual rows=2 loops=1 time=[0-9.]+ms\)$`),
+		regexp.MustCompile(`^       -> Seq Scan on a \(rows=3\) \(actual rows=3 loops=1 time=[0-9.]+ms\)$`),
+	}
+	if len(rs.Rows) != len(want) {
+		t.Fatalf("EXPLAIN ANALYZE returns %d lines, want %d: %v", len(rs.Rows), len(want), rs.Rows)
+	}
+	for i, re := range want {
+		if line := rs.Rows[i][0].(string); !re.MatchString(line) {
+			t.Errorf("line %d = %q, want to match %q", i, line, re)
+		}
+	}
+
+	// EXPLAIN ANALYZE executes the statement.
+	rs = querySQL(t, db, "SELECT id, v FROM a ORDER BY id")
+	if diff := cmp.Diff([][]interface{}{{int64(1), int64(1)}}, rs.Rows); diff != "" {
+		t.Errorf("rows mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestEgSQLDB_Explain_NotSupported(t *testing.T) {
+	db, err := NewEgSQLDB(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := execSQL(t, db, "CREATE TABLE a (id INT PRIMARY KEY)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := execSQL(t, db, "EXPLAIN TRUNCATE a"); !errors.Is(err, query.ErrNotSupportedStatement) {
+		t.Errorf("EXPLAIN TRUNCATE error = %v, want %v", err, query.ErrNotSupportedStatement)
+	}
+}
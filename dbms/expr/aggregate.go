@@ -0,0 +1,284 @@
+package expr
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/nao1215/egsql/misc/errfmt"
+)
+
+// Aggregate is a call of the aggregate function like SUM(x). It is not an Expr
+// because its value is computed from the rows of a group by the aggregation
+// operator, which creates an Accumulator for each group.
+type Aggregate struct {
+	// Name is function name in lower case.
+	Name string
+	// Args is the arguments evaluated for each row of the input. It is empty for COUNT(*).
+	Args []Expr
+	// Distinct is a flag indicating whether the duplicate values of the arguments
+	// are aggregated only once, like COUNT(DISTINCT x).
+	Distinct bool
+	// T is the data type of the result.
+	T Type
+	// newAcc returns the accumulator of the function without DISTINCT.
+	newAcc func() Accumulator
+}
+
+// Accumulator computes the result of the aggregate function for a group.
+type Accumulator interface {
+	// Step adds the values of the arguments of a row in the group.
+	Step(args []interface{}) error
+	// Result returns the result for the rows added so far.
+	Result() (interface{}, error)
+}
+
+// aggregates is the constructors of the built-in aggregate functions.
+// The arguments are bound, and the function is not called with "*".
+var aggregates = map[string]func(args []Expr) (*Aggregate, error){
+	"count": func(args []Expr) (*Aggregate, error) {
+		return &Aggregate{T: Int, newAcc: func() Accumulator { return &countAcc{} }}, nil
+	},
+	"sum": func(args []Expr) (*Aggregate, error) {
+		return &Aggregate{T: Int, newAcc: func() Accumulator { return &sumAcc{} }}, nil
+	},
+	"avg": func(args []Expr) (*Aggregate, error) {
+		return &Aggregate{T: Int, newAcc: func() Accumulator { return &sumAcc{avg: true} }}, nil
+	},
+	"min": func(args []Expr) (*Aggregate, error) {
+		return &Aggregate{T: args[0].Type(), newAcc: func() Accumulator { return &minMaxAcc{sign: -1} }}, nil
+	},
+	"max": func(args []Expr) (*Aggregate, error) {
+		return &Aggregate{T: args[0].Type(), newAcc: func() Accumulator { return &minMaxAcc{sign: 1} }}, nil
+	},
+}
+
+// AggregateFuncs is the aggregate functions other than the built-in ones,
+// e.g. the functions defined by the application.
+type AggregateFuncs interface {
+	// IsAggregate reports whether the function is an aggregate function.
+	IsAggregate(name string) bool
+	// NewAggregate returns the call of the aggregate function whose arguments
+	// are already bound.
+	NewAggregate(name string, args []Expr, distinct bool) (*Aggregate, error)
+}
+
+// IsAggregate reports whether the function is a built-in aggregate function.
+func IsAggregate(name string) bool {
+	_, ok := aggregates[name]
+	return ok
+}
+
+// NewAggregate returns the call of the aggregate function whose arguments are
+// already bound. star is true for COUNT(*). The arguments of SUM and AVG are
+// converted to Int.
+func NewAggregate(name string, args []Expr, star, distinct bool) (*Aggregate, error) {
+	newFn, ok := aggregates[name]
+	if !ok {
+		return nil, errfmt.Wrap(ErrNotSupportedFunction, name)
+	}
+	switch {
+	case star && (name != "count" || distinct):
+		return nil, errfmt.Wrap(ErrWrongNumberOfArgs, name+"(*) is not allowed")
+	case !star && len(args) != 1:
+		return nil, errfmt.Wrap(ErrWrongNumberOfArgs, name+" takes exactly one argument")
+	}
+	if name == "sum" || name == "avg" {
+		arg, err := Coerce(args[0], Int)
+		if err != nil {
+			return nil, err
+		}
+		args = []Expr{arg}
+	}
+	a, err := newFn(args)
+	if err != nil {
+		return nil, err
+	}
+	a.Name, a.Args, a.Distinct = name, args, distinct
+	return a, nil
+}
+
+// NewCustomAggregate returns the call of the aggregate function that is not
+// built in. newAcc returns the accumulator of a group, which is given the
+// values of args for each row including NULL.
+func NewCustomAggregate(name string, args []Expr, t Type, distinct bool, newAcc func() Accumulator) *Aggregate {
+	return &Aggregate{Name: name, Args: args, Distinct: distinct, T: t, newAcc: newAcc}
+}
+
+// NewAccumulator returns the accumulator for a new group.
+func (a *Aggregate) NewAccumulator() Accumulator {
+	acc := a.newAcc()
+	if a.Distinct {
+		return &distinctAcc{seen: make(map[string]struct{}), acc: acc}
+	}
+	return acc
+}
+
+// Eval evaluates the arguments for the row.
+func (a *Aggregate) Eval(env *Env, row []interface{}) ([]interface{}, error) {
+	values := make([]interface{}, len(a.Args))
+	for i, arg := range a.Args {
+		v, err := arg.Eval(env, row)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// String returns the call in SQL like text.
+func (a *Aggregate) String() string {
+	if len(a.Args) == 0 {
+		return a.Name + "(*)"
+	}
+	if a.Distinct {
+		return a.Name + "(DISTINCT " + joinExprs(a.Args) + ")"
+	}
+	return a.Name + "(" + joinExprs(a.Args) + ")"
+}
+
+// hasNull reports whether any of the values is NULL. The aggregate functions
+// ignore the rows whose argument is NULL.
+func hasNull(values []interface{}) bool {
+	for _, v := range values {
+		if v == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// countAcc counts the rows whose arguments are not NULL.
+type countAcc struct {
+	n int64
+}
+
+// Step adds the row.
+func (c *countAcc) Step(args []interface{}) error {
+	if !hasNull(args) {
+		c.n++
+	}
+	return nil
+}
+
+// Result returns the number of the rows.
+func (c *countAcc) Result() (interface{}, error) {
+	return c.n, nil
+}
+
+// sumAcc computes SUM or AVG. The result is NULL if there is no value.
+// AVG is rounded toward zero because the result is Int.
+type sumAcc struct {
+	avg bool
+	sum int64
+	n   int64
+}
+
+// Step adds the value.
+func (s *sumAcc) Step(args []interface{}) error {
+	if hasNull(args) {
+		return nil
+	}
+	sum, err := arith("+", s.sum, args[0].(int64))
+	if err != nil {
+		return err
+	}
+	s.sum = sum.(int64)
+	s.n++
+	return nil
+}
+
+// Result returns the sum or the average.
+func (s *sumAcc) Result() (interface{}, error) {
+	switch {
+	case s.n == 0:
+		return nil, nil
+	case s.avg:
+		return s.sum / s.n, nil
+	}
+	return s.sum, nil
+}
+
+// minMaxAcc computes MIN (sign is -1) or MAX (sign is 1).
+type minMaxAcc struct {
+	sign  int
+	value interface{}
+}
+
+// Step compares the value with the current one.
+func (m *minMaxAcc) Step(args []interface{}) error {
+	if hasNull(args) {
+		return nil
+	}
+	if m.value == nil {
+		m.value = args[0]
+		return nil
+	}
+	c, err := Compare(args[0], m.value)
+	if err != nil {
+		return err
+	}
+	if c == m.sign {
+		m.value = args[0]
+	}
+	return nil
+}
+
+// Result returns the minimum or the maximum value.
+func (m *minMaxAcc) Result() (interface{}, error) {
+	return m.value, nil
+}
+
+// distinctAcc passes only the first occurrence of the values to acc.
+type distinctAcc struct {
+	seen map[string]struct{}
+	acc  Accumulator
+}
+
+// Step adds the values if they are not seen yet.
+func (d *distinctAcc) Step(args []interface{}) error {
+	if hasNull(args) {
+		return nil
+	}
+	key := Key(args)
+	if _, ok := d.seen[key]; ok {
+		return nil
+	}
+	d.seen[key] = struct{}{}
+	return d.acc.Step(args)
+}
+
+// Result returns the result of acc.
+func (d *distinctAcc) Result() (interface{}, error) {
+	return d.acc.Result()
+}
+
+// Key returns the text that identifies the values, so that the values equal
+// to each other have the same key. NULL has the key different from any value,
+// and the same as the other NULL, as GROUP BY and DISTINCT treat NULLs.
+func Key(values []interface{}) string {
+	var b strings.Builder
+	for _, v := range values {
+		switch x := v.(type) {
+		case nil:
+			b.WriteString("n;")
+		case int64:
+			b.WriteString("i")
+			b.WriteString(strconv.FormatInt(x, 10))
+			b.WriteString(";")
+		case bool:
+			if x {
+				b.WriteString("t;")
+			} else {
+				b.WriteString("f;")
+			}
+		case string:
+			// The length makes the key unambiguous even if the text has ";".
+			b.WriteString("s")
+			b.WriteString(strconv.Itoa(len(x)))
+			b.WriteString(":")
+			b.WriteString(x)
+		}
+	}
+	return b.String()
+}
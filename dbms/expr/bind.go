@@ -0,0 +1,465 @@
+package expr
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/nao1215/egsql/dbms/meta"
+	"github.com/nao1215/egsql/dbms/query"
+	"github.com/nao1215/egsql/misc/errfmt"
+)
+
+// Scope resolves the column references to the positions in the row.
+type Scope interface {
+	// Lookup returns the position and the type of the column. table is
+	// the table name qualifying the column, or empty if it is not qualified.
+	Lookup(table, name string) (int, Type, error)
+}
+
+// ColumnInfo is a column of the row.
+type ColumnInfo struct {
+	// Table is the name of the table that the column belongs to.
+	// It is the name to qualify the column with, e.g. the alias of the table.
+	Table string
+	// Name is column name.
+	Name string
+	T    Type
+	// Hidden is a flag indicating whether the column can be referenced only
+	// if it is qualified with the table name, e.g. the column of JOIN USING
+	// that is merged into the column without the table name.
+	Hidden bool
+}
+
+// Columns is the Scope of the columns of a row, in the order of the row.
+type Columns []ColumnInfo
+
+// Lookup returns the position and the type of the column.
+func (cs Columns) Lookup(table, name string) (int, Type, error) {
+	found := -1
+	for i, c := range cs {
+		if c.Name != name || (table != "" && c.Table != table) || (table == "" && c.Hidden) {
+			continue
+		}
+		if found >= 0 {
+			return 0, Unknown, errfmt.Wrap(ErrAmbiguousColumn, qualify(table, name))
+		}
+		found = i
+	}
+	if found < 0 {
+		return 0, Unknown, errfmt.Wrap(meta.ErrNotExistColumn, qualify(table, name))
+	}
+	return found, cs[found].T, nil
+}
+
+// qualify returns the column name qualified with the table name as written in SQL.
+func qualify(table, name string) string {
+	if table == "" {
+		return name
+	}
+	return table + "." + name
+}
+
+// FuncBinder binds the function call whose arguments are already bound.
+type FuncBinder func(name string, args []Expr) (Expr, error)
+
+// Binder binds the parsed expressions to the columns of the rows.
+// See the package documentation for the type rules.
+type Binder struct {
+	// Scope is the columns that the expressions can reference. If it is nil,
+	// the expressions can not reference any column.
+	Scope Scope
+	// Outer is the binder of the query that the subquery is in, or nil.
+	// The columns that are not in Scope are looked up in the outer queries.
+	Outer *Binder
+	// Funcs binds the function calls. If it is nil, no function can be called.
+	Funcs FuncBinder
+	// Aggregates is the aggregate functions other than the built-in ones, or nil.
+	Aggregates AggregateFuncs
+	// Subquery plans the subqueries. If it is nil, no subquery can be used.
+	Subquery SubqueryPlanner
+	// Correlated is set to true when the expression references the column of
+	// the outer query, if it is not nil.
+	Correlated *bool
+	// substitute returns the expression bound instead of e, or nil if e is
+	// bound as usual. It is used to bind the expressions after grouping.
+	substitute func(e query.Expr) (Expr, error)
+}
+
+// Bind binds the expression.
+func (b *Binder) Bind(e query.Expr) (Expr, error) {
+	if b.substitute != nil {
+		if bound, err := b.substitute(e); err != nil || bound != nil {
+			return bound, err
+		}
+	}
+	switch v := e.(type) {
+	case *query.Literal:
+		return literal(v.Value), nil
+	case *query.Param:
+		return &Param{Index: v.Index}, nil
+	case *query.ColumnRef:
+		if b.Scope == nil {
+			return b.lookupOuter(v)
+		}
+		i, t, err := b.Scope.Lookup(v.Table, v.Name)
+		if errors.Is(err, meta.ErrNotExistColumn) {
+			return b.lookupOuter(v)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &Column{Index: i, Name: qualify(v.Table, v.Name), T: t}, nil
+	case *query.FuncCall:
+		return b.bindCall(v)
+	case *query.BinaryExpr:
+		return b.bindBinary(v)
+	case *query.UnaryExpr:
+		if v.Op == "NOT" {
+			operand, err := b.BindAs(v.Expr, Bool)
+			if err != nil {
+				return nil, err
+			}
+			return &Not{Expr: operand}, nil
+		}
+		operand, err := b.BindAs(v.Expr, Int)
+		if err != nil {
+			return nil, err
+		}
+		return &Neg{Expr: operand}, nil
+	case *query.IsNullExpr:
+		operand, err := b.Bind(v.Expr)
+		if err != nil {
+			return nil, err
+		}
+		return &IsNull{Expr: operand, Not: v.Not}, nil
+	case *query.LikeExpr:
+		return b.bindLike(v)
+	case *query.InExpr:
+		if v.Select != nil {
+			return b.bindInSubquery(v)
+		}
+		exprs, err := b.bindCommon(append([]query.Expr{v.Expr}, v.List...)...)
+		if err != nil {
+			return nil, err
+		}
+		return &In{Expr: exprs[0], List: exprs[1:], Not: v.Not}, nil
+	case *query.BetweenExpr:
+		exprs, err := b.bindCommon(v.Expr, v.Low, v.High)
+		if err != nil {
+			return nil, err
+		}
+		return &Between{Expr: exprs[0], Low: exprs[1], High: exprs[2], Not: v.Not}, nil
+	case *query.CaseExpr:
+		return b.bindCase(v)
+	case *query.CastExpr:
+		operand, err := b.Bind(v.Expr)
+		if err != nil {
+			return nil, err
+		}
+		to := TypeOf(v.Type)
+		if c, ok := operand.(*Const); ok {
+			// The constant is converted now, so that the invalid literal
+			// like CAST('abc' AS INT) is an error at plan time.
+			value, err := Convert(c.Value, to)
+			if err != nil {
+				return nil, err
+			}
+			return &Const{Value: value, T: to}, nil
+		}
+		return &Cast{Expr: operand, To: to}, nil
+	case *query.SubqueryExpr:
+		q, types, err := b.bindSubquery(v.Select, 1)
+		if err != nil {
+			return nil, err
+		}
+		return &ScalarSubquery{Query: q, T: types[0]}, nil
+	case *query.ExistsExpr:
+		q, _, err := b.bindSubquery(v.Select, 0)
+		if err != nil {
+			return nil, err
+		}
+		return &Exists{Query: q}, nil
+	}
+	return nil, errfmt.Wrap(ErrNotSupportedExpr, fmt.Sprintf("%T", e))
+}
+
+// BindAs binds the expression and converts it to the type t by the implicit
+// conversion. If it can not be converted, ErrTypeMismatch is returned.
+func (b *Binder) BindAs(e query.Expr, t Type) (Expr, error) {
+	bound, err := b.Bind(e)
+	if err != nil {
+		return nil, err
+	}
+	return Coerce(bound, t)
+}
+
+// BindCondition binds the condition of WHERE clause. It must be Bool.
+func (b *Binder) BindCondition(e query.Expr) (Expr, error) {
+	return b.BindAs(e, Bool)
+}
+
+// literal returns the constant of the literal value. The string literal
+// is untyped, so that it can be converted to the type required by the context.
+func literal(v interface{}) *Const {
+	switch v.(type) {
+	case string:
+		return &Const{Value: v, T: Varchar, untyped: true}
+	case nil:
+		return &Const{T: Unknown}
+	}
+	return &Const{Value: v, T: typeOfValue(v)}
+}
+
+// Coerce converts the expression to the type t by the implicit conversion:
+// Unknown expression is converted to any type, and the untyped string
+// literal is converted to Int or Bool at this time. If t is Unknown,
+// the expression is returned as is.
+func Coerce(e Expr, t Type) (Expr, error) {
+	from := e.Type()
+	if t == Unknown || from == t {
+		return e, nil
+	}
+	if c, ok := e.(*Const); ok && (from == Unknown || c.untyped) {
+		v, err := Convert(c.Value, t)
+		if err != nil {
+			return nil, err
+		}
+		return &Const{Value: v, T: t}, nil
+	}
+	if from == Unknown {
+		return &Cast{Expr: e, To: t}, nil
+	}
+	return nil, errfmt.Wrap(ErrTypeMismatch, fmt.Sprintf("%s is %s, but %s is required", e, from, t))
+}
+
+// isUntyped reports whether the expression takes the type of the context.
+func isUntyped(e Expr) bool {
+	if e.Type() == Unknown {
+		return true
+	}
+	c, ok := e.(*Const)
+	return ok && c.untyped
+}
+
+// CommonType returns the type that the expressions are converted to, so that
+// they can be compared: the type of the first typed expression, or the type
+// of the first untyped literal if all are untyped.
+func CommonType(exprs ...Expr) Type {
+	t := Unknown
+	for _, e := range exprs {
+		if !isUntyped(e) {
+			return e.Type()
+		}
+		if t == Unknown {
+			t = e.Type()
+		}
+	}
+	return t
+}
+
+// bindCommon binds the expressions and converts them to their common type.
+func (b *Binder) bindCommon(exprs ...query.Expr) ([]Expr, error) {
+	bound := make([]Expr, len(exprs))
+	for i, e := range exprs {
+		var err error
+		if bound[i], err = b.Bind(e); err != nil {
+			return nil, err
+		}
+	}
+	return coerceAll(bound)
+}
+
+// coerceAll converts the expressions to their common type.
+func coerceAll(exprs []Expr) ([]Expr, error) {
+	t := CommonType(exprs...)
+	for i, e := range exprs {
+		var err error
+		if exprs[i], err = Coerce(e, t); err != nil {
+			return nil, err
+		}
+	}
+	return exprs, nil
+}
+
+// bindBinary binds the binary operation.
+func (b *Binder) bindBinary(e *query.BinaryExpr) (Expr, error) {
+	switch e.Op {
+	case "AND", "OR":
+		l, r, err := b.bindPair(e.Left, e.Right, Bool)
+		if err != nil {
+			return nil, err
+		}
+		return &Logical{Op: e.Op, Left: l, Right: r}, nil
+	case "+", "-", "*", "/", "%":
+		l, r, err := b.bindPair(e.Left, e.Right, Int)
+		if err != nil {
+			return nil, err
+		}
+		return &Arith{Op: e.Op, Left: l, Right: r}, nil
+	case "||":
+		l, err := b.bindVarchar(e.Left)
+		if err != nil {
+			return nil, err
+		}
+		r, err := b.bindVarchar(e.Right)
+		if err != nil {
+			return nil, err
+		}
+		return &Concat{Left: l, Right: r}, nil
+	case "=", "<>", "<", "<=", ">", ">=":
+		l, err := b.Bind(e.Left)
+		if err != nil {
+			return nil, err
+		}
+		r, err := b.Bind(e.Right)
+		if err != nil {
+			return nil, err
+		}
+		return NewComparison(e.Op, l, r)
+	}
+	return nil, errfmt.Wrap(ErrNotSupportedExpr, e.Op)
+}
+
+// NewComparison returns the comparison of the bound operands, which are
+// converted to their common type.
+func NewComparison(op string, left, right Expr) (Expr, error) {
+	exprs, err := coerceAll([]Expr{left, right})
+	if err != nil {
+		return nil, err
+	}
+	return &Comparison{Op: op, Left: exprs[0], Right: exprs[1]}, nil
+}
+
+// bindPair binds the operands and converts them to the type t.
+func (b *Binder) bindPair(left, right query.Expr, t Type) (Expr, Expr, error) {
+	l, err := b.BindAs(left, t)
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := b.BindAs(right, t)
+	if err != nil {
+		return nil, nil, err
+	}
+	return l, r, nil
+}
+
+// bindVarchar binds the operand of "||", which is converted to Varchar
+// even if it is Int or Bool.
+func (b *Binder) bindVarchar(e query.Expr) (Expr, error) {
+	bound, err := b.Bind(e)
+	if err != nil {
+		return nil, err
+	}
+	if bound.Type() == Varchar {
+		return bound, nil
+	}
+	if c, ok := bound.(*Const); ok {
+		v, err := Convert(c.Value, Varchar)
+		if err != nil {
+			return nil, err
+		}
+		return &Const{Value: v, T: Varchar}, nil
+	}
+	return &Cast{Expr: bound, To: Varchar}, nil
+}
+
+// bindLike binds LIKE or ILIKE. The operands must be Varchar.
+func (b *Binder) bindLike(e *query.LikeExpr) (Expr, error) {
+	operand, pattern, err := b.bindPair(e.Expr, e.Pattern, Varchar)
+	if err != nil {
+		return nil, err
+	}
+	like := &Like{Expr: operand, Pattern: pattern, Not: e.Not, CaseInsensitive: e.CaseInsensitive}
+	if e.Escape != nil {
+		if like.Escape, err = b.BindAs(e.Escape, Varchar); err != nil {
+			return nil, err
+		}
+		if c, ok := like.Escape.(*Const); ok && c.Value != nil {
+			if _, err := escapeRune(c.Value.(string)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return like, nil
+}
+
+// bindCase binds CASE expression. The operand of the simple CASE and the
+// values of WHEN are converted to their common type, and so are the results.
+func (b *Binder) bindCase(e *query.CaseExpr) (Expr, error) {
+	c := &Case{}
+	if e.Operand != nil {
+		exprs := []query.Expr{e.Operand}
+		for _, w := range e.Whens {
+			exprs = append(exprs, w.Cond)
+		}
+		bound, err := b.bindCommon(exprs...)
+		if err != nil {
+			return nil, err
+		}
+		c.Operand = bound[0]
+		for _, cond := range bound[1:] {
+			c.Whens = append(c.Whens, When{Cond: cond})
+		}
+	} else {
+		for _, w := range e.Whens {
+			cond, err := b.BindCondition(w.Cond)
+			if err != nil {
+				return nil, err
+			}
+			c.Whens = append(c.Whens, When{Cond: cond})
+		}
+	}
+
+	var results []Expr
+	for _, w := range e.Whens {
+		r, err := b.Bind(w.Result)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+	if e.Else != nil {
+		r, err := b.Bind(e.Else)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+	results, err := coerceAll(results)
+	if err != nil {
+		return nil, err
+	}
+	for i := range c.Whens {
+		c.Whens[i].Result = results[i]
+	}
+	if e.Else != nil {
+		c.Else = results[len(results)-1]
+	}
+	c.T = CommonType(results...)
+	return c, nil
+}
+
+// bindCall binds the function call. The aggregate function is bound by
+// Grouping, so it is not allowed here.
+func (b *Binder) bindCall(e *query.FuncCall) (Expr, error) {
+	if e.Over != nil {
+		return nil, errfmt.Wrap(ErrMisplacedWindow, e.Name)
+	}
+	if b.IsAggregate(e.Name) {
+		return nil, errfmt.Wrap(ErrMisplacedAggregate, e.Name)
+	}
+	if e.Star || e.Distinct {
+		return nil, errfmt.Wrap(ErrNotSupportedExpr, e.Name+" is not an aggregate function")
+	}
+	args := make([]Expr, len(e.Args))
+	for i, a := range e.Args {
+		var err error
+		if args[i], err = b.Bind(a); err != nil {
+			return nil, err
+		}
+	}
+	if b.Funcs == nil {
+		return nil, errfmt.Wrap(ErrNotSupportedFunction, e.Name)
+	}
+	return b.Funcs(e.Name, args)
+}
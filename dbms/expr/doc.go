@@ -0,0 +1,47 @@
+// Package expr is the typed expression tree and its evaluator.
+//
+// The parsed expression (query.Expr) is bound to the columns of the rows by
+// Binder before the statement is executed (at plan time). Binding resolves
+// the column references to the positions in the row, checks the data types
+// of the operands and inserts the implicit conversions, so that the type
+// errors are reported before any row is read.
+//
+// # Values
+//
+// The value of an expression is int64 (Int), string (Varchar), bool (Bool)
+// or nil (NULL). The comparisons and the logical operators follow the three
+// valued logic of SQL: the comparison with NULL is NULL, and NULL AND FALSE
+// is FALSE. WHERE clause keeps only the rows whose condition is TRUE.
+//
+// # Implicit conversion between Int and Varchar
+//
+// Int and Varchar are not converted to each other implicitly, except for
+// the following cases. Use CAST to convert the other expressions.
+//
+//   - A string literal (e.g. '10') has no type until it is used. Where Int
+//     is required, for example "id = '10'" or "id + '1'", it is converted to
+//     Int when the statement is bound, and the invalid integer text like 'abc'
+//     is an error at that time.
+//   - A placeholder (?) and NULL take the type required by the context.
+//     The value bound to the placeholder is converted when it is evaluated.
+//   - The operands of the concatenation operator "||" are converted to
+//     Varchar. Int is converted to its decimal text.
+//
+// So "id = '10'" is valid for Int column id, but "id = name" for Varchar
+// column name is an error (ErrTypeMismatch) even if every name is a number.
+//
+// # Operators
+//
+//   - "+", "-", "*", "/", "%" and unary "-" require Int. The overflow and
+//     the division by zero are errors.
+//   - "=", "<>", "<", "<=", ">", ">=", IN and BETWEEN require the operands
+//     of the same type after the implicit conversion.
+//   - AND, OR, NOT and the conditions of WHERE and CASE WHEN require Bool.
+//   - LIKE and ILIKE require Varchar. "%" matches any sequence of characters,
+//     "_" matches any one character, and the escape character (default "\")
+//     makes the next character literal. ILIKE ignores case.
+//   - The results of CASE are converted to the common type, as the operands
+//     of the comparison.
+//   - CAST converts between Int, Varchar and Bool. Bool is converted to Int
+//     as 1 or 0, and to Varchar as 'true' or 'false'.
+package expr
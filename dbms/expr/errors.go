@@ -0,0 +1,48 @@
+package expr
+
+import "errors"
+
+var (
+	// ErrTypeMismatch means that the data type of the operand is not allowed
+	// for the operator, or the operands have different data types.
+	ErrTypeMismatch = errors.New("data types do not match")
+	// ErrInvalidCast means that the value can not be converted to the data type.
+	// For example, CAST('abc' AS INT).
+	ErrInvalidCast = errors.New("invalid value for the data type")
+	// ErrDivisionByZero means that the divisor of "/" or "%" is zero.
+	ErrDivisionByZero = errors.New("division by zero")
+	// ErrOutOfRange means that the result of the arithmetic overflows Int.
+	ErrOutOfRange = errors.New("integer out of range")
+	// ErrInvalidEscape means that the escape character of LIKE is not one character,
+	// or the pattern ends with the escape character.
+	ErrInvalidEscape = errors.New("invalid escape string")
+	// ErrAmbiguousColumn means that the column reference matches more than one column.
+	ErrAmbiguousColumn = errors.New("column reference is ambiguous")
+	// ErrNotMatchArgNum means that the number of arguments and the number of
+	// placeholders do not match.
+	ErrNotMatchArgNum = errors.New("'number of arguments' and 'number of placeholders' do not match")
+	// ErrWrongNumberOfArgs means that the function is called with the wrong
+	// number of arguments.
+	ErrWrongNumberOfArgs = errors.New("wrong number of arguments")
+	// ErrMisplacedAggregate means that the aggregate function is used where it is
+	// not allowed, e.g. in WHERE clause or in the argument of another aggregate.
+	ErrMisplacedAggregate = errors.New("aggregate function is not allowed here")
+	// ErrNotGrouped means that the column is referenced after the rows are grouped,
+	// but it is neither in GROUP BY clause nor in the argument of an aggregate function.
+	ErrNotGrouped = errors.New("column must appear in the GROUP BY clause or be used in an aggregate function")
+	// ErrMisplacedWindow means that the window function is used where it is not
+	// allowed, e.g. in WHERE clause or in the argument of another window function.
+	ErrMisplacedWindow = errors.New("window function is not allowed here")
+	// ErrInvalidFrame means that the frame of the window is invalid, e.g. it
+	// starts with UNBOUNDED FOLLOWING.
+	ErrInvalidFrame = errors.New("invalid window frame")
+	// ErrSubqueryColumns means that the subquery used as a value or in IN
+	// returns more than one column.
+	ErrSubqueryColumns = errors.New("subquery must return only one column")
+	// ErrSubqueryRows means that the subquery used as a value returns more than one row.
+	ErrSubqueryRows = errors.New("more than one row returned by a subquery used as an expression")
+	// ErrNotSupportedFunction means that the function is not supported.
+	ErrNotSupportedFunction = errors.New("not supported function")
+	// ErrNotSupportedExpr means that the expression can not be used in the place.
+	ErrNotSupportedExpr = errors.New("not supported expression")
+)
@@ -0,0 +1,656 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/nao1215/egsql/misc/errfmt"
+)
+
+// Expr is a bound expression. It is made by Binder, and evaluated
+// for each row.
+type Expr interface {
+	// Type returns the data type of the value.
+	Type() Type
+	// Eval evaluates the expression for the row.
+	Eval(env *Env, row []interface{}) (interface{}, error)
+	// String returns the expression in SQL like text.
+	String() string
+}
+
+// Env is the environment in which the expressions are evaluated.
+type Env struct {
+	// Args is the values bound to the placeholders.
+	Args []interface{}
+	// Outer is the rows of the outer queries that the correlated subquery is
+	// evaluated for, from the query that the subquery is in.
+	Outer [][]interface{}
+}
+
+// Const is a constant value.
+type Const struct {
+	Value interface{}
+	T     Type
+	// untyped is a flag indicating whether the constant is a string literal
+	// that can be converted to the type required by the context.
+	untyped bool
+}
+
+// Column is a reference to the value in the row.
+type Column struct {
+	// Index is the position of the value in the row.
+	Index int
+	// Name is column name, qualified with the table name if it is written so.
+	Name string
+	T    Type
+}
+
+// Param is the value bound to the placeholder.
+type Param struct {
+	// Index is the 0-origin position of the placeholder.
+	Index int
+}
+
+// Arith is an arithmetic operation of Int: "+", "-", "*", "/" or "%".
+type Arith struct {
+	Op    string
+	Left  Expr
+	Right Expr
+}
+
+// Neg is unary "-" of Int.
+type Neg struct {
+	Expr Expr
+}
+
+// Comparison is a comparison: "=", "<>", "<", "<=", ">" or ">=".
+type Comparison struct {
+	Op    string
+	Left  Expr
+	Right Expr
+}
+
+// Concat is the concatenation of Varchar "||".
+type Concat struct {
+	Left  Expr
+	Right Expr
+}
+
+// Logical is AND or OR of Bool.
+type Logical struct {
+	// Op is "AND" or "OR".
+	Op    string
+	Left  Expr
+	Right Expr
+}
+
+// Not is NOT of Bool.
+type Not struct {
+	Expr Expr
+}
+
+// IsNull is IS [NOT] NULL.
+type IsNull struct {
+	Expr Expr
+	Not  bool
+}
+
+// Like is [NOT] LIKE or [NOT] ILIKE.
+type Like struct {
+	Expr    Expr
+	Pattern Expr
+	// Escape is the escape character. It is nil if ESCAPE is not specified;
+	// then the escape character is "\".
+	Escape          Expr
+	Not             bool
+	CaseInsensitive bool
+}
+
+// In is [NOT] IN (list).
+type In struct {
+	Expr Expr
+	List []Expr
+	Not  bool
+}
+
+// Between is [NOT] BETWEEN low AND high.
+type Between struct {
+	Expr Expr
+	Low  Expr
+	High Expr
+	Not  bool
+}
+
+// Case is CASE expression. If Operand is not nil, the value of Operand is
+// compared with the value of each When.Cond; otherwise When.Cond is a condition.
+type Case struct {
+	Operand Expr
+	Whens   []When
+	// Else is the result if no WHEN matches. It is nil for NULL.
+	Else Expr
+	T    Type
+}
+
+// When is WHEN cond THEN result clause of Case.
+type When struct {
+	Cond   Expr
+	Result Expr
+}
+
+// Cast converts the value to the type.
+type Cast struct {
+	Expr Expr
+	To   Type
+}
+
+// Call is a function call.
+type Call struct {
+	Name string
+	Args []Expr
+	T    Type
+	// Deterministic is a flag indicating whether Fn always returns the same
+	// result for the same arguments.
+	Deterministic bool
+	// Fn computes the result from the values of the arguments.
+	Fn func(args []interface{}) (interface{}, error)
+}
+
+// Type returns the data type of the value.
+func (e *Const) Type() Type { return e.T }
+
+// Type returns the data type of the value.
+func (e *Column) Type() Type { return e.T }
+
+// Type returns the data type of the value.
+func (e *Param) Type() Type { return Unknown }
+
+// Type returns the data type of the value.
+func (e *Arith) Type() Type { return Int }
+
+// Type returns the data type of the value.
+func (e *Neg) Type() Type { return Int }
+
+// Type returns the data type of the value.
+func (e *Comparison) Type() Type { return Bool }
+
+// Type returns the data type of the value.
+func (e *Concat) Type() Type { return Varchar }
+
+// Type returns the data type of the value.
+func (e *Logical) Type() Type { return Bool }
+
+// Type returns the data type of the value.
+func (e *Not) Type() Type { return Bool }
+
+// Type returns the data type of the value.
+func (e *IsNull) Type() Type { return Bool }
+
+// Type returns the data type of the value.
+func (e *Like) Type() Type { return Bool }
+
+// Type returns the data type of the value.
+func (e *In) Type() Type { return Bool }
+
+// Type returns the data type of the value.
+func (e *Between) Type() Type { return Bool }
+
+// Type returns the data type of the value.
+func (e *Case) Type() Type { return e.T }
+
+// Type returns the data type of the value.
+func (e *Cast) Type() Type { return e.To }
+
+// Type returns the data type of the value.
+func (e *Call) Type() Type { return e.T }
+
+// Eval returns the constant value.
+func (e *Const) Eval(env *Env, row []interface{}) (interface{}, error) {
+	return e.Value, nil
+}
+
+// Eval returns the value in the row.
+func (e *Column) Eval(env *Env, row []interface{}) (interface{}, error) {
+	return row[e.Index], nil
+}
+
+// Eval returns the value bound to the placeholder.
+func (e *Param) Eval(env *Env, row []interface{}) (interface{}, error) {
+	if env == nil || e.Index >= len(env.Args) {
+		return nil, errfmt.Wrap(ErrNotMatchArgNum, fmt.Sprintf("placeholder %d", e.Index+1))
+	}
+	return env.Args[e.Index], nil
+}
+
+// Eval returns the result of the arithmetic operation.
+func (e *Arith) Eval(env *Env, row []interface{}) (interface{}, error) {
+	l, r, err := evalPair(env, row, e.Left, e.Right)
+	if err != nil || l == nil || r == nil {
+		return nil, err
+	}
+	return arith(e.Op, l.(int64), r.(int64))
+}
+
+// arith returns the result of the arithmetic operation, checking the overflow.
+func arith(op string, a, b int64) (interface{}, error) {
+	switch op {
+	case "+":
+		r := a + b
+		if (a > 0 && b > 0 && r < 0) || (a < 0 && b < 0 && r >= 0) {
+			return nil, ErrOutOfRange
+		}
+		return r, nil
+	case "-":
+		r := a - b
+		if (a >= 0 && b < 0 && r < 0) || (a < 0 && b > 0 && r >= 0) {
+			return nil, ErrOutOfRange
+		}
+		return r, nil
+	case "*":
+		if a == 0 || b == 0 {
+			return int64(0), nil
+		}
+		r := a * b
+		if r/b != a || (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+			return nil, ErrOutOfRange
+		}
+		return r, nil
+	case "/":
+		if b == 0 {
+			return nil, ErrDivisionByZero
+		}
+		if a == math.MinInt64 && b == -1 {
+			return nil, ErrOutOfRange
+		}
+		return a / b, nil
+	case "%":
+		if b == 0 {
+			return nil, ErrDivisionByZero
+		}
+		if b == -1 {
+			return int64(0), nil
+		}
+		return a % b, nil
+	}
+	return nil, errfmt.Wrap(ErrNotSupportedExpr, op)
+}
+
+// evalPair evaluates the operands of the binary operator.
+func evalPair(env *Env, row []interface{}, left, right Expr) (interface{}, interface{}, error) {
+	l, err := left.Eval(env, row)
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := right.Eval(env, row)
+	if err != nil {
+		return nil, nil, err
+	}
+	return l, r, nil
+}
+
+// Eval returns the negated value.
+func (e *Neg) Eval(env *Env, row []interface{}) (interface{}, error) {
+	v, err := e.Expr.Eval(env, row)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	return arith("-", 0, v.(int64))
+}
+
+// Eval returns the result of the comparison.
+func (e *Comparison) Eval(env *Env, row []interface{}) (interface{}, error) {
+	l, r, err := evalPair(env, row, e.Left, e.Right)
+	if err != nil || l == nil || r == nil {
+		return nil, err
+	}
+	c, err := Compare(l, r)
+	if err != nil {
+		return nil, err
+	}
+	switch e.Op {
+	case "=":
+		return c == 0, nil
+	case "<>":
+		return c != 0, nil
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	case ">=":
+		return c >= 0, nil
+	}
+	return nil, errfmt.Wrap(ErrNotSupportedExpr, e.Op)
+}
+
+// Eval returns the concatenated string.
+func (e *Concat) Eval(env *Env, row []interface{}) (interface{}, error) {
+	l, r, err := evalPair(env, row, e.Left, e.Right)
+	if err != nil || l == nil || r == nil {
+		return nil, err
+	}
+	return l.(string) + r.(string), nil
+}
+
+// Eval returns the result of AND or OR in the three valued logic.
+// The right operand is not evaluated if the left operand decides the result.
+func (e *Logical) Eval(env *Env, row []interface{}) (interface{}, error) {
+	// decisive is the value that decides the result: FALSE for AND, TRUE for OR.
+	decisive := e.Op == "OR"
+	l, err := e.Left.Eval(env, row)
+	if err != nil {
+		return nil, err
+	}
+	if l == decisive {
+		return decisive, nil
+	}
+	r, err := e.Right.Eval(env, row)
+	if err != nil {
+		return nil, err
+	}
+	if r == decisive {
+		return decisive, nil
+	}
+	if l == nil || r == nil {
+		return nil, nil
+	}
+	return !decisive, nil
+}
+
+// Eval returns the negated bool.
+func (e *Not) Eval(env *Env, row []interface{}) (interface{}, error) {
+	v, err := e.Expr.Eval(env, row)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	return !v.(bool), nil
+}
+
+// Eval returns whether the value is NULL.
+func (e *IsNull) Eval(env *Env, row []interface{}) (interface{}, error) {
+	v, err := e.Expr.Eval(env, row)
+	if err != nil {
+		return nil, err
+	}
+	return (v == nil) != e.Not, nil
+}
+
+// Eval returns whether the string matches the pattern.
+func (e *Like) Eval(env *Env, row []interface{}) (interface{}, error) {
+	v, p, err := evalPair(env, row, e.Expr, e.Pattern)
+	if err != nil || v == nil || p == nil {
+		return nil, err
+	}
+	escape := '\\'
+	if e.Escape != nil {
+		esc, err := e.Escape.Eval(env, row)
+		if err != nil || esc == nil {
+			return nil, err
+		}
+		if escape, err = escapeRune(esc.(string)); err != nil {
+			return nil, err
+		}
+	}
+	matched, err := matchLike(v.(string), p.(string), escape, e.CaseInsensitive)
+	if err != nil {
+		return nil, err
+	}
+	return matched != e.Not, nil
+}
+
+// Eval returns whether the value is in the list, in the three valued logic:
+// if the value is not found and the list has NULL, the result is NULL.
+func (e *In) Eval(env *Env, row []interface{}) (interface{}, error) {
+	v, err := e.Expr.Eval(env, row)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	hasNull := false
+	for _, item := range e.List {
+		iv, err := item.Eval(env, row)
+		if err != nil {
+			return nil, err
+		}
+		if iv == nil {
+			hasNull = true
+			continue
+		}
+		c, err := Compare(v, iv)
+		if err != nil {
+			return nil, err
+		}
+		if c == 0 {
+			return !e.Not, nil
+		}
+	}
+	if hasNull {
+		return nil, nil
+	}
+	return e.Not, nil
+}
+
+// Eval returns whether low <= value AND value <= high, in the three valued logic.
+func (e *Between) Eval(env *Env, row []interface{}) (interface{}, error) {
+	v, err := e.Expr.Eval(env, row)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	ge, err := compareWith(env, row, v, e.Low, func(c int) bool { return c >= 0 })
+	if err != nil {
+		return nil, err
+	}
+	le, err := compareWith(env, row, v, e.High, func(c int) bool { return c <= 0 })
+	if err != nil {
+		return nil, err
+	}
+
+	var result interface{}
+	switch {
+	case ge == false || le == false:
+		result = false
+	case ge == nil || le == nil:
+		return nil, nil
+	default:
+		result = true
+	}
+	return result != e.Not, nil
+}
+
+// compareWith compares v with the value of e, and returns the result of
+// pred, or nil if the value of e is NULL.
+func compareWith(env *Env, row []interface{}, v interface{}, e Expr, pred func(c int) bool) (interface{}, error) {
+	other, err := e.Eval(env, row)
+	if err != nil || other == nil {
+		return nil, err
+	}
+	c, err := Compare(v, other)
+	if err != nil {
+		return nil, err
+	}
+	return pred(c), nil
+}
+
+// Eval returns the result of the first matching WHEN, or ELSE.
+func (e *Case) Eval(env *Env, row []interface{}) (interface{}, error) {
+	var operand interface{}
+	if e.Operand != nil {
+		var err error
+		if operand, err = e.Operand.Eval(env, row); err != nil {
+			return nil, err
+		}
+	}
+	for _, w := range e.Whens {
+		matched, err := e.match(env, row, operand, w.Cond)
+		if err != nil {
+			return nil, err
+		}
+		if matched {
+			return w.Result.Eval(env, row)
+		}
+	}
+	if e.Else == nil {
+		return nil, nil
+	}
+	return e.Else.Eval(env, row)
+}
+
+// match returns whether the WHEN clause matches.
+func (e *Case) match(env *Env, row []interface{}, operand interface{}, cond Expr) (bool, error) {
+	v, err := cond.Eval(env, row)
+	if err != nil || v == nil {
+		return false, err
+	}
+	if e.Operand == nil {
+		return v.(bool), nil
+	}
+	if operand == nil {
+		return false, nil
+	}
+	c, err := Compare(operand, v)
+	return c == 0, err
+}
+
+// Eval returns the converted value.
+func (e *Cast) Eval(env *Env, row []interface{}) (interface{}, error) {
+	v, err := e.Expr.Eval(env, row)
+	if err != nil {
+		return nil, err
+	}
+	return Convert(v, e.To)
+}
+
+// Eval calls the function with the values of the arguments.
+func (e *Call) Eval(env *Env, row []interface{}) (interface{}, error) {
+	args := make([]interface{}, len(e.Args))
+	for i, a := range e.Args {
+		v, err := a.Eval(env, row)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	return e.Fn(args)
+}
+
+// String returns the expression in SQL like text.
+func (e *Const) String() string {
+	switch v := e.Value.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case bool:
+		return strings.ToUpper(strconv.FormatBool(v))
+	}
+	return fmt.Sprint(e.Value)
+}
+
+// String returns the expression in SQL like text.
+func (e *Column) String() string { return e.Name }
+
+// String returns the expression in SQL like text.
+func (e *Param) String() string { return "$" + strconv.Itoa(e.Index+1) }
+
+// String returns the expression in SQL like text.
+func (e *Arith) String() string { return binaryString(e.Left, e.Op, e.Right) }
+
+// String returns the expression in SQL like text.
+func (e *Neg) String() string { return "-" + e.Expr.String() }
+
+// String returns the expression in SQL like text.
+func (e *Comparison) String() string { return binaryString(e.Left, e.Op, e.Right) }
+
+// String returns the expression in SQL like text.
+func (e *Concat) String() string { return binaryString(e.Left, "||", e.Right) }
+
+// String returns the expression in SQL like text.
+func (e *Logical) String() string { return binaryString(e.Left, e.Op, e.Right) }
+
+// String returns the expression in SQL like text.
+func (e *Not) String() string { return "NOT " + e.Expr.String() }
+
+// String returns the expression in SQL like text.
+func (e *IsNull) String() string {
+	if e.Not {
+		return e.Expr.String() + " IS NOT NULL"
+	}
+	return e.Expr.String() + " IS NULL"
+}
+
+// String returns the expression in SQL like text.
+func (e *Like) String() string {
+	op := "LIKE"
+	if e.CaseInsensitive {
+		op = "ILIKE"
+	}
+	if e.Not {
+		op = "NOT " + op
+	}
+	if e.Escape == nil {
+		return binaryString(e.Expr, op, e.Pattern)
+	}
+	return "(" + e.Expr.String() + " " + op + " " + e.Pattern.String() + " ESCAPE " + e.Escape.String() + ")"
+}
+
+// String returns the expression in SQL like text.
+func (e *In) String() string {
+	op := " IN ("
+	if e.Not {
+		op = " NOT IN ("
+	}
+	return e.Expr.String() + op + joinExprs(e.List) + ")"
+}
+
+// String returns the expression in SQL like text.
+func (e *Between) String() string {
+	op := " BETWEEN "
+	if e.Not {
+		op = " NOT BETWEEN "
+	}
+	return e.Expr.String() + op + e.Low.String() + " AND " + e.High.String()
+}
+
+// String returns the expression in SQL like text.
+func (e *Case) String() string {
+	var b strings.Builder
+	b.WriteString("CASE")
+	if e.Operand != nil {
+		b.WriteString(" " + e.Operand.String())
+	}
+	for _, w := range e.Whens {
+		b.WriteString(" WHEN " + w.Cond.String() + " THEN " + w.Result.String())
+	}
+	if e.Else != nil {
+		b.WriteString(" ELSE " + e.Else.String())
+	}
+	b.WriteString(" END")
+	return b.String()
+}
+
+// String returns the expression in SQL like text.
+func (e *Cast) String() string {
+	return "CAST(" + e.Expr.String() + " AS " + e.To.String() + ")"
+}
+
+// String returns the expression in SQL like text.
+func (e *Call) String() string {
+	return e.Name + "(" + joinExprs(e.Args) + ")"
+}
+
+// binaryString returns the text of the binary operation in parentheses.
+func binaryString(left Expr, op string, right Expr) string {
+	return "(" + left.String() + " " + op + " " + right.String() + ")"
+}
+
+// joinExprs returns the comma separated text of the expressions.
+func joinExprs(exprs []Expr) string {
+	s := make([]string, len(exprs))
+	for i, e := range exprs {
+		s[i] = e.String()
+	}
+	return strings.Join(s, ", ")
+}
@@ -0,0 +1,138 @@
+package expr
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nao1215/egsql/dbms/meta"
+	"github.com/nao1215/egsql/dbms/query"
+)
+
+// testColumns is the scope of the tests: id INT, name VARCHAR, note VARCHAR.
+var testColumns = Columns{
+	{Table: "t", Name: "id", T: Int},
+	{Table: "t", Name: "name", T: Varchar},
+	{Table: "t", Name: "note", T: Varchar},
+}
+
+// parseExpr parses the expression in the select list.
+func parseExpr(t *testing.T, s string) query.Expr {
+	t.Helper()
+
+	stmt, _, err := query.Parse("SELECT " + s)
+	if err != nil {
+		t.Fatalf("Parse(%q) error = %v", s, err)
+	}
+	return stmt.(*query.SelectStmt).Items[0].Expr
+}
+
+func TestExpr_Eval(t *testing.T) {
+	row := []interface{}{int64(10), "Alice", nil}
+	tests := []struct {
+		name     string
+		expr     string
+		args     []interface{}
+		want     interface{}
+		wantType Type
+		wantErr  error
+	}{
+		{name: "[Success] arithmetic precedence", expr: "1 + id * 2 - 7 % 4", want: int64(18), wantType: Int},
+		{name: "[Success] division truncates", expr: "-7 / 2", want: int64(-3), wantType: Int},
+		{name: "[Success] string literal converted to int", expr: "id + '5'", want: int64(15), wantType: Int},
+		{name: "[Success] arithmetic with null", expr: "id + NULL", want: nil, wantType: Int},
+		{name: "[Success] comparison", expr: "id >= 10 AND name <> 'Bob'", want: true, wantType: Bool},
+		{name: "[Success] comparison with string literal", expr: "id = '10'", want: true, wantType: Bool},
+		{name: "[Success] comparison with null", expr: "note = 'x'", want: nil, wantType: Bool},
+		{name: "[Success] null and false", expr: "note = 'x' AND FALSE", want: false, wantType: Bool},
+		{name: "[Success] null or true", expr: "note = 'x' OR TRUE", want: true, wantType: Bool},
+		{name: "[Success] not null", expr: "NOT note = 'x'", want: nil, wantType: Bool},
+		{name: "[Success] is null", expr: "note IS NULL AND name IS NOT NULL", want: true, wantType: Bool},
+		{name: "[Success] like", expr: "name LIKE 'A_i%'", want: true, wantType: Bool},
+		{name: "[Success] like is case sensitive", expr: "name LIKE 'a%'", want: false, wantType: Bool},
+		{name: "[Success] ilike", expr: "name ILIKE 'a%E'", want: true, wantType: Bool},
+		{name: "[Success] like with escape", expr: "'100%' LIKE '100!%' ESCAPE '!'", want: true, wantType: Bool},
+		{name: "[Success] like with default escape", expr: `'a_c' NOT LIKE 'a\_c'`, want: false, wantType: Bool},
+		{name: "[Success] in", expr: "id IN (1, 10, NULL)", want: true, wantType: Bool},
+		{name: "[Success] not in with null", expr: "id NOT IN (1, NULL)", want: nil, wantType: Bool},
+		{name: "[Success] between", expr: "id BETWEEN 1 AND 10", want: true, wantType: Bool},
+		{name: "[Success] not between", expr: "name NOT BETWEEN 'B' AND 'C'", want: true, wantType: Bool},
+		{name: "[Success] searched case", expr: "CASE WHEN id < 5 THEN 'small' WHEN id < 50 THEN 'medium' END", want: "medium", wantType: Varchar},
+		{name: "[Success] simple case without match", expr: "CASE id WHEN 1 THEN 'one' END", want: nil, wantType: Varchar},
+		{name: "[Success] cast", expr: "CAST('12' AS INT) = 12 AND CAST(note AS INT) IS NULL", want: true, wantType: Bool},
+		{name: "[Success] cast int to text", expr: "CAST(id AS TEXT)", want: "10", wantType: Varchar},
+		{name: "[Success] concatenation", expr: "name || '-' || id", want: "Alice-10", wantType: Varchar},
+		{name: "[Success] concatenation with null", expr: "name || note", want: nil, wantType: Varchar},
+		{name: "[Success] placeholder takes the type of the context", expr: "id = ?", args: []interface{}{"10"}, want: true, wantType: Bool},
+		{name: "[Error] type mismatch", expr: "id = name", wantErr: ErrTypeMismatch},
+		{name: "[Error] invalid integer literal", expr: "id = 'abc'", wantErr: ErrInvalidCast},
+		{name: "[Error] not bool operand", expr: "id AND TRUE", wantErr: ErrTypeMismatch},
+		{name: "[Error] like with int", expr: "id LIKE '1%'", wantErr: ErrTypeMismatch},
+		{name: "[Error] case results of different types", expr: "CASE WHEN TRUE THEN id ELSE name END", wantErr: ErrTypeMismatch},
+		{name: "[Error] invalid escape", expr: "name LIKE 'a' ESCAPE 'ab'", wantErr: ErrInvalidEscape},
+		{name: "[Error] not exist column", expr: "t.age", wantErr: meta.ErrNotExistColumn},
+		{name: "[Error] not supported function", expr: "lower(name)", wantErr: ErrNotSupportedFunction},
+		{name: "[Error] division by zero", expr: "id / (id - 10)", wantErr: ErrDivisionByZero},
+		{name: "[Error] overflow", expr: "9223372036854775807 + id", wantErr: ErrOutOfRange},
+		{name: "[Error] invalid cast", expr: "CAST(name AS INT)", wantErr: ErrInvalidCast},
+		{name: "[Error] missing argument", expr: "id = ?", wantErr: ErrNotMatchArgNum},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &Binder{Scope: testColumns}
+			e, err := b.Bind(parseExpr(t, tt.expr))
+			var got interface{}
+			if err == nil {
+				if tt.wantErr == nil && e.Type() != tt.wantType {
+					t.Errorf("Type() = %v, want %v", e.Type(), tt.wantType)
+				}
+				got, err = e.Eval(&Env{Args: tt.args}, row)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Bind() or Eval() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Eval() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestColumns_Lookup(t *testing.T) {
+	cs := Columns{
+		{Table: "a", Name: "id", T: Int},
+		{Table: "b", Name: "id", T: Varchar},
+	}
+	if _, _, err := cs.Lookup("", "id"); !errors.Is(err, ErrAmbiguousColumn) {
+		t.Errorf("Lookup() error = %v, want %v", err, ErrAmbiguousColumn)
+	}
+	i, typ, err := cs.Lookup("b", "id")
+	if err != nil || i != 1 || typ != Varchar {
+		t.Errorf("Lookup() = %d, %v, %v, want 1, varchar, nil", i, typ, err)
+	}
+}
+
+func TestMatchLike(t *testing.T) {
+	tests := []struct {
+		s       string
+		pattern string
+		want    bool
+	}{
+		{s: "", pattern: "%", want: true},
+		{s: "abc", pattern: "a%c", want: true},
+		{s: "abcbc", pattern: "%bc", want: true},
+		{s: "abc", pattern: "a_", want: false},
+		{s: "日本語", pattern: "_本_", want: true},
+		{s: "a%", pattern: `a\%`, want: true},
+		{s: "ab", pattern: `a\%`, want: false},
+	}
+	for _, tt := range tests {
+		got, err := matchLike(tt.s, tt.pattern, '\\', false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("matchLike(%q, %q) = %v, want %v", tt.s, tt.pattern, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package expr
+
+import (
+	"reflect"
+
+	"github.com/nao1215/egsql/dbms/query"
+	"github.com/nao1215/egsql/misc/errfmt"
+)
+
+// Grouping binds the expressions evaluated after the rows are grouped,
+// i.e. the select list and HAVING clause of the query with GROUP BY clause
+// or aggregate functions.
+//
+// The grouped row is the values of Keys followed by the results of
+// Aggregates. The expression bound by Grouping can reference a column
+// only if it is a key, and can call the aggregate functions whose
+// arguments reference any column of the input rows.
+type Grouping struct {
+	// Keys is the expressions of GROUP BY clause bound to the input rows.
+	Keys []Expr
+	// Aggregates is the aggregate functions called in the bound expressions.
+	Aggregates []*Aggregate
+
+	input    *Binder
+	keyExprs []query.Expr
+	// aggCalls is the calls of Aggregates, so that the same call in the select
+	// list and HAVING clause is computed once.
+	aggCalls []*query.FuncCall
+}
+
+// NewGrouping binds GROUP BY expressions with input, which binds the
+// expressions to the input rows.
+func NewGrouping(input *Binder, groupBy []query.Expr) (*Grouping, error) {
+	g := &Grouping{input: input, keyExprs: groupBy}
+	for _, e := range groupBy {
+		if input.HasAggregate(e) {
+			return nil, errfmt.Wrap(ErrMisplacedAggregate, "in GROUP BY clause")
+		}
+		key, err := input.Bind(e)
+		if err != nil {
+			return nil, err
+		}
+		g.Keys = append(g.Keys, key)
+	}
+	return g, nil
+}
+
+// Binder returns the binder of the expressions evaluated for the grouped rows.
+func (g *Grouping) Binder() *Binder {
+	in := g.input
+	return &Binder{
+		Scope: groupedScope{g}, Outer: in.Outer, Funcs: in.Funcs, Aggregates: in.Aggregates,
+		Subquery: in.Subquery, Correlated: in.Correlated, substitute: g.substitute,
+	}
+}
+
+// substitute returns the reference to the key if the expression is the same
+// as a GROUP BY expression, or the reference to the result of the aggregate
+// function if it is an aggregate function call.
+func (g *Grouping) substitute(e query.Expr) (Expr, error) {
+	for i, k := range g.keyExprs {
+		if reflect.DeepEqual(k, e) {
+			return &Column{Index: i, Name: g.Keys[i].String(), T: g.Keys[i].Type()}, nil
+		}
+	}
+	call, ok := e.(*query.FuncCall)
+	if !ok || !g.input.IsAggregate(call.Name) || call.Over != nil {
+		return nil, nil
+	}
+	for i, c := range g.aggCalls {
+		if reflect.DeepEqual(c, call) {
+			return g.aggregateColumn(i), nil
+		}
+	}
+	args := make([]Expr, len(call.Args))
+	for i, arg := range call.Args {
+		// The input binder rejects the nested aggregate function.
+		var err error
+		if args[i], err = g.input.Bind(arg); err != nil {
+			return nil, err
+		}
+	}
+	agg, err := g.input.newAggregate(call.Name, args, call.Star, call.Distinct)
+	if err != nil {
+		return nil, err
+	}
+	g.Aggregates = append(g.Aggregates, agg)
+	g.aggCalls = append(g.aggCalls, call)
+	return g.aggregateColumn(len(g.Aggregates) - 1), nil
+}
+
+// aggregateColumn returns the reference to the result of the i-th aggregate function.
+func (g *Grouping) aggregateColumn(i int) *Column {
+	agg := g.Aggregates[i]
+	return &Column{Index: len(g.Keys) + i, Name: agg.String(), T: agg.T}
+}
+
+// groupedScope resolves the column references to the keys of the grouped rows.
+type groupedScope struct {
+	g *Grouping
+}
+
+// Lookup returns the position of the key that is the column.
+func (s groupedScope) Lookup(table, name string) (int, Type, error) {
+	i, t, err := s.g.input.Scope.Lookup(table, name)
+	if err != nil {
+		return 0, Unknown, err
+	}
+	for k, key := range s.g.Keys {
+		if c, ok := key.(*Column); ok && c.Index == i {
+			return k, t, nil
+		}
+	}
+	return 0, Unknown, errfmt.Wrap(ErrNotGrouped, qualify(table, name))
+}
+
+// IsAggregate reports whether the function is a built-in aggregate function
+// or one of b.Aggregates.
+func (b *Binder) IsAggregate(name string) bool {
+	return IsAggregate(name) || (b.Aggregates != nil && b.Aggregates.IsAggregate(name))
+}
+
+// newAggregate returns the call of the built-in aggregate function or one of
+// b.Aggregates.
+func (b *Binder) newAggregate(name string, args []Expr, star, distinct bool) (*Aggregate, error) {
+	if IsAggregate(name) || b.Aggregates == nil {
+		return NewAggregate(name, args, star, distinct)
+	}
+	if star {
+		return nil, errfmt.Wrap(ErrWrongNumberOfArgs, name+"(*) is not allowed")
+	}
+	return b.Aggregates.NewAggregate(name, args, distinct)
+}
+
+// HasAggregate reports whether the expression calls an aggregate function.
+// The aggregate function called as a window function is not counted, but
+// its arguments are searched.
+func (b *Binder) HasAggregate(e query.Expr) bool {
+	found := false
+	query.Walk(e, func(e query.Expr) bool {
+		if call, ok := e.(*query.FuncCall); ok && b.IsAggregate(call.Name) && call.Over == nil {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
@@ -0,0 +1,96 @@
+package expr
+
+import (
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/nao1215/egsql/misc/errfmt"
+)
+
+// likeToken is an element of the LIKE pattern.
+type likeToken struct {
+	// wildcard is '%', '_' or 0 for the literal character r.
+	wildcard rune
+	r        rune
+}
+
+// escapeRune returns the escape character of ESCAPE clause. The empty string
+// means that no escape character is used, and it is returned as -1.
+func escapeRune(s string) (rune, error) {
+	if s == "" {
+		return -1, nil
+	}
+	if utf8.RuneCountInString(s) != 1 {
+		return 0, errfmt.Wrap(ErrInvalidEscape, "escape string must be one character")
+	}
+	r, _ := utf8.DecodeRuneInString(s)
+	return r, nil
+}
+
+// parseLike splits the LIKE pattern into the tokens.
+func parseLike(pattern string, escape rune) ([]likeToken, error) {
+	var tokens []likeToken
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			tokens = append(tokens, likeToken{r: r})
+			escaped = false
+		case r == escape:
+			escaped = true
+		case r == '%' || r == '_':
+			tokens = append(tokens, likeToken{wildcard: r})
+		default:
+			tokens = append(tokens, likeToken{r: r})
+		}
+	}
+	if escaped {
+		return nil, errfmt.Wrap(ErrInvalidEscape, "LIKE pattern must not end with escape character")
+	}
+	return tokens, nil
+}
+
+// matchLike reports whether s matches the LIKE pattern. If caseInsensitive
+// is true, the characters are compared ignoring case (ILIKE).
+//
+// It is the greedy matching that backtracks to the last '%', so it runs in
+// O(len(s) * len(pattern)) at worst.
+func matchLike(s, pattern string, escape rune, caseInsensitive bool) (bool, error) {
+	tokens, err := parseLike(pattern, escape)
+	if err != nil {
+		return false, err
+	}
+	text := []rune(s)
+	equal := func(a, b rune) bool {
+		if caseInsensitive {
+			return unicode.ToLower(a) == unicode.ToLower(b)
+		}
+		return a == b
+	}
+
+	ti, pi := 0, 0
+	// star is the position of the last '%' in tokens, and starText is
+	// the position in text that it is tried to match from.
+	star, starText := -1, 0
+	for ti < len(text) {
+		switch {
+		case pi < len(tokens) && tokens[pi].wildcard == '%':
+			star, starText = pi, ti
+			pi++
+		case pi < len(tokens) && (tokens[pi].wildcard == '_' ||
+			tokens[pi].wildcard == 0 && equal(tokens[pi].r, text[ti])):
+			ti++
+			pi++
+		case star >= 0:
+			// '%' matches one more character.
+			starText++
+			ti, pi = starText, star+1
+		default:
+			return false, nil
+		}
+	}
+	for pi < len(tokens) && tokens[pi].wildcard == '%' {
+		pi++
+	}
+	return pi == len(tokens), nil
+}
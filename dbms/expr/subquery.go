@@ -0,0 +1,206 @@
+package expr
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/nao1215/egsql/dbms/meta"
+	"github.com/nao1215/egsql/dbms/query"
+	"github.com/nao1215/egsql/misc/errfmt"
+)
+
+// Query is the plan of a subquery. The correlated subquery references the
+// columns of the row of the outer query by OuterColumn.
+type Query interface {
+	// Rows returns at most limit rows of the subquery evaluated for the row of
+	// the outer query. If limit is negative, all rows are returned.
+	Rows(env *Env, row []interface{}, limit int) ([][]interface{}, error)
+}
+
+// SubqueryPlanner plans the subquery in the expression bound by outer.
+// It returns the plan and the types of the columns of the subquery.
+type SubqueryPlanner func(stmt *query.SelectStmt, outer *Binder) (Query, []Type, error)
+
+// OuterColumn is a reference to the column of the outer query in a correlated
+// subquery. Its value is in Env.Outer.
+type OuterColumn struct {
+	// Level is the number of the queries from the subquery to the query of
+	// the column. 1 is the query that the subquery is in.
+	Level int
+	// Index is the position of the value in the row of the outer query.
+	Index int
+	Name  string
+	T     Type
+}
+
+// ScalarSubquery is the subquery of one column used as a value. Its value is
+// the value of the only row, or NULL if there is no row.
+type ScalarSubquery struct {
+	Query Query
+	T     Type
+}
+
+// Exists is EXISTS (subquery).
+type Exists struct {
+	Query Query
+}
+
+// InSubquery is [NOT] IN (subquery) of one column.
+type InSubquery struct {
+	Expr  Expr
+	Query Query
+	Not   bool
+}
+
+// Type returns the data type of the value.
+func (e *OuterColumn) Type() Type { return e.T }
+
+// Type returns the data type of the value.
+func (e *ScalarSubquery) Type() Type { return e.T }
+
+// Type returns the data type of the value.
+func (e *Exists) Type() Type { return Bool }
+
+// Type returns the data type of the value.
+func (e *InSubquery) Type() Type { return Bool }
+
+// Eval returns the value in the row of the outer query.
+func (e *OuterColumn) Eval(env *Env, row []interface{}) (interface{}, error) {
+	return env.Outer[e.Level-1][e.Index], nil
+}
+
+// Eval returns the value of the only row of the subquery.
+func (e *ScalarSubquery) Eval(env *Env, row []interface{}) (interface{}, error) {
+	rows, err := e.Query.Rows(env, row, 2)
+	if err != nil {
+		return nil, err
+	}
+	switch len(rows) {
+	case 0:
+		return nil, nil
+	case 1:
+		return rows[0][0], nil
+	}
+	return nil, ErrSubqueryRows
+}
+
+// Eval returns whether the subquery returns any row.
+func (e *Exists) Eval(env *Env, row []interface{}) (interface{}, error) {
+	rows, err := e.Query.Rows(env, row, 1)
+	if err != nil {
+		return nil, err
+	}
+	return len(rows) > 0, nil
+}
+
+// Eval returns whether the value is in the rows of the subquery, in the
+// three valued logic as In.
+func (e *InSubquery) Eval(env *Env, row []interface{}) (interface{}, error) {
+	v, err := e.Expr.Eval(env, row)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := e.Query.Rows(env, row, -1)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return e.Not, nil
+	}
+	if v == nil {
+		return nil, nil
+	}
+	hasNull := false
+	for _, r := range rows {
+		if r[0] == nil {
+			hasNull = true
+			continue
+		}
+		c, err := Compare(v, r[0])
+		if err != nil {
+			return nil, err
+		}
+		if c == 0 {
+			return !e.Not, nil
+		}
+	}
+	if hasNull {
+		return nil, nil
+	}
+	return e.Not, nil
+}
+
+// String returns the expression in SQL like text.
+func (e *OuterColumn) String() string { return e.Name }
+
+// String returns the expression in SQL like text.
+func (e *ScalarSubquery) String() string { return "(SELECT ...)" }
+
+// String returns the expression in SQL like text.
+func (e *Exists) String() string { return "EXISTS (SELECT ...)" }
+
+// String returns the expression in SQL like text.
+func (e *InSubquery) String() string {
+	op := " IN "
+	if e.Not {
+		op = " NOT IN "
+	}
+	return e.Expr.String() + op + "(SELECT ...)"
+}
+
+// bindSubquery plans the subquery whose columns must be n, and returns the
+// plan and the types of the columns.
+func (b *Binder) bindSubquery(stmt *query.SelectStmt, n int) (Query, []Type, error) {
+	if b.Subquery == nil {
+		return nil, nil, errfmt.Wrap(ErrNotSupportedExpr, "subquery")
+	}
+	q, types, err := b.Subquery(stmt, b)
+	if err != nil {
+		return nil, nil, err
+	}
+	if n > 0 && len(types) != n {
+		return nil, nil, errfmt.Wrap(ErrSubqueryColumns, "subquery returns "+strconv.Itoa(len(types))+" columns")
+	}
+	return q, types, nil
+}
+
+// bindInSubquery binds expr [NOT] IN (subquery). The value is converted to
+// the type of the column of the subquery.
+func (b *Binder) bindInSubquery(e *query.InExpr) (Expr, error) {
+	operand, err := b.Bind(e.Expr)
+	if err != nil {
+		return nil, err
+	}
+	q, types, err := b.bindSubquery(e.Select, 1)
+	if err != nil {
+		return nil, err
+	}
+	if operand, err = Coerce(operand, types[0]); err != nil {
+		return nil, err
+	}
+	return &InSubquery{Expr: operand, Query: q, Not: e.Not}, nil
+}
+
+// lookupOuter binds the reference to the column of the outer queries. The
+// subqueries between the column and the reference are marked as correlated.
+func (b *Binder) lookupOuter(ref *query.ColumnRef) (Expr, error) {
+	correlated := []*bool{b.Correlated}
+	for level, o := 1, b.Outer; o != nil; level, o = level+1, o.Outer {
+		if o.Scope != nil {
+			i, t, err := o.Scope.Lookup(ref.Table, ref.Name)
+			if err == nil {
+				for _, c := range correlated {
+					if c != nil {
+						*c = true
+					}
+				}
+				return &OuterColumn{Level: level, Index: i, Name: qualify(ref.Table, ref.Name), T: t}, nil
+			}
+			if !errors.Is(err, meta.ErrNotExistColumn) {
+				return nil, err
+			}
+		}
+		correlated = append(correlated, o.Correlated)
+	}
+	return nil, errfmt.Wrap(meta.ErrNotExistColumn, qualify(ref.Table, ref.Name))
+}
@@ -0,0 +1,163 @@
+package expr
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/nao1215/egsql/dbms/meta"
+	"github.com/nao1215/egsql/misc/errfmt"
+)
+
+// Type is the data type of the expression. It is Enum.
+type Type uint8
+
+const (
+	// Unknown is the type of NULL and the placeholder that are not bound
+	// to the context yet. The value of Unknown expression is any type.
+	Unknown Type = iota
+	// Int is an Integer type. The value is int64.
+	Int
+	// Varchar is a variable-length string type. The value is string.
+	Varchar
+	// Bool is a boolean type. The value is bool.
+	Bool
+)
+
+// TypeOf returns the type of the value of the column data type.
+func TypeOf(d meta.DataType) Type {
+	switch d {
+	case meta.Int:
+		return Int
+	case meta.Varchar:
+		return Varchar
+	default:
+		return Unknown
+	}
+}
+
+// String is stringer for Type.
+func (t Type) String() string {
+	switch t {
+	case Int:
+		return "int"
+	case Varchar:
+		return "varchar"
+	case Bool:
+		return "bool"
+	default:
+		return "unknown"
+	}
+}
+
+// Convert converts the value to the type. NULL is NULL in any type.
+// It is the conversion of CAST and the implicit conversion.
+func Convert(v interface{}, t Type) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	switch t {
+	case Int:
+		switch x := v.(type) {
+		case int64:
+			return x, nil
+		case string:
+			i, err := strconv.ParseInt(strings.TrimSpace(x), 10, 64)
+			if err != nil {
+				return nil, errfmt.Wrap(ErrInvalidCast, "invalid input for int: '"+x+"'")
+			}
+			return i, nil
+		case bool:
+			if x {
+				return int64(1), nil
+			}
+			return int64(0), nil
+		}
+	case Varchar:
+		switch x := v.(type) {
+		case int64:
+			return strconv.FormatInt(x, 10), nil
+		case string:
+			return x, nil
+		case bool:
+			return strconv.FormatBool(x), nil
+		}
+	case Bool:
+		switch x := v.(type) {
+		case int64:
+			return x != 0, nil
+		case string:
+			switch strings.ToLower(strings.TrimSpace(x)) {
+			case "true", "t", "yes", "y", "on", "1":
+				return true, nil
+			case "false", "f", "no", "n", "off", "0":
+				return false, nil
+			}
+			return nil, errfmt.Wrap(ErrInvalidCast, "invalid input for bool: '"+x+"'")
+		case bool:
+			return x, nil
+		}
+	case Unknown:
+		return v, nil
+	}
+	return nil, errfmt.Wrap(ErrInvalidCast, "unsupported value")
+}
+
+// typeOfValue returns the type of the value.
+func typeOfValue(v interface{}) Type {
+	switch v.(type) {
+	case int64:
+		return Int
+	case string:
+		return Varchar
+	case bool:
+		return Bool
+	default:
+		return Unknown
+	}
+}
+
+// Compare compares the values that are not NULL, and returns -1, 0 or +1.
+// The values of different types are compared after converting the string to
+// the type of the other value, because only the values of Unknown expressions
+// (e.g. two placeholders) can have different types at this point.
+func Compare(a, b interface{}) (int, error) {
+	ta, tb := typeOfValue(a), typeOfValue(b)
+	if ta != tb {
+		var err error
+		switch {
+		case ta == Varchar:
+			a, err = Convert(a, tb)
+		case tb == Varchar:
+			b, err = Convert(b, ta)
+		default:
+			err = errfmt.Wrap(ErrTypeMismatch, ta.String()+" and "+tb.String())
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	switch x := a.(type) {
+	case int64:
+		y := b.(int64)
+		switch {
+		case x < y:
+			return -1, nil
+		case x > y:
+			return 1, nil
+		}
+		return 0, nil
+	case string:
+		return strings.Compare(x, b.(string)), nil
+	case bool:
+		y := b.(bool)
+		switch {
+		case x == y:
+			return 0, nil
+		case !x:
+			return -1, nil
+		}
+		return 1, nil
+	}
+	return 0, errfmt.Wrap(ErrTypeMismatch, "unsupported value")
+}
@@ -0,0 +1,98 @@
+package expr
+
+// Walk calls fn for the expression and its subexpressions in depth-first order.
+// If fn returns false, the subexpressions of the expression are not visited.
+func Walk(e Expr, fn func(Expr) bool) {
+	if e == nil || !fn(e) {
+		return
+	}
+	for _, c := range children(e) {
+		Walk(c, fn)
+	}
+}
+
+// children returns the direct subexpressions of the expression.
+// The nil subexpressions (e.g. CASE without ELSE) are not returned.
+func children(e Expr) []Expr {
+	var exprs []Expr
+	switch v := e.(type) {
+	case *Arith:
+		exprs = []Expr{v.Left, v.Right}
+	case *Neg:
+		exprs = []Expr{v.Expr}
+	case *Comparison:
+		exprs = []Expr{v.Left, v.Right}
+	case *Concat:
+		exprs = []Expr{v.Left, v.Right}
+	case *Logical:
+		exprs = []Expr{v.Left, v.Right}
+	case *Not:
+		exprs = []Expr{v.Expr}
+	case *IsNull:
+		exprs = []Expr{v.Expr}
+	case *Like:
+		exprs = []Expr{v.Expr, v.Pattern, v.Escape}
+	case *In:
+		exprs = append([]Expr{v.Expr}, v.List...)
+	case *Between:
+		exprs = []Expr{v.Expr, v.Low, v.High}
+	case *Case:
+		exprs = []Expr{v.Operand}
+		for _, w := range v.Whens {
+			exprs = append(exprs, w.Cond, w.Result)
+		}
+		exprs = append(exprs, v.Else)
+	case *Cast:
+		exprs = []Expr{v.Expr}
+	case *Call:
+		exprs = v.Args
+	case *InSubquery:
+		exprs = []Expr{v.Expr}
+	}
+
+	result := exprs[:0:0]
+	for _, c := range exprs {
+		if c != nil {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// Conjuncts returns the operands of the top-level ANDs of the condition.
+// The condition is TRUE if all of them are TRUE.
+func Conjuncts(cond Expr) []Expr {
+	if l, ok := cond.(*Logical); ok && l.Op == "AND" {
+		return append(Conjuncts(l.Left), Conjuncts(l.Right)...)
+	}
+	if cond == nil {
+		return nil
+	}
+	return []Expr{cond}
+}
+
+// And returns the condition that is TRUE if all conditions are TRUE,
+// or nil if there is no condition.
+func And(conds ...Expr) Expr {
+	var result Expr
+	for _, c := range conds {
+		if result == nil {
+			result = c
+			continue
+		}
+		result = &Logical{Op: "AND", Left: result, Right: c}
+	}
+	return result
+}
+
+// ColumnsOf returns the positions of the columns that the expression references.
+func ColumnsOf(e Expr) []int {
+	var positions []int
+	Walk(e, func(e Expr) bool {
+		if c, ok := e.(*Column); ok {
+			positions = append(positions, c.Index)
+		}
+		return true
+	})
+	return positions
+}
@@ -0,0 +1,277 @@
+package expr
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/nao1215/egsql/dbms/query"
+	"github.com/nao1215/egsql/misc/errfmt"
+)
+
+// WindowFunc is a call of the window function like RANK() OVER (ORDER BY x).
+// Like Aggregate, it is not an Expr because its value is computed from the
+// rows of the partition by the window operator.
+type WindowFunc struct {
+	// Name is function name in lower case.
+	Name string
+	// Args is the arguments evaluated for the rows of the partition.
+	Args []Expr
+	// PartitionBy is the expressions of PARTITION BY clause.
+	PartitionBy []Expr
+	// OrderBy is the sort keys of the rows in the partition.
+	OrderBy []SortExpr
+	// Frame is the rows of the partition that the aggregate function,
+	// FIRST_VALUE and LAST_VALUE are computed from.
+	Frame query.WindowFrame
+	// Aggregate is the aggregate function computed over the frame, or nil
+	// if the function is not an aggregate function.
+	Aggregate *Aggregate
+	// T is the data type of the result.
+	T Type
+}
+
+// SortExpr is a sort key of ORDER BY clause.
+type SortExpr struct {
+	Expr       Expr
+	Desc       bool
+	NullsFirst bool
+}
+
+// defaultFrame is the frame when the frame clause is not specified: the rows
+// from the first row of the partition to the last peer of the current row.
+var defaultFrame = query.WindowFrame{
+	Range: true,
+	Start: query.FrameBound{Type: query.UnboundedPreceding},
+	End:   query.FrameBound{Type: query.CurrentRow},
+}
+
+// windowFuncs is the number of the arguments of the window functions that
+// are not aggregate functions: the minimum and the maximum.
+var windowFuncs = map[string][2]int{
+	"row_number":  {0, 0},
+	"rank":        {0, 0},
+	"dense_rank":  {0, 0},
+	"lag":         {1, 3},
+	"lead":        {1, 3},
+	"first_value": {1, 1},
+	"last_value":  {1, 1},
+}
+
+// Window returns the window in SQL like text. The functions of the same
+// window are computed from the same sorted partitions.
+func (w *WindowFunc) Window() string {
+	var clauses []string
+	if len(w.PartitionBy) > 0 {
+		clauses = append(clauses, "PARTITION BY "+joinExprs(w.PartitionBy))
+	}
+	if len(w.OrderBy) > 0 {
+		items := make([]string, len(w.OrderBy))
+		for i, o := range w.OrderBy {
+			items[i] = o.Expr.String()
+			if o.Desc {
+				items[i] += " DESC"
+			}
+			if o.NullsFirst {
+				items[i] += " NULLS FIRST"
+			} else {
+				items[i] += " NULLS LAST"
+			}
+		}
+		clauses = append(clauses, "ORDER BY "+strings.Join(items, ", "))
+	}
+	return "(" + strings.Join(clauses, " ") + ")"
+}
+
+// String returns the call in SQL like text.
+func (w *WindowFunc) String() string {
+	if w.Aggregate != nil {
+		return w.Aggregate.String() + " OVER " + w.Window()
+	}
+	return w.Name + "(" + joinExprs(w.Args) + ") OVER " + w.Window()
+}
+
+// Windowing binds the expressions evaluated after the window functions are
+// computed, i.e. the select list and ORDER BY clause. The row is the input
+// row followed by the results of Funcs, and the window functions are bound
+// to the input rows.
+type Windowing struct {
+	// Funcs is the window functions called in the bound expressions.
+	Funcs []*WindowFunc
+
+	input *Binder
+	calls []*query.FuncCall
+	// refs is the references to the results of Funcs, whose positions are
+	// set by Resolve.
+	refs [][]*Column
+}
+
+// NewWindowing returns the Windowing of the input rows bound by input.
+func NewWindowing(input *Binder) *Windowing {
+	return &Windowing{input: input}
+}
+
+// Binder returns the binder of the expressions evaluated for the rows
+// followed by the results of the window functions.
+func (w *Windowing) Binder() *Binder {
+	in := w.input
+	return &Binder{
+		Scope: in.Scope, Outer: in.Outer, Funcs: in.Funcs, Aggregates: in.Aggregates,
+		Subquery: in.Subquery, Correlated: in.Correlated,
+		substitute: func(e query.Expr) (Expr, error) {
+			if bound, err := w.substitute(e); err != nil || bound != nil {
+				return bound, err
+			}
+			if in.substitute != nil {
+				return in.substitute(e)
+			}
+			return nil, nil
+		},
+	}
+}
+
+// Resolve sets the positions of the results of the window functions, which
+// follow the input row of width columns. It must be called after all
+// expressions are bound, because the grouped rows get wider as the aggregate
+// functions are bound.
+func (w *Windowing) Resolve(width int) {
+	for i, refs := range w.refs {
+		for _, ref := range refs {
+			ref.Index = width + i
+		}
+	}
+}
+
+// substitute returns the reference to the result of the window function if
+// the expression is a window function call.
+func (w *Windowing) substitute(e query.Expr) (Expr, error) {
+	call, ok := e.(*query.FuncCall)
+	if !ok || call.Over == nil {
+		return nil, nil
+	}
+	i := -1
+	for k, c := range w.calls {
+		if reflect.DeepEqual(c, call) {
+			i = k
+			break
+		}
+	}
+	if i < 0 {
+		fn, err := w.bindWindowFunc(call)
+		if err != nil {
+			return nil, err
+		}
+		w.Funcs = append(w.Funcs, fn)
+		w.calls = append(w.calls, call)
+		w.refs = append(w.refs, nil)
+		i = len(w.Funcs) - 1
+	}
+	fn := w.Funcs[i]
+	ref := &Column{Name: fn.String(), T: fn.T}
+	w.refs[i] = append(w.refs[i], ref)
+	return ref, nil
+}
+
+// bindWindowFunc binds the window function call to the input rows.
+func (w *Windowing) bindWindowFunc(call *query.FuncCall) (*WindowFunc, error) {
+	_, isWindow := windowFuncs[call.Name]
+	if !isWindow && !w.input.IsAggregate(call.Name) {
+		return nil, errfmt.Wrap(ErrNotSupportedFunction, call.Name+" is not a window function")
+	}
+	if call.Distinct {
+		return nil, errfmt.Wrap(ErrNotSupportedExpr, "DISTINCT in window function "+call.Name)
+	}
+	// The input binder rejects the nested window function.
+	args := make([]Expr, len(call.Args))
+	for i, arg := range call.Args {
+		var err error
+		if args[i], err = w.input.Bind(arg); err != nil {
+			return nil, err
+		}
+	}
+	fn := &WindowFunc{Name: call.Name, Frame: defaultFrame}
+	if err := fn.bindWindow(w.input, call.Over); err != nil {
+		return nil, err
+	}
+	if !isWindow {
+		agg, err := w.input.newAggregate(call.Name, args, call.Star, false)
+		if err != nil {
+			return nil, err
+		}
+		fn.Args, fn.Aggregate, fn.T = agg.Args, agg, agg.T
+		return fn, nil
+	}
+	if err := fn.bindArgs(args, call.Star); err != nil {
+		return nil, err
+	}
+	return fn, nil
+}
+
+// bindArgs checks the number and the types of the arguments of the window
+// function that is not an aggregate function, and sets the result type.
+func (w *WindowFunc) bindArgs(args []Expr, star bool) error {
+	n := windowFuncs[w.Name]
+	if star || len(args) < n[0] || len(args) > n[1] {
+		return errfmt.Wrap(ErrWrongNumberOfArgs, fmt.Sprintf("%s takes %d to %d arguments", w.Name, n[0], n[1]))
+	}
+	w.T = Int
+	if len(args) == 0 {
+		return nil
+	}
+	w.T = args[0].Type()
+	if w.Name == "lag" || w.Name == "lead" {
+		// LAG(value, offset, default): offset is Int and default is the type of value.
+		if len(args) > 1 {
+			offset, err := Coerce(args[1], Int)
+			if err != nil {
+				return err
+			}
+			args[1] = offset
+		}
+		if len(args) > 2 {
+			exprs, err := coerceAll([]Expr{args[0], args[2]})
+			if err != nil {
+				return err
+			}
+			args[0], args[2] = exprs[0], exprs[1]
+			w.T = args[0].Type()
+		}
+	}
+	w.Args = args
+	return nil
+}
+
+// bindWindow binds PARTITION BY, ORDER BY and the frame of the window.
+func (w *WindowFunc) bindWindow(b *Binder, spec *query.WindowSpec) error {
+	for _, e := range spec.PartitionBy {
+		bound, err := b.Bind(e)
+		if err != nil {
+			return err
+		}
+		w.PartitionBy = append(w.PartitionBy, bound)
+	}
+	for _, item := range spec.OrderBy {
+		bound, err := b.Bind(item.Expr)
+		if err != nil {
+			return err
+		}
+		w.OrderBy = append(w.OrderBy, SortExpr{Expr: bound, Desc: item.Desc, NullsFirst: item.NullsFirst})
+	}
+	if spec.Frame == nil {
+		return nil
+	}
+	f := *spec.Frame
+	switch {
+	case f.Start.Type == query.UnboundedFollowing:
+		return errfmt.Wrap(ErrInvalidFrame, "frame start cannot be UNBOUNDED FOLLOWING")
+	case f.End.Type == query.UnboundedPreceding:
+		return errfmt.Wrap(ErrInvalidFrame, "frame end cannot be UNBOUNDED PRECEDING")
+	case f.Start.Type > f.End.Type:
+		return errfmt.Wrap(ErrInvalidFrame, "frame starts after it ends")
+	case f.Range && (f.Start.Type == query.Preceding || f.Start.Type == query.Following ||
+		f.End.Type == query.Preceding || f.End.Type == query.Following):
+		return errfmt.Wrap(ErrInvalidFrame, "RANGE with offset is not supported")
+	}
+	w.Frame = f
+	return nil
+}
@@ -0,0 +1,216 @@
+package dbms
+
+import (
+	"github.com/nao1215/egsql/dbms/meta"
+	"github.com/nao1215/egsql/dbms/storage"
+	"github.com/nao1215/egsql/misc/errfmt"
+)
+
+// fkCheck is a check of the FOREIGN KEY constraint for one key.
+// The constraint is satisfied if the parent table has the key,
+// or no row of the child table references the key.
+type fkCheck struct {
+	child string
+	fk    meta.ForeignKey
+	key   storage.Row
+}
+
+// enforceForeignKeys applies the FOREIGN KEY actions for the changes after
+// the start position of the undo log, and checks the constraints.
+// The checks of the deferred constraints are returned without checking.
+func (tx *Tx) enforceForeignKeys(start int) ([]fkCheck, error) {
+	var checks []fkCheck
+	w := &Writer{tx: tx}
+
+	// The changes made by the actions are appended to the undo log,
+	// so they are processed in this loop too (e.g. cascading delete).
+	for i := start; i < len(tx.changes); i++ {
+		c := tx.changes[i]
+		if c.old == nil {
+			continue
+		}
+		for _, child := range tx.db.catalog.ReferencedBy(c.table) {
+			for _, fk := range child.ForeignKeys {
+				if fk.RefTable != c.table {
+					continue
+				}
+				check, err := tx.applyAction(w, child, fk, c)
+				if err != nil {
+					return nil, err
+				}
+				if check != nil {
+					checks = append(checks, *check)
+				}
+			}
+		}
+	}
+
+	// The referencing rows must reference the existing parent rows.
+	for i := start; i < len(tx.changes); i++ {
+		c := tx.changes[i]
+		if c.new == nil {
+			continue
+		}
+		scheme := tx.db.tables[c.table].Scheme()
+		for _, fk := range scheme.ForeignKeys {
+			key, ok := keyOf(scheme, c.new, fk.Columns)
+			if !ok {
+				continue
+			}
+			if c.old != nil {
+				if oldKey, ok := keyOf(scheme, c.old, fk.Columns); ok && equalKey(key, oldKey) {
+					continue
+				}
+			}
+			checks = append(checks, fkCheck{child: c.table, fk: fk, key: key})
+		}
+	}
+
+	var deferred []fkCheck
+	for _, check := range checks {
+		if check.fk.Deferred {
+			deferred = append(deferred, check)
+			continue
+		}
+		if err := tx.verify(check); err != nil {
+			return nil, err
+		}
+	}
+	return deferred, nil
+}
+
+// applyAction applies the action of the FOREIGN KEY constraint to the child rows
+// that reference the key removed from the parent table by the change.
+// For NO ACTION and RESTRICT, the check of the key is returned.
+func (tx *Tx) applyAction(w *Writer, child *meta.Scheme, fk meta.ForeignKey, c change) (*fkCheck, error) {
+	parent := tx.db.tables[c.table]
+	oldKey, ok := keyOf(parent.Scheme(), c.old, fk.RefColumns)
+	if !ok {
+		return nil, nil
+	}
+
+	action := fk.OnDelete
+	var newKey storage.Row
+	if c.new != nil {
+		var ok bool
+		if newKey, ok = keyOf(parent.Scheme(), c.new, fk.RefColumns); !ok {
+			// CASCADE of the key updated to NULL sets the child columns to NULL.
+			newKey = make(storage.Row, len(fk.RefColumns))
+		}
+		if equalKey(oldKey, newKey) {
+			return nil, nil
+		}
+		action = fk.OnUpdate
+	}
+
+	// Another parent row may have the key in the same statement.
+	if has, err := hasKey(parent, fk.RefColumns, oldKey); err != nil || has {
+		return nil, err
+	}
+
+	check := &fkCheck{child: child.TableName, fk: fk, key: oldKey}
+	switch action {
+	case meta.NoAction:
+		return check, nil
+	case meta.Restrict:
+		// RESTRICT is never deferred.
+		check.fk.Deferred = false
+		return check, nil
+	}
+
+	childTable := tx.db.tables[child.TableName]
+	rowIDs, err := childTable.Lookup(fk.Index, oldKey)
+	if err != nil {
+		return nil, err
+	}
+	for _, rowID := range rowIDs {
+		row, ok := childTable.Get(rowID)
+		if !ok {
+			continue
+		}
+		if action == meta.Cascade && c.new == nil {
+			if err := w.Delete(child.TableName, rowID); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		updated := append(storage.Row{}, row...)
+		for j, col := range fk.Columns {
+			pos := child.ColumnIndex(col)
+			switch action {
+			case meta.Cascade:
+				updated[pos] = newKey[j]
+			case meta.SetNull:
+				updated[pos] = nil
+			case meta.SetDefault:
+				updated[pos] = child.DefaultValue(col)
+			}
+		}
+		if err := w.Update(child.TableName, rowID, updated); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// verify checks the FOREIGN KEY constraint for the key.
+func (tx *Tx) verify(c fkCheck) error {
+	parent, ok := tx.db.tables[c.fk.RefTable]
+	if !ok {
+		return errfmt.Wrap(ErrNotExistTable, c.fk.RefTable)
+	}
+	has, err := hasKey(parent, c.fk.RefColumns, c.key)
+	if err != nil || has {
+		return err
+	}
+
+	child, ok := tx.db.tables[c.child]
+	if !ok {
+		return nil
+	}
+	rowIDs, err := child.Lookup(c.fk.Index, c.key)
+	if err != nil {
+		return err
+	}
+	if len(rowIDs) > 0 {
+		return errfmt.Wrap(ErrForeignKeyViolation, c.fk.Name)
+	}
+	return nil
+}
+
+// hasKey reports whether the table has the row whose columns equal to the key.
+func hasKey(t *storage.Table, columns []string, key storage.Row) (bool, error) {
+	rowIDs, err := t.Lookup(t.Scheme().UniqueIndexFor(columns), key)
+	if err != nil {
+		return false, err
+	}
+	return len(rowIDs) > 0, nil
+}
+
+// keyOf returns the values of the columns in the row.
+// If a value is NULL, false is returned because NULL never references anything.
+func keyOf(scheme *meta.Scheme, row storage.Row, columns []string) (storage.Row, bool) {
+	key := make(storage.Row, 0, len(columns))
+	for _, c := range columns {
+		v := row[scheme.ColumnIndex(c)]
+		if v == nil {
+			return nil, false
+		}
+		key = append(key, v)
+	}
+	return key, true
+}
+
+// equalKey reports whether the keys have the same values.
+func equalKey(a, b storage.Row) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
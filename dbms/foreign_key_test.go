@@ -0,0 +1,641 @@
+package dbms
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nao1215/egsql/dbms/meta"
+	"github.com/nao1215/egsql/dbms/storage"
+)
+
+// newTestDB returns the database that has the parent table "groups" and
+// the child table "users" referencing it with the foreign key.
+func newTestDB(t *testing.T, fk meta.ForeignKey) *EgSQLDB {
+	t.Helper()
+
+	db, err := NewEgSQLDB(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	groups, err := meta.NewScheme("groups", []string{"id", "name"}, []meta.DataType{meta.Int, meta.Varchar}, "id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateTable(groups); err != nil {
+		t.Fatal(err)
+	}
+
+	users, err := meta.NewScheme("users", []string{"id", "group_id"}, []meta.DataType{meta.Int, meta.Int}, "id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := users.SetDefault("group_id", int64(0)); err != nil {
+		t.Fatal(err)
+	}
+	fk.Columns = []string{"group_id"}
+	fk.RefTable = "groups"
+	if err := users.AddForeignKey(fk); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateTable(users); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// exec executes fn as one statement in the new transaction and commits it.
+func exec(db *EgSQLDB, fn func(w *Writer) error) error {
+	tx := db.Begin()
+	if err := tx.Statement(fn); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// rows returns all rows of the table.
+func rows(db *EgSQLDB, table string) []storage.Row {
+	var got []storage.Row
+	db.Table(table).Scan(func(rowID int64, row storage.Row) bool {
+		got = append(got, row)
+		return true
+	})
+	return got
+}
+
+// setup inserts groups 0, 1, 2 and users referencing group 1.
+func setup(t *testing.T, db *EgSQLDB) {
+	t.Helper()
+
+	err := exec(db, func(w *Writer) error {
+		for _, r := range []storage.Row{{int64(0), "default"}, {int64(1), "admin"}, {int64(2), "guest"}} {
+			if _, err := w.Insert("groups", r); err != nil {
+				return err
+			}
+		}
+		for _, r := range []storage.Row{{int64(10), int64(1)}, {int64(11), int64(1)}, {int64(12), nil}} {
+			if _, err := w.Insert("users", r); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// deleteGroup deletes the group with the id.
+func deleteGroup(id int64) func(w *Writer) error {
+	return func(w *Writer) error {
+		groups, err := w.Table("groups")
+		if err != nil {
+			return err
+		}
+		rowIDs, err := groups.Lookup("groups_pkey", storage.Row{id})
+		if err != nil {
+			return err
+		}
+		return w.Delete("groups", rowIDs[0])
+	}
+}
+
+// updateGroupID updates the id of the group.
+func updateGroupID(from, to int64) func(w *Writer) error {
+	return func(w *Writer) error {
+		groups, err := w.Table("groups")
+		if err != nil {
+			return err
+		}
+		rowIDs, err := groups.Lookup("groups_pkey", storage.Row{from})
+		if err != nil {
+			return err
+		}
+		row, _ := groups.Get(rowIDs[0])
+		return w.Update("groups", rowIDs[0], storage.Row{to, row[1]})
+	}
+}
+
+func TestForeignKey_Insert(t *testing.T) {
+	tests := []struct {
+		name      string
+		row       storage.Row
+		wantErrIs error
+	}{
+		{
+			name:      "[Success] reference existing parent",
+			row:       storage.Row{int64(20), int64(2)},
+			wantErrIs: nil,
+		},
+		{
+			name:      "[Success] NULL references nothing",
+			row:       storage.Row{int64(20), nil},
+			wantErrIs: nil,
+		},
+		{
+			name:      "[Error] reference not existing parent",
+			row:       storage.Row{int64(20), int64(100)},
+			wantErrIs: ErrForeignKeyViolation,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t, meta.ForeignKey{})
+			setup(t, db)
+
+			err := exec(db, func(w *Writer) error {
+				_, err := w.Insert("users", tt.row)
+				return err
+			})
+			if !errors.Is(err, tt.wantErrIs) {
+				t.Errorf("Writer.Insert() error = %v, wantErrIs %v", err, tt.wantErrIs)
+			}
+			if tt.wantErrIs != nil && db.Table("users").Len() != 3 {
+				t.Errorf("statement is not undone")
+			}
+		})
+	}
+}
+
+func TestForeignKey_CheckedAtStatementEnd(t *testing.T) {
+	db := newTestDB(t, meta.ForeignKey{})
+
+	err := exec(db, func(w *Writer) error {
+		// The child is inserted before the parent in the same statement.
+		if _, err := w.Insert("users", storage.Row{int64(10), int64(5)}); err != nil {
+			return err
+		}
+		_, err := w.Insert("groups", storage.Row{int64(5), "late"})
+		return err
+	})
+	if err != nil {
+		t.Errorf("constraint is not checked at the end of statement: %v", err)
+	}
+}
+
+func TestForeignKey_OnDelete(t *testing.T) {
+	tests := []struct {
+		name      string
+		action    meta.ReferentialAction
+		wantErrIs error
+		wantUsers []storage.Row
+	}{
+		{
+			name:      "[Error] NO ACTION",
+			action:    meta.NoAction,
+			wantErrIs: ErrForeignKeyViolation,
+			wantUsers: []storage.Row{{int64(10), int64(1)}, {int64(11), int64(1)}, {int64(12), nil}},
+		},
+		{
+			name:      "[Error] RESTRICT",
+			action:    meta.Restrict,
+			wantErrIs: ErrForeignKeyViolation,
+			wantUsers: []storage.Row{{int64(10), int64(1)}, {int64(11), int64(1)}, {int64(12), nil}},
+		},
+		{
+			name:      "[Success] CASCADE",
+			action:    meta.Cascade,
+			wantErrIs: nil,
+			wantUsers: []storage.Row{{int64(12), nil}},
+		},
+		{
+			name:      "[Success] SET NULL",
+			action:    meta.SetNull,
+			wantErrIs: nil,
+			wantUsers: []storage.Row{{int64(10), nil}, {int64(11), nil}, {int64(12), nil}},
+		},
+		{
+			name:      "[Success] SET DEFAULT",
+			action:    meta.SetDefault,
+			wantErrIs: nil,
+			wantUsers: []storage.Row{{int64(10), int64(0)}, {int64(11), int64(0)}, {int64(12), nil}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t, meta.ForeignKey{OnDelete: tt.action})
+			setup(t, db)
+
+			err := exec(db, deleteGroup(1))
+			if !errors.Is(err, tt.wantErrIs) {
+				t.Errorf("Writer.Delete() error = %v, wantErrIs %v", err, tt.wantErrIs)
+			}
+			if diff := cmp.Diff(tt.wantUsers, rows(db, "users")); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestForeignKey_OnUpdate(t *testing.T) {
+	tests := []struct {
+		name      string
+		action    meta.ReferentialAction
+		wantErrIs error
+		wantUsers []storage.Row
+	}{
+		{
+			name:      "[Error] NO ACTION",
+			action:    meta.NoAction,
+			wantErrIs: ErrForeignKeyViolation,
+			wantUsers: []storage.Row{{int64(10), int64(1)}, {int64(11), int64(1)}, {int64(12), nil}},
+		},
+		{
+			name:      "[Success] CASCADE",
+			action:    meta.Cascade,
+			wantErrIs: nil,
+			wantUsers: []storage.Row{{int64(10), int64(5)}, {int64(11), int64(5)}, {int64(12), nil}},
+		},
+		{
+			name:      "[Success] SET NULL",
+			action:    meta.SetNull,
+			wantErrIs: nil,
+			wantUsers: []storage.Row{{int64(10), nil}, {int64(11), nil}, {int64(12), nil}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t, meta.ForeignKey{OnUpdate: tt.action})
+			setup(t, db)
+
+			err := exec(db, updateGroupID(1, 5))
+			if !errors.Is(err, tt.wantErrIs) {
+				t.Errorf("Writer.Update() error = %v, wantErrIs %v", err, tt.wantErrIs)
+			}
+			if diff := cmp.Diff(tt.wantUsers, rows(db, "users")); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestForeignKey_SetDefaultToMissingParent(t *testing.T) {
+	db := newTestDB(t, meta.ForeignKey{OnDelete: meta.SetDefault})
+	setup(t, db)
+
+	// The default group 0 is deleted first, so SET DEFAULT references nothing.
+	if err := exec(db, deleteGroup(0)); err != nil {
+		t.Fatal(err)
+	}
+	err := exec(db, deleteGroup(1))
+	if !errors.Is(err, ErrForeignKeyViolation) {
+		t.Errorf("Writer.Delete() error = %v, wantErrIs %v", err, ErrForeignKeyViolation)
+	}
+}
+
+func TestForeignKey_Deferred(t *testing.T) {
+	t.Run("[Success] violation is fixed before commit", func(t *testing.T) {
+		db := newTestDB(t, meta.ForeignKey{Deferred: true})
+
+		tx := db.Begin()
+		err := tx.Statement(func(w *Writer) error {
+			_, err := w.Insert("users", storage.Row{int64(10), int64(5)})
+			return err
+		})
+		if err != nil {
+			t.Fatalf("deferred constraint is checked at the end of statement: %v", err)
+		}
+		err = tx.Statement(func(w *Writer) error {
+			_, err := w.Insert("groups", storage.Row{int64(5), "late"})
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Errorf("Tx.Commit() error = %v", err)
+		}
+	})
+
+	t.Run("[Error] violation remains at commit", func(t *testing.T) {
+		db := newTestDB(t, meta.ForeignKey{Deferred: true})
+
+		tx := db.Begin()
+		err := tx.Statement(func(w *Writer) error {
+			_, err := w.Insert("users", storage.Row{int64(10), int64(5)})
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.Commit(); !errors.Is(err, ErrForeignKeyViolation) {
+			t.Errorf("Tx.Commit() error = %v, wantErrIs %v", err, ErrForeignKeyViolation)
+		}
+		if db.Table("users").Len() != 0 {
+			t.Errorf("transaction is not rolled back")
+		}
+		if err := tx.Commit(); !errors.Is(err, ErrTxDone) {
+			t.Errorf("Tx.Commit() error = %v, wantErrIs %v", err, ErrTxDone)
+		}
+	})
+
+	t.Run("[Error] RESTRICT is not deferred", func(t *testing.T) {
+		db := newTestDB(t, meta.ForeignKey{Deferred: true, OnDelete: meta.Restrict})
+		setup(t, db)
+
+		tx := db.Begin()
+		err := tx.Statement(deleteGroup(1))
+		if !errors.Is(err, ErrForeignKeyViolation) {
+			t.Errorf("Tx.Statement() error = %v, wantErrIs %v", err, ErrForeignKeyViolation)
+		}
+		_ = tx.Rollback()
+	})
+}
+
+func TestTx_Rollback(t *testing.T) {
+	db := newTestDB(t, meta.ForeignKey{OnDelete: meta.Cascade})
+	setup(t, db)
+	want := rows(db, "users")
+
+	tx := db.Begin()
+	if err := tx.Statement(deleteGroup(1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Statement(func(w *Writer) error {
+		_, err := w.Insert("users", storage.Row{int64(20), int64(2)})
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(want, rows(db, "users")); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+	if db.Table("groups").Len() != 3 {
+		t.Errorf("deleted parent is not restored")
+	}
+}
+
+func TestForeignKey_CreateTableSQL(t *testing.T) {
+	tests := []struct {
+		name          string
+		create        string
+		insert        string
+		wantCreateErr error
+		wantInsertErr error
+	}{
+		{
+			name:   "[Success] column constraint",
+			create: "CREATE TABLE users (id INT PRIMARY KEY, group_id INT REFERENCES groups)",
+			insert: "INSERT INTO users VALUES (10, 1), (11, NULL)",
+		},
+		{
+			name:          "[Error] column constraint",
+			create:        "CREATE TABLE users (id INT PRIMARY KEY, group_id INT REFERENCES groups)",
+			insert:        "INSERT INTO users VALUES (10, 1), (11, 9)",
+			wantInsertErr: ErrForeignKeyViolation,
+		},
+		{
+			name:          "[Error] table constraint",
+			create:        "CREATE TABLE users (id INT PRIMARY KEY, group_id INT, CONSTRAINT users_group_fkey FOREIGN KEY (group_id) REFERENCES groups (id))",
+			insert:        "INSERT INTO users VALUES (10, 9)",
+			wantInsertErr: ErrForeignKeyViolation,
+		},
+		{
+			name:          "[Error] referenced table does not exist",
+			create:        "CREATE TABLE users (id INT PRIMARY KEY, group_id INT REFERENCES roles)",
+			wantCreateErr: ErrNotExistTable,
+		},
+		{
+			name:          "[Error] referenced column is not unique",
+			create:        "CREATE TABLE users (id INT PRIMARY KEY, group_name TEXT REFERENCES groups (name))",
+			wantCreateErr: meta.ErrInvalidForeignKey,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := NewEgSQLDB(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, sql := range []string{"CREATE TABLE groups (id INT PRIMARY KEY, name TEXT)", "INSERT INTO groups VALUES (1, 'admin')"} {
+				if _, err := execSQL(t, db, sql); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			_, err = execSQL(t, db, tt.create)
+			if !errors.Is(err, tt.wantCreateErr) {
+				t.Fatalf("CREATE TABLE error = %v, wantErr %v", err, tt.wantCreateErr)
+			}
+			if err != nil {
+				return
+			}
+			_, err = execSQL(t, db, tt.insert)
+			if !errors.Is(err, tt.wantInsertErr) {
+				t.Errorf("INSERT error = %v, wantErr %v", err, tt.wantInsertErr)
+			}
+			if err != nil && db.Table("users").Len() != 0 {
+				t.Errorf("statement is not undone")
+			}
+		})
+	}
+}
+
+func TestForeignKey_ActionsFromSQL(t *testing.T) {
+	db, err := NewEgSQLDB(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sql := range []string{
+		"CREATE TABLE groups (id INT PRIMARY KEY, name TEXT)",
+		"CREATE TABLE users (id INT PRIMARY KEY, group_id INT DEFAULT 0 REFERENCES groups ON DELETE SET DEFAULT ON UPDATE CASCADE)",
+		"INSERT INTO groups VALUES (0, 'default'), (1, 'admin')",
+		"INSERT INTO users VALUES (10, 1)",
+	} {
+		if _, err := execSQL(t, db, sql); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := exec(db, updateGroupID(1, 5)); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]storage.Row{{int64(10), int64(5)}}, rows(db, "users")); diff != "" {
+		t.Errorf("ON UPDATE CASCADE mismatch (-want +got):\n%s", diff)
+	}
+	if err := exec(db, deleteGroup(5)); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]storage.Row{{int64(10), int64(0)}}, rows(db, "users")); diff != "" {
+		t.Errorf("ON DELETE SET DEFAULT mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// newSQLTestDB returns the database whose tables "groups" and "users" are
+// created by SQL. The foreign key of users is "REFERENCES groups" followed by
+// the clause, and users 10 and 11 reference groups 1 and 2.
+func newSQLTestDB(t *testing.T, clause string) *EgSQLDB {
+	t.Helper()
+
+	db, err := NewEgSQLDB(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sql := range []string{
+		"CREATE TABLE groups (id INT PRIMARY KEY, name TEXT)",
+		"CREATE TABLE users (id INT PRIMARY KEY, group_id INT DEFAULT 0 REFERENCES groups " + clause + ")",
+		"INSERT INTO groups VALUES (0, 'default'), (1, 'admin'), (2, 'guest')",
+		"INSERT INTO users VALUES (10, 1), (11, 2)",
+	} {
+		if _, err := execSQL(t, db, sql); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func TestForeignKey_ActionsBySQL(t *testing.T) {
+	tests := []struct {
+		name    string
+		clause  string
+		sql     string
+		want    []storage.Row
+		wantErr error
+	}{
+		{
+			name:   "[Success] ON DELETE CASCADE",
+			clause: "ON DELETE CASCADE",
+			sql:    "DELETE FROM groups WHERE id = 1",
+			want:   []storage.Row{{int64(11), int64(2)}},
+		},
+		{
+			name:   "[Success] ON DELETE SET NULL",
+			clause: "ON DELETE SET NULL",
+			sql:    "DELETE FROM groups WHERE id = 1",
+			want:   []storage.Row{{int64(10), nil}, {int64(11), int64(2)}},
+		},
+		{
+			name:   "[Success] ON DELETE SET DEFAULT",
+			clause: "ON DELETE SET DEFAULT",
+			sql:    "DELETE FROM groups WHERE id = 1",
+			want:   []storage.Row{{int64(10), int64(0)}, {int64(11), int64(2)}},
+		},
+		{
+			name:    "[Error] ON DELETE RESTRICT",
+			clause:  "ON DELETE RESTRICT",
+			sql:     "DELETE FROM groups WHERE id = 1",
+			wantErr: ErrForeignKeyViolation,
+		},
+		{
+			name:    "[Error] ON DELETE NO ACTION",
+			clause:  "ON DELETE NO ACTION",
+			sql:     "DELETE FROM groups WHERE id = 1",
+			wantErr: ErrForeignKeyViolation,
+		},
+		{
+			name:   "[Success] ON UPDATE CASCADE",
+			clause: "ON UPDATE CASCADE",
+			sql:    "UPDATE groups SET id = id + 10 WHERE id > 0",
+			want:   []storage.Row{{int64(10), int64(11)}, {int64(11), int64(12)}},
+		},
+		{
+			name:   "[Success] ON UPDATE SET NULL",
+			clause: "ON UPDATE SET NULL",
+			sql:    "UPDATE groups SET id = id + 10 WHERE id > 0",
+			want:   []storage.Row{{int64(10), nil}, {int64(11), nil}},
+		},
+		{
+			name:   "[Success] ON UPDATE SET DEFAULT",
+			clause: "ON UPDATE SET DEFAULT",
+			sql:    "UPDATE groups SET id = 5 WHERE id = 1",
+			want:   []storage.Row{{int64(10), int64(0)}, {int64(11), int64(2)}},
+		},
+		{
+			name:    "[Error] ON UPDATE NO ACTION",
+			clause:  "ON UPDATE NO ACTION",
+			sql:     "UPDATE groups SET id = 5 WHERE id = 1",
+			wantErr: ErrForeignKeyViolation,
+		},
+		{
+			name:    "[Error] update of the child to a missing parent",
+			clause:  "ON UPDATE CASCADE",
+			sql:     "UPDATE users SET group_id = 9 WHERE id = 10",
+			wantErr: ErrForeignKeyViolation,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newSQLTestDB(t, tt.clause)
+			before := rows(db, "users")
+
+			_, err := execSQL(t, db, tt.sql)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Exec() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				// The statement is undone with the actions.
+				if diff := cmp.Diff(before, rows(db, "users")); diff != "" {
+					t.Errorf("rows mismatch (-want +got):\n%s", diff)
+				}
+				return
+			}
+			if diff := cmp.Diff(tt.want, rows(db, "users")); diff != "" {
+				t.Errorf("rows mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestForeignKey_DeferredBySQL(t *testing.T) {
+	t.Run("[Success] NO ACTION is checked at commit", func(t *testing.T) {
+		db := newSQLTestDB(t, "ON DELETE NO ACTION DEFERRABLE INITIALLY DEFERRED")
+		sess := NewSession()
+		sess.Tx = db.Begin()
+
+		if err := execIn(t, db, sess, "DELETE FROM groups WHERE id = 1"); err != nil {
+			t.Fatalf("deferred constraint is checked at the end of statement: %v", err)
+		}
+		if err := execIn(t, db, sess, "INSERT INTO groups VALUES (1, 'staff')"); err != nil {
+			t.Fatal(err)
+		}
+		if err := sess.Tx.Commit(); err != nil {
+			t.Errorf("Tx.Commit() error = %v", err)
+		}
+	})
+
+	t.Run("[Error] violation remains at commit", func(t *testing.T) {
+		db := newSQLTestDB(t, "DEFERRABLE INITIALLY DEFERRED")
+		sess := NewSession()
+		sess.Tx = db.Begin()
+
+		if err := execIn(t, db, sess, "DELETE FROM groups WHERE id = 1"); err != nil {
+			t.Fatal(err)
+		}
+		if err := sess.Tx.Commit(); !errors.Is(err, ErrForeignKeyViolation) {
+			t.Errorf("Tx.Commit() error = %v, wantErrIs %v", err, ErrForeignKeyViolation)
+		}
+		if db.Table("groups").Len() != 3 {
+			t.Errorf("transaction is not rolled back")
+		}
+	})
+
+	t.Run("[Error] RESTRICT is not deferred", func(t *testing.T) {
+		db := newSQLTestDB(t, "ON DELETE RESTRICT DEFERRABLE INITIALLY DEFERRED")
+		sess := NewSession()
+		sess.Tx = db.Begin()
+
+		err := execIn(t, db, sess, "DELETE FROM groups WHERE id = 1")
+		if !errors.Is(err, ErrForeignKeyViolation) {
+			t.Errorf("Exec() error = %v, wantErrIs %v", err, ErrForeignKeyViolation)
+		}
+		_ = sess.Tx.Rollback()
+	})
+
+	t.Run("[Error] NOT DEFERRABLE is checked at the end of statement", func(t *testing.T) {
+		db := newSQLTestDB(t, "NOT DEFERRABLE")
+		sess := NewSession()
+		sess.Tx = db.Begin()
+
+		err := execIn(t, db, sess, "DELETE FROM groups WHERE id = 1")
+		if !errors.Is(err, ErrForeignKeyViolation) {
+			t.Errorf("Exec() error = %v, wantErrIs %v", err, ErrForeignKeyViolation)
+		}
+		_ = sess.Tx.Rollback()
+	})
+}
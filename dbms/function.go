@@ -0,0 +1,310 @@
+package dbms
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/nao1215/egsql/dbms/expr"
+	"github.com/nao1215/egsql/misc/errfmt"
+)
+
+// Function is a scalar function that can be called in SQL. The arguments are
+// checked against Params and converted when the call is bound (at plan time).
+type Function struct {
+	// Name is the function name in lower case.
+	Name string
+	// Params is the types of the parameters. The argument is converted to the
+	// type of its parameter. The arguments of the Unknown parameters are
+	// converted to their common type, like the operands of the comparison.
+	Params []expr.Type
+	// MinArgs is the number of the required arguments. The parameters after
+	// them are optional.
+	MinArgs int
+	// Variadic is a flag indicating whether the last parameter can be repeated.
+	Variadic bool
+	// Result is the type of the result. If it is Unknown, the result is the
+	// common type of the arguments of the Unknown parameters.
+	Result expr.Type
+	// Deterministic is a flag indicating whether the function always returns
+	// the same result for the same arguments, so that the call with constant
+	// arguments can be evaluated once.
+	Deterministic bool
+	// CalledOnNull is a flag indicating whether Fn is called when an argument
+	// is NULL. If it is false, the result is NULL without calling Fn.
+	CalledOnNull bool
+	// Fn computes the result from the arguments converted to Params.
+	Fn func(args []interface{}) (interface{}, error)
+}
+
+// AggregateFunction is an aggregate function that can be called in SQL, like
+// SUM(x). The arguments are checked and converted as those of Function.
+type AggregateFunction struct {
+	// Name is the function name in lower case.
+	Name string
+	// Params is the types of the parameters.
+	Params []expr.Type
+	// MinArgs is the number of the required arguments.
+	MinArgs int
+	// Variadic is a flag indicating whether the last parameter can be repeated.
+	Variadic bool
+	// Result is the type of the result.
+	Result expr.Type
+	// CalledOnNull is a flag indicating whether the row whose argument is NULL
+	// is added to the accumulator. If it is false, the row is ignored.
+	CalledOnNull bool
+	// New returns the accumulator of a new group.
+	New func() expr.Accumulator
+}
+
+// signature is the parameters and the result of the function.
+type signature struct {
+	name     string
+	params   []expr.Type
+	minArgs  int
+	variadic bool
+	result   expr.Type
+}
+
+// validate checks the definition of the parameters.
+func (s signature) validate() error {
+	if s.minArgs < 0 || s.minArgs > len(s.params) || (s.variadic && len(s.params) == 0) {
+		return errfmt.Wrap(ErrInvalidFunction, s.name+" has invalid parameters")
+	}
+	return nil
+}
+
+// bind checks the number and the types of the bound arguments, and returns
+// the arguments converted to the parameters and the type of the result.
+func (s signature) bind(args []expr.Expr) ([]expr.Expr, expr.Type, error) {
+	maxArgs := len(s.params)
+	if len(args) < s.minArgs || (!s.variadic && len(args) > maxArgs) {
+		want := fmt.Sprintf("%d", s.minArgs)
+		switch {
+		case s.variadic:
+			want += " or more"
+		case maxArgs > s.minArgs:
+			want += fmt.Sprintf(" to %d", maxArgs)
+		}
+		return nil, expr.Unknown, errfmt.Wrap(ErrWrongNumberOfArgs, fmt.Sprintf("%s takes %s arguments, but %d given", s.name, want, len(args)))
+	}
+	param := func(i int) expr.Type {
+		if i >= len(s.params) {
+			return s.params[len(s.params)-1]
+		}
+		return s.params[i]
+	}
+	var generic []expr.Expr
+	for i, a := range args {
+		if param(i) == expr.Unknown {
+			generic = append(generic, a)
+		}
+	}
+	common := expr.CommonType(generic...)
+	bound := make([]expr.Expr, len(args))
+	for i, a := range args {
+		t := param(i)
+		if t == expr.Unknown {
+			t = common
+		}
+		var err error
+		if bound[i], err = expr.Coerce(a, t); err != nil {
+			return nil, expr.Unknown, errfmt.Wrap(err, fmt.Sprintf("argument %d of %s", i+1, s.name))
+		}
+	}
+	if s.result == expr.Unknown {
+		return bound, common, nil
+	}
+	return bound, s.result, nil
+}
+
+// signature returns the signature of the function.
+func (f *Function) signature() signature {
+	return signature{name: f.Name, params: f.Params, minArgs: f.MinArgs, variadic: f.Variadic, result: f.Result}
+}
+
+// bind checks the number and the types of the bound arguments, and returns the call.
+func (f *Function) bind(args []expr.Expr) (expr.Expr, error) {
+	args, result, err := f.signature().bind(args)
+	if err != nil {
+		return nil, err
+	}
+	fn := f.Fn
+	if !f.CalledOnNull {
+		fn = func(values []interface{}) (interface{}, error) {
+			if hasNull(values) {
+				return nil, nil
+			}
+			return f.Fn(values)
+		}
+	}
+	return &expr.Call{Name: f.Name, Args: args, T: result, Deterministic: f.Deterministic, Fn: fn}, nil
+}
+
+// signature returns the signature of the function.
+func (f *AggregateFunction) signature() signature {
+	return signature{name: f.Name, params: f.Params, minArgs: f.MinArgs, variadic: f.Variadic, result: f.Result}
+}
+
+// bind checks the number and the types of the bound arguments, and returns the call.
+func (f *AggregateFunction) bind(args []expr.Expr, distinct bool) (*expr.Aggregate, error) {
+	args, result, err := f.signature().bind(args)
+	if err != nil {
+		return nil, err
+	}
+	newAcc := f.New
+	if !f.CalledOnNull {
+		newAcc = func() expr.Accumulator { return &nonNullAcc{acc: f.New()} }
+	}
+	return expr.NewCustomAggregate(f.Name, args, result, distinct, newAcc), nil
+}
+
+// nonNullAcc ignores the rows whose argument is NULL.
+type nonNullAcc struct {
+	acc expr.Accumulator
+}
+
+// Step adds the values of the arguments unless any of them is NULL.
+func (a *nonNullAcc) Step(args []interface{}) error {
+	if hasNull(args) {
+		return nil
+	}
+	return a.acc.Step(args)
+}
+
+// Result returns the result of the accumulator.
+func (a *nonNullAcc) Result() (interface{}, error) {
+	return a.acc.Result()
+}
+
+// hasNull reports whether any of the values is NULL.
+func hasNull(values []interface{}) bool {
+	for _, v := range values {
+		if v == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// functionRegistry is the scalar functions and the aggregate functions that
+// can be called by name, other than the built-in aggregate functions.
+// A name is either a scalar function or an aggregate function.
+type functionRegistry struct {
+	funcs map[string]*Function
+	aggs  map[string]*AggregateFunction
+	mutex sync.RWMutex
+}
+
+// newFunctionRegistry returns the registry of the built-in functions.
+func newFunctionRegistry() *functionRegistry {
+	r := &functionRegistry{funcs: make(map[string]*Function), aggs: make(map[string]*AggregateFunction)}
+	for _, f := range builtinFunctions {
+		r.funcs[f.Name] = f
+	}
+	return r
+}
+
+// checkName returns the name of the function in lower case if it can be registered.
+func checkName(name string) (string, error) {
+	lower := strings.ToLower(name)
+	if lower == "" || lower == "nextval" || expr.IsAggregate(lower) {
+		return "", errfmt.Wrap(ErrInvalidFunction, "cannot register function '"+name+"'")
+	}
+	return lower, nil
+}
+
+// register adds the function, replacing the function of the same name.
+func (r *functionRegistry) register(f *Function) error {
+	fn := *f
+	var err error
+	if fn.Name, err = checkName(f.Name); err != nil {
+		return err
+	}
+	if fn.Fn == nil {
+		return errfmt.Wrap(ErrInvalidFunction, fn.Name+" has no implementation")
+	}
+	if err := fn.signature().validate(); err != nil {
+		return err
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.aggs, fn.Name)
+	r.funcs[fn.Name] = &fn
+	return nil
+}
+
+// registerAggregate adds the aggregate function, replacing the function of the same name.
+func (r *functionRegistry) registerAggregate(f *AggregateFunction) error {
+	fn := *f
+	var err error
+	if fn.Name, err = checkName(f.Name); err != nil {
+		return err
+	}
+	if fn.New == nil {
+		return errfmt.Wrap(ErrInvalidFunction, fn.Name+" has no implementation")
+	}
+	if err := fn.signature().validate(); err != nil {
+		return err
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.funcs, fn.Name)
+	r.aggs[fn.Name] = &fn
+	return nil
+}
+
+// lookup returns the scalar function of the name.
+func (r *functionRegistry) lookup(name string) (*Function, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	f, ok := r.funcs[name]
+	return f, ok
+}
+
+// IsAggregate reports whether the function is a registered aggregate function.
+// It implements expr.AggregateFuncs.
+func (r *functionRegistry) IsAggregate(name string) bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	_, ok := r.aggs[name]
+	return ok
+}
+
+// NewAggregate returns the call of the registered aggregate function.
+// It implements expr.AggregateFuncs.
+func (r *functionRegistry) NewAggregate(name string, args []expr.Expr, distinct bool) (*expr.Aggregate, error) {
+	r.mutex.RLock()
+	f, ok := r.aggs[name]
+	r.mutex.RUnlock()
+	if !ok {
+		return nil, errfmt.Wrap(ErrNotSupportedFunction, name)
+	}
+	return f.bind(args, distinct)
+}
+
+// RegisterFunction adds the scalar function that the queries can call by its
+// name, replacing the function of the same name including the built-in one.
+// The prepared statements are planned again to call the new function.
+func (db *EgSQLDB) RegisterFunction(f *Function) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	if err := db.funcs.register(f); err != nil {
+		return err
+	}
+	db.version++
+	return nil
+}
+
+// RegisterAggregateFunction adds the aggregate function that the queries can
+// call by its name, replacing the scalar function of the same name. The
+// built-in aggregate functions can not be replaced.
+func (db *EgSQLDB) RegisterAggregateFunction(f *AggregateFunction) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	if err := db.funcs.registerAggregate(f); err != nil {
+		return err
+	}
+	db.version++
+	return nil
+}
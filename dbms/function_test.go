@@ -0,0 +1,244 @@
+package dbms
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nao1215/egsql/dbms/expr"
+	"github.com/nao1215/egsql/dbms/query"
+)
+
+func TestEgSQLDB_SelectBuiltinFunction(t *testing.T) {
+	now = func() time.Time { return time.Date(2024, 2, 29, 13, 45, 30, 0, time.UTC) }
+	t.Cleanup(func() { now = time.Now })
+
+	db, err := NewEgSQLDB(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sql := range []string{
+		"CREATE TABLE users (id INT PRIMARY KEY, name TEXT, nick TEXT, score INT)",
+		"INSERT INTO users VALUES (1, '  Alice ', NULL, -15), (2, 'Bob', 'bobby', 25)",
+	} {
+		if _, err := execSQL(t, db, sql); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		sql      string
+		args     []interface{}
+		wantRows [][]interface{}
+		wantErr  error
+	}{
+		{
+			name:     "[Success] string functions",
+			sql:      "SELECT UPPER(TRIM(name)), LOWER(name), LENGTH(name), SUBSTR(TRIM(name), 2), SUBSTR(name, 0, 4) FROM users ORDER BY id",
+			wantRows: [][]interface{}{{"ALICE", "  alice ", int64(8), "lice", "  A"}, {"BOB", "bob", int64(3), "ob", "Bob"}},
+		},
+		{
+			name:     "[Success] trim with characters and replace",
+			sql:      "SELECT LTRIM('xxhixx', 'x'), RTRIM('xxhixx', 'x'), TRIM('xxhixx', 'x'), REPLACE('a-b-c', '-', '+'), REPLACE('abc', '', 'x')",
+			wantRows: [][]interface{}{{"hixx", "xxhi", "hi", "a+b+c", "abc"}},
+		},
+		{
+			name:     "[Success] conditional functions",
+			sql:      "SELECT COALESCE(nick, name, 'none'), NULLIF(score, 25), COALESCE(?, id) FROM users ORDER BY id",
+			args:     []interface{}{nil},
+			wantRows: [][]interface{}{{"  Alice ", int64(-15), int64(1)}, {"bobby", nil, int64(2)}},
+		},
+		{
+			name:     "[Success] math functions",
+			sql:      "SELECT ABS(score), SIGN(score), ROUND(score, -1), ROUND(1234, -2), ROUND(score) FROM users ORDER BY id",
+			wantRows: [][]interface{}{{int64(15), int64(-1), int64(-20), int64(1200), int64(-15)}, {int64(25), int64(1), int64(30), int64(1200), int64(25)}},
+		},
+		{
+			name:     "[Success] function returns NULL for NULL argument",
+			sql:      "SELECT UPPER(nick), LENGTH(NULL), ABS(?) FROM users WHERE id = 1",
+			args:     []interface{}{nil},
+			wantRows: [][]interface{}{{nil, nil, nil}},
+		},
+		{
+			name: "[Success] date and time functions",
+			sql: "SELECT NOW(), DATE_TRUNC('month', NOW()), DATE_TRUNC('week', '2024-02-29'), DATE_TRUNC('hour', '2024-02-29T13:45:30Z'), " +
+				"STRFTIME('%Y/%m/%d %H:%M:%S %j %w %%', NOW()), STRFTIME('%s', '1970-01-02 00:00:00')",
+			wantRows: [][]interface{}{{
+				"2024-02-29 13:45:30", "2024-02-01 00:00:00", "2024-02-26 00:00:00", "2024-02-29 13:00:00",
+				"2024/02/29 13:45:30 060 4 %", "86400",
+			}},
+		},
+		{
+			name:     "[Success] function name is case insensitive",
+			sql:      "SELECT Length('héllo')",
+			wantRows: [][]interface{}{{int64(5)}},
+		},
+		{
+			name:    "[Error] wrong number of arguments",
+			sql:     "SELECT SUBSTR('abc')",
+			wantErr: ErrWrongNumberOfArgs,
+		},
+		{
+			name:    "[Error] argument of wrong type",
+			sql:     "SELECT ABS(name) FROM users",
+			wantErr: expr.ErrTypeMismatch,
+		},
+		{
+			name:    "[Error] arguments without common type",
+			sql:     "SELECT COALESCE(name, id) FROM users",
+			wantErr: expr.ErrTypeMismatch,
+		},
+		{
+			name:    "[Error] invalid timestamp",
+			sql:     "SELECT DATE_TRUNC('day', name) FROM users",
+			wantErr: ErrInvalidArgument,
+		},
+		{
+			name:    "[Error] unknown unit",
+			sql:     "SELECT DATE_TRUNC('decade', '2024-02-29')",
+			wantErr: ErrInvalidArgument,
+		},
+		{
+			name:    "[Error] unknown function",
+			sql:     "SELECT SLUGIFY(name) FROM users",
+			wantErr: ErrNotSupportedFunction,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stmt, _, err := query.Parse(tt.sql)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rs, err := db.Exec(nil, stmt, tt.args)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Exec() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(tt.wantRows, rs.Rows); diff != "" {
+				t.Errorf("Rows mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestEgSQLDB_RegisterFunction(t *testing.T) {
+	db, err := NewEgSQLDB(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	double := &Function{
+		Name: "Double", Params: []expr.Type{expr.Int}, MinArgs: 1, Result: expr.Int, Deterministic: true,
+		Fn: func(args []interface{}) (interface{}, error) { return args[0].(int64) * 2, nil },
+	}
+	if err := db.RegisterFunction(double); err != nil {
+		t.Fatal(err)
+	}
+	rs := querySQL(t, db, "SELECT double(21), DOUBLE('4')")
+	if diff := cmp.Diff([][]interface{}{{int64(42), int64(8)}}, rs.Rows); diff != "" {
+		t.Errorf("Rows mismatch (-want +got):\n%s", diff)
+	}
+
+	tests := []struct {
+		name string
+		f    *Function
+	}{
+		{name: "[Error] aggregate function name", f: &Function{Name: "sum", Fn: double.Fn}},
+		{name: "[Error] no implementation", f: &Function{Name: "f"}},
+		{name: "[Error] more required arguments than parameters", f: &Function{Name: "f", MinArgs: 1, Fn: double.Fn}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := db.RegisterFunction(tt.f); !errors.Is(err, ErrInvalidFunction) {
+				t.Errorf("RegisterFunction() error = %v, want %v", err, ErrInvalidFunction)
+			}
+		})
+	}
+}
+
+// concatAcc joins the strings with ",".
+type concatAcc struct {
+	values []string
+}
+
+func (a *concatAcc) Step(args []interface{}) error {
+	a.values = append(a.values, args[0].(string))
+	return nil
+}
+
+func (a *concatAcc) Result() (interface{}, error) {
+	return strings.Join(a.values, ","), nil
+}
+
+func TestEgSQLDB_RegisterAggregateFunction(t *testing.T) {
+	db, err := NewEgSQLDB(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sql := range []string{
+		"CREATE TABLE pets (id INT PRIMARY KEY, kind TEXT, name TEXT)",
+		"INSERT INTO pets VALUES (1, 'cat', 'tama'), (2, 'dog', 'pochi'), (3, 'cat', NULL), (4, 'cat', 'tama'), (5, 'dog', 'shiro')",
+	} {
+		if _, err := execSQL(t, db, sql); err != nil {
+			t.Fatal(err)
+		}
+	}
+	agg := &AggregateFunction{
+		Name: "group_concat", Params: []expr.Type{expr.Varchar}, MinArgs: 1, Result: expr.Varchar,
+		New: func() expr.Accumulator { return &concatAcc{} },
+	}
+	if err := db.RegisterAggregateFunction(agg); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		sql      string
+		wantRows [][]interface{}
+		wantErr  error
+	}{
+		{
+			name:     "[Success] group by",
+			sql:      "SELECT kind, GROUP_CONCAT(name), GROUP_CONCAT(DISTINCT name) FROM pets GROUP BY kind ORDER BY kind",
+			wantRows: [][]interface{}{{"cat", "tama,tama", "tama"}, {"dog", "pochi,shiro", "pochi,shiro"}},
+		},
+		{
+			name:     "[Success] window",
+			sql:      "SELECT id, GROUP_CONCAT(kind) OVER (ORDER BY id ROWS BETWEEN 1 PRECEDING AND CURRENT ROW) FROM pets WHERE id < 4 ORDER BY id",
+			wantRows: [][]interface{}{{int64(1), "cat"}, {int64(2), "cat,dog"}, {int64(3), "dog,cat"}},
+		},
+		{
+			name:    "[Error] aggregate function in WHERE clause",
+			sql:     "SELECT id FROM pets WHERE GROUP_CONCAT(name) = ''",
+			wantErr: expr.ErrMisplacedAggregate,
+		},
+		{
+			name:    "[Error] wrong type of argument",
+			sql:     "SELECT GROUP_CONCAT(id) FROM pets",
+			wantErr: expr.ErrTypeMismatch,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stmt, _, err := query.Parse(tt.sql)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rs, err := db.Exec(nil, stmt, nil)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Exec() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(tt.wantRows, rs.Rows); diff != "" {
+				t.Errorf("Rows mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
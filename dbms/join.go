@@ -0,0 +1,399 @@
+package dbms
+
+import (
+	"fmt"
+
+	"github.com/nao1215/egsql/dbms/executor"
+	"github.com/nao1215/egsql/dbms/expr"
+	"github.com/nao1215/egsql/dbms/meta"
+	"github.com/nao1215/egsql/dbms/query"
+	"github.com/nao1215/egsql/dbms/storage"
+	"github.com/nao1215/egsql/misc/errfmt"
+)
+
+// relation is the planned FROM clause: the operator that returns the rows
+// and the columns of the rows.
+type relation struct {
+	plan    executor.Operator
+	columns expr.Columns
+	// star is the positions of the columns that "*" is expanded to.
+	star []int
+	// table is the table whose rows plan returns as they are, or nil.
+	// The index nested loop join looks up the rows by its indexes.
+	table *storage.Table
+}
+
+// planFrom plans FROM clause.
+func (p *planner) planFrom(te query.TableExpr) (*relation, error) {
+	switch v := te.(type) {
+	case nil:
+		// SELECT without FROM returns one row of the select list.
+		return &relation{plan: &executor.Values{Rows: [][]interface{}{{}}}}, nil
+	case *query.TableRef:
+		return p.planTable(v)
+	case *query.DerivedTable:
+		return p.planDerivedTable(v)
+	case *query.JoinExpr:
+		return p.planJoin(v)
+	}
+	return nil, errfmt.Wrap(ErrNotSupportedExpr, fmt.Sprintf("%T", te))
+}
+
+// planTable plans the common table expression, the table or the system view.
+// Its columns are qualified with the alias, or the name without the schema name.
+func (p *planner) planTable(ref *query.TableRef) (*relation, error) {
+	if c := p.lookupCTE(ref.Name); c != nil {
+		return p.planCTE(c, aliasOr(ref.Alias, ref.Name.Name))
+	}
+	scheme, rows, table, err := p.db.scanRelation(p.sess, ref.Name)
+	if err != nil {
+		return nil, err
+	}
+	_, name := meta.SplitQualifiedName(scheme.TableName)
+	alias := aliasOr(ref.Alias, name)
+	values := &executor.Values{Rows: toValues(rows), Table: scheme.TableName}
+	p.rebind(func() error {
+		_, rows, _, err := p.db.scanRelation(p.sess, ref.Name)
+		values.Rows = toValues(rows)
+		return err
+	})
+	r := &relation{plan: values, table: table}
+	for i, c := range scheme.ColumnNames {
+		r.columns = append(r.columns, expr.ColumnInfo{Table: alias, Name: c, T: expr.TypeOf(scheme.ColumnDataTypes[i])})
+		r.star = append(r.star, i)
+	}
+	return r, nil
+}
+
+// planDerivedTable plans the subquery in FROM clause. Its columns are
+// qualified with the alias. It is a part of the query, so it is evaluated
+// in the same environment and is correlated if it references the outer queries.
+func (p *planner) planDerivedTable(d *query.DerivedTable) (*relation, error) {
+	sub := &planner{db: p.db, sess: p.sess, ctx: p.ctx, env: p.env, outer: p.outer, ctes: p.ctes, bound: p.bound}
+	r, err := sub.planSelect(d.Select)
+	if err != nil {
+		return nil, err
+	}
+	if sub.correlated {
+		p.correlated = true
+	}
+	for i := range r.columns {
+		r.columns[i].Table = d.Alias
+	}
+	return r, nil
+}
+
+// planJoin plans the join. The joined row is the left row followed by the
+// right row. For USING and NATURAL, the columns of the same name are merged
+// into one column without the table name, which "*" is expanded to instead of them.
+func (p *planner) planJoin(j *query.JoinExpr) (*relation, error) {
+	left, err := p.planFrom(j.Left)
+	if err != nil {
+		return nil, err
+	}
+	right, err := p.planFrom(j.Right)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkAliases(left.columns, right.columns); err != nil {
+		return nil, err
+	}
+
+	lw := len(left.columns)
+	r := &relation{columns: append(append(expr.Columns{}, left.columns...), right.columns...)}
+	var cond expr.Expr
+	var merged []expr.Expr
+	using := j.Using
+	switch {
+	case j.Natural || len(j.Using) > 0:
+		if j.Natural {
+			using = commonColumns(left.columns, right.columns)
+		}
+		if cond, merged, err = r.mergeUsing(left, right, using, j.Type); err != nil {
+			return nil, err
+		}
+	case j.On != nil:
+		if cond, err = p.binder(r.columns).BindCondition(j.On); err != nil {
+			return nil, err
+		}
+		r.star = append(append(r.star, left.star...), offset(right.star, lw)...)
+	default:
+		r.star = append(append(r.star, left.star...), offset(right.star, lw)...)
+	}
+
+	r.plan = planJoinOperator(left, right, cond, joinTypeOf(j.Type), p.env)
+	if len(merged) > 0 {
+		// The merged columns are appended to the joined row.
+		exprs := make([]expr.Expr, 0, len(r.columns)+len(merged))
+		for i, c := range r.columns {
+			exprs = append(exprs, &expr.Column{Index: i, Name: c.Name, T: c.T})
+		}
+		r.plan = &executor.Project{Input: r.plan, Exprs: append(exprs, merged...), Env: p.env}
+		for i, m := range merged {
+			r.columns = append(r.columns, expr.ColumnInfo{Name: using[i], T: m.Type()})
+		}
+	}
+	return r, nil
+}
+
+// mergeUsing returns the condition of JOIN USING and the expressions of the
+// merged columns, and sets r.star. The columns of the names are hidden, so
+// that the names without the table name reference the merged columns.
+func (r *relation) mergeUsing(left, right *relation, using []string, typ query.JoinType) (expr.Expr, []expr.Expr, error) {
+	lw := len(left.columns)
+	var conds, merged []expr.Expr
+	usedLeft, usedRight := make(map[int]bool), make(map[int]bool)
+	for _, name := range using {
+		li, lt, err := left.columns.Lookup("", name)
+		if err != nil {
+			return nil, nil, err
+		}
+		ri, rt, err := right.columns.Lookup("", name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if usedLeft[li] {
+			return nil, nil, errfmt.Wrap(ErrDuplicateColumn, name)
+		}
+		usedLeft[li], usedRight[ri] = true, true
+		eq, err := expr.NewComparison("=",
+			&expr.Column{Index: li, Name: name, T: lt},
+			&expr.Column{Index: lw + ri, Name: name, T: rt})
+		if err != nil {
+			return nil, nil, err
+		}
+		conds = append(conds, eq)
+		merged = append(merged, mergedColumn(eq.(*expr.Comparison), typ))
+		r.columns[li].Hidden = true
+		r.columns[lw+ri].Hidden = true
+	}
+
+	// The merged columns are after the joined row.
+	for i := range merged {
+		r.star = append(r.star, len(r.columns)+i)
+	}
+	for _, p := range left.star {
+		if !usedLeft[p] {
+			r.star = append(r.star, p)
+		}
+	}
+	for _, p := range right.star {
+		if !usedRight[p] {
+			r.star = append(r.star, lw+p)
+		}
+	}
+	return expr.And(conds...), merged, nil
+}
+
+// mergedColumn returns the value of the column merged by JOIN USING:
+// the left value, the right value for RIGHT JOIN, or the value that is not
+// NULL for FULL JOIN.
+func mergedColumn(eq *expr.Comparison, typ query.JoinType) expr.Expr {
+	switch typ {
+	case query.RightJoin:
+		return eq.Right
+	case query.FullJoin:
+		return &expr.Case{
+			Whens: []expr.When{{Cond: &expr.IsNull{Expr: eq.Left, Not: true}, Result: eq.Left}},
+			Else:  eq.Right,
+			T:     eq.Left.Type(),
+		}
+	}
+	return eq.Left
+}
+
+// commonColumns returns the names of the columns that both sides of
+// NATURAL JOIN have, in the order of the left columns.
+func commonColumns(left, right expr.Columns) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, c := range left {
+		if c.Hidden || seen[c.Name] {
+			continue
+		}
+		seen[c.Name] = true
+		for _, rc := range right {
+			if !rc.Hidden && rc.Name == c.Name {
+				names = append(names, c.Name)
+				break
+			}
+		}
+	}
+	return names
+}
+
+// checkAliases checks that the same table name does not qualify the
+// columns of both sides of the join.
+func checkAliases(left, right expr.Columns) error {
+	names := make(map[string]bool)
+	for _, c := range left {
+		if c.Table != "" {
+			names[c.Table] = true
+		}
+	}
+	for _, c := range right {
+		if names[c.Table] {
+			return errfmt.Wrap(ErrDuplicateAlias, c.Table)
+		}
+	}
+	return nil
+}
+
+// offset returns the positions added n.
+func offset(positions []int, n int) []int {
+	result := make([]int, len(positions))
+	for i, p := range positions {
+		result[i] = p + n
+	}
+	return result
+}
+
+// joinTypeOf returns the join type of the operator. CROSS JOIN is the inner
+// join without condition.
+func joinTypeOf(t query.JoinType) executor.JoinType {
+	switch t {
+	case query.LeftJoin:
+		return executor.LeftJoin
+	case query.RightJoin:
+		return executor.RightJoin
+	case query.FullJoin:
+		return executor.FullJoin
+	default:
+		return executor.InnerJoin
+	}
+}
+
+// equiKey is the comparison "=" of the join condition, whose one side
+// references only the left columns and the other side references the right columns.
+type equiKey struct {
+	left  expr.Expr
+	right expr.Expr
+	cond  expr.Expr
+}
+
+// equiKeys splits the join condition into the equi-join keys and the rest.
+// leftWidth is the number of the left columns.
+func equiKeys(cond expr.Expr, leftWidth int) ([]equiKey, []expr.Expr) {
+	var keys []equiKey
+	var rest []expr.Expr
+	for _, c := range expr.Conjuncts(cond) {
+		cmp, ok := c.(*expr.Comparison)
+		if ok && cmp.Op == "=" {
+			l, r := sideOf(cmp.Left, leftWidth), sideOf(cmp.Right, leftWidth)
+			if l&rightSide == 0 && r == rightSide {
+				keys = append(keys, equiKey{left: cmp.Left, right: cmp.Right, cond: c})
+				continue
+			}
+			if r&rightSide == 0 && l == rightSide {
+				keys = append(keys, equiKey{left: cmp.Right, right: cmp.Left, cond: c})
+				continue
+			}
+		}
+		rest = append(rest, c)
+	}
+	return keys, rest
+}
+
+const (
+	// leftSide means that the expression references a left column.
+	leftSide = 1 << iota
+	// rightSide means that the expression references a right column.
+	rightSide
+)
+
+// sideOf returns the sides of the columns that the expression references.
+// The expression that has a subquery is on both sides, because the subquery
+// can reference any column of the joined row.
+func sideOf(e expr.Expr, leftWidth int) int {
+	if !isLocal(e) {
+		return leftSide | rightSide
+	}
+	side := 0
+	for _, p := range expr.ColumnsOf(e) {
+		if p < leftWidth {
+			side |= leftSide
+		} else {
+			side |= rightSide
+		}
+	}
+	return side
+}
+
+// planJoinOperator returns the join operator. The index nested loop join is
+// used if the right relation is a table that has the index on the columns
+// compared with the left row by "=", the hash join is used if there is any
+// such comparison, and the nested loop join is used otherwise.
+func planJoinOperator(left, right *relation, cond expr.Expr, typ executor.JoinType, env *expr.Env) executor.Operator {
+	lw, rw := len(left.columns), len(right.columns)
+	keys, rest := equiKeys(cond, lw)
+	if op := planIndexJoin(left, right, keys, rest, typ, env); op != nil {
+		return op
+	}
+	if len(keys) > 0 {
+		j := &executor.HashJoin{
+			Left: left.plan, Right: right.plan, LeftWidth: lw, RightWidth: rw,
+			Cond: expr.And(rest...), Type: typ, Env: env,
+		}
+		for _, k := range keys {
+			j.LeftKeys = append(j.LeftKeys, k.left)
+			j.RightKeys = append(j.RightKeys, k.right)
+		}
+		return j
+	}
+	return &executor.NestedLoopJoin{
+		Left: left.plan, Right: right.plan, LeftWidth: lw, RightWidth: rw,
+		Cond: cond, Type: typ, Env: env,
+	}
+}
+
+// planIndexJoin returns the index nested loop join using the index whose
+// columns are all compared with the left row, or nil if there is no such
+// index. The index of the most columns is used.
+func planIndexJoin(left, right *relation, keys []equiKey, rest []expr.Expr, typ executor.JoinType, env *expr.Env) executor.Operator {
+	if right.table == nil || (typ != executor.InnerJoin && typ != executor.LeftJoin) {
+		return nil
+	}
+	lw := len(left.columns)
+	// byColumn is the position of the key in keys for the position of the table column.
+	byColumn := make(map[int]int)
+	for i, k := range keys {
+		if c, ok := k.right.(*expr.Column); ok {
+			if _, dup := byColumn[c.Index-lw]; !dup {
+				byColumn[c.Index-lw] = i
+			}
+		}
+	}
+	scheme := right.table.Scheme()
+	var best *meta.Index
+	for i, idx := range scheme.Indexes {
+		covered := true
+		for _, c := range idx.Columns {
+			if _, ok := byColumn[scheme.ColumnIndex(c)]; !ok {
+				covered = false
+				break
+			}
+		}
+		if covered && (best == nil || len(idx.Columns) > len(best.Columns)) {
+			best = &scheme.Indexes[i]
+		}
+	}
+	if best == nil {
+		return nil
+	}
+
+	j := &executor.IndexJoin{Left: left.plan, LeftWidth: lw, Table: right.table, Index: best.Name, Type: typ, Env: env}
+	used := make(map[int]bool)
+	for _, c := range best.Columns {
+		i := byColumn[scheme.ColumnIndex(c)]
+		j.Keys = append(j.Keys, keys[i].left)
+		used[i] = true
+	}
+	// The comparisons not used for the lookup are checked for the joined rows.
+	for i, k := range keys {
+		if !used[i] {
+			rest = append(rest, k.cond)
+		}
+	}
+	j.Cond = expr.And(rest...)
+	return j
+}
@@ -0,0 +1,211 @@
+package meta
+
+import "strings"
+
+// Clone returns a deep copy of the scheme. ALTER TABLE changes the copy so that
+// the scheme in the catalog is not changed until the new catalog is persisted.
+func (s *Scheme) Clone() *Scheme {
+	c := &Scheme{
+		TableName:       s.TableName,
+		ColumnNames:     append([]string{}, s.ColumnNames...),
+		ColumnDataTypes: append([]DataType{}, s.ColumnDataTypes...),
+		PrimaryKey:      append(KeyColumns{}, s.PrimaryKey...),
+	}
+	for _, u := range s.Uniques {
+		c.Uniques = append(c.Uniques, append(KeyColumns{}, u...))
+	}
+	for _, idx := range s.Indexes {
+		idx.Columns = append([]string{}, idx.Columns...)
+		c.Indexes = append(c.Indexes, idx)
+	}
+	for _, fk := range s.ForeignKeys {
+		fk.Columns = append([]string{}, fk.Columns...)
+		fk.RefColumns = append([]string{}, fk.RefColumns...)
+		c.ForeignKeys = append(c.ForeignKeys, fk)
+	}
+	if s.Defaults != nil {
+		c.Defaults = make(map[string]string, len(s.Defaults))
+		for k, v := range s.Defaults {
+			c.Defaults[k] = v
+		}
+	}
+	if s.Identity != nil {
+		id := *s.Identity
+		c.Identity = &id
+	}
+	return c
+}
+
+// AddColumn adds the column to the end of the columns.
+func (s *Scheme) AddColumn(name string, dataType DataType) error {
+	if name == "" {
+		return ErrEmptyColumnName
+	}
+	if s.ColumnIndex(name) >= 0 {
+		return ErrExistColumn
+	}
+	s.ColumnNames = append(s.ColumnNames, name)
+	s.ColumnDataTypes = append(s.ColumnDataTypes, dataType)
+	return nil
+}
+
+// DropColumn removes the column and the UNIQUE constraints, FOREIGN KEY
+// constraints and indexes that include it. The column of the primary key
+// and the last column can not be dropped.
+func (s *Scheme) DropColumn(name string) error {
+	i := s.ColumnIndex(name)
+	if i < 0 {
+		return ErrNotExistColumn
+	}
+	if s.PrimaryKey.Contains(name) {
+		return ErrDropKeyColumn
+	}
+	if len(s.ColumnNames) == 1 {
+		return ErrColumnBelowMinNum
+	}
+
+	s.ColumnNames = append(s.ColumnNames[:i:i], s.ColumnNames[i+1:]...)
+	s.ColumnDataTypes = append(s.ColumnDataTypes[:i:i], s.ColumnDataTypes[i+1:]...)
+
+	var uniques []KeyColumns
+	for _, u := range s.Uniques {
+		if !u.Contains(name) {
+			uniques = append(uniques, u)
+		}
+	}
+	s.Uniques = uniques
+
+	var indexes []Index
+	for _, idx := range s.Indexes {
+		if !KeyColumns(idx.Columns).Contains(name) {
+			indexes = append(indexes, idx)
+		}
+	}
+	s.Indexes = indexes
+
+	var fks []ForeignKey
+	for _, fk := range s.ForeignKeys {
+		if KeyColumns(fk.Columns).Contains(name) {
+			continue
+		}
+		if fk.RefTable == s.TableName && KeyColumns(fk.RefColumns).Contains(name) {
+			continue
+		}
+		fks = append(fks, fk)
+	}
+	s.ForeignKeys = fks
+
+	s.deleteDefault(name)
+	if s.Identity != nil && s.Identity.Column == name {
+		s.Identity = nil
+	}
+	return nil
+}
+
+// RenameColumn renames the column and the references to it in the
+// constraints and indexes. The names of the constraints and indexes are not changed.
+func (s *Scheme) RenameColumn(oldName, newName string) error {
+	i := s.ColumnIndex(oldName)
+	if i < 0 {
+		return ErrNotExistColumn
+	}
+	if newName == "" {
+		return ErrEmptyColumnName
+	}
+	if s.ColumnIndex(newName) >= 0 {
+		return ErrExistColumn
+	}
+
+	s.ColumnNames[i] = newName
+	renameIn(s.PrimaryKey, oldName, newName)
+	for _, u := range s.Uniques {
+		renameIn(u, oldName, newName)
+	}
+	for _, idx := range s.Indexes {
+		renameIn(idx.Columns, oldName, newName)
+	}
+	for _, fk := range s.ForeignKeys {
+		renameIn(fk.Columns, oldName, newName)
+	}
+	s.RenameRefColumn(s.TableName, oldName, newName)
+
+	if v, ok := s.Defaults[oldName]; ok {
+		delete(s.Defaults, oldName)
+		s.Defaults[newName] = v
+	}
+	if s.Identity != nil && s.Identity.Column == oldName {
+		s.Identity.Column = newName
+	}
+	return nil
+}
+
+// Rename renames the table. The FOREIGN KEY constraints referencing the
+// table itself follow the new name, and so do the names of the indexes and
+// the constraints generated from the table name, so that a new table of the
+// old name does not get the same names. The identity sequence is renamed by
+// the database, which knows the names of the other sequences.
+func (s *Scheme) Rename(tableName string) {
+	s.RenameRefTable(s.TableName, tableName)
+	for i := range s.Indexes {
+		s.Indexes[i].Name = renameGenerated(s.Indexes[i].Name, s.TableName, tableName)
+	}
+	for i := range s.ForeignKeys {
+		s.ForeignKeys[i].Name = renameGenerated(s.ForeignKeys[i].Name, s.TableName, tableName)
+		s.ForeignKeys[i].Index = renameGenerated(s.ForeignKeys[i].Index, s.TableName, tableName)
+	}
+	s.TableName = tableName
+}
+
+// renameGenerated replaces oldTable in the name generated from the table name
+// ("<table>_pkey", "<table>_<columns>_key[N]" or "<table>_<columns>_fkey")
+// with newTable. The other names are returned as they are.
+func renameGenerated(name, oldTable, newTable string) string {
+	if !strings.HasPrefix(name, oldTable+"_") {
+		return name
+	}
+	base := strings.TrimRight(name, "0123456789")
+	if !strings.HasSuffix(base, "_pkey") && !strings.HasSuffix(base, "_key") && !strings.HasSuffix(base, "_fkey") {
+		return name
+	}
+	return newTable + strings.TrimPrefix(name, oldTable)
+}
+
+// RenameRefTable changes the referenced table name of the FOREIGN KEY
+// constraints from oldName to newName.
+func (s *Scheme) RenameRefTable(oldName, newName string) {
+	for i := range s.ForeignKeys {
+		if s.ForeignKeys[i].RefTable == oldName {
+			s.ForeignKeys[i].RefTable = newName
+		}
+	}
+}
+
+// RenameRefColumn changes the referenced column name of the FOREIGN KEY
+// constraints referencing the table from oldName to newName.
+func (s *Scheme) RenameRefColumn(tableName, oldName, newName string) {
+	for _, fk := range s.ForeignKeys {
+		if fk.RefTable == tableName {
+			renameIn(fk.RefColumns, oldName, newName)
+		}
+	}
+}
+
+// References reports whether the scheme has the FOREIGN KEY constraint
+// referencing the column of the table.
+func (s *Scheme) References(tableName, column string) bool {
+	for _, fk := range s.ForeignKeys {
+		if fk.RefTable == tableName && KeyColumns(fk.RefColumns).Contains(column) {
+			return true
+		}
+	}
+	return false
+}
+
+// renameIn replaces oldName in the columns with newName.
+func renameIn(columns []string, oldName, newName string) {
+	for i := range columns {
+		if columns[i] == oldName {
+			columns[i] = newName
+		}
+	}
+}
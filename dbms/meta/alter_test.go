@@ -0,0 +1,163 @@
+package meta
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// newTestUsers returns the scheme of users(id, name, group_id) with
+// UNIQUE (name, group_id), the self-referencing FOREIGN KEY (group_id)
+// and DEFAULT 0 for group_id.
+func newTestUsers(t *testing.T) *Scheme {
+	t.Helper()
+
+	s, err := NewScheme("users", []string{"id", "name", "group_id"}, []DataType{Int, Varchar, Int}, "id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddUnique("name", "group_id"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddForeignKey(ForeignKey{Columns: []string{"group_id"}, RefTable: "users", RefColumns: []string{"id"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetDefault("group_id", int64(0)); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestScheme_Clone(t *testing.T) {
+	s := newTestUsers(t)
+	c := s.Clone()
+	if diff := cmp.Diff(s, c); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	if err := c.RenameColumn("group_id", "team_id"); err != nil {
+		t.Fatal(err)
+	}
+	c.Rename("members")
+	if diff := cmp.Diff(newTestUsers(t), s); diff != "" {
+		t.Errorf("original scheme is changed (-want +got):\n%s", diff)
+	}
+}
+
+func TestScheme_Rename(t *testing.T) {
+	s := newTestUsers(t)
+	if err := s.AddForeignKey(ForeignKey{Name: "owner", Columns: []string{"id"}, RefTable: "owners"}); err != nil {
+		t.Fatal(err)
+	}
+	s.Rename("members")
+
+	var indexes []string
+	for _, idx := range s.Indexes {
+		indexes = append(indexes, idx.Name)
+	}
+	want := []string{"members_pkey", "members_name_group_id_key", "members_group_id_fkey"}
+	if diff := cmp.Diff(want, indexes); diff != "" {
+		t.Errorf("index names mismatch (-want +got):\n%s", diff)
+	}
+	got := []ForeignKey{
+		{Name: s.ForeignKeys[0].Name, RefTable: s.ForeignKeys[0].RefTable, Index: s.ForeignKeys[0].Index},
+		{Name: s.ForeignKeys[1].Name, RefTable: s.ForeignKeys[1].RefTable, Index: s.ForeignKeys[1].Index},
+	}
+	wantFKs := []ForeignKey{
+		{Name: "members_group_id_fkey", RefTable: "members", Index: "members_group_id_fkey"},
+		{Name: "owner", RefTable: "owners", Index: "members_pkey"},
+	}
+	if diff := cmp.Diff(wantFKs, got); diff != "" {
+		t.Errorf("foreign keys mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestScheme_DropColumn(t *testing.T) {
+	tests := []struct {
+		name    string
+		column  string
+		want    func(s *Scheme)
+		wantErr error
+	}{
+		{
+			name:   "[Success] drop column with constraints",
+			column: "group_id",
+			want: func(s *Scheme) {
+				s.ColumnNames = []string{"id", "name"}
+				s.ColumnDataTypes = []DataType{Int, Varchar}
+				s.Uniques = nil
+				s.Indexes = s.Indexes[:1]
+				s.ForeignKeys = nil
+				s.Defaults = nil
+			},
+		},
+		{
+			name:   "[Success] drop column in unique",
+			column: "name",
+			want: func(s *Scheme) {
+				s.ColumnNames = []string{"id", "group_id"}
+				s.ColumnDataTypes = []DataType{Int, Int}
+				s.Uniques = nil
+				s.Indexes = []Index{s.Indexes[0], s.Indexes[2]}
+			},
+		},
+		{
+			name:    "[Error] drop primary key column",
+			column:  "id",
+			wantErr: ErrDropKeyColumn,
+		},
+		{
+			name:    "[Error] not exist column",
+			column:  "email",
+			wantErr: ErrNotExistColumn,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestUsers(t)
+			err := s.DropColumn(tt.column)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("DropColumn() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			want := newTestUsers(t)
+			tt.want(want)
+			if diff := cmp.Diff(want, s); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestScheme_RenameColumn(t *testing.T) {
+	s := newTestUsers(t)
+	if err := s.RenameColumn("id", "name"); !errors.Is(err, ErrExistColumn) {
+		t.Errorf("RenameColumn() error = %v, wantErr %v", err, ErrExistColumn)
+	}
+	if err := s.RenameColumn("id", "user_id"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RenameColumn("group_id", "team_id"); err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(KeyColumns{"user_id"}, s.PrimaryKey); diff != "" {
+		t.Errorf("PrimaryKey mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]KeyColumns{{"name", "team_id"}}, s.Uniques); diff != "" {
+		t.Errorf("Uniques mismatch (-want +got):\n%s", diff)
+	}
+	fk := s.ForeignKeys[0]
+	if diff := cmp.Diff([]string{"team_id"}, fk.Columns); diff != "" {
+		t.Errorf("FOREIGN KEY columns mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"user_id"}, fk.RefColumns); diff != "" {
+		t.Errorf("FOREIGN KEY referenced columns mismatch (-want +got):\n%s", diff)
+	}
+	if got := s.DefaultValue("team_id"); got != int64(0) {
+		t.Errorf("DefaultValue() = %v, want 0", got)
+	}
+}
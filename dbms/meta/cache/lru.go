@@ -32,28 +32,32 @@ func NewLRU(cap int) *LRU {
 	}
 }
 
-// Insert adds data to the LRU. If capacity is exceeded, return oldest data. otherwise, return nil.
+// Insert adds data to the LRU. If the key exists, its value is replaced.
+// If capacity is exceeded, return the value of the oldest data, which is removed.
+// otherwise, return nil.
 func (l *LRU) Insert(key, value interface{}) interface{} {
 	l.mutex.Lock()
 	defer l.mutex.Unlock()
 
-	var victim interface{}
-	entry := &entry{key, value}
-	elment := l.evictList.PushFront(entry)
-	l.items[key] = elment
+	if element, ok := l.items[key]; ok {
+		element.Value.(*entry).value = value
+		l.evictList.MoveToFront(element)
+		return nil
+	}
+	l.items[key] = l.evictList.PushFront(&entry{key, value})
 
 	if l.needEvict() {
-		victim = l.evictList.Back()
-		l.removeOldest()
+		return l.removeOldest()
 	}
-	return victim
+	return nil
 }
 
-// Get returns the value corresponding to the key.
-// If there is no corresponding value, nil is returned.
+// Get returns the value corresponding to the key, and marks it as the most
+// recently used. If there is no corresponding value, nil is returned.
 func (l *LRU) Get(key interface{}) interface{} {
-	l.mutex.RLock()
-	defer l.mutex.RUnlock()
+	// Get moves the element in the eviction list, so it needs the write lock.
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
 
 	if element, ok := l.items[key]; ok {
 		l.evictList.MoveToFront(element)
@@ -62,21 +66,49 @@ func (l *LRU) Get(key interface{}) interface{} {
 	return nil
 }
 
+// Remove removes the data corresponding to the key, and returns its value.
+// If there is no corresponding value, nil is returned.
+func (l *LRU) Remove(key interface{}) interface{} {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	element, ok := l.items[key]
+	if !ok {
+		return nil
+	}
+	l.evictList.Remove(element)
+	delete(l.items, key)
+	return element.Value.(*entry).value
+}
+
+// Purge removes all data.
+func (l *LRU) Purge() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.evictList.Init()
+	l.items = make(map[interface{}]*list.Element)
+}
+
 // Len return length of eviction list.
 func (l *LRU) Len() int {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
 	return l.evictList.Len()
 }
 
 // needEvict returns whether eviction is necessary
 func (l *LRU) needEvict() bool {
-	return l.Len() > l.capacity
+	return l.evictList.Len() > l.capacity
 }
 
-// removeOldest removes the oldest element in the eviction list.
-func (l *LRU) removeOldest() {
+// removeOldest removes the oldest element in the eviction list, and returns its value.
+func (l *LRU) removeOldest() interface{} {
 	elm := l.evictList.Back()
-	if elm != nil {
-		l.evictList.Remove(elm)
-		delete(l.items, elm.Value.(*entry).key)
+	if elm == nil {
+		return nil
 	}
+	l.evictList.Remove(elm)
+	delete(l.items, elm.Value.(*entry).key)
+	return elm.Value.(*entry).value
 }
@@ -1,7 +1,6 @@
 package cache
 
 import (
-	"container/list"
 	"sync"
 	"testing"
 )
@@ -23,15 +22,64 @@ func TestLRU_Insert(t *testing.T) {
 		}
 
 		want := 100
-		wantKey := "key1"
 		got := lru.Insert("key2", 1000)
-		if got.(*list.Element).Value.(*entry).value.(int) != want {
-			t.Errorf("mismatch want:%d, got:%d", want, got.(*list.Element).Value.(*entry).value.(int))
+		if got != want {
+			t.Errorf("mismatch want:%d, got:%v", want, got)
 		}
-		if got.(*list.Element).Value.(*entry).key.(string) != wantKey {
-			t.Errorf("mismatch want:%s, got:%s", wantKey, got.(*list.Element).Value.(*entry).key.(string))
+		if lru.Get("key1") != nil {
+			t.Errorf("victim key1 is not removed")
 		}
 	})
+
+	t.Run("[Success] Insert existing key replaces the value", func(t *testing.T) {
+		lru := NewLRU(2)
+		lru.Insert("key1", 100)
+		lru.Insert("key2", 200)
+		if got := lru.Insert("key1", 101); got != nil {
+			t.Errorf("Insert result(=%v) is not nil", got)
+		}
+		if lru.Len() != 2 {
+			t.Errorf("mismatch want:2, got:%d", lru.Len())
+		}
+		// key2 is the oldest because key1 is inserted again.
+		if got := lru.Insert("key3", 300); got != 200 {
+			t.Errorf("mismatch want:200, got:%v", got)
+		}
+		if got := lru.Get("key1"); got != 101 {
+			t.Errorf("mismatch want:101, got:%v", got)
+		}
+	})
+
+	t.Run("[Success] Get marks the data as recently used", func(t *testing.T) {
+		lru := NewLRU(2)
+		lru.Insert("key1", 100)
+		lru.Insert("key2", 200)
+		lru.Get("key1")
+		if got := lru.Insert("key3", 300); got != 200 {
+			t.Errorf("mismatch want:200, got:%v", got)
+		}
+	})
+}
+
+func TestLRU_Remove(t *testing.T) {
+	lru := NewLRU(3)
+	lru.Insert("key1", 100)
+	lru.Insert("key2", 200)
+
+	if got := lru.Remove("key1"); got != 100 {
+		t.Errorf("mismatch want:100, got:%v", got)
+	}
+	if got := lru.Remove("key1"); got != nil {
+		t.Errorf("mismatch want:nil, got:%v", got)
+	}
+	if lru.Len() != 1 {
+		t.Errorf("mismatch want:1, got:%d", lru.Len())
+	}
+
+	lru.Purge()
+	if lru.Len() != 0 || lru.Get("key2") != nil {
+		t.Errorf("data is left after Purge")
+	}
 }
 
 func TestLRU_Get(t *testing.T) {
@@ -12,4 +12,28 @@ var (
 	// ErrInvalidPrimaryKey means that the primary key is invalid.
 	// For example, if you specify a column name that does not exist.
 	ErrInvalidPrimaryKey = errors.New("invalid primary key")
+	// ErrEmptyKey means that a key (e.g. UNIQUE constraint) has no columns.
+	ErrEmptyKey = errors.New("key has no columns")
+	// ErrNotExistColumn means that the specified column does not exist in the table.
+	ErrNotExistColumn = errors.New("column does not exist")
+	// ErrDuplicateKeyColumn means that the same column is specified more than once in a key.
+	ErrDuplicateKeyColumn = errors.New("column is specified more than once in the key")
+	// ErrDuplicateConstraint means that the same constraint is already defined in the table.
+	ErrDuplicateConstraint = errors.New("constraint already exists")
+	// ErrInvalidForeignKey means that the FOREIGN KEY constraint is invalid.
+	// For example, if SET NULL action is specified for the primary key column.
+	ErrInvalidForeignKey = errors.New("invalid foreign key")
+	// ErrNotMatchRefColumnNum means that "'number of referencing columns' and 'number of referenced columns' do not match"
+	ErrNotMatchRefColumnNum = errors.New("'number of referencing columns' and 'number of referenced columns' do not match")
+	// ErrInvalidIdentity means that the identity column is not Int column.
+	ErrInvalidIdentity = errors.New("identity column must be int")
+	// ErrInvalidSequence means that the sequence definition is invalid.
+	// For example, if the increment is not positive.
+	ErrInvalidSequence = errors.New("invalid sequence")
+	// ErrExistColumn means that the column with the same name already exists in the table.
+	ErrExistColumn = errors.New("column already exists")
+	// ErrDropKeyColumn means that the column of the primary key is dropped.
+	ErrDropKeyColumn = errors.New("cannot drop column of primary key")
+	// ErrInvalidDefault means that the default value does not match the column data type.
+	ErrInvalidDefault = errors.New("invalid default value")
 )
@@ -0,0 +1,138 @@
+package meta
+
+import "strings"
+
+// ReferentialAction is the action taken on the child rows when the referenced
+// parent row is deleted or its key is updated. It is Enum.
+type ReferentialAction uint8
+
+const (
+	// NoAction rejects the change if child rows still reference the old key
+	// when the constraint is checked. It is the default action.
+	NoAction ReferentialAction = iota
+	// Restrict rejects the change if child rows reference the old key.
+	// Unlike NoAction, it is never deferred to commit.
+	Restrict
+	// Cascade deletes the child rows, or updates their key to the new key.
+	Cascade
+	// SetNull sets the referencing columns of the child rows to NULL.
+	SetNull
+	// SetDefault sets the referencing columns of the child rows to their default.
+	SetDefault
+)
+
+// ForeignKey is the definition of the FOREIGN KEY constraint.
+type ForeignKey struct {
+	// Name is constraint name. It is unique within a table.
+	Name string `json:"name"`
+	// Columns is the referencing column names of the child table.
+	Columns []string `json:"columns"`
+	// RefTable is the referenced parent table name.
+	RefTable string `json:"refTable"`
+	// RefColumns is the referenced column names of the parent table.
+	// They must be the primary key or the columns of a UNIQUE constraint.
+	// If it is empty, the primary key of the parent table is referenced.
+	RefColumns []string `json:"refColumns"`
+	// OnDelete is the action when the parent row is deleted.
+	OnDelete ReferentialAction `json:"onDelete"`
+	// OnUpdate is the action when the key of the parent row is updated.
+	OnUpdate ReferentialAction `json:"onUpdate"`
+	// Deferred is a flag indicating whether the constraint is checked
+	// at commit instead of at the end of each statement.
+	Deferred bool `json:"deferred,omitempty"`
+	// Index is the name of the index on the referencing columns that is
+	// used to find the child rows.
+	Index string `json:"index"`
+}
+
+// AddForeignKey adds the FOREIGN KEY constraint and the index on the
+// referencing columns used to enforce it. If fk.Name is empty, the
+// name is generated from the columns. The referenced table is not checked
+// here because the scheme does not know the other tables; it is checked
+// when the table is created.
+func (s *Scheme) AddForeignKey(fk ForeignKey) error {
+	if err := validKeyColumns(s.ColumnNames, fk.Columns); err != nil {
+		return err
+	}
+	if fk.RefTable == "" {
+		return ErrInvalidForeignKey
+	}
+	if len(fk.RefColumns) != 0 && len(fk.RefColumns) != len(fk.Columns) {
+		return ErrNotMatchRefColumnNum
+	}
+	if fk.Name == "" {
+		fk.Name = s.TableName + "_" + strings.Join(fk.Columns, "_") + "_fkey"
+	}
+	if s.FetchForeignKey(fk.Name) != nil {
+		return ErrDuplicateConstraint
+	}
+	if fk.OnDelete == SetNull || fk.OnUpdate == SetNull {
+		for _, c := range fk.Columns {
+			if s.PrimaryKey.Contains(c) {
+				return ErrInvalidForeignKey
+			}
+		}
+	}
+
+	fk.Index = s.indexFor(fk.Columns)
+	if fk.Index == "" {
+		fk.Index = fk.Name
+		s.Indexes = append(s.Indexes, Index{
+			Name:    fk.Name,
+			Columns: fk.Columns,
+		})
+	}
+	s.ForeignKeys = append(s.ForeignKeys, fk)
+	return nil
+}
+
+// FetchForeignKey returns the FOREIGN KEY constraint with the specified name,
+// if one exists. If no constraint exists, nil is returned.
+func (s *Scheme) FetchForeignKey(name string) *ForeignKey {
+	for i := range s.ForeignKeys {
+		if s.ForeignKeys[i].Name == name {
+			return &s.ForeignKeys[i]
+		}
+	}
+	return nil
+}
+
+// UniqueIndexFor returns the name of the unique index whose columns are
+// exactly the specified columns. If no index exists, "" is returned.
+func (s *Scheme) UniqueIndexFor(columns []string) string {
+	for _, idx := range s.Indexes {
+		if idx.Unique && KeyColumns(idx.Columns).Equal(columns) {
+			return idx.Name
+		}
+	}
+	return ""
+}
+
+// indexFor returns the name of the index whose columns are exactly
+// the specified columns. If no index exists, "" is returned.
+func (s *Scheme) indexFor(columns []string) string {
+	for _, idx := range s.Indexes {
+		if KeyColumns(idx.Columns).Equal(columns) {
+			return idx.Name
+		}
+	}
+	return ""
+}
+
+// String is stringer for ReferentialAction
+func (r ReferentialAction) String() string {
+	switch r {
+	case NoAction:
+		return "NO ACTION"
+	case Restrict:
+		return "RESTRICT"
+	case Cascade:
+		return "CASCADE"
+	case SetNull:
+		return "SET NULL"
+	case SetDefault:
+		return "SET DEFAULT"
+	default:
+		return "undefined"
+	}
+}
@@ -0,0 +1,181 @@
+package meta
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestScheme_AddForeignKey(t *testing.T) {
+	tests := []struct {
+		name        string
+		fk          ForeignKey
+		want        *ForeignKey
+		wantIndexes []Index
+		wantErrIs   error
+	}{
+		{
+			name: "[Success] add foreign key and index on referencing columns",
+			fk:   ForeignKey{Columns: []string{"group_id"}, RefTable: "groups", RefColumns: []string{"id"}, OnDelete: Cascade},
+			want: &ForeignKey{
+				Name:       "users_group_id_fkey",
+				Columns:    []string{"group_id"},
+				RefTable:   "groups",
+				RefColumns: []string{"id"},
+				OnDelete:   Cascade,
+				Index:      "users_group_id_fkey",
+			},
+			wantIndexes: []Index{
+				{Name: "users_pkey", Columns: []string{"id"}, Unique: true, Primary: true},
+				{Name: "users_group_id_fkey", Columns: []string{"group_id"}},
+			},
+			wantErrIs: nil,
+		},
+		{
+			name: "[Success] reuse existing index on referencing columns",
+			fk:   ForeignKey{Name: "fk_parent", Columns: []string{"id"}, RefTable: "parents"},
+			want: &ForeignKey{
+				Name:     "fk_parent",
+				Columns:  []string{"id"},
+				RefTable: "parents",
+				Index:    "users_pkey",
+			},
+			wantIndexes: []Index{
+				{Name: "users_pkey", Columns: []string{"id"}, Unique: true, Primary: true},
+			},
+			wantErrIs: nil,
+		},
+		{
+			name:      "[Error] referencing column does not exist",
+			fk:        ForeignKey{Columns: []string{"not_exist"}, RefTable: "groups"},
+			wantErrIs: ErrNotExistColumn,
+		},
+		{
+			name:      "[Error] referenced table is empty",
+			fk:        ForeignKey{Columns: []string{"group_id"}},
+			wantErrIs: ErrInvalidForeignKey,
+		},
+		{
+			name:      "[Error] number of referenced columns does not match",
+			fk:        ForeignKey{Columns: []string{"group_id"}, RefTable: "groups", RefColumns: []string{"id", "name"}},
+			wantErrIs: ErrNotMatchRefColumnNum,
+		},
+		{
+			name:      "[Error] SET NULL on primary key column",
+			fk:        ForeignKey{Columns: []string{"id"}, RefTable: "groups", OnDelete: SetNull},
+			wantErrIs: ErrInvalidForeignKey,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewScheme("users", []string{"id", "group_id"}, []DataType{Int, Int}, "id")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = s.AddForeignKey(tt.fk)
+			if !errors.Is(err, tt.wantErrIs) {
+				t.Fatalf("Scheme.AddForeignKey() error = %v, wantErrIs %v", err, tt.wantErrIs)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(tt.want, s.FetchForeignKey(tt.want.Name)); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.wantIndexes, s.Indexes); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+			if err := s.AddForeignKey(tt.fk); !errors.Is(err, ErrDuplicateConstraint) {
+				t.Errorf("Scheme.AddForeignKey() error = %v, wantErrIs %v", err, ErrDuplicateConstraint)
+			}
+		})
+	}
+}
+
+func TestScheme_SetDefault(t *testing.T) {
+	tests := []struct {
+		name      string
+		column    string
+		value     interface{}
+		want      interface{}
+		wantErrIs error
+	}{
+		{
+			name:   "[Success] set default of Int column",
+			column: "id",
+			value:  int64(10),
+			want:   int64(10),
+		},
+		{
+			name:   "[Success] set default of Varchar column",
+			column: "name",
+			value:  "unknown",
+			want:   "unknown",
+		},
+		{
+			name:   "[Success] remove default",
+			column: "name",
+			value:  nil,
+			want:   nil,
+		},
+		{
+			name:      "[Error] type mismatch",
+			column:    "id",
+			value:     "10",
+			want:      nil,
+			wantErrIs: ErrInvalidDefault,
+		},
+		{
+			name:      "[Error] column does not exist",
+			column:    "not_exist",
+			value:     int64(10),
+			want:      nil,
+			wantErrIs: ErrNotExistColumn,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewScheme("users", []string{"id", "name"}, []DataType{Int, Varchar}, "id")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := s.SetDefault("name", "before"); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := s.SetDefault(tt.column, tt.value); !errors.Is(err, tt.wantErrIs) {
+				t.Errorf("Scheme.SetDefault() error = %v, wantErrIs %v", err, tt.wantErrIs)
+			}
+			if tt.wantErrIs != nil {
+				return
+			}
+			if diff := cmp.Diff(tt.want, s.DefaultValue(tt.column)); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestReferentialAction_String(t *testing.T) {
+	tests := []struct {
+		name string
+		r    ReferentialAction
+		want string
+	}{
+		{name: "[Success] NO ACTION", r: NoAction, want: "NO ACTION"},
+		{name: "[Success] RESTRICT", r: Restrict, want: "RESTRICT"},
+		{name: "[Success] CASCADE", r: Cascade, want: "CASCADE"},
+		{name: "[Success] SET NULL", r: SetNull, want: "SET NULL"},
+		{name: "[Success] SET DEFAULT", r: SetDefault, want: "SET DEFAULT"},
+		{name: "[Error] undefined", r: ReferentialAction(100), want: "undefined"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.r.String(); got != tt.want {
+				t.Errorf("ReferentialAction.String() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package meta
+
+import "strings"
+
+// DefaultSchema is the schema that exists in every catalog. The tables created
+// before schemas were supported belong to it.
+const DefaultSchema = "public"
+
+const (
+	// InformationSchema is the schema of the standard read-only views
+	// (e.g. information_schema.tables) that describe the catalog.
+	InformationSchema = "information_schema"
+	// SystemSchema is the schema of the egsql specific read-only views
+	// (e.g. egsql_indexes). The views can be referred to without the schema name.
+	SystemSchema = "egsql_catalog"
+)
+
+// IsSystemSchema reports whether the schema is InformationSchema or SystemSchema.
+// The system schemas are not in the catalog and can not be created, dropped or changed.
+func IsSystemSchema(name string) bool {
+	return name == InformationSchema || name == SystemSchema
+}
+
+// QualifiedName returns the name that identifies the table or sequence in the
+// catalog. The name in DefaultSchema is the name itself, and the name in
+// another schema is "schema.name".
+func QualifiedName(schema, name string) string {
+	if schema == "" || schema == DefaultSchema {
+		return name
+	}
+	return schema + "." + name
+}
+
+// SplitQualifiedName splits the name returned by QualifiedName into
+// the schema name and the name in the schema.
+func SplitQualifiedName(qualified string) (schema, name string) {
+	i := strings.Index(qualified, ".")
+	if i < 0 {
+		return DefaultSchema, qualified
+	}
+	return qualified[:i], qualified[i+1:]
+}
+
+// SchemaName returns the name of the schema the table belongs to.
+func (s *Scheme) SchemaName() string {
+	schema, _ := SplitQualifiedName(s.TableName)
+	return schema
+}
@@ -5,6 +5,13 @@ type ResultSet struct {
 	Message     string
 	ColumnNames []string
 	Values      []string
+	// Rows is the rows returned by the query. Each value is int64, string or nil (NULL)
+	// in the order of ColumnNames.
+	Rows [][]interface{}
+	// AffectedRows is the number of rows changed by the query.
+	AffectedRows int64
+	// LastInsertID is the last value generated for the identity column by the query.
+	LastInsertID int64
 }
 
 // NewResultSet returns ResultSet pointer
@@ -1,6 +1,12 @@
 package meta
 
-import "github.com/nao1215/egsql/misc/slice"
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/nao1215/egsql/misc/slice"
+)
 
 // DataType is the data type of the table column. It is Enum.
 type DataType uint8
@@ -18,6 +24,10 @@ type Table struct {
 	Name string
 	// Columns is an slice that holds everything involved in the table.
 	Columns []Column
+	// PrimaryKey is the column names that make up the primary key, in key order.
+	PrimaryKey []string
+	// Uniques is the column names of each UNIQUE constraint.
+	Uniques [][]string
 }
 
 // Column represents a DB table column.
@@ -27,9 +37,30 @@ type Column struct {
 	// Type is column data type.
 	Type DataType
 	// Primary is a flag indicating whether the column is a primary key or not.
+	// For a composite primary key, every column in the key is flagged.
 	Primary bool
+	// Unique is a flag indicating whether the column alone has a UNIQUE constraint.
+	Unique bool
 }
 
+// Index is the definition of an index on the columns of a table.
+// Primary key and UNIQUE constraints are enforced through unique indexes.
+type Index struct {
+	// Name is index name. It is unique within a table.
+	Name string `json:"name"`
+	// Columns is the indexed column names, in key order.
+	Columns []string `json:"columns"`
+	// Unique is a flag indicating whether duplicate keys are rejected.
+	Unique bool `json:"unique"`
+	// Primary is a flag indicating whether the index backs the primary key.
+	Primary bool `json:"primary,omitempty"`
+}
+
+// KeyColumns is an slice of column names that make up a key.
+// In catalog json, it is also accepted as a single string for compatibility
+// with catalogs written when the primary key was a single column.
+type KeyColumns []string
+
 // Scheme is the definition of tables and Columns
 type Scheme struct {
 	// TableName is table name.
@@ -38,12 +69,25 @@ type Scheme struct {
 	ColumnNames []string `json:"columnNames"`
 	// ColumnDataTypes is an slice of all column data type.
 	ColumnDataTypes []DataType `json:"dataTypes"`
-	// PrimaryKey is primary key.
-	PrimaryKey string `json:"pk"`
+	// PrimaryKey is the column names that make up the primary key.
+	PrimaryKey KeyColumns `json:"pk"`
+	// Uniques is the column names of each UNIQUE constraint.
+	Uniques []KeyColumns `json:"uniques,omitempty"`
+	// Indexes is the indexes of the table, including the ones backing constraints.
+	Indexes []Index `json:"indexes,omitempty"`
+	// ForeignKeys is the FOREIGN KEY constraints of the table.
+	ForeignKeys []ForeignKey `json:"foreignKeys,omitempty"`
+	// Defaults is the default value of columns. Key is column name, and
+	// value is the text representation of the value (e.g. "10" for Int).
+	Defaults map[string]string `json:"defaults,omitempty"`
+	// Identity is the column whose value is generated by the sequence, if any.
+	Identity *Identity `json:"identity,omitempty"`
 }
 
 // NewScheme returns a pointer to the new schema.
-func NewScheme(tableName string, columnNames []string, dataTypes []DataType, pk string) (*Scheme, error) {
+// pk is the column names of the primary key. Specify more than one column
+// for the composite primary key like PRIMARY KEY (tenant_id, id).
+func NewScheme(tableName string, columnNames []string, dataTypes []DataType, pk ...string) (*Scheme, error) {
 	if err := validColumn(columnNames, dataTypes); err != nil {
 		return nil, err
 	}
@@ -51,12 +95,14 @@ func NewScheme(tableName string, columnNames []string, dataTypes []DataType, pk
 		return nil, err
 	}
 
-	return &Scheme{
+	s := &Scheme{
 		TableName:       tableName,
 		ColumnNames:     columnNames,
 		ColumnDataTypes: dataTypes,
 		PrimaryKey:      pk,
-	}, nil
+	}
+	s.Indexes = []Index{s.primaryIndex()}
+	return s, nil
 }
 
 // validColumn is the validation when initializing the schema.
@@ -74,13 +120,263 @@ func validColumn(columnNames []string, dataTypes []DataType) error {
 }
 
 // validPrimaryKey checks if the Primary Key specification is correct
-func validPrimaryKey(columnNames []string, pk string) error {
-	if !slice.Contains(columnNames, pk) {
+func validPrimaryKey(columnNames []string, pk []string) error {
+	if err := validKeyColumns(columnNames, pk); err != nil {
 		return ErrInvalidPrimaryKey
 	}
 	return nil
 }
 
+// validKeyColumns checks that key columns are not empty, exist in
+// the table and are not duplicated.
+func validKeyColumns(columnNames []string, key []string) error {
+	if len(key) == 0 {
+		return ErrEmptyKey
+	}
+	for i, k := range key {
+		if !slice.Contains(columnNames, k) {
+			return ErrNotExistColumn
+		}
+		if slice.Contains(key[:i], k) {
+			return ErrDuplicateKeyColumn
+		}
+	}
+	return nil
+}
+
+// AddUnique adds the UNIQUE constraint on the specified columns and
+// the unique index that enforces it.
+func (s *Scheme) AddUnique(columns ...string) error {
+	if err := validKeyColumns(s.ColumnNames, columns); err != nil {
+		return err
+	}
+	for _, u := range s.Uniques {
+		if u.Equal(columns) {
+			return ErrDuplicateConstraint
+		}
+	}
+	if s.PrimaryKey.Equal(columns) {
+		return ErrDuplicateConstraint
+	}
+
+	s.Uniques = append(s.Uniques, columns)
+	s.Indexes = append(s.Indexes, Index{
+		Name:    s.uniqueIndexName(columns),
+		Columns: columns,
+		Unique:  true,
+	})
+	return nil
+}
+
+// SetDefault sets the default value of the column. The value must be
+// int64 for Int column, string for Varchar column, or nil to remove the default.
+func (s *Scheme) SetDefault(column string, value interface{}) error {
+	i := s.ColumnIndex(column)
+	if i < 0 {
+		return ErrNotExistColumn
+	}
+
+	var text string
+	switch v := value.(type) {
+	case nil:
+		s.deleteDefault(column)
+		return nil
+	case int64:
+		if s.ColumnDataTypes[i] != Int {
+			return ErrInvalidDefault
+		}
+		text = strconv.FormatInt(v, 10)
+	case string:
+		if s.ColumnDataTypes[i] != Varchar {
+			return ErrInvalidDefault
+		}
+		text = v
+	default:
+		return ErrInvalidDefault
+	}
+
+	if s.Defaults == nil {
+		s.Defaults = make(map[string]string)
+	}
+	s.Defaults[column] = text
+	return nil
+}
+
+// deleteDefault removes the default value of the column.
+func (s *Scheme) deleteDefault(column string) {
+	delete(s.Defaults, column)
+	if len(s.Defaults) == 0 {
+		s.Defaults = nil
+	}
+}
+
+// DefaultValue returns the default value of the column.
+// If the column has no default, nil (NULL) is returned.
+func (s *Scheme) DefaultValue(column string) interface{} {
+	text, ok := s.Defaults[column]
+	if !ok {
+		return nil
+	}
+	i := s.ColumnIndex(column)
+	if i < 0 {
+		return nil
+	}
+	if s.ColumnDataTypes[i] == Int {
+		v, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return nil
+		}
+		return v
+	}
+	return text
+}
+
+// SetIdentity makes the Int column the identity column whose value is
+// generated by the sequence named "<table>_<column>_seq" when it is omitted.
+// The database adds a numeric suffix to the name if it is already used.
+// If always is true, the value can not be specified explicitly.
+func (s *Scheme) SetIdentity(column string, always bool) error {
+	i := s.ColumnIndex(column)
+	if i < 0 {
+		return ErrNotExistColumn
+	}
+	if s.ColumnDataTypes[i] != Int {
+		return ErrInvalidIdentity
+	}
+	if s.Identity != nil {
+		return ErrDuplicateConstraint
+	}
+	s.Identity = &Identity{
+		Column:   column,
+		Sequence: s.TableName + "_" + column + "_seq",
+		Always:   always,
+	}
+	return nil
+}
+
+// FetchIndex returns the index with the specified name, if one exists.
+// If no index exists, nil is returned.
+func (s *Scheme) FetchIndex(name string) *Index {
+	for i := range s.Indexes {
+		if s.Indexes[i].Name == name {
+			return &s.Indexes[i]
+		}
+	}
+	return nil
+}
+
+// ColumnIndex returns the position of the column in the table.
+// If the column does not exist, -1 is returned.
+func (s *Scheme) ColumnIndex(name string) int {
+	for i, c := range s.ColumnNames {
+		if c == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// primaryIndex returns the index definition that backs the primary key.
+func (s *Scheme) primaryIndex() Index {
+	return Index{
+		Name:    s.TableName + "_pkey",
+		Columns: s.PrimaryKey,
+		Unique:  true,
+		Primary: true,
+	}
+}
+
+// uniqueIndexName returns the index name that backs the UNIQUE constraint.
+// If the name is already used, e.g. by UNIQUE (a_b) for UNIQUE (a, b), the
+// smallest number that makes it unique is appended like PostgreSQL.
+func (s *Scheme) uniqueIndexName(columns []string) string {
+	base := s.TableName + "_" + strings.Join(columns, "_") + "_key"
+	name := base
+	for i := 1; s.FetchIndex(name) != nil; i++ {
+		name = base + strconv.Itoa(i)
+	}
+	return name
+}
+
+// UnmarshalJSON unmarshals the Scheme and completes the indexes backing
+// the constraints when they are missing, as in catalogs written
+// before indexes were recorded.
+func (s *Scheme) UnmarshalJSON(b []byte) error {
+	type scheme Scheme
+	var tmp scheme
+	if err := json.Unmarshal(b, &tmp); err != nil {
+		return err
+	}
+	*s = Scheme(tmp)
+
+	if len(s.PrimaryKey) > 0 && s.primaryIndexDef() == nil {
+		s.Indexes = append([]Index{s.primaryIndex()}, s.Indexes...)
+	}
+	for _, u := range s.Uniques {
+		if s.UniqueIndexFor(u) == "" {
+			s.Indexes = append(s.Indexes, Index{
+				Name:    s.uniqueIndexName(u),
+				Columns: u,
+				Unique:  true,
+			})
+		}
+	}
+	return nil
+}
+
+// primaryIndexDef returns the index backing the primary key, if one exists.
+func (s *Scheme) primaryIndexDef() *Index {
+	for i := range s.Indexes {
+		if s.Indexes[i].Primary {
+			return &s.Indexes[i]
+		}
+	}
+	return nil
+}
+
+// Equal reports whether k and columns are the same columns in the same order.
+func (k KeyColumns) Equal(columns []string) bool {
+	if len(k) != len(columns) {
+		return false
+	}
+	for i := range k {
+		if k[i] != columns[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Contains reports whether the column is one of the key columns.
+func (k KeyColumns) Contains(column string) bool {
+	for _, c := range k {
+		if c == column {
+			return true
+		}
+	}
+	return false
+}
+
+// UnmarshalJSON unmarshals the key columns from a json array or a single string.
+func (k *KeyColumns) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		if single == "" {
+			*k = nil
+			return nil
+		}
+		*k = KeyColumns{single}
+		return nil
+	}
+
+	var columns []string
+	if err := json.Unmarshal(b, &columns); err != nil {
+		return err
+	}
+	*k = columns
+	return nil
+}
+
 // String is stringer for DataType
 func (d DataType) String() string {
 	switch d {
@@ -97,13 +393,22 @@ func (d DataType) String() string {
 func (s *Scheme) ConvertToTable() *Table {
 	var t Table
 	t.Name = s.TableName
+	t.PrimaryKey = append(t.PrimaryKey, s.PrimaryKey...)
+	for _, u := range s.Uniques {
+		t.Uniques = append(t.Uniques, append([]string{}, u...))
+	}
 
 	var columns []Column
 	for i := range s.ColumnNames {
 		var col Column
 		col.Name = s.ColumnNames[i]
 		col.Type = s.ColumnDataTypes[i]
-		col.Primary = (col.Name == s.PrimaryKey)
+		col.Primary = s.PrimaryKey.Contains(col.Name)
+		for _, u := range s.Uniques {
+			if u.Equal([]string{col.Name}) {
+				col.Unique = true
+			}
+		}
 		columns = append(columns, col)
 	}
 	t.Columns = columns
@@ -1,6 +1,7 @@
 package meta
 
 import (
+	"encoding/json"
 	"errors"
 	"testing"
 
@@ -12,7 +13,7 @@ func TestNewScheme(t *testing.T) {
 		tableName   string
 		columnNames []string
 		dataTypes   []DataType
-		pk          string
+		pk          []string
 	}
 	tests := []struct {
 		name      string
@@ -27,24 +28,71 @@ func TestNewScheme(t *testing.T) {
 				tableName:   "this_is_table_name",
 				columnNames: []string{"id", "user_id", "group_id", "name"},
 				dataTypes:   []DataType{Int, Int, Int, Varchar},
-				pk:          "id",
+				pk:          []string{"id"},
 			},
 			want: &Scheme{
 				TableName:       "this_is_table_name",
 				ColumnNames:     []string{"id", "user_id", "group_id", "name"},
 				ColumnDataTypes: []DataType{Int, Int, Int, Varchar},
-				PrimaryKey:      "id",
+				PrimaryKey:      KeyColumns{"id"},
+				Indexes: []Index{
+					{Name: "this_is_table_name_pkey", Columns: []string{"id"}, Unique: true, Primary: true},
+				},
+			},
+			wantErr:   false,
+			wantErrIs: nil,
+		},
+		{
+			name: "[Success] generate new table with composite primary key",
+			args: args{
+				tableName:   "accounts",
+				columnNames: []string{"tenant_id", "id", "name"},
+				dataTypes:   []DataType{Int, Int, Varchar},
+				pk:          []string{"tenant_id", "id"},
+			},
+			want: &Scheme{
+				TableName:       "accounts",
+				ColumnNames:     []string{"tenant_id", "id", "name"},
+				ColumnDataTypes: []DataType{Int, Int, Varchar},
+				PrimaryKey:      KeyColumns{"tenant_id", "id"},
+				Indexes: []Index{
+					{Name: "accounts_pkey", Columns: []string{"tenant_id", "id"}, Unique: true, Primary: true},
+				},
 			},
 			wantErr:   false,
 			wantErrIs: nil,
 		},
+		{
+			name: "[Error] primary key is not specified",
+			args: args{
+				tableName:   "this_is_table_name",
+				columnNames: []string{"id", "name"},
+				dataTypes:   []DataType{Int, Varchar},
+				pk:          nil,
+			},
+			want:      nil,
+			wantErr:   true,
+			wantErrIs: ErrInvalidPrimaryKey,
+		},
+		{
+			name: "[Error] same column is specified twice in primary key",
+			args: args{
+				tableName:   "this_is_table_name",
+				columnNames: []string{"id", "name"},
+				dataTypes:   []DataType{Int, Varchar},
+				pk:          []string{"id", "id"},
+			},
+			want:      nil,
+			wantErr:   true,
+			wantErrIs: ErrInvalidPrimaryKey,
+		},
 		{
 			name: "[Error] Column name slice is empty",
 			args: args{
 				tableName:   "this_is_table_name",
 				columnNames: []string{},
 				dataTypes:   []DataType{Int, Int, Int, Varchar},
-				pk:          "id",
+				pk:          []string{"id"},
 			},
 			want:      nil,
 			wantErr:   true,
@@ -56,7 +104,7 @@ func TestNewScheme(t *testing.T) {
 				tableName:   "this_is_table_name",
 				columnNames: []string{"id", "user_id", "group_id", "name"},
 				dataTypes:   []DataType{},
-				pk:          "id",
+				pk:          []string{"id"},
 			},
 			want:      nil,
 			wantErr:   true,
@@ -68,7 +116,7 @@ func TestNewScheme(t *testing.T) {
 				tableName:   "this_is_table_name",
 				columnNames: []string{"id", "user_id", "group_id", "name"},
 				dataTypes:   []DataType{Int},
-				pk:          "id",
+				pk:          []string{"id"},
 			},
 			want:      nil,
 			wantErr:   true,
@@ -80,7 +128,7 @@ func TestNewScheme(t *testing.T) {
 				tableName:   "this_is_table_name",
 				columnNames: []string{"id", "user_id", "group_id", ""},
 				dataTypes:   []DataType{Int, Int, Int, Varchar},
-				pk:          "id",
+				pk:          []string{"id"},
 			},
 			want:      nil,
 			wantErr:   true,
@@ -92,7 +140,7 @@ func TestNewScheme(t *testing.T) {
 				tableName:   "this_is_table_name",
 				columnNames: []string{"id", "user_id", "group_id", "name"},
 				dataTypes:   []DataType{Int, Int, Int, Varchar},
-				pk:          "not_exist_pk",
+				pk:          []string{"not_exist_pk"},
 			},
 			want:      nil,
 			wantErr:   true,
@@ -101,7 +149,7 @@ func TestNewScheme(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := NewScheme(tt.args.tableName, tt.args.columnNames, tt.args.dataTypes, tt.args.pk)
+			got, err := NewScheme(tt.args.tableName, tt.args.columnNames, tt.args.dataTypes, tt.args.pk...)
 			if (err != nil) != tt.wantErr && !errors.Is(err, tt.wantErrIs) {
 				t.Errorf("NewScheme() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -182,7 +230,7 @@ func Test_validColumn(t *testing.T) {
 func Test_validPrimaryKey(t *testing.T) {
 	type args struct {
 		columnNames []string
-		pk          string
+		pk          []string
 	}
 	tests := []struct {
 		name      string
@@ -194,16 +242,34 @@ func Test_validPrimaryKey(t *testing.T) {
 			name: "[Success] valid ok",
 			args: args{
 				columnNames: []string{"id", "user_id", "group_id", "name"},
-				pk:          "id",
+				pk:          []string{"id"},
+			},
+			wantErr:   false,
+			wantErrIs: nil,
+		},
+		{
+			name: "[Success] composite primary key",
+			args: args{
+				columnNames: []string{"id", "user_id", "group_id", "name"},
+				pk:          []string{"group_id", "id"},
 			},
 			wantErr:   false,
 			wantErrIs: nil,
 		},
+		{
+			name: "[Error] empty primary key",
+			args: args{
+				columnNames: []string{"id", "user_id", "group_id", "name"},
+				pk:          []string{},
+			},
+			wantErr:   true,
+			wantErrIs: ErrInvalidPrimaryKey,
+		},
 		{
 			name: "[Error] if you specify a column name that does not exist.",
 			args: args{
 				columnNames: []string{"id", "user_id", "group_id", "name"},
-				pk:          "not_exist_pk",
+				pk:          []string{"not_exist_pk"},
 			},
 			wantErr:   true,
 			wantErrIs: ErrInvalidPrimaryKey,
@@ -254,7 +320,8 @@ func TestScheme_ConvertToTable(t *testing.T) {
 		TableName       string
 		ColumnNames     []string
 		ColumnDataTypes []DataType
-		PrimaryKey      string
+		PrimaryKey      KeyColumns
+		Uniques         []KeyColumns
 	}
 	tests := []struct {
 		name   string
@@ -267,10 +334,11 @@ func TestScheme_ConvertToTable(t *testing.T) {
 				TableName:       "test_table",
 				ColumnNames:     []string{"id", "user_id", "group_id", "name"},
 				ColumnDataTypes: []DataType{Int, Int, Int, Varchar},
-				PrimaryKey:      "id",
+				PrimaryKey:      KeyColumns{"id"},
 			},
 			want: &Table{
-				Name: "test_table",
+				Name:       "test_table",
+				PrimaryKey: []string{"id"},
 				Columns: []Column{
 					{
 						Name:    "id",
@@ -295,6 +363,27 @@ func TestScheme_ConvertToTable(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "[Succes] convert schema with composite primary key and unique constraints",
+			fields: fields{
+				TableName:       "accounts",
+				ColumnNames:     []string{"tenant_id", "id", "email", "code"},
+				ColumnDataTypes: []DataType{Int, Int, Varchar, Varchar},
+				PrimaryKey:      KeyColumns{"tenant_id", "id"},
+				Uniques:         []KeyColumns{{"email"}, {"tenant_id", "code"}},
+			},
+			want: &Table{
+				Name:       "accounts",
+				PrimaryKey: []string{"tenant_id", "id"},
+				Uniques:    [][]string{{"email"}, {"tenant_id", "code"}},
+				Columns: []Column{
+					{Name: "tenant_id", Type: Int, Primary: true},
+					{Name: "id", Type: Int, Primary: true},
+					{Name: "email", Type: Varchar, Unique: true},
+					{Name: "code", Type: Varchar},
+				},
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -303,6 +392,7 @@ func TestScheme_ConvertToTable(t *testing.T) {
 				ColumnNames:     tt.fields.ColumnNames,
 				ColumnDataTypes: tt.fields.ColumnDataTypes,
 				PrimaryKey:      tt.fields.PrimaryKey,
+				Uniques:         tt.fields.Uniques,
 			}
 			got := s.ConvertToTable()
 			if diff := cmp.Diff(tt.want, got); diff != "" {
@@ -311,3 +401,171 @@ func TestScheme_ConvertToTable(t *testing.T) {
 		})
 	}
 }
+
+func TestScheme_AddUnique(t *testing.T) {
+	tests := []struct {
+		name        string
+		uniques     [][]string
+		columns     []string
+		wantUniques []KeyColumns
+		wantIndex   *Index
+		wantErrIs   error
+	}{
+		{
+			name:        "[Success] add single column unique constraint",
+			columns:     []string{"email"},
+			wantUniques: []KeyColumns{{"email"}},
+			wantIndex:   &Index{Name: "users_email_key", Columns: []string{"email"}, Unique: true},
+			wantErrIs:   nil,
+		},
+		{
+			name:        "[Success] add composite unique constraint",
+			uniques:     [][]string{{"email"}},
+			columns:     []string{"tenant_id", "code"},
+			wantUniques: []KeyColumns{{"email"}, {"tenant_id", "code"}},
+			wantIndex:   &Index{Name: "users_tenant_id_code_key", Columns: []string{"tenant_id", "code"}, Unique: true},
+			wantErrIs:   nil,
+		},
+		{
+			name:        "[Success] index name that is already used gets numeric suffix",
+			uniques:     [][]string{{"tenant_id"}},
+			columns:     []string{"tenant", "id"},
+			wantUniques: []KeyColumns{{"tenant_id"}, {"tenant", "id"}},
+			wantIndex:   &Index{Name: "users_tenant_id_key1", Columns: []string{"tenant", "id"}, Unique: true},
+			wantErrIs:   nil,
+		},
+		{
+			name:      "[Error] column does not exist",
+			columns:   []string{"not_exist"},
+			wantErrIs: ErrNotExistColumn,
+		},
+		{
+			name:      "[Error] no column",
+			columns:   []string{},
+			wantErrIs: ErrEmptyKey,
+		},
+		{
+			name:      "[Error] same column is specified twice",
+			columns:   []string{"code", "code"},
+			wantErrIs: ErrDuplicateKeyColumn,
+		},
+		{
+			name:        "[Error] same constraint already exists",
+			uniques:     [][]string{{"email"}},
+			columns:     []string{"email"},
+			wantUniques: []KeyColumns{{"email"}},
+			wantErrIs:   ErrDuplicateConstraint,
+		},
+		{
+			name:      "[Error] same as primary key",
+			columns:   []string{"tenant_id", "id"},
+			wantErrIs: ErrDuplicateConstraint,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewScheme("users",
+				[]string{"tenant_id", "id", "email", "code", "tenant"},
+				[]DataType{Int, Int, Varchar, Varchar, Int}, "tenant_id", "id")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, u := range tt.uniques {
+				if err := s.AddUnique(u...); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err = s.AddUnique(tt.columns...)
+			if !errors.Is(err, tt.wantErrIs) {
+				t.Errorf("Scheme.AddUnique() error = %v, wantErrIs %v", err, tt.wantErrIs)
+			}
+			if diff := cmp.Diff(tt.wantUniques, s.Uniques); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+			if tt.wantIndex != nil {
+				if diff := cmp.Diff(tt.wantIndex, s.FetchIndex(tt.wantIndex.Name)); diff != "" {
+					t.Errorf("mismatch (-want +got):\n%s", diff)
+				}
+			}
+		})
+	}
+}
+
+func TestScheme_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		want    *Scheme
+		wantErr bool
+	}{
+		{
+			name: "[Success] unmarshal legacy scheme that has single string primary key",
+			json: `{"tableName":"users","columnNames":["id","user_id"],"dataTypes":"AQI=","pk":"id"}`,
+			want: &Scheme{
+				TableName:       "users",
+				ColumnNames:     []string{"id", "user_id"},
+				ColumnDataTypes: []DataType{Int, Varchar},
+				PrimaryKey:      KeyColumns{"id"},
+				Indexes: []Index{
+					{Name: "users_pkey", Columns: []string{"id"}, Unique: true, Primary: true},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "[Success] unmarshal scheme that has composite primary key and unique constraint",
+			json: `{"tableName":"users","columnNames":["tenant_id","id","email"],"dataTypes":"AQEC",` +
+				`"pk":["tenant_id","id"],"uniques":[["email"]],` +
+				`"indexes":[{"name":"users_pkey","columns":["tenant_id","id"],"unique":true,"primary":true},` +
+				`{"name":"users_email_key","columns":["email"],"unique":true}]}`,
+			want: &Scheme{
+				TableName:       "users",
+				ColumnNames:     []string{"tenant_id", "id", "email"},
+				ColumnDataTypes: []DataType{Int, Int, Varchar},
+				PrimaryKey:      KeyColumns{"tenant_id", "id"},
+				Uniques:         []KeyColumns{{"email"}},
+				Indexes: []Index{
+					{Name: "users_pkey", Columns: []string{"tenant_id", "id"}, Unique: true, Primary: true},
+					{Name: "users_email_key", Columns: []string{"email"}, Unique: true},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "[Success] complete missing unique index",
+			json: `{"tableName":"users","columnNames":["id","email"],"dataTypes":"AQI=","pk":["id"],"uniques":[["email"]]}`,
+			want: &Scheme{
+				TableName:       "users",
+				ColumnNames:     []string{"id", "email"},
+				ColumnDataTypes: []DataType{Int, Varchar},
+				PrimaryKey:      KeyColumns{"id"},
+				Uniques:         []KeyColumns{{"email"}},
+				Indexes: []Index{
+					{Name: "users_pkey", Columns: []string{"id"}, Unique: true, Primary: true},
+					{Name: "users_email_key", Columns: []string{"email"}, Unique: true},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name:    "[Error] primary key is number",
+			json:    `{"tableName":"users","columnNames":["id"],"dataTypes":"AQ==","pk":1}`,
+			want:    &Scheme{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := &Scheme{}
+			err := json.Unmarshal([]byte(tt.json), got)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Scheme.UnmarshalJSON() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package meta
+
+// Sequence is the definition and the counter of the sequence.
+//
+// To persist the counter crash-safely without saving the catalog on every
+// value, the values are reserved in blocks: Last is the last value that may
+// have been returned, and it is persisted before any value up to it is returned.
+// After a crash, the sequence restarts after Last, so values may be skipped
+// but are never returned twice.
+type Sequence struct {
+	// Name is sequence name.
+	Name string `json:"name"`
+	// Start is the first value of the sequence.
+	Start int64 `json:"start"`
+	// Increment is the difference between the values. It is positive.
+	Increment int64 `json:"increment"`
+	// Last is the last reserved value.
+	Last int64 `json:"last"`
+	// OwnedBy is the name of the table whose identity column the sequence
+	// generates, or empty if the sequence is created by CREATE SEQUENCE.
+	// The sequence is dropped together with the table that owns it.
+	OwnedBy string `json:"owned_by,omitempty"`
+	// next is the next value to return. It is valid only if loaded is true.
+	next   int64
+	loaded bool
+}
+
+// Identity is the definition of the column whose value is generated by
+// the sequence (e.g. INTEGER PRIMARY KEY AUTOINCREMENT).
+type Identity struct {
+	// Column is the identity column name.
+	Column string `json:"column"`
+	// Sequence is the name of the sequence that generates the values.
+	Sequence string `json:"sequence"`
+	// Always is a flag indicating whether the value can not be specified
+	// explicitly (GENERATED ALWAYS AS IDENTITY).
+	Always bool `json:"always,omitempty"`
+}
+
+// NewSequence returns a pointer to the new sequence.
+func NewSequence(name string, start, increment int64) (*Sequence, error) {
+	if name == "" || increment <= 0 {
+		return nil, ErrInvalidSequence
+	}
+	return &Sequence{
+		Name:      name,
+		Start:     start,
+		Increment: increment,
+		Last:      start - increment,
+		next:      start,
+		loaded:    true,
+	}, nil
+}
+
+// NeedReserve reports whether the next value is not reserved yet.
+// If true, Reserve must be called and the catalog must be persisted
+// before calling Next.
+func (s *Sequence) NeedReserve() bool {
+	s.load()
+	return s.next > s.Last
+}
+
+// Reserve reserves the block of n values from the next value.
+func (s *Sequence) Reserve(n int64) {
+	s.load()
+	s.Last = s.next + s.Increment*(n-1)
+}
+
+// Next returns the next value and advances the sequence.
+func (s *Sequence) Next() int64 {
+	s.load()
+	v := s.next
+	s.next += s.Increment
+	return v
+}
+
+// Advance advances the sequence so that the next value is greater than v.
+// It is used when the value of the identity column is specified explicitly.
+func (s *Sequence) Advance(v int64) {
+	s.load()
+	if v >= s.next {
+		s.next = v + s.Increment
+	}
+}
+
+// load initializes the next value of the sequence loaded from the catalog.
+// The values up to Last may have been returned before, so they are skipped.
+func (s *Sequence) load() {
+	if s.loaded {
+		return
+	}
+	s.next = s.Last + s.Increment
+	s.loaded = true
+}
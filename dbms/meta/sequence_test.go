@@ -0,0 +1,63 @@
+package meta
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSequence_Next(t *testing.T) {
+	seq, err := NewSequence("seq", 5, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !seq.NeedReserve() {
+		t.Fatal("NeedReserve() = false, want true")
+	}
+	seq.Reserve(2)
+	for _, want := range []int64{5, 7} {
+		if got := seq.Next(); got != want {
+			t.Errorf("Next() = %d, want %d", got, want)
+		}
+	}
+	if !seq.NeedReserve() {
+		t.Error("NeedReserve() = false after the block is used, want true")
+	}
+
+	seq.Advance(20)
+	seq.Reserve(1)
+	if got := seq.Next(); got != 22 {
+		t.Errorf("Next() after Advance(20) = %d, want 22", got)
+	}
+
+	// The sequence loaded from the catalog restarts after Last.
+	loaded := &Sequence{Name: "seq", Start: 5, Increment: 2, Last: 30}
+	if got := loaded.Next(); got != 32 {
+		t.Errorf("Next() of the loaded sequence = %d, want 32", got)
+	}
+}
+
+func TestNewSequence(t *testing.T) {
+	if _, err := NewSequence("", 1, 1); !errors.Is(err, ErrInvalidSequence) {
+		t.Errorf("NewSequence() error = %v, want %v", err, ErrInvalidSequence)
+	}
+	if _, err := NewSequence("seq", 1, 0); !errors.Is(err, ErrInvalidSequence) {
+		t.Errorf("NewSequence() error = %v, want %v", err, ErrInvalidSequence)
+	}
+}
+
+func TestScheme_SetIdentity(t *testing.T) {
+	s, err := NewScheme("users", []string{"id", "name"}, []DataType{Int, Varchar}, "id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetIdentity("name", false); !errors.Is(err, ErrInvalidIdentity) {
+		t.Errorf("SetIdentity() error = %v, want %v", err, ErrInvalidIdentity)
+	}
+	if err := s.SetIdentity("id", true); err != nil {
+		t.Fatal(err)
+	}
+	want := Identity{Column: "id", Sequence: "users_id_seq", Always: true}
+	if s.Identity == nil || *s.Identity != want {
+		t.Errorf("Identity = %v, want %v", s.Identity, want)
+	}
+}
@@ -0,0 +1,151 @@
+package meta
+
+import (
+	"sort"
+	"strings"
+)
+
+// HistogramBuckets is the maximum number of the buckets of the histogram
+// collected by ANALYZE.
+const HistogramBuckets = 10
+
+// TableStats is the statistics of a table collected by ANALYZE. The planner
+// estimates the number of the rows of the plans with it.
+type TableStats struct {
+	// TableName is the qualified name of the table.
+	TableName string
+	// RowCount is the number of the rows when the statistics are collected.
+	RowCount int64
+	// Columns is the statistics of the columns in the order of the scheme.
+	Columns []ColumnStats
+}
+
+// ColumnStats is the statistics of a column.
+type ColumnStats struct {
+	// Name is the column name.
+	Name string
+	// NullCount is the number of NULL.
+	NullCount int64
+	// DistinctCount is the number of the distinct values except NULL.
+	DistinctCount int64
+	// Histogram is the bounds of the equi-depth histogram of the values
+	// except NULL. The first bound is the minimum and the last is the
+	// maximum, and each bucket between the adjacent bounds has about the
+	// same number of the values. It is empty if all values are NULL.
+	Histogram []interface{}
+}
+
+// NewTableStats computes the statistics of the rows of the table.
+func NewTableStats(scheme *Scheme, rows [][]interface{}) *TableStats {
+	s := &TableStats{TableName: scheme.TableName, RowCount: int64(len(rows))}
+	for i, name := range scheme.ColumnNames {
+		c := ColumnStats{Name: name}
+		values := make([]interface{}, 0, len(rows))
+		for _, row := range rows {
+			if row[i] == nil {
+				c.NullCount++
+				continue
+			}
+			values = append(values, row[i])
+		}
+		sort.Slice(values, func(a, b int) bool { return compareValues(values[a], values[b]) < 0 })
+		for k, v := range values {
+			if k == 0 || compareValues(values[k-1], v) != 0 {
+				c.DistinctCount++
+			}
+		}
+		if n := len(values); n > 0 {
+			buckets := HistogramBuckets
+			if n-1 < buckets {
+				buckets = n - 1
+			}
+			c.Histogram = append(c.Histogram, values[0])
+			for b := 1; b <= buckets; b++ {
+				c.Histogram = append(c.Histogram, values[b*(n-1)/buckets])
+			}
+		}
+		s.Columns = append(s.Columns, c)
+	}
+	return s
+}
+
+// Column returns the statistics of the column, or nil if there is no such column.
+func (s *TableStats) Column(name string) *ColumnStats {
+	for i := range s.Columns {
+		if s.Columns[i].Name == name {
+			return &s.Columns[i]
+		}
+	}
+	return nil
+}
+
+// NullFraction returns the fraction of the rows whose value is NULL.
+func (s *TableStats) NullFraction(c *ColumnStats) float64 {
+	if s.RowCount == 0 {
+		return 0
+	}
+	return float64(c.NullCount) / float64(s.RowCount)
+}
+
+// EqualFraction returns the estimated fraction of the rows whose value equals
+// a value: the values except NULL are assumed to be distributed evenly.
+func (s *TableStats) EqualFraction(c *ColumnStats) float64 {
+	if c.DistinctCount == 0 {
+		return 0
+	}
+	return (1 - s.NullFraction(c)) / float64(c.DistinctCount)
+}
+
+// LessFraction returns the estimated fraction of the rows whose value is less
+// than v by the histogram. The values in a bucket are assumed to be
+// distributed evenly.
+func (s *TableStats) LessFraction(c *ColumnStats, v interface{}) float64 {
+	h := c.Histogram
+	if len(h) == 0 || compareValues(v, h[0]) <= 0 {
+		return 0
+	}
+	notNull := 1 - s.NullFraction(c)
+	if compareValues(v, h[len(h)-1]) > 0 {
+		return notNull
+	}
+	if len(h) == 1 {
+		return 0
+	}
+	// h[i-1] < v <= h[i]
+	i := sort.Search(len(h), func(i int) bool { return compareValues(h[i], v) >= 0 })
+	within := 0.5
+	lo, lok := h[i-1].(int64)
+	hi, hok := h[i].(int64)
+	x, xok := v.(int64)
+	if lok && hok && xok && hi > lo {
+		within = float64(x-lo) / float64(hi-lo)
+	}
+	buckets := float64(len(h) - 1)
+	return notNull * (float64(i-1) + within) / buckets
+}
+
+// compareValues compares the values of the same type, int64 or string,
+// and returns -1, 0 or +1.
+func compareValues(a, b interface{}) int {
+	switch x := a.(type) {
+	case int64:
+		y, ok := b.(int64)
+		if !ok {
+			return -1
+		}
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	case string:
+		y, ok := b.(string)
+		if !ok {
+			return 1
+		}
+		return strings.Compare(x, y)
+	}
+	return 0
+}
@@ -0,0 +1,86 @@
+package meta
+
+import (
+	"math"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewTableStats(t *testing.T) {
+	s, err := NewScheme("users", []string{"id", "name"}, []DataType{Int, Varchar}, "id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		rows [][]interface{}
+		want *TableStats
+	}{
+		{
+			name: "[Success] empty table",
+			want: &TableStats{
+				TableName: "users",
+				Columns:   []ColumnStats{{Name: "id"}, {Name: "name"}},
+			},
+		},
+		{
+			name: "[Success] null and duplicated values",
+			rows: [][]interface{}{
+				{int64(3), "b"},
+				{int64(1), nil},
+				{int64(2), "a"},
+				{int64(4), "b"},
+			},
+			want: &TableStats{
+				TableName: "users",
+				RowCount:  4,
+				Columns: []ColumnStats{
+					{Name: "id", DistinctCount: 4, Histogram: []interface{}{int64(1), int64(2), int64(3), int64(4)}},
+					{Name: "name", NullCount: 1, DistinctCount: 2, Histogram: []interface{}{"a", "b", "b"}},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewTableStats(s, tt.rows)
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTableStats_Fraction(t *testing.T) {
+	s, err := NewScheme("numbers", []string{"n"}, []DataType{Int}, "n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows [][]interface{}
+	for i := int64(0); i <= 100; i++ {
+		rows = append(rows, []interface{}{i})
+	}
+	stats := NewTableStats(s, rows)
+	c := stats.Column("n")
+
+	near := func(a, b float64) bool { return math.Abs(a-b) < 0.02 }
+	if got := stats.EqualFraction(c); !near(got, 1.0/101) {
+		t.Errorf("EqualFraction() = %v", got)
+	}
+	tests := []struct {
+		v    interface{}
+		want float64
+	}{
+		{v: int64(-1), want: 0},
+		{v: int64(0), want: 0},
+		{v: int64(25), want: 0.25},
+		{v: int64(50), want: 0.5},
+		{v: int64(101), want: 1},
+	}
+	for _, tt := range tests {
+		if got := stats.LessFraction(c, tt.v); !near(got, tt.want) {
+			t.Errorf("LessFraction(%v) = %v, want %v", tt.v, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,621 @@
+package dbms
+
+import (
+	"github.com/nao1215/egsql/dbms/executor"
+	"github.com/nao1215/egsql/dbms/expr"
+	"github.com/nao1215/egsql/dbms/meta"
+	"github.com/nao1215/egsql/dbms/query"
+)
+
+const (
+	// maxJoinLeaves is the maximum number of the relations of the inner joins
+	// that the planner reorders. The larger joins are planned as written.
+	maxJoinLeaves = 64
+	// eqSelectivity is the estimated fraction of the rows that satisfy "="
+	// when the column has no statistics.
+	eqSelectivity = 0.1
+	// defaultSelectivity is the estimated fraction of the rows that satisfy
+	// the other conditions.
+	defaultSelectivity = 1.0 / 3
+)
+
+// joinLeaf is a relation joined by the inner joins of FROM clause.
+type joinLeaf struct {
+	rel *relation
+	// offset is the position of the first column of the relation in the
+	// columns of all relations in the written order.
+	offset int
+	// stats is the statistics of the table collected by ANALYZE, or nil.
+	stats *meta.TableStats
+	// filters is the conditions of WHERE clause that reference only the relation.
+	filters []query.Expr
+	// selectivities is the estimated fraction of the rows that pass each filter.
+	selectivities []float64
+	// filtered is the relation of the rows that pass the filters.
+	filtered *relation
+	// indexScan is a flag indicating whether filtered looks up the table by the index.
+	indexScan bool
+}
+
+// tableRows returns the estimated number of the rows of the relation.
+func (l *joinLeaf) tableRows() float64 {
+	switch {
+	case l.stats != nil:
+		return float64(l.stats.RowCount)
+	case l.rel.table != nil:
+		return float64(l.rel.table.Len())
+	}
+	return 1000
+}
+
+// rows returns the estimated number of the rows that pass the filters.
+func (l *joinLeaf) rows() float64 {
+	rows := l.tableRows()
+	for _, s := range l.selectivities {
+		rows *= s
+	}
+	return rows
+}
+
+// joinCond is a condition that references the columns of two or more relations.
+type joinCond struct {
+	cond query.Expr
+	// leaves is the set of the positions of the relations that cond references.
+	leaves uint64
+	// selectivity is the estimated fraction of the joined rows that satisfy cond.
+	selectivity float64
+}
+
+// joinGraph is the relations of the inner joins and the conditions between them.
+type joinGraph struct {
+	leaves []*joinLeaf
+	conds  []joinCond
+	// columns is the columns of all relations in the written order.
+	columns expr.Columns
+}
+
+// onCond is a condition of ON clause. It can reference the relations
+// from first to last-1, which are in the join.
+type onCond struct {
+	cond        query.Expr
+	first, last int
+}
+
+// planFromWhere plans FROM clause with the conditions of WHERE clause. The
+// inner joins are flattened into the relations and the conditions between
+// them, so that the condition that references one relation is evaluated
+// before the join (predicate pushdown), the table is looked up by the index
+// if it is cheaper than reading all rows, and the relations are joined in the
+// order of the smallest estimated intermediate result if all of them are the
+// tables analyzed by ANALYZE. Otherwise they are joined in the written order.
+// The columns of the relation are in the order of the join, but "*" is
+// expanded in the written order. It returns the conditions of WHERE clause
+// that the caller must evaluate for the rows of the relation.
+func (p *planner) planFromWhere(te query.TableExpr, where query.Expr) (*relation, []query.Expr, error) {
+	var conds []query.Expr
+	if where != nil {
+		conds = query.Conjuncts(where)
+	}
+	units, ons := flattenJoin(te, nil, nil)
+	if te == nil || len(units) > maxJoinLeaves {
+		r, err := p.planFrom(te)
+		return r, conds, err
+	}
+
+	g := &joinGraph{}
+	for _, u := range units {
+		r, err := p.planFrom(u)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := checkAliases(g.columns, r.columns); err != nil {
+			return nil, nil, err
+		}
+		l := &joinLeaf{rel: r, offset: len(g.columns)}
+		if r.table != nil {
+			l.stats = p.db.catalog.FetchStats(r.table.Scheme().TableName)
+		}
+		g.leaves = append(g.leaves, l)
+		g.columns = append(g.columns, r.columns...)
+	}
+
+	var rest []query.Expr
+	for _, on := range ons {
+		bound, leaves, ok := p.bindConjunct(g, on.cond)
+		if !ok || leaves&^leafRange(on.first, on.last) != 0 {
+			// The condition that can not be moved is evaluated in the join as written.
+			r, err := p.planFrom(te)
+			return r, conds, err
+		}
+		rest = g.add(on.cond, bound, leaves, rest)
+	}
+	for _, c := range conds {
+		bound, leaves, ok := p.bindConjunct(g, c)
+		if !ok {
+			rest = append(rest, c)
+			continue
+		}
+		rest = g.add(c, bound, leaves, rest)
+	}
+
+	for _, l := range g.leaves {
+		if err := p.planAccessPath(l); err != nil {
+			return nil, nil, err
+		}
+	}
+	r, err := p.planJoinOrder(g, g.joinOrder())
+	if err != nil {
+		return nil, nil, err
+	}
+	return r, rest, nil
+}
+
+// flattenJoin appends the operands of the inner joins without USING and
+// NATURAL to units, and their ON conditions to ons. The other table
+// expressions are appended to units as they are.
+func flattenJoin(te query.TableExpr, units []query.TableExpr, ons []onCond) ([]query.TableExpr, []onCond) {
+	j, ok := te.(*query.JoinExpr)
+	if !ok || (j.Type != query.InnerJoin && j.Type != query.CrossJoin) || j.Natural || len(j.Using) > 0 {
+		return append(units, te), ons
+	}
+	first := len(units)
+	units, ons = flattenJoin(j.Left, units, ons)
+	units, ons = flattenJoin(j.Right, units, ons)
+	if j.On != nil {
+		for _, c := range query.Conjuncts(j.On) {
+			ons = append(ons, onCond{cond: c, first: first, last: len(units)})
+		}
+	}
+	return units, ons
+}
+
+// bindConjunct binds the condition to the columns of all relations, and
+// returns the set of the relations that it references. It returns false if
+// the condition can not be moved: it has a subquery, it references the outer
+// queries, it is not deterministic, or it can not be bound.
+func (p *planner) bindConjunct(g *joinGraph, cond query.Expr) (expr.Expr, uint64, bool) {
+	if hasSubquery(cond) {
+		return nil, 0, false
+	}
+	bound, err := p.binder(g.columns).BindCondition(cond)
+	if err != nil || !isLocal(bound) || !isDeterministic(bound) {
+		return nil, 0, false
+	}
+	var leaves uint64
+	for _, c := range expr.ColumnsOf(bound) {
+		leaves |= 1 << uint(g.leafOf(c))
+	}
+	return bound, leaves, true
+}
+
+// add adds the condition that references the relations to the filters of the
+// relation or the join conditions. The condition that references no relation
+// is appended to rest.
+func (g *joinGraph) add(cond query.Expr, bound expr.Expr, leaves uint64, rest []query.Expr) []query.Expr {
+	switch {
+	case leaves == 0:
+		return append(rest, cond)
+	case leaves&(leaves-1) == 0:
+		l := g.leaves[g.leafOf(expr.ColumnsOf(bound)[0])]
+		l.filters = append(l.filters, cond)
+		l.selectivities = append(l.selectivities, fraction(g.selectivity(bound)))
+	default:
+		g.conds = append(g.conds, joinCond{cond: cond, leaves: leaves, selectivity: fraction(g.selectivity(bound))})
+	}
+	return rest
+}
+
+// leafOf returns the position of the relation that has the column.
+func (g *joinGraph) leafOf(column int) int {
+	for i := len(g.leaves) - 1; i > 0; i-- {
+		if column >= g.leaves[i].offset {
+			return i
+		}
+	}
+	return 0
+}
+
+// leafRange returns the set of the relations from first to last-1.
+func leafRange(first, last int) uint64 {
+	var set uint64
+	for i := first; i < last; i++ {
+		set |= 1 << uint(i)
+	}
+	return set
+}
+
+// hasSubquery reports whether the parsed expression has a subquery.
+func hasSubquery(e query.Expr) bool {
+	found := false
+	query.Walk(e, func(e query.Expr) bool {
+		switch v := e.(type) {
+		case *query.SubqueryExpr, *query.ExistsExpr:
+			found = true
+		case *query.InExpr:
+			found = v.Select != nil
+		}
+		return !found
+	})
+	return found
+}
+
+// isDeterministic reports whether the expression calls no function that
+// can return the different values for the same arguments, like nextval().
+func isDeterministic(e expr.Expr) bool {
+	deterministic := true
+	expr.Walk(e, func(e expr.Expr) bool {
+		if c, ok := e.(*expr.Call); ok && !c.Deterministic {
+			deterministic = false
+		}
+		return deterministic
+	})
+	return deterministic
+}
+
+// planAccessPath plans the relation of the rows of the leaf that pass its
+// filters. The table is looked up by the index whose columns are all compared
+// with the constants by "=", if the estimated number of the rows looked up is
+// less than the rows of the table. The index of the fewest estimated rows is used.
+func (p *planner) planAccessPath(l *joinLeaf) error {
+	if len(l.filters) == 0 {
+		l.filtered = l.rel
+		return nil
+	}
+	binder := p.binder(l.rel.columns)
+	conds := make([]expr.Expr, 0, len(l.filters))
+	for _, f := range l.filters {
+		c, err := binder.BindCondition(f)
+		if err != nil {
+			return err
+		}
+		conds = append(conds, c)
+	}
+
+	input := l.rel.plan
+	if l.rel.table != nil {
+		if scan, rest := p.planIndexScan(l, conds); scan != nil {
+			input, conds, l.indexScan = scan, rest, true
+		}
+	}
+	l.filtered = &relation{plan: input, columns: l.rel.columns, star: l.rel.star}
+	if len(conds) > 0 {
+		l.filtered.plan = &executor.Filter{Input: input, Cond: expr.And(conds...), Env: p.env}
+	}
+	return nil
+}
+
+// planIndexScan returns the index scan of the table of the leaf and the
+// conditions not used for the lookup, or nil if no index is cheaper than
+// reading all rows.
+func (p *planner) planIndexScan(l *joinLeaf, conds []expr.Expr) (executor.Operator, []expr.Expr) {
+	// byColumn is the position of the condition in conds for the position of the table column.
+	byColumn := make(map[int]int)
+	keys := make([]expr.Expr, len(conds))
+	for i, c := range conds {
+		col, key, ok := constantKey(c)
+		if !ok {
+			continue
+		}
+		if _, dup := byColumn[col.Index]; !dup {
+			byColumn[col.Index] = i
+			keys[i] = key
+		}
+	}
+	scheme := l.rel.table.Scheme()
+	var best *meta.Index
+	bestCost := l.tableRows()
+	for i, idx := range scheme.Indexes {
+		covered := true
+		for _, c := range idx.Columns {
+			if _, ok := byColumn[scheme.ColumnIndex(c)]; !ok {
+				covered = false
+				break
+			}
+		}
+		if !covered {
+			continue
+		}
+		if cost := lookupRows(l, idx); cost < bestCost {
+			best, bestCost = &scheme.Indexes[i], cost
+		}
+	}
+	if best == nil {
+		return nil, conds
+	}
+
+	scan := &executor.IndexScan{Table: l.rel.table, Index: best.Name, Env: p.env}
+	used := make(map[int]bool)
+	for _, c := range best.Columns {
+		i := byColumn[scheme.ColumnIndex(c)]
+		scan.Key = append(scan.Key, keys[i])
+		used[i] = true
+	}
+	var rest []expr.Expr
+	for i, c := range conds {
+		if !used[i] {
+			rest = append(rest, c)
+		}
+	}
+	return scan, rest
+}
+
+// constantKey returns the column and the key if the condition is "=" between
+// the column and the expression that references no column.
+func constantKey(cond expr.Expr) (*expr.Column, expr.Expr, bool) {
+	cmp, ok := cond.(*expr.Comparison)
+	if !ok || cmp.Op != "=" {
+		return nil, nil, false
+	}
+	if col, ok := cmp.Left.(*expr.Column); ok && len(expr.ColumnsOf(cmp.Right)) == 0 {
+		return col, cmp.Right, true
+	}
+	if col, ok := cmp.Right.(*expr.Column); ok && len(expr.ColumnsOf(cmp.Left)) == 0 {
+		return col, cmp.Left, true
+	}
+	return nil, nil, false
+}
+
+// lookupRows returns the estimated number of the rows looked up by the index.
+func lookupRows(l *joinLeaf, idx meta.Index) float64 {
+	if idx.Unique {
+		return 1
+	}
+	rows := l.tableRows()
+	for _, name := range idx.Columns {
+		if c := columnStatsOf(l.stats, name); c != nil {
+			rows *= l.stats.EqualFraction(c)
+		} else {
+			rows *= eqSelectivity
+		}
+	}
+	return rows
+}
+
+// columnStatsOf returns the statistics of the column, or nil if there is no statistics.
+func columnStatsOf(stats *meta.TableStats, name string) *meta.ColumnStats {
+	if stats == nil {
+		return nil
+	}
+	return stats.Column(name)
+}
+
+// joinOrder returns the positions of the relations in the order to join.
+// If all relations have the statistics, the relation of the fewest estimated
+// rows comes first, and then the relation that makes the fewest estimated
+// joined rows is joined one by one, preferring the relations that have a join
+// condition with the joined ones to the cross join. Otherwise the written
+// order is returned.
+func (g *joinGraph) joinOrder() []int {
+	n := len(g.leaves)
+	order := make([]int, 0, n)
+	analyzed := true
+	for i, l := range g.leaves {
+		order = append(order, i)
+		analyzed = analyzed && l.stats != nil
+	}
+	if !analyzed || n < 2 {
+		return order
+	}
+
+	start := 0
+	for i, l := range g.leaves {
+		if l.rows() < g.leaves[start].rows() {
+			start = i
+		}
+	}
+	order = append(order[:0], start)
+	joined := uint64(1) << uint(start)
+	rows := g.leaves[start].rows()
+	for len(order) < n {
+		best, bestRows, bestConnected := -1, 0.0, false
+		for i, l := range g.leaves {
+			bit := uint64(1) << uint(i)
+			if joined&bit != 0 {
+				continue
+			}
+			joinedRows := rows * l.rows()
+			connected := false
+			for _, c := range g.conds {
+				if c.leaves&bit != 0 && c.leaves&^(joined|bit) == 0 {
+					joinedRows *= c.selectivity
+					connected = true
+				}
+			}
+			if best < 0 || (connected && !bestConnected) || (connected == bestConnected && joinedRows < bestRows) {
+				best, bestRows, bestConnected = i, joinedRows, connected
+			}
+		}
+		order = append(order, best)
+		joined |= 1 << uint(best)
+		rows = bestRows
+	}
+	return order
+}
+
+// planJoinOrder joins the relations in the order. Each join condition is
+// evaluated in the first join that has all relations it references.
+func (p *planner) planJoinOrder(g *joinGraph, order []int) (*relation, error) {
+	first := g.leaves[order[0]]
+	r := &relation{plan: first.filtered.plan, columns: first.filtered.columns, table: first.filtered.table}
+	positions := make([]int, len(g.leaves))
+	joined := uint64(1) << uint(order[0])
+	applied := make([]bool, len(g.conds))
+	for _, i := range order[1:] {
+		joined |= 1 << uint(i)
+		var conds []query.Expr
+		for k, c := range g.conds {
+			if !applied[k] && c.leaves&^joined == 0 {
+				conds = append(conds, c.cond)
+				applied[k] = true
+			}
+		}
+		positions[i] = len(r.columns)
+		var err error
+		if r, err = p.joinLeaf(r, g.leaves[i], conds); err != nil {
+			return nil, err
+		}
+	}
+	for i, l := range g.leaves {
+		r.star = append(r.star, offset(l.rel.star, positions[i])...)
+	}
+	return r, nil
+}
+
+// joinLeaf returns the inner join of the relation and the leaf by the conditions.
+// If the table of the leaf is not looked up by the index scan, it can be looked
+// up by the index nested loop join, which checks the filters of the leaf for
+// the joined rows.
+func (p *planner) joinLeaf(left *relation, l *joinLeaf, conds []query.Expr) (*relation, error) {
+	r := &relation{columns: append(append(expr.Columns{}, left.columns...), l.rel.columns...)}
+	binder := p.binder(r.columns)
+	bindAll := func(conds []query.Expr) ([]expr.Expr, error) {
+		bound := make([]expr.Expr, 0, len(conds))
+		for _, c := range conds {
+			b, err := binder.BindCondition(c)
+			if err != nil {
+				return nil, err
+			}
+			bound = append(bound, b)
+		}
+		return bound, nil
+	}
+	bound, err := bindAll(conds)
+	if err != nil {
+		return nil, err
+	}
+
+	if l.rel.table != nil && !l.indexScan && len(l.filters) > 0 {
+		filters, err := bindAll(l.filters)
+		if err != nil {
+			return nil, err
+		}
+		keys, rest := equiKeys(expr.And(append(bound, filters...)...), len(left.columns))
+		if op := planIndexJoin(left, l.rel, keys, rest, executor.InnerJoin, p.env); op != nil {
+			r.plan = op
+			return r, nil
+		}
+	}
+	r.plan = planJoinOperator(left, l.filtered, expr.And(bound...), executor.InnerJoin, p.env)
+	return r, nil
+}
+
+// selectivity returns the estimated fraction of the rows that satisfy the
+// condition bound to the columns of all relations. The statistics of the
+// columns are used if they are analyzed.
+func (g *joinGraph) selectivity(cond expr.Expr) float64 {
+	switch c := cond.(type) {
+	case *expr.Comparison:
+		left, lok := c.Left.(*expr.Column)
+		right, rok := c.Right.(*expr.Column)
+		switch {
+		case lok && rok:
+			return g.joinSelectivity(c.Op, left, right)
+		case lok:
+			return g.compareSelectivity(c.Op, left, c.Right)
+		case rok:
+			return g.compareSelectivity(flipComparison(c.Op), right, c.Left)
+		}
+	case *expr.IsNull:
+		if col, ok := c.Expr.(*expr.Column); ok {
+			if stats, cs := g.columnStats(col); cs != nil {
+				if c.Not {
+					return 1 - stats.NullFraction(cs)
+				}
+				return stats.NullFraction(cs)
+			}
+		}
+	}
+	return defaultSelectivity
+}
+
+// joinSelectivity returns the estimated fraction of the joined rows whose
+// columns are equal: one over the larger number of the distinct values.
+func (g *joinGraph) joinSelectivity(op string, left, right *expr.Column) float64 {
+	if op != "=" {
+		return defaultSelectivity
+	}
+	_, lc := g.columnStats(left)
+	_, rc := g.columnStats(right)
+	if lc == nil || rc == nil {
+		return eqSelectivity
+	}
+	distinct := lc.DistinctCount
+	if rc.DistinctCount > distinct {
+		distinct = rc.DistinctCount
+	}
+	if distinct == 0 {
+		return 0
+	}
+	return 1 / float64(distinct)
+}
+
+// compareSelectivity returns the estimated fraction of the rows whose column
+// satisfies "column op value".
+func (g *joinGraph) compareSelectivity(op string, col *expr.Column, value expr.Expr) float64 {
+	stats, cs := g.columnStats(col)
+	if cs == nil {
+		if op == "=" {
+			return eqSelectivity
+		}
+		return defaultSelectivity
+	}
+	switch op {
+	case "=":
+		return stats.EqualFraction(cs)
+	case "<>":
+		return 1 - stats.NullFraction(cs) - stats.EqualFraction(cs)
+	}
+	v, ok := value.(*expr.Const)
+	if !ok || v.Value == nil {
+		return defaultSelectivity
+	}
+	less := stats.LessFraction(cs, v.Value)
+	switch op {
+	case "<":
+		return less
+	case "<=":
+		return less + stats.EqualFraction(cs)
+	case ">":
+		return 1 - stats.NullFraction(cs) - less - stats.EqualFraction(cs)
+	case ">=":
+		return 1 - stats.NullFraction(cs) - less
+	}
+	return defaultSelectivity
+}
+
+// fraction returns f limited to the range from 0 to 1, because the estimates
+// by the statistics can be out of the range.
+func fraction(f float64) float64 {
+	switch {
+	case f < 0:
+		return 0
+	case f > 1:
+		return 1
+	}
+	return f
+}
+
+// flipComparison returns the operator whose operands are swapped.
+func flipComparison(op string) string {
+	switch op {
+	case "<":
+		return ">"
+	case "<=":
+		return ">="
+	case ">":
+		return "<"
+	case ">=":
+		return "<="
+	}
+	return op
+}
+
+// columnStats returns the statistics of the table and the column, or nil if
+// the column is not of the analyzed table.
+func (g *joinGraph) columnStats(col *expr.Column) (*meta.TableStats, *meta.ColumnStats) {
+	l := g.leaves[g.leafOf(col.Index)]
+	if l.stats == nil {
+		return nil, nil
+	}
+	return l.stats, columnStatsOf(l.stats, g.columns[col.Index].Name)
+}
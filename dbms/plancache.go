@@ -0,0 +1,235 @@
+package dbms
+
+import (
+	"context"
+	"reflect"
+	"sync"
+
+	"github.com/nao1215/egsql/dbms/executor"
+	"github.com/nao1215/egsql/dbms/expr"
+	"github.com/nao1215/egsql/dbms/meta/cache"
+	"github.com/nao1215/egsql/dbms/query"
+)
+
+// PlanCacheSize is the number of the prepared statements that the plan cache keeps.
+const PlanCacheSize = 1024
+
+// PreparedStmt is the statement parsed from the SQL text by Prepare.
+// It is shared by the callers, so it must not be modified.
+type PreparedStmt struct {
+	Stmt query.Stmt
+	// NumInput is the number of the parameter placeholders.
+	NumInput int
+	// key is the normalized SQL text, the key of the plan cache.
+	key string
+}
+
+// PlanCacheStats is the metrics of the plan cache.
+type PlanCacheStats struct {
+	// Hits is the number of the executions that reused the cached plan.
+	Hits int64
+	// Misses is the number of the executions that planned the statement
+	// because no cached plan could be used.
+	Misses int64
+	// Evictions is the number of the statements removed because the cache is full.
+	Evictions int64
+	// Invalidations is the number of the statements removed because the
+	// table definitions or the statistics have changed.
+	Invalidations int64
+	// Size is the number of the statements in the cache.
+	Size int
+	// Capacity is the maximum number of the statements in the cache.
+	Capacity int
+}
+
+// boundPlan is the plan of SELECT statement bound to the tables, the
+// functions and the settings of the session, which the plan cache keeps to
+// execute it again. Before it is executed again, the rows of the tables, the
+// arguments and the context are bound by rebind. A plan is executed by one
+// query at a time, so it is taken out of the cache while it is executed.
+type boundPlan struct {
+	stmt *PreparedStmt
+	// version is the version of the database that the plan is bound at.
+	version uint64
+	// sess is the copy of the settings of the session that the plan is bound with.
+	sess    *Session
+	plan    executor.Operator
+	columns []string
+	// env is the environment of the query, whose Args are the arguments.
+	env *expr.Env
+	// configs is the resources of the operators, whose Context is the context of the query.
+	configs []*executor.Config
+	// rebinds read the rows of the tables again and reset the subqueries.
+	rebinds []func() error
+}
+
+// rebind prepares the plan to be executed again with the context and the arguments.
+// It must be called with db.mutex locked.
+func (b *boundPlan) rebind(ctx context.Context, args []interface{}) error {
+	b.env.Args, b.env.Outer = args, nil
+	for _, c := range b.configs {
+		c.Context = ctx
+	}
+	for _, f := range b.rebinds {
+		if err := f(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cachedStmt is the prepared statement in the plan cache and its plan.
+type cachedStmt struct {
+	stmt *PreparedStmt
+	// plan is the bound plan that is not being executed, or nil.
+	plan *boundPlan
+}
+
+// planCache is the least recently used prepared statements of the database
+// and the bound plans of them. Key is the normalized SQL text, so the SQL
+// texts that differ only in the spaces, the comments or the case of the
+// keywords share the statement and the plan. The plan of SELECT statement
+// is cached; the other statements are planned at each execution. The
+// statements and the plans are discarded when the version of the database
+// changes, e.g. by DDL or ANALYZE.
+type planCache struct {
+	lru *cache.LRU
+	// version is the version of the database of the cached statements.
+	version uint64
+	stats   PlanCacheStats
+	mutex   sync.Mutex
+}
+
+// newPlanCache returns the empty plan cache.
+func newPlanCache() *planCache {
+	return &planCache{lru: cache.NewLRU(PlanCacheSize), stats: PlanCacheStats{Capacity: PlanCacheSize}}
+}
+
+// lookup returns the cached statement of the key, or nil. If the version is
+// newer than that of the cached statements, they are discarded. It must be
+// called with c.mutex locked.
+func (c *planCache) lookup(key string, version uint64) *cachedStmt {
+	if version > c.version {
+		c.stats.Invalidations += int64(c.lru.Len())
+		c.lru.Purge()
+		c.version = version
+	}
+	if version != c.version {
+		return nil
+	}
+	s, _ := c.lru.Get(key).(*cachedStmt)
+	return s
+}
+
+// insert caches the statement. It must be called with c.mutex locked.
+func (c *planCache) insert(s *cachedStmt) {
+	if c.lru.Insert(s.stmt.key, s) != nil {
+		c.stats.Evictions++
+	}
+}
+
+// statement returns the statement of the key, or nil.
+func (c *planCache) statement(key string, version uint64) *PreparedStmt {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if s := c.lookup(key, version); s != nil {
+		return s.stmt
+	}
+	return nil
+}
+
+// putStatement caches the statement parsed at the version. It is not cached
+// if the version of the cache differs.
+func (c *planCache) putStatement(version uint64, p *PreparedStmt) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.version == version && c.lookup(p.key, version) == nil {
+		c.insert(&cachedStmt{stmt: p})
+	}
+}
+
+// take removes the plan of the statement from the cache and returns it, if
+// it is bound at the version with the same settings as the session.
+// Otherwise it returns nil, and the statement must be planned.
+func (c *planCache) take(p *PreparedStmt, version uint64, sess *Session) *boundPlan {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if s := c.lookup(p.key, version); s != nil && s.plan != nil && reflect.DeepEqual(s.plan.sess, sess.settings()) {
+		b := s.plan
+		s.plan = nil
+		c.stats.Hits++
+		return b
+	}
+	c.stats.Misses++
+	return nil
+}
+
+// put returns the plan to the cache after it is executed. It is discarded if
+// the version of the cache differs from that of the plan.
+func (c *planCache) put(b *boundPlan) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.version != b.version {
+		return
+	}
+	if s := c.lookup(b.stmt.key, b.version); s != nil {
+		s.plan = b
+		return
+	}
+	c.insert(&cachedStmt{stmt: b.stmt, plan: b})
+}
+
+// Prepare parses the SQL text, or returns the statement cached by the plan
+// cache of the database. The SQL texts of the same normal form share the
+// statement (see query.Normalize). QueryPrepared executes the statement
+// with the cached plan.
+func (db *EgSQLDB) Prepare(sql string) (*PreparedStmt, error) {
+	key, err := query.Normalize(sql)
+	if err != nil {
+		return nil, err
+	}
+	version := db.Version()
+	if p := db.plans.statement(key, version); p != nil {
+		return p, nil
+	}
+	stmt, numInput, err := query.Parse(sql)
+	if err != nil {
+		return nil, err
+	}
+	p := &PreparedStmt{Stmt: stmt, NumInput: numInput, key: key}
+	db.plans.putStatement(version, p)
+	return p, nil
+}
+
+// bindSelect plans SELECT statement to be cached by the plan cache. The plan
+// is bound with the copy of the settings of the session, so that it does not
+// change when the settings of the session change. It must be called with
+// db.mutex locked.
+func (db *EgSQLDB) bindSelect(ctx context.Context, sess *Session, p *PreparedStmt, args []interface{}) (*boundPlan, error) {
+	b := &boundPlan{stmt: p, version: db.version, sess: sess.settings(), env: &expr.Env{Args: args}}
+	pl := &planner{db: db, sess: b.sess, ctx: ctx, env: b.env, bound: b}
+	r, err := pl.planSelect(p.Stmt.(*query.SelectStmt))
+	if err != nil {
+		return nil, err
+	}
+	b.plan = r.plan
+	for _, c := range r.columns {
+		b.columns = append(b.columns, c.Name)
+	}
+	return b, nil
+}
+
+// PlanCacheStats returns the metrics of the plan cache.
+func (db *EgSQLDB) PlanCacheStats() PlanCacheStats {
+	c := db.plans
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	stats := c.stats
+	stats.Size = c.lru.Len()
+	return stats
+}
@@ -0,0 +1,220 @@
+package dbms
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// queryPrepared executes the prepared statement by QueryPrepared, and returns the rows.
+func queryPrepared(t *testing.T, db *EgSQLDB, sess *Session, p *PreparedStmt, args ...interface{}) [][]interface{} {
+	t.Helper()
+
+	rows, err := db.QueryPrepared(context.Background(), sess, p, args)
+	if err != nil {
+		t.Fatalf("QueryPrepared() error = %v", err)
+	}
+	defer rows.Close()
+
+	var got [][]interface{}
+	for {
+		b, err := rows.NextBatch()
+		if err == io.EOF {
+			return got
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j := 0; j < b.Len; j++ {
+			got = append(got, b.Row(j))
+		}
+	}
+}
+
+func TestEgSQLDB_Prepare(t *testing.T) {
+	db, err := NewEgSQLDB(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := db.Prepare("SELECT id FROM users WHERE id = ?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.NumInput != 1 {
+		t.Errorf("NumInput = %d, want 1", first.NumInput)
+	}
+	second, err := db.Prepare("select ID\n  from USERS where id = ?; -- same statement")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Error("the statements of the same normal form are not shared")
+	}
+
+	// DDL changes the version of the table definitions, which discards the statements.
+	if _, err := execSQL(t, db, "CREATE TABLE users (id INT PRIMARY KEY)"); err != nil {
+		t.Fatal(err)
+	}
+	third, err := db.Prepare("SELECT id FROM users WHERE id = ?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third == first {
+		t.Error("the statement is not prepared again after DDL")
+	}
+	if diff := cmp.Diff(PlanCacheStats{Invalidations: 1, Size: 1, Capacity: PlanCacheSize}, db.PlanCacheStats()); diff != "" {
+		t.Errorf("PlanCacheStats() mismatch (-want +got):\n%s", diff)
+	}
+
+	for i := 0; i < PlanCacheSize; i++ {
+		if _, err := db.Prepare(fmt.Sprintf("SELECT %d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stats := db.PlanCacheStats()
+	if stats.Evictions != 1 || stats.Size != PlanCacheSize {
+		t.Errorf("Evictions = %d, Size = %d, want 1, %d", stats.Evictions, stats.Size, PlanCacheSize)
+	}
+
+	if _, err := db.Prepare("SELECT 'unterminated"); err == nil {
+		t.Error("Prepare() of invalid SQL succeeds")
+	}
+}
+
+func TestEgSQLDB_QueryPrepared(t *testing.T) {
+	db, err := NewEgSQLDB(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sql := range []string{
+		"CREATE TABLE users (id INT PRIMARY KEY, name VARCHAR)",
+		"INSERT INTO users VALUES (1, 'alice'), (2, 'bob')",
+	} {
+		if _, err := execSQL(t, db, sql); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p, err := db.Prepare("SELECT id, name FROM users WHERE id >= ? ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess := NewSession()
+
+	got := queryPrepared(t, db, sess, p, int64(1))
+	if diff := cmp.Diff([][]interface{}{{int64(1), "alice"}, {int64(2), "bob"}}, got); diff != "" {
+		t.Errorf("rows mismatch (-want +got):\n%s", diff)
+	}
+
+	// The cached plan reads the rows inserted after it is planned, with the new arguments.
+	if _, err := execSQL(t, db, "INSERT INTO users VALUES (3, 'carol')"); err != nil {
+		t.Fatal(err)
+	}
+	got = queryPrepared(t, db, sess, p, int64(2))
+	if diff := cmp.Diff([][]interface{}{{int64(2), "bob"}, {int64(3), "carol"}}, got); diff != "" {
+		t.Errorf("rows mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(PlanCacheStats{Hits: 1, Misses: 1, Size: 1, Capacity: PlanCacheSize}, db.PlanCacheStats()); diff != "" {
+		t.Errorf("PlanCacheStats() mismatch (-want +got):\n%s", diff)
+	}
+
+	// The plan is executed by one query at a time, so the query while the
+	// rows of the cached plan are open plans the statement again.
+	open, err := db.QueryPrepared(context.Background(), sess, p, []interface{}{int64(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = queryPrepared(t, db, sess, p, int64(3))
+	if diff := cmp.Diff([][]interface{}{{int64(3), "carol"}}, got); diff != "" {
+		t.Errorf("rows mismatch (-want +got):\n%s", diff)
+	}
+	if err := open.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(PlanCacheStats{Hits: 2, Misses: 2, Size: 1, Capacity: PlanCacheSize}, db.PlanCacheStats()); diff != "" {
+		t.Errorf("PlanCacheStats() mismatch (-want +got):\n%s", diff)
+	}
+
+	// The plan bound with the other settings of the session is not used.
+	other := NewSession()
+	other.DisableHashAgg = true
+	queryPrepared(t, db, other, p, int64(1))
+	if stats := db.PlanCacheStats(); stats.Hits != 2 || stats.Misses != 3 {
+		t.Errorf("Hits = %d, Misses = %d, want 2, 3", stats.Hits, stats.Misses)
+	}
+
+	// ANALYZE changes the version of the database, which discards the plans.
+	if _, err := execSQL(t, db, "ANALYZE users"); err != nil {
+		t.Fatal(err)
+	}
+	queryPrepared(t, db, sess, p, int64(1))
+	if diff := cmp.Diff(PlanCacheStats{Hits: 2, Misses: 4, Invalidations: 1, Size: 1, Capacity: PlanCacheSize}, db.PlanCacheStats()); diff != "" {
+		t.Errorf("PlanCacheStats() mismatch (-want +got):\n%s", diff)
+	}
+
+	rs := querySQL(t, db, "SELECT hits, misses, evictions, invalidations, size, capacity FROM egsql_catalog.egsql_plan_cache")
+	want := [][]interface{}{{int64(2), int64(4), int64(0), int64(1), int64(1), int64(PlanCacheSize)}}
+	if diff := cmp.Diff(want, rs.Rows); diff != "" {
+		t.Errorf("egsql_plan_cache mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestEgSQLDB_QueryPrepared_Reuse(t *testing.T) {
+	db, err := NewEgSQLDB(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sql := range []string{
+		"CREATE TABLE a (id INT PRIMARY KEY, v INT)",
+		"CREATE TABLE b (id INT PRIMARY KEY, a_id INT)",
+		"INSERT INTO a VALUES (1, 10), (2, 20), (3, 10)",
+		"INSERT INTO b VALUES (1, 1), (2, 3)",
+	} {
+		if _, err := execSQL(t, db, sql); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		sql  string
+	}{
+		{name: "[Success] index scan", sql: "SELECT v FROM a WHERE id = 4"},
+		{name: "[Success] join", sql: "SELECT a.id, b.id FROM a JOIN b ON a.id = b.a_id ORDER BY a.id"},
+		{name: "[Success] aggregate", sql: "SELECT v, count(*) FROM a GROUP BY v ORDER BY v"},
+		{name: "[Success] uncorrelated subquery", sql: "SELECT id FROM a WHERE v = (SELECT max(v) FROM a) ORDER BY id"},
+		{name: "[Success] semi join", sql: "SELECT id FROM a WHERE EXISTS (SELECT 1 FROM b WHERE b.a_id = a.id) ORDER BY id"},
+		{name: "[Success] set operation", sql: "SELECT id FROM a EXCEPT SELECT a_id FROM b ORDER BY 1"},
+		{name: "[Success] window", sql: "SELECT id, row_number() OVER (ORDER BY id DESC) FROM a ORDER BY id"},
+		{name: "[Success] recursive query", sql: "WITH RECURSIVE r (n) AS (SELECT 1 UNION SELECT n + 1 FROM r WHERE n < (SELECT count(*) FROM a)) SELECT max(n) FROM r"},
+		{name: "[Success] limit", sql: "SELECT id FROM a ORDER BY id DESC LIMIT 2"},
+		{name: "[Success] system view", sql: "SELECT size FROM egsql_catalog.egsql_plan_cache"},
+	}
+	sess := NewSession()
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := db.Prepare(tt.sql)
+			if err != nil {
+				t.Fatal(err)
+			}
+			queryPrepared(t, db, sess, p)
+
+			// The cached plan returns the same rows as the new plan after the rows change.
+			if _, err := execSQL(t, db, "INSERT INTO a VALUES (?, 20)", int64(4+i)); err != nil {
+				t.Fatal(err)
+			}
+			hits := db.PlanCacheStats().Hits
+			got := queryPrepared(t, db, sess, p)
+			if db.PlanCacheStats().Hits != hits+1 {
+				t.Error("the cached plan is not used")
+			}
+			want := querySQL(t, db, tt.sql).Rows
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("rows mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
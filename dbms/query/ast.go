@@ -0,0 +1,600 @@
+package query
+
+import "github.com/nao1215/egsql/dbms/meta"
+
+// Stmt is a parsed SQL statement.
+type Stmt interface {
+	// stmt is a marker so that only the statements in this package are Stmt.
+	stmt()
+}
+
+// Expr is a parsed SQL expression.
+type Expr interface {
+	// expr is a marker so that only the expressions in this package are Expr.
+	expr()
+}
+
+// ObjectName is the name of a table or a sequence, optionally qualified
+// with the schema name like "schema.name".
+type ObjectName struct {
+	// Schema is schema name. It is empty if the name is not qualified.
+	Schema string
+	// Name is the name in the schema.
+	Name string
+}
+
+// String returns the name as written in SQL.
+func (n ObjectName) String() string {
+	if n.Schema == "" {
+		return n.Name
+	}
+	return n.Schema + "." + n.Name
+}
+
+// CreateTableStmt is CREATE TABLE statement.
+type CreateTableStmt struct {
+	// Name is table name.
+	Name ObjectName
+	// Columns is the column definitions.
+	Columns []ColumnDef
+	// PrimaryKey is the columns of the primary key, specified by the column
+	// constraint or the table constraint.
+	PrimaryKey []string
+	// Uniques is the columns of each UNIQUE constraint.
+	Uniques [][]string
+	// ForeignKeys is the FOREIGN KEY constraints.
+	ForeignKeys []ForeignKeyDef
+}
+
+// ColumnDef is a column definition in CREATE TABLE statement.
+type ColumnDef struct {
+	// Name is column name.
+	Name string
+	// Type is column data type.
+	Type meta.DataType
+	// Default is the DEFAULT value. It is nil if not specified.
+	Default Expr
+	// Identity is a flag indicating whether the column is AUTOINCREMENT or
+	// GENERATED AS IDENTITY.
+	Identity bool
+	// Always is a flag indicating whether the column is GENERATED ALWAYS AS IDENTITY.
+	Always bool
+}
+
+// ForeignKeyDef is a FOREIGN KEY constraint (REFERENCES clause).
+type ForeignKeyDef struct {
+	// Name is constraint name. It is empty if CONSTRAINT name is not specified.
+	Name string
+	// Columns is the referencing columns.
+	Columns []string
+	// RefTable is the referenced table name.
+	RefTable ObjectName
+	// RefColumns is the referenced columns. It is empty if not specified.
+	RefColumns []string
+	// OnDelete is the action of ON DELETE.
+	OnDelete meta.ReferentialAction
+	// OnUpdate is the action of ON UPDATE.
+	OnUpdate meta.ReferentialAction
+	// Deferred is a flag indicating whether INITIALLY DEFERRED is specified.
+	Deferred bool
+}
+
+// CreateSequenceStmt is CREATE SEQUENCE statement.
+type CreateSequenceStmt struct {
+	// Name is sequence name.
+	Name ObjectName
+	// Start is the value of START WITH. It is 1 if not specified.
+	Start int64
+	// Increment is the value of INCREMENT BY. It is 1 if not specified.
+	Increment int64
+}
+
+// InsertStmt is INSERT statement.
+type InsertStmt struct {
+	// Table is table name.
+	Table ObjectName
+	// Columns is the column names. It is empty if not specified,
+	// which means all columns in the table order.
+	Columns []string
+	// Rows is the rows of VALUES clause. It is nil if Select is specified.
+	Rows [][]Expr
+	// Select is the query whose result rows are inserted, or nil.
+	Select *SelectStmt
+	// OnConflict is ON CONFLICT clause, or nil.
+	OnConflict *OnConflict
+}
+
+// OnConflict is ON CONFLICT clause of INSERT statement. It specifies the
+// action for the row that conflicts with an existing row on the primary key
+// or a unique constraint.
+type OnConflict struct {
+	// Columns is the columns of the primary key or the unique constraint to
+	// check. It is empty if not specified, which means all of them.
+	Columns []string
+	// DoNothing is true for DO NOTHING, which skips the row.
+	DoNothing bool
+	// Set is the assignments of DO UPDATE SET, which updates the existing row.
+	// The values can reference the columns of the existing row, and those of
+	// the row to insert qualified with "excluded".
+	Set []Assignment
+	// Where is the condition of DO UPDATE, or nil. The existing row is not
+	// updated unless it is true.
+	Where Expr
+}
+
+// UpdateStmt is UPDATE statement.
+type UpdateStmt struct {
+	Table ObjectName
+	// Alias is the alias of the table. It is empty if not specified.
+	Alias string
+	// Set is the assignments of SET clause. The values can reference the
+	// columns of the row before the update.
+	Set []Assignment
+	// Where is the condition of WHERE clause. It is nil if not specified,
+	// which means all rows.
+	Where Expr
+}
+
+// DeleteStmt is DELETE statement.
+type DeleteStmt struct {
+	Table ObjectName
+	// Alias is the alias of the table. It is empty if not specified.
+	Alias string
+	// Where is the condition of WHERE clause. It is nil if not specified,
+	// which means all rows.
+	Where Expr
+}
+
+// Assignment is "column = expr" of SET clause.
+type Assignment struct {
+	Column string
+	Value  Expr
+}
+
+// AlterTableStmt is ALTER TABLE statement.
+type AlterTableStmt struct {
+	// Table is table name.
+	Table ObjectName
+	// Action is the change of the table.
+	Action AlterAction
+}
+
+// AlterAction is the change of the table in ALTER TABLE statement.
+type AlterAction interface {
+	// alterAction is a marker so that only the actions in this package are AlterAction.
+	alterAction()
+}
+
+// AddColumn is ADD COLUMN action.
+type AddColumn struct {
+	// Column is the column definition. Only DEFAULT is allowed as the constraint.
+	Column ColumnDef
+}
+
+// DropColumn is DROP COLUMN action.
+type DropColumn struct {
+	// Column is column name.
+	Column string
+}
+
+// RenameColumn is RENAME COLUMN action.
+type RenameColumn struct {
+	// Column is the current column name.
+	Column string
+	// NewName is the new column name.
+	NewName string
+}
+
+// RenameTable is RENAME TO action.
+type RenameTable struct {
+	// NewName is the new table name. The table stays in the same schema.
+	NewName string
+}
+
+// AlterColumnDefault is ALTER COLUMN ... SET DEFAULT and DROP DEFAULT action.
+type AlterColumnDefault struct {
+	// Column is column name.
+	Column string
+	// Default is the new default value. It is nil for DROP DEFAULT.
+	Default Expr
+}
+
+// DropTableStmt is DROP TABLE statement.
+type DropTableStmt struct {
+	// Name is table name.
+	Name ObjectName
+	// IfExists is a flag indicating whether IF EXISTS is specified.
+	IfExists bool
+}
+
+// TruncateStmt is TRUNCATE TABLE statement.
+type TruncateStmt struct {
+	// Tables is the table names.
+	Tables []ObjectName
+}
+
+// AnalyzeStmt is ANALYZE statement.
+type AnalyzeStmt struct {
+	// Table is the table name. It is nil if all tables are analyzed.
+	Table *ObjectName
+}
+
+// ExplainStmt is EXPLAIN [ANALYZE] statement.
+type ExplainStmt struct {
+	// Analyze is a flag indicating whether the statement is executed to
+	// measure the operators.
+	Analyze bool
+	Stmt    Stmt
+}
+
+// CreateSchemaStmt is CREATE SCHEMA statement.
+type CreateSchemaStmt struct {
+	// Name is schema name.
+	Name string
+}
+
+// DropSchemaStmt is DROP SCHEMA statement.
+type DropSchemaStmt struct {
+	// Name is schema name.
+	Name string
+	// IfExists is a flag indicating whether IF EXISTS is specified.
+	IfExists bool
+	// Cascade is a flag indicating whether CASCADE is specified.
+	Cascade bool
+}
+
+// SetStmt is SET statement that changes the setting of the session.
+type SetStmt struct {
+	// Name is setting name in lower case.
+	Name string
+	// Values is the values of the setting.
+	Values []string
+}
+
+// SelectStmt is SELECT statement.
+type SelectStmt struct {
+	// With is the common table expressions of WITH clause.
+	With []CommonTableExpr
+	// Recursive is a flag indicating whether WITH RECURSIVE is specified.
+	Recursive bool
+	// SetOp is the set operation of the query like "left UNION right". If it
+	// is not nil, the fields of SELECT clause to HAVING clause are not set.
+	SetOp *SetOperation
+	// Items is the select list.
+	Items []SelectItem
+	// From is the table or the join of FROM clause. It is nil if FROM is not specified.
+	// The comma separated tables are the cross join of them.
+	From TableExpr
+	// Where is the condition of WHERE clause. It is nil if not specified.
+	Where Expr
+	// GroupBy is the expressions of GROUP BY clause.
+	GroupBy []Expr
+	// Having is the condition of HAVING clause. It is nil if not specified.
+	Having Expr
+	// OrderBy is the sort keys of ORDER BY clause, which sorts the rows of
+	// the query including the set operation.
+	OrderBy []OrderItem
+	// Limit is the maximum number of the rows of LIMIT clause. It is nil if not specified.
+	Limit Expr
+	// Offset is the number of the rows skipped by OFFSET clause. It is nil if not specified.
+	Offset Expr
+}
+
+// OrderItem is a sort key of ORDER BY clause.
+type OrderItem struct {
+	Expr Expr
+	// Desc is a flag indicating whether DESC is specified.
+	Desc bool
+	// NullsFirst is a flag indicating whether NULL comes first. If NULLS FIRST
+	// or NULLS LAST is not specified, NULL is larger than any value: it comes
+	// last in ascending order and first in descending order.
+	NullsFirst bool
+}
+
+// CommonTableExpr is "name [(columns)] AS (query)" of WITH clause.
+type CommonTableExpr struct {
+	Name string
+	// Columns is the column names. If it is empty, the column names of the query are used.
+	Columns []string
+	Select  *SelectStmt
+}
+
+// SetOpType is the type of the set operation.
+type SetOpType int
+
+const (
+	// Union is UNION.
+	Union SetOpType = iota
+	// Intersect is INTERSECT.
+	Intersect
+	// Except is EXCEPT.
+	Except
+)
+
+// String returns the keyword of the set operation.
+func (t SetOpType) String() string {
+	switch t {
+	case Union:
+		return "UNION"
+	case Intersect:
+		return "INTERSECT"
+	case Except:
+		return "EXCEPT"
+	}
+	return "UNKNOWN"
+}
+
+// SetOperation is the set operation of two queries "left {UNION | INTERSECT | EXCEPT} [ALL] right".
+type SetOperation struct {
+	Op SetOpType
+	// All is a flag indicating whether ALL is specified. The duplicate rows are
+	// removed unless it is true.
+	All   bool
+	Left  *SelectStmt
+	Right *SelectStmt
+}
+
+// SelectItem is an item of the select list.
+type SelectItem struct {
+	// Star is a flag indicating whether the item is "*" (all columns) or
+	// "table.*" (all columns of the table). If Star is true, Expr and Alias are not set.
+	Star bool
+	// Table is the table name of "table.*". It is empty for "*".
+	Table string
+	// Expr is the expression of the item.
+	Expr Expr
+	// Alias is the output column name specified by AS. It is empty if not specified.
+	Alias string
+}
+
+// TableExpr is an item of FROM clause: TableRef or JoinExpr.
+type TableExpr interface {
+	tableExpr()
+}
+
+// TableRef is a table in FROM clause.
+type TableRef struct {
+	Name ObjectName
+	// Alias is the name of the table in the statement. It is empty if not specified.
+	Alias string
+}
+
+// JoinType is the type of the join. It is Enum.
+type JoinType uint8
+
+const (
+	// InnerJoin is [INNER] JOIN.
+	InnerJoin JoinType = iota
+	// LeftJoin is LEFT [OUTER] JOIN.
+	LeftJoin
+	// RightJoin is RIGHT [OUTER] JOIN.
+	RightJoin
+	// FullJoin is FULL [OUTER] JOIN.
+	FullJoin
+	// CrossJoin is CROSS JOIN or the comma separated tables.
+	CrossJoin
+)
+
+// JoinExpr is the join of two table expressions.
+type JoinExpr struct {
+	Type  JoinType
+	Left  TableExpr
+	Right TableExpr
+	// On is the join condition of ON clause. It is nil if not specified.
+	On Expr
+	// Using is the column names of USING clause.
+	Using []string
+	// Natural is a flag indicating whether the join is NATURAL JOIN,
+	// which is USING the columns that have the same name in both tables.
+	Natural bool
+}
+
+// DerivedTable is the subquery in FROM clause "(SELECT ...) [AS] alias".
+type DerivedTable struct {
+	Select *SelectStmt
+	// Alias is the name of the table in the statement. It is required.
+	Alias string
+}
+
+// Literal is a constant value: int64, string, bool (TRUE or FALSE) or nil (NULL).
+type Literal struct {
+	Value interface{}
+}
+
+// Param is a parameter placeholder "?". Index is the 0-origin position
+// of the placeholder in the statement.
+type Param struct {
+	Index int
+}
+
+// FuncCall is a function call such as nextval('seq').
+type FuncCall struct {
+	// Name is function name in lower case.
+	Name string
+	// Args is the arguments.
+	Args []Expr
+	// Star is a flag indicating whether the argument is "*" like COUNT(*).
+	Star bool
+	// Distinct is a flag indicating whether DISTINCT is specified before
+	// the arguments of the aggregate function like COUNT(DISTINCT x).
+	Distinct bool
+	// Over is the window of the window function call "f(...) OVER (...)".
+	// It is nil if the function is not called as a window function.
+	Over *WindowSpec
+}
+
+// WindowSpec is the window of OVER clause.
+type WindowSpec struct {
+	// PartitionBy is the expressions of PARTITION BY clause.
+	PartitionBy []Expr
+	// OrderBy is the sort keys of ORDER BY clause in the partition.
+	OrderBy []OrderItem
+	// Frame is the frame clause. It is nil if not specified, which means
+	// RANGE BETWEEN UNBOUNDED PRECEDING AND CURRENT ROW.
+	Frame *WindowFrame
+}
+
+// WindowFrame is the frame clause "{ROWS | RANGE} BETWEEN start AND end".
+type WindowFrame struct {
+	// Range is a flag indicating whether RANGE is specified. The frame of
+	// RANGE consists of the peer rows, which have the same ORDER BY values.
+	Range bool
+	Start FrameBound
+	End   FrameBound
+}
+
+// FrameBoundType is the type of the bound of the window frame.
+type FrameBoundType int
+
+const (
+	// UnboundedPreceding is UNBOUNDED PRECEDING: the first row of the partition.
+	UnboundedPreceding FrameBoundType = iota
+	// Preceding is "n PRECEDING": n rows before the current row.
+	Preceding
+	// CurrentRow is CURRENT ROW.
+	CurrentRow
+	// Following is "n FOLLOWING": n rows after the current row.
+	Following
+	// UnboundedFollowing is UNBOUNDED FOLLOWING: the last row of the partition.
+	UnboundedFollowing
+)
+
+// FrameBound is the start or the end of the window frame.
+type FrameBound struct {
+	Type FrameBoundType
+	// Offset is n of "n PRECEDING" and "n FOLLOWING".
+	Offset int64
+}
+
+// ColumnRef is a reference to the column, optionally qualified with
+// the table name like "users.id".
+type ColumnRef struct {
+	// Table is table name. It is empty if the column is not qualified.
+	Table string
+	// Name is column name.
+	Name string
+}
+
+// BinaryExpr is a binary operation. Op is one of the arithmetic operators
+// "+", "-", "*", "/", "%", the comparison operators "=", "<>", "<", "<=",
+// ">", ">=", the concatenation operator "||", and "AND", "OR".
+// "!=" is parsed as "<>".
+type BinaryExpr struct {
+	Op    string
+	Left  Expr
+	Right Expr
+}
+
+// UnaryExpr is a unary operation. Op is "NOT" or "-".
+type UnaryExpr struct {
+	Op   string
+	Expr Expr
+}
+
+// LikeExpr is [NOT] LIKE or [NOT] ILIKE pattern matching.
+type LikeExpr struct {
+	Expr    Expr
+	Pattern Expr
+	// Escape is the escape character specified by ESCAPE. It is nil if not specified.
+	Escape Expr
+	// Not is a flag indicating whether NOT LIKE is specified.
+	Not bool
+	// CaseInsensitive is a flag indicating whether ILIKE is specified.
+	CaseInsensitive bool
+}
+
+// InExpr is expr [NOT] IN (list) or expr [NOT] IN (SELECT ...).
+type InExpr struct {
+	Expr Expr
+	List []Expr
+	// Select is the subquery whose rows are the list. It is nil for the list of expressions.
+	Select *SelectStmt
+	Not    bool
+}
+
+// BetweenExpr is expr [NOT] BETWEEN low AND high.
+type BetweenExpr struct {
+	Expr Expr
+	Low  Expr
+	High Expr
+	Not  bool
+}
+
+// IsNullExpr is expr IS [NOT] NULL.
+type IsNullExpr struct {
+	Expr Expr
+	Not  bool
+}
+
+// CaseExpr is CASE expression. If Operand is not nil, it is the simple CASE
+// "CASE operand WHEN value THEN result ..." that compares operand with values.
+type CaseExpr struct {
+	// Operand is the operand of the simple CASE. It is nil for the searched CASE.
+	Operand Expr
+	Whens   []When
+	// Else is the result of ELSE clause. It is nil if not specified.
+	Else Expr
+}
+
+// When is WHEN condition THEN result clause of CASE expression.
+type When struct {
+	Cond   Expr
+	Result Expr
+}
+
+// CastExpr is CAST(expr AS type).
+type CastExpr struct {
+	Expr Expr
+	Type meta.DataType
+}
+
+// SubqueryExpr is the scalar subquery "(SELECT ...)". Its value is the value
+// of the only column of the only row, or NULL if there is no row.
+type SubqueryExpr struct {
+	Select *SelectStmt
+}
+
+// ExistsExpr is EXISTS (SELECT ...).
+type ExistsExpr struct {
+	Select *SelectStmt
+}
+
+func (*CreateTableStmt) stmt()    {}
+func (*CreateSequenceStmt) stmt() {}
+func (*InsertStmt) stmt()         {}
+func (*UpdateStmt) stmt()         {}
+func (*DeleteStmt) stmt()         {}
+func (*AlterTableStmt) stmt()     {}
+func (*DropTableStmt) stmt()      {}
+func (*TruncateStmt) stmt()       {}
+func (*AnalyzeStmt) stmt()        {}
+func (*ExplainStmt) stmt()        {}
+func (*CreateSchemaStmt) stmt()   {}
+func (*DropSchemaStmt) stmt()     {}
+func (*SetStmt) stmt()            {}
+func (*SelectStmt) stmt()         {}
+
+func (*TableRef) tableExpr()     {}
+func (*JoinExpr) tableExpr()     {}
+func (*DerivedTable) tableExpr() {}
+
+func (*AddColumn) alterAction()          {}
+func (*DropColumn) alterAction()         {}
+func (*RenameColumn) alterAction()       {}
+func (*RenameTable) alterAction()        {}
+func (*AlterColumnDefault) alterAction() {}
+
+func (*Literal) expr()      {}
+func (*Param) expr()        {}
+func (*FuncCall) expr()     {}
+func (*ColumnRef) expr()    {}
+func (*BinaryExpr) expr()   {}
+func (*UnaryExpr) expr()    {}
+func (*LikeExpr) expr()     {}
+func (*InExpr) expr()       {}
+func (*BetweenExpr) expr()  {}
+func (*IsNullExpr) expr()   {}
+func (*CaseExpr) expr()     {}
+func (*CastExpr) expr()     {}
+func (*SubqueryExpr) expr() {}
+func (*ExistsExpr) expr()   {}
@@ -0,0 +1,18 @@
+package query
+
+import "errors"
+
+var (
+	// ErrUnexpectedChar means that the SQL text has a character that is not a part of any token.
+	ErrUnexpectedChar = errors.New("unexpected character")
+	// ErrUnterminatedString means that the closing quote of the string literal is missing.
+	ErrUnterminatedString = errors.New("unterminated string literal")
+	// ErrUnterminatedIdent means that the closing double quote of the quoted identifier is missing.
+	ErrUnterminatedIdent = errors.New("unterminated quoted identifier")
+	// ErrEmptyIdent means that the quoted identifier is empty ("").
+	ErrEmptyIdent = errors.New("zero-length quoted identifier")
+	// ErrSyntax means that the SQL text does not follow the grammar.
+	ErrSyntax = errors.New("syntax error")
+	// ErrNotSupportedStatement means that the statement is not supported by egsql yet.
+	ErrNotSupportedStatement = errors.New("not supported statement")
+)
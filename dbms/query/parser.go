@@ -0,0 +1,1833 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/nao1215/egsql/dbms/meta"
+	"github.com/nao1215/egsql/misc/errfmt"
+)
+
+// nonReserved is the keywords that can be used as identifiers.
+var nonReserved = map[string]bool{
+	"ACTION": true, "ALWAYS": true, "CASCADE": true, "CURRENT": true, "DEFERRED": true,
+	"FIRST": true, "FOLLOWING": true, "IDENTITY": true, "IMMEDIATE": true,
+	"INCREMENT": true, "KEY": true, "LAST": true, "NO": true, "NULLS": true,
+	"PARTITION": true, "PRECEDING": true, "RANGE": true, "RESTRICT": true, "ROW": true,
+	"ROWS": true, "SCHEMA": true, "SEQUENCE": true, "START": true, "TEXT": true,
+	"UNBOUNDED": true,
+}
+
+// parser is a recursive descent parser of SQL.
+type parser struct {
+	tokens []Token
+	pos    int
+	// params is the number of parameter placeholders found so far.
+	params int
+}
+
+// ParseObjectName parses the text "[schema.]name" with the same identifier
+// rules as SQL; for example, the argument of nextval('Sales."Orders"') is
+// sales.Orders.
+func ParseObjectName(text string) (ObjectName, error) {
+	tokens, err := Tokenize(text)
+	if err != nil {
+		return ObjectName{}, err
+	}
+	p := &parser{tokens: tokens}
+	name, err := p.expectObjectName()
+	if err != nil {
+		return ObjectName{}, err
+	}
+	if p.peek().Kind != EOF {
+		return ObjectName{}, p.errorf("unexpected %q after the name", p.peek().Raw)
+	}
+	return name, nil
+}
+
+// Parse parses the SQL text that has one statement (with an optional
+// trailing semicolon) and returns the statement and the number of
+// parameter placeholders in it.
+func Parse(sql string) (Stmt, int, error) {
+	tokens, err := Tokenize(sql)
+	if err != nil {
+		return nil, 0, err
+	}
+	p := &parser{tokens: tokens}
+
+	stmt, err := p.parseStmt()
+	if err != nil {
+		return nil, 0, err
+	}
+	p.acceptSymbol(";")
+	if p.peek().Kind != EOF {
+		return nil, 0, p.errorf("unexpected %q after the statement", p.peek().Raw)
+	}
+	return stmt, p.params, nil
+}
+
+// parseStmt parses a statement.
+func (p *parser) parseStmt() (Stmt, error) {
+	switch {
+	case p.acceptKeyword("CREATE"):
+		switch {
+		case p.acceptKeyword("TABLE"):
+			return p.parseCreateTable()
+		case p.acceptKeyword("SEQUENCE"):
+			return p.parseCreateSequence()
+		case p.acceptKeyword("SCHEMA"):
+			name, err := p.expectIdent()
+			if err != nil {
+				return nil, err
+			}
+			return &CreateSchemaStmt{Name: name}, nil
+		}
+	case p.acceptKeyword("INSERT"):
+		return p.parseInsert()
+	case p.acceptKeyword("UPDATE"):
+		return p.parseUpdate()
+	case p.acceptKeyword("DELETE"):
+		return p.parseDelete()
+	case p.acceptKeyword("ALTER"):
+		if err := p.expectKeyword("TABLE"); err != nil {
+			return nil, err
+		}
+		return p.parseAlterTable()
+	case p.acceptKeyword("DROP"):
+		if p.acceptKeyword("SCHEMA") {
+			return p.parseDropSchema()
+		}
+		if err := p.expectKeyword("TABLE"); err != nil {
+			return nil, err
+		}
+		return p.parseDropTable()
+	case p.acceptKeyword("SET"):
+		return p.parseSet()
+	case p.acceptKeyword("TRUNCATE"):
+		return p.parseTruncate()
+	case p.acceptKeyword("ANALYZE"):
+		return p.parseAnalyze()
+	case p.acceptKeyword("EXPLAIN"):
+		stmt := &ExplainStmt{Analyze: p.acceptKeyword("ANALYZE")}
+		var err error
+		if stmt.Stmt, err = p.parseStmt(); err != nil {
+			return nil, err
+		}
+		return stmt, nil
+	case p.peekKeyword("SELECT"), p.peekKeyword("WITH"), p.peekSubquery():
+		stmt, err := p.parseQuery()
+		if err != nil {
+			return nil, err
+		}
+		return stmt, nil
+	}
+	return nil, errfmt.Wrap(ErrNotSupportedStatement, p.peek().Raw)
+}
+
+// parseCreateTable parses CREATE TABLE statement after "CREATE TABLE".
+//
+//	CREATE TABLE name ( column_def | table_constraint [, ...] )
+func (p *parser) parseCreateTable() (Stmt, error) {
+	name, err := p.expectObjectName()
+	if err != nil {
+		return nil, err
+	}
+	stmt := &CreateTableStmt{Name: name}
+	if err := p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+	for {
+		if p.isTableConstraint() {
+			err = p.parseTableConstraint(stmt)
+		} else {
+			err = p.parseColumnDef(stmt)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+	if err := p.expectSymbol(")"); err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+// isTableConstraint reports whether the next token starts a table constraint.
+func (p *parser) isTableConstraint() bool {
+	t := p.peek()
+	if t.Kind != Keyword {
+		return false
+	}
+	switch t.Value {
+	case "CONSTRAINT", "PRIMARY", "UNIQUE", "FOREIGN":
+		return true
+	}
+	return false
+}
+
+// parseTableConstraint parses a table constraint.
+//
+//	[CONSTRAINT name] PRIMARY KEY (columns)
+//	[CONSTRAINT name] UNIQUE (columns)
+//	[CONSTRAINT name] FOREIGN KEY (columns) references_clause
+func (p *parser) parseTableConstraint(stmt *CreateTableStmt) error {
+	var name string
+	if p.acceptKeyword("CONSTRAINT") {
+		var err error
+		if name, err = p.expectIdent(); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case p.acceptKeyword("PRIMARY"):
+		if err := p.expectKeyword("KEY"); err != nil {
+			return err
+		}
+		columns, err := p.parseIdentList()
+		if err != nil {
+			return err
+		}
+		if len(stmt.PrimaryKey) > 0 {
+			return p.errorf("multiple primary keys for table %q are not allowed", stmt.Name)
+		}
+		stmt.PrimaryKey = columns
+	case p.acceptKeyword("UNIQUE"):
+		columns, err := p.parseIdentList()
+		if err != nil {
+			return err
+		}
+		stmt.Uniques = append(stmt.Uniques, columns)
+	case p.acceptKeyword("FOREIGN"):
+		if err := p.expectKeyword("KEY"); err != nil {
+			return err
+		}
+		columns, err := p.parseIdentList()
+		if err != nil {
+			return err
+		}
+		if err := p.expectKeyword("REFERENCES"); err != nil {
+			return err
+		}
+		fk, err := p.parseReferences()
+		if err != nil {
+			return err
+		}
+		fk.Name = name
+		fk.Columns = columns
+		stmt.ForeignKeys = append(stmt.ForeignKeys, fk)
+	default:
+		return p.errorf("unexpected %q in table constraint", p.peek().Raw)
+	}
+	return nil
+}
+
+// parseColumnDef parses a column definition.
+//
+//	name type [PRIMARY KEY] [AUTOINCREMENT] [UNIQUE] [DEFAULT value]
+//	  [GENERATED {ALWAYS | BY DEFAULT} AS IDENTITY] [references_clause]
+func (p *parser) parseColumnDef(stmt *CreateTableStmt) error {
+	name, err := p.expectIdent()
+	if err != nil {
+		return err
+	}
+	typ, err := p.parseDataType()
+	if err != nil {
+		return err
+	}
+	col := ColumnDef{Name: name, Type: typ}
+
+	for {
+		switch {
+		case p.acceptKeyword("PRIMARY"):
+			if err := p.expectKeyword("KEY"); err != nil {
+				return err
+			}
+			if len(stmt.PrimaryKey) > 0 {
+				return p.errorf("multiple primary keys for table %q are not allowed", stmt.Name)
+			}
+			stmt.PrimaryKey = []string{name}
+		case p.acceptKeyword("AUTOINCREMENT"), p.acceptKeyword("AUTO_INCREMENT"):
+			col.Identity = true
+		case p.acceptKeyword("GENERATED"):
+			if p.acceptKeyword("ALWAYS") {
+				col.Always = true
+			} else if err := p.expectKeywords("BY", "DEFAULT"); err != nil {
+				return err
+			}
+			if err := p.expectKeywords("AS", "IDENTITY"); err != nil {
+				return err
+			}
+			col.Identity = true
+		case p.acceptKeyword("UNIQUE"):
+			stmt.Uniques = append(stmt.Uniques, []string{name})
+		case p.acceptKeyword("DEFAULT"):
+			if col.Default, err = p.parsePrimary(); err != nil {
+				return err
+			}
+		case p.acceptKeyword("REFERENCES"):
+			fk, err := p.parseReferences()
+			if err != nil {
+				return err
+			}
+			fk.Columns = []string{name}
+			stmt.ForeignKeys = append(stmt.ForeignKeys, fk)
+		default:
+			stmt.Columns = append(stmt.Columns, col)
+			return nil
+		}
+	}
+}
+
+// parseDataType parses the column data type.
+// INT, INTEGER and BIGINT are Int, and VARCHAR[(n)] and TEXT are Varchar.
+func (p *parser) parseDataType() (meta.DataType, error) {
+	switch {
+	case p.acceptKeyword("INT"), p.acceptKeyword("INTEGER"), p.acceptKeyword("BIGINT"):
+		return meta.Int, nil
+	case p.acceptKeyword("TEXT"):
+		return meta.Varchar, nil
+	case p.acceptKeyword("VARCHAR"):
+		if p.acceptSymbol("(") {
+			if _, err := p.expectNumber(); err != nil {
+				return 0, err
+			}
+			if err := p.expectSymbol(")"); err != nil {
+				return 0, err
+			}
+		}
+		return meta.Varchar, nil
+	}
+	return 0, p.errorf("unknown data type %q", p.peek().Raw)
+}
+
+// parseReferences parses the references clause after "REFERENCES".
+//
+//	table [(columns)] [ON DELETE action] [ON UPDATE action]
+//	  [[NOT] DEFERRABLE] [INITIALLY {DEFERRED | IMMEDIATE}]
+func (p *parser) parseReferences() (ForeignKeyDef, error) {
+	var fk ForeignKeyDef
+	var err error
+	if fk.RefTable, err = p.expectObjectName(); err != nil {
+		return fk, err
+	}
+	if p.peekSymbol("(") {
+		if fk.RefColumns, err = p.parseIdentList(); err != nil {
+			return fk, err
+		}
+	}
+
+	for {
+		switch {
+		case p.acceptKeyword("ON"):
+			switch {
+			case p.acceptKeyword("DELETE"):
+				fk.OnDelete, err = p.parseAction()
+			case p.acceptKeyword("UPDATE"):
+				fk.OnUpdate, err = p.parseAction()
+			default:
+				err = p.errorf("expected DELETE or UPDATE after ON")
+			}
+			if err != nil {
+				return fk, err
+			}
+		case p.acceptKeyword("NOT"):
+			if err := p.expectKeyword("DEFERRABLE"); err != nil {
+				return fk, err
+			}
+		case p.acceptKeyword("DEFERRABLE"):
+		case p.acceptKeyword("INITIALLY"):
+			switch {
+			case p.acceptKeyword("DEFERRED"):
+				fk.Deferred = true
+			case p.acceptKeyword("IMMEDIATE"):
+				fk.Deferred = false
+			default:
+				return fk, p.errorf("expected DEFERRED or IMMEDIATE after INITIALLY")
+			}
+		default:
+			return fk, nil
+		}
+	}
+}
+
+// parseAction parses the referential action.
+func (p *parser) parseAction() (meta.ReferentialAction, error) {
+	switch {
+	case p.acceptKeyword("RESTRICT"):
+		return meta.Restrict, nil
+	case p.acceptKeyword("CASCADE"):
+		return meta.Cascade, nil
+	case p.acceptKeyword("NO"):
+		return meta.NoAction, p.expectKeyword("ACTION")
+	case p.acceptKeyword("SET"):
+		switch {
+		case p.acceptKeyword("NULL"):
+			return meta.SetNull, nil
+		case p.acceptKeyword("DEFAULT"):
+			return meta.SetDefault, nil
+		}
+	}
+	return 0, p.errorf("unknown referential action %q", p.peek().Raw)
+}
+
+// parseAlterTable parses ALTER TABLE statement after "ALTER TABLE".
+//
+//	ALTER TABLE name ADD [COLUMN] name type [DEFAULT value]
+//	ALTER TABLE name DROP [COLUMN] name
+//	ALTER TABLE name RENAME [COLUMN] name TO new_name
+//	ALTER TABLE name RENAME TO new_name
+//	ALTER TABLE name ALTER [COLUMN] name {SET DEFAULT value | DROP DEFAULT}
+func (p *parser) parseAlterTable() (Stmt, error) {
+	table, err := p.expectObjectName()
+	if err != nil {
+		return nil, err
+	}
+	stmt := &AlterTableStmt{Table: table}
+
+	switch {
+	case p.acceptKeyword("ADD"):
+		p.acceptKeyword("COLUMN")
+		def := &CreateTableStmt{Name: table}
+		if err := p.parseColumnDef(def); err != nil {
+			return nil, err
+		}
+		col := def.Columns[0]
+		if len(def.PrimaryKey) > 0 || len(def.Uniques) > 0 || len(def.ForeignKeys) > 0 || col.Identity {
+			return nil, p.errorf("only DEFAULT is supported in ADD COLUMN")
+		}
+		stmt.Action = &AddColumn{Column: col}
+	case p.acceptKeyword("DROP"):
+		p.acceptKeyword("COLUMN")
+		name, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Action = &DropColumn{Column: name}
+	case p.acceptKeyword("RENAME"):
+		if p.acceptKeyword("TO") {
+			name, err := p.expectIdent()
+			if err != nil {
+				return nil, err
+			}
+			stmt.Action = &RenameTable{NewName: name}
+			break
+		}
+		p.acceptKeyword("COLUMN")
+		name, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectKeyword("TO"); err != nil {
+			return nil, err
+		}
+		newName, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Action = &RenameColumn{Column: name, NewName: newName}
+	case p.acceptKeyword("ALTER"):
+		p.acceptKeyword("COLUMN")
+		name, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		action := &AlterColumnDefault{Column: name}
+		if p.acceptKeyword("DROP") {
+			if err := p.expectKeyword("DEFAULT"); err != nil {
+				return nil, err
+			}
+		} else {
+			if err := p.expectKeywords("SET", "DEFAULT"); err != nil {
+				return nil, err
+			}
+			if action.Default, err = p.parsePrimary(); err != nil {
+				return nil, err
+			}
+		}
+		stmt.Action = action
+	default:
+		return nil, p.errorf("unexpected %q in ALTER TABLE", p.peek().Raw)
+	}
+	return stmt, nil
+}
+
+// parseDropTable parses DROP TABLE statement after "DROP TABLE".
+//
+//	DROP TABLE [IF EXISTS] name
+func (p *parser) parseDropTable() (Stmt, error) {
+	stmt := &DropTableStmt{}
+	if p.acceptKeyword("IF") {
+		if err := p.expectKeyword("EXISTS"); err != nil {
+			return nil, err
+		}
+		stmt.IfExists = true
+	}
+	name, err := p.expectObjectName()
+	if err != nil {
+		return nil, err
+	}
+	stmt.Name = name
+	return stmt, nil
+}
+
+// parseDropSchema parses DROP SCHEMA statement after "DROP SCHEMA".
+//
+//	DROP SCHEMA [IF EXISTS] name [CASCADE | RESTRICT]
+func (p *parser) parseDropSchema() (Stmt, error) {
+	stmt := &DropSchemaStmt{}
+	if p.acceptKeyword("IF") {
+		if err := p.expectKeyword("EXISTS"); err != nil {
+			return nil, err
+		}
+		stmt.IfExists = true
+	}
+	name, err := p.expectIdent()
+	if err != nil {
+		return nil, err
+	}
+	stmt.Name = name
+	if p.acceptKeyword("CASCADE") {
+		stmt.Cascade = true
+	} else {
+		p.acceptKeyword("RESTRICT")
+	}
+	return stmt, nil
+}
+
+// parseSet parses SET statement after "SET".
+//
+//	SET name {TO | =} value [, ...]
+func (p *parser) parseSet() (Stmt, error) {
+	name, err := p.expectIdent()
+	if err != nil {
+		return nil, err
+	}
+	if !p.acceptKeyword("TO") {
+		if err := p.expectSymbol("="); err != nil {
+			return nil, err
+		}
+	}
+	stmt := &SetStmt{Name: strings.ToLower(name)}
+	for {
+		t := p.peek()
+		switch {
+		case t.Kind == String, t.Kind == Number:
+			p.next()
+			stmt.Values = append(stmt.Values, t.Value)
+		case t.Kind == Keyword:
+			// The value like ON or DEFAULT is a keyword.
+			p.next()
+			stmt.Values = append(stmt.Values, strings.ToLower(t.Value))
+		default:
+			v, err := p.expectIdent()
+			if err != nil {
+				return nil, err
+			}
+			stmt.Values = append(stmt.Values, v)
+		}
+		if !p.acceptSymbol(",") {
+			return stmt, nil
+		}
+	}
+}
+
+// parseTruncate parses TRUNCATE statement after "TRUNCATE".
+//
+//	TRUNCATE [TABLE] name [, ...]
+func (p *parser) parseTruncate() (Stmt, error) {
+	p.acceptKeyword("TABLE")
+	stmt := &TruncateStmt{}
+	for {
+		name, err := p.expectObjectName()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Tables = append(stmt.Tables, name)
+		if !p.acceptSymbol(",") {
+			return stmt, nil
+		}
+	}
+}
+
+// parseAnalyze parses ANALYZE statement after "ANALYZE".
+//
+//	ANALYZE [name]
+func (p *parser) parseAnalyze() (Stmt, error) {
+	stmt := &AnalyzeStmt{}
+	if p.peek().Kind == EOF || p.peekSymbol(";") {
+		return stmt, nil
+	}
+	name, err := p.expectObjectName()
+	if err != nil {
+		return nil, err
+	}
+	stmt.Table = &name
+	return stmt, nil
+}
+
+// parseCreateSequence parses CREATE SEQUENCE statement after "CREATE SEQUENCE".
+//
+//	CREATE SEQUENCE name [START [WITH] n] [INCREMENT [BY] n]
+func (p *parser) parseCreateSequence() (Stmt, error) {
+	name, err := p.expectObjectName()
+	if err != nil {
+		return nil, err
+	}
+	stmt := &CreateSequenceStmt{Name: name, Start: 1, Increment: 1}
+	for {
+		switch {
+		case p.acceptKeyword("START"):
+			p.acceptKeyword("WITH")
+			if stmt.Start, err = p.expectSignedNumber(); err != nil {
+				return nil, err
+			}
+		case p.acceptKeyword("INCREMENT"):
+			p.acceptKeyword("BY")
+			if stmt.Increment, err = p.expectSignedNumber(); err != nil {
+				return nil, err
+			}
+		default:
+			return stmt, nil
+		}
+	}
+}
+
+// parseInsert parses INSERT statement after "INSERT".
+//
+//	INSERT INTO table [(columns)] {VALUES (exprs) [, ...] | query}
+//	  [ON CONFLICT [(columns)] {DO NOTHING | DO UPDATE SET column = expr [, ...] [WHERE cond]}]
+func (p *parser) parseInsert() (Stmt, error) {
+	if err := p.expectKeyword("INTO"); err != nil {
+		return nil, err
+	}
+	table, err := p.expectObjectName()
+	if err != nil {
+		return nil, err
+	}
+	stmt := &InsertStmt{Table: table}
+	if p.peekSymbol("(") && !p.peekSubquery() {
+		if stmt.Columns, err = p.parseIdentList(); err != nil {
+			return nil, err
+		}
+	}
+	if p.peekKeyword("SELECT") || p.peekKeyword("WITH") || p.peekSubquery() {
+		if stmt.Select, err = p.parseQuery(); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := p.expectKeyword("VALUES"); err != nil {
+			return nil, err
+		}
+		for {
+			row, err := p.parseExprList()
+			if err != nil {
+				return nil, err
+			}
+			stmt.Rows = append(stmt.Rows, row)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+	if p.acceptKeyword("ON") {
+		if err := p.expectKeyword("CONFLICT"); err != nil {
+			return nil, err
+		}
+		if stmt.OnConflict, err = p.parseOnConflict(); err != nil {
+			return nil, err
+		}
+	}
+	return stmt, nil
+}
+
+// parseOnConflict parses ON CONFLICT clause after "ON CONFLICT".
+func (p *parser) parseOnConflict() (*OnConflict, error) {
+	c := &OnConflict{}
+	var err error
+	if p.peekSymbol("(") {
+		if c.Columns, err = p.parseIdentList(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expectKeyword("DO"); err != nil {
+		return nil, err
+	}
+	if p.acceptKeyword("NOTHING") {
+		c.DoNothing = true
+		return c, nil
+	}
+	if err := p.expectKeyword("UPDATE"); err != nil {
+		return nil, err
+	}
+	if c.Set, err = p.parseAssignments(); err != nil {
+		return nil, err
+	}
+	if p.acceptKeyword("WHERE") {
+		if c.Where, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// parseAssignments parses SET clause.
+//
+//	SET column = expr [, ...]
+func (p *parser) parseAssignments() ([]Assignment, error) {
+	if err := p.expectKeyword("SET"); err != nil {
+		return nil, err
+	}
+	var set []Assignment
+	for {
+		column, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectSymbol("="); err != nil {
+			return nil, err
+		}
+		value, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		set = append(set, Assignment{Column: column, Value: value})
+		if !p.acceptSymbol(",") {
+			return set, nil
+		}
+	}
+}
+
+// parseUpdate parses UPDATE statement after "UPDATE".
+//
+//	UPDATE table [ [AS] alias ] SET column = expr [, ...] [WHERE condition]
+func (p *parser) parseUpdate() (Stmt, error) {
+	table, err := p.expectObjectName()
+	if err != nil {
+		return nil, err
+	}
+	stmt := &UpdateStmt{Table: table}
+	if stmt.Alias, err = p.parseTableAlias(); err != nil {
+		return nil, err
+	}
+	if stmt.Set, err = p.parseAssignments(); err != nil {
+		return nil, err
+	}
+	if p.acceptKeyword("WHERE") {
+		if stmt.Where, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	return stmt, nil
+}
+
+// parseDelete parses DELETE statement after "DELETE".
+//
+//	DELETE FROM table [ [AS] alias ] [WHERE condition]
+func (p *parser) parseDelete() (Stmt, error) {
+	if err := p.expectKeyword("FROM"); err != nil {
+		return nil, err
+	}
+	table, err := p.expectObjectName()
+	if err != nil {
+		return nil, err
+	}
+	stmt := &DeleteStmt{Table: table}
+	if stmt.Alias, err = p.parseTableAlias(); err != nil {
+		return nil, err
+	}
+	if p.acceptKeyword("WHERE") {
+		if stmt.Where, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	return stmt, nil
+}
+
+// parseTableAlias parses the optional alias "[AS] alias" of the table.
+// It returns the empty string if the alias is not specified.
+func (p *parser) parseTableAlias() (string, error) {
+	if p.acceptKeyword("AS") || p.peek().Kind == Ident {
+		return p.expectIdent()
+	}
+	return "", nil
+}
+
+// parseQuery parses the query: SELECT statement with the optional WITH
+// clause, or the set operations of the queries. INTERSECT binds more
+// tightly than UNION and EXCEPT. ORDER BY, LIMIT and OFFSET clauses apply
+// to the result of the set operations.
+//
+//	[WITH [RECURSIVE] name [(column [, ...])] AS ( query ) [, ...]]
+//	  set_expr [ORDER BY expr [ASC | DESC] [NULLS {FIRST | LAST}] [, ...]]
+//	  [LIMIT {count | ALL}] [OFFSET start]
+//	set_expr: term { {UNION | EXCEPT} [ALL | DISTINCT] term }
+//	term: operand { INTERSECT [ALL | DISTINCT] operand }
+//	operand: SELECT ... | ( query )
+func (p *parser) parseQuery() (*SelectStmt, error) {
+	var with []CommonTableExpr
+	recursive := false
+	if p.acceptKeyword("WITH") {
+		recursive = p.acceptKeyword("RECURSIVE")
+		for {
+			cte, err := p.parseCommonTableExpr()
+			if err != nil {
+				return nil, err
+			}
+			with = append(with, cte)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+	stmt, err := p.parseSetExpr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.parseOrderByLimit(stmt); err != nil {
+		return nil, err
+	}
+	if len(with) > 0 {
+		if len(stmt.With) > 0 {
+			return nil, p.errorf("WITH clause is specified more than once")
+		}
+		stmt.With, stmt.Recursive = with, recursive
+	}
+	return stmt, nil
+}
+
+// parseSetExpr parses the queries combined by UNION and EXCEPT.
+func (p *parser) parseSetExpr() (*SelectStmt, error) {
+	left, err := p.parseSetTerm()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var op SetOpType
+		switch {
+		case p.acceptKeyword("UNION"):
+			op = Union
+		case p.acceptKeyword("EXCEPT"):
+			op = Except
+		default:
+			return left, nil
+		}
+		set := &SetOperation{Op: op, All: p.acceptAll(), Left: left}
+		if set.Right, err = p.parseSetTerm(); err != nil {
+			return nil, err
+		}
+		left = &SelectStmt{SetOp: set}
+	}
+}
+
+// parseSetTerm parses the queries combined by INTERSECT.
+func (p *parser) parseSetTerm() (*SelectStmt, error) {
+	left, err := p.parseQueryOperand()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("INTERSECT") {
+		set := &SetOperation{Op: Intersect, All: p.acceptAll(), Left: left}
+		if set.Right, err = p.parseQueryOperand(); err != nil {
+			return nil, err
+		}
+		left = &SelectStmt{SetOp: set}
+	}
+	return left, nil
+}
+
+// acceptAll consumes ALL or DISTINCT after the set operator, and reports
+// whether ALL is specified.
+func (p *parser) acceptAll() bool {
+	if p.acceptKeyword("ALL") {
+		return true
+	}
+	p.acceptKeyword("DISTINCT")
+	return false
+}
+
+// parseOrderByLimit parses ORDER BY, LIMIT and OFFSET clauses of the query.
+// They can not be added to the parenthesized query that already has LIMIT
+// or OFFSET clause, because they would apply in the different order.
+func (p *parser) parseOrderByLimit(stmt *SelectStmt) error {
+	limited := stmt.Limit != nil || stmt.Offset != nil
+	if p.peekKeyword("ORDER") && (limited || len(stmt.OrderBy) > 0) ||
+		(p.peekKeyword("LIMIT") || p.peekKeyword("OFFSET")) && limited {
+		return p.errorf("%s clause is specified more than once", p.peek().Value)
+	}
+	if p.acceptKeyword("ORDER") {
+		if err := p.expectKeyword("BY"); err != nil {
+			return err
+		}
+		for {
+			item, err := p.parseOrderItem()
+			if err != nil {
+				return err
+			}
+			stmt.OrderBy = append(stmt.OrderBy, item)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+	if p.acceptKeyword("LIMIT") && !p.acceptKeyword("ALL") {
+		limit, err := p.parseExpr()
+		if err != nil {
+			return err
+		}
+		stmt.Limit = limit
+	}
+	if p.acceptKeyword("OFFSET") {
+		offset, err := p.parseExpr()
+		if err != nil {
+			return err
+		}
+		stmt.Offset = offset
+	}
+	return nil
+}
+
+// parseOrderItem parses a sort key of ORDER BY clause.
+func (p *parser) parseOrderItem() (OrderItem, error) {
+	e, err := p.parseExpr()
+	if err != nil {
+		return OrderItem{}, err
+	}
+	item := OrderItem{Expr: e}
+	if !p.acceptKeyword("ASC") {
+		item.Desc = p.acceptKeyword("DESC")
+	}
+	item.NullsFirst = item.Desc
+	if p.acceptKeyword("NULLS") {
+		switch {
+		case p.acceptKeyword("FIRST"):
+			item.NullsFirst = true
+		case p.acceptKeyword("LAST"):
+			item.NullsFirst = false
+		default:
+			return OrderItem{}, p.errorf("expected FIRST or LAST but got %q", p.peek().Raw)
+		}
+	}
+	return item, nil
+}
+
+// parseCommonTableExpr parses a common table expression of WITH clause.
+//
+//	name [(column [, ...])] AS ( query )
+func (p *parser) parseCommonTableExpr() (CommonTableExpr, error) {
+	name, err := p.expectIdent()
+	if err != nil {
+		return CommonTableExpr{}, err
+	}
+	cte := CommonTableExpr{Name: name}
+	if p.peekSymbol("(") {
+		if cte.Columns, err = p.parseIdentList(); err != nil {
+			return CommonTableExpr{}, err
+		}
+	}
+	if err := p.expectKeyword("AS"); err != nil {
+		return CommonTableExpr{}, err
+	}
+	if cte.Select, err = p.parseSubquery(); err != nil {
+		return CommonTableExpr{}, err
+	}
+	return cte, nil
+}
+
+// parseQueryOperand parses the operand of the set operation: SELECT statement
+// or the parenthesized query.
+func (p *parser) parseQueryOperand() (*SelectStmt, error) {
+	if p.peekSymbol("(") {
+		return p.parseSubquery()
+	}
+	if err := p.expectKeyword("SELECT"); err != nil {
+		return nil, err
+	}
+	return p.parseSelect()
+}
+
+// parseSelect parses SELECT statement after "SELECT".
+//
+//	SELECT { * | table.* | expr [ [AS] alias ] } [, ...] [FROM from_item [, ...]] [WHERE condition]
+//	  [GROUP BY expr [, ...]] [HAVING condition]
+func (p *parser) parseSelect() (*SelectStmt, error) {
+	stmt := &SelectStmt{}
+	for {
+		item, err := p.parseSelectItem()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Items = append(stmt.Items, item)
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+	if p.acceptKeyword("FROM") {
+		from, err := p.parseFrom()
+		if err != nil {
+			return nil, err
+		}
+		stmt.From = from
+	}
+	if p.acceptKeyword("WHERE") {
+		where, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Where = where
+	}
+	if p.acceptKeyword("GROUP") {
+		if err := p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			e, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			stmt.GroupBy = append(stmt.GroupBy, e)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+	if p.acceptKeyword("HAVING") {
+		having, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Having = having
+	}
+	return stmt, nil
+}
+
+// parseSelectItem parses an item of the select list.
+func (p *parser) parseSelectItem() (SelectItem, error) {
+	if p.acceptSymbol("*") {
+		return SelectItem{Star: true}, nil
+	}
+	if t := p.peek(); t.Kind == Ident && p.peekAt(1).Value == "." && p.peekAt(2).Value == "*" {
+		p.next()
+		p.next()
+		p.next()
+		return SelectItem{Star: true, Table: t.Value}, nil
+	}
+	e, err := p.parseExpr()
+	if err != nil {
+		return SelectItem{}, err
+	}
+	item := SelectItem{Expr: e}
+	if p.acceptKeyword("AS") || p.peek().Kind == Ident {
+		if item.Alias, err = p.expectIdent(); err != nil {
+			return SelectItem{}, err
+		}
+	}
+	return item, nil
+}
+
+// parseFrom parses the items of FROM clause. The comma separated items are
+// the cross join of them.
+//
+//	from_item [, ...]
+func (p *parser) parseFrom() (TableExpr, error) {
+	from, err := p.parseJoin()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptSymbol(",") {
+		right, err := p.parseJoin()
+		if err != nil {
+			return nil, err
+		}
+		from = &JoinExpr{Type: CrossJoin, Left: from, Right: right}
+	}
+	return from, nil
+}
+
+// parseJoin parses a table followed by the joins.
+//
+//	table_primary { CROSS JOIN table_primary
+//	  | [NATURAL] [INNER | {LEFT | RIGHT | FULL} [OUTER]] JOIN table_primary
+//	    [ON condition | USING (column [, ...])] }
+func (p *parser) parseJoin() (TableExpr, error) {
+	left, err := p.parseTablePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		join := &JoinExpr{Left: left}
+		switch {
+		case p.acceptKeyword("CROSS"):
+			join.Type = CrossJoin
+		default:
+			join.Natural = p.acceptKeyword("NATURAL")
+			switch {
+			case p.acceptKeyword("LEFT"):
+				join.Type = LeftJoin
+				p.acceptKeyword("OUTER")
+			case p.acceptKeyword("RIGHT"):
+				join.Type = RightJoin
+				p.acceptKeyword("OUTER")
+			case p.acceptKeyword("FULL"):
+				join.Type = FullJoin
+				p.acceptKeyword("OUTER")
+			default:
+				p.acceptKeyword("INNER")
+			}
+			if !join.Natural && join.Type == InnerJoin && !p.peekKeyword("JOIN") {
+				return left, nil
+			}
+		}
+		if err := p.expectKeyword("JOIN"); err != nil {
+			return nil, err
+		}
+		if join.Right, err = p.parseTablePrimary(); err != nil {
+			return nil, err
+		}
+		if join.Type != CrossJoin && !join.Natural {
+			switch {
+			case p.acceptKeyword("ON"):
+				if join.On, err = p.parseExpr(); err != nil {
+					return nil, err
+				}
+			case p.acceptKeyword("USING"):
+				if join.Using, err = p.parseIdentList(); err != nil {
+					return nil, err
+				}
+			default:
+				return nil, p.errorf("ON or USING is required for JOIN")
+			}
+		}
+		left = join
+	}
+}
+
+// parseTablePrimary parses a table with the optional alias, the subquery
+// with the alias, or the parenthesized joins.
+//
+//	name [ [AS] alias ] | ( SELECT ... ) [AS] alias | ( from_item )
+func (p *parser) parseTablePrimary() (TableExpr, error) {
+	if p.peekSubquery() {
+		sel, err := p.parseSubquery()
+		if err != nil {
+			return nil, err
+		}
+		p.acceptKeyword("AS")
+		if p.peek().Kind != Ident {
+			return nil, p.errorf("subquery in FROM must have an alias")
+		}
+		alias, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		return &DerivedTable{Select: sel, Alias: alias}, nil
+	}
+	if p.acceptSymbol("(") {
+		from, err := p.parseJoin()
+		if err != nil {
+			return nil, err
+		}
+		return from, p.expectSymbol(")")
+	}
+	name, err := p.expectObjectName()
+	if err != nil {
+		return nil, err
+	}
+	ref := &TableRef{Name: name}
+	if ref.Alias, err = p.parseTableAlias(); err != nil {
+		return nil, err
+	}
+	return ref, nil
+}
+
+// peekSubquery reports whether the parenthesized query follows.
+func (p *parser) peekSubquery() bool {
+	t := p.peekAt(1)
+	return p.peekSymbol("(") && t.Kind == Keyword && (t.Value == "SELECT" || t.Value == "WITH")
+}
+
+// parseSubquery parses the parenthesized query "(SELECT ...)".
+func (p *parser) parseSubquery() (*SelectStmt, error) {
+	if err := p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+	stmt, err := p.parseQuery()
+	if err != nil {
+		return nil, err
+	}
+	return stmt, p.expectSymbol(")")
+}
+
+// parseExprList parses the parenthesized expressions "(expr [, ...])".
+func (p *parser) parseExprList() ([]Expr, error) {
+	if err := p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+	var exprs []Expr
+	for {
+		e, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, e)
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+	return exprs, p.expectSymbol(")")
+}
+
+// parseExpr parses an expression. The operators are, from the lowest precedence:
+//
+//	OR
+//	AND
+//	NOT
+//	= <> != < <= > >=, IS [NOT] NULL, [NOT] LIKE, [NOT] ILIKE, [NOT] IN, [NOT] BETWEEN
+//	||
+//	+ -
+//	* / %
+//	unary -
+func (p *parser) parseExpr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Op: "OR", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+// parseAnd parses the expression of AND operators.
+func (p *parser) parseAnd() (Expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("AND") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Op: "AND", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+// parseNot parses the expression of NOT operator.
+func (p *parser) parseNot() (Expr, error) {
+	if p.acceptKeyword("NOT") {
+		e, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &UnaryExpr{Op: "NOT", Expr: e}, nil
+	}
+	return p.parseComparison()
+}
+
+// comparisonOps is the comparison operators.
+var comparisonOps = []string{"=", "<>", "!=", "<", "<=", ">", ">="}
+
+// parseComparison parses the comparison and the predicates
+// (IS NULL, LIKE, ILIKE, IN and BETWEEN).
+func (p *parser) parseComparison() (Expr, error) {
+	left, err := p.parseConcat()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if op, ok := p.acceptComparisonOp(); ok {
+			right, err := p.parseConcat()
+			if err != nil {
+				return nil, err
+			}
+			left = &BinaryExpr{Op: op, Left: left, Right: right}
+			continue
+		}
+		if p.acceptKeyword("IS") {
+			not := p.acceptKeyword("NOT")
+			if err := p.expectKeyword("NULL"); err != nil {
+				return nil, err
+			}
+			left = &IsNullExpr{Expr: left, Not: not}
+			continue
+		}
+
+		not := p.acceptNotBeforePredicate()
+		switch {
+		case p.acceptKeyword("LIKE"):
+			left, err = p.parseLike(left, not, false)
+		case p.acceptKeyword("ILIKE"):
+			left, err = p.parseLike(left, not, true)
+		case p.acceptKeyword("IN"):
+			in := &InExpr{Expr: left, Not: not}
+			if p.peekSubquery() {
+				in.Select, err = p.parseSubquery()
+			} else {
+				in.List, err = p.parseExprList()
+			}
+			left = in
+		case p.acceptKeyword("BETWEEN"):
+			left, err = p.parseBetween(left, not)
+		default:
+			return left, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// acceptComparisonOp consumes the current token if it is a comparison operator
+// and returns it. "!=" is returned as "<>".
+func (p *parser) acceptComparisonOp() (string, bool) {
+	for _, op := range comparisonOps {
+		if p.acceptSymbol(op) {
+			if op == "!=" {
+				op = "<>"
+			}
+			return op, true
+		}
+	}
+	return "", false
+}
+
+// acceptNotBeforePredicate consumes NOT if LIKE, ILIKE, IN or BETWEEN follows it.
+func (p *parser) acceptNotBeforePredicate() bool {
+	if !p.peekKeyword("NOT") {
+		return false
+	}
+	switch t := p.peekAt(1); {
+	case t.Kind != Keyword:
+		return false
+	case t.Value == "LIKE", t.Value == "ILIKE", t.Value == "IN", t.Value == "BETWEEN":
+		p.next()
+		return true
+	}
+	return false
+}
+
+// parseBetween parses the range after BETWEEN.
+func (p *parser) parseBetween(e Expr, not bool) (Expr, error) {
+	low, err := p.parseConcat()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("AND"); err != nil {
+		return nil, err
+	}
+	high, err := p.parseConcat()
+	if err != nil {
+		return nil, err
+	}
+	return &BetweenExpr{Expr: e, Low: low, High: high, Not: not}, nil
+}
+
+// parseLike parses the pattern and the escape character after LIKE or ILIKE.
+func (p *parser) parseLike(e Expr, not, caseInsensitive bool) (Expr, error) {
+	pattern, err := p.parseConcat()
+	if err != nil {
+		return nil, err
+	}
+	like := &LikeExpr{Expr: e, Pattern: pattern, Not: not, CaseInsensitive: caseInsensitive}
+	if p.acceptKeyword("ESCAPE") {
+		if like.Escape, err = p.parseConcat(); err != nil {
+			return nil, err
+		}
+	}
+	return like, nil
+}
+
+// parseConcat parses the expression of the concatenation operator "||".
+func (p *parser) parseConcat() (Expr, error) {
+	return p.parseBinary([]string{"||"}, p.parseAdditive)
+}
+
+// parseAdditive parses the expression of "+" and "-" operators.
+func (p *parser) parseAdditive() (Expr, error) {
+	return p.parseBinary([]string{"+", "-"}, p.parseMultiplicative)
+}
+
+// parseMultiplicative parses the expression of "*", "/" and "%" operators.
+func (p *parser) parseMultiplicative() (Expr, error) {
+	return p.parseBinary([]string{"*", "/", "%"}, p.parseUnary)
+}
+
+// parseBinary parses the left-associative binary operators ops whose operands
+// are parsed by operand.
+func (p *parser) parseBinary(ops []string, operand func() (Expr, error)) (Expr, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var op string
+		for _, o := range ops {
+			if p.acceptSymbol(o) {
+				op = o
+				break
+			}
+		}
+		if op == "" {
+			return left, nil
+		}
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Op: op, Left: left, Right: right}
+	}
+}
+
+// parseUnary parses the expression of unary "-" operator.
+// The negative number literal is parsed by parsePrimary.
+func (p *parser) parseUnary() (Expr, error) {
+	if p.peekSymbol("-") && p.peekAt(1).Kind != Number {
+		p.next()
+		e, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &UnaryExpr{Op: "-", Expr: e}, nil
+	}
+	return p.parsePrimary()
+}
+
+// parsePrimary parses a literal, NULL, TRUE, FALSE, a placeholder, a function call,
+// a column reference, CASE, CAST, EXISTS, the subquery or the parenthesized expression.
+func (p *parser) parsePrimary() (Expr, error) {
+	t := p.peek()
+	switch {
+	case t.Kind == Number, t.Kind == Symbol && t.Value == "-":
+		v, err := p.expectSignedNumber()
+		if err != nil {
+			return nil, err
+		}
+		return &Literal{Value: v}, nil
+	case t.Kind == String:
+		p.next()
+		return &Literal{Value: t.Value}, nil
+	case t.Kind == Placeholder:
+		p.next()
+		p.params++
+		return &Param{Index: p.params - 1}, nil
+	case p.acceptKeyword("NULL"):
+		return &Literal{Value: nil}, nil
+	case p.acceptKeyword("TRUE"):
+		return &Literal{Value: true}, nil
+	case p.acceptKeyword("FALSE"):
+		return &Literal{Value: false}, nil
+	case p.acceptKeyword("CASE"):
+		return p.parseCase()
+	case p.acceptKeyword("CAST"):
+		return p.parseCast()
+	case p.acceptKeyword("EXISTS"):
+		sel, err := p.parseSubquery()
+		if err != nil {
+			return nil, err
+		}
+		return &ExistsExpr{Select: sel}, nil
+	case p.peekSubquery():
+		sel, err := p.parseSubquery()
+		if err != nil {
+			return nil, err
+		}
+		return &SubqueryExpr{Select: sel}, nil
+	case p.acceptSymbol("("):
+		e, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		return e, p.expectSymbol(")")
+	case t.Kind == Ident && p.peekAt(1).Kind == Symbol && p.peekAt(1).Value == "(":
+		p.next()
+		p.next()
+		return p.parseFuncCall(strings.ToLower(t.Value))
+	case t.Kind == Ident, t.Kind == Keyword && nonReserved[t.Value]:
+		name, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		if !p.acceptSymbol(".") {
+			return &ColumnRef{Name: name}, nil
+		}
+		column, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		return &ColumnRef{Table: name, Name: column}, nil
+	}
+	return nil, p.errorf("unexpected %q in expression", t.Raw)
+}
+
+// parseFuncCall parses the function call after "name (".
+//
+//	name ( [* | [DISTINCT] expr [, ...]] ) [OVER ( window )]
+func (p *parser) parseFuncCall(name string) (Expr, error) {
+	call := &FuncCall{Name: name}
+	switch {
+	case p.acceptSymbol(")"):
+	case p.acceptSymbol("*"):
+		call.Star = true
+		if err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+	default:
+		call.Distinct = p.acceptKeyword("DISTINCT")
+		for {
+			arg, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			call.Args = append(call.Args, arg)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+		if err := p.expectSymbol(")"); err != nil {
+			return nil, err
+		}
+	}
+	if p.acceptKeyword("OVER") {
+		var err error
+		if call.Over, err = p.parseWindowSpec(); err != nil {
+			return nil, err
+		}
+	}
+	return call, nil
+}
+
+// parseWindowSpec parses the window of OVER clause.
+//
+//	( [PARTITION BY expr [, ...]] [ORDER BY order_item [, ...]] [frame] )
+func (p *parser) parseWindowSpec() (*WindowSpec, error) {
+	if err := p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+	spec := &WindowSpec{}
+	if p.acceptKeyword("PARTITION") {
+		if err := p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			e, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			spec.PartitionBy = append(spec.PartitionBy, e)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+	if p.acceptKeyword("ORDER") {
+		if err := p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		for {
+			item, err := p.parseOrderItem()
+			if err != nil {
+				return nil, err
+			}
+			spec.OrderBy = append(spec.OrderBy, item)
+			if !p.acceptSymbol(",") {
+				break
+			}
+		}
+	}
+	if p.peekKeyword("ROWS") || p.peekKeyword("RANGE") {
+		frame, err := p.parseWindowFrame()
+		if err != nil {
+			return nil, err
+		}
+		spec.Frame = frame
+	}
+	return spec, p.expectSymbol(")")
+}
+
+// parseWindowFrame parses the frame clause of the window. The frame
+// "{ROWS | RANGE} start" is the frame that ends with the current row.
+//
+//	{ROWS | RANGE} {BETWEEN bound AND bound | bound}
+//	bound: UNBOUNDED {PRECEDING | FOLLOWING} | n {PRECEDING | FOLLOWING} | CURRENT ROW
+func (p *parser) parseWindowFrame() (*WindowFrame, error) {
+	frame := &WindowFrame{Range: p.acceptKeyword("RANGE")}
+	if !frame.Range {
+		if err := p.expectKeyword("ROWS"); err != nil {
+			return nil, err
+		}
+	}
+	if !p.acceptKeyword("BETWEEN") {
+		start, err := p.parseFrameBound()
+		if err != nil {
+			return nil, err
+		}
+		frame.Start, frame.End = start, FrameBound{Type: CurrentRow}
+		return frame, nil
+	}
+	var err error
+	if frame.Start, err = p.parseFrameBound(); err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("AND"); err != nil {
+		return nil, err
+	}
+	if frame.End, err = p.parseFrameBound(); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+// parseFrameBound parses the start or the end of the window frame.
+func (p *parser) parseFrameBound() (FrameBound, error) {
+	if p.acceptKeyword("CURRENT") {
+		return FrameBound{Type: CurrentRow}, p.expectKeyword("ROW")
+	}
+	if p.acceptKeyword("UNBOUNDED") {
+		switch {
+		case p.acceptKeyword("PRECEDING"):
+			return FrameBound{Type: UnboundedPreceding}, nil
+		case p.acceptKeyword("FOLLOWING"):
+			return FrameBound{Type: UnboundedFollowing}, nil
+		}
+		return FrameBound{}, p.errorf("expected PRECEDING or FOLLOWING but got %q", p.peek().Raw)
+	}
+	n, err := p.expectNumber()
+	if err != nil {
+		return FrameBound{}, err
+	}
+	switch {
+	case p.acceptKeyword("PRECEDING"):
+		return FrameBound{Type: Preceding, Offset: n}, nil
+	case p.acceptKeyword("FOLLOWING"):
+		return FrameBound{Type: Following, Offset: n}, nil
+	}
+	return FrameBound{}, p.errorf("expected PRECEDING or FOLLOWING but got %q", p.peek().Raw)
+}
+
+// parseCase parses CASE expression after "CASE".
+//
+//	CASE [operand] WHEN expr THEN result [...] [ELSE result] END
+func (p *parser) parseCase() (Expr, error) {
+	c := &CaseExpr{}
+	var err error
+	if !p.peekKeyword("WHEN") {
+		if c.Operand, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	for p.acceptKeyword("WHEN") {
+		var w When
+		if w.Cond, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+		if err := p.expectKeyword("THEN"); err != nil {
+			return nil, err
+		}
+		if w.Result, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+		c.Whens = append(c.Whens, w)
+	}
+	if len(c.Whens) == 0 {
+		return nil, p.errorf("CASE requires at least one WHEN clause")
+	}
+	if p.acceptKeyword("ELSE") {
+		if c.Else, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+	return c, p.expectKeyword("END")
+}
+
+// parseCast parses CAST expression after "CAST".
+//
+//	CAST ( expr AS type )
+func (p *parser) parseCast() (Expr, error) {
+	if err := p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+	e, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expectKeyword("AS"); err != nil {
+		return nil, err
+	}
+	typ, err := p.parseDataType()
+	if err != nil {
+		return nil, err
+	}
+	return &CastExpr{Expr: e, Type: typ}, p.expectSymbol(")")
+}
+
+// parseIdentList parses the parenthesized identifiers "(ident [, ...])".
+func (p *parser) parseIdentList() ([]string, error) {
+	if err := p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+	var idents []string
+	for {
+		ident, err := p.expectIdent()
+		if err != nil {
+			return nil, err
+		}
+		idents = append(idents, ident)
+		if !p.acceptSymbol(",") {
+			break
+		}
+	}
+	return idents, p.expectSymbol(")")
+}
+
+// peek returns the current token without consuming it.
+func (p *parser) peek() Token {
+	return p.peekAt(0)
+}
+
+// peekAt returns the token n tokens after the current token without consuming it.
+func (p *parser) peekAt(n int) Token {
+	if p.pos+n >= len(p.tokens) {
+		return p.tokens[len(p.tokens)-1]
+	}
+	return p.tokens[p.pos+n]
+}
+
+// next consumes the current token and returns it.
+func (p *parser) next() Token {
+	t := p.peek()
+	if p.pos < len(p.tokens)-1 {
+		p.pos++
+	}
+	return t
+}
+
+// peekKeyword reports whether the current token is the keyword.
+func (p *parser) peekKeyword(kw string) bool {
+	t := p.peek()
+	return t.Kind == Keyword && t.Value == kw
+}
+
+// acceptKeyword consumes the current token if it is the keyword.
+func (p *parser) acceptKeyword(kw string) bool {
+	if t := p.peek(); t.Kind == Keyword && t.Value == kw {
+		p.next()
+		return true
+	}
+	return false
+}
+
+// expectKeyword consumes the current token if it is the keyword, otherwise returns an error.
+func (p *parser) expectKeyword(kw string) error {
+	if !p.acceptKeyword(kw) {
+		return p.errorf("expected %s but got %q", kw, p.peek().Raw)
+	}
+	return nil
+}
+
+// expectKeywords consumes the keywords in order.
+func (p *parser) expectKeywords(kws ...string) error {
+	for _, kw := range kws {
+		if err := p.expectKeyword(kw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// peekSymbol reports whether the current token is the symbol.
+func (p *parser) peekSymbol(sym string) bool {
+	t := p.peek()
+	return t.Kind == Symbol && t.Value == sym
+}
+
+// acceptSymbol consumes the current token if it is the symbol.
+func (p *parser) acceptSymbol(sym string) bool {
+	if p.peekSymbol(sym) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+// expectSymbol consumes the current token if it is the symbol, otherwise returns an error.
+func (p *parser) expectSymbol(sym string) error {
+	if !p.acceptSymbol(sym) {
+		return p.errorf("expected %q but got %q", sym, p.peek().Raw)
+	}
+	return nil
+}
+
+// expectIdent consumes the current token if it is an identifier and returns it.
+// The non-reserved keywords are also accepted as identifiers in lower case.
+func (p *parser) expectIdent() (string, error) {
+	t := p.peek()
+	if t.Kind == Ident {
+		p.next()
+		return t.Value, nil
+	}
+	if t.Kind == Keyword && nonReserved[t.Value] {
+		p.next()
+		return strings.ToLower(t.Value), nil
+	}
+	return "", p.errorf("expected identifier but got %q", t.Raw)
+}
+
+// expectObjectName consumes the table or sequence name optionally qualified
+// with the schema name "[schema.]name".
+func (p *parser) expectObjectName() (ObjectName, error) {
+	name, err := p.expectIdent()
+	if err != nil {
+		return ObjectName{}, err
+	}
+	if !p.acceptSymbol(".") {
+		return ObjectName{Name: name}, nil
+	}
+	qualified, err := p.expectIdent()
+	if err != nil {
+		return ObjectName{}, err
+	}
+	return ObjectName{Schema: name, Name: qualified}, nil
+}
+
+// expectNumber consumes the current token if it is an integer literal and returns it.
+func (p *parser) expectNumber() (int64, error) {
+	t := p.peek()
+	if t.Kind != Number {
+		return 0, p.errorf("expected number but got %q", t.Raw)
+	}
+	p.next()
+	v, err := strconv.ParseInt(t.Value, 10, 64)
+	if err != nil {
+		return 0, p.errorf("number %s is out of range", t.Value)
+	}
+	return v, nil
+}
+
+// expectSignedNumber consumes an integer literal with an optional minus sign.
+func (p *parser) expectSignedNumber() (int64, error) {
+	if p.acceptSymbol("-") {
+		t := p.peek()
+		if t.Kind == Number && t.Value == "9223372036854775808" {
+			p.next()
+			return -9223372036854775808, nil
+		}
+		v, err := p.expectNumber()
+		return -v, err
+	}
+	return p.expectNumber()
+}
+
+// errorf returns the syntax error with the position of the current token.
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return errfmt.Wrap(ErrSyntax, fmt.Sprintf("at position %d: ", p.peek().Pos)+fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,611 @@
+package query
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nao1215/egsql/dbms/meta"
+)
+
+// and returns the left-associative AND of the expressions.
+func and(exprs ...Expr) Expr {
+	e := exprs[0]
+	for _, r := range exprs[1:] {
+		e = &BinaryExpr{Op: "AND", Left: e, Right: r}
+	}
+	return e
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name         string
+		sql          string
+		want         Stmt
+		wantNumInput int
+		wantErr      error
+	}{
+		{
+			name: "[Success] create table with constraints",
+			sql: `CREATE TABLE users (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				name VARCHAR(32) UNIQUE DEFAULT 'anonymous',
+				group_id INT REFERENCES groups ON DELETE CASCADE
+			);`,
+			want: &CreateTableStmt{
+				Name: ObjectName{Name: "users"},
+				Columns: []ColumnDef{
+					{Name: "id", Type: meta.Int, Identity: true},
+					{Name: "name", Type: meta.Varchar, Default: &Literal{Value: "anonymous"}},
+					{Name: "group_id", Type: meta.Int},
+				},
+				PrimaryKey:  []string{"id"},
+				Uniques:     [][]string{{"name"}},
+				ForeignKeys: []ForeignKeyDef{{Columns: []string{"group_id"}, RefTable: ObjectName{Name: "groups"}, OnDelete: meta.Cascade}},
+			},
+		},
+		{
+			name: "[Success] create table with table constraints",
+			sql:  "CREATE TABLE t (a INT, b TEXT, CONSTRAINT t_pk PRIMARY KEY (a, b), FOREIGN KEY (a) REFERENCES p (id) DEFERRABLE INITIALLY DEFERRED)",
+			want: &CreateTableStmt{
+				Name:        ObjectName{Name: "t"},
+				Columns:     []ColumnDef{{Name: "a", Type: meta.Int}, {Name: "b", Type: meta.Varchar}},
+				PrimaryKey:  []string{"a", "b"},
+				ForeignKeys: []ForeignKeyDef{{Columns: []string{"a"}, RefTable: ObjectName{Name: "p"}, RefColumns: []string{"id"}, Deferred: true}},
+			},
+		},
+		{
+			name: "[Success] create table with unique table constraints",
+			sql:  "CREATE TABLE t (tenant_id INT, id INT, a TEXT, b TEXT, PRIMARY KEY (tenant_id, id), UNIQUE (a, b), CONSTRAINT t_b_key UNIQUE (b))",
+			want: &CreateTableStmt{
+				Name: ObjectName{Name: "t"},
+				Columns: []ColumnDef{
+					{Name: "tenant_id", Type: meta.Int}, {Name: "id", Type: meta.Int},
+					{Name: "a", Type: meta.Varchar}, {Name: "b", Type: meta.Varchar},
+				},
+				PrimaryKey: []string{"tenant_id", "id"},
+				Uniques:    [][]string{{"a", "b"}, {"b"}},
+			},
+		},
+		{
+			name:    "[Error] multiple primary keys",
+			sql:     "CREATE TABLE t (a INT PRIMARY KEY, b INT, PRIMARY KEY (a, b))",
+			wantErr: ErrSyntax,
+		},
+		{
+			name: "[Success] create table with referential actions",
+			sql: `CREATE TABLE t (
+				a INT REFERENCES p ON DELETE SET NULL ON UPDATE RESTRICT,
+				b INT,
+				CONSTRAINT t_b_fkey FOREIGN KEY (b) REFERENCES q (x) ON DELETE SET DEFAULT ON UPDATE NO ACTION NOT DEFERRABLE
+			)`,
+			want: &CreateTableStmt{
+				Name:    ObjectName{Name: "t"},
+				Columns: []ColumnDef{{Name: "a", Type: meta.Int}, {Name: "b", Type: meta.Int}},
+				ForeignKeys: []ForeignKeyDef{
+					{Columns: []string{"a"}, RefTable: ObjectName{Name: "p"}, OnDelete: meta.SetNull, OnUpdate: meta.Restrict},
+					{Name: "t_b_fkey", Columns: []string{"b"}, RefTable: ObjectName{Name: "q"}, RefColumns: []string{"x"}, OnDelete: meta.SetDefault, OnUpdate: meta.NoAction},
+				},
+			},
+		},
+		{
+			name:    "[Error] unknown referential action",
+			sql:     "CREATE TABLE t (a INT REFERENCES p ON DELETE IGNORE)",
+			wantErr: ErrSyntax,
+		},
+		{
+			name: "[Success] create sequence",
+			sql:  "create sequence seq start with -5 increment by 2",
+			want: &CreateSequenceStmt{Name: ObjectName{Name: "seq"}, Start: -5, Increment: 2},
+		},
+		{
+			name: "[Success] insert with placeholders",
+			sql:  "INSERT INTO users (name) VALUES (?), ('it''s'), (nextval('seq'))",
+			want: &InsertStmt{
+				Table:   ObjectName{Name: "users"},
+				Columns: []string{"name"},
+				Rows: [][]Expr{
+					{&Param{Index: 0}},
+					{&Literal{Value: "it's"}},
+					{&FuncCall{Name: "nextval", Args: []Expr{&Literal{Value: "seq"}}}},
+				},
+			},
+			wantNumInput: 1,
+		},
+		{
+			name: "[Success] alter table add column",
+			sql:  "ALTER TABLE users ADD age INT DEFAULT 20",
+			want: &AlterTableStmt{Table: ObjectName{Name: "users"}, Action: &AddColumn{
+				Column: ColumnDef{Name: "age", Type: meta.Int, Default: &Literal{Value: int64(20)}},
+			}},
+		},
+		{
+			name: "[Success] alter table rename column",
+			sql:  "ALTER TABLE users RENAME COLUMN name TO full_name",
+			want: &AlterTableStmt{Table: ObjectName{Name: "users"}, Action: &RenameColumn{Column: "name", NewName: "full_name"}},
+		},
+		{
+			name: "[Success] alter table rename to",
+			sql:  "ALTER TABLE users RENAME TO members",
+			want: &AlterTableStmt{Table: ObjectName{Name: "users"}, Action: &RenameTable{NewName: "members"}},
+		},
+		{
+			name: "[Success] alter table drop default",
+			sql:  "ALTER TABLE users ALTER COLUMN age DROP DEFAULT",
+			want: &AlterTableStmt{Table: ObjectName{Name: "users"}, Action: &AlterColumnDefault{Column: "age"}},
+		},
+		{
+			name:    "[Error] alter table add column with primary key",
+			sql:     "ALTER TABLE users ADD COLUMN id2 INT PRIMARY KEY",
+			wantErr: ErrSyntax,
+		},
+		{
+			name: "[Success] drop table if exists",
+			sql:  "DROP TABLE IF EXISTS users",
+			want: &DropTableStmt{Name: ObjectName{Name: "users"}, IfExists: true},
+		},
+		{
+			name: "[Success] truncate tables",
+			sql:  "TRUNCATE TABLE users, groups",
+			want: &TruncateStmt{Tables: []ObjectName{{Name: "users"}, {Name: "groups"}}},
+		},
+		{
+			name: "[Success] analyze all tables",
+			sql:  "ANALYZE",
+			want: &AnalyzeStmt{},
+		},
+		{
+			name: "[Success] analyze table",
+			sql:  "ANALYZE sales.users;",
+			want: &AnalyzeStmt{Table: &ObjectName{Schema: "sales", Name: "users"}},
+		},
+		{
+			name: "[Success] explain analyze",
+			sql:  "EXPLAIN ANALYZE SELECT 1",
+			want: &ExplainStmt{
+				Analyze: true,
+				Stmt:    &SelectStmt{Items: []SelectItem{{Expr: &Literal{Value: int64(1)}}}},
+			},
+		},
+		{
+			name: "[Success] qualified table name",
+			sql:  "INSERT INTO sales.users VALUES (1)",
+			want: &InsertStmt{
+				Table: ObjectName{Schema: "sales", Name: "users"},
+				Rows:  [][]Expr{{&Literal{Value: int64(1)}}},
+			},
+		},
+		{
+			name: "[Success] insert select",
+			sql:  "INSERT INTO archive (id, name) SELECT id, name FROM users WHERE id > ?",
+			want: &InsertStmt{
+				Table:   ObjectName{Name: "archive"},
+				Columns: []string{"id", "name"},
+				Select: &SelectStmt{
+					Items: []SelectItem{{Expr: &ColumnRef{Name: "id"}}, {Expr: &ColumnRef{Name: "name"}}},
+					From:  &TableRef{Name: ObjectName{Name: "users"}},
+					Where: &BinaryExpr{Op: ">", Left: &ColumnRef{Name: "id"}, Right: &Param{Index: 0}},
+				},
+			},
+			wantNumInput: 1,
+		},
+		{
+			name: "[Success] insert parenthesized select",
+			sql:  "INSERT INTO archive (SELECT 1)",
+			want: &InsertStmt{
+				Table:  ObjectName{Name: "archive"},
+				Select: &SelectStmt{Items: []SelectItem{{Expr: &Literal{Value: int64(1)}}}},
+			},
+		},
+		{
+			name: "[Success] insert on conflict do nothing",
+			sql:  "INSERT INTO users VALUES (1, 'a') ON CONFLICT DO NOTHING",
+			want: &InsertStmt{
+				Table:      ObjectName{Name: "users"},
+				Rows:       [][]Expr{{&Literal{Value: int64(1)}, &Literal{Value: "a"}}},
+				OnConflict: &OnConflict{DoNothing: true},
+			},
+		},
+		{
+			name: "[Success] insert on conflict do update",
+			sql:  "INSERT INTO users VALUES (1, 'a') ON CONFLICT (id) DO UPDATE SET name = excluded.name, n = n + 1 WHERE n < 10",
+			want: &InsertStmt{
+				Table: ObjectName{Name: "users"},
+				Rows:  [][]Expr{{&Literal{Value: int64(1)}, &Literal{Value: "a"}}},
+				OnConflict: &OnConflict{
+					Columns: []string{"id"},
+					Set: []Assignment{
+						{Column: "name", Value: &ColumnRef{Table: "excluded", Name: "name"}},
+						{Column: "n", Value: &BinaryExpr{Op: "+", Left: &ColumnRef{Name: "n"}, Right: &Literal{Value: int64(1)}}},
+					},
+					Where: &BinaryExpr{Op: "<", Left: &ColumnRef{Name: "n"}, Right: &Literal{Value: int64(10)}},
+				},
+			},
+		},
+		{
+			name:    "[Error] insert on conflict without action",
+			sql:     "INSERT INTO users VALUES (1) ON CONFLICT (id)",
+			wantErr: ErrSyntax,
+		},
+		{
+			name: "[Success] update",
+			sql:  "UPDATE sales.users u SET name = 'b', n = u.n + 1 WHERE id = ?",
+			want: &UpdateStmt{
+				Table: ObjectName{Schema: "sales", Name: "users"},
+				Alias: "u",
+				Set: []Assignment{
+					{Column: "name", Value: &Literal{Value: "b"}},
+					{Column: "n", Value: &BinaryExpr{Op: "+", Left: &ColumnRef{Table: "u", Name: "n"}, Right: &Literal{Value: int64(1)}}},
+				},
+				Where: &BinaryExpr{Op: "=", Left: &ColumnRef{Name: "id"}, Right: &Param{Index: 0}},
+			},
+			wantNumInput: 1,
+		},
+		{
+			name:    "[Error] update without SET",
+			sql:     "UPDATE users WHERE id = 1",
+			wantErr: ErrSyntax,
+		},
+		{
+			name: "[Success] delete",
+			sql:  "DELETE FROM users AS u WHERE u.id = 1",
+			want: &DeleteStmt{
+				Table: ObjectName{Name: "users"},
+				Alias: "u",
+				Where: &BinaryExpr{Op: "=", Left: &ColumnRef{Table: "u", Name: "id"}, Right: &Literal{Value: int64(1)}},
+			},
+		},
+		{
+			name: "[Success] delete all rows",
+			sql:  "DELETE FROM users",
+			want: &DeleteStmt{Table: ObjectName{Name: "users"}},
+		},
+		{
+			name:    "[Error] delete without FROM",
+			sql:     "DELETE users",
+			wantErr: ErrSyntax,
+		},
+		{
+			name: "[Success] drop schema cascade",
+			sql:  "DROP SCHEMA IF EXISTS sales CASCADE",
+			want: &DropSchemaStmt{Name: "sales", IfExists: true, Cascade: true},
+		},
+		{
+			name: "[Success] set search_path",
+			sql:  "SET search_path TO sales, 'public'",
+			want: &SetStmt{Name: "search_path", Values: []string{"sales", "public"}},
+		},
+		{
+			name: "[Success] select from system view",
+			sql:  "SELECT table_name AS name, t.data_type type, * FROM information_schema.columns",
+			want: &SelectStmt{
+				Items: []SelectItem{
+					{Expr: &ColumnRef{Name: "table_name"}, Alias: "name"},
+					{Expr: &ColumnRef{Table: "t", Name: "data_type"}, Alias: "type"},
+					{Star: true},
+				},
+				From: &TableRef{Name: ObjectName{Schema: "information_schema", Name: "columns"}},
+			},
+		},
+		{
+			name: "[Success] select without from",
+			sql:  "SELECT 1, ?",
+			want: &SelectStmt{
+				Items: []SelectItem{{Expr: &Literal{Value: int64(1)}}, {Expr: &Param{Index: 0}}},
+			},
+			wantNumInput: 1,
+		},
+		{
+			name: "[Success] select with operator precedence",
+			sql:  "SELECT 1 + 2 * -a || 'x' FROM t WHERE NOT a = 1 OR b <> 2 AND c != 3",
+			want: &SelectStmt{
+				Items: []SelectItem{{Expr: &BinaryExpr{
+					Op: "||",
+					Left: &BinaryExpr{Op: "+", Left: &Literal{Value: int64(1)}, Right: &BinaryExpr{
+						Op: "*", Left: &Literal{Value: int64(2)}, Right: &UnaryExpr{Op: "-", Expr: &ColumnRef{Name: "a"}},
+					}},
+					Right: &Literal{Value: "x"},
+				}}},
+				From: &TableRef{Name: ObjectName{Name: "t"}},
+				Where: &BinaryExpr{
+					Op:   "OR",
+					Left: &UnaryExpr{Op: "NOT", Expr: &BinaryExpr{Op: "=", Left: &ColumnRef{Name: "a"}, Right: &Literal{Value: int64(1)}}},
+					Right: &BinaryExpr{
+						Op:    "AND",
+						Left:  &BinaryExpr{Op: "<>", Left: &ColumnRef{Name: "b"}, Right: &Literal{Value: int64(2)}},
+						Right: &BinaryExpr{Op: "<>", Left: &ColumnRef{Name: "c"}, Right: &Literal{Value: int64(3)}},
+					},
+				},
+			},
+		},
+		{
+			name: "[Success] select with predicates",
+			sql: `SELECT a FROM t WHERE a NOT LIKE 'x!%' ESCAPE '!' AND b ILIKE ? AND c NOT IN (1, 2)
+				AND d BETWEEN 1 AND 10 AND e IS NOT NULL AND f = TRUE`,
+			want: &SelectStmt{
+				Items: []SelectItem{{Expr: &ColumnRef{Name: "a"}}},
+				From:  &TableRef{Name: ObjectName{Name: "t"}},
+				Where: and(
+					&LikeExpr{Expr: &ColumnRef{Name: "a"}, Pattern: &Literal{Value: "x!%"}, Escape: &Literal{Value: "!"}, Not: true},
+					&LikeExpr{Expr: &ColumnRef{Name: "b"}, Pattern: &Param{Index: 0}, CaseInsensitive: true},
+					&InExpr{Expr: &ColumnRef{Name: "c"}, List: []Expr{&Literal{Value: int64(1)}, &Literal{Value: int64(2)}}, Not: true},
+					&BetweenExpr{Expr: &ColumnRef{Name: "d"}, Low: &Literal{Value: int64(1)}, High: &Literal{Value: int64(10)}},
+					&IsNullExpr{Expr: &ColumnRef{Name: "e"}, Not: true},
+					&BinaryExpr{Op: "=", Left: &ColumnRef{Name: "f"}, Right: &Literal{Value: true}},
+				),
+			},
+			wantNumInput: 1,
+		},
+		{
+			name: "[Success] select case and cast",
+			sql:  "SELECT CASE WHEN a > 0 THEN 'plus' ELSE 'other' END, CASE a WHEN 1 THEN 'one' END, CAST(a AS TEXT) FROM t",
+			want: &SelectStmt{
+				Items: []SelectItem{
+					{Expr: &CaseExpr{
+						Whens: []When{{Cond: &BinaryExpr{Op: ">", Left: &ColumnRef{Name: "a"}, Right: &Literal{Value: int64(0)}}, Result: &Literal{Value: "plus"}}},
+						Else:  &Literal{Value: "other"},
+					}},
+					{Expr: &CaseExpr{
+						Operand: &ColumnRef{Name: "a"},
+						Whens:   []When{{Cond: &Literal{Value: int64(1)}, Result: &Literal{Value: "one"}}},
+					}},
+					{Expr: &CastExpr{Expr: &ColumnRef{Name: "a"}, Type: meta.Varchar}},
+				},
+				From: &TableRef{Name: ObjectName{Name: "t"}},
+			},
+		},
+		{
+			name: "[Success] select with group by and having",
+			sql:  "SELECT a, COUNT(*), count(DISTINCT b) FROM t GROUP BY a, 2 HAVING SUM(b) > 1",
+			want: &SelectStmt{
+				Items: []SelectItem{
+					{Expr: &ColumnRef{Name: "a"}},
+					{Expr: &FuncCall{Name: "count", Star: true}},
+					{Expr: &FuncCall{Name: "count", Args: []Expr{&ColumnRef{Name: "b"}}, Distinct: true}},
+				},
+				From:    &TableRef{Name: ObjectName{Name: "t"}},
+				GroupBy: []Expr{&ColumnRef{Name: "a"}, &Literal{Value: int64(2)}},
+				Having: &BinaryExpr{
+					Op:    ">",
+					Left:  &FuncCall{Name: "sum", Args: []Expr{&ColumnRef{Name: "b"}}},
+					Right: &Literal{Value: int64(1)},
+				},
+			},
+		},
+		{
+			name: "[Success] set keyword value",
+			sql:  "SET enable_hashagg = ON",
+			want: &SetStmt{Name: "enable_hashagg", Values: []string{"on"}},
+		},
+		{
+			name: "[Success] set number",
+			sql:  "SET max_recursion_depth = 100",
+			want: &SetStmt{Name: "max_recursion_depth", Values: []string{"100"}},
+		},
+		{
+			name: "[Success] select with joins",
+			sql: `SELECT u.*, o.id FROM users AS u LEFT OUTER JOIN sales.orders o ON u.id = o.user_id
+				NATURAL JOIN profiles CROSS JOIN (a FULL JOIN b USING (k, l)), c`,
+			want: &SelectStmt{
+				Items: []SelectItem{{Star: true, Table: "u"}, {Expr: &ColumnRef{Table: "o", Name: "id"}}},
+				From: &JoinExpr{
+					Type: CrossJoin,
+					Left: &JoinExpr{
+						Type: CrossJoin,
+						Left: &JoinExpr{
+							Left: &JoinExpr{
+								Type:  LeftJoin,
+								Left:  &TableRef{Name: ObjectName{Name: "users"}, Alias: "u"},
+								Right: &TableRef{Name: ObjectName{Schema: "sales", Name: "orders"}, Alias: "o"},
+								On:    &BinaryExpr{Op: "=", Left: &ColumnRef{Table: "u", Name: "id"}, Right: &ColumnRef{Table: "o", Name: "user_id"}},
+							},
+							Right:   &TableRef{Name: ObjectName{Name: "profiles"}},
+							Natural: true,
+						},
+						Right: &JoinExpr{
+							Type:  FullJoin,
+							Left:  &TableRef{Name: ObjectName{Name: "a"}},
+							Right: &TableRef{Name: ObjectName{Name: "b"}},
+							Using: []string{"k", "l"},
+						},
+					},
+					Right: &TableRef{Name: ObjectName{Name: "c"}},
+				},
+			},
+		},
+		{
+			name: "[Success] select with subqueries",
+			sql: `SELECT (SELECT MAX(id) FROM t WHERE t.k = u.k) FROM (SELECT k FROM users) AS u
+				WHERE k NOT IN (SELECT k FROM t) AND NOT EXISTS (SELECT * FROM t)`,
+			want: &SelectStmt{
+				Items: []SelectItem{{Expr: &SubqueryExpr{Select: &SelectStmt{
+					Items: []SelectItem{{Expr: &FuncCall{Name: "max", Args: []Expr{&ColumnRef{Name: "id"}}}}},
+					From:  &TableRef{Name: ObjectName{Name: "t"}},
+					Where: &BinaryExpr{Op: "=", Left: &ColumnRef{Table: "t", Name: "k"}, Right: &ColumnRef{Table: "u", Name: "k"}},
+				}}}},
+				From: &DerivedTable{
+					Select: &SelectStmt{
+						Items: []SelectItem{{Expr: &ColumnRef{Name: "k"}}},
+						From:  &TableRef{Name: ObjectName{Name: "users"}},
+					},
+					Alias: "u",
+				},
+				Where: and(
+					&InExpr{
+						Expr: &ColumnRef{Name: "k"},
+						Select: &SelectStmt{
+							Items: []SelectItem{{Expr: &ColumnRef{Name: "k"}}},
+							From:  &TableRef{Name: ObjectName{Name: "t"}},
+						},
+						Not: true,
+					},
+					&UnaryExpr{Op: "NOT", Expr: &ExistsExpr{Select: &SelectStmt{
+						Items: []SelectItem{{Star: true}},
+						From:  &TableRef{Name: ObjectName{Name: "t"}},
+					}}},
+				),
+			},
+		},
+		{
+			name: "[Success] select with recursive common table expression",
+			sql: `WITH RECURSIVE r (n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM r WHERE n < 3), s AS (SELECT n FROM r)
+				SELECT n FROM s UNION SELECT 0`,
+			want: &SelectStmt{
+				With: []CommonTableExpr{
+					{
+						Name:    "r",
+						Columns: []string{"n"},
+						Select: &SelectStmt{SetOp: &SetOperation{
+							Op:   Union,
+							All:  true,
+							Left: &SelectStmt{Items: []SelectItem{{Expr: &Literal{Value: int64(1)}}}},
+							Right: &SelectStmt{
+								Items: []SelectItem{{Expr: &BinaryExpr{Op: "+", Left: &ColumnRef{Name: "n"}, Right: &Literal{Value: int64(1)}}}},
+								From:  &TableRef{Name: ObjectName{Name: "r"}},
+								Where: &BinaryExpr{Op: "<", Left: &ColumnRef{Name: "n"}, Right: &Literal{Value: int64(3)}},
+							},
+						}},
+					},
+					{
+						Name: "s",
+						Select: &SelectStmt{
+							Items: []SelectItem{{Expr: &ColumnRef{Name: "n"}}},
+							From:  &TableRef{Name: ObjectName{Name: "r"}},
+						},
+					},
+				},
+				Recursive: true,
+				SetOp: &SetOperation{
+					Op: Union,
+					Left: &SelectStmt{
+						Items: []SelectItem{{Expr: &ColumnRef{Name: "n"}}},
+						From:  &TableRef{Name: ObjectName{Name: "s"}},
+					},
+					Right: &SelectStmt{Items: []SelectItem{{Expr: &Literal{Value: int64(0)}}}},
+				},
+			},
+		},
+		{
+			name: "[Success] union of parenthesized queries",
+			sql:  "(SELECT 1) UNION ALL (SELECT 2 UNION SELECT 3)",
+			want: &SelectStmt{SetOp: &SetOperation{
+				Op:   Union,
+				All:  true,
+				Left: &SelectStmt{Items: []SelectItem{{Expr: &Literal{Value: int64(1)}}}},
+				Right: &SelectStmt{SetOp: &SetOperation{
+					Op:    Union,
+					Left:  &SelectStmt{Items: []SelectItem{{Expr: &Literal{Value: int64(2)}}}},
+					Right: &SelectStmt{Items: []SelectItem{{Expr: &Literal{Value: int64(3)}}}},
+				}},
+			}},
+		},
+		{
+			name: "[Success] set operations with order by and limit",
+			sql:  "SELECT a FROM t EXCEPT ALL SELECT a FROM u INTERSECT DISTINCT SELECT a FROM v ORDER BY a DESC, 1 NULLS FIRST LIMIT ? OFFSET 2",
+			want: &SelectStmt{
+				SetOp: &SetOperation{
+					Op:   Except,
+					All:  true,
+					Left: &SelectStmt{Items: []SelectItem{{Expr: &ColumnRef{Name: "a"}}}, From: &TableRef{Name: ObjectName{Name: "t"}}},
+					Right: &SelectStmt{SetOp: &SetOperation{
+						Op:    Intersect,
+						Left:  &SelectStmt{Items: []SelectItem{{Expr: &ColumnRef{Name: "a"}}}, From: &TableRef{Name: ObjectName{Name: "u"}}},
+						Right: &SelectStmt{Items: []SelectItem{{Expr: &ColumnRef{Name: "a"}}}, From: &TableRef{Name: ObjectName{Name: "v"}}},
+					}},
+				},
+				OrderBy: []OrderItem{
+					{Expr: &ColumnRef{Name: "a"}, Desc: true, NullsFirst: true},
+					{Expr: &Literal{Value: int64(1)}, NullsFirst: true},
+				},
+				Limit:  &Param{Index: 0},
+				Offset: &Literal{Value: int64(2)},
+			},
+			wantNumInput: 1,
+		},
+		{
+			name: "[Success] window functions",
+			sql:  "SELECT RANK() OVER (PARTITION BY a ORDER BY b DESC), SUM(b) OVER (ROWS BETWEEN 2 PRECEDING AND CURRENT ROW) FROM t",
+			want: &SelectStmt{
+				Items: []SelectItem{
+					{Expr: &FuncCall{Name: "rank", Over: &WindowSpec{
+						PartitionBy: []Expr{&ColumnRef{Name: "a"}},
+						OrderBy:     []OrderItem{{Expr: &ColumnRef{Name: "b"}, Desc: true, NullsFirst: true}},
+					}}},
+					{Expr: &FuncCall{Name: "sum", Args: []Expr{&ColumnRef{Name: "b"}}, Over: &WindowSpec{
+						Frame: &WindowFrame{Start: FrameBound{Type: Preceding, Offset: 2}, End: FrameBound{Type: CurrentRow}},
+					}}},
+				},
+				From: &TableRef{Name: ObjectName{Name: "t"}},
+			},
+		},
+		{
+			name:    "[Error] frame bound without direction",
+			sql:     "SELECT SUM(b) OVER (ROWS 2) FROM t",
+			wantErr: ErrSyntax,
+		},
+		{
+			name:    "[Error] order by after parenthesized query with limit",
+			sql:     "(SELECT a FROM t LIMIT 1) ORDER BY a",
+			wantErr: ErrSyntax,
+		},
+		{
+			name:    "[Error] common table expression without AS",
+			sql:     "WITH r (SELECT 1) SELECT * FROM r",
+			wantErr: ErrSyntax,
+		},
+		{
+			name:    "[Error] derived table without alias",
+			sql:     "SELECT * FROM (SELECT 1)",
+			wantErr: ErrSyntax,
+		},
+		{
+			name:    "[Error] join without condition",
+			sql:     "SELECT * FROM a JOIN b",
+			wantErr: ErrSyntax,
+		},
+		{
+			name:    "[Error] group without by",
+			sql:     "SELECT a FROM t GROUP a",
+			wantErr: ErrSyntax,
+		},
+		{
+			name:    "[Error] case without when",
+			sql:     "SELECT CASE ELSE 1 END",
+			wantErr: ErrSyntax,
+		},
+		{
+			name:    "[Error] select without items",
+			sql:     "SELECT FROM users",
+			wantErr: ErrSyntax,
+		},
+		{
+			name:    "[Error] unterminated string",
+			sql:     "INSERT INTO users VALUES ('a)",
+			wantErr: ErrUnterminatedString,
+		},
+		{
+			name:    "[Error] syntax error",
+			sql:     "CREATE TABLE users id INT",
+			wantErr: ErrSyntax,
+		},
+		{
+			name:    "[Error] not supported statement",
+			sql:     "GRANT ALL ON users",
+			wantErr: ErrNotSupportedStatement,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, numInput, err := Parse(tt.sql)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Parse() mismatch (-want +got):\n%s", diff)
+			}
+			if numInput != tt.wantNumInput {
+				t.Errorf("Parse() numInput = %d, want %d", numInput, tt.wantNumInput)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/nao1215/egsql/misc/errfmt"
+)
+
+// TokenKind is the kind of the token. It is Enum.
+type TokenKind uint8
+
+const (
+	// EOF is the end of the SQL text.
+	EOF TokenKind = iota
+	// Keyword is a reserved word such as SELECT. The value is upper case.
+	Keyword
+	// Ident is an identifier such as table name or column name. The value of
+	// the unquoted identifier is folded to lower case, and the value of the
+	// quoted identifier ("Name") is as written without the quotes.
+	Ident
+	// Number is an integer literal.
+	Number
+	// String is a string literal enclosed in single quotes.
+	String
+	// Symbol is an operator or a punctuation such as "(" or ">=".
+	Symbol
+	// Placeholder is a parameter placeholder "?".
+	Placeholder
+)
+
+// Token is the smallest unit of the SQL text.
+type Token struct {
+	// Kind is token kind.
+	Kind TokenKind
+	// Value is token text. Keywords are upper case, and the quotes
+	// of string literals are removed.
+	Value string
+	// Raw is the token text as written in the SQL text.
+	Raw string
+	// Pos is the byte offset of the token in the SQL text.
+	Pos int
+}
+
+// keywords is the reserved words. An identifier that matches one of them
+// (case-insensitive) is tokenized as Keyword.
+var keywords = map[string]bool{
+	"ACTION": true, "ADD": true, "ALL": true, "ALTER": true, "ALWAYS": true, "ANALYZE": true, "AND": true, "AS": true, "ASC": true,
+	"AUTOINCREMENT": true, "AUTO_INCREMENT": true, "BETWEEN": true, "BIGINT": true, "BY": true,
+	"CASCADE": true, "CASE": true, "CAST": true, "COLUMN": true, "CONFLICT": true, "CONSTRAINT": true,
+	"CREATE": true, "CROSS": true, "CURRENT": true, "DEFAULT": true, "DEFERRABLE": true, "DEFERRED": true,
+	"DELETE": true, "DESC": true, "DISTINCT": true, "DO": true, "DROP": true, "ELSE": true, "END": true, "ESCAPE": true,
+	"EXCEPT": true, "EXISTS": true, "EXPLAIN": true, "FALSE": true, "FIRST": true, "FOLLOWING": true, "FOREIGN": true, "FROM": true, "FULL": true, "GENERATED": true,
+	"GROUP": true, "HAVING": true, "IDENTITY": true, "IF": true, "ILIKE": true, "IMMEDIATE": true,
+	"IN": true, "INCREMENT": true, "INITIALLY": true, "INNER": true, "INSERT": true, "INT": true,
+	"INTEGER": true, "INTERSECT": true, "INTO": true, "IS": true, "JOIN": true, "KEY": true, "LAST": true, "LEFT": true,
+	"LIKE": true, "LIMIT": true, "NATURAL": true, "NO": true, "NOT": true, "NOTHING": true, "NULL": true, "NULLS": true, "OFFSET": true, "ON": true, "OR": true, "ORDER": true,
+	"OUTER": true, "OVER": true, "PARTITION": true, "PRECEDING": true, "PRIMARY": true,
+	"RANGE": true, "RECURSIVE": true, "REFERENCES": true, "RENAME": true, "RESTRICT": true,
+	"RIGHT": true, "ROW": true, "ROWS": true, "SCHEMA": true, "SELECT": true, "SEQUENCE": true, "SET": true, "START": true,
+	"TABLE": true, "TEXT": true, "THEN": true, "TO": true, "TRUE": true, "TRUNCATE": true,
+	"UNBOUNDED": true, "UNION": true, "UNIQUE": true, "UPDATE": true, "USING": true, "VALUES": true, "VARCHAR": true, "WHEN": true,
+	"WHERE": true, "WITH": true,
+}
+
+// symbols is the operators and punctuations. Longer symbols come first
+// so that ">=" is not tokenized as ">" and "=".
+var symbols = []string{
+	"<>", "<=", ">=", "!=", "||",
+	"(", ")", ",", ";", ".", "*", "=", "<", ">", "+", "-", "/", "%",
+}
+
+// Tokenize splits the SQL text into tokens. The last token is always EOF.
+func Tokenize(sql string) ([]Token, error) {
+	var tokens []Token
+	for pos := 0; pos < len(sql); {
+		c := rune(sql[pos])
+		switch {
+		case unicode.IsSpace(c):
+			pos++
+		case strings.HasPrefix(sql[pos:], "--"):
+			for pos < len(sql) && sql[pos] != '\n' {
+				pos++
+			}
+		case c == '\'':
+			s, next, err := readQuoted(sql, pos, '\'')
+			if err != nil {
+				return nil, errfmt.Wrap(ErrUnterminatedString, err.Error())
+			}
+			tokens = append(tokens, Token{Kind: String, Value: s, Raw: sql[pos:next], Pos: pos})
+			pos = next
+		case c == '"':
+			s, next, err := readQuoted(sql, pos, '"')
+			if err != nil {
+				return nil, errfmt.Wrap(ErrUnterminatedIdent, err.Error())
+			}
+			if s == "" {
+				return nil, errfmt.Wrap(ErrEmptyIdent, fmt.Sprintf("at position %d", pos))
+			}
+			tokens = append(tokens, Token{Kind: Ident, Value: s, Raw: sql[pos:next], Pos: pos})
+			pos = next
+		case c == '?':
+			tokens = append(tokens, Token{Kind: Placeholder, Value: "?", Raw: "?", Pos: pos})
+			pos++
+		case '0' <= c && c <= '9':
+			start := pos
+			for pos < len(sql) && '0' <= sql[pos] && sql[pos] <= '9' {
+				pos++
+			}
+			tokens = append(tokens, Token{Kind: Number, Value: sql[start:pos], Raw: sql[start:pos], Pos: start})
+		case isIdentStart(c):
+			start := pos
+			for pos < len(sql) && isIdentPart(rune(sql[pos])) {
+				pos++
+			}
+			word := sql[start:pos]
+			if keywords[strings.ToUpper(word)] {
+				tokens = append(tokens, Token{Kind: Keyword, Value: strings.ToUpper(word), Raw: word, Pos: start})
+			} else {
+				tokens = append(tokens, Token{Kind: Ident, Value: strings.ToLower(word), Raw: word, Pos: start})
+			}
+		default:
+			sym := matchSymbol(sql[pos:])
+			if sym == "" {
+				return nil, errfmt.Wrap(ErrUnexpectedChar, string(c))
+			}
+			tokens = append(tokens, Token{Kind: Symbol, Value: sym, Raw: sym, Pos: pos})
+			pos += len(sym)
+		}
+	}
+	return append(tokens, Token{Kind: EOF, Pos: len(sql)}), nil
+}
+
+// Normalize returns the SQL text in the normal form, in which the tokens are
+// separated by a space, the keywords are upper case, the unquoted identifiers
+// are lower case, and the comments and the trailing semicolon are removed.
+// The SQL texts of the same normal form are parsed to the same statement.
+func Normalize(sql string) (string, error) {
+	tokens, err := Tokenize(sql)
+	if err != nil {
+		return "", err
+	}
+	tokens = tokens[:len(tokens)-1]
+	if n := len(tokens); n > 0 && tokens[n-1].Kind == Symbol && tokens[n-1].Value == ";" {
+		tokens = tokens[:n-1]
+	}
+	words := make([]string, len(tokens))
+	for i, t := range tokens {
+		switch {
+		case t.Kind == Keyword, t.Kind == Ident && !strings.HasPrefix(t.Raw, `"`):
+			words[i] = t.Value
+		default:
+			words[i] = t.Raw
+		}
+	}
+	return strings.Join(words, " "), nil
+}
+
+// readQuoted reads the string literal or the quoted identifier that starts
+// at pos and is enclosed in quote. Two quotes in it mean one quote.
+// It returns the text without the quotes and the position after it.
+func readQuoted(sql string, pos int, quote byte) (string, int, error) {
+	var sb strings.Builder
+	for i := pos + 1; i < len(sql); i++ {
+		if sql[i] != quote {
+			sb.WriteByte(sql[i])
+			continue
+		}
+		if i+1 < len(sql) && sql[i+1] == quote {
+			sb.WriteByte(quote)
+			i++
+			continue
+		}
+		return sb.String(), i + 1, nil
+	}
+	return "", 0, fmt.Errorf("at position %d", pos)
+}
+
+// matchSymbol returns the symbol at the beginning of s. If no symbol matches, "" is returned.
+func matchSymbol(s string) string {
+	for _, sym := range symbols {
+		if strings.HasPrefix(s, sym) {
+			return sym
+		}
+	}
+	return ""
+}
+
+// isIdentStart reports whether the byte c can be the first byte of an identifier.
+// The bytes of multibyte UTF-8 characters are treated as letters.
+func isIdentStart(c rune) bool {
+	return c == '_' || c >= utf8.RuneSelf || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+// isIdentPart reports whether the byte c can be a byte of an identifier.
+func isIdentPart(c rune) bool {
+	return isIdentStart(c) || ('0' <= c && c <= '9')
+}
@@ -0,0 +1,140 @@
+package query
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name    string
+		sql     string
+		want    []Token
+		wantErr error
+	}{
+		{
+			name: "[Success] unquoted identifiers are folded to lower case and keywords to upper case",
+			sql:  "Select Users.ID",
+			want: []Token{
+				{Kind: Keyword, Value: "SELECT", Raw: "Select", Pos: 0},
+				{Kind: Ident, Value: "users", Raw: "Users", Pos: 7},
+				{Kind: Symbol, Value: ".", Raw: ".", Pos: 12},
+				{Kind: Ident, Value: "id", Raw: "ID", Pos: 13},
+				{Kind: EOF, Pos: 15},
+			},
+		},
+		{
+			name: "[Success] quoted identifiers are exact",
+			sql:  `"Users" "say ""hi""" insert`,
+			want: []Token{
+				{Kind: Ident, Value: "Users", Raw: `"Users"`, Pos: 0},
+				{Kind: Ident, Value: `say "hi"`, Raw: `"say ""hi"""`, Pos: 8},
+				{Kind: Keyword, Value: "INSERT", Raw: "insert", Pos: 21},
+				{Kind: EOF, Pos: 27},
+			},
+		},
+		{
+			name: "[Success] string literal and comment",
+			sql:  "'it''s' -- comment",
+			want: []Token{
+				{Kind: String, Value: "it's", Raw: "'it''s'", Pos: 0},
+				{Kind: EOF, Pos: 18},
+			},
+		},
+		{
+			name:    "[Error] unterminated quoted identifier",
+			sql:     `"Users`,
+			wantErr: ErrUnterminatedIdent,
+		},
+		{
+			name:    "[Error] empty quoted identifier",
+			sql:     `""`,
+			wantErr: ErrEmptyIdent,
+		},
+		{
+			name:    "[Error] unexpected character",
+			sql:     "id @ 1",
+			wantErr: ErrUnexpectedChar,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Tokenize(tt.sql)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Tokenize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Tokenize() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name    string
+		sql     string
+		want    string
+		wantErr error
+	}{
+		{
+			name: "[Success] spaces, comments, cases and semicolon",
+			sql:  "select  Name,\n\t\"Age\" -- comment\nFROM Users WHERE name = 'Gopher' AND id=?;",
+			want: `SELECT name , "Age" FROM users WHERE name = 'Gopher' AND id = ?`,
+		},
+		{
+			name:    "[Error] unterminated string",
+			sql:     "SELECT 'a",
+			wantErr: ErrUnterminatedString,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Normalize(tt.sql)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Normalize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Normalize() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseObjectName(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		want    ObjectName
+		wantErr error
+	}{
+		{
+			name: "[Success] unqualified name",
+			text: "Orders_Seq",
+			want: ObjectName{Name: "orders_seq"},
+		},
+		{
+			name: "[Success] qualified name with quoted identifier",
+			text: `Sales."Orders"`,
+			want: ObjectName{Schema: "sales", Name: "Orders"},
+		},
+		{
+			name:    "[Error] extra token",
+			text:    "a.b.c",
+			wantErr: ErrSyntax,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseObjectName(tt.text)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParseObjectName() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("ParseObjectName() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
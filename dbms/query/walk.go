@@ -0,0 +1,64 @@
+package query
+
+// Walk calls fn for the expression and its subexpressions in depth-first order.
+// If fn returns false, the subexpressions of the expression are not visited.
+func Walk(e Expr, fn func(Expr) bool) {
+	if e == nil || !fn(e) {
+		return
+	}
+	for _, c := range children(e) {
+		Walk(c, fn)
+	}
+}
+
+// children returns the direct subexpressions of the expression.
+// The nil subexpressions (e.g. CASE without ELSE) are not returned.
+func children(e Expr) []Expr {
+	var exprs []Expr
+	switch v := e.(type) {
+	case *FuncCall:
+		exprs = append([]Expr{}, v.Args...)
+		if v.Over != nil {
+			exprs = append(exprs, v.Over.PartitionBy...)
+			for _, item := range v.Over.OrderBy {
+				exprs = append(exprs, item.Expr)
+			}
+		}
+	case *BinaryExpr:
+		exprs = []Expr{v.Left, v.Right}
+	case *UnaryExpr:
+		exprs = []Expr{v.Expr}
+	case *LikeExpr:
+		exprs = []Expr{v.Expr, v.Pattern, v.Escape}
+	case *InExpr:
+		exprs = append([]Expr{v.Expr}, v.List...)
+	case *BetweenExpr:
+		exprs = []Expr{v.Expr, v.Low, v.High}
+	case *IsNullExpr:
+		exprs = []Expr{v.Expr}
+	case *CaseExpr:
+		exprs = []Expr{v.Operand}
+		for _, w := range v.Whens {
+			exprs = append(exprs, w.Cond, w.Result)
+		}
+		exprs = append(exprs, v.Else)
+	case *CastExpr:
+		exprs = []Expr{v.Expr}
+	}
+
+	result := exprs[:0:0]
+	for _, c := range exprs {
+		if c != nil {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// Conjuncts returns the operands of the top-level ANDs of the condition.
+func Conjuncts(cond Expr) []Expr {
+	if b, ok := cond.(*BinaryExpr); ok && b.Op == "AND" {
+		return append(Conjuncts(b.Left), Conjuncts(b.Right)...)
+	}
+	return []Expr{cond}
+}
@@ -0,0 +1,179 @@
+package dbms
+
+import (
+	"context"
+	"io"
+
+	"github.com/nao1215/egsql/dbms/executor"
+	"github.com/nao1215/egsql/dbms/expr"
+	"github.com/nao1215/egsql/dbms/query"
+)
+
+// Rows is the cursor of the result rows of the query. The rows of SELECT
+// statement are computed a batch at a time as they are read, so that the
+// rows are not held in memory at once.
+type Rows struct {
+	db      *EgSQLDB
+	ctx     context.Context
+	columns []string
+	// plan is the opened plan, or nil if the rows are exhausted or closed.
+	plan executor.Operator
+	// first is the first batch, computed when the query is executed so that
+	// its errors are returned by Query.
+	first *executor.Batch
+	// bound is the cached plan, returned to the plan cache when it is closed, or nil.
+	bound *boundPlan
+}
+
+// Query executes the statement like Exec, and returns the cursor of the result
+// rows. SELECT statement is executed a batch at a time as the rows are read,
+// and the other statements are executed at once. The cursor must be closed.
+func (db *EgSQLDB) Query(sess *Session, stmt query.Stmt, args []interface{}) (*Rows, error) {
+	return db.QueryContext(context.Background(), sess, stmt, args)
+}
+
+// QueryContext is Query with the context. When the context is done, SELECT
+// statement stops with its error and removes its temporary files.
+func (db *EgSQLDB) QueryContext(ctx context.Context, sess *Session, stmt query.Stmt, args []interface{}) (*Rows, error) {
+	s, ok := stmt.(*query.SelectStmt)
+	if !ok {
+		rs, err := db.Exec(sess, stmt, args)
+		if err != nil {
+			return nil, err
+		}
+		rows := &Rows{db: db, ctx: ctx, columns: rs.ColumnNames, plan: &executor.Values{Rows: rs.Rows}}
+		return rows, rows.plan.Open()
+	}
+	if sess == nil {
+		sess = NewSession()
+	}
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	p := &planner{db: db, sess: sess, ctx: ctx, env: &expr.Env{Args: args}}
+	r, err := p.planSelect(s)
+	if err != nil {
+		return nil, err
+	}
+	rows := &Rows{db: db, ctx: ctx, plan: r.plan}
+	for _, c := range r.columns {
+		rows.columns = append(rows.columns, c.Name)
+	}
+	if err := rows.open(); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// QueryPrepared executes the statement prepared by Prepare like QueryContext.
+// SELECT statement is executed with the plan cached by the plan cache if
+// the plan is bound with the same settings of the session, and the plan is
+// cached when the rows are closed. The other statements are executed by
+// QueryContext.
+func (db *EgSQLDB) QueryPrepared(ctx context.Context, sess *Session, p *PreparedStmt, args []interface{}) (*Rows, error) {
+	if _, ok := p.Stmt.(*query.SelectStmt); !ok {
+		return db.QueryContext(ctx, sess, p.Stmt, args)
+	}
+	if sess == nil {
+		sess = NewSession()
+	}
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	b := db.plans.take(p, db.version, sess)
+	if b == nil {
+		var err error
+		if b, err = db.bindSelect(ctx, sess, p, args); err != nil {
+			return nil, err
+		}
+	} else if err := b.rebind(ctx, args); err != nil {
+		return nil, err
+	}
+	rows := &Rows{db: db, ctx: ctx, columns: b.columns, plan: b.plan, bound: b}
+	if err := rows.open(); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// open opens the plan and computes the first batch. It must be called with
+// db.mutex locked.
+func (r *Rows) open() error {
+	if err := r.plan.Open(); err != nil {
+		r.close()
+		return err
+	}
+	var err error
+	if r.first, err = r.next(); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+// Columns returns the names of the columns.
+func (r *Rows) Columns() []string {
+	return r.columns
+}
+
+// NextBatch returns the next batch of the rows. It returns io.EOF if there
+// is no more row. The batch is valid until the next call.
+// When the context is done, the cursor is closed and its error is returned.
+func (r *Rows) NextBatch() (*executor.Batch, error) {
+	if err := r.ctx.Err(); err != nil {
+		if cErr := r.Close(); cErr != nil {
+			return nil, cErr
+		}
+		return nil, err
+	}
+	if b := r.first; b != nil {
+		r.first = nil
+		return b, nil
+	}
+	if r.plan == nil {
+		return nil, io.EOF
+	}
+	r.db.mutex.Lock()
+	defer r.db.mutex.Unlock()
+	return r.next()
+}
+
+// next computes the next batch. The plan is closed when the rows are
+// exhausted or an error occurs. It must be called with db.mutex locked.
+func (r *Rows) next() (*executor.Batch, error) {
+	b, err := executor.NextBatch(r.plan, executor.BatchSize)
+	if err != nil {
+		if cErr := r.close(); err == io.EOF && cErr != nil {
+			err = cErr
+		}
+		return nil, err
+	}
+	return b, nil
+}
+
+// Close closes the cursor. It can be called more than once.
+func (r *Rows) Close() error {
+	r.first = nil
+	if r.plan == nil {
+		return nil
+	}
+	r.db.mutex.Lock()
+	defer r.db.mutex.Unlock()
+	return r.close()
+}
+
+// close closes the plan, and returns the cached plan to the plan cache.
+// It must be called with db.mutex locked.
+func (r *Rows) close() error {
+	if r.plan == nil {
+		return nil
+	}
+	err := r.plan.Close()
+	r.plan = nil
+	if r.bound != nil {
+		r.db.plans.put(r.bound)
+		r.bound = nil
+	}
+	return err
+}
@@ -0,0 +1,210 @@
+package dbms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nao1215/egsql/dbms/expr"
+	"github.com/nao1215/egsql/dbms/query"
+)
+
+// queryRows executes the SQL by Query, and returns the lengths of the batches and the rows.
+func queryRows(t *testing.T, db *EgSQLDB, sql string) ([]int, [][]interface{}) {
+	t.Helper()
+
+	stmt, _, err := query.Parse(sql)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := db.Query(nil, stmt, nil)
+	if err != nil {
+		t.Fatalf("Query(%q) error = %v", sql, err)
+	}
+	defer rows.Close()
+
+	var lens []int
+	var got [][]interface{}
+	for {
+		b, err := rows.NextBatch()
+		if err == io.EOF {
+			return lens, got
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		lens = append(lens, b.Len)
+		for j := 0; j < b.Len; j++ {
+			got = append(got, b.Row(j))
+		}
+	}
+}
+
+func TestEgSQLDB_Query(t *testing.T) {
+	db, err := NewEgSQLDB(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := execSQL(t, db, "CREATE TABLE a (id INT PRIMARY KEY, v INT)"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 2100; i++ {
+		if _, err := execSQL(t, db, "INSERT INTO a VALUES (?, ?)", int64(i), int64(i%3)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("[Success] rows are read a batch at a time", func(t *testing.T) {
+		sql := "SELECT id FROM a WHERE v = 0"
+		lens, got := queryRows(t, db, sql)
+		if diff := cmp.Diff([]int{341, 341, 18}, lens); diff != "" {
+			t.Errorf("batch lengths mismatch (-want +got):\n%s", diff)
+		}
+		if diff := cmp.Diff(querySQL(t, db, sql).Rows, got); diff != "" {
+			t.Errorf("rows mismatch with Exec (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("[Success] more rows than a batch", func(t *testing.T) {
+		lens, got := queryRows(t, db, "SELECT id, v FROM a ORDER BY id DESC")
+		if diff := cmp.Diff([]int{1024, 1024, 52}, lens); diff != "" {
+			t.Errorf("batch lengths mismatch (-want +got):\n%s", diff)
+		}
+		if diff := cmp.Diff([]interface{}{int64(2100), int64(0)}, got[0]); diff != "" {
+			t.Errorf("first row mismatch (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("[Success] statement other than SELECT", func(t *testing.T) {
+		lens, got := queryRows(t, db, "EXPLAIN SELECT id FROM a")
+		if diff := cmp.Diff([]int{2}, lens); diff != "" {
+			t.Errorf("batch lengths mismatch (-want +got):\n%s", diff)
+		}
+		if diff := cmp.Diff([]interface{}{"Project (id)"}, got[0]); diff != "" {
+			t.Errorf("first row mismatch (-want +got):\n%s", diff)
+		}
+	})
+	t.Run("[Error] error of the first batch is returned by Query", func(t *testing.T) {
+		stmt, _, err := query.Parse("SELECT 1 / v FROM a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Query(nil, stmt, nil); !errors.Is(err, expr.ErrDivisionByZero) {
+			t.Errorf("Query() error = %v, want %v", err, expr.ErrDivisionByZero)
+		}
+	})
+	t.Run("[Success] database is usable while rows are open", func(t *testing.T) {
+		stmt, _, err := query.Parse("SELECT id FROM a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows, err := db.Query(nil, stmt, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		if _, err := execSQL(t, db, "INSERT INTO a VALUES (3000, 0)"); err != nil {
+			t.Fatal(err)
+		}
+		if err := rows.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := rows.NextBatch(); err != io.EOF {
+			t.Errorf("NextBatch() after Close error = %v, want io.EOF", err)
+		}
+	})
+}
+
+func TestEgSQLDB_QueryContext_ExternalSort(t *testing.T) {
+	db, err := NewEgSQLDB(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := execSQL(t, db, "CREATE TABLE a (id INT PRIMARY KEY, name TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 3000; i++ {
+		if _, err := execSQL(t, db, "INSERT INTO a VALUES (?, ?)", int64(i), fmt.Sprintf("name%04d", i%1000)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tempDir := filepath.Join(db.homeDir, tempDirName)
+	sess := NewSession()
+	if _, err := db.Exec(sess, mustParse(t, "SET work_mem = '4kB'"), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("[Success] sort spills and merges the runs", func(t *testing.T) {
+		rows, err := db.QueryContext(context.Background(), sess, mustParse(t, "SELECT id, name FROM a ORDER BY name DESC, id"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		if files, _ := os.ReadDir(tempDir); len(files) == 0 {
+			t.Error("no temporary file is written while the rows are read")
+		}
+		var got [][]interface{}
+		for {
+			b, err := rows.NextBatch()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for j := 0; j < b.Len; j++ {
+				got = append(got, b.Row(j))
+			}
+		}
+		if len(got) != 3000 {
+			t.Fatalf("got %d rows, want 3000", len(got))
+		}
+		want := [][]interface{}{{int64(999), "name0999"}, {int64(1999), "name0999"}, {int64(2999), "name0999"}, {int64(998), "name0998"}}
+		if diff := cmp.Diff(want, got[:4]); diff != "" {
+			t.Errorf("first rows mismatch (-want +got):\n%s", diff)
+		}
+		if files, _ := os.ReadDir(tempDir); len(files) != 0 {
+			t.Errorf("temporary files are left: %v", files)
+		}
+	})
+	t.Run("[Error] cancelled query removes the temporary files", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := db.QueryContext(ctx, sess, mustParse(t, "SELECT id FROM a ORDER BY name"), nil); !errors.Is(err, context.Canceled) {
+			t.Errorf("QueryContext() error = %v, want %v", err, context.Canceled)
+		}
+		if files, _ := os.ReadDir(tempDir); len(files) != 0 {
+			t.Errorf("temporary files are left: %v", files)
+		}
+	})
+	t.Run("[Error] cancelled while the rows are read", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		rows, err := db.QueryContext(ctx, sess, mustParse(t, "SELECT id FROM a ORDER BY name"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		cancel()
+		if _, err := rows.NextBatch(); !errors.Is(err, context.Canceled) {
+			t.Errorf("NextBatch() error = %v, want %v", err, context.Canceled)
+		}
+		if files, _ := os.ReadDir(tempDir); len(files) != 0 {
+			t.Errorf("temporary files are left: %v", files)
+		}
+	})
+}
+
+// mustParse parses the SQL.
+func mustParse(t *testing.T, sql string) query.Stmt {
+	t.Helper()
+
+	stmt, _, err := query.Parse(sql)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stmt
+}
@@ -0,0 +1,71 @@
+package dbms
+
+import (
+	"strings"
+
+	"github.com/nao1215/egsql/dbms/meta"
+	"github.com/nao1215/egsql/dbms/storage"
+	"github.com/nao1215/egsql/misc/errfmt"
+)
+
+// CreateSchema adds the schema to the catalog and persists the catalog.
+func (db *EgSQLDB) CreateSchema(name string) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if name == "" || strings.Contains(name, ".") {
+		return errfmt.Wrap(ErrInvalidSchemaName, name)
+	}
+	if db.catalog.HasSchema(name) || meta.IsSystemSchema(name) {
+		return errfmt.Wrap(ErrExistSchema, name)
+	}
+	next := db.catalog.Copy()
+	next.AddSchema(name)
+	if err := storage.SaveCatalog(db.homeDir, next); err != nil {
+		return err
+	}
+	db.catalog.AddSchema(name)
+	db.version++
+	return nil
+}
+
+// DropSchema removes the schema from the catalog and persists the catalog.
+// If ifExists is true, dropping the schema that does not exist is not an error.
+// If cascade is true, the tables and sequences in the schema are dropped too;
+// otherwise the schema must be empty.
+func (db *EgSQLDB) DropSchema(name string, ifExists, cascade bool) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if name == meta.DefaultSchema {
+		return ErrDropDefaultSchema
+	}
+	if meta.IsSystemSchema(name) {
+		return errfmt.Wrap(ErrSystemSchema, name)
+	}
+	if !db.catalog.HasSchema(name) {
+		if ifExists {
+			return nil
+		}
+		return errfmt.Wrap(ErrNotExistSchema, name)
+	}
+
+	var tables, sequences []string
+	for _, s := range db.catalog.Schemes {
+		if s.SchemaName() == name {
+			tables = append(tables, s.TableName)
+		}
+	}
+	for _, seq := range db.catalog.Sequences {
+		if schema, _ := meta.SplitQualifiedName(seq.Name); schema == name {
+			sequences = append(sequences, seq.Name)
+		}
+	}
+	if !cascade && len(tables)+len(sequences) > 0 {
+		return errfmt.Wrap(ErrDependentObject, "schema "+name+" is not empty")
+	}
+	if err := db.checkDroppable(tables); err != nil {
+		return err
+	}
+	return db.dropObjects([]string{name}, tables, sequences)
+}
@@ -0,0 +1,121 @@
+package dbms
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nao1215/egsql/dbms/query"
+	"github.com/nao1215/egsql/dbms/storage"
+)
+
+// execIn parses and executes the SQL in the session.
+func execIn(t *testing.T, db *EgSQLDB, sess *Session, sql string) error {
+	t.Helper()
+
+	stmt, _, err := query.Parse(sql)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(sess, stmt, nil)
+	return err
+}
+
+func TestEgSQLDB_Schema(t *testing.T) {
+	db, err := NewEgSQLDB(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess := NewSession()
+	for _, sql := range []string{
+		"CREATE SCHEMA sales",
+		"CREATE TABLE users (id INT PRIMARY KEY AUTOINCREMENT, name TEXT)",
+		"CREATE TABLE sales.users (id INT PRIMARY KEY AUTOINCREMENT, name TEXT)",
+		"CREATE TABLE sales.orders (id INT PRIMARY KEY, user_id INT REFERENCES users)",
+		"INSERT INTO users (name) VALUES ('public')",
+		"SET search_path TO sales, public",
+		"INSERT INTO users (name) VALUES ('sales')",
+		"INSERT INTO orders VALUES (1, 1)",
+	} {
+		if err := execIn(t, db, sess, sql); err != nil {
+			t.Fatalf("Exec(%q) error = %v", sql, err)
+		}
+	}
+
+	if diff := cmp.Diff([]storage.Row{{int64(1), "public"}}, rows(db, "users")); diff != "" {
+		t.Errorf("public.users mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]storage.Row{{int64(1), "sales"}}, rows(db, "sales.users")); diff != "" {
+		t.Errorf("sales.users mismatch (-want +got):\n%s", diff)
+	}
+	// The unqualified reference is resolved when the table is created.
+	if got := db.catalog.FetchScheme("sales.orders").ForeignKeys[0].RefTable; got != "users" {
+		t.Errorf("RefTable = %q, want %q", got, "users")
+	}
+
+	if err := execIn(t, db, sess, "DROP SCHEMA sales"); !errors.Is(err, ErrDependentObject) {
+		t.Errorf("DROP SCHEMA error = %v, want %v", err, ErrDependentObject)
+	}
+	if err := execIn(t, db, sess, "DROP SCHEMA public"); !errors.Is(err, ErrDropDefaultSchema) {
+		t.Errorf("DROP SCHEMA error = %v, want %v", err, ErrDropDefaultSchema)
+	}
+	if err := execIn(t, db, sess, "CREATE TABLE nowhere.users (id INT)"); !errors.Is(err, ErrNotExistSchema) {
+		t.Errorf("CREATE TABLE error = %v, want %v", err, ErrNotExistSchema)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := NewEgSQLDB(db.homeDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reopened.catalog.HasSchema("sales") || !reopened.catalog.HasScheme("sales.users") {
+		t.Error("schema sales is not persisted")
+	}
+
+	if err := execIn(t, db, sess, "DROP SCHEMA sales CASCADE"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"sales.users", "sales.orders"} {
+		if db.Table(name) != nil {
+			t.Errorf("table %s exists after DROP SCHEMA CASCADE", name)
+		}
+	}
+	if db.catalog.HasSequence("sales.users_id_seq") {
+		t.Error("sequence sales.users_id_seq exists after DROP SCHEMA CASCADE")
+	}
+	if err := execIn(t, db, sess, "INSERT INTO users (name) VALUES ('public again')"); err != nil {
+		t.Errorf("INSERT after DROP SCHEMA error = %v", err)
+	}
+}
+
+func TestEgSQLDB_IdentifierFolding(t *testing.T) {
+	db, err := NewEgSQLDB(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess := NewSession()
+	for _, sql := range []string{
+		"CREATE TABLE Users (ID INT PRIMARY KEY, Name TEXT)",
+		`CREATE TABLE "Users" ("ID" INT PRIMARY KEY)`,
+		"INSERT INTO USERS (id, NAME) VALUES (1, 'lower')",
+		`INSERT INTO "Users" ("ID") VALUES (2)`,
+		"CREATE SEQUENCE Order_Seq START WITH 10",
+		"INSERT INTO users VALUES (nextval('ORDER_SEQ'), 'seq')",
+	} {
+		if err := execIn(t, db, sess, sql); err != nil {
+			t.Fatalf("Exec(%q) error = %v", sql, err)
+		}
+	}
+
+	if diff := cmp.Diff([]storage.Row{{int64(1), "lower"}, {int64(10), "seq"}}, rows(db, "users")); diff != "" {
+		t.Errorf("users mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]storage.Row{{int64(2)}}, rows(db, "Users")); diff != "" {
+		t.Errorf(`"Users" mismatch (-want +got):\n%s`, diff)
+	}
+	if err := execIn(t, db, sess, `INSERT INTO "USERS" VALUES (3, 'x')`); !errors.Is(err, ErrNotExistTable) {
+		t.Errorf("INSERT error = %v, want %v", err, ErrNotExistTable)
+	}
+}
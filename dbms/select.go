@@ -0,0 +1,515 @@
+package dbms
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nao1215/egsql/dbms/executor"
+	"github.com/nao1215/egsql/dbms/expr"
+	"github.com/nao1215/egsql/dbms/meta"
+	"github.com/nao1215/egsql/dbms/query"
+	"github.com/nao1215/egsql/dbms/storage"
+	"github.com/nao1215/egsql/misc/errfmt"
+)
+
+// execSelect executes SELECT statement and returns the rows in the result set.
+// The database is locked during the statement like the other statements,
+// because nextval() in the select list advances the sequence.
+func (db *EgSQLDB) execSelect(sess *Session, stmt *query.SelectStmt, args []interface{}) (*meta.ResultSet, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	p := &planner{db: db, sess: sess, env: &expr.Env{Args: args}}
+	r, err := p.planSelect(stmt)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := executor.Run(r.plan)
+	if err != nil {
+		return nil, err
+	}
+	rs := meta.NewResultSet(fmt.Sprintf("SELECT %d", len(rows)))
+	for _, c := range r.columns {
+		rs.ColumnNames = append(rs.ColumnNames, c.Name)
+	}
+	rs.Rows = rows
+	return rs, nil
+}
+
+// planner plans a query. It must be used with db.mutex locked.
+// Each subquery is planned by its own planner.
+type planner struct {
+	db   *EgSQLDB
+	sess *Session
+	// ctx is the context of the query, or nil. The operators that write the
+	// temporary files stop when it is done.
+	ctx context.Context
+	// env is the environment in which the operators of the query evaluate the expressions.
+	env *expr.Env
+	// outer is the binder of the query that the subquery is in, or nil.
+	outer *expr.Binder
+	// correlated is set to true if the query references the columns of the outer queries.
+	correlated bool
+	// ctes is the common table expressions in scope, the innermost first.
+	ctes *cte
+	// bound is the plan being bound for the plan cache, or nil.
+	bound *boundPlan
+}
+
+// binder returns the binder of the expressions of the query that reference the columns.
+func (p *planner) binder(columns expr.Columns) *expr.Binder {
+	return &expr.Binder{
+		Scope: columns, Outer: p.outer, Funcs: p.db.funcBinder(p.sess), Aggregates: p.db.funcs,
+		Subquery: p.planSubquery, Correlated: &p.correlated,
+	}
+}
+
+// planSubquery plans the subquery in the expression bound by outer.
+func (p *planner) planSubquery(stmt *query.SelectStmt, outer *expr.Binder) (expr.Query, []expr.Type, error) {
+	sub := &planner{db: p.db, sess: p.sess, ctx: p.ctx, env: &expr.Env{Args: p.env.Args}, outer: outer, ctes: p.ctes, bound: p.bound}
+	r, err := sub.planSelect(stmt)
+	if err != nil {
+		return nil, nil, err
+	}
+	types := make([]expr.Type, len(r.columns))
+	for i, c := range r.columns {
+		types[i] = c.T
+	}
+	q := &executor.Subquery{Plan: r.plan, Env: sub.env, Correlated: sub.correlated}
+	p.rebind(func() error {
+		q.Reset()
+		return nil
+	})
+	return q, types, nil
+}
+
+// config returns the resources of the operator of the query. The context of
+// the bound plan is replaced at each execution.
+func (p *planner) config() *executor.Config {
+	c := p.db.executorConfig(p.ctx, p.sess)
+	if p.bound != nil {
+		p.bound.configs = append(p.bound.configs, c)
+	}
+	return c
+}
+
+// rebind registers the function that prepares the bound plan for its next
+// execution, e.g. reads the rows of the table again.
+func (p *planner) rebind(f func() error) {
+	if p.bound != nil {
+		p.bound.rebinds = append(p.bound.rebinds, f)
+	}
+}
+
+// planSelect binds the query and returns the relation of the result rows.
+// The common table expressions of WITH clause are in scope while the query
+// is planned.
+func (p *planner) planSelect(stmt *query.SelectStmt) (*relation, error) {
+	if len(stmt.With) > 0 {
+		defer func(ctes *cte) { p.ctes = ctes }(p.ctes)
+		if err := p.declareCTEs(stmt.With, stmt.Recursive); err != nil {
+			return nil, err
+		}
+	}
+	var r *relation
+	var err error
+	if stmt.SetOp != nil {
+		if r, err = p.planSetOperation(stmt.SetOp); err != nil {
+			return nil, err
+		}
+		if r, err = p.planSortedSetOperation(r, stmt.OrderBy); err != nil {
+			return nil, err
+		}
+	} else if r, err = p.planSimpleSelect(stmt); err != nil {
+		return nil, err
+	}
+	return p.planLimit(r, stmt.Limit, stmt.Offset)
+}
+
+// planSimpleSelect binds SELECT statement without WITH clause and the set
+// operation, and returns the relation of the result rows sorted by ORDER BY
+// clause, whose columns are the select list.
+func (p *planner) planSimpleSelect(stmt *query.SelectStmt) (*relation, error) {
+	env := p.env
+	from, where, err := p.planFromWhere(stmt.From, stmt.Where)
+	if err != nil {
+		return nil, err
+	}
+	plan := from.plan
+
+	binder := p.binder(from.columns)
+	if len(where) > 0 {
+		// The simple correlated EXISTS in WHERE clause is planned as the semi join.
+		var conds []expr.Expr
+		for _, c := range where {
+			semi, err := p.planSemiJoin(plan, binder, c)
+			if err != nil {
+				return nil, err
+			}
+			if semi != nil {
+				plan = semi
+				continue
+			}
+			cond, err := binder.BindCondition(c)
+			if err != nil {
+				return nil, err
+			}
+			conds = append(conds, cond)
+		}
+		if len(conds) > 0 {
+			plan = &executor.Filter{Input: plan, Cond: expr.And(conds...), Env: env}
+		}
+	}
+
+	items, err := expandStar(from, stmt.Items)
+	if err != nil {
+		return nil, err
+	}
+	if isAggregateQuery(binder, stmt) {
+		groupBy, err := resolveGroupBy(binder.Scope, items, stmt.GroupBy)
+		if err != nil {
+			return nil, err
+		}
+		grouping, err := expr.NewGrouping(binder, groupBy)
+		if err != nil {
+			return nil, err
+		}
+		// The select list and HAVING clause are bound to the grouped rows, and
+		// the window functions are computed for the rows that pass HAVING.
+		grouped := grouping.Binder()
+		windowing := expr.NewWindowing(grouped)
+		names, exprs, err := bindSelectItems(windowing.Binder(), items)
+		if err != nil {
+			return nil, err
+		}
+		var having expr.Expr
+		if stmt.Having != nil {
+			if having, err = grouped.BindCondition(stmt.Having); err != nil {
+				return nil, err
+			}
+		}
+		keys, exprs, err := bindOrderBy(windowing.Binder(), names, exprs, stmt.OrderBy)
+		if err != nil {
+			return nil, err
+		}
+		// The aggregation is planned after all aggregate functions are bound.
+		plan = p.planAggregate(plan, grouping)
+		if having != nil {
+			plan = &executor.Filter{Input: plan, Cond: having, Env: env}
+		}
+		plan = p.planWindow(plan, windowing, len(grouping.Keys)+len(grouping.Aggregates))
+		return p.projection(plan, names, exprs, keys), nil
+	}
+
+	windowing := expr.NewWindowing(binder)
+	names, exprs, err := bindSelectItems(windowing.Binder(), items)
+	if err != nil {
+		return nil, err
+	}
+	keys, exprs, err := bindOrderBy(windowing.Binder(), names, exprs, stmt.OrderBy)
+	if err != nil {
+		return nil, err
+	}
+	plan = p.planWindow(plan, windowing, len(from.columns))
+	return p.projection(plan, names, exprs, keys), nil
+}
+
+// planWindow returns the operators that compute the window functions for the
+// input rows of width columns. The functions of the same window are computed
+// by one operator, and the results follow the input row in the order of
+// w.Funcs.
+func (p *planner) planWindow(input executor.Operator, w *expr.Windowing, width int) executor.Operator {
+	if len(w.Funcs) == 0 {
+		return input
+	}
+	w.Resolve(width)
+	var windows []*executor.Window
+	byKey := make(map[string]*executor.Window)
+	for i, fn := range w.Funcs {
+		op, ok := byKey[fn.Window()]
+		if !ok {
+			op = &executor.Window{
+				PartitionBy: fn.PartitionBy, OrderBy: fn.OrderBy,
+				Width: width + len(w.Funcs), Env: p.env, Config: p.config(),
+			}
+			byKey[fn.Window()] = op
+			windows = append(windows, op)
+		}
+		op.Funcs = append(op.Funcs, fn)
+		op.Positions = append(op.Positions, width+i)
+	}
+	plan := input
+	for _, op := range windows {
+		op.Input = plan
+		plan = op
+	}
+	return plan
+}
+
+// projection returns the relation of the select list whose output column
+// names are names. The rows of exprs are sorted by keys, and then the sort
+// keys after the select list are removed.
+func (p *planner) projection(input executor.Operator, names []string, exprs []expr.Expr, keys []executor.SortKey) *relation {
+	var plan executor.Operator = &executor.Project{Input: input, Exprs: exprs, Env: p.env}
+	if len(keys) > 0 {
+		plan = &executor.Sort{Input: plan, Keys: keys, Config: p.config()}
+	}
+	columns := make(expr.Columns, len(names))
+	for i, name := range names {
+		columns[i] = expr.ColumnInfo{Name: name, T: exprs[i].Type()}
+	}
+	if len(exprs) > len(names) {
+		plan = &executor.Project{Input: plan, Exprs: columnRefs(columns), Env: p.env}
+	}
+	return newRelation(plan, columns)
+}
+
+// columnRefs returns the references to the columns.
+func columnRefs(columns expr.Columns) []expr.Expr {
+	exprs := make([]expr.Expr, len(columns))
+	for i, c := range columns {
+		exprs[i] = &expr.Column{Index: i, Name: c.Name, T: c.T}
+	}
+	return exprs
+}
+
+// bindOrderBy binds ORDER BY clause and returns the sort keys of the rows of
+// exprs. The position in the select list and the output column name
+// reference the select item, and the other expressions are bound by b and
+// appended to exprs.
+func bindOrderBy(b *expr.Binder, names []string, exprs []expr.Expr, items []query.OrderItem) ([]executor.SortKey, []expr.Expr, error) {
+	keys := make([]executor.SortKey, len(items))
+	for i, item := range items {
+		index, err := outputPosition(names, item.Expr)
+		if err != nil {
+			return nil, nil, err
+		}
+		if index < 0 {
+			e, err := b.Bind(item.Expr)
+			if err != nil {
+				return nil, nil, err
+			}
+			index, exprs = len(exprs), append(exprs, e)
+		}
+		keys[i] = executor.SortKey{Index: index, Desc: item.Desc, NullsFirst: item.NullsFirst}
+	}
+	return keys, exprs, nil
+}
+
+// outputPosition returns the 0-origin position of the select item that the
+// expression of ORDER BY clause references by the 1-origin position or the
+// output column name, or -1 if it does not.
+func outputPosition(names []string, e query.Expr) (int, error) {
+	switch v := e.(type) {
+	case *query.Literal:
+		pos, ok := v.Value.(int64)
+		if !ok {
+			return -1, nil
+		}
+		if pos < 1 || pos > int64(len(names)) {
+			return 0, errfmt.Wrap(ErrInvalidPosition, fmt.Sprintf("ORDER BY position %d is not in select list", pos))
+		}
+		return int(pos - 1), nil
+	case *query.ColumnRef:
+		if v.Table != "" {
+			return -1, nil
+		}
+		for i, name := range names {
+			if name == v.Name {
+				return i, nil
+			}
+		}
+	}
+	return -1, nil
+}
+
+// planLimit plans LIMIT and OFFSET clauses of the relation.
+func (p *planner) planLimit(r *relation, limit, offset query.Expr) (*relation, error) {
+	if limit == nil && offset == nil {
+		return r, nil
+	}
+	l := &executor.Limit{Input: r.plan, Env: p.env}
+	b := p.binder(nil)
+	for _, v := range []struct {
+		e    query.Expr
+		dest *expr.Expr
+	}{{limit, &l.Count}, {offset, &l.Offset}} {
+		if v.e == nil {
+			continue
+		}
+		e, err := b.Bind(v.e)
+		if err != nil {
+			return nil, err
+		}
+		if *v.dest, err = expr.Coerce(e, expr.Int); err != nil {
+			return nil, err
+		}
+	}
+	r.plan = l
+	return r, nil
+}
+
+// isAggregateQuery reports whether the rows are grouped: the query has
+// GROUP BY clause, HAVING clause or the aggregate function in the select list
+// or ORDER BY clause. b knows the aggregate functions.
+func isAggregateQuery(b *expr.Binder, stmt *query.SelectStmt) bool {
+	if len(stmt.GroupBy) > 0 || stmt.Having != nil {
+		return true
+	}
+	for _, item := range stmt.OrderBy {
+		if b.HasAggregate(item.Expr) {
+			return true
+		}
+	}
+	for _, item := range stmt.Items {
+		if !item.Star && b.HasAggregate(item.Expr) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveGroupBy returns GROUP BY expressions in which the position of the
+// select list (e.g. GROUP BY 1) and the alias of the select item that is not
+// a column name are replaced with the expression of the select item.
+func resolveGroupBy(scope expr.Scope, items []query.SelectItem, groupBy []query.Expr) ([]query.Expr, error) {
+	resolved := make([]query.Expr, len(groupBy))
+	for i, e := range groupBy {
+		resolved[i] = e
+		switch v := e.(type) {
+		case *query.Literal:
+			pos, ok := v.Value.(int64)
+			if !ok {
+				continue
+			}
+			if pos < 1 || pos > int64(len(items)) {
+				return nil, errfmt.Wrap(ErrInvalidPosition, fmt.Sprintf("GROUP BY position %d is not in select list", pos))
+			}
+			resolved[i] = items[pos-1].Expr
+		case *query.ColumnRef:
+			if v.Table != "" {
+				continue
+			}
+			if _, _, err := scope.Lookup("", v.Name); err == nil {
+				continue
+			}
+			for _, item := range items {
+				if item.Alias == v.Name {
+					resolved[i] = item.Expr
+					break
+				}
+			}
+		}
+	}
+	return resolved, nil
+}
+
+// planAggregate returns the aggregation operator of the grouping.
+// The rows are grouped by the hash table unless it is disabled in the session.
+func (p *planner) planAggregate(input executor.Operator, g *expr.Grouping) executor.Operator {
+	config := p.config()
+	if p.sess.DisableHashAgg {
+		return &executor.SortAggregate{Input: input, Keys: g.Keys, Aggregates: g.Aggregates, Env: p.env, Config: config}
+	}
+	return &executor.HashAggregate{Input: input, Keys: g.Keys, Aggregates: g.Aggregates, Env: p.env, Config: config}
+}
+
+// toValues converts the rows of the table to the rows of the operator.
+func toValues(rows []storage.Row) [][]interface{} {
+	values := make([][]interface{}, len(rows))
+	for i, r := range rows {
+		values[i] = r
+	}
+	return values
+}
+
+// expandStar returns the select list in which "*" is replaced with the
+// references to the columns of the relation, and "t.*" is replaced with
+// the references to the columns of the table t.
+func expandStar(r *relation, items []query.SelectItem) ([]query.SelectItem, error) {
+	var expanded []query.SelectItem
+	for _, item := range items {
+		if !item.Star {
+			expanded = append(expanded, item)
+			continue
+		}
+		positions := r.star
+		if item.Table != "" {
+			positions = nil
+			for i, c := range r.columns {
+				if c.Table == item.Table {
+					positions = append(positions, i)
+				}
+			}
+			if len(positions) == 0 {
+				return nil, errfmt.Wrap(ErrNotExistTable, item.Table)
+			}
+		}
+		for _, p := range positions {
+			c := r.columns[p]
+			expanded = append(expanded, query.SelectItem{Expr: &query.ColumnRef{Table: c.Table, Name: c.Name}})
+		}
+	}
+	return expanded, nil
+}
+
+// bindSelectItems binds the select list, and returns the output column names
+// and the expressions. The output column name is the alias, the column name,
+// or "?column?".
+func bindSelectItems(b *expr.Binder, items []query.SelectItem) ([]string, []expr.Expr, error) {
+	names := make([]string, len(items))
+	exprs := make([]expr.Expr, len(items))
+	for i, item := range items {
+		e, err := b.Bind(item.Expr)
+		if err != nil {
+			return nil, nil, err
+		}
+		name := "?column?"
+		if ref, ok := item.Expr.(*query.ColumnRef); ok {
+			name = ref.Name
+		} else if call, ok := item.Expr.(*query.FuncCall); ok {
+			name = call.Name
+		}
+		names[i] = aliasOr(item.Alias, name)
+		exprs[i] = e
+	}
+	return names, exprs, nil
+}
+
+// scanRelation returns the scheme and the rows of the table or the system view,
+// and the table if it is not a system view. It must be called with db.mutex locked.
+func (db *EgSQLDB) scanRelation(sess *Session, name query.ObjectName) (*meta.Scheme, []storage.Row, *storage.Table, error) {
+	if meta.IsSystemSchema(name.Schema) {
+		qualified := meta.QualifiedName(name.Schema, name.Name)
+		v, ok := systemViews[qualified]
+		if !ok {
+			return nil, nil, nil, errfmt.Wrap(ErrNotExistTable, name.String())
+		}
+		return systemViewScheme(qualified, v), v.rows(db), nil, nil
+	}
+	tableName, err := db.resolveTable(sess, name)
+	if err != nil {
+		// The system view in meta.SystemSchema is also found without the schema
+		// name, after the tables in the search path.
+		if v, ok := systemViews[meta.QualifiedName(meta.SystemSchema, name.Name)]; ok && name.Schema == "" {
+			return systemViewScheme(meta.QualifiedName(meta.SystemSchema, name.Name), v), v.rows(db), nil, nil
+		}
+		return nil, nil, nil, err
+	}
+
+	t := db.tables[tableName]
+	var rows []storage.Row
+	t.Scan(func(_ int64, row storage.Row) bool {
+		rows = append(rows, row)
+		return true
+	})
+	return t.Scheme(), rows, t, nil
+}
+
+// aliasOr returns alias if it is specified, otherwise name.
+func aliasOr(alias, name string) string {
+	if alias != "" {
+		return alias
+	}
+	return name
+}
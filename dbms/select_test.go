@@ -0,0 +1,703 @@
+package dbms
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/nao1215/egsql/dbms/executor"
+	"github.com/nao1215/egsql/dbms/expr"
+	"github.com/nao1215/egsql/dbms/meta"
+	"github.com/nao1215/egsql/dbms/query"
+)
+
+func TestEgSQLDB_Select(t *testing.T) {
+	db, err := NewEgSQLDB(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sql := range []string{
+		"CREATE TABLE users (id INT PRIMARY KEY, name TEXT, age INT)",
+		"INSERT INTO users VALUES (1, 'alice', 30), (2, 'Bob', NULL), ('3', 'carol', 25)",
+	} {
+		execSQL(t, db, sql)
+	}
+
+	tests := []struct {
+		name        string
+		sql         string
+		args        []interface{}
+		wantColumns []string
+		wantRows    [][]interface{}
+		wantErr     error
+	}{
+		{
+			name:        "[Success] where with three-valued logic",
+			sql:         "SELECT id, name || ':' || age AS label, age * 2 FROM users WHERE age > 20 OR name ILIKE 'b%'",
+			wantColumns: []string{"id", "label", "?column?"},
+			wantRows: [][]interface{}{
+				{int64(1), "alice:30", int64(60)},
+				{int64(2), nil, nil},
+				{int64(3), "carol:25", int64(50)},
+			},
+		},
+		{
+			name:        "[Success] null condition filters the row",
+			sql:         "SELECT name FROM users WHERE NOT age BETWEEN 26 AND 100",
+			wantColumns: []string{"name"},
+			wantRows:    [][]interface{}{{"carol"}},
+		},
+		{
+			name:        "[Success] where with placeholder and case",
+			sql:         "SELECT CASE WHEN age IS NULL THEN 'unknown' ELSE CAST(age AS TEXT) END FROM users WHERE id IN (?, 2)",
+			args:        []interface{}{int64(1)},
+			wantColumns: []string{"?column?"},
+			wantRows:    [][]interface{}{{"30"}, {"unknown"}},
+		},
+		{
+			name:        "[Success] order by column not in select list with limit",
+			sql:         "SELECT name FROM users ORDER BY age DESC LIMIT 2",
+			wantColumns: []string{"name"},
+			wantRows:    [][]interface{}{{"Bob"}, {"alice"}},
+		},
+		{
+			name:        "[Success] order by alias and position",
+			sql:         "SELECT id, age * -1 AS neg FROM users ORDER BY neg NULLS FIRST, 1",
+			wantColumns: []string{"id", "neg"},
+			wantRows:    [][]interface{}{{int64(2), nil}, {int64(1), int64(-30)}, {int64(3), int64(-25)}},
+		},
+		{
+			name:        "[Success] order by aggregate",
+			sql:         "SELECT age IS NULL AS unknown, COUNT(*) FROM users GROUP BY 1 ORDER BY COUNT(*) DESC",
+			wantColumns: []string{"unknown", "count"},
+			wantRows:    [][]interface{}{{false, int64(2)}, {true, int64(1)}},
+		},
+		{
+			name:        "[Success] limit all with offset",
+			sql:         "SELECT id FROM users ORDER BY id LIMIT ALL OFFSET ?",
+			args:        []interface{}{int64(1)},
+			wantColumns: []string{"id"},
+			wantRows:    [][]interface{}{{int64(2)}, {int64(3)}},
+		},
+		{
+			name:    "[Error] order by position out of range",
+			sql:     "SELECT id FROM users ORDER BY 2",
+			wantErr: ErrInvalidPosition,
+		},
+		{
+			name:    "[Error] negative limit",
+			sql:     "SELECT id FROM users LIMIT -1",
+			wantErr: ErrInvalidLimit,
+		},
+		{
+			name:    "[Error] type mismatch is found before reading rows",
+			sql:     "SELECT id FROM users WHERE id = name",
+			wantErr: expr.ErrTypeMismatch,
+		},
+		{
+			name:    "[Error] where must be bool",
+			sql:     "SELECT id FROM users WHERE age",
+			wantErr: expr.ErrTypeMismatch,
+		},
+		{
+			name:    "[Error] division by zero",
+			sql:     "SELECT id / (id - 2) FROM users",
+			wantErr: expr.ErrDivisionByZero,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stmt, _, err := query.Parse(tt.sql)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rs, err := db.Exec(nil, stmt, tt.args)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Exec() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(tt.wantColumns, rs.ColumnNames); diff != "" {
+				t.Errorf("ColumnNames mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.wantRows, rs.Rows); diff != "" {
+				t.Errorf("Rows mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestEgSQLDB_SelectAggregate(t *testing.T) {
+	db, err := NewEgSQLDB(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The tiny budget makes the aggregation spill the rows to the temporary files.
+	db.workMem = 64
+	for _, sql := range []string{
+		"CREATE TABLE orders (id INT PRIMARY KEY, customer TEXT, amount INT)",
+		`INSERT INTO orders VALUES (1, 'alice', 100), (2, 'bob', 50), (3, 'alice', 300),
+			(4, 'carol', NULL), (5, 'bob', 50), (6, NULL, 10)`,
+	} {
+		if _, err := execSQL(t, db, sql); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		sql         string
+		wantColumns []string
+		wantRows    [][]interface{}
+		wantErr     error
+	}{
+		{
+			name:        "[Success] aggregate without group by",
+			sql:         "SELECT COUNT(*), COUNT(amount), SUM(amount), AVG(amount), MIN(customer), MAX(amount) FROM orders",
+			wantColumns: []string{"count", "count", "sum", "avg", "min", "max"},
+			wantRows:    [][]interface{}{{int64(6), int64(5), int64(510), int64(102), "alice", int64(300)}},
+		},
+		{
+			name:        "[Success] aggregate of no rows",
+			sql:         "SELECT COUNT(*), SUM(amount) FROM orders WHERE id > 100",
+			wantColumns: []string{"count", "sum"},
+			wantRows:    [][]interface{}{{int64(0), nil}},
+		},
+		{
+			name:        "[Success] group by with having",
+			sql:         "SELECT customer, COUNT(DISTINCT amount) AS kinds, SUM(amount) total FROM orders GROUP BY customer HAVING COUNT(*) > 1",
+			wantColumns: []string{"customer", "kinds", "total"},
+			wantRows:    [][]interface{}{{"alice", int64(2), int64(400)}, {"bob", int64(1), int64(100)}},
+		},
+		{
+			name:        "[Success] null is a group",
+			sql:         "SELECT orders.customer, MAX(amount) FROM orders WHERE amount IS NULL OR amount < 20 GROUP BY customer",
+			wantColumns: []string{"customer", "max"},
+			wantRows:    [][]interface{}{{"carol", nil}, {nil, int64(10)}},
+		},
+		{
+			name:        "[Success] group by expression, position and alias",
+			sql:         "SELECT amount / 100 AS bucket, amount > 60, COUNT(*) + 1 FROM orders GROUP BY bucket, 2",
+			wantColumns: []string{"bucket", "?column?", "?column?"},
+			wantRows: [][]interface{}{
+				{int64(1), true, int64(2)},
+				{int64(0), false, int64(4)},
+				{int64(3), true, int64(2)},
+				{nil, nil, int64(2)},
+			},
+		},
+		{
+			name:    "[Error] column not in group by",
+			sql:     "SELECT customer, amount FROM orders GROUP BY customer",
+			wantErr: expr.ErrNotGrouped,
+		},
+		{
+			name:    "[Error] star with group by",
+			sql:     "SELECT * FROM orders GROUP BY customer",
+			wantErr: expr.ErrNotGrouped,
+		},
+		{
+			name:    "[Error] aggregate in where",
+			sql:     "SELECT customer FROM orders WHERE SUM(amount) > 1",
+			wantErr: expr.ErrMisplacedAggregate,
+		},
+		{
+			name:    "[Error] nested aggregate",
+			sql:     "SELECT MAX(COUNT(*)) FROM orders",
+			wantErr: expr.ErrMisplacedAggregate,
+		},
+		{
+			name:    "[Error] sum of varchar",
+			sql:     "SELECT SUM(customer) FROM orders",
+			wantErr: expr.ErrTypeMismatch,
+		},
+		{
+			name:    "[Error] group by position out of range",
+			sql:     "SELECT customer FROM orders GROUP BY 2",
+			wantErr: ErrInvalidPosition,
+		},
+	}
+	sortRows := cmpopts.SortSlices(func(a, b []interface{}) bool { return fmt.Sprint(a) < fmt.Sprint(b) })
+	for _, hashAgg := range []string{"on", "off"} {
+		sess := NewSession()
+		querySessionSQL(t, db, sess, "SET enable_hashagg = "+hashAgg)
+		for _, tt := range tests {
+			t.Run(tt.name+" enable_hashagg="+hashAgg, func(t *testing.T) {
+				stmt, _, err := query.Parse(tt.sql)
+				if err != nil {
+					t.Fatal(err)
+				}
+				rs, err := db.Exec(sess, stmt, nil)
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Exec() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if err != nil {
+					return
+				}
+				if diff := cmp.Diff(tt.wantColumns, rs.ColumnNames); diff != "" {
+					t.Errorf("ColumnNames mismatch (-want +got):\n%s", diff)
+				}
+				if diff := cmp.Diff(tt.wantRows, rs.Rows, sortRows); diff != "" {
+					t.Errorf("Rows mismatch (-want +got):\n%s", diff)
+				}
+			})
+		}
+	}
+	files, err := os.ReadDir(filepath.Join(db.homeDir, tempDirName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Errorf("temporary files are left: %v", files)
+	}
+}
+
+// querySessionSQL parses and executes the statement in the session.
+func querySessionSQL(t *testing.T, db *EgSQLDB, sess *Session, sql string) {
+	t.Helper()
+
+	stmt, _, err := query.Parse(sql)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(sess, stmt, nil); err != nil {
+		t.Fatalf("Exec(%q) error = %v", sql, err)
+	}
+}
+
+func TestEgSQLDB_SelectJoin(t *testing.T) {
+	db, err := NewEgSQLDB(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sql := range []string{
+		"CREATE TABLE users (id INT PRIMARY KEY, name TEXT)",
+		"CREATE TABLE orders (id INT PRIMARY KEY, user_id INT, amount INT)",
+		"CREATE TABLE prefs (id INT PRIMARY KEY, color TEXT)",
+		"INSERT INTO users VALUES (1, 'alice'), (2, 'bob'), (3, 'carol')",
+		"INSERT INTO orders VALUES (10, 1, 100), (11, 1, 50), (12, 2, 70), (13, 9, 5)",
+		"INSERT INTO prefs VALUES (1, 'red'), (4, 'blue')",
+	} {
+		if _, err := execSQL(t, db, sql); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		sql         string
+		wantColumns []string
+		wantRows    [][]interface{}
+		wantErr     error
+	}{
+		{
+			name:        "[Success] inner join",
+			sql:         "SELECT u.name, o.amount FROM users u JOIN orders AS o ON u.id = o.user_id",
+			wantColumns: []string{"name", "amount"},
+			wantRows:    [][]interface{}{{"alice", int64(100)}, {"alice", int64(50)}, {"bob", int64(70)}},
+		},
+		{
+			name:        "[Success] left join keeps unmatched left rows",
+			sql:         "SELECT u.name, o.id FROM users u LEFT JOIN orders o ON o.user_id = u.id AND o.amount > 60",
+			wantColumns: []string{"name", "id"},
+			wantRows:    [][]interface{}{{"alice", int64(10)}, {"bob", int64(12)}, {"carol", nil}},
+		},
+		{
+			name:        "[Success] right join keeps unmatched right rows",
+			sql:         "SELECT u.name, o.id FROM users u RIGHT OUTER JOIN orders o ON u.id = o.user_id",
+			wantColumns: []string{"name", "id"},
+			wantRows:    [][]interface{}{{"alice", int64(10)}, {"alice", int64(11)}, {"bob", int64(12)}, {nil, int64(13)}},
+		},
+		{
+			name:        "[Success] full join using merges the column",
+			sql:         "SELECT * FROM users FULL JOIN prefs USING (id)",
+			wantColumns: []string{"id", "name", "color"},
+			wantRows: [][]interface{}{
+				{int64(1), "alice", "red"}, {int64(2), "bob", nil}, {int64(3), "carol", nil}, {int64(4), nil, "blue"},
+			},
+		},
+		{
+			name:        "[Success] natural join",
+			sql:         "SELECT * FROM users NATURAL JOIN prefs",
+			wantColumns: []string{"id", "name", "color"},
+			wantRows:    [][]interface{}{{int64(1), "alice", "red"}},
+		},
+		{
+			name:        "[Success] table star and qualified using column",
+			sql:         "SELECT prefs.*, users.id FROM users JOIN prefs USING (id)",
+			wantColumns: []string{"id", "color", "id"},
+			wantRows:    [][]interface{}{{int64(1), "red", int64(1)}},
+		},
+		{
+			name:        "[Success] cross join by comma with where",
+			sql:         "SELECT users.id, prefs.id FROM users, prefs WHERE users.id < prefs.id",
+			wantColumns: []string{"id", "id"},
+			wantRows:    [][]interface{}{{int64(1), int64(4)}, {int64(2), int64(4)}, {int64(3), int64(4)}},
+		},
+		{
+			name:        "[Success] cross join of three tables",
+			sql:         "SELECT COUNT(*) FROM users CROSS JOIN orders CROSS JOIN prefs",
+			wantColumns: []string{"count"},
+			wantRows:    [][]interface{}{{int64(24)}},
+		},
+		{
+			name:        "[Success] join by primary key index",
+			sql:         "SELECT o.id, u.name FROM orders o JOIN users u ON u.id = o.user_id",
+			wantColumns: []string{"id", "name"},
+			wantRows:    [][]interface{}{{int64(10), "alice"}, {int64(11), "alice"}, {int64(12), "bob"}},
+		},
+		{
+			name:        "[Success] left join by non-equal condition",
+			sql:         "SELECT u.name, p.color FROM users u LEFT JOIN prefs p ON p.id > u.id + 1",
+			wantColumns: []string{"name", "color"},
+			wantRows:    [][]interface{}{{"alice", "blue"}, {"bob", "blue"}, {"carol", nil}},
+		},
+		{
+			name:        "[Success] aggregate over join",
+			sql:         "SELECT u.name, SUM(o.amount) FROM users u LEFT JOIN orders o ON u.id = o.user_id GROUP BY u.name",
+			wantColumns: []string{"name", "sum"},
+			wantRows:    [][]interface{}{{"alice", int64(150)}, {"bob", int64(70)}, {"carol", nil}},
+		},
+		{
+			name:    "[Error] ambiguous column",
+			sql:     "SELECT id FROM users JOIN orders ON users.id = orders.user_id",
+			wantErr: expr.ErrAmbiguousColumn,
+		},
+		{
+			name:    "[Error] same table name twice",
+			sql:     "SELECT * FROM users, users",
+			wantErr: ErrDuplicateAlias,
+		},
+		{
+			name:    "[Error] using column does not exist",
+			sql:     "SELECT * FROM users JOIN orders USING (name)",
+			wantErr: meta.ErrNotExistColumn,
+		},
+		{
+			name:    "[Error] join condition type mismatch",
+			sql:     "SELECT * FROM users u JOIN users v ON u.id = v.name",
+			wantErr: expr.ErrTypeMismatch,
+		},
+		{
+			name:    "[Error] star of unknown table",
+			sql:     "SELECT x.* FROM users",
+			wantErr: ErrNotExistTable,
+		},
+	}
+	sortRows := cmpopts.SortSlices(func(a, b []interface{}) bool { return fmt.Sprint(a) < fmt.Sprint(b) })
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stmt, _, err := query.Parse(tt.sql)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rs, err := db.Exec(nil, stmt, nil)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Exec() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(tt.wantColumns, rs.ColumnNames); diff != "" {
+				t.Errorf("ColumnNames mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.wantRows, rs.Rows, sortRows); diff != "" {
+				t.Errorf("Rows mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestEgSQLDB_PlanJoin(t *testing.T) {
+	db, err := NewEgSQLDB(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sql := range []string{
+		"CREATE TABLE users (id INT PRIMARY KEY, name TEXT)",
+		"CREATE TABLE orders (id INT PRIMARY KEY, user_id INT, amount INT)",
+		"CREATE TABLE items (order_id INT, line INT, PRIMARY KEY (order_id, line))",
+	} {
+		if _, err := execSQL(t, db, sql); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		sql  string
+		want string
+	}{
+		{
+			name: "[Success] index of the right table",
+			sql:  "SELECT * FROM orders o JOIN users u ON o.user_id = u.id",
+			want: "*executor.IndexJoin",
+		},
+		{
+			name: "[Success] composite index",
+			sql:  "SELECT * FROM orders o LEFT JOIN items i ON i.line = 1 AND o.id = i.order_id",
+			want: "*executor.IndexJoin",
+		},
+		{
+			name: "[Success] no index on the right columns",
+			sql:  "SELECT * FROM users u JOIN orders o ON u.id = o.user_id",
+			want: "*executor.HashJoin",
+		},
+		{
+			name: "[Success] right join does not use index",
+			sql:  "SELECT * FROM orders o RIGHT JOIN users u ON o.user_id = u.id",
+			want: "*executor.HashJoin",
+		},
+		{
+			name: "[Success] not equi-join",
+			sql:  "SELECT * FROM orders o JOIN users u ON o.user_id < u.id",
+			want: "*executor.NestedLoopJoin",
+		},
+		{
+			name: "[Success] cross join",
+			sql:  "SELECT * FROM orders CROSS JOIN users",
+			want: "*executor.NestedLoopJoin",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stmt, _, err := query.Parse(tt.sql)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p := &planner{db: db, sess: NewSession(), env: &expr.Env{}}
+			from, err := p.planFrom(stmt.(*query.SelectStmt).From)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := fmt.Sprintf("%T", from.plan); got != tt.want {
+				t.Errorf("planFrom() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEgSQLDB_SelectSubquery(t *testing.T) {
+	db, err := NewEgSQLDB(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sql := range []string{
+		"CREATE TABLE users (id INT PRIMARY KEY, name TEXT)",
+		"CREATE TABLE orders (id INT PRIMARY KEY, user_id INT, amount INT)",
+		"INSERT INTO users VALUES (1, 'alice'), (2, 'bob'), (3, 'carol')",
+		"INSERT INTO orders VALUES (10, 1, 100), (11, 1, 50), (12, 2, 70), (13, NULL, 5)",
+	} {
+		if _, err := execSQL(t, db, sql); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		sql         string
+		args        []interface{}
+		wantColumns []string
+		wantRows    [][]interface{}
+		wantErr     error
+	}{
+		{
+			name:        "[Success] in subquery",
+			sql:         "SELECT name FROM users WHERE id IN (SELECT user_id FROM orders WHERE amount > ?)",
+			args:        []interface{}{int64(60)},
+			wantColumns: []string{"name"},
+			wantRows:    [][]interface{}{{"alice"}, {"bob"}},
+		},
+		{
+			name:        "[Success] not in subquery with null is unknown",
+			sql:         "SELECT name FROM users WHERE id NOT IN (SELECT user_id FROM orders)",
+			wantColumns: []string{"name"},
+		},
+		{
+			name:        "[Success] not in subquery without null",
+			sql:         "SELECT name FROM users WHERE id NOT IN (SELECT user_id FROM orders WHERE user_id IS NOT NULL)",
+			wantColumns: []string{"name"},
+			wantRows:    [][]interface{}{{"carol"}},
+		},
+		{
+			name:        "[Success] correlated exists",
+			sql:         "SELECT name FROM users u WHERE EXISTS (SELECT * FROM orders o WHERE o.user_id = u.id AND o.amount < 60)",
+			wantColumns: []string{"name"},
+			wantRows:    [][]interface{}{{"alice"}},
+		},
+		{
+			name:        "[Success] correlated not exists",
+			sql:         "SELECT name FROM users WHERE NOT EXISTS (SELECT 1 FROM orders WHERE user_id = users.id)",
+			wantColumns: []string{"name"},
+			wantRows:    [][]interface{}{{"carol"}},
+		},
+		{
+			name:        "[Success] correlated exists with non-equal condition",
+			sql:         "SELECT name FROM users u WHERE EXISTS (SELECT * FROM orders o WHERE o.user_id > u.id)",
+			wantColumns: []string{"name"},
+			wantRows:    [][]interface{}{{"alice"}},
+		},
+		{
+			name:        "[Success] uncorrelated exists",
+			sql:         "SELECT COUNT(*) FROM users WHERE EXISTS (SELECT * FROM orders WHERE amount > 1000)",
+			wantColumns: []string{"count"},
+			wantRows:    [][]interface{}{{int64(0)}},
+		},
+		{
+			name:        "[Success] correlated scalar subquery in select list",
+			sql:         "SELECT name, (SELECT SUM(amount) FROM orders WHERE user_id = u.id) AS total FROM users u",
+			wantColumns: []string{"name", "total"},
+			wantRows:    [][]interface{}{{"alice", int64(150)}, {"bob", int64(70)}, {"carol", nil}},
+		},
+		{
+			name:        "[Success] scalar subquery references the outer query of two levels",
+			sql:         "SELECT name FROM users u WHERE (SELECT COUNT(*) FROM orders o WHERE EXISTS (SELECT 1 FROM users v WHERE v.id = o.user_id AND v.id = u.id)) = 2",
+			wantColumns: []string{"name"},
+			wantRows:    [][]interface{}{{"alice"}},
+		},
+		{
+			name:        "[Success] subquery references the grouped column",
+			sql:         "SELECT user_id, (SELECT name FROM users WHERE id = user_id) FROM orders GROUP BY user_id HAVING COUNT(*) > 1",
+			wantColumns: []string{"user_id", "?column?"},
+			wantRows:    [][]interface{}{{int64(1), "alice"}},
+		},
+		{
+			name:        "[Success] derived table",
+			sql:         "SELECT t.name, t.total FROM (SELECT u.name, SUM(o.amount) AS total FROM users u JOIN orders o ON o.user_id = u.id GROUP BY u.name) AS t WHERE t.total > 100",
+			wantColumns: []string{"name", "total"},
+			wantRows:    [][]interface{}{{"alice", int64(150)}},
+		},
+		{
+			name:        "[Success] join with derived table",
+			sql:         "SELECT * FROM users JOIN (SELECT user_id AS id, COUNT(*) AS n FROM orders GROUP BY user_id) c USING (id)",
+			wantColumns: []string{"id", "name", "n"},
+			wantRows:    [][]interface{}{{int64(1), "alice", int64(2)}, {int64(2), "bob", int64(1)}},
+		},
+		{
+			name:    "[Error] scalar subquery returns more than one row",
+			sql:     "SELECT (SELECT id FROM orders) FROM users",
+			wantErr: expr.ErrSubqueryRows,
+		},
+		{
+			name:    "[Error] scalar subquery returns more than one column",
+			sql:     "SELECT (SELECT id, amount FROM orders WHERE id = 10)",
+			wantErr: expr.ErrSubqueryColumns,
+		},
+		{
+			name:    "[Error] in subquery type mismatch",
+			sql:     "SELECT id FROM users WHERE name IN (SELECT id FROM orders)",
+			wantErr: expr.ErrTypeMismatch,
+		},
+		{
+			name:    "[Error] unknown column in subquery",
+			sql:     "SELECT id FROM users WHERE EXISTS (SELECT * FROM orders WHERE x = 1)",
+			wantErr: meta.ErrNotExistColumn,
+		},
+	}
+	sortRows := cmpopts.SortSlices(func(a, b []interface{}) bool { return fmt.Sprint(a) < fmt.Sprint(b) })
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stmt, _, err := query.Parse(tt.sql)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rs, err := db.Exec(nil, stmt, tt.args)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Exec() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(tt.wantColumns, rs.ColumnNames); diff != "" {
+				t.Errorf("ColumnNames mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.wantRows, rs.Rows, sortRows); diff != "" {
+				t.Errorf("Rows mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestEgSQLDB_PlanSemiJoin(t *testing.T) {
+	db, err := NewEgSQLDB(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sql := range []string{
+		"CREATE TABLE users (id INT PRIMARY KEY, name TEXT)",
+		"CREATE TABLE orders (id INT PRIMARY KEY, user_id INT, amount INT)",
+	} {
+		if _, err := execSQL(t, db, sql); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		sql      string
+		wantSemi bool
+		wantAnti bool
+	}{
+		{
+			name:     "[Success] correlated exists",
+			sql:      "SELECT * FROM users u WHERE EXISTS (SELECT * FROM orders o WHERE o.user_id = u.id AND o.amount > 1)",
+			wantSemi: true,
+		},
+		{
+			name:     "[Success] correlated not exists",
+			sql:      "SELECT * FROM users u WHERE u.id > 1 AND NOT EXISTS (SELECT * FROM orders o WHERE u.id = o.user_id)",
+			wantSemi: true,
+			wantAnti: true,
+		},
+		{
+			name: "[Success] uncorrelated exists is not decorrelated",
+			sql:  "SELECT * FROM users u WHERE EXISTS (SELECT * FROM orders o WHERE o.amount > 1)",
+		},
+		{
+			name: "[Success] non-equal correlation is not decorrelated",
+			sql:  "SELECT * FROM users u WHERE EXISTS (SELECT * FROM orders o WHERE o.user_id < u.id)",
+		},
+		{
+			name: "[Success] exists in or is not decorrelated",
+			sql:  "SELECT * FROM users u WHERE u.id = 1 OR EXISTS (SELECT * FROM orders o WHERE o.user_id = u.id)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stmt, _, err := query.Parse(tt.sql)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p := &planner{db: db, sess: NewSession(), env: &expr.Env{}}
+			r, err := p.planSelect(stmt.(*query.SelectStmt))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var semi *executor.SemiJoin
+			for op := r.plan; op != nil; {
+				switch v := op.(type) {
+				case *executor.Project:
+					op = v.Input
+				case *executor.Filter:
+					op = v.Input
+				case *executor.SemiJoin:
+					semi = v
+					op = nil
+				default:
+					op = nil
+				}
+			}
+			if (semi != nil) != tt.wantSemi {
+				t.Fatalf("semi join is planned = %v, want %v", semi != nil, tt.wantSemi)
+			}
+			if semi != nil && semi.Anti != tt.wantAnti {
+				t.Errorf("Anti = %v, want %v", semi.Anti, tt.wantAnti)
+			}
+		})
+	}
+}
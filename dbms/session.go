@@ -0,0 +1,201 @@
+package dbms
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/nao1215/egsql/dbms/meta"
+	"github.com/nao1215/egsql/dbms/query"
+	"github.com/nao1215/egsql/misc/errfmt"
+)
+
+// Session is the state of a connection to the database.
+type Session struct {
+	// Tx is the transaction in progress. It is nil in auto-commit mode.
+	Tx *Tx
+	// SearchPath is the schemas searched in order for the table or sequence
+	// whose name is not qualified with the schema name. The table or sequence
+	// is created in the first existing schema of it.
+	SearchPath []string
+	// DisableHashAgg is a flag indicating whether the rows are grouped by
+	// sorting them instead of the hash table (SET enable_hashagg = off).
+	DisableHashAgg bool
+	// MaxRecursionDepth is the maximum number of the iterations of the
+	// recursive query (SET max_recursion_depth = n). 0 means no limit.
+	MaxRecursionDepth int
+	// WorkMem is the bytes of the rows that an operator of the query keeps
+	// in memory before it writes them to the temporary files (SET work_mem =
+	// '4MB'). 0 means the default of the database.
+	WorkMem int64
+}
+
+// DefaultMaxRecursionDepth is the default maximum number of the iterations
+// of the recursive query.
+const DefaultMaxRecursionDepth = 1000
+
+// NewSession returns the session in auto-commit mode whose search path
+// is the specified schemas. If no schema is specified, the search path is
+// meta.DefaultSchema.
+func NewSession(searchPath ...string) *Session {
+	if len(searchPath) == 0 {
+		searchPath = []string{meta.DefaultSchema}
+	}
+	return &Session{SearchPath: searchPath, MaxRecursionDepth: DefaultMaxRecursionDepth}
+}
+
+// settings returns the copy of the settings of the session, without the
+// transaction. The plan cache compares them to find the plan bound with them.
+func (s *Session) settings() *Session {
+	c := *s
+	c.Tx = nil
+	c.SearchPath = append([]string(nil), s.SearchPath...)
+	return &c
+}
+
+// resolveTable returns the name of the existing table in the catalog.
+// The system views can not be resolved by it because they are read-only;
+// they are resolved by scanRelation.
+func (db *EgSQLDB) resolveTable(sess *Session, name query.ObjectName) (string, error) {
+	if meta.IsSystemSchema(name.Schema) {
+		return "", errfmt.Wrap(ErrSystemSchema, name.String())
+	}
+	if name.Schema != "" {
+		if !db.catalog.HasSchema(name.Schema) {
+			return "", errfmt.Wrap(ErrNotExistSchema, name.Schema)
+		}
+		qualified := meta.QualifiedName(name.Schema, name.Name)
+		if !db.catalog.HasScheme(qualified) {
+			return "", errfmt.Wrap(ErrNotExistTable, name.String())
+		}
+		return qualified, nil
+	}
+	for _, schema := range sess.SearchPath {
+		if qualified := meta.QualifiedName(schema, name.Name); db.catalog.HasScheme(qualified) {
+			return qualified, nil
+		}
+	}
+	return "", errfmt.Wrap(ErrNotExistTable, name.Name)
+}
+
+// resolveSequence returns the name of the sequence in the catalog.
+// text is the argument of nextval() like "schema.name", which follows
+// the identifier rules of SQL. If the sequence is not found in the search
+// path, the name in the first schema is returned.
+func (db *EgSQLDB) resolveSequence(sess *Session, text string) (string, error) {
+	name, err := query.ParseObjectName(text)
+	if err != nil {
+		return "", err
+	}
+	if name.Schema != "" {
+		return meta.QualifiedName(name.Schema, name.Name), nil
+	}
+	for _, schema := range sess.SearchPath {
+		if qualified := meta.QualifiedName(schema, name.Name); db.catalog.HasSequence(qualified) {
+			return qualified, nil
+		}
+	}
+	return name.Name, nil
+}
+
+// newName returns the name in the catalog of the table or sequence to be created.
+// If the name is not qualified, the first existing schema in the search path is used.
+func (db *EgSQLDB) newName(sess *Session, name query.ObjectName) (string, error) {
+	if meta.IsSystemSchema(name.Schema) {
+		return "", errfmt.Wrap(ErrSystemSchema, name.String())
+	}
+	if name.Schema != "" {
+		if !db.catalog.HasSchema(name.Schema) {
+			return "", errfmt.Wrap(ErrNotExistSchema, name.Schema)
+		}
+		return meta.QualifiedName(name.Schema, name.Name), nil
+	}
+	for _, schema := range sess.SearchPath {
+		if db.catalog.HasSchema(schema) {
+			return meta.QualifiedName(schema, name.Name), nil
+		}
+	}
+	return "", errfmt.Wrap(ErrNotExistSchema, "no schema in search_path exists")
+}
+
+// execSet executes SET statement. search_path, enable_hashagg,
+// max_recursion_depth and work_mem are supported.
+func execSet(sess *Session, stmt *query.SetStmt) (*meta.ResultSet, error) {
+	switch stmt.Name {
+	case "search_path":
+		sess.SearchPath = append([]string{}, stmt.Values...)
+	case "enable_hashagg":
+		on, err := settingBool(stmt)
+		if err != nil {
+			return nil, err
+		}
+		sess.DisableHashAgg = !on
+	case "max_recursion_depth":
+		n, err := settingInt(stmt)
+		if err != nil {
+			return nil, err
+		}
+		sess.MaxRecursionDepth = n
+	case "work_mem":
+		if len(stmt.Values) != 1 {
+			return nil, errfmt.Wrap(ErrInvalidSetting, stmt.Name+" must be a size like 4MB")
+		}
+		n, err := ParseWorkMem(stmt.Values[0])
+		if err != nil {
+			return nil, err
+		}
+		sess.WorkMem = n
+	default:
+		return nil, errfmt.Wrap(ErrNotSupportedSetting, stmt.Name)
+	}
+	return meta.NewResultSet("SET"), nil
+}
+
+// settingBool returns the boolean value of the setting: on, off, true or false.
+func settingBool(stmt *query.SetStmt) (bool, error) {
+	if len(stmt.Values) == 1 {
+		switch strings.ToLower(stmt.Values[0]) {
+		case "on", "true":
+			return true, nil
+		case "off", "false":
+			return false, nil
+		}
+	}
+	return false, errfmt.Wrap(ErrInvalidSetting, stmt.Name+" must be on or off")
+}
+
+// settingInt returns the non-negative integer value of the setting.
+func settingInt(stmt *query.SetStmt) (int, error) {
+	if len(stmt.Values) == 1 {
+		if n, err := strconv.Atoi(stmt.Values[0]); err == nil && n >= 0 {
+			return n, nil
+		}
+	}
+	return 0, errfmt.Wrap(ErrInvalidSetting, stmt.Name+" must be a non-negative integer")
+}
+
+// workMemUnits is the units of work_mem.
+var workMemUnits = []struct {
+	suffix string
+	bytes  int64
+}{
+	{"kB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30}, {"B", 1},
+}
+
+// ParseWorkMem parses the value of work_mem: the positive number of bytes
+// followed by the unit B, kB, MB or GB. The number without the unit is in kB,
+// as in PostgreSQL.
+func ParseWorkMem(value string) (int64, error) {
+	s, unit := strings.TrimSpace(value), int64(1<<10)
+	for _, u := range workMemUnits {
+		if strings.HasSuffix(s, u.suffix) {
+			s, unit = strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), u.bytes
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n <= 0 || n > math.MaxInt64/unit {
+		return 0, errfmt.Wrap(ErrInvalidSetting, "work_mem must be a positive size like 4MB: "+value)
+	}
+	return n * unit, nil
+}
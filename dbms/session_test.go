@@ -0,0 +1,35 @@
+package dbms
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseWorkMem(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    int64
+		wantErr error
+	}{
+		{name: "[Success] kB without unit", value: "64", want: 64 << 10},
+		{name: "[Success] bytes", value: "512B", want: 512},
+		{name: "[Success] kB", value: "64kB", want: 64 << 10},
+		{name: "[Success] MB with space", value: "4 MB", want: 4 << 20},
+		{name: "[Success] GB", value: "1GB", want: 1 << 30},
+		{name: "[Error] zero", value: "0", wantErr: ErrInvalidSetting},
+		{name: "[Error] unknown unit", value: "4TB", wantErr: ErrInvalidSetting},
+		{name: "[Error] overflow", value: "9223372036854775807GB", wantErr: ErrInvalidSetting},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseWorkMem(tt.value)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParseWorkMem(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseWorkMem(%q) = %d, want %d", tt.value, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package dbms
+
+import (
+	"fmt"
+
+	"github.com/nao1215/egsql/dbms/executor"
+	"github.com/nao1215/egsql/dbms/expr"
+	"github.com/nao1215/egsql/dbms/query"
+	"github.com/nao1215/egsql/misc/errfmt"
+)
+
+// planSetOperation plans the set operation of the queries. The column names
+// are the names of the left query.
+func (p *planner) planSetOperation(op *query.SetOperation) (*relation, error) {
+	left, err := p.planSelect(op.Left)
+	if err != nil {
+		return nil, err
+	}
+	right, err := p.planSelect(op.Right)
+	if err != nil {
+		return nil, err
+	}
+	columns, err := p.unifyColumns(left, right)
+	if err != nil {
+		return nil, err
+	}
+	return newRelation(p.setOperator(op, left.plan, right.plan, len(columns)), columns), nil
+}
+
+// setOperator returns the operator of the set operation. The duplicate rows
+// are removed by the hash table unless it is disabled in the session, in
+// which case the rows are sorted.
+func (p *planner) setOperator(op *query.SetOperation, left, right executor.Operator, width int) executor.Operator {
+	if op.Op == query.Union && op.All {
+		return &executor.Union{Left: left, Right: right, All: true}
+	}
+	typ := map[query.SetOpType]executor.SetOpType{
+		query.Union: executor.SetUnion, query.Intersect: executor.SetIntersect, query.Except: executor.SetExcept,
+	}[op.Op]
+	switch {
+	case p.sess.DisableHashAgg:
+		return &executor.SortSetOp{
+			Left: left, Right: right, Op: typ, All: op.All, Width: width, Config: p.config(),
+		}
+	case op.Op == query.Union:
+		return &executor.Union{Left: left, Right: right}
+	}
+	return &executor.HashSetOp{Left: left, Right: right, Op: typ, All: op.All}
+}
+
+// planSortedSetOperation plans ORDER BY clause of the set operation, which
+// references the columns of the result.
+func (p *planner) planSortedSetOperation(r *relation, items []query.OrderItem) (*relation, error) {
+	if len(items) == 0 {
+		return r, nil
+	}
+	names := make([]string, len(r.columns))
+	for i, c := range r.columns {
+		names[i] = c.Name
+	}
+	keys, exprs, err := bindOrderBy(p.binder(r.columns), names, columnRefs(r.columns), items)
+	if err != nil {
+		return nil, err
+	}
+	return p.projection(r.plan, names, exprs, keys), nil
+}
+
+// unifyColumns returns the columns of the set operation of the relations,
+// and converts the columns of both sides to the same types. The column of
+// unknown type (NULL) takes the type of the other side.
+func (p *planner) unifyColumns(left, right *relation) (expr.Columns, error) {
+	if len(left.columns) != len(right.columns) {
+		return nil, errfmt.Wrap(ErrColumnCount,
+			fmt.Sprintf("each query of the set operation must have the same number of columns: %d and %d",
+				len(left.columns), len(right.columns)))
+	}
+	columns := make(expr.Columns, len(left.columns))
+	for i, c := range left.columns {
+		columns[i] = expr.ColumnInfo{Name: c.Name, T: c.T}
+		if c.T == expr.Unknown {
+			columns[i].T = right.columns[i].T
+		}
+	}
+	if err := p.coerceRelation(left, columns); err != nil {
+		return nil, err
+	}
+	if err := p.coerceRelation(right, columns); err != nil {
+		return nil, err
+	}
+	return columns, nil
+}
+
+// coerceRelation converts the columns of the relation to the types of columns.
+func (p *planner) coerceRelation(r *relation, columns expr.Columns) error {
+	exprs := make([]expr.Expr, len(r.columns))
+	cast := false
+	for i, c := range r.columns {
+		col := &expr.Column{Index: i, Name: c.Name, T: c.T}
+		e, err := expr.Coerce(col, columns[i].T)
+		if err != nil {
+			return err
+		}
+		exprs[i] = e
+		cast = cast || e != expr.Expr(col)
+	}
+	if cast {
+		r.plan = &executor.Project{Input: r.plan, Exprs: exprs, Env: p.env}
+	}
+	return nil
+}
+
+// newRelation returns the relation of the plan whose columns are columns,
+// all of which "*" is expanded to.
+func newRelation(plan executor.Operator, columns expr.Columns) *relation {
+	r := &relation{plan: plan, columns: columns}
+	for i := range columns {
+		r.star = append(r.star, i)
+	}
+	return r
+}
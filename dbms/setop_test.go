@@ -0,0 +1,129 @@
+package dbms
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nao1215/egsql/dbms/expr"
+	"github.com/nao1215/egsql/dbms/meta"
+	"github.com/nao1215/egsql/dbms/query"
+)
+
+func TestEgSQLDB_SelectSetOperation(t *testing.T) {
+	db, err := NewEgSQLDB(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sql := range []string{
+		"CREATE TABLE a (id INT PRIMARY KEY, v INT, name TEXT)",
+		"CREATE TABLE b (id INT PRIMARY KEY, v INT, name TEXT)",
+		"INSERT INTO a VALUES (1, 1, 'x'), (2, 1, 'x'), (3, 2, 'y'), (4, NULL, 'z'), (5, 3, 'w')",
+		"INSERT INTO b VALUES (1, 1, 'x'), (2, 2, 'y'), (3, 2, 'y'), (4, NULL, 'z')",
+	} {
+		if _, err := execSQL(t, db, sql); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		sql         string
+		args        []interface{}
+		wantColumns []string
+		wantRows    [][]interface{}
+		wantErr     error
+	}{
+		{
+			name:        "[Success] union",
+			sql:         "SELECT v, name FROM a UNION SELECT v, name FROM b ORDER BY v",
+			wantColumns: []string{"v", "name"},
+			wantRows:    [][]interface{}{{int64(1), "x"}, {int64(2), "y"}, {int64(3), "w"}, {nil, "z"}},
+		},
+		{
+			name:        "[Success] union all",
+			sql:         "SELECT v FROM a UNION ALL SELECT v FROM b ORDER BY 1 DESC NULLS LAST",
+			wantColumns: []string{"v"},
+			wantRows: [][]interface{}{
+				{int64(3)}, {int64(2)}, {int64(2)}, {int64(2)}, {int64(1)}, {int64(1)}, {int64(1)}, {nil}, {nil},
+			},
+		},
+		{
+			name:        "[Success] intersect",
+			sql:         "SELECT v, name FROM a INTERSECT SELECT v, name FROM b ORDER BY name",
+			wantColumns: []string{"v", "name"},
+			wantRows:    [][]interface{}{{int64(1), "x"}, {int64(2), "y"}, {nil, "z"}},
+		},
+		{
+			name:        "[Success] intersect all",
+			sql:         "SELECT v FROM a INTERSECT ALL SELECT v FROM b ORDER BY v NULLS FIRST",
+			wantColumns: []string{"v"},
+			wantRows:    [][]interface{}{{nil}, {int64(1)}, {int64(2)}},
+		},
+		{
+			name:        "[Success] except",
+			sql:         "SELECT name FROM a EXCEPT SELECT name FROM b",
+			wantColumns: []string{"name"},
+			wantRows:    [][]interface{}{{"w"}},
+		},
+		{
+			name:        "[Success] except all",
+			sql:         "SELECT v AS value FROM a EXCEPT ALL SELECT v FROM b ORDER BY value",
+			wantColumns: []string{"value"},
+			wantRows:    [][]interface{}{{int64(1)}, {int64(3)}},
+		},
+		{
+			name:        "[Success] intersect binds more tightly than union",
+			sql:         "SELECT 5 UNION SELECT v FROM a INTERSECT SELECT v FROM b ORDER BY 1 LIMIT 3",
+			wantColumns: []string{"?column?"},
+			wantRows:    [][]interface{}{{int64(1)}, {int64(2)}, {int64(5)}},
+		},
+		{
+			name:        "[Success] order by expression of output column with limit and offset",
+			sql:         "(SELECT id FROM a UNION SELECT id + 10 FROM b) ORDER BY id % 10, id DESC LIMIT ? OFFSET ?",
+			args:        []interface{}{int64(3), int64(1)},
+			wantColumns: []string{"id"},
+			wantRows:    [][]interface{}{{int64(1)}, {int64(12)}, {int64(2)}},
+		},
+		{
+			name:    "[Error] order by column that is not in the result",
+			sql:     "SELECT v FROM a UNION SELECT v FROM b ORDER BY id",
+			wantErr: meta.ErrNotExistColumn,
+		},
+		{
+			name:    "[Error] different number of columns",
+			sql:     "SELECT v FROM a EXCEPT SELECT v, name FROM b",
+			wantErr: ErrColumnCount,
+		},
+		{
+			name:    "[Error] different types",
+			sql:     "SELECT v FROM a INTERSECT SELECT name FROM b",
+			wantErr: expr.ErrTypeMismatch,
+		},
+	}
+	for _, hashAgg := range []string{"on", "off"} {
+		sess := NewSession()
+		querySessionSQL(t, db, sess, "SET enable_hashagg = "+hashAgg)
+		for _, tt := range tests {
+			t.Run(tt.name+" enable_hashagg="+hashAgg, func(t *testing.T) {
+				stmt, _, err := query.Parse(tt.sql)
+				if err != nil {
+					t.Fatal(err)
+				}
+				rs, err := db.Exec(sess, stmt, tt.args)
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Exec() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if err != nil {
+					return
+				}
+				if diff := cmp.Diff(tt.wantColumns, rs.ColumnNames); diff != "" {
+					t.Errorf("ColumnNames mismatch (-want +got):\n%s", diff)
+				}
+				if diff := cmp.Diff(tt.wantRows, rs.Rows); diff != "" {
+					t.Errorf("Rows mismatch (-want +got):\n%s", diff)
+				}
+			})
+		}
+	}
+}
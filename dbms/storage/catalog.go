@@ -1,9 +1,10 @@
 package storage
 
 import (
-	"encoding/json"
+	"errors"
+	"io/fs"
 	"io/ioutil"
-	"path"
+	"os"
 	"path/filepath"
 	"sync"
 
@@ -11,65 +12,312 @@ import (
 	"github.com/nao1215/egsql/misc/errfmt"
 )
 
-// jsonMarshal is a variable used to change json.Marshal to a stub at test time.
-var jsonMarshal = json.Marshal
-
 // catalogName os catlog file name.
 const catalogName = "catalog.db"
 
+// backupName is the file name of the previous generation of the catalog file.
+const backupName = catalogName + ".bak"
+
 // Catalog is the top-level structure for data storage.
 // Data storage is organized in units of catalogs, schemas, and tables, in order from top to bottom
 type Catalog struct {
-	Schemes []*meta.Scheme
-	mutex   *sync.RWMutex
+	// Schemas is the names of the schemas created by CREATE SCHEMA.
+	// meta.DefaultSchema always exists and is not included.
+	Schemas   []string `json:"Schemas,omitempty"`
+	Schemes   []*meta.Scheme
+	Sequences []*meta.Sequence `json:"Sequences,omitempty"`
+	// Stats is the statistics of the tables collected by ANALYZE.
+	Stats []*meta.TableStats `json:"Stats,omitempty"`
+	// schemeIndex is the index of Schemes. Key is table name.
+	schemeIndex map[string]*meta.Scheme
+	// sequenceIndex is the index of Sequences. Key is sequence name.
+	sequenceIndex map[string]*meta.Sequence
+	// statsIndex is the index of Stats. Key is table name.
+	statsIndex map[string]*meta.TableStats
+	// legacy is a flag indicating whether the catalog is read from the legacy json file.
+	legacy bool
+	// recovered is a flag indicating whether the catalog is read from the backup
+	// because the catalog file is corrupt or missing.
+	recovered bool
+	mutex     *sync.RWMutex
 }
 
 // NewEmtpyCatalog return Catalog pointer. Only setup mutex, not setup any schema.
 func NewEmtpyCatalog() *Catalog {
-	return &Catalog{
+	c := &Catalog{
 		mutex: &sync.RWMutex{},
 	}
+	c.buildIndex()
+	return c
+}
+
+// buildIndex builds the indexes of the schemes and sequences by name.
+// The names are compared exactly; the identifiers in SQL are folded
+// before they are looked up (see query.Tokenize).
+func (c *Catalog) buildIndex() {
+	c.schemeIndex = make(map[string]*meta.Scheme, len(c.Schemes))
+	for _, s := range c.Schemes {
+		c.schemeIndex[s.TableName] = s
+	}
+	c.sequenceIndex = make(map[string]*meta.Sequence, len(c.Sequences))
+	for _, s := range c.Sequences {
+		c.sequenceIndex[s.Name] = s
+	}
+	c.statsIndex = make(map[string]*meta.TableStats, len(c.Stats))
+	for _, s := range c.Stats {
+		c.statsIndex[s.TableName] = s
+	}
+}
+
+// Copy returns a copy of the catalog that has the same schemas, schemes,
+// sequences and statistics. Adding to or removing from the copy does not change c, so it
+// is used to persist the changed catalog before changing c.
+func (c *Catalog) Copy() *Catalog {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	copied := &Catalog{
+		Schemas:   append([]string{}, c.Schemas...),
+		Schemes:   append([]*meta.Scheme{}, c.Schemes...),
+		Sequences: append([]*meta.Sequence{}, c.Sequences...),
+		Stats:     append([]*meta.TableStats{}, c.Stats...),
+		mutex:     &sync.RWMutex{},
+	}
+	copied.buildIndex()
+	return copied
 }
 
 // LoadCatalog reads a catalog file and returns its contents as a Catalog pointer.
-// If the catalog file does not exist, a new empty catalog pointer is returned.
+// If the catalog file is corrupt or missing, the backup (the previous generation
+// saved by SaveCatalog) is read instead, and the catalog is marked as Recovered.
+// If neither exists, a new empty catalog pointer is returned.
+// If the catalog file can not be read, or both the catalog file and the backup
+// are corrupt, an error is returned instead of the empty catalog, so that
+// the existing tables do not vanish.
 func LoadCatalog(egsqlHomePath string) (*Catalog, error) {
-	b, err := ioutil.ReadFile(path.Join(egsqlHomePath, catalogName))
+	catalog, err := readCatalog(filepath.Join(egsqlHomePath, catalogName))
+	if err != nil && recoverable(err) {
+		backup, backupErr := readCatalog(filepath.Join(egsqlHomePath, backupName))
+		if backupErr == nil {
+			backup.recovered = true
+			catalog, err = backup, nil
+		} else if errors.Is(err, fs.ErrNotExist) && errors.Is(backupErr, fs.ErrNotExist) {
+			catalog, err = NewEmtpyCatalog(), nil
+		}
+	}
 	if err != nil {
-		return NewEmtpyCatalog(), nil
+		if errors.Is(err, fs.ErrNotExist) {
+			// The catalog file is missing, and the backup exists but is broken.
+			return nil, errfmt.Wrap(ErrCorruptCatalogFile, "catalog file is missing and backup is corrupt")
+		}
+		return nil, err
 	}
+	return catalog, nil
+}
 
-	var catalog Catalog
-	err = json.Unmarshal(b, &catalog)
+// readCatalog reads the catalog from the file. If the file does not exist,
+// the error wrapping fs.ErrNotExist is returned.
+func readCatalog(name string) (*Catalog, error) {
+	b, err := ioutil.ReadFile(name)
 	if err != nil {
-		return nil, errfmt.Wrap(ErrParseCatalogFile, err.Error())
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		return nil, errfmt.Wrap(ErrReadCatalogFile, err.Error())
 	}
 
+	catalog, err := decodeCatalog(b)
+	if err != nil {
+		return nil, err
+	}
 	catalog.mutex = &sync.RWMutex{}
-	return &catalog, nil
+	catalog.buildIndex()
+	return catalog, nil
+}
+
+// recoverable reports whether the catalog can be read from the backup
+// when reading the catalog file fails with err. The catalog written by
+// the newer version is not recovered, because the backup is older than it.
+func recoverable(err error) bool {
+	return errors.Is(err, fs.ErrNotExist) ||
+		errors.Is(err, ErrCorruptCatalogFile) ||
+		errors.Is(err, ErrParseCatalogFile)
+}
+
+// NeedsUpgrade reports whether the catalog is read from the legacy json
+// catalog file. Saving the catalog upgrades the file to the current format.
+func (c *Catalog) NeedsUpgrade() bool {
+	return c.legacy
+}
+
+// Recovered reports whether the catalog is read from the backup because
+// the catalog file is corrupt or missing. Saving the catalog repairs the file.
+func (c *Catalog) Recovered() bool {
+	return c.recovered
 }
 
 // SaveCatalog persists the system catalog as `catalog.db`.
-// `catalog.db` has a simple json format like key/value.
+// `catalog.db` is the binary format with the magic number, the format version
+// and the checksum (see catalog_format.go).
+//
+// The current `catalog.db` is kept as `catalog.db.bak` if it is valid, and
+// each file is written to the temporary file, fsynced, renamed and then the
+// directory is fsynced, so that the catalog file is either the old one or
+// the new one after a crash or a full disk.
 func SaveCatalog(egsqlHomePath string, c *Catalog) (err error) {
-	jsonStr, err := jsonMarshal(c)
+	b, err := encodeCatalog(c)
 	if err != nil {
 		return errfmt.Wrap(ErrSaveCatalogFile, err.Error())
 	}
 
-	err = ioutil.WriteFile(filepath.Join(egsqlHomePath, catalogName), jsonStr, 0644)
-	if err != nil {
+	primary := filepath.Join(egsqlHomePath, catalogName)
+	if old, err := ioutil.ReadFile(primary); err == nil {
+		// The corrupt catalog file does not overwrite the valid backup.
+		if _, err := decodeCatalog(old); err == nil {
+			if err := writeFileSync(filepath.Join(egsqlHomePath, backupName), old); err != nil {
+				return errfmt.Wrap(ErrSaveCatalogFile, err.Error())
+			}
+		}
+	}
+	if err := writeFileSync(primary, b); err != nil {
 		return errfmt.Wrap(ErrSaveCatalogFile, err.Error())
 	}
 	return nil
 }
 
+// writeFileSync replaces the file with b atomically and durably: b is written
+// to the temporary file, fsynced, renamed over the file and then the directory
+// is fsynced to persist the rename.
+func writeFileSync(name string, b []byte) error {
+	tmp := name + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		_ = f.Close()
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return syncDir(filepath.Dir(name))
+}
+
+// syncDir fsyncs the directory to persist the entries created or renamed in it.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// AddSchema is to add the new schema into a memory.
+// Be careful not to persist the disk.
+func (c *Catalog) AddSchema(name string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.Schemas = append(c.Schemas, name)
+}
+
+// HasSchema returns whether the schema with the specified name exists.
+func (c *Catalog) HasSchema(name string) bool {
+	if name == meta.DefaultSchema {
+		return true
+	}
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	for _, s := range c.Schemas {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+// RemoveSchema removes the schema with the specified name from a memory.
+// The tables and sequences in the schema are not removed.
+// If no schema exists, false is returned.
+// Be careful not to persist the disk.
+func (c *Catalog) RemoveSchema(name string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for i, s := range c.Schemas {
+		if s == name {
+			c.Schemas = append(c.Schemas[:i:i], c.Schemas[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
 // Add is to add the new scheme into a memory.
 // Be careful not to persist the disk.
 func (c *Catalog) Add(scheme *meta.Scheme) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 	c.Schemes = append(c.Schemes, scheme)
+	c.schemeIndex[scheme.TableName] = scheme
+}
+
+// Replace replaces the scheme with the specified table name with the scheme
+// in a memory, keeping its position. It is used to change the scheme by
+// ALTER TABLE. If no schema exists, false is returned.
+// Be careful not to persist the disk.
+func (c *Catalog) Replace(tableName string, scheme *meta.Scheme) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	old, ok := c.schemeIndex[tableName]
+	if !ok {
+		return false
+	}
+	for i, s := range c.Schemes {
+		if s == old {
+			c.Schemes[i] = scheme
+		}
+	}
+	delete(c.schemeIndex, tableName)
+	c.schemeIndex[scheme.TableName] = scheme
+	c.removeStats(tableName)
+	return true
+}
+
+// Remove removes the scheme with the specified table name from a memory.
+// If no schema exists, false is returned.
+// Be careful not to persist the disk.
+func (c *Catalog) Remove(tableName string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	old, ok := c.schemeIndex[tableName]
+	if !ok {
+		return false
+	}
+	for i, s := range c.Schemes {
+		if s == old {
+			c.Schemes = append(c.Schemes[:i:i], c.Schemes[i+1:]...)
+			break
+		}
+	}
+	delete(c.schemeIndex, tableName)
+	c.removeStats(tableName)
+	return true
 }
 
 // HasScheme returns whether a schema with the specified table name exists.
@@ -82,12 +330,123 @@ func (c *Catalog) HasScheme(tableName string) bool {
 func (c *Catalog) FetchScheme(tableName string) *meta.Scheme {
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
+	return c.schemeIndex[tableName]
+}
+
+// ReferencedBy returns the schemes that have the FOREIGN KEY constraint
+// referencing the table with the specified name.
+func (c *Catalog) ReferencedBy(tableName string) []*meta.Scheme {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
 
-	// TODO : Fix O(n) to O(1)
+	var schemes []*meta.Scheme
 	for _, s := range c.Schemes {
-		if s.TableName == tableName {
-			return s
+		for _, fk := range s.ForeignKeys {
+			if fk.RefTable == tableName {
+				schemes = append(schemes, s)
+				break
+			}
 		}
 	}
-	return nil
+	return schemes
+}
+
+// AddSequence is to add the new sequence into a memory.
+// Be careful not to persist the disk.
+func (c *Catalog) AddSequence(seq *meta.Sequence) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.Sequences = append(c.Sequences, seq)
+	c.sequenceIndex[seq.Name] = seq
+}
+
+// RemoveSequence removes the sequence with the specified name from a memory.
+// If no sequence exists, false is returned.
+// Be careful not to persist the disk.
+func (c *Catalog) RemoveSequence(name string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	old, ok := c.sequenceIndex[name]
+	if !ok {
+		return false
+	}
+	for i, s := range c.Sequences {
+		if s == old {
+			c.Sequences = append(c.Sequences[:i:i], c.Sequences[i+1:]...)
+			break
+		}
+	}
+	delete(c.sequenceIndex, name)
+	return true
+}
+
+// ReplaceSequence replaces the sequence with the specified name with seq
+// in a memory, keeping its position. It is used to rename the identity
+// sequence by ALTER TABLE. If no sequence exists, false is returned.
+// Be careful not to persist the disk.
+func (c *Catalog) ReplaceSequence(name string, seq *meta.Sequence) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	old, ok := c.sequenceIndex[name]
+	if !ok {
+		return false
+	}
+	for i, s := range c.Sequences {
+		if s == old {
+			c.Sequences[i] = seq
+		}
+	}
+	delete(c.sequenceIndex, name)
+	c.sequenceIndex[seq.Name] = seq
+	return true
+}
+
+// HasSequence returns whether a sequence with the specified name exists.
+func (c *Catalog) HasSequence(name string) bool {
+	return c.FetchSequence(name) != nil
+}
+
+// FetchSequence returns the sequence with the specified name,
+// if one exists. If no sequence exists, nil is returned.
+func (c *Catalog) FetchSequence(name string) *meta.Sequence {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.sequenceIndex[name]
+}
+
+// SetStats sets the statistics of the table in a memory, replacing the old one.
+// Be careful not to persist the disk. The caller must increment the version of
+// the database, so that the prepared statements are discarded.
+func (c *Catalog) SetStats(stats *meta.TableStats) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.removeStats(stats.TableName)
+	c.Stats = append(c.Stats, stats)
+	c.statsIndex[stats.TableName] = stats
+}
+
+// FetchStats returns the statistics of the table with the specified name,
+// if ANALYZE has collected it. Otherwise nil is returned.
+func (c *Catalog) FetchStats(tableName string) *meta.TableStats {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.statsIndex[tableName]
+}
+
+// removeStats removes the statistics of the table, which is stale after the
+// table is dropped or altered. The caller must hold the lock.
+func (c *Catalog) removeStats(tableName string) {
+	old, ok := c.statsIndex[tableName]
+	if !ok {
+		return
+	}
+	for i, s := range c.Stats {
+		if s == old {
+			c.Stats = append(c.Stats[:i:i], c.Stats[i+1:]...)
+			break
+		}
+	}
+	delete(c.statsIndex, tableName)
 }
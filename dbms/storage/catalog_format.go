@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"hash/crc32"
+	"strconv"
+
+	"github.com/nao1215/egsql/dbms/meta"
+	"github.com/nao1215/egsql/misc/errfmt"
+)
+
+// The catalog file has the following layout. Integers are big endian.
+//
+//	+----------------+-----------+------------+------------+----------------+
+//	| magic (8 byte) | version   | reserved   | length     | crc32          |
+//	| "EGSQLCAT"     | (2 byte)  | (2 byte)   | (4 byte)   | (4 byte)       |
+//	+----------------+-----------+------------+------------+----------------+
+//	| payload (length byte): gob encoded catalogPayload                      |
+//	+------------------------------------------------------------------------+
+//
+// crc32 is the IEEE checksum of the payload. The catalog file written before
+// this format was introduced is json, and it is read as the legacy format.
+const (
+	// catalogMagic is the magic number at the beginning of the catalog file.
+	catalogMagic = "EGSQLCAT"
+	// catalogFormatVersion is the version of the catalog file format written by SaveCatalog.
+	catalogFormatVersion uint16 = 1
+	// catalogHeaderSize is the size of the catalog file header in bytes.
+	catalogHeaderSize = len(catalogMagic) + 2 + 2 + 4 + 4
+)
+
+// catalogPayload is the persisted part of the Catalog.
+type catalogPayload struct {
+	Schemas   []string
+	Schemes   []*meta.Scheme
+	Sequences []*meta.Sequence
+	Stats     []*meta.TableStats
+}
+
+// encodePayload is a variable used to change the payload encoder to a stub at test time.
+var encodePayload = func(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeCatalog returns the catalog file contents of the catalog.
+func encodeCatalog(c *Catalog) ([]byte, error) {
+	c.mutex.RLock()
+	payload, err := encodePayload(catalogPayload{
+		Schemas:   c.Schemas,
+		Schemes:   c.Schemes,
+		Sequences: c.Sequences,
+		Stats:     c.Stats,
+	})
+	c.mutex.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, catalogHeaderSize, catalogHeaderSize+len(payload))
+	copy(b, catalogMagic)
+	binary.BigEndian.PutUint16(b[8:], catalogFormatVersion)
+	binary.BigEndian.PutUint32(b[12:], uint32(len(payload)))
+	binary.BigEndian.PutUint32(b[16:], crc32.ChecksumIEEE(payload))
+	return append(b, payload...), nil
+}
+
+// decodeCatalog returns the catalog read from the catalog file contents.
+// The legacy json catalog is also accepted, and the returned catalog is
+// marked to be upgraded (see NeedsUpgrade).
+func decodeCatalog(b []byte) (*Catalog, error) {
+	if isLegacyCatalog(b) {
+		var c Catalog
+		if err := json.Unmarshal(b, &c); err != nil {
+			return nil, errfmt.Wrap(ErrParseCatalogFile, err.Error())
+		}
+		c.legacy = true
+		return &c, nil
+	}
+
+	if len(b) < catalogHeaderSize || string(b[:len(catalogMagic)]) != catalogMagic {
+		return nil, errfmt.Wrap(ErrCorruptCatalogFile, "bad magic number")
+	}
+	if v := binary.BigEndian.Uint16(b[8:]); v != catalogFormatVersion {
+		return nil, errfmt.Wrap(ErrUnsupportedCatalogVersion, "version "+strconv.FormatUint(uint64(v), 10))
+	}
+	payload := b[catalogHeaderSize:]
+	if int(binary.BigEndian.Uint32(b[12:])) != len(payload) {
+		return nil, errfmt.Wrap(ErrCorruptCatalogFile, "payload length does not match")
+	}
+	if binary.BigEndian.Uint32(b[16:]) != crc32.ChecksumIEEE(payload) {
+		return nil, errfmt.Wrap(ErrCorruptCatalogFile, "checksum does not match")
+	}
+
+	var p catalogPayload
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&p); err != nil {
+		return nil, errfmt.Wrap(ErrCorruptCatalogFile, err.Error())
+	}
+	return &Catalog{
+		Schemas:   p.Schemas,
+		Schemes:   p.Schemes,
+		Sequences: p.Sequences,
+		Stats:     p.Stats,
+	}, nil
+}
+
+// isLegacyCatalog reports whether the catalog file contents is the legacy json.
+func isLegacyCatalog(b []byte) bool {
+	b = bytes.TrimLeft(b, " \t\r\n")
+	return len(b) > 0 && b[0] == '{'
+}
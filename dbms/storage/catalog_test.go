@@ -1,9 +1,11 @@
 package storage
 
 import (
-	"encoding/json"
+	"bytes"
 	"errors"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strconv"
 	"sync"
 	"testing"
@@ -29,7 +31,7 @@ func TestNewEmtpyCatalog(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			got := NewEmtpyCatalog()
-			if diff := cmp.Diff(*tt.want, *got, cmpopts.IgnoreFields(*got, "mutex")); diff != "" {
+			if diff := cmp.Diff(*tt.want, *got, cmpopts.IgnoreFields(*got, "mutex", "schemeIndex", "sequenceIndex", "statsIndex", "legacy", "recovered")); diff != "" {
 				t.Errorf("mismatch (-want +got):\n%s", diff)
 			}
 		})
@@ -46,6 +48,8 @@ func TestLoadCatalog(t *testing.T) {
 		want      *Catalog
 		wantErr   bool
 		wantErrAs error
+		// wantUpgrade is whether the catalog is read from the legacy json file.
+		wantUpgrade bool
 	}{
 		{
 			name: "[Success] generate new catlog pointer (not unmarshal catalog.db)",
@@ -57,7 +61,7 @@ func TestLoadCatalog(t *testing.T) {
 			wantErrAs: nil,
 		},
 		{
-			name: "[Success] load catlog file",
+			name: "[Success] load legacy json catlog file",
 			args: args{
 				egsqlHomePath: "./testdata/ok",
 			},
@@ -67,13 +71,40 @@ func TestLoadCatalog(t *testing.T) {
 						TableName:       "users",
 						ColumnNames:     []string{"id", "user_id"},
 						ColumnDataTypes: []meta.DataType{meta.Int, meta.Varchar},
-						PrimaryKey:      "id",
+						PrimaryKey:      meta.KeyColumns{"id"},
+						Indexes: []meta.Index{
+							{Name: "users_pkey", Columns: []string{"id"}, Unique: true, Primary: true},
+						},
 					},
 				},
 				mutex: &sync.RWMutex{},
 			},
-			wantErr:   false,
-			wantErrAs: nil,
+			wantErr:     false,
+			wantErrAs:   nil,
+			wantUpgrade: true,
+		},
+		{
+			name: "[Success] load legacy json catlog file that has single string primary key",
+			args: args{
+				egsqlHomePath: "./testdata/legacy",
+			},
+			want: &Catalog{
+				Schemes: []*meta.Scheme{
+					{
+						TableName:       "users",
+						ColumnNames:     []string{"id", "user_id"},
+						ColumnDataTypes: []meta.DataType{meta.Int, meta.Varchar},
+						PrimaryKey:      meta.KeyColumns{"id"},
+						Indexes: []meta.Index{
+							{Name: "users_pkey", Columns: []string{"id"}, Unique: true, Primary: true},
+						},
+					},
+				},
+				mutex: &sync.RWMutex{},
+			},
+			wantErr:     false,
+			wantErrAs:   nil,
+			wantUpgrade: true,
 		},
 		{
 			name: "[Error] failed to parse catalog.db",
@@ -88,7 +119,7 @@ func TestLoadCatalog(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			got, err := LoadCatalog(tt.args.egsqlHomePath)
-			if (err != nil) != tt.wantErr && !errors.As(err, &tt.wantErrAs) {
+			if (err != nil) != tt.wantErr && !errors.Is(err, tt.wantErrAs) {
 				t.Errorf("LoadCatalog() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
@@ -96,8 +127,11 @@ func TestLoadCatalog(t *testing.T) {
 			if got == nil {
 				return
 			}
+			if got.NeedsUpgrade() != tt.wantUpgrade {
+				t.Errorf("NeedsUpgrade() = %v, want %v", got.NeedsUpgrade(), tt.wantUpgrade)
+			}
 
-			if diff := cmp.Diff(*tt.want, *got, cmpopts.IgnoreFields(*got, "mutex")); diff != "" {
+			if diff := cmp.Diff(*tt.want, *got, cmpopts.IgnoreFields(*got, "mutex", "schemeIndex", "sequenceIndex", "statsIndex", "legacy", "recovered")); diff != "" {
 				t.Errorf("mismatch (-want +got):\n%s", diff)
 			}
 		})
@@ -105,106 +139,176 @@ func TestLoadCatalog(t *testing.T) {
 }
 
 func TestSaveCatalog(t *testing.T) {
-	type args struct {
-		egsqlHomePath string
-		c             *Catalog
+	newUsers := func() *Catalog {
+		c := &Catalog{
+			Schemas: []string{"sales"},
+			Schemes: []*meta.Scheme{
+				{
+					TableName:       "users",
+					ColumnNames:     []string{"id", "user_id"},
+					ColumnDataTypes: []meta.DataType{meta.Int, meta.Varchar},
+					PrimaryKey:      meta.KeyColumns{"id"},
+					Indexes: []meta.Index{
+						{Name: "users_pkey", Columns: []string{"id"}, Unique: true, Primary: true},
+					},
+					Defaults: map[string]string{"user_id": "guest"},
+					Identity: &meta.Identity{Column: "id", Sequence: "users_id_seq"},
+				},
+			},
+			Sequences: []*meta.Sequence{
+				{Name: "users_id_seq", Start: 1, Increment: 1, Last: 32},
+			},
+			mutex: &sync.RWMutex{},
+		}
+		c.buildIndex()
+		return c
 	}
+
 	tests := []struct {
-		name      string
-		args      args
-		wantErr   bool
-		wantErrAs error
-		marshal   func(v any) ([]byte, error)
+		name          string
+		egsqlHomePath string
+		c             *Catalog
+		wantErrAs     error
+		encode        func(v interface{}) ([]byte, error)
 	}{
 		{
-			name: "[Success] Save catalog",
-			args: args{
-				egsqlHomePath: "testdata/save",
-				c: &Catalog{
-					Schemes: []*meta.Scheme{
-						{
-							TableName:       "users",
-							ColumnNames:     []string{"id", "user_id"},
-							ColumnDataTypes: []meta.DataType{meta.Int, meta.Varchar},
-							PrimaryKey:      "id",
-						},
-					},
-					mutex: &sync.RWMutex{},
-				},
-			},
-			wantErr:   false,
-			wantErrAs: nil,
-			marshal:   json.Marshal,
+			name:          "[Success] Save catalog",
+			egsqlHomePath: t.TempDir(),
+			c:             newUsers(),
+			wantErrAs:     nil,
+			encode:        encodePayload,
 		},
 		{
-			name: "[Error] failed to marshal Catlog",
-			args: args{
-				egsqlHomePath: "testdata/save",
-				c: &Catalog{
-					Schemes: []*meta.Scheme{
-						{
-							TableName:       "users",
-							ColumnNames:     []string{"id", "user_id"},
-							ColumnDataTypes: []meta.DataType{meta.Int, meta.Varchar},
-							PrimaryKey:      "id",
-						},
-					},
-					mutex: &sync.RWMutex{},
-				},
-			},
-			wantErr:   false,
-			wantErrAs: ErrSaveCatalogFile,
-			marshal:   func(v any) ([]byte, error) { return []byte{}, errors.New("error") },
+			name:          "[Error] failed to encode Catlog",
+			egsqlHomePath: t.TempDir(),
+			c:             newUsers(),
+			wantErrAs:     ErrSaveCatalogFile,
+			encode:        func(v interface{}) ([]byte, error) { return nil, errors.New("error") },
 		},
 		{
-			name: "[Error] failed to write file",
-			args: args{
-				egsqlHomePath: "/no_exist_path",
-				c: &Catalog{
-					Schemes: []*meta.Scheme{
-						{
-							TableName:       "users",
-							ColumnNames:     []string{"id", "user_id"},
-							ColumnDataTypes: []meta.DataType{meta.Int, meta.Varchar},
-							PrimaryKey:      "id",
-						},
-					},
-					mutex: &sync.RWMutex{},
-				},
-			},
-			wantErr:   false,
-			wantErrAs: ErrSaveCatalogFile,
-			marshal:   json.Marshal,
+			name:          "[Error] failed to write file",
+			egsqlHomePath: "/no_exist_path",
+			c:             newUsers(),
+			wantErrAs:     ErrSaveCatalogFile,
+			encode:        encodePayload,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			jsonMarshal = tt.marshal
-			defer func() { jsonMarshal = json.Marshal }()
+			orig := encodePayload
+			encodePayload = tt.encode
+			defer func() { encodePayload = orig }()
 
-			err := SaveCatalog(tt.args.egsqlHomePath, tt.args.c)
-			if (err != nil) != tt.wantErr && !errors.As(err, &tt.wantErrAs) {
-				t.Errorf("SaveCatalog() error = %v, wantErr %v", err, tt.wantErr)
+			err := SaveCatalog(tt.egsqlHomePath, tt.c)
+			if !errors.Is(err, tt.wantErrAs) {
+				t.Fatalf("SaveCatalog() error = %v, wantErrAs %v", err, tt.wantErrAs)
+			}
+			if err != nil {
 				return
 			}
 
-			golden, err := ioutil.ReadFile("testdata/ok/catalog.db")
+			b, err := ioutil.ReadFile(filepath.Join(tt.egsqlHomePath, catalogName))
 			if err != nil {
 				t.Fatal(err)
 			}
+			if !bytes.HasPrefix(b, []byte(catalogMagic)) {
+				t.Errorf("catalog file does not start with the magic number: %q", b[:8])
+			}
 
-			got, err := ioutil.ReadFile("testdata/save/catalog.db")
+			got, err := LoadCatalog(tt.egsqlHomePath)
 			if err != nil {
 				t.Fatal(err)
 			}
-
-			if diff := cmp.Diff(golden, got); diff != "" {
+			if got.NeedsUpgrade() {
+				t.Error("saved catalog needs upgrade")
+			}
+			opt := cmpopts.IgnoreFields(*got, "mutex", "schemeIndex", "sequenceIndex", "statsIndex", "legacy", "recovered")
+			if diff := cmp.Diff(*tt.c, *got, opt, cmpopts.IgnoreUnexported(meta.Sequence{})); diff != "" {
 				t.Errorf("mismatch (-want +got):\n%s", diff)
 			}
 		})
 	}
 }
 
+func TestLoadCatalog_Corrupt(t *testing.T) {
+	c := NewEmtpyCatalog()
+	c.Add(&meta.Scheme{
+		TableName:       "users",
+		ColumnNames:     []string{"id"},
+		ColumnDataTypes: []meta.DataType{meta.Int},
+		PrimaryKey:      meta.KeyColumns{"id"},
+	})
+	valid, err := encodeCatalog(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modify := func(f func(b []byte) []byte) []byte {
+		return f(append([]byte{}, valid...))
+	}
+
+	tests := []struct {
+		name      string
+		content   []byte
+		wantErrAs error
+	}{
+		{
+			name:      "[Error] bit flip in payload",
+			content:   modify(func(b []byte) []byte { b[len(b)-1] ^= 0x01; return b }),
+			wantErrAs: ErrCorruptCatalogFile,
+		},
+		{
+			name:      "[Error] truncated file",
+			content:   modify(func(b []byte) []byte { return b[:len(b)-4] }),
+			wantErrAs: ErrCorruptCatalogFile,
+		},
+		{
+			name:      "[Error] truncated header",
+			content:   modify(func(b []byte) []byte { return b[:10] }),
+			wantErrAs: ErrCorruptCatalogFile,
+		},
+		{
+			name:      "[Error] bad magic number",
+			content:   modify(func(b []byte) []byte { b[0] = 'X'; return b }),
+			wantErrAs: ErrCorruptCatalogFile,
+		},
+		{
+			name:      "[Error] empty file",
+			content:   []byte{},
+			wantErrAs: ErrCorruptCatalogFile,
+		},
+		{
+			name:      "[Error] unsupported version",
+			content:   modify(func(b []byte) []byte { b[9] = 99; return b }),
+			wantErrAs: ErrUnsupportedCatalogVersion,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := ioutil.WriteFile(filepath.Join(dir, catalogName), tt.content, 0600); err != nil {
+				t.Fatal(err)
+			}
+			got, err := LoadCatalog(dir)
+			if !errors.Is(err, tt.wantErrAs) {
+				t.Errorf("LoadCatalog() error = %v, wantErrAs %v", err, tt.wantErrAs)
+			}
+			if got != nil {
+				t.Errorf("LoadCatalog() = %v, want nil", got)
+			}
+		})
+	}
+
+	t.Run("[Error] catalog file can not be read", func(t *testing.T) {
+		dir := t.TempDir()
+		if err := os.Mkdir(filepath.Join(dir, catalogName), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadCatalog(dir); !errors.Is(err, ErrReadCatalogFile) {
+			t.Errorf("LoadCatalog() error = %v, wantErrAs %v", err, ErrReadCatalogFile)
+		}
+	})
+}
+
 func TestCatalog_Add(t *testing.T) {
 	type fields struct {
 		Schemes []*meta.Scheme
@@ -236,6 +340,7 @@ func TestCatalog_Add(t *testing.T) {
 				Schemes: tt.fields.Schemes,
 				mutex:   tt.fields.mutex,
 			}
+			c.buildIndex()
 			c.Add(tt.args.scheme)
 
 			if !slice.Contains(c.Schemes, tt.args.scheme) {
@@ -250,6 +355,7 @@ func TestCatalog_Add_Concurrenct(t *testing.T) {
 		Schemes: s,
 	}
 	ctg.mutex = &sync.RWMutex{}
+	ctg.buildIndex()
 
 	var wg sync.WaitGroup
 
@@ -314,6 +420,7 @@ func TestCatalog_HasScheme(t *testing.T) {
 				Schemes: tt.fields.Schemes,
 				mutex:   tt.fields.mutex,
 			}
+			c.buildIndex()
 			if got := c.HasScheme(tt.args.tableName); got != tt.want {
 				t.Errorf("Catalog.HasScheme() = %v, want %v", got, tt.want)
 			}
@@ -364,6 +471,7 @@ func TestCatalog_FetchScheme(t *testing.T) {
 				Schemes: tt.fields.Schemes,
 				mutex:   tt.fields.mutex,
 			}
+			c.buildIndex()
 			got := c.FetchScheme(tt.args.tableName)
 			if diff := cmp.Diff(tt.want, got); diff != "" {
 				t.Errorf("mismatch (-want +got):\n%s", diff)
@@ -371,3 +479,235 @@ func TestCatalog_FetchScheme(t *testing.T) {
 		})
 	}
 }
+
+func TestCatalog_ReferencedBy(t *testing.T) {
+	groups := &meta.Scheme{TableName: "groups"}
+	users := &meta.Scheme{
+		TableName:   "users",
+		ForeignKeys: []meta.ForeignKey{{Name: "fk1", RefTable: "groups"}, {Name: "fk2", RefTable: "groups"}},
+	}
+	roles := &meta.Scheme{
+		TableName:   "roles",
+		ForeignKeys: []meta.ForeignKey{{Name: "fk3", RefTable: "users"}},
+	}
+	c := &Catalog{
+		Schemes: []*meta.Scheme{groups, users, roles},
+		mutex:   &sync.RWMutex{},
+	}
+
+	tests := []struct {
+		name      string
+		tableName string
+		want      []*meta.Scheme
+	}{
+		{
+			name:      "[Success] referenced by one table with two foreign keys",
+			tableName: "groups",
+			want:      []*meta.Scheme{users},
+		},
+		{
+			name:      "[Success] not referenced",
+			tableName: "roles",
+			want:      nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := c.ReferencedBy(tt.tableName)
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCatalog_Remove(t *testing.T) {
+	users := &meta.Scheme{TableName: "users"}
+	groups := &meta.Scheme{TableName: "groups"}
+	c := NewEmtpyCatalog()
+	c.Add(users)
+	c.Add(groups)
+
+	if c.Remove("roles") {
+		t.Error("Catalog.Remove() = true for not exist table")
+	}
+	if !c.Remove("users") {
+		t.Error("Catalog.Remove() = false for exist table")
+	}
+	if diff := cmp.Diff([]*meta.Scheme{groups}, c.Schemes); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestCatalog_Replace(t *testing.T) {
+	users := &meta.Scheme{TableName: "users"}
+	groups := &meta.Scheme{TableName: "groups"}
+	members := &meta.Scheme{TableName: "members"}
+	c := NewEmtpyCatalog()
+	c.Add(users)
+	c.Add(groups)
+
+	if c.Replace("roles", members) {
+		t.Error("Catalog.Replace() = true for not exist table")
+	}
+	if !c.Replace("users", members) {
+		t.Error("Catalog.Replace() = false for exist table")
+	}
+	if diff := cmp.Diff([]*meta.Scheme{members, groups}, c.Schemes); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+	if c.HasScheme("users") {
+		t.Error("the old name is still found after Catalog.Replace()")
+	}
+	if c.FetchScheme("members") != members {
+		t.Error("the new name is not found after Catalog.Replace()")
+	}
+}
+
+func TestSaveCatalog_Backup(t *testing.T) {
+	newCatalog := func(tables ...string) *Catalog {
+		c := NewEmtpyCatalog()
+		for _, name := range tables {
+			c.Add(&meta.Scheme{
+				TableName:       name,
+				ColumnNames:     []string{"id"},
+				ColumnDataTypes: []meta.DataType{meta.Int},
+				PrimaryKey:      meta.KeyColumns{"id"},
+			})
+		}
+		return c
+	}
+	tableNames := func(c *Catalog) []string {
+		var names []string
+		for _, s := range c.Schemes {
+			names = append(names, s.TableName)
+		}
+		return names
+	}
+	corrupt := func(t *testing.T, name string) {
+		t.Helper()
+		if err := ioutil.WriteFile(name, []byte("EGSQLCAT broken"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// save saves the catalog that has only "first" table, and then the catalog
+	// that has "first" and "second", so that the backup has only "first".
+	save := func(t *testing.T) string {
+		t.Helper()
+		dir := t.TempDir()
+		if err := SaveCatalog(dir, newCatalog("first")); err != nil {
+			t.Fatal(err)
+		}
+		if err := SaveCatalog(dir, newCatalog("first", "second")); err != nil {
+			t.Fatal(err)
+		}
+		return dir
+	}
+
+	t.Run("[Success] previous generation is kept as backup", func(t *testing.T) {
+		dir := save(t)
+		backup, err := readCatalog(filepath.Join(dir, backupName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([]string{"first"}, tableNames(backup)); diff != "" {
+			t.Errorf("mismatch (-want +got):\n%s", diff)
+		}
+		if _, err := os.Stat(filepath.Join(dir, catalogName+".tmp")); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("temporary file remains: %v", err)
+		}
+	})
+
+	t.Run("[Success] load backup if catalog file is corrupt", func(t *testing.T) {
+		dir := save(t)
+		corrupt(t, filepath.Join(dir, catalogName))
+
+		got, err := LoadCatalog(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Recovered() {
+			t.Error("Recovered() = false, want true")
+		}
+		if diff := cmp.Diff([]string{"first"}, tableNames(got)); diff != "" {
+			t.Errorf("mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("[Success] load backup if catalog file is missing", func(t *testing.T) {
+		dir := save(t)
+		if err := os.Remove(filepath.Join(dir, catalogName)); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := LoadCatalog(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([]string{"first"}, tableNames(got)); diff != "" {
+			t.Errorf("mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("[Success] corrupt catalog file does not overwrite backup", func(t *testing.T) {
+		dir := save(t)
+		corrupt(t, filepath.Join(dir, catalogName))
+		if err := SaveCatalog(dir, newCatalog("third")); err != nil {
+			t.Fatal(err)
+		}
+		backup, err := readCatalog(filepath.Join(dir, backupName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([]string{"first"}, tableNames(backup)); diff != "" {
+			t.Errorf("mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("[Error] both catalog file and backup are corrupt", func(t *testing.T) {
+		dir := save(t)
+		corrupt(t, filepath.Join(dir, catalogName))
+		corrupt(t, filepath.Join(dir, backupName))
+
+		if _, err := LoadCatalog(dir); !errors.Is(err, ErrCorruptCatalogFile) {
+			t.Errorf("LoadCatalog() error = %v, wantErrAs %v", err, ErrCorruptCatalogFile)
+		}
+	})
+}
+
+func TestCatalog_Stats(t *testing.T) {
+	users := &meta.Scheme{
+		TableName:       "users",
+		ColumnNames:     []string{"id", "name"},
+		ColumnDataTypes: []meta.DataType{meta.Int, meta.Varchar},
+		PrimaryKey:      meta.KeyColumns{"id"},
+	}
+	stats := meta.NewTableStats(users, [][]interface{}{{int64(1), "a"}, {int64(2), nil}})
+
+	t.Run("[Success] statistics are persisted", func(t *testing.T) {
+		c := NewEmtpyCatalog()
+		c.Add(users)
+		c.SetStats(stats)
+		dir := t.TempDir()
+		if err := SaveCatalog(dir, c); err != nil {
+			t.Fatal(err)
+		}
+		got, err := LoadCatalog(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(stats, got.FetchStats("users")); diff != "" {
+			t.Errorf("mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("[Success] statistics are removed with the table", func(t *testing.T) {
+		c := NewEmtpyCatalog()
+		c.Add(users)
+		c.SetStats(stats)
+		c.Remove("users")
+		if c.FetchStats("users") != nil || len(c.Stats) != 0 {
+			t.Error("statistics remain after Catalog.Remove()")
+		}
+	})
+}
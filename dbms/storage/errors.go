@@ -3,8 +3,41 @@ package storage
 import "errors"
 
 var (
-	// ErrParseCatalogFile means that parsing of the catalog file (json file) failed
+	// ErrParseCatalogFile means that parsing of the legacy catalog file (json file) failed
 	ErrParseCatalogFile = errors.New("failed to parse catalog file")
-	// ErrSaveCatalogFile means that saving of the catalog file (json file) failed
+	// ErrSaveCatalogFile means that saving of the catalog file failed
 	ErrSaveCatalogFile = errors.New("failed to save catalog file")
+	// ErrReadCatalogFile means that the catalog file exists but can not be read.
+	// For example, if the permission is denied.
+	ErrReadCatalogFile = errors.New("failed to read catalog file")
+	// ErrCorruptCatalogFile means that the catalog file has the bad magic number,
+	// length or checksum.
+	ErrCorruptCatalogFile = errors.New("catalog file is corrupt")
+	// ErrUnsupportedCatalogVersion means that the catalog file is written in
+	// the format version that this egsql can not read.
+	ErrUnsupportedCatalogVersion = errors.New("unsupported catalog file version")
+	// ErrNotMatchValueNum means that the number of values in the row and
+	// the number of columns in the table do not match.
+	ErrNotMatchValueNum = errors.New("'number of values' and 'number of columns' do not match")
+	// ErrNotMatchKeyNum means that the number of values in the key and
+	// the number of columns in the index do not match.
+	ErrNotMatchKeyNum = errors.New("'number of key values' and 'number of index columns' do not match")
+	// ErrTypeMismatch means that the value can not be stored in the column.
+	ErrTypeMismatch = errors.New("value does not match the column data type")
+	// ErrNotNullViolation means that NULL is stored in the column that does not allow NULL.
+	ErrNotNullViolation = errors.New("null value violates not-null constraint")
+	// ErrDuplicateKey means that the row violates the primary key or UNIQUE constraint.
+	ErrDuplicateKey = errors.New("duplicate key violates unique constraint")
+	// ErrNotExistRow means that the row with the specified row id does not exist.
+	ErrNotExistRow = errors.New("row does not exist")
+	// ErrExistRow means that the row with the specified row id is not deleted.
+	ErrExistRow = errors.New("row already exists")
+	// ErrNotExistIndex means that the index with the specified name does not exist.
+	ErrNotExistIndex = errors.New("index does not exist")
+	// ErrHomeLocked means that the EgSQL HOME is used by another database,
+	// in this process or another.
+	ErrHomeLocked = errors.New("egsql home is used by another database")
+	// ErrLockHome means that the lock file of the EgSQL HOME can not be
+	// created or locked.
+	ErrLockHome = errors.New("failed to lock egsql home")
 )
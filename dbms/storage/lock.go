@@ -0,0 +1,38 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/nao1215/egsql/misc/errfmt"
+)
+
+// lockName is the file in the EgSQL HOME that the database locks while it is open.
+const lockName = "egsql.lock"
+
+// HomeLock is the exclusive lock of the EgSQL HOME. The database holds it
+// while it is open, so that no other database, in this process or another,
+// overwrites the catalog with its own.
+type HomeLock struct {
+	f *os.File
+}
+
+// LockHome locks the EgSQL HOME. If another database holds the lock,
+// ErrHomeLocked is returned without waiting.
+func LockHome(egsqlHomePath string) (*HomeLock, error) {
+	name := filepath.Join(egsqlHomePath, lockName)
+	f, err := lockFile(name)
+	if errors.Is(err, ErrHomeLocked) {
+		return nil, errfmt.Wrap(ErrHomeLocked, egsqlHomePath)
+	}
+	if err != nil {
+		return nil, errfmt.Wrap(ErrLockHome, err.Error())
+	}
+	return &HomeLock{f: f}, nil
+}
+
+// Unlock releases the lock.
+func (l *HomeLock) Unlock() error {
+	return l.f.Close()
+}
@@ -0,0 +1,27 @@
+//go:build !windows
+
+package storage
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// lockFile opens the file and locks it with flock(2). The lock is released
+// when the file is closed or the process exits. If the file is locked by
+// another open file, ErrHomeLocked is returned.
+func lockFile(name string) (*os.File, error) {
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, ErrHomeLocked
+		}
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,374 @@
+package storage
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/nao1215/egsql/dbms/meta"
+	"github.com/nao1215/egsql/misc/errfmt"
+)
+
+// Row is a record of the table. Each value is int64 (meta.Int),
+// string (meta.Varchar) or nil (NULL), in the order of the scheme columns.
+type Row []interface{}
+
+// Table is the records of one table and the indexes over them.
+// The constraints defined in the scheme are enforced when rows are written.
+type Table struct {
+	scheme *meta.Scheme
+	// rows is the records of the table. The position in the slice is the row id,
+	// and the deleted row is left as nil so that row ids never change.
+	rows []Row
+	// live is the number of rows that are not deleted.
+	live int
+	// indexes is the indexes of the table. Key is index name.
+	indexes map[string]*index
+	mutex   *sync.RWMutex
+}
+
+// index maps the key of the indexed columns to the row ids.
+type index struct {
+	def meta.Index
+	// positions is the position of the indexed columns in the row.
+	positions []int
+	entries   map[string][]int64
+}
+
+// NewTable returns an empty Table pointer with the indexes defined in the scheme.
+func NewTable(scheme *meta.Scheme) *Table {
+	t := &Table{
+		scheme:  scheme,
+		indexes: make(map[string]*index),
+		mutex:   &sync.RWMutex{},
+	}
+	for _, def := range scheme.Indexes {
+		t.indexes[def.Name] = newIndex(scheme, def)
+	}
+	return t
+}
+
+// newIndex returns an empty index for the definition.
+func newIndex(scheme *meta.Scheme, def meta.Index) *index {
+	idx := &index{
+		def:     def,
+		entries: make(map[string][]int64),
+	}
+	for _, c := range def.Columns {
+		idx.positions = append(idx.positions, scheme.ColumnIndex(c))
+	}
+	return idx
+}
+
+// Scheme returns the scheme of the table.
+func (t *Table) Scheme() *meta.Scheme {
+	return t.scheme
+}
+
+// Len returns the number of rows in the table.
+func (t *Table) Len() int {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return t.live
+}
+
+// Insert adds the copy of the row to the table and returns its row id.
+// If the row violates a constraint, the table is not changed.
+func (t *Table) Insert(row Row) (int64, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if err := t.validRow(row); err != nil {
+		return 0, err
+	}
+	if err := t.checkUnique(row, -1); err != nil {
+		return 0, err
+	}
+
+	row = row.clone()
+	rowID := int64(len(t.rows))
+	t.rows = append(t.rows, row)
+	t.live++
+	for _, idx := range t.indexes {
+		idx.add(row, rowID)
+	}
+	return rowID, nil
+}
+
+// Update replaces the row with the specified row id by the copy of the row.
+// If the new row violates a constraint, the table is not changed.
+func (t *Table) Update(rowID int64, row Row) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	old, ok := t.get(rowID)
+	if !ok {
+		return ErrNotExistRow
+	}
+	if err := t.validRow(row); err != nil {
+		return err
+	}
+	if err := t.checkUnique(row, rowID); err != nil {
+		return err
+	}
+
+	row = row.clone()
+	for _, idx := range t.indexes {
+		idx.remove(old, rowID)
+		idx.add(row, rowID)
+	}
+	t.rows[rowID] = row
+	return nil
+}
+
+// Delete removes the row with the specified row id.
+func (t *Table) Delete(rowID int64) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	old, ok := t.get(rowID)
+	if !ok {
+		return ErrNotExistRow
+	}
+	for _, idx := range t.indexes {
+		idx.remove(old, rowID)
+	}
+	t.rows[rowID] = nil
+	t.live--
+	return nil
+}
+
+// Truncate removes all rows and releases their memory. The row ids
+// start from 0 again.
+func (t *Table) Truncate() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.rows = nil
+	t.live = 0
+	for name, idx := range t.indexes {
+		t.indexes[name] = newIndex(t.scheme, idx.def)
+	}
+}
+
+// Restore puts the deleted row back with the same row id.
+// It is used to undo Delete, so the constraints are not checked again.
+func (t *Table) Restore(rowID int64, row Row) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if rowID < 0 || rowID >= int64(len(t.rows)) {
+		return ErrNotExistRow
+	}
+	if t.rows[rowID] != nil {
+		return ErrExistRow
+	}
+	t.rows[rowID] = row
+	t.live++
+	for _, idx := range t.indexes {
+		idx.add(row, rowID)
+	}
+	return nil
+}
+
+// Rebuild returns a new table with the scheme whose rows are the rows of t
+// converted by convert, keeping their row ids. If convert is nil, the rows are
+// not converted. The constraints of the scheme are checked for every row, and
+// if a row violates one, an error is returned and t is not changed.
+func (t *Table) Rebuild(scheme *meta.Scheme, convert func(row Row) Row) (*Table, error) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	next := NewTable(scheme)
+	next.rows = make([]Row, len(t.rows))
+	for i, row := range t.rows {
+		if row == nil {
+			continue
+		}
+		if convert != nil {
+			row = convert(row)
+		}
+		if err := next.validRow(row); err != nil {
+			return nil, err
+		}
+		if err := next.checkUnique(row, -1); err != nil {
+			return nil, err
+		}
+		for _, idx := range next.indexes {
+			idx.add(row, int64(i))
+		}
+		next.rows[i] = row
+		next.live++
+	}
+	return next, nil
+}
+
+// Get returns the row with the specified row id.
+// If the row does not exist, false is returned.
+func (t *Table) Get(rowID int64) (Row, bool) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return t.get(rowID)
+}
+
+// get is Get without locking.
+func (t *Table) get(rowID int64) (Row, bool) {
+	if rowID < 0 || rowID >= int64(len(t.rows)) || t.rows[rowID] == nil {
+		return nil, false
+	}
+	return t.rows[rowID], true
+}
+
+// Scan calls fn for each row in row id order until fn returns false.
+// fn must not modify the table.
+func (t *Table) Scan(fn func(rowID int64, row Row) bool) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	for i, row := range t.rows {
+		if row == nil {
+			continue
+		}
+		if !fn(int64(i), row) {
+			return
+		}
+	}
+}
+
+// Lookup returns the row ids whose indexed columns equal to the key,
+// using the index with the specified name. The key values are in
+// the order of the index columns. A key including NULL matches nothing.
+func (t *Table) Lookup(indexName string, key Row) ([]int64, error) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	idx, ok := t.indexes[indexName]
+	if !ok {
+		return nil, errfmt.Wrap(ErrNotExistIndex, indexName)
+	}
+	if len(key) != len(idx.positions) {
+		return nil, ErrNotMatchKeyNum
+	}
+	k, ok := encodeKey(key)
+	if !ok {
+		return nil, nil
+	}
+	return append([]int64{}, idx.entries[k]...), nil
+}
+
+// validRow checks the number of values, their types and that
+// the primary key columns are not NULL.
+func (t *Table) validRow(row Row) error {
+	if len(row) != len(t.scheme.ColumnNames) {
+		return ErrNotMatchValueNum
+	}
+	for i, v := range row {
+		if v == nil {
+			if t.scheme.PrimaryKey.Contains(t.scheme.ColumnNames[i]) {
+				return errfmt.Wrap(ErrNotNullViolation, t.scheme.ColumnNames[i])
+			}
+			continue
+		}
+		if !matchType(t.scheme.ColumnDataTypes[i], v) {
+			return errfmt.Wrap(ErrTypeMismatch, t.scheme.ColumnNames[i])
+		}
+	}
+	return nil
+}
+
+// checkUnique checks that no other row has the same key in the unique indexes.
+// The row with the ignore row id is not treated as a duplicate.
+func (t *Table) checkUnique(row Row, ignore int64) error {
+	for _, idx := range t.indexes {
+		if !idx.def.Unique {
+			continue
+		}
+		k, ok := idx.key(row)
+		if !ok {
+			continue
+		}
+		for _, id := range idx.entries[k] {
+			if id != ignore {
+				return errfmt.Wrap(ErrDuplicateKey, idx.def.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// matchType reports whether the value can be stored in the column of the data type.
+func matchType(d meta.DataType, v interface{}) bool {
+	switch v.(type) {
+	case int64:
+		return d == meta.Int
+	case string:
+		return d == meta.Varchar
+	default:
+		return false
+	}
+}
+
+// key returns the encoded key of the indexed columns in the row.
+// If the key includes NULL, false is returned.
+func (idx *index) key(row Row) (string, bool) {
+	values := make(Row, 0, len(idx.positions))
+	for _, p := range idx.positions {
+		values = append(values, row[p])
+	}
+	return encodeKey(values)
+}
+
+// add adds the row id to the index.
+func (idx *index) add(row Row, rowID int64) {
+	if k, ok := idx.key(row); ok {
+		idx.entries[k] = append(idx.entries[k], rowID)
+	}
+}
+
+// remove removes the row id from the index.
+func (idx *index) remove(row Row, rowID int64) {
+	k, ok := idx.key(row)
+	if !ok {
+		return
+	}
+	ids := idx.entries[k]
+	for i, id := range ids {
+		if id == rowID {
+			ids = append(ids[:i], ids[i+1:]...)
+			break
+		}
+	}
+	if len(ids) == 0 {
+		delete(idx.entries, k)
+		return
+	}
+	idx.entries[k] = ids
+}
+
+// encodeKey encodes the values to the string used as the index key.
+// Each value is prefixed by its type so that 1 and "1" are different keys.
+// If the values include NULL, false is returned because NULL is never equal to anything.
+func encodeKey(values Row) (string, bool) {
+	var sb strings.Builder
+	for _, v := range values {
+		switch val := v.(type) {
+		case int64:
+			sb.WriteString("i")
+			sb.WriteString(strconv.FormatInt(val, 10))
+		case string:
+			sb.WriteString("s")
+			sb.WriteString(strconv.Itoa(len(val)))
+			sb.WriteString(":")
+			sb.WriteString(val)
+		default:
+			return "", false
+		}
+		sb.WriteString("|")
+	}
+	return sb.String(), true
+}
+
+// clone returns the copy of the row, so that the caller can reuse its slice.
+func (r Row) clone() Row {
+	return append(make(Row, 0, len(r)), r...)
+}
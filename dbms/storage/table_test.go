@@ -0,0 +1,379 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nao1215/egsql/dbms/meta"
+)
+
+// newTestAccounts returns the table that has composite primary key
+// (tenant_id, id) and UNIQUE (email), UNIQUE (tenant_id, code).
+func newTestAccounts(t *testing.T) *Table {
+	t.Helper()
+
+	s, err := meta.NewScheme("accounts",
+		[]string{"tenant_id", "id", "email", "code"},
+		[]meta.DataType{meta.Int, meta.Int, meta.Varchar, meta.Varchar},
+		"tenant_id", "id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddUnique("email"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddUnique("tenant_id", "code"); err != nil {
+		t.Fatal(err)
+	}
+	return NewTable(s)
+}
+
+func TestTable_Insert(t *testing.T) {
+	tests := []struct {
+		name      string
+		existing  []Row
+		row       Row
+		wantErrIs error
+		wantLen   int
+	}{
+		{
+			name:      "[Success] insert row",
+			row:       Row{int64(1), int64(1), "a@example.com", "A"},
+			wantErrIs: nil,
+			wantLen:   1,
+		},
+		{
+			name:      "[Success] same id in the other tenant",
+			existing:  []Row{{int64(1), int64(1), "a@example.com", "A"}},
+			row:       Row{int64(2), int64(1), "b@example.com", "A"},
+			wantErrIs: nil,
+			wantLen:   2,
+		},
+		{
+			name: "[Success] NULL in unique key is not a duplicate",
+			existing: []Row{
+				{int64(1), int64(1), nil, nil},
+			},
+			row:       Row{int64(1), int64(2), nil, nil},
+			wantErrIs: nil,
+			wantLen:   2,
+		},
+		{
+			name:      "[Error] duplicate composite primary key",
+			existing:  []Row{{int64(1), int64(1), "a@example.com", "A"}},
+			row:       Row{int64(1), int64(1), "b@example.com", "B"},
+			wantErrIs: ErrDuplicateKey,
+			wantLen:   1,
+		},
+		{
+			name:      "[Error] duplicate single column unique key",
+			existing:  []Row{{int64(1), int64(1), "a@example.com", "A"}},
+			row:       Row{int64(2), int64(1), "a@example.com", "B"},
+			wantErrIs: ErrDuplicateKey,
+			wantLen:   1,
+		},
+		{
+			name:      "[Error] duplicate composite unique key",
+			existing:  []Row{{int64(1), int64(1), "a@example.com", "A"}},
+			row:       Row{int64(1), int64(2), "b@example.com", "A"},
+			wantErrIs: ErrDuplicateKey,
+			wantLen:   1,
+		},
+		{
+			name:      "[Error] NULL in primary key",
+			row:       Row{nil, int64(1), "a@example.com", "A"},
+			wantErrIs: ErrNotNullViolation,
+			wantLen:   0,
+		},
+		{
+			name:      "[Error] number of values does not match",
+			row:       Row{int64(1), int64(1)},
+			wantErrIs: ErrNotMatchValueNum,
+			wantLen:   0,
+		},
+		{
+			name:      "[Error] type mismatch",
+			row:       Row{int64(1), "1", "a@example.com", "A"},
+			wantErrIs: ErrTypeMismatch,
+			wantLen:   0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := newTestAccounts(t)
+			for _, r := range tt.existing {
+				if _, err := table.Insert(r); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			_, err := table.Insert(tt.row)
+			if !errors.Is(err, tt.wantErrIs) {
+				t.Errorf("Table.Insert() error = %v, wantErrIs %v", err, tt.wantErrIs)
+			}
+			if got := table.Len(); got != tt.wantLen {
+				t.Errorf("mismatch: want=%d got=%d", tt.wantLen, got)
+			}
+		})
+	}
+}
+
+func TestTable_Update(t *testing.T) {
+	table := newTestAccounts(t)
+	first, err := table.Insert(Row{int64(1), int64(1), "a@example.com", "A"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := table.Insert(Row{int64(1), int64(2), "b@example.com", "B"}); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("[Success] update row to the same key", func(t *testing.T) {
+		if err := table.Update(first, Row{int64(1), int64(1), "a@example.com", "C"}); err != nil {
+			t.Errorf("Table.Update() error = %v", err)
+		}
+	})
+
+	t.Run("[Error] update row to the key of the other row", func(t *testing.T) {
+		err := table.Update(first, Row{int64(1), int64(2), "a@example.com", "C"})
+		if !errors.Is(err, ErrDuplicateKey) {
+			t.Errorf("Table.Update() error = %v, wantErrIs %v", err, ErrDuplicateKey)
+		}
+		got, _ := table.Get(first)
+		if diff := cmp.Diff(Row{int64(1), int64(1), "a@example.com", "C"}, got); diff != "" {
+			t.Errorf("mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("[Success] old key is released from index", func(t *testing.T) {
+		if err := table.Update(first, Row{int64(1), int64(3), "c@example.com", "C"}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := table.Insert(Row{int64(1), int64(1), "a@example.com", "A"}); err != nil {
+			t.Errorf("Table.Insert() error = %v", err)
+		}
+	})
+
+	t.Run("[Success] caller's row is copied", func(t *testing.T) {
+		row := Row{int64(2), int64(1), "d@example.com", "D"}
+		id, err := table.Insert(row)
+		if err != nil {
+			t.Fatal(err)
+		}
+		row[3] = "X"
+		got, _ := table.Get(id)
+		if diff := cmp.Diff(Row{int64(2), int64(1), "d@example.com", "D"}, got); diff != "" {
+			t.Errorf("Insert mismatch (-want +got):\n%s", diff)
+		}
+
+		row = Row{int64(2), int64(1), "d@example.com", "E"}
+		if err := table.Update(id, row); err != nil {
+			t.Fatal(err)
+		}
+		row[3] = "X"
+		got, _ = table.Get(id)
+		if diff := cmp.Diff(Row{int64(2), int64(1), "d@example.com", "E"}, got); diff != "" {
+			t.Errorf("Update mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("[Error] row does not exist", func(t *testing.T) {
+		err := table.Update(100, Row{int64(1), int64(100), nil, nil})
+		if !errors.Is(err, ErrNotExistRow) {
+			t.Errorf("Table.Update() error = %v, wantErrIs %v", err, ErrNotExistRow)
+		}
+	})
+}
+
+func TestTable_Delete(t *testing.T) {
+	table := newTestAccounts(t)
+	rowID, err := table.Insert(Row{int64(1), int64(1), "a@example.com", "A"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := table.Delete(rowID); err != nil {
+		t.Fatalf("Table.Delete() error = %v", err)
+	}
+	if _, ok := table.Get(rowID); ok {
+		t.Errorf("deleted row is still in the table")
+	}
+	if err := table.Delete(rowID); !errors.Is(err, ErrNotExistRow) {
+		t.Errorf("Table.Delete() error = %v, wantErrIs %v", err, ErrNotExistRow)
+	}
+	if _, err := table.Insert(Row{int64(1), int64(1), "a@example.com", "A"}); err != nil {
+		t.Errorf("key of deleted row can not be reused: %v", err)
+	}
+}
+
+func TestTable_Lookup(t *testing.T) {
+	table := newTestAccounts(t)
+	want, err := table.Insert(Row{int64(1), int64(1), "a@example.com", "A"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		index     string
+		key       Row
+		want      []int64
+		wantErrIs error
+	}{
+		{
+			name:  "[Success] lookup by primary key",
+			index: "accounts_pkey",
+			key:   Row{int64(1), int64(1)},
+			want:  []int64{want},
+		},
+		{
+			name:  "[Success] lookup by unique key",
+			index: "accounts_email_key",
+			key:   Row{"a@example.com"},
+			want:  []int64{want},
+		},
+		{
+			name:  "[Success] not found",
+			index: "accounts_pkey",
+			key:   Row{int64(1), int64(2)},
+			want:  []int64{},
+		},
+		{
+			name:  "[Success] NULL matches nothing",
+			index: "accounts_email_key",
+			key:   Row{nil},
+			want:  nil,
+		},
+		{
+			name:      "[Error] index does not exist",
+			index:     "not_exist",
+			key:       Row{int64(1)},
+			want:      nil,
+			wantErrIs: ErrNotExistIndex,
+		},
+		{
+			name:      "[Error] number of key values does not match",
+			index:     "accounts_pkey",
+			key:       Row{int64(1)},
+			want:      nil,
+			wantErrIs: ErrNotMatchKeyNum,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := table.Lookup(tt.index, tt.key)
+			if !errors.Is(err, tt.wantErrIs) {
+				t.Errorf("Table.Lookup() error = %v, wantErrIs %v", err, tt.wantErrIs)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTable_Restore(t *testing.T) {
+	table := newTestAccounts(t)
+	row := Row{int64(1), int64(1), "a@example.com", "A"}
+	rowID, err := table.Insert(row)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := table.Restore(rowID, row); !errors.Is(err, ErrExistRow) {
+		t.Errorf("Table.Restore() error = %v, wantErrIs %v", err, ErrExistRow)
+	}
+	if err := table.Delete(rowID); err != nil {
+		t.Fatal(err)
+	}
+	if err := table.Restore(rowID, row); err != nil {
+		t.Fatalf("Table.Restore() error = %v", err)
+	}
+
+	got, err := table.Lookup("accounts_email_key", Row{"a@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]int64{rowID}, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestTable_Rebuild(t *testing.T) {
+	table := newTestAccounts(t)
+	for _, row := range []Row{
+		{int64(1), int64(1), "a@example.com", "A"},
+		{int64(1), int64(2), "b@example.com", "B"},
+	} {
+		if _, err := table.Insert(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := table.Delete(0); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("[Success] add column keeps row ids", func(t *testing.T) {
+		s := table.Scheme().Clone()
+		if err := s.AddColumn("note", meta.Varchar); err != nil {
+			t.Fatal(err)
+		}
+		got, err := table.Rebuild(s, func(row Row) Row { return append(append(Row{}, row...), "x") })
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := got.Get(0); ok {
+			t.Error("deleted row 0 exists after Rebuild()")
+		}
+		row, _ := got.Get(1)
+		if diff := cmp.Diff(Row{int64(1), int64(2), "b@example.com", "B", "x"}, row); diff != "" {
+			t.Errorf("mismatch (-want +got):\n%s", diff)
+		}
+		ids, err := got.Lookup("accounts_email_key", Row{"b@example.com"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([]int64{1}, ids); diff != "" {
+			t.Errorf("mismatch (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("[Error] converted row violates the constraint", func(t *testing.T) {
+		if _, err := table.Insert(Row{int64(1), int64(3), "c@example.com", "C"}); err != nil {
+			t.Fatal(err)
+		}
+		_, err := table.Rebuild(table.Scheme(), func(row Row) Row {
+			return Row{row[0], row[1], "same@example.com", row[3]}
+		})
+		if !errors.Is(err, ErrDuplicateKey) {
+			t.Errorf("Table.Rebuild() error = %v, wantErrIs %v", err, ErrDuplicateKey)
+		}
+		if table.Len() != 2 {
+			t.Errorf("Table.Len() = %d, want 2", table.Len())
+		}
+	})
+}
+
+func TestTable_Truncate(t *testing.T) {
+	table := newTestAccounts(t)
+	row := Row{int64(1), int64(1), "a@example.com", "A"}
+	if _, err := table.Insert(row); err != nil {
+		t.Fatal(err)
+	}
+
+	table.Truncate()
+	if table.Len() != 0 {
+		t.Errorf("Table.Len() = %d, want 0", table.Len())
+	}
+	got, err := table.Lookup("accounts_email_key", Row{"a@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("Table.Lookup() = %v after Truncate(), want empty", got)
+	}
+	if _, err := table.Insert(row); err != nil {
+		t.Errorf("Table.Insert() error = %v after Truncate()", err)
+	}
+}
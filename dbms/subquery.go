@@ -0,0 +1,105 @@
+package dbms
+
+import (
+	"github.com/nao1215/egsql/dbms/executor"
+	"github.com/nao1215/egsql/dbms/expr"
+	"github.com/nao1215/egsql/dbms/query"
+)
+
+// planSemiJoin plans the condition of WHERE clause as the semi join of input
+// and the subquery, if the condition is the simple correlated [NOT] EXISTS:
+// the subquery is not grouped, its FROM clause does not reference the outer
+// query, and each condition of its WHERE clause either references no outer
+// column or is "=" between a column of the outer row and an expression of the
+// subquery row. outer is the binder of the input rows. It returns nil if the
+// condition is not such EXISTS.
+func (p *planner) planSemiJoin(input executor.Operator, outer *expr.Binder, cond query.Expr) (executor.Operator, error) {
+	anti := false
+	if not, ok := cond.(*query.UnaryExpr); ok && not.Op == "NOT" {
+		cond, anti = not.Expr, true
+	}
+	exists, ok := cond.(*query.ExistsExpr)
+	if !ok {
+		return nil, nil
+	}
+	stmt := exists.Select
+	if stmt.From == nil || len(stmt.With) > 0 || stmt.SetOp != nil || isAggregateQuery(outer, stmt) {
+		return nil, nil
+	}
+
+	// The subquery is read once in the environment of the query.
+	sub := &planner{db: p.db, sess: p.sess, ctx: p.ctx, env: p.env, outer: outer, ctes: p.ctes, bound: p.bound}
+	from, err := sub.planFrom(stmt.From)
+	if err != nil || sub.correlated || stmt.Where == nil {
+		return nil, err
+	}
+	where, err := sub.binder(from.columns).BindCondition(stmt.Where)
+	if err != nil {
+		return nil, err
+	}
+	j := &executor.SemiJoin{Left: input, Anti: anti, Env: p.env}
+	var filters []expr.Expr
+	for _, c := range expr.Conjuncts(where) {
+		if isLocal(c) {
+			filters = append(filters, c)
+			continue
+		}
+		left, right, ok := correlatedKey(c)
+		if !ok {
+			return nil, nil
+		}
+		j.LeftKeys = append(j.LeftKeys, left)
+		j.RightKeys = append(j.RightKeys, right)
+	}
+	if len(j.LeftKeys) == 0 {
+		return nil, nil
+	}
+	j.Right = from.plan
+	if len(filters) > 0 {
+		j.Right = &executor.Filter{Input: from.plan, Cond: expr.And(filters...), Env: p.env}
+	}
+	return j, nil
+}
+
+// correlatedKey returns the key of the outer row and the key of the subquery
+// row if the condition is "=" between them.
+func correlatedKey(cond expr.Expr) (expr.Expr, expr.Expr, bool) {
+	cmp, ok := cond.(*expr.Comparison)
+	if !ok || cmp.Op != "=" {
+		return nil, nil, false
+	}
+	if left, ok := outerKey(cmp.Left); ok && isLocal(cmp.Right) {
+		return left, cmp.Right, true
+	}
+	if left, ok := outerKey(cmp.Right); ok && isLocal(cmp.Left) {
+		return left, cmp.Left, true
+	}
+	return nil, nil, false
+}
+
+// outerKey returns the expression that evaluates e for the outer row, if e is
+// the column of the query that the subquery is in, or its conversion.
+func outerKey(e expr.Expr) (expr.Expr, bool) {
+	switch v := e.(type) {
+	case *expr.OuterColumn:
+		return &expr.Column{Index: v.Index, Name: v.Name, T: v.T}, v.Level == 1
+	case *expr.Cast:
+		key, ok := outerKey(v.Expr)
+		return &expr.Cast{Expr: key, To: v.To}, ok
+	}
+	return nil, false
+}
+
+// isLocal reports whether the expression references neither the columns of
+// the outer queries nor the subqueries.
+func isLocal(e expr.Expr) bool {
+	local := true
+	expr.Walk(e, func(e expr.Expr) bool {
+		switch e.(type) {
+		case *expr.OuterColumn, *expr.ScalarSubquery, *expr.Exists, *expr.InSubquery:
+			local = false
+		}
+		return local
+	})
+	return local
+}
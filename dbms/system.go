@@ -0,0 +1,193 @@
+package dbms
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nao1215/egsql/dbms/meta"
+	"github.com/nao1215/egsql/dbms/storage"
+)
+
+// systemView is a read-only virtual table whose rows are generated from
+// the catalog when it is read.
+type systemView struct {
+	// columns is the column names.
+	columns []string
+	// types is the column data types.
+	types []meta.DataType
+	// rows generates the rows. It is called with db.mutex locked.
+	rows func(db *EgSQLDB) []storage.Row
+}
+
+// systemViews is the system views. Key is the qualified name (schema.name).
+var systemViews map[string]*systemView
+
+func init() {
+	// systemViews is initialized here because information_schema.tables
+	// lists the system views themselves.
+	systemViews = map[string]*systemView{
+		meta.InformationSchema + ".tables": {
+			columns: []string{"table_schema", "table_name", "table_type"},
+			types:   []meta.DataType{meta.Varchar, meta.Varchar, meta.Varchar},
+			rows:    (*EgSQLDB).tablesRows,
+		},
+		meta.InformationSchema + ".columns": {
+			columns: []string{
+				"table_schema", "table_name", "column_name", "ordinal_position",
+				"data_type", "column_default", "is_nullable", "is_identity",
+			},
+			types: []meta.DataType{
+				meta.Varchar, meta.Varchar, meta.Varchar, meta.Int,
+				meta.Varchar, meta.Varchar, meta.Varchar, meta.Varchar,
+			},
+			rows: (*EgSQLDB).columnsRows,
+		},
+		meta.SystemSchema + ".egsql_indexes": {
+			columns: []string{"table_schema", "table_name", "index_name", "column_names", "is_unique", "is_primary"},
+			types:   []meta.DataType{meta.Varchar, meta.Varchar, meta.Varchar, meta.Varchar, meta.Varchar, meta.Varchar},
+			rows:    (*EgSQLDB).indexesRows,
+		},
+		meta.SystemSchema + ".egsql_stats": {
+			columns: []string{"table_schema", "table_name", "row_count"},
+			types:   []meta.DataType{meta.Varchar, meta.Varchar, meta.Int},
+			rows:    (*EgSQLDB).statsRows,
+		},
+		meta.SystemSchema + ".egsql_column_stats": {
+			columns: []string{"table_schema", "table_name", "column_name", "row_count", "null_count", "distinct_count", "histogram"},
+			types:   []meta.DataType{meta.Varchar, meta.Varchar, meta.Varchar, meta.Int, meta.Int, meta.Int, meta.Varchar},
+			rows:    (*EgSQLDB).columnStatsRows,
+		},
+		meta.SystemSchema + ".egsql_plan_cache": {
+			columns: []string{"hits", "misses", "evictions", "invalidations", "size", "capacity"},
+			types:   []meta.DataType{meta.Int, meta.Int, meta.Int, meta.Int, meta.Int, meta.Int},
+			rows:    (*EgSQLDB).planCacheRows,
+		},
+	}
+}
+
+// systemViewScheme returns the scheme of the system view. Key is the qualified name.
+// The scheme describes the columns only; it has no keys.
+func systemViewScheme(name string, v *systemView) *meta.Scheme {
+	return &meta.Scheme{TableName: name, ColumnNames: v.columns, ColumnDataTypes: v.types}
+}
+
+// sortedSchemes returns the schemes of the tables and the system views
+// in the order of the schema name and the table name.
+func (db *EgSQLDB) sortedSchemes() []*meta.Scheme {
+	schemes := append([]*meta.Scheme{}, db.catalog.Schemes...)
+	for name, v := range systemViews {
+		schemes = append(schemes, systemViewScheme(name, v))
+	}
+	sort.Slice(schemes, func(i, j int) bool {
+		si, ti := meta.SplitQualifiedName(schemes[i].TableName)
+		sj, tj := meta.SplitQualifiedName(schemes[j].TableName)
+		if si != sj {
+			return si < sj
+		}
+		return ti < tj
+	})
+	return schemes
+}
+
+// tablesRows generates the rows of information_schema.tables.
+func (db *EgSQLDB) tablesRows() []storage.Row {
+	var rows []storage.Row
+	for _, s := range db.sortedSchemes() {
+		schema, name := meta.SplitQualifiedName(s.TableName)
+		tableType := "BASE TABLE"
+		if meta.IsSystemSchema(schema) {
+			tableType = "SYSTEM VIEW"
+		}
+		rows = append(rows, storage.Row{schema, name, tableType})
+	}
+	return rows
+}
+
+// columnsRows generates the rows of information_schema.columns.
+// The primary key columns are not nullable.
+func (db *EgSQLDB) columnsRows() []storage.Row {
+	var rows []storage.Row
+	for _, s := range db.sortedSchemes() {
+		schema, name := meta.SplitQualifiedName(s.TableName)
+		for i, c := range s.ColumnNames {
+			var def interface{}
+			if text, ok := s.Defaults[c]; ok {
+				def = text
+			}
+			rows = append(rows, storage.Row{
+				schema, name, c, int64(i + 1), s.ColumnDataTypes[i].String(), def,
+				yesOrNo(!s.PrimaryKey.Contains(c)), yesOrNo(s.Identity != nil && s.Identity.Column == c),
+			})
+		}
+	}
+	return rows
+}
+
+// indexesRows generates the rows of egsql_catalog.egsql_indexes.
+func (db *EgSQLDB) indexesRows() []storage.Row {
+	var rows []storage.Row
+	for _, s := range db.sortedSchemes() {
+		schema, name := meta.SplitQualifiedName(s.TableName)
+		for _, idx := range s.Indexes {
+			rows = append(rows, storage.Row{
+				schema, name, idx.Name, strings.Join(idx.Columns, ","),
+				yesOrNo(idx.Unique), yesOrNo(idx.Primary),
+			})
+		}
+	}
+	return rows
+}
+
+// statsRows generates the rows of egsql_catalog.egsql_stats.
+func (db *EgSQLDB) statsRows() []storage.Row {
+	var rows []storage.Row
+	for _, s := range db.sortedSchemes() {
+		t, ok := db.tables[s.TableName]
+		if !ok {
+			continue
+		}
+		schema, name := meta.SplitQualifiedName(s.TableName)
+		rows = append(rows, storage.Row{schema, name, int64(t.Len())})
+	}
+	return rows
+}
+
+// columnStatsRows generates the rows of egsql_catalog.egsql_column_stats,
+// the statistics collected by ANALYZE. The histogram is the bounds of
+// the buckets separated by ",".
+func (db *EgSQLDB) columnStatsRows() []storage.Row {
+	var rows []storage.Row
+	for _, s := range db.sortedSchemes() {
+		stats := db.catalog.FetchStats(s.TableName)
+		if stats == nil {
+			continue
+		}
+		schema, name := meta.SplitQualifiedName(s.TableName)
+		for _, c := range stats.Columns {
+			bounds := make([]string, 0, len(c.Histogram))
+			for _, v := range c.Histogram {
+				bounds = append(bounds, fmt.Sprint(v))
+			}
+			rows = append(rows, storage.Row{
+				schema, name, c.Name, stats.RowCount, c.NullCount, c.DistinctCount, strings.Join(bounds, ","),
+			})
+		}
+	}
+	return rows
+}
+
+// planCacheRows generates the row of egsql_catalog.egsql_plan_cache,
+// the metrics of the plan cache.
+func (db *EgSQLDB) planCacheRows() []storage.Row {
+	s := db.PlanCacheStats()
+	return []storage.Row{{s.Hits, s.Misses, s.Evictions, s.Invalidations, int64(s.Size), int64(s.Capacity)}}
+}
+
+// yesOrNo returns "YES" or "NO" as the boolean columns of information_schema.
+func yesOrNo(b bool) string {
+	if b {
+		return "YES"
+	}
+	return "NO"
+}
@@ -0,0 +1,163 @@
+package dbms
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nao1215/egsql/dbms/meta"
+	"github.com/nao1215/egsql/dbms/query"
+)
+
+// querySQL parses and executes the query in a new session and returns the result set.
+func querySQL(t *testing.T, db *EgSQLDB, sql string, args ...interface{}) *meta.ResultSet {
+	t.Helper()
+
+	stmt, _, err := query.Parse(sql)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs, err := db.Exec(nil, stmt, args)
+	if err != nil {
+		t.Fatalf("Exec(%q) error = %v", sql, err)
+	}
+	return rs
+}
+
+func TestEgSQLDB_SystemViews(t *testing.T) {
+	db, err := NewEgSQLDB(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sql := range []string{
+		"CREATE SCHEMA sales",
+		"CREATE TABLE users (id INT PRIMARY KEY AUTOINCREMENT, email TEXT UNIQUE DEFAULT 'none')",
+		"CREATE TABLE sales.orders (id INT PRIMARY KEY, user_id INT)",
+		"INSERT INTO users (email) VALUES ('a@example.com'), ('b@example.com')",
+	} {
+		execSQL(t, db, sql)
+	}
+
+	tests := []struct {
+		name        string
+		sql         string
+		wantColumns []string
+		wantRows    [][]interface{}
+	}{
+		{
+			name:        "[Success] information_schema.tables",
+			sql:         "SELECT table_schema, table_name, table_type FROM information_schema.tables",
+			wantColumns: []string{"table_schema", "table_name", "table_type"},
+			wantRows: [][]interface{}{
+				{"egsql_catalog", "egsql_column_stats", "SYSTEM VIEW"},
+				{"egsql_catalog", "egsql_indexes", "SYSTEM VIEW"},
+				{"egsql_catalog", "egsql_plan_cache", "SYSTEM VIEW"},
+				{"egsql_catalog", "egsql_stats", "SYSTEM VIEW"},
+				{"information_schema", "columns", "SYSTEM VIEW"},
+				{"information_schema", "tables", "SYSTEM VIEW"},
+				{"public", "users", "BASE TABLE"},
+				{"sales", "orders", "BASE TABLE"},
+			},
+		},
+		{
+			name:        "[Success] information_schema.columns",
+			sql:         "SELECT * FROM information_schema.columns",
+			wantColumns: systemViews["information_schema.columns"].columns,
+			wantRows: append(systemColumnsRows(),
+				[]interface{}{"public", "users", "id", int64(1), "int", nil, "NO", "YES"},
+				[]interface{}{"public", "users", "email", int64(2), "varchar", "none", "YES", "NO"},
+				[]interface{}{"sales", "orders", "id", int64(1), "int", nil, "NO", "NO"},
+				[]interface{}{"sales", "orders", "user_id", int64(2), "int", nil, "YES", "NO"},
+			),
+		},
+		{
+			name:        "[Success] egsql_indexes without schema name",
+			sql:         "SELECT table_name, index_name AS name, column_names, is_unique, is_primary FROM egsql_indexes",
+			wantColumns: []string{"table_name", "name", "column_names", "is_unique", "is_primary"},
+			wantRows: [][]interface{}{
+				{"users", "users_pkey", "id", "YES", "YES"},
+				{"users", "users_email_key", "email", "YES", "NO"},
+				{"orders", "sales.orders_pkey", "id", "YES", "YES"},
+			},
+		},
+		{
+			name:        "[Success] egsql_stats",
+			sql:         "SELECT egsql_stats.table_name, row_count FROM egsql_catalog.egsql_stats",
+			wantColumns: []string{"table_name", "row_count"},
+			wantRows:    [][]interface{}{{"users", int64(2)}, {"orders", int64(0)}},
+		},
+		{
+			name:        "[Success] select without from",
+			sql:         "SELECT 1, 'a' AS b",
+			wantColumns: []string{"?column?", "b"},
+			wantRows:    [][]interface{}{{int64(1), "a"}},
+		},
+		{
+			name:        "[Success] select from table",
+			sql:         "SELECT email, id FROM users",
+			wantColumns: []string{"email", "id"},
+			wantRows:    [][]interface{}{{"a@example.com", int64(1)}, {"b@example.com", int64(2)}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs := querySQL(t, db, tt.sql)
+			if diff := cmp.Diff(tt.wantColumns, rs.ColumnNames); diff != "" {
+				t.Errorf("columns mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.wantRows, rs.Rows); diff != "" {
+				t.Errorf("rows mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// systemColumnsRows returns the rows of information_schema.columns that
+// describe the system views, which come before the tables in public schema.
+func systemColumnsRows() [][]interface{} {
+	var rows [][]interface{}
+	for _, name := range []string{
+		"egsql_catalog.egsql_column_stats", "egsql_catalog.egsql_indexes", "egsql_catalog.egsql_plan_cache",
+		"egsql_catalog.egsql_stats",
+		"information_schema.columns", "information_schema.tables",
+	} {
+		schema, table := meta.SplitQualifiedName(name)
+		v := systemViews[name]
+		for i, c := range v.columns {
+			rows = append(rows, []interface{}{schema, table, c, int64(i + 1), v.types[i].String(), nil, "YES", "NO"})
+		}
+	}
+	return rows
+}
+
+func TestEgSQLDB_SystemViews_ReadOnly(t *testing.T) {
+	db, err := NewEgSQLDB(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		sql       string
+		wantErrIs error
+	}{
+		{name: "[Error] insert into system view", sql: "INSERT INTO information_schema.tables VALUES ('a', 'b', 'c')", wantErrIs: ErrSystemSchema},
+		{name: "[Error] create table in system schema", sql: "CREATE TABLE egsql_catalog.t (id INT PRIMARY KEY)", wantErrIs: ErrSystemSchema},
+		{name: "[Error] drop system view", sql: "DROP TABLE information_schema.columns", wantErrIs: ErrSystemSchema},
+		{name: "[Error] create system schema", sql: "CREATE SCHEMA information_schema", wantErrIs: ErrExistSchema},
+		{name: "[Error] drop system schema", sql: "DROP SCHEMA egsql_catalog CASCADE", wantErrIs: ErrSystemSchema},
+		{name: "[Error] select from view that does not exist", sql: "SELECT * FROM information_schema.views", wantErrIs: ErrNotExistTable},
+		{name: "[Error] select column that does not exist", sql: "SELECT name FROM information_schema.tables", wantErrIs: meta.ErrNotExistColumn},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stmt, _, err := query.Parse(tt.sql)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := db.Exec(nil, stmt, nil); !errors.Is(err, tt.wantErrIs) {
+				t.Errorf("Exec() error = %v, wantErrIs %v", err, tt.wantErrIs)
+			}
+		})
+	}
+}
@@ -0,0 +1,253 @@
+package dbms
+
+import (
+	"github.com/nao1215/egsql/dbms/meta"
+	"github.com/nao1215/egsql/dbms/storage"
+	"github.com/nao1215/egsql/misc/errfmt"
+)
+
+// Tx is a transaction. The changes are applied to the tables immediately
+// and undone by Rollback. Transactions are not isolated from each other yet,
+// so the uncommitted changes are visible to other transactions.
+type Tx struct {
+	db *EgSQLDB
+	// changes is the undo log of the transaction in the order of the changes.
+	changes []change
+	// deferred is the FOREIGN KEY checks that are deferred to commit.
+	deferred []fkCheck
+	// lastInsertID is the last value generated for the identity column.
+	lastInsertID int64
+	done         bool
+}
+
+// change is a change of one row. old is nil for insert, and new is nil for delete.
+type change struct {
+	table string
+	rowID int64
+	old   storage.Row
+	new   storage.Row
+}
+
+// Writer changes rows in a statement. It is valid only in the statement.
+type Writer struct {
+	tx *Tx
+}
+
+// Begin starts a transaction.
+func (db *EgSQLDB) Begin() *Tx {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	tx := &Tx{db: db}
+	db.txs[tx] = struct{}{}
+	return tx
+}
+
+// Statement executes fn as one statement in the transaction. The FOREIGN KEY
+// actions (CASCADE, SET NULL, SET DEFAULT) are applied and the constraints are
+// checked when fn returns, except the deferred constraints that are checked
+// at commit. If fn or the checks fail, all changes of the statement are undone.
+// fn must not call the methods of EgSQLDB; use Writer.Table to read rows.
+func (tx *Tx) Statement(fn func(w *Writer) error) error {
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.db.mutex.Lock()
+	defer tx.db.mutex.Unlock()
+
+	start := len(tx.changes)
+	tx.lastInsertID = 0
+	if err := fn(&Writer{tx: tx}); err != nil {
+		tx.undo(start)
+		return err
+	}
+
+	deferred, err := tx.enforceForeignKeys(start)
+	if err != nil {
+		tx.undo(start)
+		return err
+	}
+	tx.deferred = append(tx.deferred, deferred...)
+	return nil
+}
+
+// Commit checks the deferred FOREIGN KEY constraints and confirms the changes.
+// If a constraint is violated, the transaction is rolled back.
+func (tx *Tx) Commit() error {
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.db.mutex.Lock()
+	defer tx.db.mutex.Unlock()
+
+	tx.done = true
+	delete(tx.db.txs, tx)
+	for _, c := range tx.deferred {
+		if err := tx.verify(c); err != nil {
+			tx.undo(0)
+			return err
+		}
+	}
+	tx.changes = nil
+	tx.deferred = nil
+	return nil
+}
+
+// Rollback undoes all changes of the transaction.
+func (tx *Tx) Rollback() error {
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.db.mutex.Lock()
+	defer tx.db.mutex.Unlock()
+
+	tx.done = true
+	delete(tx.db.txs, tx)
+	tx.undo(0)
+	tx.deferred = nil
+	return nil
+}
+
+// undo undoes the changes after the start position of the undo log in reverse order.
+// Each change is undone to the state that was valid, so undo does not fail
+// unless the tables are changed outside the transaction.
+func (tx *Tx) undo(start int) {
+	for i := len(tx.changes) - 1; i >= start; i-- {
+		c := tx.changes[i]
+		t := tx.db.tables[c.table]
+		switch {
+		case c.old == nil:
+			_ = t.Delete(c.rowID)
+		case c.new == nil:
+			_ = t.Restore(c.rowID, c.old)
+		default:
+			_ = t.Update(c.rowID, c.old)
+		}
+	}
+	tx.changes = tx.changes[:start]
+}
+
+// changed reports whether the transaction has changed the table or
+// has the deferred FOREIGN KEY checks on it.
+func (tx *Tx) changed(table string) bool {
+	for _, c := range tx.changes {
+		if c.table == table {
+			return true
+		}
+	}
+	for _, c := range tx.deferred {
+		if c.child == table || c.fk.RefTable == table {
+			return true
+		}
+	}
+	return false
+}
+
+// LastInsertID returns the last value generated for the identity column
+// by the last statement. If no value is generated, 0 is returned.
+func (tx *Tx) LastInsertID() int64 {
+	return tx.lastInsertID
+}
+
+// Insert adds the row to the table and returns its row id.
+// If the table has the identity column and its value is NULL,
+// the value is generated by the sequence.
+func (w *Writer) Insert(tableName string, row storage.Row) (int64, error) {
+	t, err := w.Table(tableName)
+	if err != nil {
+		return 0, err
+	}
+	row, err = w.fillIdentity(t.Scheme(), row)
+	if err != nil {
+		return 0, err
+	}
+	rowID, err := t.Insert(row)
+	if err != nil {
+		return 0, err
+	}
+	w.tx.changes = append(w.tx.changes, change{table: tableName, rowID: rowID, new: row})
+	return rowID, nil
+}
+
+// fillIdentity returns the row whose identity column is generated by the sequence
+// if it is NULL. If the value is specified, the sequence is advanced beyond it
+// so that the generated values do not collide with it.
+func (w *Writer) fillIdentity(scheme *meta.Scheme, row storage.Row) (storage.Row, error) {
+	id := scheme.Identity
+	if id == nil {
+		return row, nil
+	}
+	pos := scheme.ColumnIndex(id.Column)
+	if pos < 0 || pos >= len(row) {
+		return row, nil
+	}
+
+	db := w.tx.db
+	if v, ok := row[pos].(int64); ok {
+		if id.Always {
+			return nil, errfmt.Wrap(ErrGeneratedAlways, id.Column)
+		}
+		seq := db.catalog.FetchSequence(id.Sequence)
+		if seq == nil {
+			return nil, errfmt.Wrap(ErrNotExistSequence, id.Sequence)
+		}
+		seq.Advance(v)
+		return row, db.reserve(seq)
+	}
+	if row[pos] != nil {
+		return row, nil
+	}
+
+	v, err := db.nextVal(id.Sequence)
+	if err != nil {
+		return nil, err
+	}
+	filled := append(storage.Row{}, row...)
+	filled[pos] = v
+	w.tx.lastInsertID = v
+	return filled, nil
+}
+
+// Update replaces the row with the specified row id in the table.
+func (w *Writer) Update(tableName string, rowID int64, row storage.Row) error {
+	t, err := w.Table(tableName)
+	if err != nil {
+		return err
+	}
+	old, ok := t.Get(rowID)
+	if !ok {
+		return storage.ErrNotExistRow
+	}
+	if err := t.Update(rowID, row); err != nil {
+		return err
+	}
+	w.tx.changes = append(w.tx.changes, change{table: tableName, rowID: rowID, old: old, new: row})
+	return nil
+}
+
+// Delete removes the row with the specified row id from the table.
+func (w *Writer) Delete(tableName string, rowID int64) error {
+	t, err := w.Table(tableName)
+	if err != nil {
+		return err
+	}
+	old, ok := t.Get(rowID)
+	if !ok {
+		return storage.ErrNotExistRow
+	}
+	if err := t.Delete(rowID); err != nil {
+		return err
+	}
+	w.tx.changes = append(w.tx.changes, change{table: tableName, rowID: rowID, old: old})
+	return nil
+}
+
+// Table returns the table with the specified name. It is used to read rows
+// in the statement because the methods of EgSQLDB can not be called in it.
+func (w *Writer) Table(name string) (*storage.Table, error) {
+	t, ok := w.tx.db.tables[name]
+	if !ok {
+		return nil, errfmt.Wrap(ErrNotExistTable, name)
+	}
+	return t, nil
+}
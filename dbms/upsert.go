@@ -0,0 +1,159 @@
+package dbms
+
+import (
+	"strings"
+
+	"github.com/nao1215/egsql/dbms/expr"
+	"github.com/nao1215/egsql/dbms/meta"
+	"github.com/nao1215/egsql/dbms/query"
+	"github.com/nao1215/egsql/dbms/storage"
+	"github.com/nao1215/egsql/misc/errfmt"
+	"github.com/nao1215/egsql/misc/slice"
+)
+
+// excludedTable is the name that qualifies the columns of the row to insert
+// in DO UPDATE of ON CONFLICT clause.
+const excludedTable = "excluded"
+
+// upsert is ON CONFLICT clause of INSERT statement bound to the table.
+type upsert struct {
+	table string
+	// indexes is the unique indexes whose keys are checked for the conflict.
+	indexes []meta.Index
+	// keys is the positions of the columns of each index in the row.
+	keys [][]int
+	// doNothing is true for DO NOTHING.
+	doNothing bool
+	// positions and values are the columns of DO UPDATE SET and their values.
+	// The values are evaluated for the existing row followed by the row to insert.
+	positions []int
+	values    []expr.Expr
+	// where is the condition of DO UPDATE, or nil.
+	where expr.Expr
+	env   *expr.Env
+	// touched is the row ids inserted or updated by the statement. DO UPDATE
+	// can not update them, because the result would depend on the row order.
+	touched map[int64]bool
+}
+
+// newUpsert binds ON CONFLICT clause. alias is the name that qualifies the
+// columns of the existing row.
+func (db *EgSQLDB) newUpsert(sess *Session, table, alias string, scheme *meta.Scheme, c *query.OnConflict, args []interface{}) (*upsert, error) {
+	u := &upsert{table: table, doNothing: c.DoNothing, env: &expr.Env{Args: args}, touched: map[int64]bool{}}
+	for _, idx := range scheme.Indexes {
+		if idx.Unique && (len(c.Columns) == 0 || sameColumns(idx.Columns, c.Columns)) {
+			u.indexes = append(u.indexes, idx)
+		}
+	}
+	if len(u.indexes) == 0 && len(c.Columns) > 0 {
+		return nil, errfmt.Wrap(ErrNoConflictTarget, strings.Join(c.Columns, ", "))
+	}
+	if !c.DoNothing && len(c.Columns) == 0 {
+		return nil, errfmt.Wrap(ErrNoConflictTarget, "DO UPDATE requires the conflict columns")
+	}
+	// A unique index may be defined on the same columns as another.
+	if len(c.Columns) > 0 {
+		u.indexes = u.indexes[:1]
+	}
+	for _, idx := range u.indexes {
+		key := make([]int, len(idx.Columns))
+		for i, col := range idx.Columns {
+			key[i] = scheme.ColumnIndex(col)
+		}
+		u.keys = append(u.keys, key)
+	}
+	if c.DoNothing {
+		return u, nil
+	}
+
+	columns := make(expr.Columns, 0, 2*len(scheme.ColumnNames))
+	for i, name := range scheme.ColumnNames {
+		columns = append(columns, expr.ColumnInfo{Table: alias, Name: name, T: expr.TypeOf(scheme.ColumnDataTypes[i])})
+	}
+	for i, name := range scheme.ColumnNames {
+		columns = append(columns, expr.ColumnInfo{Table: excludedTable, Name: name, T: expr.TypeOf(scheme.ColumnDataTypes[i]), Hidden: true})
+	}
+	b := &expr.Binder{Scope: columns, Funcs: db.funcBinder(sess), Aggregates: db.funcs}
+	var err error
+	if u.positions, u.values, err = bindAssignments(b, scheme, c.Set); err != nil {
+		return nil, err
+	}
+	if c.Where != nil {
+		where, err := b.BindAs(c.Where, expr.Bool)
+		if err != nil {
+			return nil, err
+		}
+		u.where = where
+	}
+	return u, nil
+}
+
+// sameColumns reports whether the column lists have the same columns in any order.
+func sameColumns(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, c := range a {
+		if !slice.Contains(b, c) {
+			return false
+		}
+	}
+	return true
+}
+
+// conflict returns the row id of the existing row whose key equals that of
+// the row in any of the indexes. ok is false if there is no such row.
+func (u *upsert) conflict(t *storage.Table, row storage.Row) (id int64, ok bool, err error) {
+	for i, idx := range u.indexes {
+		key := make(storage.Row, len(u.keys[i]))
+		for j, pos := range u.keys[i] {
+			key[j] = row[pos]
+		}
+		ids, err := t.Lookup(idx.Name, key)
+		if err != nil {
+			return 0, false, err
+		}
+		if len(ids) > 0 {
+			return ids[0], true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// update takes the action for the existing row that conflicts with the row
+// to insert, and reports whether the existing row is updated.
+func (u *upsert) update(w *Writer, t *storage.Table, id int64, row storage.Row) (bool, error) {
+	if u.doNothing {
+		return false, nil
+	}
+	if u.touched[id] {
+		return false, ErrConflictTwice
+	}
+	old, ok := t.Get(id)
+	if !ok {
+		return false, storage.ErrNotExistRow
+	}
+	in := append(append(make([]interface{}, 0, len(old)+len(row)), old...), row...)
+	if u.where != nil {
+		v, err := u.where.Eval(u.env, in)
+		if err != nil {
+			return false, err
+		}
+		if v != true {
+			return false, nil
+		}
+	}
+	updated := append(storage.Row{}, old...)
+	for i, pos := range u.positions {
+		v, err := u.values[i].Eval(u.env, in)
+		if err != nil {
+			return false, err
+		}
+		updated[pos] = v
+	}
+	if err := w.Update(u.table, id, updated); err != nil {
+		return false, err
+	}
+	u.touched[id] = true
+	return true, nil
+}
@@ -0,0 +1,162 @@
+package dbms
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nao1215/egsql/dbms/expr"
+	"github.com/nao1215/egsql/dbms/query"
+)
+
+func TestEgSQLDB_SelectWindow(t *testing.T) {
+	db, err := NewEgSQLDB(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sql := range []string{
+		"CREATE TABLE scores (id INT PRIMARY KEY, team TEXT, player TEXT, score INT)",
+		"INSERT INTO scores VALUES (1, 'red', 'alice', 30), (2, 'red', 'bob', 50), (3, 'red', 'carol', 30), " +
+			"(4, 'blue', 'dave', 40), (5, 'blue', 'erin', NULL), (6, 'blue', 'frank', 20)",
+	} {
+		if _, err := execSQL(t, db, sql); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		sql         string
+		wantColumns []string
+		wantRows    [][]interface{}
+		wantErr     error
+	}{
+		{
+			name: "[Success] leaderboard ranks",
+			sql: "SELECT player, ROW_NUMBER() OVER (ORDER BY score DESC NULLS LAST, id) AS n, " +
+				"RANK() OVER (ORDER BY score DESC NULLS LAST), DENSE_RANK() OVER (ORDER BY score DESC NULLS LAST) " +
+				"FROM scores ORDER BY n",
+			wantColumns: []string{"player", "n", "rank", "dense_rank"},
+			wantRows: [][]interface{}{
+				{"bob", int64(1), int64(1), int64(1)},
+				{"dave", int64(2), int64(2), int64(2)},
+				{"alice", int64(3), int64(3), int64(3)},
+				{"carol", int64(4), int64(3), int64(3)},
+				{"frank", int64(5), int64(5), int64(4)},
+				{"erin", int64(6), int64(6), int64(5)},
+			},
+		},
+		{
+			name: "[Success] rank in partition",
+			sql: "SELECT team, player, RANK() OVER (PARTITION BY team ORDER BY score DESC) FROM scores " +
+				"WHERE score IS NOT NULL ORDER BY team, 3, player",
+			wantColumns: []string{"team", "player", "rank"},
+			wantRows: [][]interface{}{
+				{"blue", "dave", int64(1)},
+				{"blue", "frank", int64(2)},
+				{"red", "bob", int64(1)},
+				{"red", "alice", int64(2)},
+				{"red", "carol", int64(2)},
+			},
+		},
+		{
+			name:        "[Success] difference from previous row with lag and lead",
+			sql:         "SELECT id, score - LAG(score) OVER (ORDER BY id), LEAD(score, 2, 0) OVER (ORDER BY id) FROM scores ORDER BY id",
+			wantColumns: []string{"id", "?column?", "lead"},
+			wantRows: [][]interface{}{
+				{int64(1), nil, int64(30)},
+				{int64(2), int64(20), int64(40)},
+				{int64(3), int64(-20), nil},
+				{int64(4), int64(10), int64(20)},
+				{int64(5), nil, int64(0)},
+				{int64(6), nil, int64(0)},
+			},
+		},
+		{
+			name:        "[Success] running total and partition total",
+			sql:         "SELECT id, SUM(score) OVER (PARTITION BY team ORDER BY id), COUNT(*) OVER (PARTITION BY team) FROM scores ORDER BY id",
+			wantColumns: []string{"id", "sum", "count"},
+			wantRows: [][]interface{}{
+				{int64(1), int64(30), int64(3)},
+				{int64(2), int64(80), int64(3)},
+				{int64(3), int64(110), int64(3)},
+				{int64(4), int64(40), int64(3)},
+				{int64(5), int64(40), int64(3)},
+				{int64(6), int64(60), int64(3)},
+			},
+		},
+		{
+			name: "[Success] moving frame with rows between",
+			sql: "SELECT id, SUM(score) OVER (ORDER BY id ROWS BETWEEN 1 PRECEDING AND 1 FOLLOWING), " +
+				"MAX(score) OVER (ORDER BY id ROWS 1 PRECEDING) FROM scores ORDER BY id",
+			wantColumns: []string{"id", "sum", "max"},
+			wantRows: [][]interface{}{
+				{int64(1), int64(80), int64(30)},
+				{int64(2), int64(110), int64(50)},
+				{int64(3), int64(120), int64(50)},
+				{int64(4), int64(70), int64(40)},
+				{int64(5), int64(60), int64(40)},
+				{int64(6), int64(20), int64(20)},
+			},
+		},
+		{
+			name: "[Success] first and last value of frames",
+			sql: "SELECT player, FIRST_VALUE(player) OVER (PARTITION BY team ORDER BY id), " +
+				"LAST_VALUE(player) OVER (PARTITION BY team ORDER BY id ROWS BETWEEN CURRENT ROW AND UNBOUNDED FOLLOWING) " +
+				"FROM scores WHERE team = 'red' ORDER BY id",
+			wantColumns: []string{"player", "first_value", "last_value"},
+			wantRows: [][]interface{}{
+				{"alice", "alice", "carol"},
+				{"bob", "alice", "carol"},
+				{"carol", "alice", "carol"},
+			},
+		},
+		{
+			name:        "[Success] window function over grouped rows",
+			sql:         "SELECT team, SUM(score), RANK() OVER (ORDER BY SUM(score) DESC) FROM scores GROUP BY team ORDER BY 3",
+			wantColumns: []string{"team", "sum", "rank"},
+			wantRows:    [][]interface{}{{"red", int64(110), int64(1)}, {"blue", int64(60), int64(2)}},
+		},
+		{
+			name:    "[Error] window function in WHERE clause",
+			sql:     "SELECT id FROM scores WHERE ROW_NUMBER() OVER (ORDER BY id) = 1",
+			wantErr: expr.ErrMisplacedWindow,
+		},
+		{
+			name:    "[Error] nested window function",
+			sql:     "SELECT SUM(RANK() OVER (ORDER BY id)) OVER () FROM scores",
+			wantErr: expr.ErrMisplacedWindow,
+		},
+		{
+			name:    "[Error] frame that starts after it ends",
+			sql:     "SELECT SUM(score) OVER (ORDER BY id ROWS BETWEEN CURRENT ROW AND 1 PRECEDING) FROM scores",
+			wantErr: expr.ErrInvalidFrame,
+		},
+		{
+			name:    "[Error] not a window function",
+			sql:     "SELECT UPPER(player) OVER () FROM scores",
+			wantErr: expr.ErrNotSupportedFunction,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stmt, _, err := query.Parse(tt.sql)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rs, err := db.Exec(NewSession(), stmt, nil)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Exec() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(tt.wantColumns, rs.ColumnNames); diff != "" {
+				t.Errorf("ColumnNames mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.wantRows, rs.Rows); diff != "" {
+				t.Errorf("Rows mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
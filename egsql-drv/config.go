@@ -23,17 +23,17 @@ const (
 func (c *config) setHomeDirPath() error {
 	home, ok := os.LookupEnv(EnvVarHome)
 	if !ok {
-		home, err := os.UserHomeDir()
+		userHome, err := os.UserHomeDir()
 		if err != nil {
 			return errfmt.Wrap(ErrNotGetEgSQLHomeDir, err.Error())
 		}
-		home = filepath.Join(home, ".egsql")
+		home = filepath.Join(userHome, ".egsql")
 	}
 	c.homeDir = home
 	return nil
 }
 
-// 	CreateHomeDirIfNeeded creates the egsql home directory if needed.
+// createHomeDirIfNeeded creates the egsql home directory if needed.
 func (c *config) createHomeDirIfNeeded() error {
 	if c.homeDir == "" {
 		if err := c.setHomeDirPath(); err != nil {
@@ -41,7 +41,7 @@ func (c *config) createHomeDirIfNeeded() error {
 		}
 	}
 	if !file.IsDir(c.homeDir) {
-		err := os.Mkdir(c.homeDir, 0644)
+		err := os.MkdirAll(c.homeDir, 0755)
 		if err != nil {
 			return errfmt.Wrap(ErrNotCreateEgSQLHomeDir, err.Error())
 		}
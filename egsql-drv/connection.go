@@ -1,18 +1,34 @@
 package egsql
 
-import "database/sql/driver"
+import (
+	"database/sql/driver"
 
-type egsqlConn struct{}
+	"github.com/nao1215/egsql/dbms"
+)
+
+type egsqlConn struct {
+	db *dbms.EgSQLDB
+	// session has the transaction in progress and the search path of the connection.
+	session *dbms.Session
+}
 
 // Prepare returns a prepared statement, bound to this connection.
-func (c *egsqlConn) Prepare(query string) (driver.Stmt, error) {
-	return &egsqlStmt{}, nil
+func (c *egsqlConn) Prepare(q string) (driver.Stmt, error) {
+	stmt := &egsqlStmt{conn: c, query: q}
+	if err := stmt.prepare(); err != nil {
+		return nil, err
+	}
+	return stmt, nil
 }
 
 // Begin starts and returns a new transaction.
 // Deprecated: Drivers should implement ConnBeginTx instead (or additionally).
 func (c *egsqlConn) Begin() (driver.Tx, error) {
-	return &egsqlTx{}, nil
+	if c.session.Tx != nil {
+		return nil, ErrTxInProgress
+	}
+	c.session.Tx = c.db.Begin()
+	return &egsqlTx{conn: c}, nil
 }
 
 // Close invalidates and potentially stops any current
@@ -27,5 +43,9 @@ func (c *egsqlConn) Begin() (driver.Tx, error) {
 // Drivers must ensure all network calls made by Close
 // do not block indefinitely (e.g. apply a timeout).
 func (c *egsqlConn) Close() (err error) {
-	return nil
+	if c.session.Tx != nil {
+		err = c.session.Tx.Rollback()
+		c.session.Tx = nil
+	}
+	return err
 }
@@ -3,16 +3,101 @@ package egsql
 import (
 	"context"
 	"database/sql/driver"
+	"sync"
+
+	"github.com/nao1215/egsql/dbms"
 )
 
 type connector struct {
 	cfg *Config // immutable private copy.
+	// funcs and aggs are the functions registered in the database at the first connection.
+	funcs []*dbms.Function
+	aggs  []*dbms.AggregateFunction
+	// register registers the functions once, and registerErr is its error.
+	register    sync.Once
+	registerErr error
+}
+
+// ConnectorOption configures the connector returned by NewConnector.
+type ConnectorOption func(c *connector) error
+
+// WithFunc registers the Go function as the scalar function of the name in
+// the database. See RegisterFunc for the functions that can be registered.
+// The function is registered at the first connection, and like RegisterFunc
+// it is shared by all connections to the same home directory in the process.
+func WithFunc(name string, fn interface{}) ConnectorOption {
+	return func(c *connector) error {
+		f, err := newFunction(name, fn)
+		if err != nil {
+			return err
+		}
+		c.funcs = append(c.funcs, f)
+		return nil
+	}
+}
+
+// WithAggregate registers the aggregate function of the name in the database.
+// See RegisterAggregate for the aggregators that can be registered. It is
+// shared by all connections to the same home directory like WithFunc.
+func WithAggregate(name string, newAggregator interface{}) ConnectorOption {
+	return func(c *connector) error {
+		f, err := newAggregateFunction(name, newAggregator)
+		if err != nil {
+			return err
+		}
+		c.aggs = append(c.aggs, f)
+		return nil
+	}
+}
+
+// NewConnector returns the connector of the DSN configured by the options,
+// which is opened by sql.OpenDB.
+func NewConnector(dsn string, opts ...ConnectorOption) (driver.Connector, error) {
+	cfg, err := ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	c := &connector{cfg: cfg}
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
 }
 
 // Connect implements driver.Connector interface.
 // Connect returns a connection to the database.
 func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
-	return &egsqlConn{}, nil
+	db, err := openDB(c.cfg.HomeDir)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.registerFuncs(db); err != nil {
+		return nil, err
+	}
+	session := dbms.NewSession(c.cfg.SearchPath...)
+	session.MaxRecursionDepth = c.cfg.MaxRecursionDepth
+	session.WorkMem = c.cfg.WorkMem
+	return &egsqlConn{db: db, session: session}, nil
+}
+
+// registerFuncs registers the functions of the options in the database at
+// the first call, and returns the error of the registration.
+func (c *connector) registerFuncs(db *dbms.EgSQLDB) error {
+	c.register.Do(func() {
+		for _, f := range c.funcs {
+			if c.registerErr = db.RegisterFunction(f); c.registerErr != nil {
+				return
+			}
+		}
+		for _, f := range c.aggs {
+			if c.registerErr = db.RegisterAggregateFunction(f); c.registerErr != nil {
+				return
+			}
+		}
+	})
+	return c.registerErr
 }
 
 // Driver implements driver.Connector interface.
@@ -0,0 +1,9 @@
+// Package egsql is the database/sql driver of egsql. The data source name
+// is the egsql home directory with the options (see ParseDSN), and the
+// connections to the same directory share the database in the process.
+//
+// egsql persists only the catalog in the home directory: the schemas, the
+// tables, the sequences and the statistics collected by ANALYZE. The rows of
+// the tables are held in memory, so they are lost when the process exits,
+// and the tables are empty when the database is opened again.
+package egsql
@@ -1,14 +1,29 @@
 package egsql
 
 import (
+	"context"
 	"database/sql"
 	"database/sql/driver"
+	"path/filepath"
+	"sync"
+
+	"github.com/nao1215/egsql/dbms"
 )
 
 // Driver is exported to make the sql driver directly accessible.
 // In general the driver is used via the database/sql package.
 type Driver struct{}
 
+var (
+	// databases is the opened databases. Key is the absolute and clean path of
+	// the egsql home directory, so that the paths to the same directory share
+	// the database.
+	// The connections to the same home directory share the database because
+	// the tables are held in memory, and so do the functions registered in it.
+	databases = make(map[string]*dbms.EgSQLDB)
+	dbMutex   sync.Mutex
+)
+
 // init registers the egsql driver using database/sql.Register().
 func init() {
 	sql.Register("egsql", &Driver{})
@@ -16,10 +31,38 @@ func init() {
 
 // Open new Connection.
 func (d Driver) Open(dsn string) (driver.Conn, error) {
-	return &egsqlConn{}, nil
+	c, err := d.OpenConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return c.Connect(context.Background())
 }
 
 // OpenConnector implements driver.DriverContext.
 func (d Driver) OpenConnector(dsn string) (driver.Connector, error) {
-	return &connector{}, nil
+	return NewConnector(dsn)
+}
+
+// openDB returns the database in the home directory. The database is opened
+// at the first call, and the same database is returned after that. The
+// database locks the directory, so another process can not open it.
+func openDB(homeDir string) (*dbms.EgSQLDB, error) {
+	// filepath.Abs also cleans the path, e.g. removes the trailing separator.
+	homeDir, err := filepath.Abs(homeDir)
+	if err != nil {
+		return nil, err
+	}
+
+	dbMutex.Lock()
+	defer dbMutex.Unlock()
+
+	if db, ok := databases[homeDir]; ok {
+		return db, nil
+	}
+	db, err := dbms.NewEgSQLDB(homeDir)
+	if err != nil {
+		return nil, err
+	}
+	databases[homeDir] = db
+	return db, nil
 }
@@ -0,0 +1,295 @@
+package egsql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDriver_LastInsertId(t *testing.T) {
+	db, err := sql.Open("egsql", t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec("CREATE TABLE users (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []int64{1, 2} {
+		res, err := db.Exec("INSERT INTO users (name) VALUES (?)", []byte("gopher"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := res.LastInsertId()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("insert %d: LastInsertId() = %d, want %d", i, got, want)
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := tx.Exec("INSERT INTO users (name) VALUES ('rollback')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := res.LastInsertId(); got != 3 {
+		t.Errorf("LastInsertId() in tx = %d, want 3", got)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDriver_QueryInformationSchema(t *testing.T) {
+	db, err := sql.Open("egsql", t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec("CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT DEFAULT 'anonymous')"); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := db.Query("SELECT table_name, column_name, ordinal_position, column_default FROM information_schema.columns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	type column struct {
+		name     string
+		position int64
+		def      sql.NullString
+	}
+	var got []column
+	for rows.Next() {
+		var table string
+		var c column
+		if err := rows.Scan(&table, &c.name, &c.position, &c.def); err != nil {
+			t.Fatal(err)
+		}
+		if table == "users" {
+			got = append(got, c)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	want := []column{
+		{name: "id", position: 1},
+		{name: "name", position: 2, def: sql.NullString{String: "anonymous", Valid: true}},
+	}
+	if diff := cmp.Diff(want, got, cmp.AllowUnexported(column{})); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestDriver_QueryExplain(t *testing.T) {
+	db, err := sql.Open("egsql", t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec("CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := db.Query("EXPLAIN SELECT name FROM users WHERE id = ?", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"QUERY PLAN"}, columns); diff != "" {
+		t.Errorf("columns mismatch (-want +got):\n%s", diff)
+	}
+	var got []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, line)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"Project (name)",
+		"  -> Filter (cond: (id = CAST($1 AS int)))",
+		"       -> Seq Scan on users (rows=0)",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("plan mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestDriver_QueryBatches(t *testing.T) {
+	db, err := sql.Open("egsql", t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec("CREATE TABLE numbers (n INTEGER PRIMARY KEY)"); err != nil {
+		t.Fatal(err)
+	}
+	const count = 2500
+	for i := 1; i <= count; i++ {
+		if _, err := db.Exec("INSERT INTO numbers VALUES (?)", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rows, err := db.Query("SELECT n FROM numbers ORDER BY n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var want int64
+	for rows.Next() {
+		var n int64
+		if err := rows.Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		if want++; n != want {
+			t.Fatalf("row %d = %d, want %d", want, n, want)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if want != count {
+		t.Errorf("got %d rows, want %d", want, count)
+	}
+}
+
+func TestDriver_QueryContext_Cancel(t *testing.T) {
+	home := t.TempDir()
+	db, err := sql.Open("egsql", home+"?work_mem=1kB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec("CREATE TABLE numbers (n INTEGER PRIMARY KEY)"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 2000; i++ {
+		if _, err := db.Exec("INSERT INTO numbers VALUES (?)", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rows, err := db.QueryContext(ctx, "SELECT n FROM numbers ORDER BY n DESC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tempDir := filepath.Join(home, "tmp")
+	if files, _ := os.ReadDir(tempDir); len(files) == 0 {
+		t.Error("ORDER BY does not spill the rows with work_mem=1kB")
+	}
+	if !rows.Next() {
+		t.Fatal(rows.Err())
+	}
+	cancel()
+	for rows.Next() {
+	}
+	if err := rows.Err(); !errors.Is(err, context.Canceled) {
+		t.Errorf("rows.Err() = %v, want %v", err, context.Canceled)
+	}
+	if err := rows.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := os.ReadDir(tempDir); len(files) != 0 {
+		t.Errorf("temporary files are left: %v", files)
+	}
+}
+
+func TestDriver_PlanCache(t *testing.T) {
+	db, err := sql.Open("egsql", t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec("CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 3; i++ {
+		if _, err := db.Exec("INSERT INTO users VALUES (?, 'gopher')", i); err != nil {
+			t.Fatal(err)
+		}
+		// The cached plan of the SELECT reads the row inserted after it is planned.
+		var count int64
+		if err := db.QueryRow("SELECT count(*) FROM users WHERE id <= ?", i).Scan(&count); err != nil {
+			t.Fatal(err)
+		}
+		if count != int64(i) {
+			t.Errorf("count = %d, want %d", count, i)
+		}
+	}
+
+	var hits, misses int64
+	if err := db.QueryRow("SELECT hits, misses FROM egsql_catalog.egsql_plan_cache").Scan(&hits, &misses); err != nil {
+		t.Fatal(err)
+	}
+	// The first SELECT count(*) and this SELECT are planned, and the other
+	// SELECT count(*) reuse the cached plan.
+	if hits != 2 || misses != 2 {
+		t.Errorf("hits = %d, misses = %d, want 2, 2", hits, misses)
+	}
+}
+
+func TestDriver_SameHomeDir(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rel, err := filepath.Rel(wd, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The paths to the same directory share the database, so the DDL through
+	// one handle is not overwritten by the other.
+	var dbs []*sql.DB
+	for _, dsn := range []string{dir, dir + string(filepath.Separator), rel} {
+		db, err := sql.Open("egsql", dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		dbs = append(dbs, db)
+	}
+	for i, db := range dbs {
+		if _, err := db.Exec(fmt.Sprintf("CREATE TABLE t%d (id INTEGER PRIMARY KEY)", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := range dbs {
+		if _, err := dbs[0].Exec(fmt.Sprintf("INSERT INTO t%d VALUES (1)", i)); err != nil {
+			t.Errorf("table t%d is not shared: %v", i, err)
+		}
+	}
+}
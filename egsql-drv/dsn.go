@@ -1,4 +1,79 @@
 package egsql
 
+import (
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/nao1215/egsql/dbms"
+	"github.com/nao1215/egsql/dbms/query"
+	"github.com/nao1215/egsql/misc/errfmt"
+)
+
 // Config is a configuration parsed from a DSN string.
-type Config struct{}
+type Config struct {
+	// HomeDir is the egsql home directory path where the database files are stored.
+	HomeDir string
+	// SearchPath is the schemas searched for the unqualified table names.
+	// The names follow the identifier rules of SQL, so they are folded to
+	// lower case unless quoted. If it is empty, only the default schema
+	// "public" is searched.
+	SearchPath []string
+	// MaxRecursionDepth is the maximum number of the iterations of the
+	// recursive query. 0 means no limit.
+	MaxRecursionDepth int
+	// WorkMem is the bytes of the rows that an operator of the query keeps in
+	// memory, e.g. for ORDER BY, before it writes them to the temporary files
+	// under the home directory. 0 means the default.
+	WorkMem int64
+}
+
+// ParseDSN parses the DSN string to a Config.
+// The DSN is the egsql home directory path followed by the optional
+// parameters like "/path/to/home?search_path=sales,public&max_recursion_depth=100&work_mem=64MB". If the path
+// is empty, the directory specified by EGSQL_HOME or "$HOME/.egsql" is used.
+func ParseDSN(dsn string) (*Config, error) {
+	path, rawQuery := dsn, ""
+	if i := strings.Index(dsn, "?"); i >= 0 {
+		path, rawQuery = dsn[:i], dsn[i+1:]
+	}
+	params, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, errfmt.Wrap(ErrInvalidDSN, err.Error())
+	}
+
+	cfg := &Config{MaxRecursionDepth: dbms.DefaultMaxRecursionDepth}
+	for key, values := range params {
+		switch key {
+		case "search_path":
+			for _, v := range strings.Split(values[len(values)-1], ",") {
+				name, err := query.ParseObjectName(v)
+				if err != nil || name.Schema != "" {
+					return nil, errfmt.Wrap(ErrInvalidDSN, "invalid search_path "+v)
+				}
+				cfg.SearchPath = append(cfg.SearchPath, name.Name)
+			}
+		case "max_recursion_depth":
+			n, err := strconv.Atoi(values[len(values)-1])
+			if err != nil || n < 0 {
+				return nil, errfmt.Wrap(ErrInvalidDSN, "invalid max_recursion_depth "+values[len(values)-1])
+			}
+			cfg.MaxRecursionDepth = n
+		case "work_mem":
+			n, err := dbms.ParseWorkMem(values[len(values)-1])
+			if err != nil {
+				return nil, errfmt.Wrap(ErrInvalidDSN, "invalid work_mem "+values[len(values)-1])
+			}
+			cfg.WorkMem = n
+		default:
+			return nil, errfmt.Wrap(ErrInvalidDSN, "unknown parameter "+key)
+		}
+	}
+
+	c := &config{homeDir: path}
+	if err := c.createHomeDirIfNeeded(); err != nil {
+		return nil, err
+	}
+	cfg.HomeDir = c.homeDir
+	return cfg, nil
+}
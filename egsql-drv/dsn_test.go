@@ -0,0 +1,70 @@
+package egsql
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/nao1215/egsql/dbms"
+)
+
+func TestParseDSN(t *testing.T) {
+	home := t.TempDir()
+	tests := []struct {
+		name    string
+		dsn     string
+		want    *Config
+		wantErr error
+	}{
+		{
+			name: "[Success] home directory only",
+			dsn:  home,
+			want: &Config{HomeDir: home, MaxRecursionDepth: dbms.DefaultMaxRecursionDepth},
+		},
+		{
+			name: "[Success] create home directory with search_path",
+			dsn:  filepath.Join(home, "new") + "?search_path=sales,%20public",
+			want: &Config{
+				HomeDir: filepath.Join(home, "new"), SearchPath: []string{"sales", "public"},
+				MaxRecursionDepth: dbms.DefaultMaxRecursionDepth,
+			},
+		},
+		{
+			name: "[Success] max_recursion_depth",
+			dsn:  home + "?max_recursion_depth=0",
+			want: &Config{HomeDir: home},
+		},
+		{
+			name: "[Success] work_mem",
+			dsn:  home + "?work_mem=64kB",
+			want: &Config{HomeDir: home, MaxRecursionDepth: dbms.DefaultMaxRecursionDepth, WorkMem: 64 << 10},
+		},
+		{
+			name:    "[Error] invalid work_mem",
+			dsn:     home + "?work_mem=0",
+			wantErr: ErrInvalidDSN,
+		},
+		{
+			name:    "[Error] negative max_recursion_depth",
+			dsn:     home + "?max_recursion_depth=-1",
+			wantErr: ErrInvalidDSN,
+		},
+		{
+			name:    "[Error] unknown parameter",
+			dsn:     home + "?user=root",
+			wantErr: ErrInvalidDSN,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseDSN(tt.dsn)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParseDSN() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("ParseDSN() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
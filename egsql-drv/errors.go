@@ -9,4 +9,16 @@ var (
 	// ErrNotCreateEgSQLHomeDir means that the egsql home directory
 	// could not be created.
 	ErrNotCreateEgSQLHomeDir = errors.New("not create egsql home dirctory")
+	// ErrInvalidDSN means that the DSN string can not be parsed.
+	ErrInvalidDSN = errors.New("invalid dsn")
+	// ErrTxInProgress means that a transaction is started while
+	// the other transaction of the connection is in progress.
+	ErrTxInProgress = errors.New("transaction is already in progress")
+	// ErrNotSupportedValue means that the type of the argument can not be stored in egsql.
+	ErrNotSupportedValue = errors.New("not supported value type")
+	// ErrNotSupportedFuncType means that the Go function can not be registered
+	// as the SQL function because of the types of its parameters or results.
+	ErrNotSupportedFuncType = errors.New("not supported function type")
+	// ErrNotEgSQLDB means that the database is not opened by the egsql driver.
+	ErrNotEgSQLDB = errors.New("database is not opened by egsql driver")
 )
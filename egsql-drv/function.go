@@ -0,0 +1,331 @@
+package egsql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/nao1215/egsql/dbms"
+	"github.com/nao1215/egsql/dbms/expr"
+	"github.com/nao1215/egsql/misc/errfmt"
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// RegisterFunc registers the Go function fn as the scalar function of the name
+// in the database opened by the egsql driver, e.g.
+//
+//	egsql.RegisterFunc(db, "slugify", func(s string) string { ... })
+//
+// The parameters and the result of fn are integers, string, []byte or the
+// pointers to them, and fn may also return an error as the last result.
+// Floats and bool are rejected because egsql has no such SQL types. The
+// arguments are converted from the SQL values, and the result is converted
+// by the rules of driver.Value. NULL is passed to the pointer as nil. If a
+// parameter is not a pointer, fn is not called for NULL and the result is NULL.
+//
+// The function is registered in the database of the home directory, which is
+// shared by all connections to it in the process, including those of other
+// sql.DB. It replaces the function of the same name registered before.
+func RegisterFunc(db *sql.DB, name string, fn interface{}) error {
+	f, err := newFunction(name, fn)
+	if err != nil {
+		return err
+	}
+	return withEgSQLDB(db, func(egdb *dbms.EgSQLDB) error {
+		return egdb.RegisterFunction(f)
+	})
+}
+
+// RegisterAggregate registers the aggregate function of the name in the
+// database opened by the egsql driver. newAggregator returns a new aggregator
+// for each group, which has the method Step called with the arguments of each
+// row, and the method Final that returns the result of the group. Step may
+// return an error, and Final may return an error as the last result. The
+// arguments and the result are converted as those of RegisterFunc. The row
+// whose argument is NULL is not passed to Step unless the parameter is a
+// pointer. The function is shared and replaced like that of RegisterFunc.
+func RegisterAggregate(db *sql.DB, name string, newAggregator interface{}) error {
+	f, err := newAggregateFunction(name, newAggregator)
+	if err != nil {
+		return err
+	}
+	return withEgSQLDB(db, func(egdb *dbms.EgSQLDB) error {
+		return egdb.RegisterAggregateFunction(f)
+	})
+}
+
+// withEgSQLDB calls fn with the egsql database that db is connected to.
+func withEgSQLDB(db *sql.DB, fn func(*dbms.EgSQLDB) error) error {
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Raw(func(driverConn interface{}) error {
+		c, ok := driverConn.(*egsqlConn)
+		if !ok {
+			return ErrNotEgSQLDB
+		}
+		return fn(c.db)
+	})
+}
+
+// newFunction returns the scalar function that calls the Go function.
+func newFunction(name string, fn interface{}) (*dbms.Function, error) {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func {
+		return nil, errfmt.Wrap(ErrNotSupportedFuncType, fmt.Sprintf("%s is %T, not a function", name, fn))
+	}
+	sig, err := newGoSignature(name, v.Type(), 0, true)
+	if err != nil {
+		return nil, err
+	}
+	return &dbms.Function{
+		Name: name, Params: sig.sqlParams(), MinArgs: sig.minArgs(), Variadic: sig.variadic,
+		Result: sig.result, CalledOnNull: true,
+		Fn: func(args []interface{}) (interface{}, error) {
+			return sig.call(v, args)
+		},
+	}, nil
+}
+
+// newAggregateFunction returns the aggregate function that calls the methods
+// of the aggregators returned by newAggregator.
+func newAggregateFunction(name string, newAggregator interface{}) (*dbms.AggregateFunction, error) {
+	v := reflect.ValueOf(newAggregator)
+	if v.Kind() != reflect.Func || v.Type().NumIn() != 0 || v.Type().NumOut() != 1 {
+		return nil, errfmt.Wrap(ErrNotSupportedFuncType, name+" needs func() returning an aggregator")
+	}
+	t := v.Type().Out(0)
+	stepMethod, ok := t.MethodByName("Step")
+	if !ok {
+		return nil, errfmt.Wrap(ErrNotSupportedFuncType, t.String()+" has no Step method")
+	}
+	finalMethod, ok := t.MethodByName("Final")
+	if !ok {
+		return nil, errfmt.Wrap(ErrNotSupportedFuncType, t.String()+" has no Final method")
+	}
+	// The method type of the concrete type has the receiver as the first parameter.
+	skip := 1
+	if t.Kind() == reflect.Interface {
+		skip = 0
+	}
+	step, err := newGoSignature(name, stepMethod.Type, skip, false)
+	if err != nil {
+		return nil, err
+	}
+	final, err := newGoSignature(name, finalMethod.Type, skip, true)
+	if err != nil {
+		return nil, err
+	}
+	if len(final.params) > 0 {
+		return nil, errfmt.Wrap(ErrNotSupportedFuncType, "Final of "+name+" must have no parameter")
+	}
+	return &dbms.AggregateFunction{
+		Name: name, Params: step.sqlParams(), MinArgs: step.minArgs(), Variadic: step.variadic,
+		Result: final.result, CalledOnNull: true,
+		New: func() expr.Accumulator {
+			agg := v.Call(nil)[0]
+			return &goAggregator{step: step, final: final, agg: agg}
+		},
+	}, nil
+}
+
+// goAggregator is the accumulator that calls the methods of the Go aggregator.
+type goAggregator struct {
+	step, final *goSignature
+	agg         reflect.Value
+}
+
+// Step calls the Step method with the values of the arguments.
+func (a *goAggregator) Step(args []interface{}) error {
+	_, err := a.step.call(a.agg.MethodByName("Step"), args)
+	return err
+}
+
+// Result calls the Final method.
+func (a *goAggregator) Result() (interface{}, error) {
+	return a.final.call(a.agg.MethodByName("Final"), nil)
+}
+
+// goParam is the parameter of the Go function.
+type goParam struct {
+	t reflect.Type
+	// sqlType is the type of the SQL value that the argument is converted from.
+	sqlType expr.Type
+	// nullable is a flag indicating whether the parameter takes NULL as nil.
+	nullable bool
+}
+
+// newGoParam returns the parameter of the Go type.
+func newGoParam(t reflect.Type) (goParam, error) {
+	p := goParam{t: t, nullable: t.Kind() == reflect.Ptr}
+	var err error
+	if p.sqlType, err = sqlTypeOf(t); err != nil {
+		return p, err
+	}
+	return p, nil
+}
+
+// sqlTypeOf returns the type of the SQL value of the Go type or the pointer to it.
+func sqlTypeOf(t reflect.Type) (expr.Type, error) {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return expr.Int, nil
+	case reflect.Float32, reflect.Float64:
+		return expr.Unknown, errfmt.Wrap(ErrNotSupportedFuncType, "type "+t.String()+": egsql has no floating-point type")
+	case reflect.Bool:
+		return expr.Unknown, errfmt.Wrap(ErrNotSupportedFuncType, "type bool: use an integer type for 1 and 0")
+	case reflect.String:
+		return expr.Varchar, nil
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return expr.Varchar, nil
+		}
+	}
+	return expr.Unknown, errfmt.Wrap(ErrNotSupportedFuncType, "type "+t.String())
+}
+
+// convert converts the SQL value to the argument. It returns false if the
+// value is NULL and the parameter is not nullable.
+func (p goParam) convert(v interface{}) (reflect.Value, bool, error) {
+	if v == nil {
+		return reflect.Zero(p.t), p.nullable, nil
+	}
+	t := p.t
+	if p.nullable {
+		t = t.Elem()
+	}
+	arg := reflect.New(t).Elem()
+	switch x := v.(type) {
+	case int64:
+		switch t.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if arg.OverflowInt(x) {
+				return arg, false, errfmt.Wrap(ErrNotSupportedValue, strconv.FormatInt(x, 10)+" overflows "+t.String())
+			}
+			arg.SetInt(x)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if x < 0 || arg.OverflowUint(uint64(x)) {
+				return arg, false, errfmt.Wrap(ErrNotSupportedValue, strconv.FormatInt(x, 10)+" overflows "+t.String())
+			}
+			arg.SetUint(uint64(x))
+		}
+	case string:
+		if t.Kind() == reflect.String {
+			arg.SetString(x)
+		} else {
+			arg.SetBytes([]byte(x))
+		}
+	default:
+		return arg, false, errfmt.Wrap(ErrNotSupportedValue, fmt.Sprintf("%T", v))
+	}
+	if p.nullable {
+		return arg.Addr(), true, nil
+	}
+	return arg, true, nil
+}
+
+// goSignature is the parameters and the result of the Go function.
+type goSignature struct {
+	name     string
+	params   []goParam
+	variadic bool
+	// result is the type of the result, or Unknown if the function returns no value.
+	result expr.Type
+	// hasErr is a flag indicating whether the last result is an error.
+	hasErr bool
+}
+
+// newGoSignature returns the signature of the function type whose first skip
+// parameters are not the arguments. If needResult is true, the function must
+// return a value.
+func newGoSignature(name string, t reflect.Type, skip int, needResult bool) (*goSignature, error) {
+	s := &goSignature{name: name, variadic: t.IsVariadic()}
+	for i := skip; i < t.NumIn(); i++ {
+		in := t.In(i)
+		if s.variadic && i == t.NumIn()-1 {
+			in = in.Elem()
+		}
+		p, err := newGoParam(in)
+		if err != nil {
+			return nil, errfmt.Wrap(err, fmt.Sprintf("parameter %d of %s", i-skip+1, name))
+		}
+		s.params = append(s.params, p)
+	}
+	out := t.NumOut()
+	if out > 0 && t.Out(out-1) == errorType {
+		s.hasErr = true
+		out--
+	}
+	switch {
+	case out > 1 || (out == 0 && needResult):
+		return nil, errfmt.Wrap(ErrNotSupportedFuncType, name+" must return a value and optionally an error")
+	case out == 1 && !needResult:
+		return nil, errfmt.Wrap(ErrNotSupportedFuncType, name+" must return only an error")
+	case out == 1:
+		var err error
+		if s.result, err = sqlTypeOf(t.Out(0)); err != nil {
+			return nil, errfmt.Wrap(err, "result of "+name)
+		}
+	}
+	return s, nil
+}
+
+// sqlParams returns the types of the SQL parameters.
+func (s *goSignature) sqlParams() []expr.Type {
+	types := make([]expr.Type, len(s.params))
+	for i, p := range s.params {
+		types[i] = p.sqlType
+	}
+	return types
+}
+
+// minArgs returns the number of the required arguments.
+func (s *goSignature) minArgs() int {
+	if s.variadic {
+		return len(s.params) - 1
+	}
+	return len(s.params)
+}
+
+// call calls the function with the SQL values, and returns the result
+// converted to the SQL value. The result is NULL without calling the function
+// if NULL is passed to the parameter that is not nullable.
+func (s *goSignature) call(fn reflect.Value, args []interface{}) (interface{}, error) {
+	in := make([]reflect.Value, len(args))
+	for i, a := range args {
+		p := s.params[len(s.params)-1]
+		if i < len(s.params) {
+			p = s.params[i]
+		}
+		v, ok, err := p.convert(a)
+		if err != nil || !ok {
+			return nil, err
+		}
+		in[i] = v
+	}
+	out := fn.Call(in)
+	if s.hasErr {
+		if err, _ := out[len(out)-1].Interface().(error); err != nil {
+			return nil, err
+		}
+		out = out[:len(out)-1]
+	}
+	if len(out) == 0 {
+		return nil, nil
+	}
+	v, err := driver.DefaultParameterConverter.ConvertValue(out[0].Interface())
+	if err != nil {
+		return nil, errfmt.Wrap(ErrNotSupportedValue, err.Error())
+	}
+	return convertValue(v)
+}
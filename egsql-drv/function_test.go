@@ -0,0 +1,276 @@
+package egsql
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// sumAggregator sums the integers, and counts the NULL values.
+type sumAggregator struct {
+	sum, nulls int64
+}
+
+func (a *sumAggregator) Step(v *int64) {
+	if v == nil {
+		a.nulls++
+		return
+	}
+	a.sum += *v
+}
+
+func (a *sumAggregator) Final() (string, error) {
+	if a.sum < 0 {
+		return "", errors.New("negative sum")
+	}
+	return strings.Repeat("*", int(a.sum)) + strings.Repeat("?", int(a.nulls)), nil
+}
+
+// joinAggregator joins the strings.
+type joinAggregator struct {
+	values []string
+}
+
+func (a *joinAggregator) Step(s string, sep string) {
+	a.values = append(a.values, s, sep)
+}
+
+func (a *joinAggregator) Final() string {
+	if len(a.values) == 0 {
+		return ""
+	}
+	return strings.Join(a.values[:len(a.values)-1], "")
+}
+
+func TestRegisterFunc(t *testing.T) {
+	db, err := sql.Open("egsql", t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for _, sql := range []string{
+		"CREATE TABLE posts (id INT PRIMARY KEY, title TEXT, stars INT)",
+		"INSERT INTO posts VALUES (1, 'Hello, World', 2), (2, 'Go  Tips', NULL), (3, NULL, 1)",
+	} {
+		if _, err := db.Exec(sql); err != nil {
+			t.Fatal(err)
+		}
+	}
+	funcs := map[string]interface{}{
+		"slugify": func(s string) string {
+			return strings.Join(strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+				return !('a' <= r && r <= 'z' || '0' <= r && r <= '9')
+			}), "-")
+		},
+		"is_even": func(n uint8) int {
+			if n%2 == 0 {
+				return 1
+			}
+			return 0
+		},
+		"half": func(n int64) (int64, error) {
+			if n < 0 {
+				return 0, errors.New("negative")
+			}
+			return n / 2, nil
+		},
+		"or_default": func(s *string, def string) *string {
+			if s == nil {
+				return &def
+			}
+			return s
+		},
+		"concat_all": func(sep []byte, values ...string) string { return strings.Join(values, string(sep)) },
+	}
+	for name, fn := range funcs {
+		if err := RegisterFunc(db, name, fn); err != nil {
+			t.Fatalf("RegisterFunc(%s) error = %v", name, err)
+		}
+	}
+	if err := RegisterAggregate(db, "stars", func() *sumAggregator { return &sumAggregator{} }); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterAggregate(db, "joined", func() *joinAggregator { return &joinAggregator{} }); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		sql      string
+		args     []interface{}
+		wantRows [][]interface{}
+		wantErr  bool
+	}{
+		{
+			name:     "[Success] scalar functions",
+			sql:      "SELECT slugify(title), is_even(stars), half(stars), or_default(title, 'untitled') FROM posts ORDER BY id",
+			wantRows: [][]interface{}{{"hello-world", int64(1), int64(1), "Hello, World"}, {"go-tips", nil, nil, "Go  Tips"}, {nil, int64(0), int64(0), "untitled"}},
+		},
+		{
+			name:     "[Success] variadic function with placeholder",
+			sql:      "SELECT concat_all(?, 'a', 'b', 'c'), concat_all(',')",
+			args:     []interface{}{"+"},
+			wantRows: [][]interface{}{{"a+b+c", ""}},
+		},
+		{
+			name:     "[Success] aggregate functions",
+			sql:      "SELECT stars(stars), joined(title, ' / ') FROM posts",
+			wantRows: [][]interface{}{{"***?", "Hello, World / Go  Tips"}},
+		},
+		{
+			name:    "[Error] function returns error",
+			sql:     "SELECT half(-2)",
+			wantErr: true,
+		},
+		{
+			name:    "[Error] argument overflows parameter",
+			sql:     "SELECT is_even(256)",
+			wantErr: true,
+		},
+		{
+			name:    "[Error] aggregator returns error",
+			sql:     "SELECT stars(stars - 10) FROM posts",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := queryRows(db, tt.sql, tt.args...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Query() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(tt.wantRows, got); err == nil && diff != "" {
+				t.Errorf("rows mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRegisterFunc_Error(t *testing.T) {
+	db, err := sql.Open("egsql", t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	tests := []struct {
+		name string
+		fn   interface{}
+	}{
+		{name: "[Error] not a function", fn: "slugify"},
+		{name: "[Error] no result", fn: func(s string) {}},
+		{name: "[Error] too many results", fn: func(s string) (string, string) { return s, s }},
+		{name: "[Error] not supported parameter", fn: func(m map[string]string) string { return "" }},
+		{name: "[Error] not supported result", fn: func() interface{} { return nil }},
+		{name: "[Error] float result", fn: func(n int64) float64 { return float64(n) / 2 }},
+		{name: "[Error] float parameter", fn: func(f float32) int64 { return int64(f) }},
+		{name: "[Error] bool result", fn: func(n int64) bool { return n > 0 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := RegisterFunc(db, "f", tt.fn); !errors.Is(err, ErrNotSupportedFuncType) {
+				t.Errorf("RegisterFunc() error = %v, want %v", err, ErrNotSupportedFuncType)
+			}
+		})
+	}
+	if err := RegisterAggregate(db, "agg", func() string { return "" }); !errors.Is(err, ErrNotSupportedFuncType) {
+		t.Errorf("RegisterAggregate() error = %v, want %v", err, ErrNotSupportedFuncType)
+	}
+}
+
+func TestNewConnector_WithFunc(t *testing.T) {
+	c, err := NewConnector(t.TempDir(),
+		WithFunc("twice", func(n int) int { return n * 2 }),
+		WithAggregate("stars", func() *sumAggregator { return &sumAggregator{} }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := sql.OpenDB(c)
+	defer db.Close()
+
+	got, err := queryRows(db, "SELECT twice(21), stars(1)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([][]interface{}{{int64(42), "*"}}, got); diff != "" {
+		t.Errorf("rows mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err := NewConnector(t.TempDir(), WithFunc("bad", 1)); !errors.Is(err, ErrNotSupportedFuncType) {
+		t.Errorf("NewConnector() error = %v, want %v", err, ErrNotSupportedFuncType)
+	}
+}
+
+func TestRegisterFunc_SharedByHomeDir(t *testing.T) {
+	home := t.TempDir()
+	c, err := NewConnector(home, WithFunc("answer", func() int { return 1 }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db1 := sql.OpenDB(c)
+	defer db1.Close()
+	if _, err := queryRows(db1, "SELECT answer()"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The other sql.DB of the same home directory sees the function, and
+	// its registration replaces the function for all of them.
+	db2, err := sql.Open("egsql", home)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db2.Close()
+	if err := RegisterFunc(db2, "answer", func() int { return 42 }); err != nil {
+		t.Fatal(err)
+	}
+	for _, db := range []*sql.DB{db1, db2} {
+		got, err := queryRows(db, "SELECT answer()")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff([][]interface{}{{int64(42)}}, got); diff != "" {
+			t.Errorf("rows mismatch (-want +got):\n%s", diff)
+		}
+	}
+
+	// The database of another home directory does not have the function.
+	other, err := sql.Open("egsql", t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	if _, err := queryRows(other, "SELECT answer()"); err == nil {
+		t.Errorf("function is visible in the database of another home directory")
+	}
+}
+
+// queryRows returns all rows of the query.
+func queryRows(db *sql.DB, query string, args ...interface{}) ([][]interface{}, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	var got [][]interface{}
+	for rows.Next() {
+		row := make([]interface{}, len(columns))
+		ptrs := make([]interface{}, len(columns))
+		for i := range row {
+			ptrs[i] = &row[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		got = append(got, row)
+	}
+	return got, rows.Err()
+}
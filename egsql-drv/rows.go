@@ -2,21 +2,33 @@ package egsql
 
 import (
 	"database/sql/driver"
+
+	"github.com/nao1215/egsql/dbms"
+	"github.com/nao1215/egsql/dbms/executor"
 )
 
-type egsqlRows struct{}
+// egsqlRows is the rows returned by the query. The rows are read from
+// the cursor a batch at a time.
+type egsqlRows struct {
+	rows *dbms.Rows
+	// batch is the current batch, or nil before the first one is read.
+	batch *executor.Batch
+	// pos is the position of the next row in the batch.
+	pos int
+}
 
 // Columns returns the names of the columns. The number of
 // columns of the result is inferred from the length of the
 // slice. If a particular column name isn't known, an empty
 // string should be returned for that entry.
 func (rows *egsqlRows) Columns() []string {
-	return []string{}
+	return rows.rows.Columns()
 }
 
 // Close closes the rows iterator.
 func (rows *egsqlRows) Close() (err error) {
-	return nil
+	rows.batch = nil
+	return rows.rows.Close()
 }
 
 // Next is called to populate the next row of data into
@@ -29,5 +41,17 @@ func (rows *egsqlRows) Close() (err error) {
 // should be taken when closing Rows not to modify
 // a buffer held in dest.
 func (rows *egsqlRows) Next(dest []driver.Value) error {
+	for rows.batch == nil || rows.pos >= rows.batch.Len {
+		batch, err := rows.rows.NextBatch()
+		if err != nil {
+			return err
+		}
+		rows.batch, rows.pos = batch, 0
+	}
+	// The values are int64, string or nil, which are valid driver.Value as is.
+	for i, v := range rows.batch.Vectors {
+		dest[i] = v[rows.pos]
+	}
+	rows.pos++
 	return nil
 }
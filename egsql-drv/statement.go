@@ -1,8 +1,38 @@
 package egsql
 
-import "database/sql/driver"
+import (
+	"context"
+	"database/sql/driver"
 
-type egsqlStmt struct{}
+	"github.com/nao1215/egsql/dbms"
+)
+
+type egsqlStmt struct {
+	conn *egsqlConn
+	// query is the SQL text of the statement.
+	query string
+	// prepared is the statement shared through the plan cache of the database.
+	prepared *dbms.PreparedStmt
+	// version is the version of the table definitions when the statement was prepared.
+	version uint64
+}
+
+// prepare parses the SQL text, or gets the statement from the plan cache
+// of the database. The statement is prepared again when the table
+// definitions have changed (e.g. DROP TABLE) since it was prepared, so that
+// it does not use the definitions of the dropped or altered tables.
+func (stmt *egsqlStmt) prepare() error {
+	version := stmt.conn.db.Version()
+	if stmt.prepared != nil && stmt.version == version {
+		return nil
+	}
+	p, err := stmt.conn.db.Prepare(stmt.query)
+	if err != nil {
+		return err
+	}
+	stmt.prepared, stmt.version = p, version
+	return nil
+}
 
 // Close closes the statement.
 func (stmt *egsqlStmt) Close() error {
@@ -11,17 +41,56 @@ func (stmt *egsqlStmt) Close() error {
 
 // NumInput returns the number of placeholder parameters.
 func (stmt *egsqlStmt) NumInput() int {
-	return 0
+	return stmt.prepared.NumInput
 }
 
 // Exec executes a query that doesn't return rows, such as an INSERT or UPDATE.
 // Deprecated: Drivers should implement StmtExecContext instead (or additionally).
 func (stmt *egsqlStmt) Exec(args []driver.Value) (driver.Result, error) {
-	return &egsqlResult{}, nil
+	if err := stmt.prepare(); err != nil {
+		return nil, err
+	}
+	values, err := convertArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	rs, err := stmt.conn.db.Exec(stmt.conn.session, stmt.prepared.Stmt, values)
+	if err != nil {
+		return nil, err
+	}
+	return &egsqlResult{affectedRows: rs.AffectedRows, insertID: rs.LastInsertID}, nil
 }
 
 // Query executes a query that may return rows, such as a SELECT.
 // Deprecated: Drivers should implement StmtQueryContext instead (or additionally).
+// The statement that does not return rows is executed, and no rows are returned.
 func (stmt *egsqlStmt) Query(args []driver.Value) (driver.Rows, error) {
-	return &egsqlRows{}, nil
+	return stmt.queryContext(context.Background(), args)
+}
+
+// QueryContext executes a query that may return rows, such as a SELECT.
+// When the context is done, the query stops and its temporary files are removed.
+func (stmt *egsqlStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	return stmt.queryContext(ctx, values)
+}
+
+// queryContext executes the query with the context. SELECT statement is
+// executed with the plan cached by the plan cache of the database.
+func (stmt *egsqlStmt) queryContext(ctx context.Context, args []driver.Value) (driver.Rows, error) {
+	if err := stmt.prepare(); err != nil {
+		return nil, err
+	}
+	values, err := convertArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := stmt.conn.db.QueryPrepared(ctx, stmt.conn.session, stmt.prepared, values)
+	if err != nil {
+		return nil, err
+	}
+	return &egsqlRows{rows: rows}, nil
 }
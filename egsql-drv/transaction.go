@@ -1,14 +1,17 @@
 package egsql
 
 type egsqlTx struct {
+	conn *egsqlConn
 }
 
 // Commit confirms changes to the database
 func (tx *egsqlTx) Commit() (err error) {
-	return nil
+	defer func() { tx.conn.session.Tx = nil }()
+	return tx.conn.session.Tx.Commit()
 }
 
 // Rollback undoes changes to the database.
 func (tx *egsqlTx) Rollback() (err error) {
-	return nil
+	defer func() { tx.conn.session.Tx = nil }()
+	return tx.conn.session.Tx.Rollback()
 }
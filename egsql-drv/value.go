@@ -0,0 +1,45 @@
+package egsql
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+
+	"github.com/nao1215/egsql/misc/errfmt"
+)
+
+// convertArgs converts the arguments to the values stored in egsql.
+// Integers are int64 and strings are string. []byte is converted to string,
+// bool to 1 or 0, and float64 to int64 if it has no fractional part.
+func convertArgs(args []driver.Value) ([]interface{}, error) {
+	values := make([]interface{}, 0, len(args))
+	for i, arg := range args {
+		v, err := convertValue(arg)
+		if err != nil {
+			return nil, errfmt.Wrap(err, fmt.Sprintf("argument %d", i+1))
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// convertValue converts the driver.Value to the value stored in egsql.
+func convertValue(v driver.Value) (interface{}, error) {
+	switch val := v.(type) {
+	case nil, int64, string:
+		return val, nil
+	case []byte:
+		return string(val), nil
+	case bool:
+		if val {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	case float64:
+		if val != math.Trunc(val) || val < math.MinInt64 || val >= math.MaxInt64 {
+			return nil, ErrNotSupportedValue
+		}
+		return int64(val), nil
+	}
+	return nil, ErrNotSupportedValue
+}